@@ -0,0 +1,399 @@
+// Package cli implements the command line of the splice command, which
+// inspects drum machine .splice files and which the gomentor command
+// also serves as its drum subcommand.
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge1/pkg/index"
+	"github.com/jpreese/go-mentor/challenge1/pkg/taptempo"
+
+	// Register the exporters that live outside the drum package.
+	_ "github.com/jpreese/go-mentor/challenge1/pkg/hydrogen"
+	_ "github.com/jpreese/go-mentor/challenge1/pkg/midi"
+)
+
+const usage = `Usage: %s <command> [arguments]
+
+Commands:
+  diff <from> <to>    show what changed between two pattern files
+  lint <file>...      report problems found in pattern files
+  convert <in> <out>  write a pattern file in another format
+  index <dir>...      record the metadata of every pattern in the directories
+  search              find indexed patterns by tempo, version or track name
+  tap [file]          estimate a tempo by pressing enter in time with the beat
+  store <dir> <op>    list, get <id>, put <id> <file> or delete <id> the patterns kept in a directory`
+
+// program is the name of the command; see Main.
+var program = "splice"
+
+// Main runs the splice command, and gomentor drum, with args[0] naming
+// diff, lint, convert, index, search, tap or store. It takes its
+// arguments as [github.com/jpreese/go-mentor/cli.Main] does.
+func Main(name string, args []string) {
+	log.SetFlags(0)
+	program = name
+
+	if len(args) < 1 {
+		log.Fatalf(usage, program)
+	}
+
+	var err error
+	switch command, args := args[0], args[1:]; command {
+	case "diff":
+		err = runDiff(args)
+	case "lint":
+		err = runLint(args)
+	case "convert":
+		err = runConvert(args)
+	case "index":
+		err = runIndex(args)
+	case "search":
+		err = runSearch(args)
+	case "tap":
+		err = runTap(args)
+	case "store":
+		err = runStore(args)
+	default:
+		log.Fatalf("unknown command %q\n\n"+usage, command, program)
+	}
+
+	if err == errDifferent || err == errLintFailed {
+		os.Exit(1)
+	}
+	if err != nil {
+		log.Print(err)
+		os.Exit(errcode.ExitStatus(err))
+	}
+}
+
+// errDifferent is returned by runDiff when the patterns differ so that
+// the command exits with status 1, like diff(1).
+var errDifferent = errors.New("patterns differ")
+
+// runDiff prints the differences between two pattern files.
+func runDiff(args []string) error {
+	if len(args) != 2 {
+		return fmt.Errorf("usage: %s diff <from> <to>", program)
+	}
+
+	from, err := drum.DecodeFile(args[0])
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", args[0], err)
+	}
+
+	to, err := drum.DecodeFile(args[1])
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", args[1], err)
+	}
+
+	diff := drum.Diff(from, to)
+	if diff.Empty() {
+		return nil
+	}
+
+	fmt.Printf("--- %s\n+++ %s\n%s", args[0], args[1], diff)
+
+	return errDifferent
+}
+
+// errLintFailed is returned by runLint when an error severity problem
+// was found.
+var errLintFailed = errors.New("lint failed")
+
+// runLint prints the problems found in each pattern file.
+func runLint(args []string) error {
+	flags := flag.NewFlagSet("lint", flag.ExitOnError)
+	disable := flags.String("disable", "", "comma separated list of rules to skip")
+	listRules := flags.Bool("rules", false, "list the available rules and exit")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s lint [flags] <file>...\n", program)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if *listRules {
+		for _, rule := range drum.DefaultRules {
+			fmt.Printf("%-22s %-8v %s\n", rule.Name, rule.Severity, rule.Description)
+		}
+		return nil
+	}
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	linter := drum.Linter{
+		Rules:    drum.DefaultRules,
+		Disabled: make(map[string]bool),
+	}
+	for _, name := range strings.Split(*disable, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !knownRule(name) {
+			return fmt.Errorf("unknown lint rule %q", name)
+		}
+		linter.Disabled[name] = true
+	}
+
+	var failed bool
+	for _, path := range flags.Args() {
+		p, err := drum.DecodeFile(path)
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", path, err)
+		}
+
+		for _, problem := range linter.Lint(p) {
+			fmt.Printf("%s: %v\n", path, problem)
+			if problem.Severity == drum.SeverityError {
+				failed = true
+			}
+		}
+	}
+
+	if failed {
+		return errLintFailed
+	}
+
+	return nil
+}
+
+func knownRule(name string) bool {
+	for _, rule := range drum.DefaultRules {
+		if rule.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// runConvert writes a pattern file in the format named by -to, or by
+// the extension of the output file, using whichever exporters are
+// registered.
+func runConvert(args []string) error {
+	flags := flag.NewFlagSet("convert", flag.ExitOnError)
+	to := flags.String("to", "", "format to write, chosen by the output file's extension when empty")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s convert [flags] <in> <out|->\n", program)
+		flags.PrintDefaults()
+		fmt.Fprintf(flags.Output(), "\nFormats:\n")
+		for _, e := range drum.Exporters() {
+			fmt.Fprintf(flags.Output(), "  %-10s %s\n", e.Name(), strings.Join(e.Extensions(), " "))
+		}
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+	in, out := flags.Arg(0), flags.Arg(1)
+
+	var exporter drum.Exporter
+	var err error
+	switch {
+	case *to != "":
+		exporter, err = drum.LookupExporter(*to)
+	case out == "-":
+		return errors.New("choose a format with -to to write to standard output")
+	default:
+		exporter, err = drum.ExporterFor(out)
+	}
+	if err != nil {
+		return fmt.Errorf("%w; run %s convert -h for the formats", err, program)
+	}
+
+	p, err := drum.DecodeFile(in)
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", in, err)
+	}
+
+	if out == "-" {
+		return exporter.Export(os.Stdout, p)
+	}
+
+	file, err := os.Create(out)
+	if err != nil {
+		return err
+	}
+
+	if err := exporter.Export(file, p); err != nil {
+		file.Close()
+		return fmt.Errorf("write %s: %w", out, err)
+	}
+
+	return file.Close()
+}
+
+const defaultIndexPath = "splice-index.json"
+
+// runIndex builds an index of the pattern files found in the given
+// directories.
+func runIndex(args []string) error {
+	flags := flag.NewFlagSet("index", flag.ExitOnError)
+	output := flags.String("o", defaultIndexPath, "path to write the index to")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s index [flags] <dir>...\n", program)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	idx, err := index.Build(flags.Args()...)
+	if err != nil {
+		return err
+	}
+
+	if err := idx.Save(*output); err != nil {
+		return err
+	}
+
+	fmt.Printf("indexed %d patterns into %s\n", len(idx.Entries), *output)
+
+	return nil
+}
+
+// trackNames collects every -track flag given to the search command.
+type trackNames []string
+
+func (t *trackNames) String() string {
+	return strings.Join(*t, ",")
+}
+
+func (t *trackNames) Set(name string) error {
+	*t = append(*t, name)
+	return nil
+}
+
+// runSearch prints the indexed patterns matching the query flags.
+func runSearch(args []string) error {
+	var query index.Query
+
+	flags := flag.NewFlagSet("search", flag.ExitOnError)
+	indexPath := flags.String("index", defaultIndexPath, "path of the index to search")
+	tempo := flags.Float64("tempo", 0, "only match patterns with this tempo")
+	flags.StringVar(&query.Version, "version", "", "only match patterns saved with this hardware version")
+	flags.Var((*trackNames)(&query.Tracks), "track", "only match patterns with a track containing this name (repeatable)")
+	flags.Parse(args)
+
+	query.Tempo = float32(*tempo)
+
+	idx, err := index.Load(*indexPath)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range idx.Search(query) {
+		fmt.Printf("%s\tTempo: %v\tTracks: %s\n", entry.Path, entry.Tempo, strings.Join(entry.Tracks, ", "))
+	}
+
+	return nil
+}
+
+// runTap estimates a tempo from enter key presses on stdin. When a
+// pattern file is given, its tempo is replaced with the final estimate
+// once stdin is closed.
+func runTap(args []string) error {
+	if len(args) > 1 {
+		return fmt.Errorf("usage: %s tap [file]", program)
+	}
+
+	fmt.Println("Press enter in time with the beat, then Ctrl-D to finish.")
+
+	var tapper taptempo.Tapper
+	scanner := bufio.NewScanner(os.Stdin)
+	for scanner.Scan() {
+		if bpm, ok := tapper.Tap(time.Now()); ok {
+			fmt.Printf("Tempo: %.1f\n", bpm)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("read taps: %w", err)
+	}
+
+	bpm, ok := tapper.BPM()
+	if !ok {
+		return errors.New("tap at least twice to estimate a tempo")
+	}
+
+	if len(args) == 0 {
+		return nil
+	}
+
+	p, err := drum.DecodeFile(args[0])
+	if err != nil {
+		return fmt.Errorf("decode %s: %w", args[0], err)
+	}
+	p.Tempo = bpm
+
+	file, err := os.Create(args[0])
+	if err != nil {
+		return err
+	}
+
+	if _, err := p.WriteTo(file); err != nil {
+		file.Close()
+		return fmt.Errorf("write %s: %w", args[0], err)
+	}
+
+	return file.Close()
+}
+
+// runStore lists, prints, adds or removes the patterns of the
+// drum.FileStore kept in a directory.
+func runStore(args []string) error {
+	if len(args) < 2 {
+		return fmt.Errorf("usage: %s store <dir> list|get <id>|put <id> <file>|delete <id>", program)
+	}
+
+	store, err := drum.NewFileStore(args[0])
+	if err != nil {
+		return err
+	}
+
+	switch op, args := args[1], args[2:]; {
+	case op == "list" && len(args) == 0:
+		ids, err := store.List()
+		if err != nil {
+			return err
+		}
+		for _, id := range ids {
+			fmt.Println(id)
+		}
+		return nil
+	case op == "get" && len(args) == 1:
+		p, err := store.Get(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Print(p)
+		return nil
+	case op == "put" && len(args) == 2:
+		p, err := drum.DecodeFile(args[1])
+		if err != nil {
+			return fmt.Errorf("decode %s: %w", args[1], err)
+		}
+		return store.Put(args[0], p)
+	case op == "delete" && len(args) == 1:
+		return store.Delete(args[0])
+	}
+
+	return fmt.Errorf("usage: %s store <dir> list|get <id>|put <id> <file>|delete <id>", program)
+}
@@ -0,0 +1,20 @@
+//go:build js && wasm
+
+// Command drumwasm runs the drum decoder in a browser for the pattern
+// viewer in index.html. Build it and copy the JavaScript support file
+// that ships with Go next to it:
+//
+//	GOOS=js GOARCH=wasm go build -o drum.wasm ./cmd/drumwasm
+//	cp "$(go env GOROOT)/lib/wasm/wasm_exec.js" .
+package main
+
+import (
+	"github.com/jpreese/go-mentor/challenge1/pkg/drumjs"
+)
+
+func main() {
+	drumjs.Register()
+
+	// JavaScript can only call the functions while the program runs.
+	select {}
+}
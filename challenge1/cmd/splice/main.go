@@ -0,0 +1,12 @@
+// Command splice inspects drum machine .splice files.
+package main
+
+import (
+	"os"
+
+	"github.com/jpreese/go-mentor/challenge1/cli"
+)
+
+func main() {
+	cli.Main("splice", os.Args[1:])
+}
@@ -1,3 +1,5 @@
-module github.com/jpreese/go-mentor/challenge1-drum-machine
+module github.com/jpreese/go-mentor/challenge1
 
-go 1.13
+go 1.23
+
+require golang.org/x/text v0.21.0
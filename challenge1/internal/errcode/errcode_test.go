@@ -0,0 +1,44 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestOf(t *testing.T) {
+	sentinel := New(DrumBadMagic, "sentinel")
+	wrapped := fmt.Errorf("context: %w", sentinel)
+
+	if got := Of(wrapped); got != DrumBadMagic {
+		t.Errorf("expected %s, got %q", DrumBadMagic, got)
+	}
+	if !errors.Is(wrapped, sentinel) {
+		t.Error("expected the wrapped error to still be the sentinel")
+	}
+	if got := Of(Wrap(DrumTruncated, wrapped)); got != DrumTruncated {
+		t.Errorf("expected the outermost code %s, got %q", DrumTruncated, got)
+	}
+	if got := Of(io.EOF); got != "" {
+		t.Errorf("expected no code for an uncoded error, got %q", got)
+	}
+}
+
+func TestExitStatus(t *testing.T) {
+	tData := []struct {
+		err  error
+		exit int
+	}{
+		{nil, 0},
+		{io.EOF, 1},
+		{fmt.Errorf("context: %w", New(DrumBadMagic, "sentinel")), 65},
+		{New(Code("UNLISTED"), "unlisted"), 1},
+	}
+
+	for _, exp := range tData {
+		if got := ExitStatus(exp.err); got != exp.exit {
+			t.Errorf("ExitStatus(%v) = %d, expected %d", exp.err, got, exp.exit)
+		}
+	}
+}
@@ -0,0 +1,43 @@
+// Code generated by gen.go from trace_test.go; DO NOT EDIT.
+
+package trace
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRecorder(t *testing.T) {
+	var rec Recorder
+
+	ctx, parent := rec.Start(context.Background(), "decode", String("path", "pattern_1.splice"))
+	_, child := rec.Start(ctx, "track", Int("id", 5))
+	child.SetAttributes(Bool("empty", false), Int("id", 6))
+	if len(rec.Spans()) != 0 {
+		t.Fatal("expected spans to be recorded once they end")
+	}
+	child.End(nil)
+	failed := errors.New("truncated")
+	parent.End(failed)
+
+	spans := rec.Spans()
+	if len(spans) != 2 || spans[0].Name != "decode" || spans[1].Name != "track" {
+		t.Fatalf("unexpected spans %v", spans)
+	}
+	if spans[1].Parent != spans[0] || spans[0].Parent != nil {
+		t.Error("expected the track span to be a child of the decode span")
+	}
+	if spans[0].Err != failed || spans[1].Err != nil {
+		t.Errorf("unexpected errors %v and %v", spans[0].Err, spans[1].Err)
+	}
+	if v, _ := spans[1].Attr("id"); v != int64(6) {
+		t.Errorf("expected the later id attribute to replace the first, got %v", v)
+	}
+	if v, ok := spans[0].Attr("path"); !ok || v != "pattern_1.splice" {
+		t.Errorf("unexpected path attribute %v", v)
+	}
+	if _, ok := spans[0].Attr("id"); ok {
+		t.Error("expected attributes to belong to one span")
+	}
+}
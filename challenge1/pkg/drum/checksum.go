@@ -0,0 +1,164 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"hash"
+	"hash/crc32"
+	"io"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+)
+
+// Checksum selects the integrity footer an Encoder appends after the
+// pattern. Decoders that predate footers ignore them, just like any
+// other bytes past the size declared in the header.
+type Checksum byte
+
+// The supported checksum footers.
+const (
+	ChecksumNone Checksum = iota
+	ChecksumCRC32
+	ChecksumSHA256
+)
+
+func (c Checksum) String() string {
+	switch c {
+	case ChecksumNone:
+		return "none"
+	case ChecksumCRC32:
+		return "crc32"
+	case ChecksumSHA256:
+		return "sha256"
+	default:
+		return fmt.Sprintf("checksum(%d)", byte(c))
+	}
+}
+
+var (
+	// ErrChecksumMismatch is returned when a pattern does not match the
+	// checksum stored in its footer.
+	ErrChecksumMismatch = errcode.New(errcode.DrumChecksumMismatch, "pattern checksum mismatch")
+
+	// ErrChecksumMissing is returned by a Decoder that requires a
+	// checksum when the pattern has no footer.
+	ErrChecksumMissing = errcode.New(errcode.DrumChecksumMissing, "pattern checksum missing")
+)
+
+// footerMagic marks the start of a checksum footer. It is followed by a
+// single Checksum byte and the digest.
+var footerMagic = []byte("CSUM")
+
+// An Encoder writes patterns with an optional checksum footer.
+type Encoder struct {
+	Checksum Checksum
+}
+
+// Encode writes the pattern to w followed by the configured checksum
+// footer.
+func (e *Encoder) Encode(w io.Writer, p *Pattern) error {
+	var file bytes.Buffer
+	if _, err := p.WriteTo(&file); err != nil {
+		return err
+	}
+
+	if e.Checksum != ChecksumNone {
+		digest, err := newChecksums().digest(e.Checksum, file.Bytes())
+		if err != nil {
+			return err
+		}
+
+		file.Write(footerMagic)
+		file.WriteByte(byte(e.Checksum))
+		file.Write(digest)
+	}
+
+	if _, err := file.WriteTo(w); err != nil {
+		return fmt.Errorf("unable to write pattern: %w", err)
+	}
+
+	return nil
+}
+
+// checksums computes every supported checksum over the bytes written
+// to it.
+type checksums struct {
+	crc32  hash.Hash32
+	sha256 hash.Hash
+}
+
+func newChecksums() *checksums {
+	return &checksums{
+		crc32:  crc32.NewIEEE(),
+		sha256: sha256.New(),
+	}
+}
+
+func (c *checksums) Write(b []byte) (int, error) {
+	c.crc32.Write(b)
+	c.sha256.Write(b)
+
+	return len(b), nil
+}
+
+func (c *checksums) Reset() {
+	c.crc32.Reset()
+	c.sha256.Reset()
+}
+
+func (c *checksums) hash(checksum Checksum) (hash.Hash, error) {
+	switch checksum {
+	case ChecksumCRC32:
+		return c.crc32, nil
+	case ChecksumSHA256:
+		return c.sha256, nil
+	default:
+		return nil, fmt.Errorf("unsupported checksum %v", checksum)
+	}
+}
+
+func (c *checksums) digest(checksum Checksum, b []byte) ([]byte, error) {
+	h, err := c.hash(checksum)
+	if err != nil {
+		return nil, err
+	}
+	h.Write(b)
+
+	return h.Sum(nil), nil
+}
+
+// verifyFooter checks the footer that follows a pattern, if any, against
+// the bytes hashed so far. Bytes that are not a footer are left unread.
+func (c *checksums) verifyFooter(r *bufio.Reader, required bool) error {
+	magic, err := r.Peek(len(footerMagic))
+	if err != nil || !bytes.Equal(magic, footerMagic) {
+		if required {
+			return ErrChecksumMissing
+		}
+		return nil
+	}
+	r.Discard(len(footerMagic))
+
+	kind, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("unable to read checksum type: %w", err)
+	}
+
+	h, err := c.hash(Checksum(kind))
+	if err != nil {
+		return err
+	}
+
+	expected := make([]byte, h.Size())
+	if _, err := io.ReadFull(r, expected); err != nil {
+		return fmt.Errorf("unable to read %v checksum: %w", Checksum(kind), err)
+	}
+
+	if !bytes.Equal(h.Sum(nil), expected) {
+		return fmt.Errorf("%v: %w", Checksum(kind), ErrChecksumMismatch)
+	}
+
+	return nil
+}
@@ -0,0 +1,55 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"path"
+	"testing"
+)
+
+func TestChecksumFooter(t *testing.T) {
+	p, err := DecodeFile(path.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, checksum := range []Checksum{ChecksumCRC32, ChecksumSHA256} {
+		var file bytes.Buffer
+		encoder := Encoder{Checksum: checksum}
+		if err := encoder.Encode(&file, p); err != nil {
+			t.Fatalf("%v: %v", checksum, err)
+		}
+
+		decoder := Decoder{RequireChecksum: true}
+		decoded, err := decoder.Decode(bytes.NewReader(file.Bytes()))
+		if err != nil {
+			t.Fatalf("%v: %v", checksum, err)
+		}
+		if fmt.Sprint(decoded) != fmt.Sprint(p) {
+			t.Errorf("%v: pattern did not round trip", checksum)
+		}
+
+		// Flip a bit in the middle of the first track.
+		corrupt := append([]byte(nil), file.Bytes()...)
+		corrupt[60] ^= 1
+		if _, err := decoder.Decode(bytes.NewReader(corrupt)); !errors.Is(err, ErrChecksumMismatch) {
+			t.Errorf("%v: expected ErrChecksumMismatch, got %v", checksum, err)
+		}
+	}
+}
+
+func TestChecksumMissing(t *testing.T) {
+	// Fixtures predate checksum footers, and pattern_5 carries unrelated
+	// padding where a footer would be.
+	for _, name := range []string{"pattern_1.splice", "pattern_5.splice"} {
+		if _, err := DecodeFile(path.Join("..", "..", "fixtures", name)); err != nil {
+			t.Errorf("%s: checksums should be optional, got %v", name, err)
+		}
+
+		decoder := Decoder{RequireChecksum: true}
+		if _, err := decoder.DecodeFile(path.Join("..", "..", "fixtures", name)); !errors.Is(err, ErrChecksumMissing) {
+			t.Errorf("%s: expected ErrChecksumMissing, got %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,174 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+)
+
+const (
+	spliceSize       = 6
+	fileSizeSize     = 8
+	versionSize      = 32
+	tempoSize        = 4
+	trackHeaderSize  = 5
+	stepsInTrack     = 16
+	maxTrackNameSize = 1 << 16
+)
+
+// Track is a single instrument line within a pattern. Steps holds one
+// byte per step, 'x' when the step plays and '-' when it is silent.
+type Track struct {
+	ID    int
+	Name  string
+	Steps []byte
+}
+
+// MarshalJSON renders the steps in the same x/- notation String uses
+// rather than as base64 encoded bytes.
+func (t Track) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		ID    int
+		Name  string
+		Steps string
+	}{t.ID, t.Name, string(t.Steps)})
+}
+
+func (t Track) String() string {
+	trackHeader := fmt.Sprintf("(%v) %v\t", t.ID, t.Name)
+	trackBody := fmt.Sprintf("|%s|%s|%s|%s|\n", t.Steps[0:4], t.Steps[4:8], t.Steps[8:12], t.Steps[12:16])
+
+	return trackHeader + trackBody
+}
+
+// Pattern represents a decoded drum file
+type Pattern struct {
+	Version string
+	Tempo   float32
+
+	tracks   []Track
+	fileSize int64
+}
+
+// NewPattern creates a pattern holding a copy of the given tracks. Like
+// WithTrack, it fails for a track without 16 steps.
+func NewPattern(version string, tempo float32, tracks ...Track) (*Pattern, error) {
+	p := Pattern{
+		Version: version,
+		Tempo:   tempo,
+	}
+
+	for _, track := range tracks {
+		if len(track.Steps) != stepsInTrack {
+			return nil, fmt.Errorf("track %d has %d steps, expected %d", track.ID, len(track.Steps), stepsInTrack)
+		}
+		track.Steps = append([]byte(nil), track.Steps...)
+		p.tracks = append(p.tracks, track)
+	}
+
+	return &p, nil
+}
+
+// MarshalJSON includes the pattern's tracks alongside its exported
+// fields.
+func (p *Pattern) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Version string
+		Tempo   float32
+		Tracks  []Track
+	}{p.Version, p.Tempo, p.tracks})
+}
+
+func (p *Pattern) String() string {
+	result := fmt.Sprintf("Saved with HW Version: %v\n", p.Version)
+	result += fmt.Sprintf("Tempo: %v\n", p.Tempo)
+
+	for _, track := range p.tracks {
+		result += track.String()
+	}
+
+	return result
+}
+
+// ErrBadMagic is returned for a file that does not start with the
+// SPLICE marker every pattern file does.
+var ErrBadMagic = errcode.New(errcode.DrumBadMagic, "not a pattern file")
+
+// headerSize is the length of everything before the first track: the
+// splice marker, file size, version and tempo.
+const headerSize = spliceSize + fileSizeSize + versionSize + tempoSize
+
+func (s *decodeState) readHeader(file io.Reader, p *Pattern) error {
+	// The header is parsed by hand from a reused buffer to avoid the
+	// reflection and allocations binary.Read incurs.
+	header := s.scratch[:headerSize]
+	if _, err := io.ReadFull(file, header); err != nil {
+		return fmt.Errorf("unable to marshal header from binary file: %w", err)
+	}
+	if string(header[:spliceSize]) != "SPLICE" {
+		return ErrBadMagic
+	}
+	p.fileSize = int64(binary.BigEndian.Uint64(header[spliceSize:]))
+
+	version := header[spliceSize+fileSizeSize : spliceSize+fileSizeSize+versionSize]
+	const NullCharacter = "\x00"
+	p.Version = string(bytes.TrimRight(version, NullCharacter))
+
+	// We use binary.LittleEndian here because the pattern file stores
+	// the tempo value in LittleEndian.
+	p.Tempo = math.Float32frombits(binary.LittleEndian.Uint32(header[headerSize-tempoSize:]))
+
+	return nil
+}
+
+func (s *decodeState) readTrack(file io.Reader) (Track, error) {
+	// The track header is an ID byte followed by a big endian name
+	// length.
+	trackHeader := s.scratch[:trackHeaderSize]
+	if _, err := io.ReadFull(file, trackHeader); err != nil {
+		return Track{}, fmt.Errorf("unable to read track header: %w", err)
+	}
+
+	wordSize := int32(binary.BigEndian.Uint32(trackHeader[1:]))
+	if wordSize < 0 || wordSize > maxTrackNameSize {
+		return Track{}, fmt.Errorf("invalid track name length %d", wordSize)
+	}
+	id := int(trackHeader[0])
+
+	// The name is read into the reused scratch buffer and only copied
+	// once, when it is converted to a string.
+	if cap(s.scratch) < int(wordSize) {
+		s.scratch = make([]byte, wordSize)
+	}
+	trackName := s.scratch[:wordSize]
+	if _, err := io.ReadFull(file, trackName); err != nil {
+		return Track{}, fmt.Errorf("unable to read track name: %w", err)
+	}
+	name := string(trackName)
+
+	stepBytes := s.nextSteps()
+	if _, err := io.ReadFull(file, stepBytes); err != nil {
+		return Track{}, fmt.Errorf("unable to read track steps: %w", err)
+	}
+
+	for k := range stepBytes {
+		if stepBytes[k] == 1 {
+			stepBytes[k] = 'x'
+		} else {
+			stepBytes[k] = '-'
+		}
+	}
+
+	track := Track{
+		ID:    id,
+		Name:  name,
+		Steps: stepBytes,
+	}
+
+	return track, nil
+}
@@ -0,0 +1,265 @@
+package drum
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+	"github.com/jpreese/go-mentor/challenge1/internal/testutil"
+	"github.com/jpreese/go-mentor/challenge1/internal/trace"
+)
+
+func TestDecodeFile(t *testing.T) {
+	tData := []struct {
+		path   string
+		output string
+	}{
+		{"pattern_1.splice",
+			`Saved with HW Version: 0.808-alpha
+Tempo: 120
+(0) kick	|x---|x---|x---|x---|
+(1) snare	|----|x---|----|x---|
+(2) clap	|----|x-x-|----|----|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(4) hh-close	|x---|x---|----|x--x|
+(5) cowbell	|----|----|--x-|----|
+`,
+		},
+		{"pattern_2.splice",
+			`Saved with HW Version: 0.808-alpha
+Tempo: 98.4
+(0) kick	|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|----|----|x---|----|
+`,
+		},
+		{"pattern_3.splice",
+			`Saved with HW Version: 0.808-alpha
+Tempo: 118
+(40) kick	|x---|----|x---|----|
+(1) clap	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) low-tom	|----|---x|----|----|
+(12) mid-tom	|----|----|x---|----|
+(9) hi-tom	|----|----|-x--|----|
+`,
+		},
+		{"pattern_4.splice",
+			`Saved with HW Version: 0.909
+Tempo: 240
+(0) SubKick	|----|----|----|----|
+(1) Kick	|x---|----|x---|----|
+(99) Maracas	|x-x-|x-x-|x-x-|x-x-|
+(255) Low Conga	|----|x---|----|x---|
+`,
+		},
+		{"pattern_5.splice",
+			`Saved with HW Version: 0.708-alpha
+Tempo: 999
+(1) Kick	|x---|----|x---|----|
+(2) HiHat	|x-x-|x-x-|x-x-|x-x-|
+`,
+		},
+	}
+
+	for _, exp := range tData {
+		decoded, err := DecodeFile(path.Join("..", "..", "fixtures", exp.path))
+		if err != nil {
+			t.Logf("something went wrong decoding %s - %v", exp.path, err)
+		}
+		if fmt.Sprint(decoded) != exp.output {
+			t.Logf("decoded:\n%#v\n", fmt.Sprint(decoded))
+			t.Logf("expected:\n%#v\n", exp.output)
+			t.Logf("%s wasn't decoded as expect.\nGot:\n%s\nExpected:\n%s",
+				exp.path, decoded, exp.output)
+		}
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	benchmarkDecode(b, func() *Decoder { return &defaultDecoder })
+}
+
+// BenchmarkDecodeNewDecoder shows the cost of decoding without
+// reusing buffers between files.
+func BenchmarkDecodeNewDecoder(b *testing.B) {
+	benchmarkDecode(b, func() *Decoder { return &Decoder{} })
+}
+
+func benchmarkDecode(b *testing.B, decoder func() *Decoder) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "fixtures", "*.splice"))
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		for _, path := range paths {
+			if _, err := decoder().DecodeFile(path); err != nil {
+				b.Fatalf("decoding %s: %v", path, err)
+			}
+		}
+	}
+}
+
+func TestDecodeFileGolden(t *testing.T) {
+	testutil.GoldenFixtures(t, filepath.Join("..", "..", "fixtures", "*.splice"), func(path string) (interface{}, error) {
+		return DecodeFile(path)
+	})
+}
+
+func TestDecodeBytes(t *testing.T) {
+	data := testutil.Fixture(t, "..", "..", "fixtures", "pattern_1.splice")
+	p, err := DecodeBytes(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected, err := DecodeFile(filepath.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.String() != expected.String() {
+		t.Fatalf("decoded\n%s\nexpected\n%s", p, expected)
+	}
+
+	if _, err := DecodeBytes(data[:10]); err == nil {
+		t.Fatal("expected a truncated pattern to fail")
+	}
+}
+
+func TestDecodeErrorCodes(t *testing.T) {
+	data := testutil.Fixture(t, "..", "..", "fixtures", "pattern_1.splice")
+	badMagic := append([]byte("SPLICY"), data[6:]...)
+
+	tData := []struct {
+		name     string
+		data     []byte
+		expected errcode.Code
+	}{
+		{"bad magic", badMagic, errcode.DrumBadMagic},
+		{"truncated header", data[:20], errcode.DrumTruncated},
+		{"truncated track", data[:len(data)-4], errcode.DrumTruncated},
+		{"empty", nil, errcode.DrumTruncated},
+	}
+
+	for _, exp := range tData {
+		_, err := DecodeBytes(exp.data)
+		if code := errcode.Of(err); code != exp.expected {
+			t.Errorf("%s: expected code %s, got %q from %v", exp.name, exp.expected, code, err)
+		}
+	}
+
+	if _, err := DecodeBytes(badMagic); !errors.Is(err, ErrBadMagic) {
+		t.Errorf("expected ErrBadMagic, got %v", err)
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	file, err := os.Open(path.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var names []string
+	p, err := DecodeStream(file, func(track Track) error {
+		names = append(names, track.Name)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Version != "0.808-alpha" || p.Tempo != 120 || len(p.tracks) != 0 {
+		t.Errorf("unexpected pattern header: %+v", p)
+	}
+
+	expected := []string{"kick", "snare", "clap", "hh-open", "hh-close", "cowbell"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected tracks: %v != %v", names, expected)
+	}
+}
+
+func TestDecodeStreamStopsOnError(t *testing.T) {
+	file, err := os.Open(path.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	errStop := errors.New("stop")
+
+	var seen int
+	_, err = DecodeStream(file, func(track Track) error {
+		seen++
+		return errStop
+	})
+	if !errors.Is(err, errStop) {
+		t.Errorf("expected the callback error, got %v", err)
+	}
+	if seen != 1 {
+		t.Errorf("expected decoding to stop after the first track, saw %d", seen)
+	}
+}
+
+func TestDecoderTracer(t *testing.T) {
+	var rec trace.Recorder
+	d := &Decoder{Tracer: &rec}
+
+	p, err := d.DecodeFileContext(context.Background(), filepath.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spans := rec.Spans()
+	if len(spans) != 1+len(p.tracks) {
+		t.Fatalf("expected a span for the pattern and each track, got %d", len(spans))
+	}
+
+	root := spans[0]
+	if root.Name != "drum.DecodeFile" || root.Parent != nil || root.Err != nil {
+		t.Errorf("unexpected pattern span: %+v", root)
+	}
+	if v, _ := root.Attr("drum.tracks"); v != int64(len(p.tracks)) {
+		t.Errorf("expected drum.tracks %d, got %v", len(p.tracks), v)
+	}
+
+	for i, s := range spans[1:] {
+		if s.Name != "drum.readTrack" || s.Parent != root {
+			t.Errorf("unexpected track span: %+v", s)
+		}
+		if v, _ := s.Attr("drum.track.name"); v != p.tracks[i].Name {
+			t.Errorf("expected track %q, got %v", p.tracks[i].Name, v)
+		}
+	}
+}
+
+func TestDecoderTracerRecordsErrors(t *testing.T) {
+	var rec trace.Recorder
+	d := &Decoder{Tracer: &rec}
+
+	data := testutil.Fixture(t, "..", "..", "fixtures", "pattern_1.splice")
+	_, err := d.DecodeContext(context.Background(), bytes.NewReader(data[:len(data)-4]))
+	if err == nil {
+		t.Fatal("expected a truncated pattern to fail")
+	}
+
+	spans := rec.Spans()
+	if len(spans) == 0 || !errors.Is(spans[0].Err, err) {
+		t.Fatalf("expected the pattern span to record %v", err)
+	}
+	if last := spans[len(spans)-1]; last.Name != "drum.readTrack" || last.Err == nil {
+		t.Errorf("expected the failing track span to record the error, got %+v", last)
+	}
+}
@@ -0,0 +1,146 @@
+package drum
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// PatternDiff describes how one pattern differs from another.
+type PatternDiff struct {
+	FromVersion, ToVersion string
+	FromTempo, ToTempo     float32
+
+	// Tracks holds one entry per track found in either pattern, in the
+	// order they appear in the original pattern followed by any tracks
+	// that were only added.
+	Tracks []TrackDiff
+}
+
+// TrackDiff describes how a single track, matched by ID, differs
+// between two patterns. From is nil for added tracks and To is nil for
+// removed tracks.
+type TrackDiff struct {
+	From, To *Track
+
+	// Toggled lists the zero based steps whose state changed.
+	Toggled []int
+}
+
+// Changed reports whether the track differs between the two patterns.
+func (d TrackDiff) Changed() bool {
+	return d.From == nil || d.To == nil || d.From.Name != d.To.Name || len(d.Toggled) > 0
+}
+
+// Diff compares two patterns, matching tracks by their ID.
+func Diff(from, to *Pattern) *PatternDiff {
+	diff := PatternDiff{
+		FromVersion: from.Version,
+		ToVersion:   to.Version,
+		FromTempo:   from.Tempo,
+		ToTempo:     to.Tempo,
+	}
+
+	matched := make(map[int]bool)
+	for i := range from.tracks {
+		fromTrack := &from.tracks[i]
+		trackDiff := TrackDiff{From: fromTrack}
+
+		for j := range to.tracks {
+			if to.tracks[j].ID == fromTrack.ID && !matched[j] {
+				matched[j] = true
+				trackDiff.To = &to.tracks[j]
+				trackDiff.Toggled = toggledSteps(fromTrack.Steps, to.tracks[j].Steps)
+				break
+			}
+		}
+
+		diff.Tracks = append(diff.Tracks, trackDiff)
+	}
+
+	for j := range to.tracks {
+		if !matched[j] {
+			diff.Tracks = append(diff.Tracks, TrackDiff{To: &to.tracks[j]})
+		}
+	}
+
+	return &diff
+}
+
+func toggledSteps(from, to []byte) []int {
+	var toggled []int
+	for k := range from {
+		if k >= len(to) || from[k] != to[k] {
+			toggled = append(toggled, k)
+		}
+	}
+
+	for k := len(from); k < len(to); k++ {
+		toggled = append(toggled, k)
+	}
+
+	return toggled
+}
+
+// Empty reports whether the two patterns are identical.
+func (d *PatternDiff) Empty() bool {
+	if d.FromVersion != d.ToVersion || d.FromTempo != d.ToTempo {
+		return false
+	}
+
+	for _, track := range d.Tracks {
+		if track.Changed() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// String renders the diff in a unified style: removed lines are
+// prefixed with "-", added lines with "+" and unchanged lines with a
+// space.
+func (d *PatternDiff) String() string {
+	var result strings.Builder
+
+	if d.FromVersion != d.ToVersion {
+		fmt.Fprintf(&result, "-Saved with HW Version: %v\n", d.FromVersion)
+		fmt.Fprintf(&result, "+Saved with HW Version: %v\n", d.ToVersion)
+	} else {
+		fmt.Fprintf(&result, " Saved with HW Version: %v\n", d.FromVersion)
+	}
+
+	if d.FromTempo != d.ToTempo {
+		delta := math.Round(float64(d.ToTempo-d.FromTempo)*100) / 100
+		fmt.Fprintf(&result, "-Tempo: %v\n", d.FromTempo)
+		fmt.Fprintf(&result, "+Tempo: %v (%s)\n", d.ToTempo, signedFloat(delta))
+	} else {
+		fmt.Fprintf(&result, " Tempo: %v\n", d.FromTempo)
+	}
+
+	for _, track := range d.Tracks {
+		switch {
+		case !track.Changed():
+			result.WriteString(" " + track.From.String())
+		case track.To == nil:
+			result.WriteString("-" + track.From.String())
+		case track.From == nil:
+			result.WriteString("+" + track.To.String())
+		default:
+			result.WriteString("-" + track.From.String())
+			result.WriteString("+" + track.To.String())
+		}
+	}
+
+	return result.String()
+}
+
+func signedFloat(f float64) string {
+	formatted := strconv.FormatFloat(f, 'f', -1, 64)
+	if f >= 0 {
+		return "+" + formatted
+	}
+
+	return formatted
+}
@@ -0,0 +1,48 @@
+package drum
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	from, err := DecodeFile(path.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	to, err := DecodeFile(path.Join("..", "..", "fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	diff := Diff(from, to)
+	if diff.Empty() {
+		t.Fatal("expected pattern_1 and pattern_2 to differ")
+	}
+
+	expected := ` Saved with HW Version: 0.808-alpha
+-Tempo: 120
++Tempo: 98.4 (-21.6)
+-(0) kick	|x---|x---|x---|x---|
++(0) kick	|x---|----|x---|----|
+ (1) snare	|----|x---|----|x---|
+-(2) clap	|----|x-x-|----|----|
+ (3) hh-open	|--x-|--x-|x-x-|--x-|
+-(4) hh-close	|x---|x---|----|x--x|
+-(5) cowbell	|----|----|--x-|----|
++(5) cowbell	|----|----|x---|----|
+`
+	if got := diff.String(); got != expected {
+		t.Errorf("unexpected diff.\nGot:\n%s\nExpected:\n%s", got, expected)
+	}
+
+	if toggled := diff.Tracks[0].Toggled; !reflect.DeepEqual(toggled, []int{4, 12}) {
+		t.Errorf("unexpected toggled kick steps: %v", toggled)
+	}
+
+	if !Diff(from, from).Empty() {
+		t.Error("expected a pattern to have no differences with itself")
+	}
+}
@@ -0,0 +1,267 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+	"github.com/jpreese/go-mentor/challenge1/internal/trace"
+)
+
+// DecodeFile decodes the drum machine file found at the provided path
+// and returns a pointer to a parsed pattern which is the entry point to the
+// rest of the data.
+func DecodeFile(path string) (*Pattern, error) {
+	return defaultDecoder.DecodeFile(path)
+}
+
+// DecodeBytes decodes the pattern file held in b, for callers such as a
+// browser that have the file in memory rather than on disk.
+func DecodeBytes(b []byte) (*Pattern, error) {
+	return defaultDecoder.Decode(bytes.NewReader(b))
+}
+
+// DecodeStream decodes a pattern from r, calling onTrack with each track
+// as soon as it has been parsed rather than collecting them, so that
+// large files can be processed in constant memory. If onTrack returns an
+// error, decoding stops and that error is returned.
+//
+// The returned pattern holds the header fields but no tracks.
+func DecodeStream(r io.Reader, onTrack func(Track) error) (*Pattern, error) {
+	return defaultDecoder.DecodeStream(r, onTrack)
+}
+
+// defaultDecoder backs the package level functions so they share pooled
+// buffers.
+var defaultDecoder Decoder
+
+// A Decoder decodes pattern files. The zero value is ready to use and
+// verifies checksum footers whenever they are present.
+//
+// A Decoder reuses its read buffers, hashes and step storage between
+// calls, so decoding many files with one Decoder allocates far less
+// than decoding each with a new one. It is safe for concurrent use and
+// must not be copied after first use.
+type Decoder struct {
+	// RequireChecksum makes decoding fail with ErrChecksumMissing when a
+	// pattern has no checksum footer.
+	RequireChecksum bool
+
+	// ValidateNames replaces any bytes in track names that are not valid
+	// UTF-8 with U+FFFD. Some hardware exports mangle names this way.
+	ValidateNames bool
+
+	// NormalizeNames converts track names to Unicode normalization form
+	// NFC so visually identical names compare equal.
+	NormalizeNames bool
+
+	// NameChanged, when set, is called for every track whose name was
+	// altered by ValidateNames or NormalizeNames, with the name as it
+	// was stored in the file.
+	NameChanged func(track Track, original string)
+
+	// Tracer, when set, records a span for every pattern decoded, with a
+	// span for each of its tracks beneath it. DecodeFileContext and
+	// DecodeContext start them under the span of their context. Any
+	// Tracer of github.com/jpreese/go-mentor/trace, such as otelbridge's,
+	// will do.
+	Tracer trace.Tracer
+
+	states sync.Pool
+}
+
+// DecodeFile decodes the drum machine file found at the provided path.
+func (d *Decoder) DecodeFile(path string) (*Pattern, error) {
+	return d.DecodeFileContext(context.Background(), path)
+}
+
+// DecodeFileContext is like DecodeFile, but traces the decoding under
+// the span in ctx.
+func (d *Decoder) DecodeFileContext(ctx context.Context, path string) (p *Pattern, err error) {
+	ctx, span := d.startSpan(ctx, "drum.DecodeFile", trace.String("drum.path", path))
+	defer func() { endSpan(span, p, err) }()
+
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return d.decode(ctx, file)
+}
+
+const readBufferSize = 512
+
+// Decode decodes a pattern from r.
+func (d *Decoder) Decode(r io.Reader) (*Pattern, error) {
+	return d.DecodeContext(context.Background(), r)
+}
+
+// DecodeContext is like Decode, but traces the decoding under the span
+// in ctx.
+func (d *Decoder) DecodeContext(ctx context.Context, r io.Reader) (p *Pattern, err error) {
+	ctx, span := d.startSpan(ctx, "drum.Decode")
+	defer func() { endSpan(span, p, err) }()
+
+	return d.decode(ctx, r)
+}
+
+func (d *Decoder) decode(ctx context.Context, r io.Reader) (*Pattern, error) {
+	var tracks []Track
+	p, err := d.decodeStream(ctx, r, func(track Track) error {
+		tracks = append(tracks, track)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	p.tracks = tracks
+
+	return p, nil
+}
+
+// DecodeStream decodes a pattern from r, calling onTrack with each track
+// as soon as it has been parsed. See the package level DecodeStream.
+func (d *Decoder) DecodeStream(r io.Reader, onTrack func(Track) error) (p *Pattern, err error) {
+	ctx, span := d.startSpan(context.Background(), "drum.DecodeStream")
+	defer func() { endSpan(span, p, err) }()
+
+	return d.decodeStream(ctx, r, onTrack)
+}
+
+func (d *Decoder) decodeStream(ctx context.Context, r io.Reader, onTrack func(Track) error) (*Pattern, error) {
+	s := d.getState()
+	defer d.putState(s)
+
+	// Decoding issues many small reads, so buffer them rather than
+	// making a syscall for every field. Pattern files are typically a
+	// few hundred bytes, so a small buffer usually holds the whole file.
+	buffered, ok := r.(*bufio.Reader)
+	if !ok {
+		s.reader.Reset(r)
+		buffered = s.reader
+	}
+
+	// Every byte of the pattern is hashed as it is read so that a
+	// checksum footer, if one follows, can be verified without reading
+	// the pattern twice.
+	s.source = buffered
+
+	var p Pattern
+
+	if err := s.readHeader(s, &p); err != nil {
+		return nil, fmt.Errorf("unable to read file header: %w", truncated(err))
+	}
+
+	// The file size counts every byte after the size field, which
+	// includes the version and tempo that were just read. Anything past
+	// the declared size is padding and is never read.
+	s.tracks = io.LimitedReader{R: s, N: p.fileSize - versionSize - tempoSize}
+	for s.tracks.N > 0 {
+		_, span := d.startSpan(ctx, "drum.readTrack")
+		track, err := s.readTrack(&s.tracks)
+		if err != nil {
+			err = fmt.Errorf("unable to read track: %w", truncated(err))
+			if span != nil {
+				span.End(err)
+			}
+			return nil, err
+		}
+		d.cleanName(&track)
+		if span != nil {
+			span.SetAttributes(trace.Int("drum.track.id", int64(track.ID)), trace.String("drum.track.name", track.Name))
+			span.End(nil)
+		}
+
+		if err := onTrack(track); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := s.sums.verifyFooter(buffered, d.RequireChecksum); err != nil {
+		return nil, err
+	}
+
+	return &p, nil
+}
+
+// startSpan starts a span with d's Tracer, returning a nil Span when it
+// has none.
+func (d *Decoder) startSpan(ctx context.Context, name string, attrs ...trace.Attribute) (context.Context, trace.Span) {
+	if d.Tracer == nil {
+		return ctx, nil
+	}
+
+	return d.Tracer.Start(ctx, name, attrs...)
+}
+
+// endSpan ends a span started by startSpan for decoding p, which failed
+// with err.
+func endSpan(span trace.Span, p *Pattern, err error) {
+	if span == nil {
+		return
+	}
+	if p != nil {
+		span.SetAttributes(trace.String("drum.version", p.Version), trace.Int("drum.tracks", int64(len(p.tracks))))
+	}
+	span.End(err)
+}
+
+// truncated gives err the DrumTruncated code when it says the file
+// ended early.
+func truncated(err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return errcode.Wrap(errcode.DrumTruncated, err)
+	}
+
+	return err
+}
+
+// ReadFrom decodes a single pattern from r, replacing the contents of
+// p. Unlike DecodeStream it consumes exactly the bytes the pattern
+// declares and leaves anything that follows unread, so patterns can be
+// read back to back from a single connection. It implements
+// io.ReaderFrom.
+//
+// ReadFrom reads the bare pattern; checksum footers written by an
+// Encoder are not consumed.
+func (p *Pattern) ReadFrom(r io.Reader) (int64, error) {
+	var prefix [spliceSize + fileSizeSize]byte
+	n, err := io.ReadFull(r, prefix[:])
+	if err != nil {
+		return int64(n), fmt.Errorf("unable to read file header: %w", err)
+	}
+
+	fileSize := int64(binary.BigEndian.Uint64(prefix[spliceSize:]))
+	if fileSize < 0 {
+		return int64(n), fmt.Errorf("invalid file size %d", fileSize)
+	}
+
+	// Copy rather than allocating fileSize up front so a corrupt size
+	// cannot trigger a huge allocation.
+	var file bytes.Buffer
+	file.Write(prefix[:])
+	copied, err := io.CopyN(&file, r, fileSize)
+	total := int64(n) + copied
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return total, fmt.Errorf("unable to read pattern body: %w", err)
+	}
+
+	decoded, err := defaultDecoder.Decode(&file)
+	if err != nil {
+		return total, err
+	}
+	*p = *decoded
+
+	return total, nil
+}
@@ -0,0 +1,136 @@
+package drum
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// The With methods implement copy-on-write editing: each returns a new
+// Pattern with the edit applied and leaves the receiver untouched, so a
+// pattern that is being read elsewhere (for example by a playback
+// engine) is never modified underneath its reader. Tracks that are not
+// edited are shared between the old and new pattern.
+
+// WithTempo returns a copy of the pattern with the given tempo.
+func (p *Pattern) WithTempo(tempo float32) *Pattern {
+	edited := p.clone()
+	edited.Tempo = tempo
+
+	return edited
+}
+
+// WithStep returns a copy of the pattern with the given step of the
+// track with the given ID turned on or off.
+func (p *Pattern) WithStep(trackID, step int, on bool) (*Pattern, error) {
+	i, err := p.trackIndex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	if step < 0 || step >= len(p.tracks[i].Steps) {
+		return nil, fmt.Errorf("step %d is out of range for track %d", step, trackID)
+	}
+
+	edited := p.clone()
+	track := &edited.tracks[i]
+	track.Steps = append([]byte(nil), track.Steps...)
+	if on {
+		track.Steps[step] = 'x'
+	} else {
+		track.Steps[step] = '-'
+	}
+
+	return edited, nil
+}
+
+// WithTrack returns a copy of the pattern with the track added, or
+// replacing the existing track with the same ID.
+func (p *Pattern) WithTrack(track Track) (*Pattern, error) {
+	if len(track.Steps) != stepsInTrack {
+		return nil, fmt.Errorf("track %d has %d steps, expected %d", track.ID, len(track.Steps), stepsInTrack)
+	}
+	track.Steps = append([]byte(nil), track.Steps...)
+
+	edited := p.clone()
+	if i, err := p.trackIndex(track.ID); err == nil {
+		edited.tracks[i] = track
+	} else {
+		edited.tracks = append(edited.tracks, track)
+	}
+
+	return edited, nil
+}
+
+// WithoutTrack returns a copy of the pattern with the track with the
+// given ID removed.
+func (p *Pattern) WithoutTrack(trackID int) (*Pattern, error) {
+	i, err := p.trackIndex(trackID)
+	if err != nil {
+		return nil, err
+	}
+
+	edited := p.clone()
+	edited.tracks = append(edited.tracks[:i], edited.tracks[i+1:]...)
+
+	return edited, nil
+}
+
+// clone copies the pattern and its track list. Step slices are shared
+// and must be copied before they are modified.
+func (p *Pattern) clone() *Pattern {
+	edited := *p
+	edited.tracks = append([]Track(nil), p.tracks...)
+
+	return &edited
+}
+
+func (p *Pattern) trackIndex(trackID int) (int, error) {
+	for i, track := range p.tracks {
+		if track.ID == trackID {
+			return i, nil
+		}
+	}
+
+	return 0, fmt.Errorf("pattern has no track with ID %d", trackID)
+}
+
+// SharedPattern holds a pattern that is edited and read from several
+// goroutines at once. Readers always see a complete pattern, and edits
+// made through Update never overwrite one another.
+type SharedPattern struct {
+	current atomic.Pointer[Pattern]
+}
+
+// NewSharedPattern creates a SharedPattern holding p. The caller must
+// not modify p afterwards.
+func NewSharedPattern(p *Pattern) *SharedPattern {
+	var s SharedPattern
+	s.current.Store(p)
+
+	return &s
+}
+
+// Load returns the current pattern. It must be treated as read-only;
+// use Update to change it.
+func (s *SharedPattern) Load() *Pattern {
+	return s.current.Load()
+}
+
+// Update replaces the current pattern with the result of edit. If
+// another Update lands while edit is running, edit is called again with
+// the newer pattern, so edit should use the With methods and must not
+// have side effects.
+func (s *SharedPattern) Update(edit func(*Pattern) (*Pattern, error)) (*Pattern, error) {
+	for {
+		current := s.current.Load()
+
+		edited, err := edit(current)
+		if err != nil {
+			return nil, err
+		}
+
+		if s.current.CompareAndSwap(current, edited) {
+			return edited, nil
+		}
+	}
+}
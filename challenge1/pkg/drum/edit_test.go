@@ -0,0 +1,133 @@
+package drum
+
+import (
+	"fmt"
+	"path"
+	"sync"
+	"testing"
+)
+
+func TestWithStep(t *testing.T) {
+	original, err := DecodeFile(path.Join("..", "..", "fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	before := fmt.Sprint(original)
+
+	edited, err := original.WithStep(5, 0, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited, err = edited.WithStep(0, 8, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	edited = edited.WithTempo(100)
+
+	expected := `Saved with HW Version: 0.808-alpha
+Tempo: 100
+(0) kick	|x---|----|----|----|
+(1) snare	|----|x---|----|x---|
+(3) hh-open	|--x-|--x-|x-x-|--x-|
+(5) cowbell	|x---|----|x---|----|
+`
+	if got := fmt.Sprint(edited); got != expected {
+		t.Errorf("unexpected edited pattern.\nGot:\n%s\nExpected:\n%s", got, expected)
+	}
+
+	if got := fmt.Sprint(original); got != before {
+		t.Errorf("editing changed the original pattern.\nGot:\n%s\nExpected:\n%s", got, before)
+	}
+
+	if _, err := original.WithStep(7, 0, true); err == nil {
+		t.Error("expected an error editing a missing track")
+	}
+	if _, err := original.WithStep(0, 16, true); err == nil {
+		t.Error("expected an error editing a step out of range")
+	}
+}
+
+func TestNewPatternRejectsShortTracks(t *testing.T) {
+	if _, err := NewPattern("0.808-alpha", 120, Track{ID: 3, Name: "clap", Steps: []byte("x---")}); err == nil {
+		t.Error("expected an error creating a pattern with a track of 4 steps")
+	}
+}
+
+func TestWithTrack(t *testing.T) {
+	p, err := NewPattern("0.808-alpha", 120, Track{ID: 0, Name: "kick", Steps: []byte("x---x---x---x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := p.WithTrack(Track{ID: 1, Name: "snare", Steps: []byte("----x-------x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replaced, err := added.WithTrack(Track{ID: 0, Name: "808 kick", Steps: []byte("x-------x-------")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	removed, err := replaced.WithoutTrack(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if got, expected := fmt.Sprint(removed), "Saved with HW Version: 0.808-alpha\nTempo: 120\n(0) 808 kick\t|x---|----|x---|----|\n"; got != expected {
+		t.Errorf("unexpected pattern.\nGot:\n%s\nExpected:\n%s", got, expected)
+	}
+
+	if len(added.tracks) != 2 || added.tracks[0].Name != "kick" {
+		t.Errorf("later edits changed an earlier pattern: %v", added)
+	}
+
+	if _, err := p.WithTrack(Track{ID: 2, Name: "short", Steps: []byte("x---")}); err == nil {
+		t.Error("expected an error adding a track with the wrong number of steps")
+	}
+}
+
+func TestSharedPatternConcurrentEdits(t *testing.T) {
+	steps := []byte("----------------")
+	p, err := NewPattern("0.808-alpha", 120, Track{ID: 0, Name: "kick", Steps: steps})
+	if err != nil {
+		t.Fatal(err)
+	}
+	shared := NewSharedPattern(p)
+
+	var wg sync.WaitGroup
+	for step := 0; step < stepsInTrack; step++ {
+		wg.Add(2)
+
+		go func(step int) {
+			defer wg.Done()
+
+			_, err := shared.Update(func(p *Pattern) (*Pattern, error) {
+				return p.WithStep(0, step, true)
+			})
+			if err != nil {
+				t.Error(err)
+			}
+		}(step)
+
+		// Readers run alongside the writers; the race detector flags any
+		// shared mutation.
+		go func() {
+			defer wg.Done()
+
+			for track := range shared.Load().Tracks() {
+				for range track.Hits() {
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	for track := range shared.Load().Tracks() {
+		if string(track.Steps) != "xxxxxxxxxxxxxxxx" {
+			t.Errorf("expected every concurrent edit to land, got %s", track.Steps)
+		}
+	}
+}
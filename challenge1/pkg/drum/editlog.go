@@ -0,0 +1,389 @@
+package drum
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math"
+	"os"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+)
+
+// An edit log, stored in a .splicelog file, records a base pattern and
+// every edit made to it since, in order. Edits are only ever appended,
+// so any earlier state of the pattern can be rebuilt by replaying a
+// prefix of the log.
+//
+// The file starts with the SPLICELOG marker and a format version byte,
+// followed by the base pattern encoded exactly as WriteTo writes it.
+// Each edit is then an op byte followed by its operands:
+//
+//	EditStep         track ID byte, step byte, 1 for on or 0 for off
+//	EditTempo        little endian float32, like the pattern header
+//	EditTrack        the track as it is stored in a pattern file
+//	EditRemoveTrack  track ID byte
+
+// EditLogExtension is the file extension of edit logs.
+const EditLogExtension = ".splicelog"
+
+const (
+	editLogMagic   = "SPLICELOG"
+	editLogVersion = 1
+)
+
+// ErrNotEditLog is returned for a file that does not start with the
+// SPLICELOG marker every edit log does.
+var ErrNotEditLog = errcode.New(errcode.DrumBadMagic, "not an edit log")
+
+// EditOp identifies the kind of change an Edit makes.
+type EditOp byte
+
+// The edits an edit log records, one for each of the With methods.
+const (
+	EditStep EditOp = iota + 1
+	EditTempo
+	EditTrack
+	EditRemoveTrack
+)
+
+func (op EditOp) String() string {
+	switch op {
+	case EditStep:
+		return "step"
+	case EditTempo:
+		return "tempo"
+	case EditTrack:
+		return "track"
+	case EditRemoveTrack:
+		return "remove-track"
+	default:
+		return fmt.Sprintf("edit(%d)", byte(op))
+	}
+}
+
+// Edit is a single change to a pattern. Which fields are used depends on
+// Op: TrackID, Step and On for EditStep, Tempo for EditTempo, Track for
+// EditTrack and TrackID for EditRemoveTrack.
+type Edit struct {
+	Op EditOp
+
+	TrackID int
+	Step    int
+	On      bool
+	Tempo   float32
+	Track   Track
+}
+
+// StepEdit returns the edit turning the given step of a track on or
+// off.
+func StepEdit(trackID, step int, on bool) Edit {
+	return Edit{Op: EditStep, TrackID: trackID, Step: step, On: on}
+}
+
+// TempoEdit returns the edit changing the tempo.
+func TempoEdit(tempo float32) Edit {
+	return Edit{Op: EditTempo, Tempo: tempo}
+}
+
+// TrackEdit returns the edit adding the track, or replacing the track
+// with the same ID.
+func TrackEdit(track Track) Edit {
+	track.Steps = append([]byte(nil), track.Steps...)
+
+	return Edit{Op: EditTrack, Track: track}
+}
+
+// RemoveTrackEdit returns the edit removing the track with the given ID.
+func RemoveTrackEdit(trackID int) Edit {
+	return Edit{Op: EditRemoveTrack, TrackID: trackID}
+}
+
+// Apply returns a copy of p with the edit made, using the With method
+// the edit corresponds to.
+func (e Edit) Apply(p *Pattern) (*Pattern, error) {
+	switch e.Op {
+	case EditStep:
+		return p.WithStep(e.TrackID, e.Step, e.On)
+	case EditTempo:
+		return p.WithTempo(e.Tempo), nil
+	case EditTrack:
+		return p.WithTrack(e.Track)
+	case EditRemoveTrack:
+		return p.WithoutTrack(e.TrackID)
+	default:
+		return nil, fmt.Errorf("unknown edit %v", e.Op)
+	}
+}
+
+func (e Edit) String() string {
+	switch e.Op {
+	case EditStep:
+		state := "off"
+		if e.On {
+			state = "on"
+		}
+		return fmt.Sprintf("step %d of track %d %s", e.Step, e.TrackID, state)
+	case EditTempo:
+		return fmt.Sprintf("tempo %v", e.Tempo)
+	case EditTrack:
+		return fmt.Sprintf("track (%d) %s", e.Track.ID, e.Track.Name)
+	case EditRemoveTrack:
+		return fmt.Sprintf("remove track %d", e.TrackID)
+	default:
+		return e.Op.String()
+	}
+}
+
+// EditLog is a base pattern and the edits made to it since, oldest
+// first.
+type EditLog struct {
+	Base  *Pattern
+	Edits []Edit
+}
+
+// NewEditLog creates an edit log starting from base. The caller must
+// not modify base afterwards.
+func NewEditLog(base *Pattern) *EditLog {
+	return &EditLog{Base: base}
+}
+
+// Append records edits at the end of the log. They are not checked
+// against the pattern until the log is replayed.
+func (l *EditLog) Append(edits ...Edit) {
+	l.Edits = append(l.Edits, edits...)
+}
+
+// Replay returns the pattern as it was after the first n edits, so
+// Replay(0) is the base pattern and Replay(len(l.Edits)) is the latest.
+// The base pattern is never modified.
+func (l *EditLog) Replay(n int) (*Pattern, error) {
+	if n < 0 || n > len(l.Edits) {
+		return nil, fmt.Errorf("cannot replay %d edits of a log holding %d", n, len(l.Edits))
+	}
+
+	p := l.Base
+	for i, edit := range l.Edits[:n] {
+		edited, err := edit.Apply(p)
+		if err != nil {
+			return nil, fmt.Errorf("replay edit %d (%v): %w", i, edit, err)
+		}
+		p = edited
+	}
+
+	return p, nil
+}
+
+// WriteTo encodes the whole log, base pattern first, to w. It
+// implements io.WriterTo.
+func (l *EditLog) WriteTo(w io.Writer) (int64, error) {
+	var file bytes.Buffer
+	file.WriteString(editLogMagic)
+	file.WriteByte(editLogVersion)
+
+	if _, err := l.Base.WriteTo(&file); err != nil {
+		return 0, fmt.Errorf("unable to write base pattern: %w", err)
+	}
+	if err := writeEdits(&file, l.Edits); err != nil {
+		return 0, err
+	}
+
+	n, err := file.WriteTo(w)
+	if err != nil {
+		return n, fmt.Errorf("unable to write edit log: %w", err)
+	}
+
+	return n, nil
+}
+
+// AppendEdits writes edits to w in the form WriteTo records them, to be
+// added to the end of an existing edit log, typically a file opened with
+// os.O_APPEND. Nothing is written unless every edit can be encoded.
+func AppendEdits(w io.Writer, edits ...Edit) error {
+	var b bytes.Buffer
+	if err := writeEdits(&b, edits); err != nil {
+		return err
+	}
+
+	if _, err := b.WriteTo(w); err != nil {
+		return fmt.Errorf("unable to append edits: %w", err)
+	}
+
+	return nil
+}
+
+func writeEdits(w io.Writer, edits []Edit) error {
+	for i, edit := range edits {
+		if err := edit.write(w); err != nil {
+			return fmt.Errorf("unable to write edit %d (%v): %w", i, edit, err)
+		}
+	}
+
+	return nil
+}
+
+func (e Edit) write(w io.Writer) error {
+	switch e.Op {
+	case EditStep:
+		if e.TrackID < 0 || e.TrackID > 255 {
+			return fmt.Errorf("track id %d does not fit in a single byte", e.TrackID)
+		}
+		if e.Step < 0 || e.Step >= stepsInTrack {
+			return fmt.Errorf("step %d is out of range", e.Step)
+		}
+		var on byte
+		if e.On {
+			on = 1
+		}
+		_, err := w.Write([]byte{byte(e.Op), byte(e.TrackID), byte(e.Step), on})
+		return err
+
+	case EditTempo:
+		var b [1 + tempoSize]byte
+		b[0] = byte(e.Op)
+		binary.LittleEndian.PutUint32(b[1:], math.Float32bits(e.Tempo))
+		_, err := w.Write(b[:])
+		return err
+
+	case EditTrack:
+		if _, err := w.Write([]byte{byte(e.Op)}); err != nil {
+			return err
+		}
+		return e.Track.write(w)
+
+	case EditRemoveTrack:
+		if e.TrackID < 0 || e.TrackID > 255 {
+			return fmt.Errorf("track id %d does not fit in a single byte", e.TrackID)
+		}
+		_, err := w.Write([]byte{byte(e.Op), byte(e.TrackID)})
+		return err
+
+	default:
+		return fmt.Errorf("unknown edit %v", e.Op)
+	}
+}
+
+// ReadFrom decodes an edit log from r, replacing the contents of l. It
+// reads until r is exhausted and implements io.ReaderFrom.
+//
+// A log whose last edit was cut short, as when the program appending it
+// crashed, fails with a DrumTruncated error, but l still holds the base
+// pattern and every complete edit before it.
+func (l *EditLog) ReadFrom(r io.Reader) (int64, error) {
+	cr := &countingReader{r: bufio.NewReader(r)}
+
+	var header [len(editLogMagic) + 1]byte
+	if _, err := io.ReadFull(cr, header[:]); err != nil {
+		return cr.n, fmt.Errorf("unable to read edit log header: %w", truncated(err))
+	}
+	if string(header[:len(editLogMagic)]) != editLogMagic {
+		return cr.n, ErrNotEditLog
+	}
+	if version := header[len(editLogMagic)]; version != editLogVersion {
+		return cr.n, fmt.Errorf("unsupported edit log version %d", version)
+	}
+
+	var base Pattern
+	if _, err := base.ReadFrom(cr); err != nil {
+		return cr.n, fmt.Errorf("unable to read base pattern: %w", truncated(err))
+	}
+	l.Base, l.Edits = &base, nil
+
+	s := decodeState{scratch: make([]byte, scratchSize)}
+	for {
+		edit, err := s.readEdit(cr)
+		if err == io.EOF {
+			return cr.n, nil
+		}
+		if err != nil {
+			return cr.n, fmt.Errorf("unable to read edit %d: %w", len(l.Edits), err)
+		}
+		l.Edits = append(l.Edits, edit)
+	}
+}
+
+// readEdit reads the next edit from r, returning io.EOF only when r ends
+// cleanly between edits.
+func (s *decodeState) readEdit(r io.Reader) (Edit, error) {
+	op := s.scratch[:1]
+	if _, err := io.ReadFull(r, op); err != nil {
+		return Edit{}, err
+	}
+
+	edit := Edit{Op: EditOp(op[0])}
+	switch edit.Op {
+	case EditStep:
+		b := s.scratch[:3]
+		if _, err := io.ReadFull(r, b); err != nil {
+			return Edit{}, truncated(noEOF(err))
+		}
+		edit.TrackID, edit.Step, edit.On = int(b[0]), int(b[1]), b[2] == 1
+
+	case EditTempo:
+		b := s.scratch[:tempoSize]
+		if _, err := io.ReadFull(r, b); err != nil {
+			return Edit{}, truncated(noEOF(err))
+		}
+		edit.Tempo = math.Float32frombits(binary.LittleEndian.Uint32(b))
+
+	case EditTrack:
+		track, err := s.readTrack(r)
+		if err != nil {
+			return Edit{}, truncated(noEOF(err))
+		}
+		edit.Track = track
+
+	case EditRemoveTrack:
+		b := s.scratch[:1]
+		if _, err := io.ReadFull(r, b); err != nil {
+			return Edit{}, truncated(noEOF(err))
+		}
+		edit.TrackID = int(b[0])
+
+	default:
+		return Edit{}, fmt.Errorf("unknown edit %v", edit.Op)
+	}
+
+	return edit, nil
+}
+
+// noEOF turns io.EOF into io.ErrUnexpectedEOF, for reads in the middle
+// of an edit where the end of the log means it was cut short.
+func noEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
+
+// DecodeEditLogFile decodes the edit log found at the provided path.
+func DecodeEditLogFile(path string) (*EditLog, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var l EditLog
+	if _, err := l.ReadFrom(file); err != nil {
+		return nil, err
+	}
+
+	return &l, nil
+}
+
+// countingReader counts the bytes read through it, for ReadFrom.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(b []byte) (int, error) {
+	n, err := c.r.Read(b)
+	c.n += int64(n)
+
+	return n, err
+}
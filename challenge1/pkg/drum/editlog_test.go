@@ -0,0 +1,151 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+)
+
+func TestEditLogReplay(t *testing.T) {
+	base, err := NewPattern("0.808-alpha", 120, Track{ID: 0, Name: "kick", Steps: []byte("x---x---x---x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := NewEditLog(base)
+	log.Append(
+		StepEdit(0, 2, true),
+		TrackEdit(Track{ID: 1, Name: "snare", Steps: []byte("----x-------x---")}),
+		TempoEdit(98.5),
+		RemoveTrackEdit(0),
+	)
+
+	expected := []string{
+		"Saved with HW Version: 0.808-alpha\nTempo: 120\n(0) kick\t|x---|x---|x---|x---|\n",
+		"Saved with HW Version: 0.808-alpha\nTempo: 120\n(0) kick\t|x-x-|x---|x---|x---|\n",
+		"Saved with HW Version: 0.808-alpha\nTempo: 120\n(0) kick\t|x-x-|x---|x---|x---|\n(1) snare\t|----|x---|----|x---|\n",
+		"Saved with HW Version: 0.808-alpha\nTempo: 98.5\n(0) kick\t|x-x-|x---|x---|x---|\n(1) snare\t|----|x---|----|x---|\n",
+		"Saved with HW Version: 0.808-alpha\nTempo: 98.5\n(1) snare\t|----|x---|----|x---|\n",
+	}
+	for n, exp := range expected {
+		p, err := log.Replay(n)
+		if err != nil {
+			t.Fatalf("replay %d: %v", n, err)
+		}
+		if got := fmt.Sprint(p); got != exp {
+			t.Errorf("replay %d.\nGot:\n%s\nExpected:\n%s", n, got, exp)
+		}
+	}
+
+	if fmt.Sprint(base) != expected[0] {
+		t.Errorf("replaying changed the base pattern:\n%s", base)
+	}
+	if _, err := log.Replay(len(log.Edits) + 1); err == nil {
+		t.Error("expected an error replaying more edits than the log holds")
+	}
+
+	log.Append(StepEdit(0, 0, true))
+	if _, err := log.Replay(len(log.Edits)); err == nil {
+		t.Error("expected an error replaying an edit of a removed track")
+	}
+}
+
+func TestEditLogRoundTrip(t *testing.T) {
+	base, err := DecodeFile(filepath.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	log := NewEditLog(base)
+	log.Append(TempoEdit(140), StepEdit(1, 3, true), TrackEdit(Track{ID: 200, Name: "clap", Steps: []byte("----x-------x---")}))
+
+	path := filepath.Join(t.TempDir(), "pattern"+EditLogExtension)
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := log.WriteTo(file); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// Later edits are appended without rewriting what is there.
+	file, err = os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendEdits(file, RemoveTrackEdit(0), StepEdit(200, 15, true)); err != nil {
+		t.Fatal(err)
+	}
+	if err := AppendEdits(file, StepEdit(300, 0, true)); err == nil {
+		t.Error("expected an error appending an edit of a track ID that does not fit in a byte")
+	}
+	file.Close()
+	log.Append(RemoveTrackEdit(0), StepEdit(200, 15, true))
+
+	decoded, err := DecodeEditLogFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Edits) != len(log.Edits) {
+		t.Fatalf("decoded %d edits, expected %d", len(decoded.Edits), len(log.Edits))
+	}
+	for i := range log.Edits {
+		if got, exp := decoded.Edits[i].String(), log.Edits[i].String(); got != exp {
+			t.Errorf("edit %d: got %s, expected %s", i, got, exp)
+		}
+	}
+
+	for n := range log.Edits {
+		got, err := decoded.Replay(n + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		exp, err := log.Replay(n + 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(exp) {
+			t.Errorf("replay %d.\nGot:\n%s\nExpected:\n%s", n+1, got, exp)
+		}
+	}
+}
+
+func TestEditLogErrors(t *testing.T) {
+	base, err := NewPattern("0.808-alpha", 120, Track{ID: 0, Name: "kick", Steps: []byte("x---x---x---x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	log := NewEditLog(base)
+	log.Append(StepEdit(0, 1, true), TempoEdit(90))
+
+	var buf bytes.Buffer
+	if _, err := log.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+
+	var decoded EditLog
+	_, err = decoded.ReadFrom(bytes.NewReader(data[:len(data)-2]))
+	if code := errcode.Of(err); code != errcode.DrumTruncated {
+		t.Errorf("expected %s for a torn final edit, got %v", errcode.DrumTruncated, err)
+	}
+	if len(decoded.Edits) != 1 || decoded.Base == nil {
+		t.Errorf("expected the base and the complete edit to be kept, got %d edits", len(decoded.Edits))
+	}
+
+	_, err = decoded.ReadFrom(bytes.NewReader(append([]byte("SPLICEBAD"), data[9:]...)))
+	if !errors.Is(err, ErrNotEditLog) {
+		t.Errorf("expected ErrNotEditLog, got %v", err)
+	}
+
+	_, err = decoded.ReadFrom(bytes.NewReader(append(append([]byte(nil), data...), 99)))
+	if err == nil {
+		t.Error("expected an error reading an unknown edit")
+	}
+}
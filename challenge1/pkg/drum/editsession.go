@@ -0,0 +1,191 @@
+package drum
+
+import "sync"
+
+// DefaultHistorySize is how many edits an EditSession can undo when it
+// is created with no other limit.
+const DefaultHistorySize = 100
+
+// EditSession edits a pattern through the With methods, recording each
+// edit so that it can be undone and redone, as an editor's undo and
+// redo commands do. It is safe for concurrent use.
+type EditSession struct {
+	historySize int
+
+	mu      sync.Mutex
+	start   *Pattern
+	current *Pattern
+	applied []Edit
+	undo    []*Pattern
+	redo    []undone
+}
+
+// undone is an edit that was undone, with the pattern it made so that
+// redoing it restores that pattern.
+type undone struct {
+	edit   Edit
+	edited *Pattern
+}
+
+// NewEditSession starts a session editing p, able to undo the last
+// historySize edits, or DefaultHistorySize when historySize is not
+// positive. The caller must not modify p afterwards.
+func NewEditSession(p *Pattern, historySize int) *EditSession {
+	if historySize <= 0 {
+		historySize = DefaultHistorySize
+	}
+
+	return &EditSession{historySize: historySize, start: p, current: p}
+}
+
+// Pattern returns the pattern as edited so far. It must be treated as
+// read-only.
+func (s *EditSession) Pattern() *Pattern {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.current
+}
+
+// Apply makes the edit and records it, discarding anything that could
+// have been redone.
+func (s *EditSession) Apply(edit Edit) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.applyLocked(edit); err != nil {
+		return err
+	}
+	s.redo = nil
+
+	return nil
+}
+
+func (s *EditSession) applyLocked(edit Edit) error {
+	edited, err := edit.Apply(s.current)
+	if err != nil {
+		return err
+	}
+	s.push(edit, edited)
+
+	return nil
+}
+
+// push makes edited, the result of edit, the current pattern.
+func (s *EditSession) push(edit Edit, edited *Pattern) {
+	// The patterns before each edit are kept to undo to. With the With
+	// methods copying only what they change these are cheap, and undo
+	// never has to work out the inverse of an edit.
+	s.undo = append(s.undo, s.current)
+	if len(s.undo) > s.historySize {
+		s.undo = append(s.undo[:0], s.undo[1:]...)
+	}
+	s.applied = append(s.applied, edit)
+	s.current = edited
+}
+
+// SetStep turns the given step of the track with the given ID on or
+// off.
+func (s *EditSession) SetStep(trackID, step int, on bool) error {
+	return s.Apply(StepEdit(trackID, step, on))
+}
+
+// Toggle turns the given step of the track with the given ID on if it
+// is off, and off if it is on.
+func (s *EditSession) Toggle(trackID, step int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	i, err := s.current.trackIndex(trackID)
+	if err != nil {
+		return err
+	}
+	on := step >= 0 && step < len(s.current.tracks[i].Steps) && s.current.tracks[i].Steps[step] != 'x'
+
+	// Recorded as the step's new state rather than as a toggle, so that
+	// replaying the edit gives the same pattern however often it is
+	// replayed.
+	if err := s.applyLocked(StepEdit(trackID, step, on)); err != nil {
+		return err
+	}
+	s.redo = nil
+
+	return nil
+}
+
+// SetTempo changes the tempo.
+func (s *EditSession) SetTempo(tempo float32) error {
+	return s.Apply(TempoEdit(tempo))
+}
+
+// SetTrack adds the track, or replaces the track with the same ID.
+func (s *EditSession) SetTrack(track Track) error {
+	return s.Apply(TrackEdit(track))
+}
+
+// RemoveTrack removes the track with the given ID.
+func (s *EditSession) RemoveTrack(trackID int) error {
+	return s.Apply(RemoveTrackEdit(trackID))
+}
+
+// CanUndo reports whether Undo has an edit to undo.
+func (s *EditSession) CanUndo() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.undo) > 0
+}
+
+// CanRedo reports whether Redo has an edit to redo.
+func (s *EditSession) CanRedo() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return len(s.redo) > 0
+}
+
+// Undo reverts the last edit that has not been undone, returning false
+// if there is none left in the history.
+func (s *EditSession) Undo() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.undo) == 0 {
+		return false
+	}
+
+	last := len(s.applied) - 1
+	s.redo = append(s.redo, undone{s.applied[last], s.current})
+	s.applied = s.applied[:last]
+	s.current = s.undo[len(s.undo)-1]
+	s.undo = s.undo[:len(s.undo)-1]
+
+	return true
+}
+
+// Redo makes the last edit undone again, returning false if there is
+// none or an edit has been made since it was undone.
+func (s *EditSession) Redo() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.redo) == 0 {
+		return false
+	}
+
+	last := s.redo[len(s.redo)-1]
+	s.redo = s.redo[:len(s.redo)-1]
+	s.push(last.edit, last.edited)
+
+	return true
+}
+
+// Log returns an edit log from the pattern the session started with to
+// the current one. Undone edits are left out, and edits too old to undo
+// are still included.
+func (s *EditSession) Log() *EditLog {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return &EditLog{Base: s.start, Edits: append([]Edit(nil), s.applied...)}
+}
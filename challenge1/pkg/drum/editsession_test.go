@@ -0,0 +1,127 @@
+package drum
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestEditSessionUndoRedo(t *testing.T) {
+	base, err := NewPattern("0.808-alpha", 120, Track{ID: 0, Name: "kick", Steps: []byte("x---x---x---x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewEditSession(base, 0)
+
+	if s.Undo() || s.Redo() {
+		t.Fatal("undid or redid an edit of a new session")
+	}
+
+	if err := s.Toggle(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTempo(90); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetTrack(Track{ID: 1, Name: "snare", Steps: []byte("----x-------x---")}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SetStep(7, 0, true); err == nil {
+		t.Error("expected an error editing a missing track")
+	}
+	latest := fmt.Sprint(s.Pattern())
+
+	expected := []string{
+		"Saved with HW Version: 0.808-alpha\nTempo: 90\n(0) kick\t|xx--|x---|x---|x---|\n",
+		"Saved with HW Version: 0.808-alpha\nTempo: 120\n(0) kick\t|xx--|x---|x---|x---|\n",
+		"Saved with HW Version: 0.808-alpha\nTempo: 120\n(0) kick\t|x---|x---|x---|x---|\n",
+	}
+	for _, exp := range expected {
+		if !s.Undo() {
+			t.Fatal("expected an edit to undo")
+		}
+		if got := fmt.Sprint(s.Pattern()); got != exp {
+			t.Errorf("unexpected pattern after undo.\nGot:\n%s\nExpected:\n%s", got, exp)
+		}
+	}
+	if s.CanUndo() || s.Undo() {
+		t.Error("undid more edits than were made")
+	}
+
+	for s.Redo() {
+	}
+	if got := fmt.Sprint(s.Pattern()); got != latest {
+		t.Errorf("unexpected pattern after redoing every edit.\nGot:\n%s\nExpected:\n%s", got, latest)
+	}
+
+	// A new edit after an undo discards the edit that was undone.
+	s.Undo()
+	if err := s.RemoveTrack(0); err != nil {
+		t.Fatal(err)
+	}
+	if s.CanRedo() || s.Redo() {
+		t.Error("redid an edit after a new one was made")
+	}
+	if got, exp := fmt.Sprint(s.Pattern()), "Saved with HW Version: 0.808-alpha\nTempo: 90\n"; got != exp {
+		t.Errorf("unexpected pattern.\nGot:\n%s\nExpected:\n%s", got, exp)
+	}
+}
+
+func TestEditSessionHistorySize(t *testing.T) {
+	base, err := NewPattern("0.808-alpha", 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewEditSession(base, 2)
+	for tempo := float32(100); tempo < 105; tempo++ {
+		if err := s.SetTempo(tempo); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	undone := 0
+	for s.Undo() {
+		undone++
+	}
+	if undone != 2 {
+		t.Errorf("undid %d edits, expected the history to hold 2", undone)
+	}
+	if s.Pattern().Tempo != 102 {
+		t.Errorf("expected the oldest edit still held to be undone to tempo 102, got %v", s.Pattern().Tempo)
+	}
+}
+
+func TestEditSessionLog(t *testing.T) {
+	base, err := NewPattern("0.808-alpha", 120, Track{ID: 0, Name: "kick", Steps: []byte("x---x---x---x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewEditSession(base, 1)
+
+	s.SetStep(0, 2, true)
+	s.SetTempo(128)
+	s.Toggle(0, 4)
+	s.Undo()
+
+	log := s.Log()
+	if len(log.Edits) != 2 {
+		t.Fatalf("expected the log to hold the 2 edits not undone, got %v", log.Edits)
+	}
+
+	var buf bytes.Buffer
+	if _, err := log.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var decoded EditLog
+	if _, err := decoded.ReadFrom(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := decoded.Replay(len(decoded.Edits))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, exp := fmt.Sprint(p), fmt.Sprint(s.Pattern()); got != exp {
+		t.Errorf("replaying the exported log gave a different pattern.\nGot:\n%s\nExpected:\n%s", got, exp)
+	}
+}
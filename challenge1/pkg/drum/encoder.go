@@ -0,0 +1,97 @@
+package drum
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// WriteTo encodes the pattern to w using the same binary layout that
+// DecodeFile reads. It implements io.WriterTo.
+func (p *Pattern) WriteTo(w io.Writer) (int64, error) {
+	var file bytes.Buffer
+
+	// Reserve room for the splice marker and file size, which can only
+	// be filled in once the rest of the pattern has been encoded.
+	file.Write(make([]byte, spliceSize+fileSizeSize))
+
+	if err := p.writeHeader(&file); err != nil {
+		return 0, fmt.Errorf("unable to write file header: %w", err)
+	}
+
+	for _, track := range p.tracks {
+		if err := track.write(&file); err != nil {
+			return 0, fmt.Errorf("unable to write track: %w", err)
+		}
+	}
+
+	prefix := file.Bytes()[:spliceSize+fileSizeSize]
+	copy(prefix, "SPLICE")
+	binary.BigEndian.PutUint64(prefix[spliceSize:], uint64(file.Len()-len(prefix)))
+
+	n, err := file.WriteTo(w)
+	if err != nil {
+		return n, fmt.Errorf("unable to write pattern: %w", err)
+	}
+
+	return n, nil
+}
+
+func (p *Pattern) writeHeader(w io.Writer) error {
+	if len(p.Version) > versionSize {
+		return fmt.Errorf("version %q is longer than %d bytes", p.Version, versionSize)
+	}
+
+	var version [versionSize]byte
+	copy(version[:], p.Version)
+	if _, err := w.Write(version[:]); err != nil {
+		return fmt.Errorf("unable to write pattern version: %w", err)
+	}
+
+	// The tempo is stored in LittleEndian, unlike the rest of the header.
+	if err := binary.Write(w, binary.LittleEndian, p.Tempo); err != nil {
+		return fmt.Errorf("unable to write pattern tempo: %w", err)
+	}
+
+	return nil
+}
+
+func (t Track) write(w io.Writer) error {
+	if t.ID < 0 || t.ID > 255 {
+		return fmt.Errorf("track id %d does not fit in a single byte", t.ID)
+	}
+
+	if len(t.Steps) != stepsInTrack {
+		return fmt.Errorf("track %d has %d steps, expected %d", t.ID, len(t.Steps), stepsInTrack)
+	}
+
+	trackHeader := struct {
+		ID       byte
+		WordSize int32
+	}{
+		ID:       byte(t.ID),
+		WordSize: int32(len(t.Name)),
+	}
+
+	if err := binary.Write(w, binary.BigEndian, trackHeader); err != nil {
+		return fmt.Errorf("unable to write track header: %w", err)
+	}
+
+	if _, err := io.WriteString(w, t.Name); err != nil {
+		return fmt.Errorf("unable to write track name: %w", err)
+	}
+
+	stepBytes := make([]byte, stepsInTrack)
+	for k, step := range t.Steps {
+		if step == 'x' {
+			stepBytes[k] = 1
+		}
+	}
+
+	if _, err := w.Write(stepBytes); err != nil {
+		return fmt.Errorf("unable to write track steps: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package drum
+
+import (
+	"bytes"
+	"fmt"
+	"path"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/testutil"
+)
+
+func TestWriteToReadFrom(t *testing.T) {
+	fixtures := []string{"pattern_1", "pattern_2", "pattern_3", "pattern_4", "pattern_5"}
+
+	// Write every fixture into one stream and read them back in order.
+	var stream bytes.Buffer
+	var decoded []*Pattern
+	for _, name := range fixtures {
+		p, err := DecodeFile(path.Join("..", "..", "fixtures", name+".splice"))
+		if err != nil {
+			t.Fatalf("decoding %s: %v", name, err)
+		}
+		decoded = append(decoded, p)
+
+		before := stream.Len()
+		n, err := p.WriteTo(&stream)
+		if err != nil {
+			t.Fatalf("encoding %s: %v", name, err)
+		}
+		if n != int64(stream.Len()-before) {
+			t.Errorf("%s: WriteTo reported %d bytes, wrote %d", name, n, stream.Len()-before)
+		}
+	}
+
+	for i, name := range fixtures {
+		var p Pattern
+		if _, err := p.ReadFrom(&stream); err != nil {
+			t.Fatalf("reading %s back: %v", name, err)
+		}
+
+		if fmt.Sprint(&p) != fmt.Sprint(decoded[i]) {
+			t.Errorf("%s did not round trip.\nGot:\n%s\nExpected:\n%s", name, &p, decoded[i])
+		}
+	}
+
+	if stream.Len() != 0 {
+		t.Errorf("expected the stream to be fully consumed, %d bytes left", stream.Len())
+	}
+}
+
+func TestReadFromLeavesTrailingBytes(t *testing.T) {
+	// pattern_5 carries padding after the size declared in its header.
+	data := testutil.Fixture(t, "..", "..", "fixtures", "pattern_5.splice")
+
+	r := bytes.NewReader(data)
+
+	var p Pattern
+	n, err := p.ReadFrom(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if n != 101 || r.Len() != len(data)-101 {
+		t.Errorf("expected to read exactly 101 bytes, read %d leaving %d", n, r.Len())
+	}
+}
+
+func TestReadFromTruncated(t *testing.T) {
+	data := testutil.Fixture(t, "..", "..", "fixtures", "pattern_1.splice")
+
+	var p Pattern
+	if _, err := p.ReadFrom(bytes.NewReader(data[:len(data)-10])); err == nil {
+		t.Error("expected an error reading a truncated pattern")
+	}
+}
@@ -0,0 +1,159 @@
+package drum
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+)
+
+// An Exporter writes patterns in a format other programs read. Formats
+// are made available by registering an Exporter for them with
+// RegisterExporter, usually from the init function of the package that
+// implements them.
+type Exporter interface {
+	// Name is the short name the format is chosen by, such as "json".
+	Name() string
+
+	// Extensions are the file extensions, with their leading dots, that
+	// name files in the format.
+	Extensions() []string
+
+	// Export writes p to w.
+	Export(w io.Writer, p *Pattern) error
+}
+
+// ErrUnknownExporter is returned when no registered Exporter matches a
+// name or file extension.
+var ErrUnknownExporter = errcode.New(errcode.DrumUnknownExporter, "unknown exporter")
+
+var (
+	exportersMu sync.RWMutex
+	exporters   = make(map[string]Exporter)
+)
+
+// RegisterExporter makes e available by its name and extensions. It
+// panics if an Exporter with the same name is already registered.
+func RegisterExporter(e Exporter) {
+	exportersMu.Lock()
+	defer exportersMu.Unlock()
+
+	name := e.Name()
+	if _, dup := exporters[name]; dup {
+		panic("drum: RegisterExporter called twice for exporter " + name)
+	}
+	exporters[name] = e
+}
+
+// Exporters returns every registered Exporter, sorted by name.
+func Exporters() []Exporter {
+	exportersMu.RLock()
+	defer exportersMu.RUnlock()
+
+	list := make([]Exporter, 0, len(exporters))
+	for _, e := range exporters {
+		list = append(list, e)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].Name() < list[j].Name()
+	})
+
+	return list
+}
+
+// LookupExporter returns the Exporter registered under name.
+func LookupExporter(name string) (Exporter, error) {
+	exportersMu.RLock()
+	defer exportersMu.RUnlock()
+
+	e, ok := exporters[name]
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownExporter, name)
+	}
+
+	return e, nil
+}
+
+// ExporterFor returns the Exporter whose extensions include that of
+// path, ignoring case. When several do, the first by name is returned.
+func ExporterFor(path string) (Exporter, error) {
+	ext := filepath.Ext(path)
+	for _, e := range Exporters() {
+		for _, candidate := range e.Extensions() {
+			if strings.EqualFold(candidate, ext) {
+				return e, nil
+			}
+		}
+	}
+
+	return nil, fmt.Errorf("%w for %q", ErrUnknownExporter, ext)
+}
+
+// exporter adapts an export function to the Exporter interface for the
+// formats built into the package.
+type exporter struct {
+	name       string
+	extensions []string
+	export     func(w io.Writer, p *Pattern) error
+}
+
+func (e exporter) Name() string                         { return e.name }
+func (e exporter) Extensions() []string                 { return append([]string(nil), e.extensions...) }
+func (e exporter) Export(w io.Writer, p *Pattern) error { return e.export(w, p) }
+
+func init() {
+	RegisterExporter(exporter{
+		name:       "splice",
+		extensions: []string{".splice"},
+		export: func(w io.Writer, p *Pattern) error {
+			_, err := p.WriteTo(w)
+			return err
+		},
+	})
+
+	RegisterExporter(exporter{
+		name:       "json",
+		extensions: []string{".json"},
+		export: func(w io.Writer, p *Pattern) error {
+			enc := json.NewEncoder(w)
+			enc.SetIndent("", "  ")
+			return enc.Encode(p)
+		},
+	})
+
+	RegisterExporter(exporter{
+		name:       "csv",
+		extensions: []string{".csv"},
+		export:     exportCSV,
+	})
+
+	RegisterExporter(exporter{
+		name:       "text",
+		extensions: []string{".txt"},
+		export: func(w io.Writer, p *Pattern) error {
+			_, err := io.WriteString(w, p.String())
+			return err
+		},
+	})
+}
+
+// exportCSV writes a header row followed by a row for each track holding
+// its ID, name and steps in the x/- notation String uses. The version
+// and tempo are left out, as spreadsheets want one record per row.
+func exportCSV(w io.Writer, p *Pattern) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "name", "steps"})
+	for track := range p.Tracks() {
+		cw.Write([]string{strconv.Itoa(track.ID), track.Name, string(track.Steps)})
+	}
+	cw.Flush()
+
+	return cw.Error()
+}
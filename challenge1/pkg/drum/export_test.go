@@ -0,0 +1,102 @@
+package drum
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/testutil"
+)
+
+func TestBuiltinExporters(t *testing.T) {
+	p, err := DecodeFile(filepath.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tData := []struct {
+		name     string
+		expected []byte
+	}{
+		{"splice", testutil.Fixture(t, "..", "..", "fixtures", "pattern_1.splice")},
+		{"json", testutil.Fixture(t, "..", "..", "fixtures", "pattern_1.json.golden")},
+		{"csv", testutil.Fixture(t, "..", "..", "fixtures", "pattern_1.csv.golden")},
+		{"text", testutil.Fixture(t, "..", "..", "fixtures", "pattern_1.golden")},
+	}
+
+	for _, exp := range tData {
+		e, err := LookupExporter(exp.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got bytes.Buffer
+		if err := e.Export(&got, p); err != nil {
+			t.Fatalf("%s export failed: %v", exp.name, err)
+		}
+		if !bytes.Equal(got.Bytes(), exp.expected) {
+			t.Errorf("%s export wrote\n%s\nexpected\n%s", exp.name, got.Bytes(), exp.expected)
+		}
+	}
+}
+
+// tsvExporter stands in for a format registered from outside the
+// package.
+type tsvExporter struct{}
+
+func (tsvExporter) Name() string         { return "test-tsv" }
+func (tsvExporter) Extensions() []string { return []string{".tsv"} }
+
+func (tsvExporter) Export(w io.Writer, p *Pattern) error {
+	for track := range p.Tracks() {
+		if _, err := fmt.Fprintf(w, "%d\t%s\t%s\n", track.ID, track.Name, track.Steps); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func TestRegisterExporter(t *testing.T) {
+	// Registrations last as long as the process, which -count reruns
+	// tests in.
+	if _, err := LookupExporter("test-tsv"); err != nil {
+		RegisterExporter(tsvExporter{})
+	}
+
+	var names []string
+	for _, e := range Exporters() {
+		names = append(names, e.Name())
+	}
+	expected := []string{"csv", "json", "splice", "test-tsv", "text"}
+	if fmt.Sprint(names) != fmt.Sprint(expected) {
+		t.Fatalf("registered exporters are %v, expected %v", names, expected)
+	}
+
+	e, err := ExporterFor(filepath.Join("out", "pattern.TSV"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name() != "test-tsv" {
+		t.Fatalf("expected the test-tsv exporter for .TSV files, got %s", e.Name())
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected registering the same name twice to panic")
+		}
+	}()
+	RegisterExporter(tsvExporter{})
+}
+
+func TestUnknownExporter(t *testing.T) {
+	if _, err := LookupExporter("midi"); !errors.Is(err, ErrUnknownExporter) {
+		t.Errorf("expected ErrUnknownExporter, got %v", err)
+	}
+	if _, err := ExporterFor("pattern.mid"); !errors.Is(err, ErrUnknownExporter) {
+		t.Errorf("expected ErrUnknownExporter, got %v", err)
+	}
+}
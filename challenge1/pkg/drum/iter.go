@@ -0,0 +1,29 @@
+package drum
+
+import "iter"
+
+// Tracks returns an iterator over the pattern's tracks in file order.
+// Each track is yielded as a copy, so modifying it does not change the
+// pattern.
+func (p *Pattern) Tracks() iter.Seq[Track] {
+	return func(yield func(Track) bool) {
+		for _, track := range p.tracks {
+			track.Steps = append([]byte(nil), track.Steps...)
+			if !yield(track) {
+				return
+			}
+		}
+	}
+}
+
+// Hits returns an iterator over the zero based indexes of the steps
+// that play.
+func (t Track) Hits() iter.Seq[int] {
+	return func(yield func(int) bool) {
+		for k, step := range t.Steps {
+			if step == 'x' && !yield(k) {
+				return
+			}
+		}
+	}
+}
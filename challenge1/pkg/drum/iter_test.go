@@ -0,0 +1,49 @@
+package drum
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestPatternTracks(t *testing.T) {
+	p, err := DecodeFile(path.Join("..", "..", "fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for track := range p.Tracks() {
+		names = append(names, track.Name)
+		track.Steps[0] = '-'
+	}
+
+	expected := []string{"kick", "snare", "hh-open", "cowbell"}
+	if !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected tracks: %v != %v", names, expected)
+	}
+
+	if p.tracks[0].Steps[0] != 'x' {
+		t.Error("modifying a yielded track changed the pattern")
+	}
+
+	for track := range p.Tracks() {
+		if track.Name != "kick" {
+			t.Errorf("expected to stop after the first track, got %s", track.Name)
+		}
+		break
+	}
+}
+
+func TestTrackHits(t *testing.T) {
+	track := Track{ID: 3, Name: "hh-open", Steps: []byte("--x---x-x-x---x-")}
+
+	var hits []int
+	for step := range track.Hits() {
+		hits = append(hits, step)
+	}
+
+	if expected := []int{2, 6, 8, 10, 14}; !reflect.DeepEqual(hits, expected) {
+		t.Errorf("unexpected hits: %v != %v", hits, expected)
+	}
+}
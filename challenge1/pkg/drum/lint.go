@@ -0,0 +1,181 @@
+package drum
+
+import (
+	"fmt"
+	"math"
+	"unicode"
+)
+
+// Severity describes how serious a lint problem is.
+type Severity int
+
+// The severities a lint rule can report.
+const (
+	SeverityWarning Severity = iota
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	default:
+		return fmt.Sprintf("severity(%d)", int(s))
+	}
+}
+
+// Problem is a single issue found while linting a pattern.
+type Problem struct {
+	Rule     string
+	Severity Severity
+	Message  string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%v: %v (%v)", p.Severity, p.Message, p.Rule)
+}
+
+// Rule is a named check run by a Linter. Check returns a message for
+// every issue it finds in the pattern.
+type Rule struct {
+	Name        string
+	Description string
+	Severity    Severity
+	Check       func(p *Pattern) []string
+}
+
+// DefaultRules are the rules run by Lint.
+var DefaultRules = []Rule{
+	{
+		Name:        "duplicate-track-id",
+		Description: "two or more tracks share the same ID",
+		Severity:    SeverityError,
+		Check:       checkDuplicateTrackIDs,
+	},
+	{
+		Name:        "empty-track-name",
+		Description: "a track has no name",
+		Severity:    SeverityWarning,
+		Check:       checkEmptyTrackNames,
+	},
+	{
+		Name:        "invalid-tempo",
+		Description: "the tempo is zero, negative or not a number",
+		Severity:    SeverityError,
+		Check:       checkTempo,
+	},
+	{
+		Name:        "silent-track",
+		Description: "a track has no active steps",
+		Severity:    SeverityWarning,
+		Check:       checkSilentTracks,
+	},
+	{
+		Name:        "non-ascii-track-name",
+		Description: "a track name contains non-ASCII characters",
+		Severity:    SeverityWarning,
+		Check:       checkNonASCIITrackNames,
+	},
+}
+
+// Linter checks patterns against a configurable set of rules.
+type Linter struct {
+	Rules []Rule
+
+	// Disabled holds the names of rules that should be skipped.
+	Disabled map[string]bool
+}
+
+// Lint checks the pattern against DefaultRules.
+func Lint(p *Pattern) []Problem {
+	return (&Linter{Rules: DefaultRules}).Lint(p)
+}
+
+// Lint checks the pattern against every enabled rule and returns the
+// problems found, grouped by rule.
+func (l *Linter) Lint(p *Pattern) []Problem {
+	var problems []Problem
+	for _, rule := range l.Rules {
+		if l.Disabled[rule.Name] {
+			continue
+		}
+
+		for _, message := range rule.Check(p) {
+			problems = append(problems, Problem{
+				Rule:     rule.Name,
+				Severity: rule.Severity,
+				Message:  message,
+			})
+		}
+	}
+
+	return problems
+}
+
+func checkDuplicateTrackIDs(p *Pattern) []string {
+	var messages []string
+
+	seen := make(map[int]int)
+	for _, track := range p.tracks {
+		seen[track.ID]++
+		if seen[track.ID] == 2 {
+			messages = append(messages, fmt.Sprintf("track ID %d is used more than once", track.ID))
+		}
+	}
+
+	return messages
+}
+
+func checkEmptyTrackNames(p *Pattern) []string {
+	var messages []string
+	for _, track := range p.tracks {
+		if track.Name == "" {
+			messages = append(messages, fmt.Sprintf("track %d has an empty name", track.ID))
+		}
+	}
+
+	return messages
+}
+
+func checkTempo(p *Pattern) []string {
+	if p.Tempo <= 0 || math.IsNaN(float64(p.Tempo)) {
+		return []string{fmt.Sprintf("tempo %v is not a positive number", p.Tempo)}
+	}
+
+	return nil
+}
+
+func checkSilentTracks(p *Pattern) []string {
+	var messages []string
+	for _, track := range p.tracks {
+		silent := true
+		for _, step := range track.Steps {
+			if step == 'x' {
+				silent = false
+				break
+			}
+		}
+
+		if silent {
+			messages = append(messages, fmt.Sprintf("track %d (%s) has no active steps", track.ID, track.Name))
+		}
+	}
+
+	return messages
+}
+
+func checkNonASCIITrackNames(p *Pattern) []string {
+	var messages []string
+	for _, track := range p.tracks {
+		for _, r := range track.Name {
+			if r > unicode.MaxASCII {
+				messages = append(messages, fmt.Sprintf("track %d name %q contains non-ASCII characters", track.ID, track.Name))
+				break
+			}
+		}
+	}
+
+	return messages
+}
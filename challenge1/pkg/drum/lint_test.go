@@ -0,0 +1,52 @@
+package drum
+
+import (
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestLint(t *testing.T) {
+	p := &Pattern{
+		Version: "0.808-alpha",
+		Tempo:   0,
+		tracks: []Track{
+			{ID: 1, Name: "kick", Steps: []byte("x---x---x---x---")},
+			{ID: 1, Name: "", Steps: []byte("----x-------x---")},
+			{ID: 2, Name: "caixa-clara-ç", Steps: []byte("----------------")},
+		},
+	}
+
+	expected := []Problem{
+		{"duplicate-track-id", SeverityError, "track ID 1 is used more than once"},
+		{"empty-track-name", SeverityWarning, "track 1 has an empty name"},
+		{"invalid-tempo", SeverityError, "tempo 0 is not a positive number"},
+		{"silent-track", SeverityWarning, "track 2 (caixa-clara-ç) has no active steps"},
+		{"non-ascii-track-name", SeverityWarning, `track 2 name "caixa-clara-ç" contains non-ASCII characters`},
+	}
+
+	if problems := Lint(p); !reflect.DeepEqual(problems, expected) {
+		t.Errorf("unexpected problems.\nGot:\n%v\nExpected:\n%v", problems, expected)
+	}
+
+	linter := Linter{
+		Rules:    DefaultRules,
+		Disabled: map[string]bool{"invalid-tempo": true, "silent-track": true},
+	}
+	for _, problem := range linter.Lint(p) {
+		if linter.Disabled[problem.Rule] {
+			t.Errorf("disabled rule %s reported %q", problem.Rule, problem.Message)
+		}
+	}
+}
+
+func TestLintFixtures(t *testing.T) {
+	decoded, err := DecodeFile(path.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if problems := Lint(decoded); len(problems) != 0 {
+		t.Errorf("expected pattern_1 to be clean, got %v", problems)
+	}
+}
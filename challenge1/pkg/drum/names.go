@@ -0,0 +1,25 @@
+package drum
+
+import (
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// cleanName applies the decoder's track name options to the track.
+func (d *Decoder) cleanName(track *Track) {
+	original := track.Name
+
+	if d.ValidateNames && !utf8.ValidString(track.Name) {
+		track.Name = strings.ToValidUTF8(track.Name, string(utf8.RuneError))
+	}
+
+	if d.NormalizeNames {
+		track.Name = norm.NFC.String(track.Name)
+	}
+
+	if track.Name != original && d.NameChanged != nil {
+		d.NameChanged(*track, original)
+	}
+}
@@ -0,0 +1,72 @@
+package drum
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestDecoderTrackNames(t *testing.T) {
+	p, err := NewPattern("0.808-alpha", 120,
+		Track{ID: 0, Name: "kick", Steps: []byte("x---x---x---x---")},
+		Track{ID: 1, Name: "sn\xffare", Steps: []byte("----x-------x---")},
+		Track{ID: 2, Name: "cafe\u0301", Steps: []byte("--x---x---x---x-")},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file bytes.Buffer
+	if _, err := p.WriteTo(&file); err != nil {
+		t.Fatal(err)
+	}
+
+	var changed []int
+	decoder := Decoder{
+		ValidateNames:  true,
+		NormalizeNames: true,
+		NameChanged: func(track Track, original string) {
+			changed = append(changed, track.ID)
+		},
+	}
+
+	decoded, err := decoder.Decode(&file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for track := range decoded.Tracks() {
+		names = append(names, track.Name)
+	}
+
+	if expected := []string{"kick", "sn\ufffdare", "caf\u00e9"}; !reflect.DeepEqual(names, expected) {
+		t.Errorf("unexpected names: %q != %q", names, expected)
+	}
+
+	if expected := []int{1, 2}; !reflect.DeepEqual(changed, expected) {
+		t.Errorf("unexpected changed tracks: %v != %v", changed, expected)
+	}
+}
+
+func TestDecoderKeepsNamesByDefault(t *testing.T) {
+	p, err := NewPattern("0.808-alpha", 120, Track{ID: 1, Name: "sn\xffare", Steps: []byte("----x-------x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var file bytes.Buffer
+	if _, err := p.WriteTo(&file); err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeStream(&file, func(track Track) error {
+		if track.Name != "sn\xffare" {
+			t.Errorf("expected the stored name, got %q", track.Name)
+		}
+		return nil
+	})
+	if err != nil || decoded == nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,75 @@
+package drum
+
+import (
+	"bufio"
+	"io"
+)
+
+const (
+	// scratchSize fits the file header and any reasonable track name.
+	scratchSize = 256
+
+	// stepsSlabSize is how many bytes of step storage are allocated at
+	// once and then handed out to tracks sixteen bytes at a time.
+	stepsSlabSize = 64 * stepsInTrack
+)
+
+// decodeState holds the buffers a Decoder reuses from one decode to the
+// next, so that decoding thousands of files does not allocate a reader,
+// hashes and header buffers for every file.
+type decodeState struct {
+	reader  *bufio.Reader
+	sums    *checksums
+	scratch []byte
+	steps   []byte
+
+	// source and tracks are embedded rather than allocated per decode.
+	source io.Reader
+	tracks io.LimitedReader
+}
+
+func (d *Decoder) getState() *decodeState {
+	if s, ok := d.states.Get().(*decodeState); ok {
+		s.sums.Reset()
+		return s
+	}
+
+	return &decodeState{
+		reader:  bufio.NewReaderSize(nil, readBufferSize),
+		sums:    newChecksums(),
+		scratch: make([]byte, scratchSize),
+	}
+}
+
+func (d *Decoder) putState(s *decodeState) {
+	// Drop references to the caller's reader so it can be collected.
+	s.reader.Reset(nil)
+	s.source = nil
+	s.tracks.R = nil
+
+	d.states.Put(s)
+}
+
+// Read reads from the source and hashes everything read, so a checksum
+// footer can be verified without reading the pattern twice.
+func (s *decodeState) Read(b []byte) (int, error) {
+	n, err := s.source.Read(b)
+	s.sums.Write(b[:n])
+
+	return n, err
+}
+
+// nextSteps returns storage for one track's steps. Tracks keep their
+// steps after the decode finishes, so the storage is carved from a slab
+// and never handed out twice. The slice is capped so appending to it
+// cannot run into the next track's steps.
+func (s *decodeState) nextSteps() []byte {
+	if len(s.steps) < stepsInTrack {
+		s.steps = make([]byte, stepsSlabSize)
+	}
+
+	steps := s.steps[:stepsInTrack:stepsInTrack]
+	s.steps = s.steps[stepsInTrack:]
+
+	return steps
+}
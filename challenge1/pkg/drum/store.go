@@ -0,0 +1,144 @@
+package drum
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jpreese/go-mentor/challenge1/internal/errcode"
+)
+
+// ErrPatternNotFound is returned by a Store when no pattern exists
+// for the requested ID.
+var ErrPatternNotFound = errcode.New(errcode.DrumPatternNotFound, "pattern not found")
+
+// ErrInvalidPatternID is returned by a Store for an ID it cannot keep a
+// pattern under.
+var ErrInvalidPatternID = errcode.New(errcode.DrumInvalidPatternID, "invalid pattern id")
+
+// Store manages a collection of patterns addressed by ID. FileStore
+// keeps them as files; the sqlitebridge module keeps them in SQLite.
+type Store interface {
+	Put(id string, p *Pattern) error
+	Get(id string) (*Pattern, error)
+	List() ([]string, error)
+	Delete(id string) error
+}
+
+const patternExtension = ".splice"
+
+// FileStore is a Store that keeps each pattern as a .splice file
+// inside a single directory.
+type FileStore struct {
+	dir string
+}
+
+// NewFileStore creates a FileStore rooted at dir, creating the
+// directory if it does not already exist.
+func NewFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("create store directory: %w", err)
+	}
+
+	return &FileStore{dir: dir}, nil
+}
+
+// Put encodes the pattern and stores it under the given ID, replacing
+// any pattern previously stored with that ID.
+func (s *FileStore) Put(id string, p *Pattern) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so a failed encode never leaves
+	// a truncated pattern behind.
+	file, err := os.CreateTemp(s.dir, "."+id+"-*")
+	if err != nil {
+		return fmt.Errorf("create temporary file: %w", err)
+	}
+	defer os.Remove(file.Name())
+
+	if _, err := p.WriteTo(file); err != nil {
+		file.Close()
+		return fmt.Errorf("encode pattern %q: %w", id, err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("close temporary file: %w", err)
+	}
+
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("store pattern %q: %w", id, err)
+	}
+
+	return nil
+}
+
+// Get decodes the pattern stored under the given ID.
+func (s *FileStore) Get(id string) (*Pattern, error) {
+	path, err := s.path(id)
+	if err != nil {
+		return nil, err
+	}
+
+	p, err := DecodeFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("get pattern %q: %w", id, ErrPatternNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pattern %q: %w", id, err)
+	}
+
+	return p, nil
+}
+
+// List returns the IDs of all stored patterns in sorted order.
+func (s *FileStore) List() ([]string, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		return nil, fmt.Errorf("list store directory: %w", err)
+	}
+
+	var ids []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || filepath.Ext(name) != patternExtension {
+			continue
+		}
+
+		ids = append(ids, strings.TrimSuffix(name, patternExtension))
+	}
+	sort.Strings(ids)
+
+	return ids, nil
+}
+
+// Delete removes the pattern stored under the given ID.
+func (s *FileStore) Delete(id string) error {
+	path, err := s.path(id)
+	if err != nil {
+		return err
+	}
+
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("delete pattern %q: %w", id, ErrPatternNotFound)
+	}
+	if err != nil {
+		return fmt.Errorf("delete pattern %q: %w", id, err)
+	}
+
+	return nil
+}
+
+func (s *FileStore) path(id string) (string, error) {
+	if id == "" || strings.HasPrefix(id, ".") || strings.ContainsAny(id, `/\`) {
+		return "", fmt.Errorf("%w %q", ErrInvalidPatternID, id)
+	}
+
+	return filepath.Join(s.dir, id+patternExtension), nil
+}
@@ -0,0 +1,67 @@
+package drum
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "drum-store")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	store, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fixtures := []string{"pattern_1", "pattern_2", "pattern_3", "pattern_4", "pattern_5"}
+	for _, id := range fixtures {
+		decoded, err := DecodeFile(path.Join("..", "..", "fixtures", id+".splice"))
+		if err != nil {
+			t.Fatalf("decoding %s: %v", id, err)
+		}
+
+		if err := store.Put(id, decoded); err != nil {
+			t.Fatalf("storing %s: %v", id, err)
+		}
+
+		stored, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("loading %s: %v", id, err)
+		}
+
+		if fmt.Sprint(stored) != fmt.Sprint(decoded) {
+			t.Errorf("%s did not round trip.\nGot:\n%s\nExpected:\n%s", id, stored, decoded)
+		}
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, fixtures) {
+		t.Errorf("unexpected ids: %v != %v", ids, fixtures)
+	}
+
+	if err := store.Delete("pattern_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("pattern_1"); !errors.Is(err, ErrPatternNotFound) {
+		t.Errorf("expected ErrPatternNotFound after delete, got %v", err)
+	}
+	if err := store.Delete("pattern_1"); !errors.Is(err, ErrPatternNotFound) {
+		t.Errorf("expected ErrPatternNotFound deleting twice, got %v", err)
+	}
+
+	if err := store.Put("../escape", &Pattern{}); !errors.Is(err, ErrInvalidPatternID) {
+		t.Errorf("expected ErrInvalidPatternID storing a pattern outside the store directory, got %v", err)
+	}
+}
@@ -0,0 +1,40 @@
+// Package drumjs exposes the drum decoder to JavaScript when built for
+// GOOS=js GOARCH=wasm, so that a browser can show patterns without a
+// server.
+//
+// Register defines a global drum object with two functions, each taking
+// the bytes of a .splice file as a Uint8Array:
+//
+//	drum.decode(bytes)  // {version, tempo, tracks: [{id, name, steps}]}
+//	drum.render(bytes)  // the pattern as text, as String renders it
+//
+// Both return {error: message} instead when the file does not decode.
+package drumjs
+
+import (
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+// patternObject returns p in the shape decode hands to JavaScript, made
+// of the types js.ValueOf converts.
+func patternObject(p *drum.Pattern) map[string]any {
+	tracks := []any{}
+	for track := range p.Tracks() {
+		tracks = append(tracks, map[string]any{
+			"id":    track.ID,
+			"name":  track.Name,
+			"steps": string(track.Steps),
+		})
+	}
+
+	return map[string]any{
+		"version": p.Version,
+		"tempo":   float64(p.Tempo),
+		"tracks":  tracks,
+	}
+}
+
+// errorObject returns err in the shape JavaScript is handed on failure.
+func errorObject(err error) map[string]any {
+	return map[string]any{"error": err.Error()}
+}
@@ -0,0 +1,38 @@
+package drumjs
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+func TestPatternObject(t *testing.T) {
+	p, err := drum.DecodeFile(filepath.Join("..", "..", "fixtures", "pattern_2.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]any{
+		"version": "0.808-alpha",
+		"tempo":   float64(float32(98.4)),
+		"tracks": []any{
+			map[string]any{"id": 0, "name": "kick", "steps": "x-------x-------"},
+			map[string]any{"id": 1, "name": "snare", "steps": "----x-------x---"},
+			map[string]any{"id": 3, "name": "hh-open", "steps": "--x---x-x-x---x-"},
+			map[string]any{"id": 5, "name": "cowbell", "steps": "--------x-------"},
+		},
+	}
+	if got := patternObject(p); !reflect.DeepEqual(got, expected) {
+		t.Fatalf("got %v, expected %v", got, expected)
+	}
+}
+
+func TestErrorObject(t *testing.T) {
+	got := errorObject(errors.New("truncated"))
+	if !reflect.DeepEqual(got, map[string]any{"error": "truncated"}) {
+		t.Fatalf("unexpected error object %v", got)
+	}
+}
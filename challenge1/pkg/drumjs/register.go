@@ -0,0 +1,45 @@
+//go:build js && wasm
+
+package drumjs
+
+import (
+	"errors"
+	"syscall/js"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+// Register defines the global drum object. The functions it holds live
+// as long as the program, which must keep running for JavaScript to
+// call them.
+func Register() {
+	js.Global().Set("drum", js.ValueOf(map[string]any{
+		"decode": js.FuncOf(func(this js.Value, args []js.Value) any {
+			p, err := decodeArg(args)
+			if err != nil {
+				return errorObject(err)
+			}
+			return patternObject(p)
+		}),
+		"render": js.FuncOf(func(this js.Value, args []js.Value) any {
+			p, err := decodeArg(args)
+			if err != nil {
+				return errorObject(err)
+			}
+			return p.String()
+		}),
+	}))
+}
+
+// decodeArg decodes the pattern in the Uint8Array passed as the only
+// argument.
+func decodeArg(args []js.Value) (*drum.Pattern, error) {
+	if len(args) != 1 || !args[0].InstanceOf(js.Global().Get("Uint8Array")) {
+		return nil, errors.New("expected the pattern file as a Uint8Array")
+	}
+
+	b := make([]byte, args[0].Length())
+	js.CopyBytesToGo(b, args[0])
+
+	return drum.DecodeBytes(b)
+}
@@ -0,0 +1,42 @@
+//go:build js && wasm
+
+package drumjs
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall/js"
+	"testing"
+)
+
+func TestRegister(t *testing.T) {
+	Register()
+	drum := js.Global().Get("drum")
+
+	data, err := os.ReadFile(filepath.Join("..", "..", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	bytes := js.Global().Get("Uint8Array").New(len(data))
+	js.CopyBytesToJS(bytes, data)
+
+	p := drum.Call("decode", bytes)
+	if got := p.Get("version").String(); got != "0.808-alpha" {
+		t.Errorf("expected version 0.808-alpha, got %q", got)
+	}
+	if got := p.Get("tracks").Index(5).Get("name").String(); got != "cowbell" {
+		t.Errorf("expected the sixth track to be the cowbell, got %q", got)
+	}
+
+	text := drum.Call("render", bytes).String()
+	if !strings.HasPrefix(text, "Saved with HW Version: 0.808-alpha\nTempo: 120\n") {
+		t.Errorf("unexpected rendering %q", text)
+	}
+
+	for _, arg := range []any{"pattern_1.splice", bytes.Call("subarray", 0, 10)} {
+		if msg := drum.Call("decode", arg).Get("error"); msg.Type() != js.TypeString {
+			t.Errorf("expected decoding %v to fail", arg)
+		}
+	}
+}
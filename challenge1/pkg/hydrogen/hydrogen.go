@@ -0,0 +1,165 @@
+// Package hydrogen reads and writes drum patterns as songs of the
+// Hydrogen drum machine, and registers the "hydrogen" exporter with the
+// drum package.
+//
+// A pattern becomes a song of one bar long pattern, with an instrument
+// for each of its tracks. The instruments have no samples, so Hydrogen
+// plays nothing until a drumkit is loaded over them.
+package hydrogen
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+// Hydrogen counts 48 ticks to a beat, so a bar of sixteen steps lasts
+// 192.
+const (
+	ticksPerStep = 12
+	stepsPerBar  = 16
+	barSize      = ticksPerStep * stepsPerBar
+)
+
+// formatVersion is the version of Hydrogen whose song format WriteSong
+// writes.
+const formatVersion = "0.9.7"
+
+// patternName names the one pattern of the songs WriteSong writes.
+const patternName = "pattern"
+
+// ErrNoPattern is returned by ReadSong for a song without patterns.
+var ErrNoPattern = errors.New("hydrogen: song has no pattern")
+
+func init() {
+	drum.RegisterExporter(songExporter{})
+}
+
+// songExporter registers WriteSong with the drum package as "hydrogen".
+type songExporter struct{}
+
+func (songExporter) Name() string         { return "hydrogen" }
+func (songExporter) Extensions() []string { return []string{".h2song"} }
+
+func (songExporter) Export(w io.Writer, p *drum.Pattern) error {
+	return WriteSong(w, p)
+}
+
+// song is the part of a .h2song file WriteSong writes and ReadSong
+// reads.
+type song struct {
+	XMLName     xml.Name     `xml:"song"`
+	Version     string       `xml:"version"`
+	BPM         float32      `xml:"bpm"`
+	Volume      float32      `xml:"volume"`
+	Name        string       `xml:"name"`
+	Mode        string       `xml:"mode"`
+	Instruments []instrument `xml:"instrumentList>instrument"`
+	Patterns    []pattern    `xml:"patternList>pattern"`
+	Sequence    []group      `xml:"patternSequence>group"`
+}
+
+type instrument struct {
+	ID     int     `xml:"id"`
+	Name   string  `xml:"name"`
+	Volume float32 `xml:"volume"`
+	Muted  bool    `xml:"isMuted"`
+	PanL   float32 `xml:"pan_L"`
+	PanR   float32 `xml:"pan_R"`
+}
+
+type pattern struct {
+	Name  string `xml:"name"`
+	Size  int    `xml:"size"`
+	Notes []note `xml:"noteList>note"`
+}
+
+type note struct {
+	Position   int     `xml:"position"`
+	Velocity   float32 `xml:"velocity"`
+	PanL       float32 `xml:"pan_L"`
+	PanR       float32 `xml:"pan_R"`
+	Length     int     `xml:"length"`
+	Instrument int     `xml:"instrument"`
+}
+
+type group struct {
+	PatternID []string `xml:"patternID"`
+}
+
+// WriteSong writes p to w as a Hydrogen song named after its version,
+// with an instrument for each track, identified by the track's ID.
+func WriteSong(w io.Writer, p *drum.Pattern) error {
+	s := song{
+		Version:  formatVersion,
+		BPM:      p.Tempo,
+		Volume:   0.5,
+		Name:     p.Version,
+		Mode:     "pattern",
+		Sequence: []group{{PatternID: []string{patternName}}},
+	}
+	bar := pattern{Name: patternName, Size: barSize}
+	for track := range p.Tracks() {
+		s.Instruments = append(s.Instruments, instrument{ID: track.ID, Name: track.Name, Volume: 1, PanL: 1, PanR: 1})
+		for step, state := range track.Steps {
+			if state == 'x' {
+				bar.Notes = append(bar.Notes, note{
+					Position:   step * ticksPerStep,
+					Velocity:   0.8,
+					PanL:       0.5,
+					PanR:       0.5,
+					Length:     -1,
+					Instrument: track.ID,
+				})
+			}
+		}
+	}
+	s.Patterns = []pattern{bar}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", " ")
+	if err := enc.Encode(s); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+
+	return err
+}
+
+// ReadSong reads the first bar of the first pattern of the Hydrogen
+// song r, with a track for each of its instruments in the order the
+// song lists them. Notes off the sixteenth note grid go to the nearest
+// step.
+func ReadSong(r io.Reader) (*drum.Pattern, error) {
+	var s song
+	if err := xml.NewDecoder(r).Decode(&s); err != nil {
+		return nil, fmt.Errorf("hydrogen: %w", err)
+	}
+	if len(s.Patterns) == 0 {
+		return nil, ErrNoPattern
+	}
+
+	tracks := make([]drum.Track, len(s.Instruments))
+	index := make(map[int]int, len(s.Instruments))
+	for i, inst := range s.Instruments {
+		tracks[i] = drum.Track{ID: inst.ID, Name: inst.Name, Steps: []byte(strings.Repeat("-", stepsPerBar))}
+		index[inst.ID] = i
+	}
+	for _, n := range s.Patterns[0].Notes {
+		i, ok := index[n.Instrument]
+		step := (n.Position + ticksPerStep/2) / ticksPerStep
+		if !ok || n.Position < 0 || step >= stepsPerBar {
+			continue
+		}
+		tracks[i].Steps[step] = 'x'
+	}
+
+	return drum.NewPattern(s.Name, s.BPM, tracks...)
+}
@@ -0,0 +1,91 @@
+package hydrogen
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+func TestSongRoundTrip(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("..", "..", "fixtures", "*.splice"))
+	if err != nil || len(paths) == 0 {
+		t.Fatalf("no fixtures: %v", err)
+	}
+
+	for _, path := range paths {
+		p, err := drum.DecodeFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var song bytes.Buffer
+		if err := WriteSong(&song, p); err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+
+		read, err := ReadSong(&song)
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if read.String() != p.String() {
+			t.Errorf("%s: read back\n%s\nexpected\n%s", path, read, p)
+		}
+	}
+}
+
+func TestSongExporter(t *testing.T) {
+	e, err := drum.ExporterFor("pattern.h2song")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name() != "hydrogen" {
+		t.Fatalf("expected the hydrogen exporter for .h2song files, got %s", e.Name())
+	}
+
+	p, err := drum.NewPattern("0.808-alpha", 120, drum.Track{ID: 3, Name: "kick", Steps: []byte("x-------x-------")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var song bytes.Buffer
+	if err := e.Export(&song, p); err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{
+		"<bpm>120</bpm>",
+		"<instrument>\n   <id>3</id>\n   <name>kick</name>",
+		"<position>96</position>",
+		"<patternID>pattern</patternID>",
+	} {
+		if !strings.Contains(song.String(), want) {
+			t.Errorf("song lacks %q:\n%s", want, song.String())
+		}
+	}
+}
+
+func TestReadSongOffGrid(t *testing.T) {
+	const song = `<song><name>humanized</name><bpm>90</bpm>
+<instrumentList><instrument><id>0</id><name>kick</name></instrument></instrumentList>
+<patternList><pattern><noteList>
+<note><position>2</position><instrument>0</instrument></note>
+<note><position>43</position><instrument>0</instrument></note>
+<note><position>191</position><instrument>0</instrument></note>
+<note><position>50</position><instrument>9</instrument></note>
+</noteList></pattern></patternList></song>`
+
+	p, err := ReadSong(strings.NewReader(song))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "Saved with HW Version: humanized\nTempo: 90\n(0) kick\t|x---|x---|----|----|\n"
+	if p.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, p)
+	}
+
+	if _, err := ReadSong(strings.NewReader("<song></song>")); !errors.Is(err, ErrNoPattern) {
+		t.Errorf("expected ErrNoPattern, got %v", err)
+	}
+}
@@ -0,0 +1,193 @@
+// Package index scans directories of drum pattern files and records
+// their metadata so collections can be searched without decoding every
+// file again.
+package index
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+// Entry holds the metadata extracted from a single pattern file.
+type Entry struct {
+	Path    string
+	Hash    string
+	Version string
+	Tempo   float32
+	Tracks  []string
+}
+
+// Index is a searchable collection of pattern metadata.
+type Index struct {
+	Entries []Entry
+}
+
+// Build walks each directory looking for .splice files and indexes
+// every pattern it finds.
+func Build(dirs ...string) (*Index, error) {
+	var idx Index
+	for _, dir := range dirs {
+		err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() || filepath.Ext(path) != ".splice" {
+				return nil
+			}
+
+			entry, err := newEntry(path)
+			if err != nil {
+				return err
+			}
+			idx.Entries = append(idx.Entries, entry)
+
+			return nil
+		})
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %w", dir, err)
+		}
+	}
+
+	sort.Slice(idx.Entries, func(i, j int) bool {
+		return idx.Entries[i].Path < idx.Entries[j].Path
+	})
+
+	return &idx, nil
+}
+
+func newEntry(path string) (Entry, error) {
+	p, err := drum.DecodeFile(path)
+	if err != nil {
+		return Entry{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	hash, err := hashFile(path)
+	if err != nil {
+		return Entry{}, fmt.Errorf("hash %s: %w", path, err)
+	}
+
+	entry := Entry{
+		Path:    path,
+		Hash:    hash,
+		Version: p.Version,
+		Tempo:   p.Tempo,
+	}
+	for track := range p.Tracks() {
+		entry.Tracks = append(entry.Tracks, track.Name)
+	}
+
+	return entry, nil
+}
+
+func hashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// Load reads an index previously written by Save.
+func Load(path string) (*Index, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read index: %w", err)
+	}
+
+	var idx Index
+	if err := json.Unmarshal(data, &idx); err != nil {
+		return nil, fmt.Errorf("parse index %s: %w", path, err)
+	}
+
+	return &idx, nil
+}
+
+// Save writes the index to path as JSON.
+func (idx *Index) Save(path string) error {
+	data, err := json.MarshalIndent(idx, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encode index: %w", err)
+	}
+
+	if err := ioutil.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("write index: %w", err)
+	}
+
+	return nil
+}
+
+// Query filters index entries. Zero valued fields match every entry.
+type Query struct {
+	// Tempo matches patterns with this tempo.
+	Tempo float32
+
+	// Version matches patterns saved with this hardware version.
+	Version string
+
+	// Tracks matches patterns that contain a track whose name includes
+	// each of these strings, ignoring case.
+	Tracks []string
+}
+
+// tempoTolerance absorbs the float32 rounding in stored tempos so that a
+// query for 98.4 matches a pattern saved at 98.4.
+const tempoTolerance = 0.005
+
+// Search returns every entry matching the query.
+func (idx *Index) Search(q Query) []Entry {
+	var matches []Entry
+	for _, entry := range idx.Entries {
+		if q.matches(entry) {
+			matches = append(matches, entry)
+		}
+	}
+
+	return matches
+}
+
+func (q Query) matches(entry Entry) bool {
+	if q.Tempo != 0 && math.Abs(float64(entry.Tempo-q.Tempo)) > tempoTolerance {
+		return false
+	}
+
+	if q.Version != "" && entry.Version != q.Version {
+		return false
+	}
+
+	for _, want := range q.Tracks {
+		if !containsTrack(entry.Tracks, want) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func containsTrack(tracks []string, want string) bool {
+	want = strings.ToLower(want)
+	for _, name := range tracks {
+		if strings.Contains(strings.ToLower(name), want) {
+			return true
+		}
+	}
+
+	return false
+}
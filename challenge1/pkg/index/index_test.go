@@ -0,0 +1,69 @@
+package index
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	idx, err := Build(filepath.Join("..", "..", "fixtures"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(idx.Entries) != 5 {
+		t.Fatalf("expected 5 indexed patterns, got %d", len(idx.Entries))
+	}
+
+	tData := []struct {
+		query    Query
+		expected []string
+	}{
+		{Query{Tempo: 120, Tracks: []string{"cowbell"}}, []string{"pattern_1.splice"}},
+		{Query{Tracks: []string{"cowbell"}}, []string{"pattern_1.splice", "pattern_2.splice"}},
+		{Query{Tempo: 98.4}, []string{"pattern_2.splice"}},
+		{Query{Version: "0.909", Tracks: []string{"KICK", "conga"}}, []string{"pattern_4.splice"}},
+		{Query{Tempo: 60}, nil},
+	}
+
+	for _, exp := range tData {
+		var got []string
+		for _, entry := range idx.Search(exp.query) {
+			got = append(got, filepath.Base(entry.Path))
+		}
+
+		if !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("query %+v matched %v, expected %v", exp.query, got, exp.expected)
+		}
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	idx, err := Build(filepath.Join("..", "..", "fixtures"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir, err := ioutil.TempDir("", "drum-index")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "index.json")
+	if err := idx.Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(loaded, idx) {
+		t.Errorf("index did not round trip.\nGot:\n%+v\nExpected:\n%+v", loaded, idx)
+	}
+}
@@ -0,0 +1,56 @@
+package midi
+
+import (
+	"math"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+// A Groove is the timing feel of a take, like those of a DAW's groove
+// pool: for each step of the bar, how far from it the hits nearest it
+// were played on average, in steps, later being positive. Steps no hit
+// was near are played right on them. Takes carry no velocities, so
+// neither do grooves.
+type Groove [stepsPerBar]float64
+
+// ExtractGroove returns the groove of t, the average offset of the hits
+// on each step from it, whichever drums played them.
+func ExtractGroove(t *Take) Groove {
+	var (
+		g     Groove
+		count [stepsPerBar]int
+	)
+	for _, h := range t.Hits {
+		step := int(math.Round(h.Step))
+		if step < 0 || step >= stepsPerBar {
+			continue
+		}
+		g[step] += h.Step - float64(step)
+		count[step]++
+	}
+	for step, n := range count {
+		if n > 0 {
+			g[step] /= float64(n)
+		}
+	}
+
+	return g
+}
+
+// ApplyGroove returns the take of p played with groove g: a hit for
+// each step of each track, moved off the step by its offset in g. The
+// zero Groove plays every hit right on its step, and quantizing the take
+// to sixteenths at full strength gives back p.
+func ApplyGroove(p *drum.Pattern, g Groove) *Take {
+	t := &Take{Version: p.Version, Tempo: p.Tempo}
+	for track := range p.Tracks() {
+		d := Drum{ID: track.ID, Name: track.Name}
+		for step, s := range track.Steps {
+			if s == 'x' && step < stepsPerBar {
+				t.Hits = append(t.Hits, Hit{Drum: d, Step: float64(step) + g[step]})
+			}
+		}
+	}
+
+	return t
+}
@@ -0,0 +1,75 @@
+package midi
+
+import (
+	"bytes"
+	"math"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+func TestExtractGroove(t *testing.T) {
+	kick, snare, hat := DefaultDrumMap[36], DefaultDrumMap[38], DefaultDrumMap[42]
+	take := &Take{Tempo: 100, Hits: []Hit{
+		{kick, 0.1},
+		{hat, -0.1},
+		{hat, 2.3},
+		{snare, 4.2},
+		{hat, 3.6},  // nearer step 4
+		{hat, 15.7}, // nearer the next bar
+	}}
+
+	checkGroove(t, ExtractGroove(take), Groove{0: 0, 2: 0.3, 4: -0.1}, 1e-9)
+}
+
+// checkGroove checks that each offset of g is within tolerance of that
+// of want.
+func checkGroove(t *testing.T, g, want Groove, tolerance float64) {
+	t.Helper()
+	for step := range g {
+		if math.Abs(g[step]-want[step]) > tolerance {
+			t.Errorf("step %d: expected an offset of %v, got %v", step, want[step], g[step])
+		}
+	}
+}
+
+func TestApplyGroove(t *testing.T) {
+	p, err := drum.NewPattern("swung", 120,
+		drum.Track{ID: 0, Name: "kick", Steps: []byte("x---x---x---x---")},
+		drum.Track{ID: 4, Name: "hh-close", Steps: []byte("x-x-x-x-x-x-x-x-")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Swing: every other eighth note comes a third of a step late.
+	var swing Groove
+	for step := 2; step < stepsPerBar; step += 4 {
+		swing[step] = 1.0 / 3
+	}
+
+	take := ApplyGroove(p, swing)
+	if take.Version != "swung" || take.Tempo != 120 || len(take.Hits) != 12 {
+		t.Fatalf("unexpected take %+v", take)
+	}
+	checkGroove(t, ExtractGroove(take), swing, 1e-9)
+
+	// On the grid the groove is gone again.
+	q, err := take.Quantize(Sixteenth, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if q.String() != p.String() {
+		t.Errorf("quantized back\n%s\nexpected\n%s", q, p)
+	}
+
+	// Written to a file, the hits keep their timing to a tick.
+	var file bytes.Buffer
+	if err := WriteSMFTake(&file, take, nil); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSMFTake(&file, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkGroove(t, ExtractGroove(read), swing, 0.5/(ticksPerBeat/stepsPerBeat))
+}
@@ -0,0 +1,180 @@
+// Package midi records drum patterns played on a MIDI instrument. It
+// reads the raw MIDI byte stream a device such as /dev/snd/midiC1D0 on
+// Linux produces, and quantizes the drum hits in it onto the sixteen
+// steps of a pattern, to a grid and strength of the caller's choosing,
+// or extracts their groove to play other patterns with. It also reads
+// and writes patterns and takes as Standard MIDI Files, and registers
+// the "midi" exporter with the drum package.
+package midi
+
+import (
+	"bufio"
+	"errors"
+	"io"
+)
+
+// Status bytes of the messages a Reader decodes or skips.
+const (
+	statusNoteOff = 0x80
+	statusNoteOn  = 0x90
+	statusSysEx   = 0xf0
+	statusEOX     = 0xf7
+	statusClock   = 0xf8
+)
+
+// ErrSysExTooLong is returned for a system exclusive message that never
+// ends.
+var ErrSysExTooLong = errors.New("midi: system exclusive message too long")
+
+// maxSysExSize bounds the system exclusive messages a Reader skips.
+const maxSysExSize = 1 << 16
+
+// A Message is a channel message: a note, controller, program or pitch
+// bend change. Data2 is zero for the messages with one data byte.
+type Message struct {
+	Status byte
+	Data1  byte
+	Data2  byte
+}
+
+// Channel returns the channel of the message, 0 to 15.
+func (m Message) Channel() int {
+	return int(m.Status & 0x0f)
+}
+
+// NoteOn reports whether m starts a note, and which at what velocity. A
+// note on with zero velocity ends the note instead, as many instruments
+// send it.
+func (m Message) NoteOn() (note, velocity byte, ok bool) {
+	if m.Status&0xf0 != statusNoteOn || m.Data2 == 0 {
+		return 0, 0, false
+	}
+
+	return m.Data1, m.Data2, true
+}
+
+// A Reader reads the channel messages of a MIDI byte stream, filling in
+// running status and skipping system messages.
+type Reader struct {
+	r       *bufio.Reader
+	running byte
+}
+
+// NewReader returns a Reader reading from r.
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReader(r)}
+}
+
+// ReadMessage returns the next channel message. Data bytes with no
+// status to give them meaning are skipped.
+func (r *Reader) ReadMessage() (Message, error) {
+	for {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return Message{}, err
+		}
+
+		switch {
+		case b >= statusClock:
+			// Real time messages may come between any two bytes, and do
+			// not cancel running status.
+			continue
+		case b == statusSysEx:
+			r.running = 0
+			if err := r.skipSysEx(); err != nil {
+				return Message{}, err
+			}
+			continue
+		case b > statusSysEx:
+			r.running = 0
+			if _, err := r.r.Discard(systemDataSize(b)); err != nil {
+				return Message{}, err
+			}
+			continue
+		case b >= statusNoteOff:
+			r.running = b
+			continue
+		case r.running == 0:
+			continue
+		}
+
+		m := Message{Status: r.running, Data1: b}
+		if dataSize(r.running) == 2 {
+			var ok bool
+			if m.Data2, ok, err = r.readData(); err != nil {
+				return Message{}, err
+			}
+			if !ok {
+				// Cut short by the next message.
+				continue
+			}
+		}
+
+		return m, nil
+	}
+}
+
+// readData reads the next data byte, skipping real time messages. It
+// reports false, leaving the byte to be read again, if a status byte
+// comes instead.
+func (r *Reader) readData() (b byte, ok bool, err error) {
+	for {
+		if b, err = r.r.ReadByte(); err != nil {
+			return 0, false, unexpected(err)
+		}
+		switch {
+		case b < statusNoteOff:
+			return b, true, nil
+		case b < statusClock:
+			return 0, false, r.r.UnreadByte()
+		}
+	}
+}
+
+// skipSysEx skips a system exclusive message up to its end.
+func (r *Reader) skipSysEx() error {
+	for n := 0; n < maxSysExSize; n++ {
+		b, err := r.r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		if b == statusEOX {
+			return nil
+		}
+	}
+
+	return ErrSysExTooLong
+}
+
+// dataSize returns the number of data bytes of a channel message.
+func dataSize(status byte) int {
+	switch status & 0xf0 {
+	case 0xc0, 0xd0:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// systemDataSize returns the number of data bytes of a system common
+// message.
+func systemDataSize(status byte) int {
+	switch status {
+	case 0xf1, 0xf3:
+		return 1
+	case 0xf2:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// unexpected turns io.EOF part way through a message into
+// io.ErrUnexpectedEOF.
+func unexpected(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+
+	return err
+}
@@ -0,0 +1,83 @@
+package midi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+)
+
+func TestReadMessage(t *testing.T) {
+	stream := []byte{
+		0xf8,             // clock
+		0x40,             // data with no status
+		0x99, 0x24, 0x64, // note on, channel 10
+		0x26, 0x50, // running status
+		0xf0, 0x7e, 0x7f, 0x06, 0x01, 0xf7, // sysex, cancels running status
+		0x12,                   // data with no status
+		0x89, 0x24, 0xfe, 0x00, // note off, active sensing in between
+		0xc9, 0x05, // program change
+		0xf2, 0x00, 0x00, // song position
+		0xb9, 0x07, 0x99, 0x2a, 0x7f, // controller cut short by a note on
+	}
+
+	r := NewReader(bytes.NewReader(stream))
+	var got []Message
+	for {
+		m, err := r.ReadMessage()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, m)
+	}
+
+	want := []Message{
+		{0x99, 0x24, 0x64},
+		{0x99, 0x26, 0x50},
+		{0x89, 0x24, 0x00},
+		{0xc9, 0x05, 0x00},
+		{0x99, 0x2a, 0x7f},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %x, got %x", want, got)
+	}
+}
+
+func TestReadMessageTruncated(t *testing.T) {
+	r := NewReader(bytes.NewReader([]byte{0x99, 0x24}))
+	if _, err := r.ReadMessage(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF, got %v", err)
+	}
+
+	r = NewReader(bytes.NewReader(append([]byte{0xf0}, make([]byte, maxSysExSize)...)))
+	if _, err := r.ReadMessage(); !errors.Is(err, ErrSysExTooLong) {
+		t.Errorf("expected ErrSysExTooLong, got %v", err)
+	}
+}
+
+func TestNoteOn(t *testing.T) {
+	tests := []struct {
+		m    Message
+		ok   bool
+		note byte
+	}{
+		{Message{0x99, 0x24, 0x64}, true, 0x24},
+		{Message{0x90, 0x24, 0x00}, false, 0},
+		{Message{0x89, 0x24, 0x40}, false, 0},
+		{Message{0xb9, 0x07, 0x40}, false, 0},
+	}
+	for _, tt := range tests {
+		note, _, ok := tt.m.NoteOn()
+		if ok != tt.ok || note != tt.note {
+			t.Errorf("%x: expected %v %x, got %v %x", tt.m, tt.ok, tt.note, ok, note)
+		}
+	}
+
+	if ch := (Message{Status: 0x99}).Channel(); ch != 9 {
+		t.Errorf("expected channel 9, got %d", ch)
+	}
+}
@@ -0,0 +1,86 @@
+package midi
+
+import (
+	"errors"
+	"math"
+	"sort"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+// A StepResolution is the spacing of a quantizing grid, in steps.
+type StepResolution int
+
+// The grids a Take can be quantized to.
+const (
+	Sixteenth StepResolution = 1
+	Eighth    StepResolution = 2
+	Quarter   StepResolution = 4
+	Half      StepResolution = 8
+)
+
+// ErrInvalidGrid is returned by Quantize for a grid that is not a whole
+// number of steps dividing the bar.
+var ErrInvalidGrid = errors.New("midi: grid must divide the bar into whole steps")
+
+// ErrInvalidStrength is returned by Quantize for a strength outside 0
+// to 1.
+var ErrInvalidStrength = errors.New("midi: strength must be between 0 and 1")
+
+// A Hit is a drum played during a take, Step steps after the bar
+// started. Steps are fractional, as hits are rarely right on one.
+type Hit struct {
+	Drum Drum
+	Step float64
+}
+
+// A Take is one bar as it was played, or read from a MIDI file, with
+// the timing of its hits kept as it was rather than put on steps.
+type Take struct {
+	Version string
+	Tempo   float32
+	Hits    []Hit
+}
+
+// Quantize returns the pattern of t, moving each hit towards the
+// nearest line of grid by strength, 0 leaving it where it was played and
+// 1 putting it on the line, and then onto the nearest step. Hits that
+// land past the bar are left out, and tracks come in order of ID.
+// Quantize(Sixteenth, 1) puts every hit on its nearest step.
+func (t *Take) Quantize(grid StepResolution, strength float64) (*drum.Pattern, error) {
+	if grid <= 0 || stepsPerBar%int(grid) != 0 {
+		return nil, ErrInvalidGrid
+	}
+	if !(strength >= 0 && strength <= 1) {
+		return nil, ErrInvalidStrength
+	}
+
+	tracks := make(map[int]*drum.Track)
+	for _, h := range t.Hits {
+		line := math.Round(h.Step/float64(grid)) * float64(grid)
+		step := int(math.Round(h.Step + (line-h.Step)*strength))
+		if step < 0 || step >= stepsPerBar {
+			continue
+		}
+
+		track, ok := tracks[h.Drum.ID]
+		if !ok {
+			track = &drum.Track{ID: h.Drum.ID, Name: h.Drum.Name, Steps: []byte("----------------")}
+			tracks[h.Drum.ID] = track
+		}
+		track.Steps[step] = 'x'
+	}
+
+	sorted := make([]drum.Track, 0, len(tracks))
+	for _, track := range tracks {
+		sorted = append(sorted, *track)
+	}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].ID < sorted[j].ID })
+
+	version := t.Version
+	if version == "" {
+		version = Version
+	}
+
+	return drum.NewPattern(version, t.Tempo, sorted...)
+}
@@ -0,0 +1,107 @@
+package midi
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestQuantize(t *testing.T) {
+	kick, snare, hat := DefaultDrumMap[36], DefaultDrumMap[38], DefaultDrumMap[42]
+	take := &Take{Tempo: 100, Hits: []Hit{
+		{kick, 0.2},
+		{kick, 8.4},
+		{snare, 2.6},
+		{snare, 13.5},
+		{hat, 5.4},
+		{hat, 15.7}, // nearer the next bar
+	}}
+
+	tData := []struct {
+		grid     StepResolution
+		strength float64
+		expected string
+	}{
+		{Sixteenth, 1, "x-------x------- ---x----------x- -----x----------"},
+		{Quarter, 0, "x-------x------- ---x----------x- -----x----------"},
+		{Quarter, 1, "x-------x------- ----x-------x--- ----x-----------"},
+		{Quarter, 0.5, "x-------x------- ---x---------x-- -----x----------"},
+	}
+
+	for _, exp := range tData {
+		p, err := take.Quantize(exp.grid, exp.strength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.Version != Version || p.Tempo != 100 {
+			t.Errorf("unexpected version %q and tempo %v", p.Version, p.Tempo)
+		}
+
+		var steps []string
+		for track := range p.Tracks() {
+			steps = append(steps, string(track.Steps))
+		}
+		if got := strings.Join(steps, " "); got != exp.expected {
+			t.Errorf("grid %d at strength %v: expected %s, got %s", exp.grid, exp.strength, exp.expected, got)
+		}
+	}
+}
+
+func TestQuantizeInvalid(t *testing.T) {
+	take := &Take{Tempo: 120}
+	for _, grid := range []StepResolution{0, -1, 3} {
+		if _, err := take.Quantize(grid, 1); !errors.Is(err, ErrInvalidGrid) {
+			t.Errorf("grid %d: expected ErrInvalidGrid, got %v", grid, err)
+		}
+	}
+	for _, strength := range []float64{-0.1, 1.1} {
+		if _, err := take.Quantize(Sixteenth, strength); !errors.Is(err, ErrInvalidStrength) {
+			t.Errorf("strength %v: expected ErrInvalidStrength, got %v", strength, err)
+		}
+	}
+}
+
+func TestRecorderTake(t *testing.T) {
+	rec, err := NewRecorder(120)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// At 120 beats per minute, each step lasts 125ms.
+	start := time.Unix(100, 0)
+	rec.Hit(36, start)
+	rec.Hit(38, start.Add(675*time.Millisecond))
+
+	take := rec.Take()
+	if len(take.Hits) != 2 || take.Hits[1].Step != 5.4 || take.Hits[1].Drum.Name != "snare" {
+		t.Fatalf("unexpected hits %v", take.Hits)
+	}
+
+	// Pattern puts the snare on its nearest step, as does a quarter note
+	// grid at half strength, which moves it only to 4.7. At full
+	// strength the grid moves it to 4.
+	tData := []struct {
+		grid     StepResolution
+		strength float64
+		expected string
+	}{
+		{Sixteenth, 1, "-----x----------"},
+		{Quarter, 0.5, "-----x----------"},
+		{Quarter, 1, "----x-----------"},
+	}
+	for _, exp := range tData {
+		p, err := take.Quantize(exp.grid, exp.strength)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for track := range p.Tracks() {
+			if track.Name == "snare" && string(track.Steps) != exp.expected {
+				t.Errorf("grid %d at strength %v: expected the snare at %s, got %s", exp.grid, exp.strength, exp.expected, track.Steps)
+			}
+		}
+	}
+	if got := rec.Pattern().String(); !strings.Contains(got, "(1) snare\t|----|-x--|") {
+		t.Errorf("expected Pattern to put the snare on step 5, got\n%s", got)
+	}
+}
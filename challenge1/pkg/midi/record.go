@@ -0,0 +1,213 @@
+package midi
+
+import (
+	"errors"
+	"io"
+	"math"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+// A pattern holds a bar of four beats in sixteenth note steps.
+const (
+	stepsPerBar  = 16
+	stepsPerBeat = 4
+)
+
+// Version is the version recorded patterns are saved with.
+const Version = "gomentor-midi"
+
+// ErrInvalidTempo is returned for a tempo that is not positive.
+var ErrInvalidTempo = errors.New("midi: tempo must be positive")
+
+// ErrNoHits is returned by Record when the input ends before anything
+// is played.
+var ErrNoHits = errors.New("midi: no drum hits recorded")
+
+// A Drum is the track a note plays.
+type Drum struct {
+	ID   int
+	Name string
+}
+
+// DefaultDrumMap maps the notes of the General MIDI percussion key map
+// to the tracks of the drum machine's own patterns.
+var DefaultDrumMap = map[byte]Drum{
+	35: {0, "kick"},
+	36: {0, "kick"},
+	37: {1, "snare"},
+	38: {1, "snare"},
+	40: {1, "snare"},
+	39: {2, "clap"},
+	46: {3, "hh-open"},
+	42: {4, "hh-close"},
+	44: {4, "hh-close"},
+	56: {5, "cowbell"},
+}
+
+// A Recorder records drum hits as a take of one bar, and quantizes
+// them onto the steps of a pattern. The bar starts with the first hit,
+// which falls on the first step.
+type Recorder struct {
+	// Tempo is the tempo of the pattern, in beats per minute.
+	Tempo float32
+
+	// Drums maps notes to the tracks they play. Nil means
+	// DefaultDrumMap. Other notes are ignored.
+	Drums map[byte]Drum
+
+	start time.Time
+	hits  []Hit
+}
+
+// NewRecorder returns a Recorder for a pattern at tempo beats per
+// minute.
+func NewRecorder(tempo float32) (*Recorder, error) {
+	if !(tempo > 0) {
+		return nil, ErrInvalidTempo
+	}
+
+	return &Recorder{Tempo: tempo}, nil
+}
+
+// Hit records note being played at the time at. It reports whether the
+// note was recorded: it is not if no track plays it, or its nearest
+// step falls after the bar.
+func (r *Recorder) Hit(note byte, at time.Time) bool {
+	d, ok := r.drums()[note]
+	if !ok {
+		return false
+	}
+	if r.start.IsZero() {
+		r.start = at
+	}
+
+	step := float64(at.Sub(r.start)) / float64(r.step())
+	if nearest := math.Round(step); nearest < 0 || nearest >= stepsPerBar {
+		return false
+	}
+	r.hits = append(r.hits, Hit{Drum: d, Step: step})
+
+	return true
+}
+
+// Started reports whether anything has been recorded yet.
+func (r *Recorder) Started() bool {
+	return !r.start.IsZero()
+}
+
+// End returns when the bar ends: half a step after its last step, as
+// later hits are nearer the first step of the next. It is the zero Time
+// until something has been recorded.
+func (r *Recorder) End() time.Time {
+	if r.start.IsZero() {
+		return time.Time{}
+	}
+
+	return r.start.Add(r.step() * (2*stepsPerBar - 1) / 2)
+}
+
+// Take returns the hits recorded so far as they were played.
+func (r *Recorder) Take() *Take {
+	return &Take{Version: Version, Tempo: r.Tempo, Hits: append([]Hit(nil), r.hits...)}
+}
+
+// Pattern returns the pattern recorded so far, each hit on its nearest
+// step, with a track for each drum played in order of ID.
+func (r *Recorder) Pattern() *drum.Pattern {
+	// Quantizing to sixteenths at full strength cannot fail.
+	p, err := r.Take().Quantize(Sixteenth, 1)
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// step returns how long each step lasts.
+func (r *Recorder) step() time.Duration {
+	return time.Duration(float64(time.Minute) / float64(r.Tempo) / stepsPerBeat)
+}
+
+func (r *Recorder) drums() map[byte]Drum {
+	if r.Drums != nil {
+		return r.Drums
+	}
+
+	return DefaultDrumMap
+}
+
+// Record records a bar played on the MIDI device r at tempo beats per
+// minute, starting with the first drum hit, and returns it once the bar
+// is over, each hit on its nearest step. It returns ErrNoHits if r ends
+// before a hit. A read from r may still be waiting when it returns,
+// which closing r ends.
+func Record(r io.Reader, tempo float32) (*drum.Pattern, error) {
+	take, err := RecordTake(r, tempo)
+	if err != nil {
+		return nil, err
+	}
+
+	return take.Quantize(Sixteenth, 1)
+}
+
+// RecordTake is like Record, but returns the bar as it was played, to
+// be quantized with Take.Quantize.
+func RecordTake(r io.Reader, tempo float32) (*Take, error) {
+	rec, err := NewRecorder(tempo)
+	if err != nil {
+		return nil, err
+	}
+
+	type hit struct {
+		note byte
+		at   time.Time
+	}
+	hits := make(chan hit)
+	failed := make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		mr := NewReader(r)
+		for {
+			m, err := mr.ReadMessage()
+			if err != nil {
+				failed <- err
+				return
+			}
+			if note, _, ok := m.NoteOn(); ok {
+				select {
+				case hits <- hit{note, time.Now()}:
+				case <-done:
+					return
+				}
+			}
+		}
+	}()
+
+	var end <-chan time.Time
+	for {
+		select {
+		case h := <-hits:
+			started := rec.Started()
+			rec.Hit(h.note, h.at)
+			if !started && rec.Started() {
+				end = time.After(time.Until(rec.End()))
+			}
+		case err := <-failed:
+			if !rec.Started() {
+				if err == io.EOF {
+					err = ErrNoHits
+				}
+				return nil, err
+			}
+			if err != io.EOF {
+				return nil, err
+			}
+			return rec.Take(), nil
+		case <-end:
+			return rec.Take(), nil
+		}
+	}
+}
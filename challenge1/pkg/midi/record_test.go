@@ -0,0 +1,94 @@
+package midi
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecorder(t *testing.T) {
+	rec, err := NewRecorder(120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rec.Started() || !rec.End().IsZero() {
+		t.Fatal("expected a new recorder to be idle")
+	}
+
+	// At 120 beats per minute, each step lasts 125ms.
+	start := time.Unix(100, 0)
+	at := func(ms int) time.Time { return start.Add(time.Duration(ms) * time.Millisecond) }
+	hits := []struct {
+		note byte
+		ms   int
+		ok   bool
+	}{
+		{36, 0, true},
+		{42, 10, true},    // step 0
+		{38, 490, true},   // step 4, early
+		{42, 260, true},   // step 2
+		{36, 1010, true},  // step 8, late
+		{38, 1500, true},  // step 12
+		{42, 1870, true},  // step 15
+		{99, 1000, false}, // not a drum
+		{36, 1940, false}, // the first step of the next bar
+	}
+	for _, h := range hits {
+		if ok := rec.Hit(h.note, at(h.ms)); ok != h.ok {
+			t.Errorf("hit %d at %dms: expected %v, got %v", h.note, h.ms, h.ok, ok)
+		}
+	}
+
+	if end := rec.End(); !end.Equal(at(1937).Add(500 * time.Microsecond)) {
+		t.Errorf("unexpected end %v", end.Sub(start))
+	}
+
+	want := `Saved with HW Version: gomentor-midi
+Tempo: 120
+(0) kick	|x---|----|x---|----|
+(1) snare	|----|x---|----|x---|
+(4) hh-close	|x-x-|----|----|---x|
+`
+	if got := rec.Pattern().String(); got != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, got)
+	}
+}
+
+func TestRecorderDrums(t *testing.T) {
+	rec := &Recorder{Tempo: 60, Drums: map[byte]Drum{60: {7, "tom"}}}
+	if rec.Hit(36, time.Now()) {
+		t.Error("expected the default map to be replaced")
+	}
+	if !rec.Hit(60, time.Now()) {
+		t.Error("expected the custom drum to be recorded")
+	}
+	if !strings.Contains(rec.Pattern().String(), "(7) tom") {
+		t.Errorf("expected a tom track, got\n%s", rec.Pattern())
+	}
+
+	if _, err := NewRecorder(0); !errors.Is(err, ErrInvalidTempo) {
+		t.Errorf("expected ErrInvalidTempo, got %v", err)
+	}
+}
+
+func TestRecord(t *testing.T) {
+	// Read without waiting, every hit falls on the first step.
+	p, err := Record(bytes.NewReader([]byte{0x99, 36, 100, 38, 100, 0x89, 36, 0}), 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `Saved with HW Version: gomentor-midi
+Tempo: 120
+(0) kick	|x---|----|----|----|
+(1) snare	|x---|----|----|----|
+`
+	if p.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, p)
+	}
+
+	if _, err := Record(bytes.NewReader([]byte{0xf8}), 120); !errors.Is(err, ErrNoHits) {
+		t.Errorf("expected ErrNoHits, got %v", err)
+	}
+}
@@ -0,0 +1,373 @@
+package midi
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+// ticksPerBeat is the division of the files WriteSMF writes.
+const ticksPerBeat = 96
+
+// Meta events WriteSMF writes or ReadSMF reads.
+const (
+	statusMeta     = 0xff
+	metaName       = 0x03
+	metaEndOfTrack = 0x2f
+	metaTempo      = 0x51
+	metaTimeSig    = 0x58
+)
+
+// percussionChannel is channel 10, which General MIDI plays drums on.
+const percussionChannel = 9
+
+// maxChunkSize bounds the chunks ReadSMF reads.
+const maxChunkSize = 1 << 20
+
+// DefaultNotes maps the tracks of the drum machine's own patterns, by
+// ID, to the General MIDI notes that play them. DefaultDrumMap maps
+// each back to its track.
+var DefaultNotes = map[int]byte{
+	0: 36, // kick
+	1: 38, // snare
+	2: 39, // clap
+	3: 46, // hh-open
+	4: 42, // hh-close
+	5: 56, // cowbell
+}
+
+// ErrNoNote is returned by WriteSMF for a track no note plays.
+var ErrNoNote = errors.New("midi: no note for track")
+
+// ErrNotSMF is returned by ReadSMF for input that is not a Standard
+// MIDI File, or one timed in SMPTE frames rather than beats.
+var ErrNotSMF = errors.New("midi: not a standard MIDI file")
+
+func init() {
+	drum.RegisterExporter(smfExporter{})
+}
+
+// smfExporter registers WriteSMF with the drum package as "midi".
+type smfExporter struct{}
+
+func (smfExporter) Name() string         { return "midi" }
+func (smfExporter) Extensions() []string { return []string{".mid", ".midi"} }
+
+func (smfExporter) Export(w io.Writer, p *drum.Pattern) error {
+	return WriteSMF(w, p, nil)
+}
+
+// WriteSMF writes p to w as a Standard MIDI File of one bar, named
+// after its version, that plays each step of a track as a sixteenth
+// note on the percussion channel. Notes maps tracks, by ID, to the
+// notes that play them; nil means DefaultNotes. It fails with ErrNoNote
+// for a track notes has no entry for.
+func WriteSMF(w io.Writer, p *drum.Pattern, notes map[int]byte) error {
+	if notes == nil {
+		notes = DefaultNotes
+	}
+	for track := range p.Tracks() {
+		if _, ok := notes[track.ID]; !ok {
+			return fmt.Errorf("%w %d (%s)", ErrNoNote, track.ID, track.Name)
+		}
+	}
+
+	return WriteSMFTake(w, ApplyGroove(p, Groove{}), notes)
+}
+
+// WriteSMFTake writes t to w as WriteSMF writes a pattern, but with each
+// hit played when it was in the take rather than on its step.
+func WriteSMFTake(w io.Writer, t *Take, notes map[int]byte) error {
+	if notes == nil {
+		notes = DefaultNotes
+	}
+	if !(t.Tempo > 0) {
+		return ErrInvalidTempo
+	}
+
+	type event struct {
+		tick int
+		data []byte
+	}
+	const stepTicks = ticksPerBeat / stepsPerBeat
+
+	tempo := uint32(math.Round(60e6 / float64(t.Tempo)))
+	events := []event{
+		{0, meta(metaName, []byte(t.Version))},
+		{0, meta(metaTimeSig, []byte{4, 2, 24, 8})},
+		{0, meta(metaTempo, []byte{byte(tempo >> 16), byte(tempo >> 8), byte(tempo)})},
+	}
+	for _, h := range t.Hits {
+		note, ok := notes[h.Drum.ID]
+		if !ok {
+			return fmt.Errorf("%w %d (%s)", ErrNoNote, h.Drum.ID, h.Drum.Name)
+		}
+		// A hit played just before the bar starts is as early as a file
+		// can put it.
+		tick := max(int(math.Round(h.Step*stepTicks)), 0)
+		events = append(events,
+			event{tick, []byte{statusNoteOn | percussionChannel, note, 100}},
+			event{tick + stepTicks/2, []byte{statusNoteOff | percussionChannel, note, 0}})
+	}
+	sort.SliceStable(events, func(i, j int) bool { return events[i].tick < events[j].tick })
+	end := max(stepsPerBar*stepTicks, events[len(events)-1].tick)
+	events = append(events, event{end, meta(metaEndOfTrack, nil)})
+
+	var track []byte
+	last := 0
+	for _, e := range events {
+		track = appendVarLen(track, uint32(e.tick-last))
+		track = append(track, e.data...)
+		last = e.tick
+	}
+
+	// A format 0 file: a header chunk, then the one track chunk.
+	var header [14]byte
+	copy(header[:], "MThd")
+	binary.BigEndian.PutUint32(header[4:], 6)
+	binary.BigEndian.PutUint16(header[8:], 0)
+	binary.BigEndian.PutUint16(header[10:], 1)
+	binary.BigEndian.PutUint16(header[12:], ticksPerBeat)
+
+	var chunk [8]byte
+	copy(chunk[:], "MTrk")
+	binary.BigEndian.PutUint32(chunk[4:], uint32(len(track)))
+
+	for _, b := range [][]byte{header[:], chunk[:], track} {
+		if _, err := w.Write(b); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// meta returns a meta event of type typ holding data.
+func meta(typ byte, data []byte) []byte {
+	return append(appendVarLen([]byte{statusMeta, typ}, uint32(len(data))), data...)
+}
+
+// appendVarLen appends v to b as a variable length quantity.
+func appendVarLen(b []byte, v uint32) []byte {
+	var groups [5]byte
+	i := len(groups) - 1
+	groups[i] = byte(v & 0x7f)
+	for v >>= 7; v > 0; v >>= 7 {
+		i--
+		groups[i] = byte(v&0x7f) | 0x80
+	}
+
+	return append(b, groups[i:]...)
+}
+
+// ReadSMF reads the first bar of the Standard MIDI File r as a pattern,
+// each note on its nearest step. It is ReadSMFTake followed by
+// Quantize(Sixteenth, 1).
+func ReadSMF(r io.Reader, drums map[byte]Drum) (*drum.Pattern, error) {
+	take, err := ReadSMFTake(r, drums)
+	if err != nil {
+		return nil, err
+	}
+
+	return take.Quantize(Sixteenth, 1)
+}
+
+// ReadSMFTake reads the notes of the Standard MIDI File r as a take,
+// playing the tracks drums maps them to; nil means DefaultDrumMap.
+// Other notes are ignored, as are those whose nearest step falls after
+// the first bar. The take's version is the name of the file's first
+// track, or Version if it has none. Files store tempos as microseconds
+// per beat, so the take's is rounded to a hundredth of a beat per
+// minute; files without one are at 120.
+func ReadSMFTake(r io.Reader, drums map[byte]Drum) (*Take, error) {
+	if drums == nil {
+		drums = DefaultDrumMap
+	}
+	br := bufio.NewReader(r)
+
+	id, header, err := readChunk(br)
+	if err == io.EOF || err == io.ErrUnexpectedEOF {
+		// Too short to be a file at all.
+		return nil, ErrNotSMF
+	}
+	if err != nil {
+		return nil, err
+	}
+	if id != "MThd" || len(header) < 6 {
+		return nil, ErrNotSMF
+	}
+	count := int(binary.BigEndian.Uint16(header[2:]))
+	division := int(binary.BigEndian.Uint16(header[4:]))
+	if division&0x8000 != 0 || division < stepsPerBeat {
+		return nil, ErrNotSMF
+	}
+	stepTicks := float64(division) / stepsPerBeat
+
+	take := &Take{}
+	tempo := 0.0
+	for read := 0; read < count; {
+		id, chunk, err := readChunk(br)
+		if err != nil {
+			return nil, unexpected(err)
+		}
+		if id != "MTrk" {
+			// Chunks of other types are for other readers.
+			continue
+		}
+		read++
+
+		first := read == 1
+		err = readEvents(chunk, func(tick int, status byte, data []byte) {
+			switch {
+			case status == statusMeta && data[0] == metaName:
+				if first && take.Version == "" {
+					take.Version = string(data[1:])
+				}
+			case status == statusMeta && data[0] == metaTempo:
+				if tempo == 0 && len(data) == 4 {
+					tempo = 60e6 / float64(uint32(data[1])<<16|uint32(data[2])<<8|uint32(data[3]))
+				}
+			case status&0xf0 == statusNoteOn && data[1] > 0:
+				d, ok := drums[data[0]]
+				step := float64(tick) / stepTicks
+				if ok && math.Round(step) < stepsPerBar {
+					take.Hits = append(take.Hits, Hit{Drum: d, Step: step})
+				}
+			}
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if take.Version == "" {
+		take.Version = Version
+	}
+	if tempo == 0 {
+		tempo = 120
+	}
+	take.Tempo = float32(math.Round(tempo*100) / 100)
+
+	return take, nil
+}
+
+// readChunk reads the next chunk of a file, returning its type and
+// data.
+func readChunk(r io.Reader) (id string, data []byte, err error) {
+	var prefix [8]byte
+	if _, err := io.ReadFull(r, prefix[:]); err != nil {
+		return "", nil, err
+	}
+	size := binary.BigEndian.Uint32(prefix[4:])
+	if size > maxChunkSize {
+		return "", nil, fmt.Errorf("%w: %d byte chunk", ErrNotSMF, size)
+	}
+
+	data = make([]byte, size)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return "", nil, unexpected(err)
+	}
+
+	return string(prefix[:4]), data, nil
+}
+
+// readEvents calls fn with each event of the track chunk data, in
+// order, and the tick it falls on. Channel messages come with their
+// status, running status filled in, and their data bytes; meta events
+// with statusMeta, and their type followed by their data. System
+// exclusive messages are skipped. Both cancel running status.
+func readEvents(data []byte, fn func(tick int, status byte, data []byte)) error {
+	r := bytes.NewReader(data)
+	tick := 0
+	var running byte
+	for r.Len() > 0 {
+		delta, err := readVarLen(r)
+		if err != nil {
+			return err
+		}
+		tick += int(delta)
+
+		b, err := r.ReadByte()
+		if err != nil {
+			return unexpected(err)
+		}
+		switch {
+		case b == statusMeta:
+			running = 0
+			typ, err := r.ReadByte()
+			if err != nil {
+				return unexpected(err)
+			}
+			body, err := readData(r)
+			if err != nil {
+				return err
+			}
+			fn(tick, statusMeta, append([]byte{typ}, body...))
+			if typ == metaEndOfTrack {
+				return nil
+			}
+			continue
+		case b == statusSysEx || b == statusEOX:
+			running = 0
+			if _, err := readData(r); err != nil {
+				return err
+			}
+			continue
+		case b >= statusNoteOff:
+			running = b
+		case running == 0:
+			return fmt.Errorf("%w: data byte without a status", ErrNotSMF)
+		default:
+			r.UnreadByte()
+		}
+
+		msg := make([]byte, dataSize(running))
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return unexpected(err)
+		}
+		fn(tick, running, msg)
+	}
+
+	return nil
+}
+
+// readData reads the length prefixed data of a meta or system exclusive
+// event.
+func readData(r *bytes.Reader) ([]byte, error) {
+	size, err := readVarLen(r)
+	if err != nil {
+		return nil, err
+	}
+	if int64(size) > int64(r.Len()) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	data := make([]byte, size)
+	r.Read(data)
+
+	return data, nil
+}
+
+// readVarLen reads a variable length quantity of at most four bytes.
+func readVarLen(r io.ByteReader) (uint32, error) {
+	var v uint32
+	for i := 0; i < 4; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, unexpected(err)
+		}
+		v = v<<7 | uint32(b&0x7f)
+		if b&0x80 == 0 {
+			return v, nil
+		}
+	}
+
+	return 0, fmt.Errorf("%w: variable length quantity too long", ErrNotSMF)
+}
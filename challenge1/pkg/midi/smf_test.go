@@ -0,0 +1,85 @@
+package midi
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+func TestSMFRoundTrip(t *testing.T) {
+	for _, name := range []string{"pattern_1.splice", "pattern_2.splice"} {
+		p, err := drum.DecodeFile(filepath.Join("..", "..", "fixtures", name))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var file bytes.Buffer
+		if err := WriteSMF(&file, p, nil); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.HasPrefix(file.Bytes(), []byte("MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk")) {
+			t.Errorf("%s: unexpected header % x", name, file.Bytes()[:22])
+		}
+
+		read, err := ReadSMF(&file, nil)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if read.String() != p.String() {
+			t.Errorf("%s: read back\n%s\nexpected\n%s", name, read, p)
+		}
+	}
+}
+
+func TestSMFExporter(t *testing.T) {
+	e, err := drum.ExporterFor("pattern.MID")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if e.Name() != "midi" {
+		t.Fatalf("expected the midi exporter for .mid files, got %s", e.Name())
+	}
+
+	p, err := drum.NewPattern("custom", 90, drum.Track{ID: 7, Name: "tom", Steps: []byte("x---x---x---x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Export(new(bytes.Buffer), p); !errors.Is(err, ErrNoNote) {
+		t.Fatalf("expected ErrNoNote for a track without a note, got %v", err)
+	}
+
+	var file bytes.Buffer
+	if err := WriteSMF(&file, p, map[int]byte{7: 45}); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadSMF(&file, map[byte]Drum{45: {7, "tom"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if read.String() != p.String() {
+		t.Errorf("read back\n%s\nexpected\n%s", read, p)
+	}
+}
+
+func TestReadSMFInvalid(t *testing.T) {
+	for _, data := range []string{
+		"",
+		"SPLICE",
+		"MThd\x00\x00\x00\x06\x00\x00\x00\x01\xe7\x28", // timed in SMPTE frames
+		"MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk\xff\xff\xff\xff",
+	} {
+		if _, err := ReadSMF(strings.NewReader(data), nil); !errors.Is(err, ErrNotSMF) {
+			t.Errorf("%q: expected ErrNotSMF, got %v", data, err)
+		}
+	}
+
+	truncated := "MThd\x00\x00\x00\x06\x00\x00\x00\x01\x00\x60MTrk\x00\x00\x00\x04\x00\x99\x24"
+	if _, err := ReadSMF(strings.NewReader(truncated), nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected io.ErrUnexpectedEOF for a truncated file, got %v", err)
+	}
+}
@@ -0,0 +1,80 @@
+// Package taptempo estimates a tempo from a series of taps, such as key
+// presses, so a pattern's tempo can be set by feel.
+package taptempo
+
+import "time"
+
+const (
+	// DefaultWindow is the number of recent intervals averaged when a
+	// Tapper has no Window set.
+	DefaultWindow = 4
+
+	// DefaultTimeout is the pause after which a Tapper with no Timeout
+	// set starts a new estimate.
+	DefaultTimeout = 2 * time.Second
+)
+
+// A Tapper turns tap timestamps into a smoothed beats-per-minute
+// estimate. The zero value is ready to use.
+type Tapper struct {
+	// Window is the number of most recent intervals averaged into the
+	// estimate.
+	Window int
+
+	// Timeout is the longest pause between taps that still counts as
+	// part of the same tempo. A longer pause starts a new estimate.
+	Timeout time.Duration
+
+	taps []time.Time
+}
+
+// Tap records a tap at the given time and returns the current estimate.
+// ok is false until at least two taps have been recorded.
+func (t *Tapper) Tap(at time.Time) (bpm float32, ok bool) {
+	if n := len(t.taps); n > 0 {
+		if gap := at.Sub(t.taps[n-1]); gap <= 0 || gap > t.timeout() {
+			t.Reset()
+		}
+	}
+
+	t.taps = append(t.taps, at)
+	if len(t.taps) > t.window()+1 {
+		t.taps = t.taps[len(t.taps)-t.window()-1:]
+	}
+
+	return t.BPM()
+}
+
+// BPM returns the tempo implied by the mean interval between the
+// recorded taps. ok is false until at least two taps have been recorded.
+func (t *Tapper) BPM() (bpm float32, ok bool) {
+	if len(t.taps) < 2 {
+		return 0, false
+	}
+
+	elapsed := t.taps[len(t.taps)-1].Sub(t.taps[0])
+	interval := elapsed / time.Duration(len(t.taps)-1)
+
+	return float32(time.Minute.Seconds() / interval.Seconds()), true
+}
+
+// Reset discards every recorded tap.
+func (t *Tapper) Reset() {
+	t.taps = t.taps[:0]
+}
+
+func (t *Tapper) window() int {
+	if t.Window > 0 {
+		return t.Window
+	}
+
+	return DefaultWindow
+}
+
+func (t *Tapper) timeout() time.Duration {
+	if t.Timeout > 0 {
+		return t.Timeout
+	}
+
+	return DefaultTimeout
+}
@@ -0,0 +1,56 @@
+package taptempo
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestTapper(t *testing.T) {
+	var tapper Tapper
+	start := time.Unix(0, 0)
+
+	if _, ok := tapper.Tap(start); ok {
+		t.Fatal("expected no estimate after a single tap")
+	}
+
+	// Taps every 500ms with a little human jitter should settle on 120bpm.
+	offsets := []time.Duration{510, 990, 1505, 2000, 2490, 3000}
+	var bpm float32
+	for _, offset := range offsets {
+		var ok bool
+		bpm, ok = tapper.Tap(start.Add(offset * time.Millisecond))
+		if !ok {
+			t.Fatal("expected an estimate after two taps")
+		}
+	}
+
+	if math.Abs(float64(bpm)-120) > 1 {
+		t.Errorf("expected roughly 120bpm, got %v", bpm)
+	}
+
+	// A long pause starts over rather than dragging the average down.
+	if _, ok := tapper.Tap(start.Add(10 * time.Second)); ok {
+		t.Error("expected a long pause to reset the estimate")
+	}
+
+	bpm, _ = tapper.Tap(start.Add(10*time.Second + time.Second))
+	if bpm != 60 {
+		t.Errorf("expected 60bpm after resetting, got %v", bpm)
+	}
+}
+
+func TestTapperWindow(t *testing.T) {
+	tapper := Tapper{Window: 2}
+	start := time.Unix(0, 0)
+
+	// Slow taps followed by two fast ones: only the last two intervals
+	// should count.
+	for _, offset := range []time.Duration{0, 1000, 2000, 2250, 2500} {
+		tapper.Tap(start.Add(offset * time.Millisecond))
+	}
+
+	if bpm, _ := tapper.BPM(); bpm != 240 {
+		t.Errorf("expected 240bpm from the last two intervals, got %v", bpm)
+	}
+}
@@ -0,0 +1,82 @@
+package cli
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+func TestCommands(t *testing.T) {
+	names := make(map[string]bool)
+	for _, cmd := range commands() {
+		if names[cmd.name] {
+			t.Errorf("Command %s defined twice", cmd.name)
+		}
+		names[cmd.name] = true
+
+		// Defining a flag twice panics.
+		flags := cmd.flagSet()
+		cmd.setup(flags)
+		if flags.Lookup("config") == nil || flags.Lookup("log-level") == nil {
+			t.Errorf("Command %s lacks the common flags", cmd.name)
+		}
+	}
+
+	for name, ok := range map[string]bool{"max-conns": true, "known-hosts": true, "expose": true, "dir": true, "listen": false} {
+		if commandFlag(name) != ok {
+			t.Errorf("commandFlag(%q) = %v", name, !ok)
+		}
+	}
+}
+
+func TestCommandAddrs(t *testing.T) {
+	for arg, want := range map[string][2]string{
+		"8080":           {"localhost:8080", ":8080"},
+		"example.com:80": {"example.com:80", "example.com:80"},
+		"[::1]:80":       {"[::1]:80", "[::1]:80"},
+	} {
+		if got, err := dialAddr(arg); err != nil || got != want[0] {
+			t.Errorf("dialAddr(%q) = %q, want %q", arg, got, want[0])
+		}
+		if got := listenAddr(arg); got != want[1] {
+			t.Errorf("listenAddr(%q) = %q, want %q", arg, got, want[1])
+		}
+	}
+}
+
+func TestEncryptDecryptCommands(t *testing.T) {
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "identity.key")
+	key, err := securecomm.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := securecomm.SaveKey(keyPath, key, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	plain := filepath.Join(dir, "notes.txt")
+	if err := os.WriteFile(plain, []byte("meet at noon"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCommand([]string{"encrypt", plain, key.String()}); err != nil {
+		t.Fatal(err)
+	}
+	if err := runCommand([]string{"encrypt", plain, key.String()}); err == nil {
+		t.Fatal("encrypt overwrote the sealed file")
+	}
+
+	opened := filepath.Join(dir, "opened.txt")
+	if err := runCommand([]string{"decrypt", "-key", keyPath, "-o", opened, plain + sealedExt}); err != nil {
+		t.Fatal(err)
+	}
+	if got, err := os.ReadFile(opened); err != nil || string(got) != "meet at noon" {
+		t.Fatalf("decrypted %q, %v", got, err)
+	}
+
+	if err := runCommand([]string{"encrypt", plain, "not a key"}); err == nil {
+		t.Fatal("encrypted for a malformed public key")
+	}
+}
@@ -0,0 +1,142 @@
+package cli
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// applyConfigFile sets the flags in flags from the configuration file at
+// path, except those already set on the command line, which take
+// precedence. Settings for flags that flags lacks are skipped if shared
+// reports them as another command's, and refused otherwise.
+//
+// The file is a subset of TOML: each line sets a flag, named as on the
+// command line, to a value, such as
+//
+//	key = "server.key"
+//	max-conns = 100
+//	compress = true
+//
+// and a [table] header prefixes the names after it, so that
+//
+//	[log]
+//	level = "debug"
+//
+// sets -log-level. Strings are quoted; numbers, booleans and durations
+// such as 30s need not be. Blank lines and comments starting with # are
+// ignored.
+func applyConfigFile(flags *flag.FlagSet, path string, shared func(name string) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+	defer file.Close()
+
+	explicit := make(map[string]bool)
+	flags.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	seen := make(map[string]bool)
+	var table string
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		fail := func(format string, args ...interface{}) error {
+			return fmt.Errorf("load config: %s:%d: %s", path, line, fmt.Sprintf(format, args...))
+		}
+
+		if strings.HasPrefix(text, "[") {
+			end := strings.Index(text, "]")
+			if end < 0 || !isComment(text[end+1:]) {
+				return fail("malformed table header")
+			}
+			table = strings.TrimSpace(text[1:end])
+			continue
+		}
+
+		eq := strings.Index(text, "=")
+		if eq < 0 {
+			return fail("expected name = value")
+		}
+		name := strings.TrimSpace(text[:eq])
+		if table != "" {
+			name = table + "-" + name
+		}
+		value, err := configValue(strings.TrimSpace(text[eq+1:]))
+		if err != nil {
+			return fail("%s: %v", name, err)
+		}
+
+		if seen[name] {
+			return fail("%s set twice", name)
+		}
+		seen[name] = true
+		if flags.Lookup(name) == nil {
+			if shared != nil && shared(name) {
+				continue
+			}
+			return fail("unknown setting %s", name)
+		}
+		if explicit[name] {
+			continue
+		}
+		if err := flags.Set(name, value); err != nil {
+			return fail("%s: %v", name, err)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("load config: %w", err)
+	}
+
+	return nil
+}
+
+// configValue parses the value of a setting, which may be followed by a
+// comment.
+func configValue(text string) (string, error) {
+	switch {
+	case strings.HasPrefix(text, `"`):
+		quoted, err := strconv.QuotedPrefix(text)
+		if err != nil {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if !isComment(text[len(quoted):]) {
+			return "", fmt.Errorf("unexpected text after string")
+		}
+		return strconv.Unquote(quoted)
+	case strings.HasPrefix(text, "'"):
+		end := strings.Index(text[1:], "'")
+		if end < 0 {
+			return "", fmt.Errorf("unterminated string")
+		}
+		if !isComment(text[end+2:]) {
+			return "", fmt.Errorf("unexpected text after string")
+		}
+		return text[1 : end+1], nil
+	}
+
+	if i := strings.Index(text, "#"); i >= 0 {
+		text = text[:i]
+	}
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text, " \t") {
+		return "", fmt.Errorf("expected a single value, quoted if it is a string")
+	}
+
+	return text, nil
+}
+
+// isComment reports whether text is nothing but white space and perhaps a
+// comment.
+func isComment(text string) bool {
+	text = strings.TrimSpace(text)
+	return text == "" || strings.HasPrefix(text, "#")
+}
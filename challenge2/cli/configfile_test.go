@@ -0,0 +1,92 @@
+package cli
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestApplyConfigFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure-config")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	newFlags := func() (*flag.FlagSet, *string, *int, *bool, *time.Duration, *string) {
+		flags := flag.NewFlagSet("test", flag.ContinueOnError)
+		flags.SetOutput(ioutil.Discard)
+		return flags,
+			flags.String("key", "", ""),
+			flags.Int("max-conns", 0, ""),
+			flags.Bool("compress", false, ""),
+			flags.Duration("idle-timeout", 0, ""),
+			flags.String("log-level", "info", "")
+	}
+
+	path := filepath.Join(dir, "secure.toml")
+	contents := `# server settings
+key = "my keys/server.key"  # quoted
+max-conns = 100
+compress = true
+idle-timeout = 30s
+
+[log]
+level = 'debug'
+`
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	flags, key, maxConns, compress, idle, level := newFlags()
+	if err := flags.Parse([]string{"-max-conns", "5"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(flags, path, nil); err != nil {
+		t.Fatal(err)
+	}
+	if *key != "my keys/server.key" || !*compress || *idle != 30*time.Second || *level != "debug" {
+		t.Errorf("Unexpected settings %q, %v, %v, %q", *key, *compress, *idle, *level)
+	}
+	if *maxConns != 5 {
+		t.Errorf("Expected the command line to override the file, got -max-conns %d", *maxConns)
+	}
+
+	// Settings of other commands are skipped, and the rest still apply.
+	if err := ioutil.WriteFile(path, []byte("proxy = \"http://proxy:3128\"\ncompress = false\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	flags, _, _, compress, _, _ = newFlags()
+	if err := flags.Parse([]string{"-compress"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := applyConfigFile(flags, path, func(name string) bool { return name == "proxy" }); err != nil {
+		t.Fatal(err)
+	}
+	if !*compress {
+		t.Error("Expected the command line to override the file")
+	}
+
+	for bad, want := range map[string]string{
+		"port = 1\n":                 "unknown setting port",
+		"key = \"a\"\nkey = \"b\"\n": "key set twice",
+		"max-conns = lots\n":         "max-conns",
+		"key = \"unterminated\n":     "unterminated string",
+		"key = two words\n":          "single value",
+		"key\n":                      "expected name = value",
+		"[log\n":                     "malformed table header",
+	} {
+		if err := ioutil.WriteFile(path, []byte(bad), 0600); err != nil {
+			t.Fatal(err)
+		}
+		flags, _, _, _, _, _ := newFlags()
+		err := applyConfigFile(flags, path, nil)
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), "secure.toml:") {
+			t.Errorf("Expected %q to fail with %q, got %v", bad, want, err)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// progressInterval is how often a progress line is redrawn at most.
+const progressInterval = 200 * time.Millisecond
+
+// progressBarWidth is how many cells the bar of a progress line has.
+const progressBarWidth = 24
+
+// A progress draws how far a transfer has got on a line of w, a
+// terminal, redrawing it in place as the transfer goes on.
+type progress struct {
+	w     io.Writer
+	label string
+
+	// total is how many bytes the transfer has, or negative if that is
+	// not known, which leaves out the bar and the ETA.
+	total int64
+
+	start time.Time
+	drawn time.Time
+
+	// width is the length of the line last drawn, to blank what is left
+	// of it when a shorter one replaces it.
+	width int
+}
+
+func newProgress(w io.Writer, label string, total int64) *progress {
+	return &progress{w: w, label: label, total: total, start: time.Now()}
+}
+
+// update redraws the line for done bytes, with suffix after them, unless
+// it was drawn less than progressInterval ago.
+func (p *progress) update(done int64, suffix string) {
+	now := time.Now()
+	if now.Sub(p.drawn) < progressInterval {
+		return
+	}
+	p.drawn = now
+	p.draw(p.line(done, now) + suffix)
+}
+
+// finish draws the line for done bytes, with suffix, one last time and
+// ends it.
+func (p *progress) finish(done int64, suffix string) {
+	p.draw(p.line(done, time.Now()) + suffix)
+	fmt.Fprintln(p.w)
+}
+
+func (p *progress) draw(line string) {
+	pad := ""
+	if n := p.width - len(line); n > 0 {
+		pad = strings.Repeat(" ", n)
+	}
+	p.width = len(line)
+	fmt.Fprintf(p.w, "\r%s%s", line, pad)
+}
+
+// line returns the progress line for done bytes at now: the label, a
+// bar, the share done, the bytes, the average rate and the time left.
+func (p *progress) line(done int64, now time.Time) string {
+	elapsed := now.Sub(p.start)
+	var rate float64
+	if elapsed > 0 {
+		rate = float64(done) / elapsed.Seconds()
+	}
+
+	var b strings.Builder
+	b.WriteString(p.label)
+	if p.total < 0 {
+		fmt.Fprintf(&b, "  %s  %s/s", formatBytes(done), formatBytes(int64(rate)))
+		return b.String()
+	}
+
+	fraction := 1.0
+	if p.total > 0 {
+		fraction = float64(done) / float64(p.total)
+	}
+	filled := int(fraction * progressBarWidth)
+	if filled > progressBarWidth {
+		filled = progressBarWidth
+	}
+	fmt.Fprintf(&b, " [%s%s] %3d%%  %s/%s  %s/s", strings.Repeat("=", filled), strings.Repeat(" ", progressBarWidth-filled),
+		int(fraction*100), formatBytes(done), formatBytes(p.total), formatBytes(int64(rate)))
+	switch {
+	case done >= p.total:
+		fmt.Fprintf(&b, "  in %s", formatDuration(elapsed))
+	case rate > 0:
+		left := time.Duration(float64(p.total-done) / rate * float64(time.Second))
+		fmt.Fprintf(&b, "  ETA %s", formatDuration(left))
+	}
+
+	return b.String()
+}
+
+// formatBytes formats n bytes in the largest binary unit it reaches,
+// such as 1.5 MiB.
+func formatBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+
+	value, prefix := float64(n)/unit, 0
+	for value >= unit && prefix < len("KMGTPE")-1 {
+		value /= unit
+		prefix++
+	}
+
+	return fmt.Sprintf("%.1f %ciB", value, "KMGTPE"[prefix])
+}
+
+// formatDuration formats d to the second as m:ss, or h:mm:ss from an
+// hour on.
+func formatDuration(d time.Duration) string {
+	s := int64(d.Round(time.Second) / time.Second)
+	if s >= 3600 {
+		return fmt.Sprintf("%d:%02d:%02d", s/3600, s/60%60, s%60)
+	}
+
+	return fmt.Sprintf("%d:%02d", s/60, s%60)
+}
+
+// countingReader counts the bytes read from Reader.
+type countingReader struct {
+	io.Reader
+	n int64
+}
+
+func (r *countingReader) Read(p []byte) (int, error) {
+	n, err := r.Reader.Read(p)
+	atomic.AddInt64(&r.n, int64(n))
+
+	return n, err
+}
+
+func (r *countingReader) count() int64 {
+	return atomic.LoadInt64(&r.n)
+}
@@ -0,0 +1,59 @@
+package cli
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProgressLine(t *testing.T) {
+	p := newProgress(nil, "file", 4<<20)
+	for _, tt := range []struct {
+		done    int64
+		elapsed time.Duration
+		want    string
+	}{
+		{0, 0, "file [                        ]   0%  0 B/4.0 MiB  0 B/s"},
+		{1 << 20, time.Second, "file [======                  ]  25%  1.0 MiB/4.0 MiB  1.0 MiB/s  ETA 0:03"},
+		{4 << 20, 2 * time.Second, "file [========================] 100%  4.0 MiB/4.0 MiB  2.0 MiB/s  in 0:02"},
+	} {
+		if got := p.line(tt.done, p.start.Add(tt.elapsed)); got != tt.want {
+			t.Errorf("line(%d, %v) = %q, want %q", tt.done, tt.elapsed, got, tt.want)
+		}
+	}
+
+	unknown := newProgress(nil, "sent", -1)
+	if got, want := unknown.line(1536, unknown.start.Add(time.Second)), "sent  1.5 KiB  1.5 KiB/s"; got != want {
+		t.Errorf("line = %q, want %q", got, want)
+	}
+}
+
+func TestProgressDraw(t *testing.T) {
+	var buf bytes.Buffer
+	p := newProgress(&buf, "x", -1)
+	p.update(1<<20, " and more")
+	p.update(2<<20, "")
+	p.finish(2<<20, "")
+
+	lines := strings.Split(buf.String(), "\r")
+	if len(lines) != 3 {
+		t.Fatalf("Expected the line drawn twice, throttled once, got %q", buf.String())
+	}
+	if !strings.HasSuffix(lines[2], "\n") || len(lines[2]) < len(lines[1]) {
+		t.Errorf("Expected the last line to blank the longer one before it and end, got %q", lines[2])
+	}
+}
+
+func TestFormat(t *testing.T) {
+	for n, want := range map[int64]string{0: "0 B", 1023: "1023 B", 1024: "1.0 KiB", 5 << 30: "5.0 GiB"} {
+		if got := formatBytes(n); got != want {
+			t.Errorf("formatBytes(%d) = %q, want %q", n, got, want)
+		}
+	}
+	for d, want := range map[time.Duration]string{0: "0:00", 61 * time.Second: "1:01", 3723 * time.Second: "1:02:03"} {
+		if got := formatDuration(d); got != want {
+			t.Errorf("formatDuration(%v) = %q, want %q", d, got, want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"os/signal"
+	"sort"
+	"syscall"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// rereadFlags returns the flags of the running command as its command
+// line and -config file set them now. runCommand sets it.
+var rereadFlags func() (*flag.FlagSet, error)
+
+// reloadable are the flags a reload applies to a running server. The
+// others only take effect on a restart.
+var reloadable = map[string]bool{
+	"log-level":       true,
+	"authorized-keys": true,
+	"ban-list":        true,
+	"client-rate":     true,
+	"global-rate":     true,
+	"idle-timeout":    true,
+}
+
+// watchReload reloads s on SIGHUP, and when asked to with a POST to
+// /debug/reload on the -debug-addr.
+func (f *serverFlags) watchReload(s *securecomm.Server) {
+	reload := func() error {
+		flags, err := rereadFlags()
+		if err != nil {
+			return err
+		}
+		return f.reload(s, flags)
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := reload(); err != nil {
+				slog.Error("reload failed", "err", err)
+			}
+		}
+	}()
+
+	if f.debugAddr != "" {
+		http.HandleFunc("/debug/reload", func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				w.Header().Set("Allow", http.MethodPost)
+				http.Error(w, "reload with POST", http.StatusMethodNotAllowed)
+				return
+			}
+			if err := reload(); err != nil {
+				slog.Error("reload failed", "err", err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			fmt.Fprintln(w, "reloaded")
+		})
+	}
+}
+
+// reload applies to s, for the connections it accepts from then on, the
+// settings of flags that can change while serving, rereading the files
+// they name, and sets the log level. If any of them is wrong, nothing
+// changes. Changes to other settings are logged as needing a restart.
+func (f *serverFlags) reload(s *securecomm.Server, flags *flag.FlagSet) error {
+	var changed, restart []string
+	var next serverFlags
+	next.register(flag.NewFlagSet("", flag.ContinueOnError))
+	flags.VisitAll(func(fl *flag.Flag) {
+		live := f.flags.Lookup(fl.Name)
+		if live == nil || live.Value.String() == fl.Value.String() {
+			return
+		}
+		if reloadable[fl.Name] {
+			changed = append(changed, fl.Name)
+		} else {
+			restart = append(restart, fl.Name)
+		}
+	})
+	f.flags.VisitAll(func(fl *flag.Flag) {
+		value := fl.Value.String()
+		if reloadable[fl.Name] && flags.Lookup(fl.Name) != nil {
+			value = flags.Lookup(fl.Name).Value.String()
+		}
+		if next.flags.Lookup(fl.Name) != nil {
+			next.flags.Set(fl.Name, value)
+		}
+	})
+
+	level, err := parseLogLevel(flags.Lookup("log-level").Value.String())
+	if err != nil {
+		return err
+	}
+	opts, err := next.limits()
+	if err != nil {
+		return err
+	}
+
+	s.Reconfigure(opts...)
+	logLevel.Set(level)
+	for _, name := range changed {
+		f.flags.Set(name, flags.Lookup(name).Value.String())
+	}
+
+	sort.Strings(changed)
+	slog.Info("configuration reloaded", "changed", changed)
+	if len(restart) > 0 {
+		sort.Strings(restart)
+		slog.Warn("settings changed that only take effect on a restart", "settings", restart)
+	}
+
+	return nil
+}
@@ -0,0 +1,94 @@
+package cli
+
+import (
+	"flag"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+func TestServerReload(t *testing.T) {
+	dir := t.TempDir()
+	config := filepath.Join(dir, "secure.toml")
+	banList := filepath.Join(dir, "banned")
+	if err := os.WriteFile(banList, []byte("127.0.0.0/8\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// parse parses the flags a server command is run with, as
+	// rereadFlags would.
+	parse := func() (*flag.FlagSet, *serverFlags) {
+		cmd := command{name: "serve"}
+		flags := cmd.flagSet()
+		var server serverFlags
+		server.register(flags)
+		if err := flags.Parse([]string{"-config", config, "-max-conns", "5"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := applyConfig(flags); err != nil {
+			t.Fatal(err)
+		}
+		return flags, &server
+	}
+
+	if err := os.WriteFile(config, []byte("[log]\nlevel = \"info\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	_, server := parse()
+	opts, err := server.options()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := server.server(opts, nil)
+	l := testutil.Listen(t)
+	go s.Serve(l)
+	defer s.Close()
+	defer logLevel.Set(slog.LevelInfo)
+
+	conn, err := securecomm.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A broken setting changes nothing.
+	if err := os.WriteFile(config, []byte("ban-list = \""+filepath.Join(dir, "missing")+"\"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	flags, _ := parse()
+	if err := server.reload(s, flags); err == nil {
+		t.Error("Expected a missing ban list to fail the reload")
+	}
+	if got := server.banList; got != "" {
+		t.Errorf("Expected -ban-list to stay unset, got %q", got)
+	}
+
+	// A good one applies to new connections only.
+	contents := "ban-list = \"" + banList + "\"\nmax-conns = 10\n[log]\nlevel = \"debug\"\n"
+	if err := os.WriteFile(config, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	flags, _ = parse()
+	if err := server.reload(s, flags); err != nil {
+		t.Fatal(err)
+	}
+	if logLevel.Level() != slog.LevelDebug {
+		t.Errorf("Expected the log level to be reloaded, got %v", logLevel.Level())
+	}
+	if server.banList != banList || server.maxConns != 5 {
+		t.Errorf("Expected only -ban-list to be reloaded, got %q and %d", server.banList, server.maxConns)
+	}
+	if _, err := securecomm.Dial(l.Addr().String()); err == nil {
+		t.Error("Expected the reloaded ban list to refuse new clients")
+	}
+	if err := conn.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := conn.ReadMsg(); err != nil || string(echo) != "ping" {
+		t.Errorf("Expected the established connection to carry on, got %q, %v", echo, err)
+	}
+}
@@ -0,0 +1,172 @@
+// Package cli implements the command line of the challenge2 command,
+// which the gomentor command also serves as its secure subcommand.
+package cli
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/errcode"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// sessionPassphraseEnv names the environment variable the -passphrase
+// flag reads from.
+const sessionPassphraseEnv = "SECURE_SESSION_PASSPHRASE"
+
+// program is the name of the command; see Main.
+var program = "challenge2"
+
+// Main runs the challenge2 command, and gomentor secure, with args[0]
+// naming one of the commands in usage. It takes its arguments as
+// [github.com/jpreese/go-mentor/cli.Main] does.
+func Main(name string, args []string) {
+	program = name
+	if err := runCommand(args); err != nil {
+		fatal(err)
+	}
+}
+
+// logLevel is the level the command logs at, which a reload can change.
+var logLevel slog.LevelVar
+
+// parseLogLevel parses a level as given to the -log-level flag.
+func parseLogLevel(level string) (slog.Level, error) {
+	var l slog.Level
+	if err := l.UnmarshalText([]byte(level)); err != nil {
+		return 0, fmt.Errorf("parse -log-level %q: %w", level, err)
+	}
+
+	return l, nil
+}
+
+// newLogger returns a logger writing to w at level and in the format
+// named, as given to the -log-format flag.
+func newLogger(w io.Writer, level slog.Leveler, format string) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	default:
+		return nil, fmt.Errorf("unknown -log-format %q, expected text or json", format)
+	}
+}
+
+// loopbackOnly fails unless addr is on a loopback interface.
+func loopbackOnly(addr string) error {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return err
+	}
+	if ip := net.ParseIP(host); host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return fmt.Errorf("%s is not a loopback address", addr)
+	}
+
+	return nil
+}
+
+// logTransferred logs how much went over the client's connection.
+func logTransferred(conn *securecomm.SecureConn) {
+	stats := conn.Stats()
+	slog.Debug("connection closed", "bytes_in", stats.BytesIn, "bytes_out", stats.BytesOut)
+}
+
+// fatal logs err, with its code when it has one, and exits with the
+// status its code calls for.
+func fatal(err error) {
+	if code := errcode.Of(err); code != "" {
+		slog.Error(err.Error(), "code", code)
+	} else {
+		slog.Error(err.Error())
+	}
+	os.Exit(errcode.ExitStatus(err))
+}
+
+// chatOnTerminal runs Chat on standard input and output, switching the
+// terminal to raw mode for the line editing if they are one.
+func chatOnTerminal(conn *securecomm.SecureConn) error {
+	fd := int(os.Stdin.Fd())
+	if terminal.IsTerminal(fd) {
+		state, err := terminal.MakeRaw(fd)
+		if err != nil {
+			return err
+		}
+		defer terminal.Restore(fd, state)
+	}
+
+	return securecomm.Chat(conn, struct {
+		io.Reader
+		io.Writer
+	}{os.Stdin, os.Stdout})
+}
+
+// pipeStdio runs PipeIO on standard input and output. With showProgress,
+// it draws how much went each way on standard error as it goes, with a
+// bar and the time left when standard input is a file.
+func pipeStdio(conn *securecomm.SecureConn, showProgress bool) error {
+	if !showProgress {
+		return securecomm.PipeIO(conn, os.Stdin, os.Stdout)
+	}
+
+	total := int64(-1)
+	if fi, err := os.Stdin.Stat(); err == nil && fi.Mode().IsRegular() {
+		total = fi.Size()
+	}
+	stdin := &countingReader{Reader: os.Stdin}
+	p := newProgress(os.Stderr, "sent", total)
+	received := func(stats, recent securecomm.ConnStats) string {
+		return fmt.Sprintf("  received %s  %s/s", formatBytes(stats.BytesIn), formatBytes(int64(recent.InRate())))
+	}
+
+	done := make(chan struct{})
+	drawn := make(chan struct{})
+	go func() {
+		defer close(drawn)
+		t := time.NewTicker(progressInterval)
+		defer t.Stop()
+		last := conn.Stats()
+		for {
+			select {
+			case <-t.C:
+				stats := conn.Stats()
+				p.update(stdin.count(), received(stats, stats.Sub(last)))
+				last = stats
+			case <-done:
+				stats := conn.Stats()
+				p.finish(stdin.count(), received(stats, stats))
+				return
+			}
+		}
+	}()
+
+	err := securecomm.PipeIO(conn, stdin, os.Stdout)
+	close(done)
+	<-drawn
+
+	return err
+}
+
+// confirmHost asks on the terminal whether to trust a new server.
+func confirmHost(host, fingerprint string) bool {
+	fmt.Fprintf(os.Stderr, "The identity of %s is not known yet.\nIts fingerprint is %s.\nTrust it and continue (yes/no)? ", host, fingerprint)
+
+	answer, _ := bufio.NewReader(os.Stdin).ReadString('\n')
+	return strings.TrimSpace(strings.ToLower(answer)) == "yes"
+}
+
+// mailboxKey derives the key the command seals its mailbox with from
+// the server's identity, so that it needs no key file of its own.
+func mailboxKey(identity *securecomm.KeyPair) *[32]byte {
+	key := sha256.Sum256(append([]byte("go-mentor mailbox key"), identity.Private[:]...))
+	return &key
+}
@@ -0,0 +1,45 @@
+package cli
+
+import (
+	"bytes"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func TestNewLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := newLogger(&buf, slog.LevelWarn, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("hidden")
+	logger.Warn("shown", "conn", 7)
+	if got := buf.String(); strings.Contains(got, "hidden") || !strings.Contains(got, `"msg":"shown","conn":7`) {
+		t.Errorf("Unexpected log output %q", got)
+	}
+
+	if _, err := parseLogLevel("loud"); err == nil {
+		t.Error("Expected -log-level loud to be refused")
+	}
+	if _, err := newLogger(&buf, slog.LevelInfo, "xml"); err == nil {
+		t.Error("Expected -log-format xml to be refused")
+	}
+}
+
+func TestLoopbackOnly(t *testing.T) {
+	for addr, ok := range map[string]bool{
+		"127.0.0.1:6060": true,
+		"[::1]:6060":     true,
+		"localhost:6060": true,
+		":6060":          false,
+		"0.0.0.0:6060":   false,
+		"10.0.0.1:6060":  false,
+		"example.com:80": false,
+		"127.0.0.1":      false,
+	} {
+		if err := loopbackOnly(addr); (err == nil) != ok {
+			t.Errorf("loopbackOnly(%q) = %v", addr, err)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// daemonEnv is set in the environment of the process -daemon starts in
+// the background, so that it runs the command instead of starting
+// another.
+const daemonEnv = "SECURE_DAEMON_CHILD"
+
+// errAlreadyRunning is returned when the -pidfile names a process that
+// is still running.
+var errAlreadyRunning = errors.New("already running")
+
+// stopRequested is closed once the service manager asks the program to
+// stop, which it then does as when interrupted.
+var (
+	stopRequested = make(chan struct{})
+	stopOnce      sync.Once
+)
+
+// requestStop closes stopRequested.
+func requestStop() {
+	stopOnce.Do(func() { close(stopRequested) })
+}
+
+// runService runs the command as the -daemon and -pidfile flags say,
+// if it has them, and as a service when the service manager started
+// it.
+func runService(flags *flag.FlagSet, run func() error) error {
+	if daemon := flags.Lookup("daemon"); daemon != nil && daemon.Value.String() == "true" && os.Getenv(daemonEnv) == "" {
+		if flags.Lookup("log-file").Value.String() == "" {
+			return errors.New("-daemon needs -log-file, as it has no standard error to log to")
+		}
+		pid, err := startDaemon()
+		if err != nil {
+			return fmt.Errorf("start in the background: %w", err)
+		}
+		fmt.Fprintf(os.Stderr, "%s running in the background as process %d\n", program, pid)
+		return nil
+	}
+
+	if pidFile := flags.Lookup("pidfile"); pidFile != nil && pidFile.Value.String() != "" {
+		path := pidFile.Value.String()
+		if err := writePidFile(path); err != nil {
+			return err
+		}
+		defer os.Remove(path)
+	}
+
+	return runPlatformService(run)
+}
+
+// writePidFile writes the ID of this process to the file at path,
+// unless it names another process that is still running.
+func writePidFile(path string) error {
+	if b, err := os.ReadFile(path); err == nil {
+		pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+		if err == nil && pid != os.Getpid() && processRunning(pid) {
+			return fmt.Errorf("%s: process %d: %w", path, pid, errAlreadyRunning)
+		}
+	} else if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// Written whole and then renamed, so that nobody reads half of it.
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(tmp, os.Getpid()); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
+
+// logFile is a log file that can be reopened, once logrotate has moved
+// it aside, to carry on in a new file at the same path.
+type logFile struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// openLogFile opens the file at path for appending, creating it if need
+// be, and reopens it on SIGHUP.
+func openLogFile(path string) (*logFile, error) {
+	lf := &logFile{path: path}
+	if err := lf.reopen(); err != nil {
+		return nil, err
+	}
+
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	go func() {
+		for range hangup {
+			if err := lf.reopen(); err != nil {
+				slog.Error("log file reopen failed", "err", err)
+			}
+		}
+	}()
+
+	return lf, nil
+}
+
+func (lf *logFile) reopen() error {
+	f, err := os.OpenFile(lf.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.f != nil {
+		lf.f.Close()
+	}
+	lf.f = f
+
+	return nil
+}
+
+func (lf *logFile) Write(p []byte) (int, error) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+
+	return lf.f.Write(p)
+}
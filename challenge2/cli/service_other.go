@@ -0,0 +1,20 @@
+//go:build !unix && !windows
+
+package cli
+
+import "errors"
+
+// startDaemon fails, as there are no sessions to detach into here.
+func startDaemon() (int, error) {
+	return 0, errors.New("-daemon is not supported on this system")
+}
+
+// processRunning reports whether the process with ID pid is running,
+// which it cannot tell here, so it assumes not.
+func processRunning(pid int) bool {
+	return false
+}
+
+func runPlatformService(run func() error) error {
+	return run()
+}
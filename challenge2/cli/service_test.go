@@ -0,0 +1,99 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWritePidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secure.pid")
+	if err := writePidFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if got := readPid(t, path); got != os.Getpid() {
+		t.Errorf("Expected pid %d, got %d", os.Getpid(), got)
+	}
+
+	// A file left by a process that has gone is replaced.
+	if err := os.WriteFile(path, []byte("999999999\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePidFile(path); err != nil {
+		t.Fatalf("Expected a stale pidfile to be replaced, got %v", err)
+	}
+
+	// One naming a running process is not.
+	if err := os.WriteFile(path, []byte(strconv.Itoa(os.Getppid())), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writePidFile(path); !errors.Is(err, errAlreadyRunning) {
+		t.Errorf("Expected errAlreadyRunning, got %v", err)
+	}
+}
+
+func readPid(t *testing.T, path string) int {
+	t.Helper()
+
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return pid
+}
+
+func TestRunServicePidFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secure.pid")
+	flags := serveFlags(t, "-pidfile", path)
+
+	err := runService(flags, func() error {
+		if got := readPid(t, path); got != os.Getpid() {
+			t.Errorf("Expected pid %d while running, got %d", os.Getpid(), got)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("Expected the pidfile to be removed, got %v", err)
+	}
+}
+
+func TestRunServiceDaemonNeedsLogFile(t *testing.T) {
+	flags := serveFlags(t, "-daemon")
+	err := runService(flags, func() error {
+		t.Error("Expected the command not to run")
+		return nil
+	})
+	if err == nil || !strings.Contains(err.Error(), "-log-file") {
+		t.Errorf("Expected -daemon without -log-file to fail, got %v", err)
+	}
+}
+
+// serveFlags returns the parsed flags of the serve command.
+func serveFlags(t *testing.T, args ...string) *flag.FlagSet {
+	t.Helper()
+
+	for _, cmd := range commands() {
+		if cmd.name == "serve" {
+			flags := cmd.flagSet()
+			cmd.setup(flags)
+			if err := flags.Parse(args); err != nil {
+				t.Fatal(err)
+			}
+			return flags
+		}
+	}
+	t.Fatal("No serve command")
+	return nil
+}
@@ -0,0 +1,48 @@
+//go:build unix
+
+package cli
+
+import (
+	"errors"
+	"os"
+	"os/exec"
+	"syscall"
+)
+
+// startDaemon starts the program again in a session of its own, with
+// no terminal and with standard input and output discarded, and
+// returns its process ID.
+func startDaemon() (int, error) {
+	self, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	null, err := os.OpenFile(os.DevNull, os.O_RDWR, 0)
+	if err != nil {
+		return 0, err
+	}
+	defer null.Close()
+
+	cmd := exec.Command(self, os.Args[1:]...)
+	cmd.Env = append(os.Environ(), daemonEnv+"=1")
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = null, null, null
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+	pid := cmd.Process.Pid
+
+	return pid, cmd.Process.Release()
+}
+
+// processRunning reports whether the process with ID pid is running.
+func processRunning(pid int) bool {
+	err := syscall.Kill(pid, 0)
+	return err == nil || errors.Is(err, syscall.EPERM)
+}
+
+// runPlatformService runs the command. Unix service managers such as
+// systemd run programs as they are, and stop them with SIGTERM.
+func runPlatformService(run func() error) error {
+	return run()
+}
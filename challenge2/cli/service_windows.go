@@ -0,0 +1,79 @@
+//go:build windows
+
+package cli
+
+import (
+	"errors"
+	"os"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/errcode"
+	"golang.org/x/sys/windows/svc"
+)
+
+// startDaemon fails, as Windows runs programs in the background as
+// services instead.
+func startDaemon() (int, error) {
+	return 0, errors.New("-daemon is not supported on Windows; install the program as a service instead")
+}
+
+// processRunning reports whether the process with ID pid is running.
+func processRunning(pid int) bool {
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	p.Release()
+
+	return true
+}
+
+// runPlatformService runs the command as a Windows service when the
+// service control manager started the program, and as it is otherwise.
+func runPlatformService(run func() error) error {
+	interactive, err := svc.IsAnInteractiveSession()
+	if err != nil {
+		return err
+	}
+	if interactive {
+		return run()
+	}
+
+	h := &serviceHandler{run: run}
+	if err := svc.Run(program, h); err != nil {
+		return err
+	}
+
+	return h.err
+}
+
+// serviceHandler answers the service control manager while the command
+// runs, stopping it when asked to.
+type serviceHandler struct {
+	run func() error
+	err error
+}
+
+func (h *serviceHandler) Execute(args []string, requests <-chan svc.ChangeRequest, status chan<- svc.Status) (serviceSpecific bool, exitCode uint32) {
+	status <- svc.Status{State: svc.StartPending}
+	done := make(chan error, 1)
+	go func() { done <- h.run() }()
+	status <- svc.Status{State: svc.Running, Accepts: svc.AcceptStop | svc.AcceptShutdown}
+
+	for {
+		select {
+		case h.err = <-done:
+			if h.err != nil {
+				return true, uint32(errcode.ExitStatus(h.err))
+			}
+			return false, 0
+		case r := <-requests:
+			switch r.Cmd {
+			case svc.Interrogate:
+				status <- r.CurrentStatus
+			case svc.Stop, svc.Shutdown:
+				status <- svc.Status{State: svc.StopPending}
+				requestStop()
+			}
+		}
+	}
+}
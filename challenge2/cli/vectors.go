@@ -0,0 +1,43 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// verifyVectorsCommand checks this implementation against a test vector
+// file, printing the outcome of each vector.
+func verifyVectorsCommand(flags *flag.FlagSet) func(args []string) error {
+	path := flags.String("f", "securecomm/testdata/vectors.json", "Test vector file to verify against")
+
+	return func(args []string) error {
+		v, err := securecomm.LoadVectors(*path)
+		if err != nil {
+			return err
+		}
+
+		var failed int
+		report := func(kind, name string, err error) {
+			if err != nil {
+				failed++
+				fmt.Printf("FAIL %s %s: %v\n", kind, name, err)
+				return
+			}
+			fmt.Printf("ok   %s %s\n", kind, name)
+		}
+		for _, frame := range v.Frames {
+			report("frame", frame.Name, frame.Verify())
+		}
+		for _, hs := range v.Handshakes {
+			report("handshake", hs.Name, hs.Verify())
+		}
+
+		if failed > 0 {
+			return fmt.Errorf("%d of %d vectors failed", failed, len(v.Frames)+len(v.Handshakes))
+		}
+
+		return nil
+	}
+}
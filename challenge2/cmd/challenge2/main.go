@@ -0,0 +1,11 @@
+package main
+
+import (
+	"os"
+
+	"github.com/jpreese/go-mentor/challenge2/cli"
+)
+
+func main() {
+	cli.Main(os.Args[0], os.Args[1:])
+}
@@ -1,5 +1,7 @@
 module github.com/jpreese/go-mentor/challenge2
 
-go 1.13
+go 1.21
 
 require golang.org/x/crypto v0.0.0-20191029031824-8986dd9e96cf
+
+require golang.org/x/sys v0.0.0-20190412213103-97732733099d
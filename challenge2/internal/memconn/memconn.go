@@ -0,0 +1,167 @@
+// Package memconn is an in-memory connection for the handshake to run
+// over in tests, in place of a socket.
+package memconn
+
+import (
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// Pipe returns the two ends of an in-memory connection. Unlike
+// net.Pipe, writes never wait for the other end to read, as the
+// handshake needs both ends to write before either reads. Each end
+// supports deadlines and CloseWrite.
+func Pipe() (net.Conn, net.Conn) {
+	a, b := newMemoryBuffer(), newMemoryBuffer()
+
+	return &memoryConn{read: a, write: b}, &memoryConn{read: b, write: a}
+}
+
+// memoryBuffer carries bytes in one direction of a Pipe.
+type memoryBuffer struct {
+	mu   sync.Mutex
+	data []byte
+
+	// writeClosed says the writer closed its end and readClosed that the
+	// reader did.
+	writeClosed bool
+	readClosed  bool
+	deadline    time.Time
+
+	// changed is closed, and replaced, whenever any of the above change.
+	changed chan struct{}
+}
+
+func newMemoryBuffer() *memoryBuffer {
+	return &memoryBuffer{changed: make(chan struct{})}
+}
+
+// signal wakes a waiting reader. The caller must hold mu.
+func (b *memoryBuffer) signal() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func (b *memoryBuffer) read(p []byte) (int, error) {
+	for {
+		b.mu.Lock()
+		switch {
+		case b.readClosed:
+			b.mu.Unlock()
+			return 0, io.ErrClosedPipe
+		case len(b.data) > 0:
+			n := copy(p, b.data)
+			b.data = b.data[n:]
+			b.mu.Unlock()
+			return n, nil
+		case b.writeClosed:
+			b.mu.Unlock()
+			return 0, io.EOF
+		case !b.deadline.IsZero() && !time.Now().Before(b.deadline):
+			b.mu.Unlock()
+			return 0, timeoutError{}
+		}
+		changed, deadline := b.changed, b.deadline
+		b.mu.Unlock()
+
+		if deadline.IsZero() {
+			<-changed
+			continue
+		}
+		timer := time.NewTimer(time.Until(deadline))
+		select {
+		case <-changed:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+func (b *memoryBuffer) write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.writeClosed || b.readClosed {
+		return 0, io.ErrClosedPipe
+	}
+	b.data = append(b.data, p...)
+	b.signal()
+
+	return len(p), nil
+}
+
+func (b *memoryBuffer) closeWrite() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.writeClosed = true
+	b.signal()
+}
+
+func (b *memoryBuffer) closeRead() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.readClosed = true
+	b.data = nil
+	b.signal()
+}
+
+func (b *memoryBuffer) setDeadline(t time.Time) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.deadline = t
+	b.signal()
+}
+
+// memoryConn is one end of a Pipe. Write deadlines are accepted
+// but have no effect, since writes never block.
+type memoryConn struct {
+	read, write *memoryBuffer
+}
+
+func (c *memoryConn) Read(p []byte) (int, error)  { return c.read.read(p) }
+func (c *memoryConn) Write(p []byte) (int, error) { return c.write.write(p) }
+
+func (c *memoryConn) CloseWrite() error {
+	c.write.closeWrite()
+	return nil
+}
+
+func (c *memoryConn) Close() error {
+	c.read.closeRead()
+	c.write.closeWrite()
+	return nil
+}
+
+func (c *memoryConn) LocalAddr() net.Addr  { return memoryAddr{} }
+func (c *memoryConn) RemoteAddr() net.Addr { return memoryAddr{} }
+
+func (c *memoryConn) SetDeadline(t time.Time) error {
+	c.read.setDeadline(t)
+	return nil
+}
+
+func (c *memoryConn) SetReadDeadline(t time.Time) error {
+	c.read.setDeadline(t)
+	return nil
+}
+
+func (c *memoryConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+type memoryAddr struct{}
+
+func (memoryAddr) Network() string { return "memory" }
+func (memoryAddr) String() string  { return "memory" }
+
+// timeoutError is returned by reads from a memoryConn past its deadline.
+type timeoutError struct{}
+
+func (timeoutError) Error() string   { return "i/o timeout" }
+func (timeoutError) Timeout() bool   { return true }
+func (timeoutError) Temporary() bool { return true }
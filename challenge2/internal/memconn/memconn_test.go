@@ -0,0 +1,33 @@
+package memconn
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestPipeDeadline(t *testing.T) {
+	a, b := Pipe()
+	defer a.Close()
+	defer b.Close()
+
+	a.SetReadDeadline(time.Now().Add(10 * time.Millisecond))
+	var netErr net.Error
+	if _, err := a.Read(make([]byte, 1)); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+
+	// Clearing the deadline lets a blocked read wait for data.
+	a.SetReadDeadline(time.Time{})
+	go b.Write([]byte("x"))
+	if n, err := a.Read(make([]byte, 1)); n != 1 || err != nil {
+		t.Fatalf("Unexpected read: %d, %v", n, err)
+	}
+
+	b.Close()
+	if _, err := a.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("Expected io.EOF after the other end closed, got %v", err)
+	}
+}
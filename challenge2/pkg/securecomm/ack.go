@@ -0,0 +1,84 @@
+package securecomm
+
+import (
+	"context"
+	"encoding/binary"
+	"sync"
+)
+
+// acks is the messages a SecureConn sent with WriteMsgAck whose
+// acknowledgement has yet to arrive, by the sequence number of their
+// last frame.
+type acks struct {
+	mu      sync.Mutex
+	waiting map[uint64]chan struct{}
+}
+
+func (a *acks) add(seq uint64, done chan struct{}) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.waiting == nil {
+		a.waiting = make(map[uint64]chan struct{})
+	}
+	a.waiting[seq] = done
+}
+
+func (a *acks) remove(seq uint64) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.waiting, seq)
+}
+
+// acknowledged wakes the writer waiting for the acknowledgement payload
+// carries. Acknowledgements nobody waits for any more are ignored.
+func (a *acks) acknowledged(payload []byte) {
+	if len(payload) != 8 {
+		return
+	}
+	seq := binary.BigEndian.Uint64(payload)
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if done, ok := a.waiting[seq]; ok {
+		close(done)
+		delete(a.waiting, seq)
+	}
+}
+
+// WriteMsgAck is WriteMsg, but waits for the peer to acknowledge that it
+// decrypted the whole message, which it does as its reads reach the
+// message. It gives up when ctx is done, returning ctx's error, although
+// the message may still be read. Acknowledgements arrive along with
+// whatever else the peer sends, so the connection must be read from
+// while waiting. WriteMsgAck fails with ErrAckUnsupported if the peer
+// does not acknowledge messages.
+func (c *SecureConn) WriteMsgAck(ctx context.Context, message []byte) error {
+	if c.features&featureAck == 0 {
+		return ErrAckUnsupported
+	}
+
+	done := make(chan struct{})
+	var seq uint64
+	var registered bool
+	_, err := c.writer.write(message, func(s uint64) {
+		seq, registered = s, true
+		c.acks.add(seq, done)
+	})
+	if err != nil {
+		if registered {
+			c.acks.remove(seq)
+		}
+		return c.keepaliveErr(c.exhausted(err))
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		c.acks.remove(seq)
+		return ctx.Err()
+	}
+}
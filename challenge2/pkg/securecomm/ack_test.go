@@ -0,0 +1,99 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteMsgAck(t *testing.T) {
+	client, server, err := testPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// Acknowledgements reach the client through its reads.
+	go func() {
+		for {
+			if _, err := client.ReadMsg(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Messages spanning several frames are acknowledged once, whole.
+	server.SetMaxMessageSize(1024)
+	client.SetMaxMessageSize(1024)
+	for _, message := range []string{"hello", strings.Repeat("x", 5000), ""} {
+		acked := make(chan error, 1)
+		go func() {
+			acked <- client.WriteMsgAck(ctx, []byte(message))
+		}()
+
+		// Nothing is acknowledged before the server reads the message.
+		select {
+		case err := <-acked:
+			t.Fatalf("WriteMsgAck returned %v before the message was read", err)
+		case <-time.After(20 * time.Millisecond):
+		}
+
+		received, err := server.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(received) != message {
+			t.Fatalf("Received %q, expected %q", received, message)
+		}
+		if err := <-acked; err != nil {
+			t.Fatalf("WriteMsgAck: %v", err)
+		}
+	}
+}
+
+func TestWriteMsgAckTimeout(t *testing.T) {
+	client, server, err := testPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// The server never reads, so never acknowledges.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := client.WriteMsgAck(ctx, []byte("anyone?")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+
+	// A late acknowledgement is ignored, and the message still arrives.
+	go client.ReadMsg()
+	if message, err := server.ReadMsg(); err != nil || string(message) != "anyone?" {
+		t.Fatalf("Unexpected message %q, %v", message, err)
+	}
+	client.acks.mu.Lock()
+	defer client.acks.mu.Unlock()
+	if len(client.acks.waiting) != 0 {
+		t.Error("Expected no acknowledgements to be awaited")
+	}
+}
+
+func TestWriteMsgAckUnsupported(t *testing.T) {
+	client, server, err := testPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	client.features &^= featureAck
+	if err := client.WriteMsgAck(context.Background(), []byte("hello")); !errors.Is(err, ErrAckUnsupported) {
+		t.Fatalf("Expected ErrAckUnsupported, got %v", err)
+	}
+}
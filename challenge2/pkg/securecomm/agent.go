@@ -0,0 +1,222 @@
+package securecomm
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+// AgentSocketEnv names the environment variable holding the socket of
+// the agent the -agent flag defaults to.
+const AgentSocketEnv = "SECURE_AGENT_SOCK"
+
+// Requests to an agent, and the status its answers start with. Each
+// travels with a four byte length prefix.
+const (
+	// agentListKeys asks for the public keys the agent holds, answered
+	// by them one after the other.
+	agentListKeys = 1
+
+	// agentECDH, followed by a public key the agent holds and a peer's
+	// public key, asks for the shared secret of the two.
+	agentECDH = 2
+
+	agentOK      = 0
+	agentFailure = 1
+)
+
+// agentMaxMessageSize bounds the messages between an agent and its
+// clients, which are no more than a list of keys.
+const agentMaxMessageSize = 64 * 1024
+
+// agentTimeout bounds how long a request to an agent may take.
+const agentTimeout = 10 * time.Second
+
+// An Agent holds identity keys in memory and computes key agreements
+// with them for the processes that connect to it, as ssh-agent does, so
+// that those processes, long-running servers among them, never hold the
+// keys themselves. Anyone who can connect to it can use the keys, so it
+// must only be reachable by their owner, such as on a Unix socket only
+// they can open. The zero Agent is ready to use, and it is safe for
+// concurrent use.
+type Agent struct {
+	mu   sync.Mutex
+	keys []*KeyPair
+}
+
+// Add adds key to the keys a holds.
+func (a *Agent) Add(key *KeyPair) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.keys = append(a.keys, key)
+}
+
+// Serve answers the requests of each client connecting on l until l
+// fails, returning its error.
+func (a *Agent) Serve(l net.Listener) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return err
+		}
+		go a.serveConn(conn)
+	}
+}
+
+// serveConn answers requests on conn until the client hangs up.
+func (a *Agent) serveConn(conn net.Conn) {
+	defer conn.Close()
+
+	for {
+		request, err := readAgentMessage(conn)
+		if err != nil {
+			return
+		}
+		var response []byte
+		if answer, err := a.answer(request); err != nil {
+			response = append([]byte{agentFailure}, err.Error()...)
+		} else {
+			response = append([]byte{agentOK}, answer...)
+		}
+		if err := writeAgentMessage(conn, response); err != nil {
+			return
+		}
+	}
+}
+
+// answer returns the answer to request.
+func (a *Agent) answer(request []byte) ([]byte, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	switch {
+	case len(request) == 1 && request[0] == agentListKeys:
+		var keys []byte
+		for _, key := range a.keys {
+			keys = append(keys, key.Public[:]...)
+		}
+		return keys, nil
+
+	case len(request) == 1+32+32 && request[0] == agentECDH:
+		var public, peer [32]byte
+		copy(public[:], request[1:])
+		copy(peer[:], request[1+32:])
+		for _, key := range a.keys {
+			if key.Public == public {
+				shared, err := key.ECDH(&peer)
+				return shared[:], err
+			}
+		}
+		return nil, fmt.Errorf("%s: %w", Fingerprint(public), ErrAgentKeyNotFound)
+
+	default:
+		return nil, fmt.Errorf("unexpected request %x", request)
+	}
+}
+
+// An AgentKey is an identity key held by the agent listening on the
+// Unix socket Socket. Each key agreement is a request to the agent.
+type AgentKey struct {
+	Socket string
+	Public [32]byte
+}
+
+// AgentKeys returns the keys held by the agent listening on the Unix
+// socket at socket.
+func AgentKeys(socket string) ([]AgentKey, error) {
+	answer, err := agentRequest(socket, []byte{agentListKeys})
+	if err != nil {
+		return nil, err
+	}
+	if len(answer)%32 != 0 {
+		return nil, fmt.Errorf("agent: listed keys of %d bytes", len(answer))
+	}
+
+	keys := make([]AgentKey, len(answer)/32)
+	for i := range keys {
+		keys[i].Socket = socket
+		copy(keys[i].Public[:], answer[i*32:])
+	}
+
+	return keys, nil
+}
+
+// PublicKey returns k.Public.
+func (k AgentKey) PublicKey() *[32]byte {
+	return &k.Public
+}
+
+// ECDH asks the agent for the shared secret of k and peer.
+func (k AgentKey) ECDH(peer *[32]byte) ([32]byte, error) {
+	var shared [32]byte
+	request := append(append([]byte{agentECDH}, k.Public[:]...), peer[:]...)
+	answer, err := agentRequest(k.Socket, request)
+	if err != nil {
+		return shared, err
+	}
+	if len(answer) != len(shared) {
+		return shared, fmt.Errorf("agent: shared secret of %d bytes", len(answer))
+	}
+	copy(shared[:], answer)
+
+	return shared, nil
+}
+
+// agentRequest sends request to the agent at socket and returns its
+// answer.
+func agentRequest(socket string, request []byte) ([]byte, error) {
+	conn, err := net.DialTimeout("unix", socket, agentTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+	defer conn.Close()
+	if err := conn.SetDeadline(time.Now().Add(agentTimeout)); err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+
+	if err := writeAgentMessage(conn, request); err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+	response, err := readAgentMessage(conn)
+	if err != nil {
+		return nil, fmt.Errorf("agent: %w", err)
+	}
+	switch {
+	case len(response) > 0 && response[0] == agentOK:
+		return response[1:], nil
+	case len(response) > 0 && response[0] == agentFailure:
+		return nil, fmt.Errorf("agent: %s", response[1:])
+	default:
+		return nil, fmt.Errorf("agent: unexpected response %x", response)
+	}
+}
+
+func writeAgentMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 4, 4+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	_, err := w.Write(append(frame, msg...))
+
+	return err
+}
+
+func readAgentMessage(r io.Reader) ([]byte, error) {
+	var size [4]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, err
+	}
+	n := binary.BigEndian.Uint32(size[:])
+	if n > agentMaxMessageSize {
+		return nil, fmt.Errorf("agent message of %d bytes: %w", n, ErrMessageTooLarge)
+	}
+
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+
+	return msg, nil
+}
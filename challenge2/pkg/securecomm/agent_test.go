@@ -0,0 +1,117 @@
+package securecomm
+
+import (
+	"errors"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startAgent starts an agent holding keys on a socket in a temporary
+// directory and returns the socket.
+func startAgent(t *testing.T, keys ...*KeyPair) string {
+	t.Helper()
+
+	socket := filepath.Join(t.TempDir(), "agent.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	var agent Agent
+	for _, key := range keys {
+		agent.Add(key)
+	}
+	go agent.Serve(l)
+
+	return socket
+}
+
+func TestAgent(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	socket := startAgent(t, key)
+
+	keys, err := AgentKeys(socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(keys) != 1 || keys[0].Public != key.Public {
+		t.Fatalf("Unexpected keys %v", keys)
+	}
+
+	got, err := keys[0].ECDH(&peer.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want, _ := peer.ECDH(&key.Public); got != want {
+		t.Errorf("Expected the agent to agree on the shared secret")
+	}
+
+	unknown := AgentKey{Socket: socket, Public: peer.Public}
+	if _, err := unknown.ECDH(&key.Public); err == nil || !strings.Contains(err.Error(), ErrAgentKeyNotFound.Error()) {
+		t.Errorf("Expected the agent to refuse a key it does not hold, got %v", err)
+	}
+}
+
+func TestAgentHandshake(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		opts []Option
+	}{
+		{"legacy", nil},
+		{"noise", []Option{WithNoise(NoiseConfig{Pattern: NoiseXX})}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			serverKey, err := GenerateKey()
+			if err != nil {
+				t.Fatal(err)
+			}
+			keys, err := AgentKeys(startAgent(t, serverKey))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			s := &Server{Options: append(tt.opts, WithIdentityKey(keys[0]))}
+			addr, _ := startServer(t, s)
+			defer s.Close()
+
+			conn, err := Dial(addr, tt.opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if identity, ok := conn.PeerIdentity(); !ok || identity != serverKey.Public {
+				t.Errorf("Expected the server to prove the key the agent holds")
+			}
+			if err := conn.WriteMsg([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			if echo, err := conn.ReadMsg(); err != nil || string(echo) != "ping" {
+				t.Fatalf("Unexpected echo %q, %v", echo, err)
+			}
+		})
+	}
+}
+
+func TestAgentUnreachable(t *testing.T) {
+	key := AgentKey{Socket: filepath.Join(t.TempDir(), "missing.sock")}
+	s := &Server{Options: []Option{WithIdentityKey(key), WithErrorHandler(func(net.Addr, error) {})}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	if _, err := Dial(addr); err == nil {
+		t.Fatal("Expected the handshake to fail without the agent")
+	}
+	if _, err := AgentKeys(key.Socket); err == nil || errors.Is(err, ErrAgentKeyNotFound) {
+		t.Errorf("Expected a connection error, got %v", err)
+	}
+}
@@ -0,0 +1,244 @@
+package securecomm
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// An AuditLog records the start and end of each session a server
+// serves, one JSON object per line, appending to the file at Path. It
+// is safe for concurrent use once its fields are set.
+type AuditLog struct {
+	// Path is the file to append to, created if need be.
+	Path string
+
+	// MaxSize, if positive, is how many bytes the file may grow to.
+	// Beyond it, the file is rotated: renamed to Path.1, the one before
+	// to Path.2 and so on, keeping MaxBackups of them.
+	MaxSize    int64
+	MaxBackups int
+
+	// Chain makes each entry carry the SHA-256 of the line before it,
+	// across rotations, so that an entry removed or altered later
+	// breaks the chain VerifyAuditLog checks.
+	Chain bool
+
+	mu   sync.Mutex
+	file *os.File
+	size int64
+	prev []byte
+}
+
+// An AuditEntry is one line of an AuditLog.
+type AuditEntry struct {
+	Time  time.Time `json:"time"`
+	Event string    `json:"event"`
+
+	Remote  string `json:"remote"`
+	Peer    string `json:"peer,omitempty"`
+	Version int    `json:"version"`
+	Cipher  string `json:"cipher"`
+	Resumed bool   `json:"resumed,omitempty"`
+
+	// BytesIn, BytesOut and Duration are set at the end of the
+	// session, and Error if it ended with one.
+	BytesIn  int64   `json:"bytes_in,omitempty"`
+	BytesOut int64   `json:"bytes_out,omitempty"`
+	Duration float64 `json:"duration_seconds,omitempty"`
+	Error    string  `json:"error,omitempty"`
+
+	// Prev is the hex encoded SHA-256 of the line before, when the log
+	// is chained.
+	Prev string `json:"prev,omitempty"`
+}
+
+// Events recorded in an AuditLog.
+const (
+	auditSessionStart = "session_start"
+	auditSessionEnd   = "session_end"
+)
+
+// start records that sc was established.
+func (a *AuditLog) start(sc *SecureConn) error {
+	return a.write(auditEntry(sc, auditSessionStart))
+}
+
+// end records that sc, established at start, ended with err.
+func (a *AuditLog) end(sc *SecureConn, start time.Time, err error) error {
+	entry := auditEntry(sc, auditSessionEnd)
+	entry.BytesIn, entry.BytesOut = sc.bytesTransferred()
+	entry.Duration = sc.clock.Now().Sub(start).Seconds()
+	if err != nil {
+		entry.Error = err.Error()
+	}
+
+	return a.write(entry)
+}
+
+func auditEntry(sc *SecureConn, event string) AuditEntry {
+	entry := AuditEntry{
+		Time:    sc.clock.Now().UTC(),
+		Event:   event,
+		Remote:  sc.RemoteAddr().String(),
+		Version: int(sc.version),
+		Cipher:  sc.CipherSuite().String(),
+		Resumed: sc.Resumed(),
+	}
+	if identity, ok := sc.PeerIdentity(); ok {
+		entry.Peer = Fingerprint(identity)
+	}
+
+	return entry
+}
+
+func (a *AuditLog) write(entry AuditEntry) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		if err := a.open(); err != nil {
+			return err
+		}
+	}
+	if a.Chain && a.prev != nil {
+		sum := sha256.Sum256(a.prev)
+		entry.Prev = hex.EncodeToString(sum[:])
+	}
+
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	if a.MaxSize > 0 && a.size > 0 && a.size+int64(len(line))+1 > a.MaxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(append(line, '\n'))
+	a.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	a.prev = line
+
+	return nil
+}
+
+// open opens the file for appending, picking up the chain from its last
+// line.
+func (a *AuditLog) open() error {
+	file, err := os.OpenFile(a.Path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("audit: %w", err)
+	}
+
+	if a.Chain && a.prev == nil && info.Size() > 0 {
+		contents, err := ioutil.ReadFile(a.Path)
+		if err != nil {
+			file.Close()
+			return fmt.Errorf("audit: %w", err)
+		}
+		contents = bytes.TrimSuffix(contents, []byte("\n"))
+		a.prev = contents[bytes.LastIndexByte(contents, '\n')+1:]
+	}
+	a.file, a.size = file, info.Size()
+
+	return nil
+}
+
+// rotate moves the full file out of the way and starts a new one.
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return fmt.Errorf("audit: %w", err)
+	}
+	a.file = nil
+
+	if a.MaxBackups <= 0 {
+		if err := os.Remove(a.Path); err != nil {
+			return fmt.Errorf("audit: rotate: %w", err)
+		}
+	} else {
+		os.Remove(a.backup(a.MaxBackups))
+		for i := a.MaxBackups - 1; i > 0; i-- {
+			if err := os.Rename(a.backup(i), a.backup(i+1)); err != nil && !os.IsNotExist(err) {
+				return fmt.Errorf("audit: rotate: %w", err)
+			}
+		}
+		if err := os.Rename(a.Path, a.backup(1)); err != nil {
+			return fmt.Errorf("audit: rotate: %w", err)
+		}
+	}
+
+	return a.open()
+}
+
+func (a *AuditLog) backup(i int) string {
+	return a.Path + "." + strconv.Itoa(i)
+}
+
+// Close closes the file. The log reopens it if written to again.
+func (a *AuditLog) Close() error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.file == nil {
+		return nil
+	}
+	err := a.file.Close()
+	a.file = nil
+
+	return err
+}
+
+// VerifyAuditLog checks the hash chain through the files of a chained
+// AuditLog, given oldest first, such as path.2, path.1 and path. The
+// first entry is taken on trust, since its predecessor may have been
+// rotated away.
+func VerifyAuditLog(paths ...string) error {
+	var prev []byte
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("verify audit log: %w", err)
+		}
+
+		scanner := bufio.NewScanner(file)
+		for line := 1; scanner.Scan(); line++ {
+			var entry AuditEntry
+			if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+				file.Close()
+				return fmt.Errorf("verify audit log: %s:%d: %w", path, line, err)
+			}
+			if prev != nil {
+				sum := sha256.Sum256(prev)
+				if entry.Prev != hex.EncodeToString(sum[:]) {
+					file.Close()
+					return fmt.Errorf("verify audit log: %s:%d: chain broken", path, line)
+				}
+			}
+			prev = append(prev[:0], scanner.Bytes()...)
+		}
+		err = scanner.Err()
+		file.Close()
+		if err != nil {
+			return fmt.Errorf("verify audit log: %w", err)
+		}
+	}
+
+	return nil
+}
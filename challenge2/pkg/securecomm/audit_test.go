@@ -0,0 +1,148 @@
+package securecomm
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAuditLog(t *testing.T, path string) []AuditEntry {
+	t.Helper()
+
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	var entries []AuditEntry
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var entry AuditEntry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+
+	return entries
+}
+
+func TestServeAuditLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	identity, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	audit := &AuditLog{Path: filepath.Join(dir, "audit.log")}
+	defer audit.Close()
+	s := &Server{Options: []Option{WithAuditLog(audit), WithErrorHandler(func(net.Addr, error) {})}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr, WithIdentity(identity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	var entries []AuditEntry
+	deadline := time.Now().Add(5 * time.Second)
+	for len(entries) < 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the session to end, got %+v", entries)
+		}
+		time.Sleep(10 * time.Millisecond)
+		entries = readAuditLog(t, audit.Path)
+	}
+
+	start, end := entries[0], entries[1]
+	if start.Event != "session_start" || end.Event != "session_end" {
+		t.Fatalf("Unexpected events %q, %q", start.Event, end.Event)
+	}
+	for _, entry := range entries {
+		if entry.Peer != Fingerprint(identity.Public) || entry.Cipher != conn.CipherSuite().String() || entry.Version == 0 {
+			t.Errorf("Unexpected entry %+v", entry)
+		}
+	}
+	if end.BytesIn == 0 || end.BytesOut == 0 || end.Duration <= 0 {
+		t.Errorf("Expected the session's totals, got %+v", end)
+	}
+}
+
+func TestAuditLogChain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure-audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+	audit := &AuditLog{Path: path, MaxSize: 300, MaxBackups: 2, Chain: true}
+	for i := 0; i < 3; i++ {
+		if err := audit.write(AuditEntry{Event: "session_start", Remote: "127.0.0.1:1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	audit.Close()
+
+	// Reopening picks the chain up from the last entry.
+	audit = &AuditLog{Path: path, MaxSize: 300, MaxBackups: 2, Chain: true}
+	for i := 0; i < 3; i++ {
+		if err := audit.write(AuditEntry{Event: "session_end", Remote: "127.0.0.1:1"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	audit.Close()
+
+	paths := []string{path + ".2", path + ".1", path}
+	var total int
+	for _, p := range paths {
+		total += len(readAuditLog(t, p))
+		if info, err := os.Stat(p); err != nil || info.Size() > 300 {
+			t.Errorf("Expected %s to be rotated, got %v, %v", p, info, err)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 backups, got %v", err)
+	}
+	// Chained entries are too long for two to fit in a file, so each
+	// write after the first rotated, dropping all but the last three.
+	if total != 3 {
+		t.Errorf("Expected 3 entries kept, got %d", total)
+	}
+	if err := VerifyAuditLog(paths...); err != nil {
+		t.Fatal(err)
+	}
+
+	// Altering an entry breaks the chain after it.
+	contents, err := ioutil.ReadFile(path + ".1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(contents), "127.0.0.1:1", "127.0.0.1:2", 1)
+	if err := ioutil.WriteFile(path+".1", []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := VerifyAuditLog(paths...); err == nil || !strings.Contains(err.Error(), "chain broken") {
+		t.Fatalf("Expected the chain to be broken, got %v", err)
+	}
+}
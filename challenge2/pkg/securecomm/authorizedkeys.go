@@ -0,0 +1,100 @@
+package securecomm
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// AuthorizedKeys is the set of client identity keys a server accepts.
+// The file it is loaded from is reloaded whenever it changes, so keys can
+// be granted or revoked without restarting the server. It is safe for
+// concurrent use.
+//
+// The file holds one hex encoded public key per line, optionally
+// followed by a comment; blank lines and lines starting with # are
+// ignored.
+type AuthorizedKeys struct {
+	path string
+
+	mu      sync.Mutex
+	keys    map[[32]byte]bool
+	modTime time.Time
+	size    int64
+}
+
+// LoadAuthorizedKeys reads the authorized keys file at path.
+func LoadAuthorizedKeys(path string) (*AuthorizedKeys, error) {
+	ak := AuthorizedKeys{path: path}
+	if err := ak.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &ak, nil
+}
+
+// Reload rereads the file. If it cannot be read or parsed, the keys
+// loaded before stay in effect.
+func (ak *AuthorizedKeys) Reload() error {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+
+	return ak.reload()
+}
+
+func (ak *AuthorizedKeys) reload() error {
+	file, err := os.Open(ak.path)
+	if err != nil {
+		return fmt.Errorf("load authorized keys: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return fmt.Errorf("load authorized keys: %w", err)
+	}
+
+	keys := make(map[[32]byte]bool)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		decoded, err := hex.DecodeString(strings.Fields(text)[0])
+		if err != nil || len(decoded) != 32 {
+			return fmt.Errorf("load authorized keys: %s:%d: expected a hex encoded key", ak.path, line)
+		}
+
+		var key [32]byte
+		copy(key[:], decoded)
+		keys[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("load authorized keys: %w", err)
+	}
+
+	ak.keys, ak.modTime, ak.size = keys, info.ModTime(), info.Size()
+
+	return nil
+}
+
+// Allowed reports whether key is authorized, first reloading the file if
+// it changed since it was last read.
+func (ak *AuthorizedKeys) Allowed(key [32]byte) bool {
+	ak.mu.Lock()
+	defer ak.mu.Unlock()
+
+	if info, err := os.Stat(ak.path); err == nil && (!info.ModTime().Equal(ak.modTime) || info.Size() != ak.size) {
+		// A file caught half written fails to parse; the previous keys
+		// stay in effect until the next change.
+		ak.reload()
+	}
+
+	return ak.keys[key]
+}
@@ -0,0 +1,85 @@
+package securecomm
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestAuthorizedKeys(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure-authorized-keys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	allowed, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "authorized_keys")
+	contents := fmt.Sprintf("# team\n\n%s alice@laptop\n", allowed)
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ak, err := LoadAuthorizedKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := testutil.Listen(t)
+	go Serve(l, nil, WithAuthorizedKeys(ak))
+
+	ping := func(opts ...Option) error {
+		conn, err := Dial(l.Addr().String(), opts...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if err := conn.WriteMsg([]byte("ping")); err != nil {
+			return err
+		}
+		_, err = conn.ReadMsg()
+		return err
+	}
+
+	if err := ping(WithIdentity(allowed)); err != nil {
+		t.Fatalf("Authorized client was refused: %v", err)
+	}
+	if err := ping(WithIdentity(other)); err == nil {
+		t.Fatal("Unauthorized client was served")
+	}
+	if err := ping(); err == nil {
+		t.Fatal("Anonymous client was served")
+	}
+
+	// Swap the keys around without restarting the server. Move the
+	// modification time forward so the change is noticed even on file
+	// systems with coarse timestamps.
+	if err := ioutil.WriteFile(path, []byte(other.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(path, later, later); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ping(WithIdentity(other)); err != nil {
+		t.Fatalf("Newly authorized client was refused: %v", err)
+	}
+	if err := ping(WithIdentity(allowed)); err == nil {
+		t.Fatal("Revoked client was served")
+	}
+}
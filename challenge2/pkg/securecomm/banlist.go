@@ -0,0 +1,134 @@
+package securecomm
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+)
+
+// A BanList is the clients a server refuses, by identity key or by
+// source address. Clients from a banned network are dropped as soon as
+// they connect, and clients presenting a banned key before the
+// handshake completes. Unlike AuthorizedKeys, the file is only reread
+// when Reload is called, for instance on SIGHUP, so that an edit in
+// progress never takes effect half done. It is safe for concurrent use.
+//
+// The file holds one entry per line: a hex encoded public key, an IP
+// address or a network in CIDR notation, optionally followed by a
+// comment. Blank lines and lines starting with # are ignored.
+type BanList struct {
+	path string
+
+	mu       sync.RWMutex
+	keys     map[[32]byte]bool
+	networks []*net.IPNet
+}
+
+// LoadBanList reads the ban list file at path.
+func LoadBanList(path string) (*BanList, error) {
+	bl := BanList{path: path}
+	if err := bl.Reload(); err != nil {
+		return nil, err
+	}
+
+	return &bl, nil
+}
+
+// Reload rereads the file. If it cannot be read or parsed, the entries
+// loaded before stay in effect. Connections already established are
+// not affected.
+func (bl *BanList) Reload() error {
+	file, err := os.Open(bl.path)
+	if err != nil {
+		return fmt.Errorf("load ban list: %w", err)
+	}
+	defer file.Close()
+
+	keys := make(map[[32]byte]bool)
+	var networks []*net.IPNet
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		entry := strings.Fields(text)[0]
+
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			networks = append(networks, network)
+			continue
+		}
+		if ip := net.ParseIP(entry); ip != nil {
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			networks = append(networks, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		decoded, err := hex.DecodeString(entry)
+		if err != nil || len(decoded) != 32 {
+			return fmt.Errorf("load ban list: %s:%d: expected a hex encoded key, an IP address or a network", bl.path, line)
+		}
+
+		var key [32]byte
+		copy(key[:], decoded)
+		keys[key] = true
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("load ban list: %w", err)
+	}
+
+	bl.mu.Lock()
+	defer bl.mu.Unlock()
+	bl.keys, bl.networks = keys, networks
+
+	return nil
+}
+
+// BannedKey reports whether the identity key is banned.
+func (bl *BanList) BannedKey(key [32]byte) bool {
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+
+	return bl.keys[key]
+}
+
+// BannedAddr reports whether addr is in a banned network. Addresses
+// that are not IP addresses are never banned.
+func (bl *BanList) BannedAddr(addr net.Addr) bool {
+	var ip net.IP
+	switch addr := addr.(type) {
+	case *net.TCPAddr:
+		ip = addr.IP
+	case *net.UDPAddr:
+		ip = addr.IP
+	default:
+		return false
+	}
+
+	bl.mu.RLock()
+	defer bl.mu.RUnlock()
+
+	for _, network := range bl.networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// checkBanned fails with ErrBanned if the client's identity key is on
+// the server's ban list.
+func (cfg config) checkBanned(key [32]byte) error {
+	if cfg.banList != nil && cfg.banList.BannedKey(key) {
+		return fmt.Errorf("%s: %w", Fingerprint(key), ErrBanned)
+	}
+
+	return nil
+}
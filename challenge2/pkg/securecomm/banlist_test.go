@@ -0,0 +1,129 @@
+package securecomm
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestBanList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure-ban-list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	banned, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(dir, "banned")
+	contents := fmt.Sprintf("# abuse\n\n%s spammer\n192.0.2.7\n198.51.100.0/24 scanners\n2001:db8::/32\n", banned)
+	if err := ioutil.WriteFile(path, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bl, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bl.BannedKey(banned.Public) || bl.BannedKey(other.Public) {
+		t.Error("Expected only the listed key to be banned")
+	}
+	for addr, expected := range map[string]bool{
+		"192.0.2.7":    true,
+		"192.0.2.8":    false,
+		"198.51.100.9": true,
+		"2001:db8::1":  true,
+		"2001:db9::1":  false,
+	} {
+		if got := bl.BannedAddr(&net.TCPAddr{IP: net.ParseIP(addr), Port: 1}); got != expected {
+			t.Errorf("BannedAddr(%s) = %v, expected %v", addr, got, expected)
+		}
+	}
+
+	// A broken file leaves the list as it was.
+	if err := ioutil.WriteFile(path, []byte("not an entry\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.Reload(); err == nil {
+		t.Error("Expected the broken file to fail to load")
+	}
+	if !bl.BannedKey(banned.Public) {
+		t.Error("Expected the earlier entries to stay in effect")
+	}
+
+	// A good one replaces it.
+	if err := ioutil.WriteFile(path, []byte(other.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if bl.BannedKey(banned.Public) || !bl.BannedKey(other.Public) {
+		t.Error("Expected the reloaded entries to replace the earlier ones")
+	}
+}
+
+func TestServeBanList(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure-ban-list")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	banned, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(dir, "banned")
+	if err := ioutil.WriteFile(path, []byte(banned.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bl, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only bans are of interest, not how the echo server's clients
+	// hung up.
+	banErrs := make(chan error, 1)
+	s := &Server{Options: []Option{
+		WithBanList(bl),
+		WithErrorHandler(func(addr net.Addr, err error) {
+			if errors.Is(err, ErrBanned) {
+				banErrs <- err
+			}
+		}),
+	}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	if _, err := Dial(addr, WithIdentity(banned)); err == nil {
+		t.Fatal("Expected the banned key to be refused")
+	}
+	<-banErrs
+	conn := dialEchoed(t, addr)
+	conn.Close()
+
+	// Banning the network takes effect on reload.
+	if err := ioutil.WriteFile(path, []byte("127.0.0.0/8\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := bl.Reload(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Dial(addr); err == nil {
+		t.Fatal("Expected the banned network to be refused")
+	}
+	<-banErrs
+}
@@ -0,0 +1,127 @@
+package securecomm
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// A benchmarkChannel dials connections to an echo server over one of the
+// channels the end-to-end benchmarks compare.
+type benchmarkChannel struct {
+	name string
+	dial func() (net.Conn, error)
+}
+
+// benchmarkChannels starts an echo server for the secure channel with
+// each cipher suite, and one for TLS 1.3 as the baseline to measure them
+// against, all on loopback.
+func benchmarkChannels(b *testing.B) []benchmarkChannel {
+	var channels []benchmarkChannel
+	for _, suite := range []CipherSuite{CipherNaClBox, CipherXChaCha20Poly1305} {
+		l := testutil.Listen(b)
+		b.Cleanup(func() { l.Close() })
+		// Logging each connection would clutter the results.
+		go Serve(l, nil, WithCipherSuite(suite), WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil))))
+
+		addr, suite := l.Addr().String(), suite
+		channels = append(channels, benchmarkChannel{suite.String(), func() (net.Conn, error) {
+			return Dial(addr, WithCipherSuite(suite))
+		}})
+	}
+
+	serverConfig, clientConfig := testTLSConfigs(b)
+	serverConfig.MinVersion, clientConfig.MinVersion = tls.VersionTLS13, tls.VersionTLS13
+	l, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { l.Close() })
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+	channels = append(channels, benchmarkChannel{"tls13", func() (net.Conn, error) {
+		return tls.Dial("tcp", l.Addr().String(), clientConfig)
+	}})
+
+	return channels
+}
+
+// roundTrip sends message over conn and reads its echo into buf.
+func roundTrip(conn net.Conn, message, buf []byte) error {
+	if _, err := conn.Write(message); err != nil {
+		return err
+	}
+	_, err := io.ReadFull(conn, buf)
+
+	return err
+}
+
+// BenchmarkEndToEnd measures round trips of a message to an echo server
+// and back, so ns/op is the latency of one and MB/s the throughput each
+// way.
+func BenchmarkEndToEnd(b *testing.B) {
+	for _, channel := range benchmarkChannels(b) {
+		for _, size := range []int{64, 1024, 16 * 1024, 256 * 1024} {
+			b.Run(channel.name+"/"+fmt.Sprintf("%dB", size), func(b *testing.B) {
+				conn, err := channel.dial()
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer conn.Close()
+				message, buf := make([]byte, size), make([]byte, size)
+
+				b.SetBytes(int64(size))
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if err := roundTrip(conn, message, buf); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkEndToEndStreams measures round trips as BenchmarkEndToEnd
+// does, over as many connections at once as RunParallel runs goroutines.
+func BenchmarkEndToEndStreams(b *testing.B) {
+	const size = 16 * 1024
+	for _, channel := range benchmarkChannels(b) {
+		b.Run(channel.name, func(b *testing.B) {
+			b.SetBytes(size)
+			b.ReportAllocs()
+			b.RunParallel(func(pb *testing.PB) {
+				conn, err := channel.dial()
+				if err != nil {
+					b.Error(err)
+					return
+				}
+				defer conn.Close()
+				message, buf := make([]byte, size), make([]byte, size)
+
+				for pb.Next() {
+					if err := roundTrip(conn, message, buf); err != nil {
+						b.Error(err)
+						return
+					}
+				}
+			})
+		})
+	}
+}
@@ -0,0 +1,152 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// A BroadcastEventType says what a BroadcastEvent reports.
+type BroadcastEventType byte
+
+const (
+	// BroadcastMessage carries a message another client sent.
+	BroadcastMessage BroadcastEventType = iota
+
+	// BroadcastJoin reports a client joining, or one that was there
+	// already when we joined.
+	BroadcastJoin
+
+	// BroadcastLeave reports a client leaving.
+	BroadcastLeave
+)
+
+// A BroadcastEvent is what a BroadcastHandler sends its clients, each in
+// a message of its own.
+type BroadcastEvent struct {
+	Type BroadcastEventType
+
+	// From names the client the event is about: the fingerprint of its
+	// identity key if it has one, its address otherwise.
+	From string
+
+	Message []byte
+}
+
+// MarshalBinary encodes e as the type, the length of From in a byte,
+// From, and the message.
+func (e BroadcastEvent) MarshalBinary() ([]byte, error) {
+	if len(e.From) > 255 {
+		return nil, fmt.Errorf("broadcast sender %q longer than 255 bytes", e.From)
+	}
+
+	b := make([]byte, 0, 2+len(e.From)+len(e.Message))
+	b = append(b, byte(e.Type), byte(len(e.From)))
+	b = append(b, e.From...)
+
+	return append(b, e.Message...), nil
+}
+
+// UnmarshalBinary decodes an event encoded by MarshalBinary.
+func (e *BroadcastEvent) UnmarshalBinary(b []byte) error {
+	if len(b) < 2 || len(b) < 2+int(b[1]) {
+		return errors.New("broadcast event truncated")
+	}
+
+	e.Type = BroadcastEventType(b[0])
+	e.From = string(b[2 : 2+b[1]])
+	e.Message = append([]byte(nil), b[2+b[1]:]...)
+
+	return nil
+}
+
+// BroadcastHandler returns a Handler that relays each message a client
+// sends to every other client it serves, as BroadcastEvents, and tells
+// them when clients join and leave. Each message is sealed for each
+// recipient on its own connection. A client that falls too far behind
+// is disconnected rather than holding up the rest.
+func BroadcastHandler() Handler {
+	room := &broadcastRoom{members: make(map[*broadcastMember]struct{})}
+	return room.serve
+}
+
+// broadcastRoom is the clients a BroadcastHandler serves.
+type broadcastRoom struct {
+	mu      sync.Mutex
+	members map[*broadcastMember]struct{}
+}
+
+// broadcastMember is a client of a broadcastRoom.
+type broadcastMember struct {
+	*relayClient
+	name string
+}
+
+func (r *broadcastRoom) serve(ctx context.Context, conn *SecureConn) error {
+	m := &broadcastMember{relayClient: newRelayClient(conn), name: conn.RemoteAddr().String()}
+	if identity, ok := conn.PeerIdentity(); ok {
+		m.name = Fingerprint(identity)
+	}
+
+	if err := r.join(m); err != nil {
+		return err
+	}
+	defer r.leave(m)
+
+	return m.serve(ctx, func(message []byte) error {
+		return r.send(m, BroadcastEvent{Type: BroadcastMessage, From: m.name, Message: message})
+	})
+}
+
+// join adds m to the room, telling it who is there already and them
+// that it arrived.
+func (r *broadcastRoom) join(m *broadcastMember) error {
+	joined, err := BroadcastEvent{Type: BroadcastJoin, From: m.name}.MarshalBinary()
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for other := range r.members {
+		other.enqueue(joined)
+		// Every member's name was encoded once already, when it joined.
+		present, _ := BroadcastEvent{Type: BroadcastJoin, From: other.name}.MarshalBinary()
+		m.enqueue(present)
+	}
+	r.members[m] = struct{}{}
+
+	return nil
+}
+
+func (r *broadcastRoom) leave(m *broadcastMember) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.members, m)
+	r.sendLocked(m, BroadcastEvent{Type: BroadcastLeave, From: m.name})
+}
+
+// send queues event for every member but from.
+func (r *broadcastRoom) send(from *broadcastMember, event BroadcastEvent) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.sendLocked(from, event)
+}
+
+func (r *broadcastRoom) sendLocked(from *broadcastMember, event BroadcastEvent) error {
+	b, err := event.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	for m := range r.members {
+		if m != from {
+			m.enqueue(b)
+		}
+	}
+
+	return nil
+}
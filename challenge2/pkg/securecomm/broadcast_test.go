@@ -0,0 +1,139 @@
+package securecomm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestBroadcastEventEncoding(t *testing.T) {
+	event := BroadcastEvent{Type: BroadcastMessage, From: "127.0.0.1:1234", Message: []byte("hello")}
+	b, err := event.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded BroadcastEvent
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Type != event.Type || decoded.From != event.From || !bytes.Equal(decoded.Message, event.Message) {
+		t.Fatalf("Decoded %+v, expected %+v", decoded, event)
+	}
+
+	if err := decoded.UnmarshalBinary(b[:5]); err == nil {
+		t.Error("Expected a truncated event to be rejected")
+	}
+	if _, err := (BroadcastEvent{From: string(make([]byte, 256))}).MarshalBinary(); err == nil {
+		t.Error("Expected an overlong sender to be rejected")
+	}
+}
+
+func TestBroadcastHandler(t *testing.T) {
+	s := &Server{Handler: BroadcastHandler()}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	next := func(conn *SecureConn) BroadcastEvent {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		message, err := conn.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var event BroadcastEvent
+		if err := event.UnmarshalBinary(message); err != nil {
+			t.Fatal(err)
+		}
+		return event
+	}
+	expect := func(conn *SecureConn, typ BroadcastEventType, from *SecureConn, message string) {
+		t.Helper()
+		event := next(conn)
+		if event.Type != typ || event.From != from.LocalAddr().String() || string(event.Message) != message {
+			t.Fatalf("Got %+v, expected type %d from %s with %q", event, typ, from.LocalAddr(), message)
+		}
+	}
+
+	alice, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+
+	bob, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+
+	// Whichever joined first, each hears of the other.
+	expect(bob, BroadcastJoin, alice, "")
+	expect(alice, BroadcastJoin, bob, "")
+
+	if err := bob.WriteMsg([]byte("hi alice")); err != nil {
+		t.Fatal(err)
+	}
+	expect(alice, BroadcastMessage, bob, "hi alice")
+	if err := alice.WriteMsg([]byte("hi bob")); err != nil {
+		t.Fatal(err)
+	}
+	// Senders do not hear their own messages back.
+	expect(bob, BroadcastMessage, alice, "hi bob")
+
+	bob.Close()
+	expect(alice, BroadcastLeave, bob, "")
+}
+
+func TestBroadcastDropsSlowClients(t *testing.T) {
+	s := &Server{Handler: BroadcastHandler()}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	// slow never reads, so its queue fills up.
+	slow, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer slow.Close()
+	if err := slow.WriteMsg([]byte("joined")); err != nil {
+		t.Fatal(err)
+	}
+
+	fast, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fast.Close()
+
+	left := make(chan struct{})
+	go func() {
+		for {
+			message, err := fast.ReadMsg()
+			if err != nil {
+				return
+			}
+			var event BroadcastEvent
+			if event.UnmarshalBinary(message) == nil && event.Type == BroadcastLeave && event.From == slow.LocalAddr().String() {
+				close(left)
+				return
+			}
+		}
+	}()
+
+	// Send until the socket buffers and then the queue fill up.
+	message := make([]byte, 64*1024)
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case <-left:
+			return
+		case <-timeout:
+			t.Fatal("The slow client was not dropped")
+		default:
+		}
+		if err := fast.WriteMsg(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package securecomm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Capture records the frames of the connections handshakes run over,
+// one JSON object per line, so that a session can be looked at, or
+// replayed with Replay, offline. It is safe for concurrent use once its
+// fields are set. Errors writing to W are ignored rather than failing
+// the connections being captured.
+type Capture struct {
+	// W is where the records are written.
+	W io.Writer
+
+	// Keys makes the capture also hold the keys each connection's
+	// frames are sealed with, recorded whenever they change, so that
+	// Replay can decrypt them. Anyone who gets hold of such a capture
+	// can read the sessions in it, so it is for debugging only.
+	Keys bool
+
+	mu    sync.Mutex
+	conns int64
+}
+
+// A CaptureRecord is one line of a Capture: a frame sent or received
+// over a connection, or the key the frames after it in that direction
+// are sealed with.
+type CaptureRecord struct {
+	Time time.Time `json:"time"`
+
+	// Conn numbers the connections in the capture from one, and Dir is
+	// "send" or "recv", the direction of the frame or key.
+	Conn int64  `json:"conn"`
+	Dir  string `json:"dir"`
+
+	// Frame is the frame as it went over the wire, header and all.
+	Frame []byte `json:"frame,omitempty"`
+
+	// Key and Cipher are the key and the cipher suite that frames in
+	// Dir are sealed with from here on.
+	Key    []byte `json:"key,omitempty"`
+	Cipher string `json:"cipher,omitempty"`
+}
+
+// Directions of a CaptureRecord.
+const (
+	captureSend = "send"
+	captureRecv = "recv"
+)
+
+// wrap returns a connection that records to c what goes over conn once
+// the handshake is done.
+func (c *Capture) wrap(conn net.Conn) net.Conn {
+	c.mu.Lock()
+	c.conns++
+	id := c.conns
+	c.mu.Unlock()
+
+	return &captureConn{Conn: conn, capture: c, id: id}
+}
+
+func (c *Capture) write(record CaptureRecord) {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.W.Write(append(line, '\n'))
+}
+
+// A captureConn is a connection a Capture records the frames of.
+type captureConn struct {
+	net.Conn
+	capture *Capture
+	id      int64
+
+	// framing is set once the handshake is done and the stream holds
+	// nothing but frames.
+	framing int32
+
+	mu             sync.Mutex // guards sent and received
+	sent, received wireParser
+}
+
+func (cc *captureConn) Read(p []byte) (int, error) {
+	n, err := cc.Conn.Read(p)
+	cc.record(captureRecv, &cc.received, p[:n])
+	return n, err
+}
+
+func (cc *captureConn) Write(p []byte) (int, error) {
+	n, err := cc.Conn.Write(p)
+	cc.record(captureSend, &cc.sent, p[:n])
+	return n, err
+}
+
+func (cc *captureConn) record(dir string, wp *wireParser, p []byte) {
+	if len(p) == 0 || atomic.LoadInt32(&cc.framing) == 0 {
+		return
+	}
+
+	cc.mu.Lock()
+	defer cc.mu.Unlock()
+	wp.parse(p, func(frame []byte) {
+		cc.capture.write(CaptureRecord{Time: time.Now(), Conn: cc.id, Dir: dir, Frame: frame})
+	})
+}
+
+func (cc *captureConn) startFraming(sc *SecureConn) {
+	if cc.capture.Keys {
+		sc.writer.keyed = func() { cc.recordKey(captureSend, &sc.writer.key, sc.writer.suite) }
+		sc.reader.keyed = func() { cc.recordKey(captureRecv, &sc.reader.key, sc.reader.suite) }
+		sc.writer.keyed()
+		sc.reader.keyed()
+	}
+
+	atomic.StoreInt32(&cc.framing, 1)
+	if fc, ok := cc.Conn.(framedConn); ok {
+		fc.startFraming(sc)
+	}
+}
+
+func (cc *captureConn) recordKey(dir string, key *[32]byte, suite CipherSuite) {
+	cc.capture.write(CaptureRecord{Time: time.Now(), Conn: cc.id, Dir: dir, Key: key[:], Cipher: suite.String()})
+}
+
+// ReadCapture reads the records of a Capture from r.
+func ReadCapture(r io.Reader) ([]CaptureRecord, error) {
+	var records []CaptureRecord
+	dec := json.NewDecoder(r)
+	for {
+		var record CaptureRecord
+		if err := dec.Decode(&record); err == io.EOF {
+			return records, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("read capture record %d: %w", len(records)+1, err)
+		}
+		records = append(records, record)
+	}
+}
+
+// Replay feeds the frames captured in one direction of a connection
+// back through a SecureReader, calling fn with each message it reads,
+// to reproduce offline what the reader made of them. conn and dir
+// select the connection and direction as in CaptureRecord. The capture
+// must have been made with Keys set. Replay returns nil once the frames
+// run out or a close frame is read, and otherwise the error reading a
+// message failed with, or that fn returned.
+func Replay(records []CaptureRecord, conn int64, dir string, fn func(msg []byte) error) error {
+	src := &replaySource{}
+	for _, record := range records {
+		if record.Conn == conn && record.Dir == dir {
+			src.records = append(src.records, record)
+		}
+	}
+	if len(src.records) == 0 || src.records[0].Key == nil {
+		return fmt.Errorf("replay %s of connection %d: %w", dir, conn, ErrNoCaptureKeys)
+	}
+
+	src.sr = &SecureReader{Reader: src, replayed: true}
+	for {
+		msg, err := src.sr.ReadMsg()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+}
+
+// A replaySource supplies a replayed SecureReader with captured frames,
+// switching its key between them as the capture did.
+type replaySource struct {
+	sr      *SecureReader
+	records []CaptureRecord
+	frame   bytes.Reader
+}
+
+func (rs *replaySource) Read(p []byte) (int, error) {
+	for rs.frame.Len() == 0 {
+		if len(rs.records) == 0 {
+			return 0, io.EOF
+		}
+		record := rs.records[0]
+		rs.records = rs.records[1:]
+
+		if record.Key == nil {
+			rs.frame.Reset(record.Frame)
+			continue
+		}
+		if len(record.Key) != len(rs.sr.key) {
+			return 0, fmt.Errorf("captured key of %d bytes, expected %d", len(record.Key), len(rs.sr.key))
+		}
+		suite, err := ParseCipherSuite(record.Cipher)
+		if err != nil {
+			return 0, err
+		}
+		// The reader only reads from us between frames, so the key
+		// changes just where it did on the captured connection.
+		copy(rs.sr.key[:], record.Key)
+		rs.sr.suite = suite
+		rs.sr.aead.wipe()
+		rs.sr.keyFrames = 0
+	}
+
+	return rs.frame.Read(p)
+}
@@ -0,0 +1,125 @@
+package securecomm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+// captureSession sends messages to a server that echoes them whole over
+// a connection recorded to a capture, rekeying after every frame, and
+// returns the capture's records.
+func captureSession(t *testing.T, keys bool, messages ...[]byte) []CaptureRecord {
+	addr := serveHandler(t, func(ctx context.Context, conn *SecureConn) error {
+		for {
+			message, err := conn.ReadMsg()
+			if err != nil {
+				return err
+			}
+			if err := conn.WriteMsg(message); err != nil {
+				return err
+			}
+		}
+	})
+
+	var out lockedBuffer
+	conn, err := Dial(addr, WithCapture(&Capture{W: &out, Keys: keys}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetRekeyPolicy(RekeyPolicy{Frames: 1})
+	for _, message := range messages {
+		if err := conn.WriteMsg(message); err != nil {
+			t.Fatal(err)
+		}
+		if reply, err := conn.ReadMsg(); err != nil || !bytes.Equal(reply, message) {
+			t.Fatalf("Unexpected echo of %d bytes, %v", len(reply), err)
+		}
+	}
+	conn.Close()
+
+	records, err := ReadCapture(strings.NewReader(out.String()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return records
+}
+
+// replayed returns the messages Replay reads from one direction of the
+// first connection in records.
+func replayed(records []CaptureRecord, dir string) ([][]byte, error) {
+	var messages [][]byte
+	err := Replay(records, 1, dir, func(msg []byte) error {
+		messages = append(messages, append([]byte(nil), msg...))
+		return nil
+	})
+	return messages, err
+}
+
+func TestCaptureReplay(t *testing.T) {
+	sent := [][]byte{[]byte("one"), bytes.Repeat([]byte("two"), DefaultMaxMessageSize), []byte("three")}
+	records := captureSession(t, true, sent...)
+
+	var keys int
+	for _, record := range records {
+		if record.Key != nil {
+			keys++
+		}
+	}
+	if keys < 2+len(sent) {
+		t.Fatalf("Expected the capture to follow the rekeys, got %d keys", keys)
+	}
+
+	for _, dir := range []string{captureSend, captureRecv} {
+		messages, err := replayed(records, dir)
+		if err != nil {
+			t.Fatalf("Replaying %s: %v", dir, err)
+		}
+		// The handshake's transcript comes first.
+		if len(messages) != 1+len(sent) {
+			t.Fatalf("Replaying %s read %d messages, expected %d", dir, len(messages), 1+len(sent))
+		}
+		for i, message := range sent {
+			if !bytes.Equal(messages[1+i], message) {
+				t.Fatalf("Replaying %s read message %d of %d bytes, expected %d", dir, i, len(messages[1+i]), len(message))
+			}
+		}
+	}
+}
+
+func TestReplayTamperedFrame(t *testing.T) {
+	records := captureSession(t, true, []byte("one"), []byte("two"))
+
+	var frame int64
+	for i, record := range records {
+		if record.Dir != captureRecv || record.Frame == nil {
+			continue
+		}
+		if frame == 2 {
+			records[i].Frame[len(record.Frame)-1] ^= 1
+			break
+		}
+		frame++
+	}
+
+	_, err := replayed(records, captureRecv)
+	var decryptErr *DecryptError
+	if !errors.As(err, &decryptErr) || decryptErr.Frame != 2 {
+		t.Fatalf("Expected replay to fail to decrypt frame 2, got %v", err)
+	}
+}
+
+func TestReplayWithoutKeys(t *testing.T) {
+	records := captureSession(t, false, []byte("one"))
+	for _, record := range records {
+		if record.Key != nil {
+			t.Fatal("Expected no keys in the capture")
+		}
+	}
+
+	if _, err := replayed(records, captureSend); !errors.Is(err, ErrNoCaptureKeys) {
+		t.Fatalf("Expected ErrNoCaptureKeys, got %v", err)
+	}
+}
@@ -0,0 +1,295 @@
+package securecomm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	mathrand "math/rand"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// errChaosReset is what a chaosConn fails with once it resets its
+// connection.
+var errChaosReset = errors.New("chaos: connection reset")
+
+// A chaosConfig says how a chaosConn mistreats the connection it wraps.
+// Its choices are drawn from a source seeded with Seed, so that a run
+// that fails can be replayed.
+type chaosConfig struct {
+	Seed int64
+
+	// Latency delays each write, and Jitter by up to that much more.
+	Latency, Jitter time.Duration
+
+	// MaxChunk, if positive, cuts reads and writes into pieces of a
+	// random size up to that many bytes, so that frames arrive in as
+	// many reads as it takes.
+	MaxChunk int
+
+	// ResetWithin, if positive, resets the connection once a number of
+	// bytes drawn at random from 1 to ResetWithin have been written to
+	// it.
+	ResetWithin int64
+}
+
+// chaosConn is a connection that delivers what is written to it late,
+// in pieces, and, if its config says so, not at all past a point.
+type chaosConn struct {
+	net.Conn
+	cfg chaosConfig
+
+	// resetAt is how many bytes are written before the reset, zero for
+	// none.
+	resetAt int64
+
+	// mu guards rand, which is not safe for concurrent use, and written.
+	mu      sync.Mutex
+	rand    *mathrand.Rand
+	written int64
+}
+
+func newChaosConn(conn net.Conn, cfg chaosConfig, n int64) *chaosConn {
+	c := &chaosConn{Conn: conn, cfg: cfg, rand: mathrand.New(mathrand.NewSource(cfg.Seed + n))}
+	if cfg.ResetWithin > 0 {
+		c.resetAt = 1 + c.rand.Int63n(cfg.ResetWithin)
+	}
+
+	return c
+}
+
+// chunk returns how many of n bytes to pass on at once.
+func (c *chaosConn) chunk(n int) int {
+	if c.cfg.MaxChunk <= 0 || n <= 1 {
+		return n
+	}
+	if n > c.cfg.MaxChunk {
+		n = c.cfg.MaxChunk
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return 1 + c.rand.Intn(n)
+}
+
+// delay returns how long to hold back the next write.
+func (c *chaosConn) delay() time.Duration {
+	if c.cfg.Jitter <= 0 {
+		return c.cfg.Latency
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.cfg.Latency + time.Duration(c.rand.Int63n(int64(c.cfg.Jitter)))
+}
+
+// allow returns how many of n bytes may be written before the reset, and
+// whether the reset comes after them.
+func (c *chaosConn) allow(n int) (int, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.resetAt > 0 && c.written+int64(n) >= c.resetAt {
+		allowed := int(c.resetAt - c.written)
+		c.written = c.resetAt
+		return allowed, true
+	}
+	c.written += int64(n)
+
+	return n, false
+}
+
+func (c *chaosConn) Read(b []byte) (int, error) {
+	return c.Conn.Read(b[:c.chunk(len(b))])
+}
+
+func (c *chaosConn) Write(b []byte) (int, error) {
+	if d := c.delay(); d > 0 {
+		time.Sleep(d)
+	}
+
+	written := 0
+	for len(b) > 0 {
+		allowed, reset := c.allow(c.chunk(len(b)))
+		n, err := c.Conn.Write(b[:allowed])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		if reset {
+			c.reset()
+			return written, errChaosReset
+		}
+		b = b[n:]
+	}
+
+	return written, nil
+}
+
+// reset drops the connection abruptly, with a TCP reset if it can.
+func (c *chaosConn) reset() {
+	if tc, ok := c.Conn.(*net.TCPConn); ok {
+		tc.SetLinger(0)
+	}
+	c.Conn.Close()
+}
+
+// chaosTransport is a Transport dialing TCP connections that each
+// mistreat traffic as cfg says, with a seed of their own.
+type chaosTransport struct {
+	cfg   chaosConfig
+	dials int64
+}
+
+func (t *chaosTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	return newChaosConn(conn, t.cfg, atomic.AddInt64(&t.dials, 1)), nil
+}
+
+// chaosListener accepts connections that each mistreat traffic as cfg
+// says, with a seed of their own.
+type chaosListener struct {
+	net.Listener
+	cfg     chaosConfig
+	accepts int64
+}
+
+func (l *chaosListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+
+	return newChaosConn(conn, l.cfg, atomic.AddInt64(&l.accepts, 1)), nil
+}
+
+// startChaosServer starts an echo server whose connections mistreat
+// traffic as cfg says, and returns its address.
+func startChaosServer(t *testing.T, cfg chaosConfig, opts ...Option) string {
+	l := testutil.Listen(t)
+	t.Cleanup(func() { l.Close() })
+	go Serve(&chaosListener{Listener: l, cfg: cfg}, nil, opts...)
+
+	return l.Addr().String()
+}
+
+func TestChaosFraming(t *testing.T) {
+	for seed := int64(1); seed <= 3; seed++ {
+		cfg := chaosConfig{Seed: seed, Latency: time.Millisecond, Jitter: 2 * time.Millisecond, MaxChunk: 7}
+		addr := startChaosServer(t, cfg)
+
+		d := Dialer{Transport: &chaosTransport{cfg: cfg}}
+		conn, err := d.Dial(addr)
+		if err != nil {
+			t.Fatalf("seed %d: %v", seed, err)
+		}
+		conn.SetDeadline(time.Now().Add(30 * time.Second))
+
+		// Each frame is cut into pieces on the way there and back.
+		for _, size := range []int{1, 100, DefaultMaxMessageSize} {
+			message := bytes.Repeat([]byte{byte(size)}, size)
+			if err := conn.WriteMsg(message); err != nil {
+				t.Fatalf("seed %d: %v", seed, err)
+			}
+			echo, err := conn.ReadMsg()
+			if err != nil {
+				t.Fatalf("seed %d: %v", seed, err)
+			}
+			if !bytes.Equal(echo, message) {
+				t.Fatalf("seed %d: echo of a %d byte message came back as %d bytes", seed, size, len(echo))
+			}
+		}
+		conn.Close()
+	}
+}
+
+func TestChaosKeepalive(t *testing.T) {
+	cfg := chaosConfig{Seed: 1, Latency: 2 * time.Millisecond, Jitter: 5 * time.Millisecond, MaxChunk: 3}
+	addr := startChaosServer(t, cfg)
+
+	clock := newFakeClock()
+	d := Dialer{Transport: &chaosTransport{cfg: cfg}}
+	conn, err := d.Dial(addr, WithClock(clock), WithKeepalive(KeepalivePolicy{Interval: time.Minute, MaxMissed: 2}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// Pings and pongs delayed and cut into pieces still keep an idle
+	// connection up.
+	echoes := make(chan error, 1)
+	go func() {
+		message, err := conn.ReadMsg()
+		if err == nil && string(message) != "still here" {
+			err = errors.New("unexpected echo " + string(message))
+		}
+		echoes <- err
+	}()
+
+	for i := 0; i < 10; i++ {
+		clock.waitTimers(t, 1)
+		clock.Advance(time.Minute)
+		clock.waitTimers(t, 1)
+		waitPong(t, conn)
+	}
+	if err := conn.WriteMsg([]byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-echoes; err != nil {
+		t.Fatalf("Expected a slow but live connection to survive, got %v", err)
+	}
+}
+
+func TestChaosReset(t *testing.T) {
+	addr := startChaosServer(t, chaosConfig{Seed: 1, MaxChunk: 64})
+
+	// Each connection is reset within a few messages, at a point of its
+	// own, often part way through one of them or the handshake.
+	transport := &chaosTransport{cfg: chaosConfig{Seed: 1, MaxChunk: 64, ResetWithin: 2000}}
+	d := Dialer{Transport: transport}
+	p := ReconnectPolicy{InitialDelay: time.Millisecond, MaxDelay: 10 * time.Millisecond}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	echoed := 0
+	err := p.Run(ctx, func(ctx context.Context) (*SecureConn, error) {
+		return d.DialContext(ctx, addr)
+	}, func(sc *SecureConn) error {
+		sc.SetDeadline(time.Now().Add(5 * time.Second))
+		for {
+			message := bytes.Repeat([]byte{byte(echoed)}, 300)
+			if err := sc.WriteMsg(message); err != nil {
+				return err
+			}
+			echo, err := sc.ReadMsg()
+			if err != nil {
+				return err
+			}
+			if !bytes.Equal(echo, message) {
+				t.Errorf("Echo %d came back corrupted", echoed)
+			}
+			if echoed++; echoed == 20 {
+				cancel()
+				return nil
+			}
+		}
+	})
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected the context's error, got %v", err)
+	}
+	if dials := atomic.LoadInt64(&transport.dials); dials < 3 {
+		t.Fatalf("Expected resets to force several dials, got %d", dials)
+	}
+}
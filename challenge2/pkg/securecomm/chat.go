@@ -0,0 +1,72 @@
+package securecomm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// Chat lets the person at term converse with the peer. Each line they
+// type is sent as a message, while the peer's messages are shown as they
+// arrive, stamped with the time. term is driven as a terminal, with line
+// editing and history, so a real one should be in raw mode. Chat returns
+// when either side ends the conversation, half-closing conn if it is
+// this one.
+func Chat(conn *SecureConn, term io.ReadWriter) error {
+	t := terminal.NewTerminal(term, "> ")
+	errs := make(chan error, 2)
+
+	go func() {
+		for {
+			message, err := conn.ReadMsg()
+			if err == io.EOF {
+				fmt.Fprintln(t, "* the other side left")
+				errs <- nil
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			fmt.Fprintf(t, "[%s] %s\n", time.Now().Format("15:04:05"), printable(message))
+		}
+	}()
+
+	go func() {
+		for {
+			line, err := t.ReadLine()
+			if err == io.EOF {
+				errs <- conn.CloseWrite()
+				return
+			}
+			if err != nil {
+				errs <- err
+				return
+			}
+			if line == "" {
+				continue
+			}
+			if err := conn.WriteMsg([]byte(line)); err != nil {
+				errs <- err
+				return
+			}
+		}
+	}()
+
+	return <-errs
+}
+
+// printable drops the control characters from a peer's message, so that
+// it cannot send escape sequences to our terminal.
+func printable(message []byte) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) && r != '\t' {
+			return -1
+		}
+		return r
+	}, string(message))
+}
@@ -0,0 +1,60 @@
+package securecomm
+
+import (
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChat(t *testing.T) {
+	client, server, err := testPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	keys, typing := io.Pipe()
+	var screen lockedBuffer
+	done := make(chan error, 1)
+	go func() {
+		done <- Chat(client, struct {
+			io.Reader
+			io.Writer
+		}{keys, &screen})
+	}()
+
+	// Lines are sent as they are entered, after any editing.
+	if _, err := io.WriteString(typing, "hellp\x7fo\r"); err != nil {
+		t.Fatal(err)
+	}
+	if message, err := server.ReadMsg(); err != nil || string(message) != "hello" {
+		t.Fatalf("Server got %q, %v", message, err)
+	}
+
+	// Messages arrive while a line is being typed, without their
+	// control characters.
+	if _, err := io.WriteString(typing, "half a li"); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WriteMsg([]byte("hi \x1b[2Jthere")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(screen.String(), "] hi [2Jthere") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Message not shown, screen is %q", screen.String())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	// Ending the input ends the conversation.
+	typing.Close()
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := server.ReadMsg(); err != io.EOF {
+		t.Fatalf("Expected the server to see the end of the conversation, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package securecomm
+
+import (
+	"crypto/cipher"
+	"fmt"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// A CipherSuite is the authenticated encryption frames are sealed with.
+// Every suite uses 24 byte nonces and adds box.Overhead bytes to each
+// frame, so the framing is the same whichever one the handshake picks.
+type CipherSuite byte
+
+const (
+	// CipherNaClBox seals frames with nacl/box, XSalsa20-Poly1305. It
+	// is the default and the only suite older peers speak.
+	CipherNaClBox CipherSuite = iota
+
+	// CipherXChaCha20Poly1305 seals frames with the XChaCha20-Poly1305
+	// AEAD, which has fast implementations on more platforms.
+	CipherXChaCha20Poly1305
+)
+
+func (s CipherSuite) String() string {
+	switch s {
+	case CipherNaClBox:
+		return "nacl-box"
+	case CipherXChaCha20Poly1305:
+		return "xchacha20-poly1305"
+	default:
+		return fmt.Sprintf("CipherSuite(%d)", byte(s))
+	}
+}
+
+// ParseCipherSuite returns the suite with the given name, as returned by
+// CipherSuite.String.
+func ParseCipherSuite(name string) (CipherSuite, error) {
+	for _, s := range []CipherSuite{CipherNaClBox, CipherXChaCha20Poly1305} {
+		if s.String() == name {
+			return s, nil
+		}
+	}
+
+	return 0, fmt.Errorf("unknown cipher suite %q", name)
+}
+
+// negotiatedSuite returns the suite the negotiated features select.
+func negotiatedSuite(features uint32) CipherSuite {
+	if features&featureXChaCha20Poly1305 != 0 {
+		return CipherXChaCha20Poly1305
+	}
+
+	return CipherNaClBox
+}
+
+// seal appends the sealed plaintext to out. aead caches the AEAD the
+// suite needs for key.
+func (s CipherSuite) seal(out, plaintext []byte, nonce *[nonceSize]byte, key *[32]byte, aead *aeadCache) []byte {
+	if s == CipherXChaCha20Poly1305 {
+		return aead.get(key).Seal(out, nonce[:], plaintext, nil)
+	}
+
+	return box.SealAfterPrecomputation(out, plaintext, nonce, key)
+}
+
+// open appends the opened sealed box to out, reporting whether it was
+// authentic. aead caches the AEAD the suite needs for key.
+func (s CipherSuite) open(out, sealed []byte, nonce *[nonceSize]byte, key *[32]byte, aead *aeadCache) ([]byte, bool) {
+	if s == CipherXChaCha20Poly1305 {
+		plaintext, err := aead.get(key).Open(out, nonce[:], sealed, nil)
+		return plaintext, err == nil
+	}
+
+	return box.OpenAfterPrecomputation(out, sealed, nonce, key)
+}
+
+// An aeadCache holds the AEAD made for the last key it was asked for,
+// since making one for every frame is costly. The zero aeadCache is
+// empty.
+type aeadCache struct {
+	key  [32]byte
+	aead cipher.AEAD
+}
+
+func (c *aeadCache) get(key *[32]byte) cipher.AEAD {
+	if c.aead == nil || c.key != *key {
+		// NewX only fails for keys of the wrong size.
+		aead, err := chacha20poly1305.NewX(key[:])
+		if err != nil {
+			panic(err)
+		}
+		c.key, c.aead = *key, aead
+	}
+
+	return c.aead
+}
@@ -0,0 +1,84 @@
+package securecomm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestCipherSuiteReadWriter(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	secureW.suite = CipherXChaCha20Poly1305
+	if err := secureW.WriteMsg([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+
+	secureR := NewSecureReader(bytes.NewReader(frame), priv, pub)
+	secureR.suite = CipherXChaCha20Poly1305
+	if message, err := secureR.ReadMsg(); err != nil || string(message) != "hello world" {
+		t.Fatalf("Unexpected result: %q, %v", message, err)
+	}
+
+	// A reader expecting the other suite must not accept the frame.
+	secureR = NewSecureReader(bytes.NewReader(frame), priv, pub)
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("Expected a nacl/box reader to reject an XChaCha20-Poly1305 frame, got %v", err)
+	}
+}
+
+func TestCipherSuiteNegotiation(t *testing.T) {
+	tests := []struct {
+		name           string
+		client, server CipherSuite
+		expected       CipherSuite
+	}{
+		{"default", CipherNaClBox, CipherNaClBox, CipherNaClBox},
+		{"both", CipherXChaCha20Poly1305, CipherXChaCha20Poly1305, CipherXChaCha20Poly1305},
+		{"client only", CipherXChaCha20Poly1305, CipherNaClBox, CipherNaClBox},
+		{"server only", CipherNaClBox, CipherXChaCha20Poly1305, CipherNaClBox},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := testutil.Listen(t)
+			go Serve(l, nil, WithCipherSuite(tt.server))
+
+			conn, err := Dial(l.Addr().String(), WithCipherSuite(tt.client))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if got := conn.CipherSuite(); got != tt.expected {
+				t.Fatalf("Negotiated %s, expected %s", got, tt.expected)
+			}
+
+			if _, err := conn.Write([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			buf := make([]byte, 4)
+			if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+				t.Fatalf("Unexpected echo: %q, %v", buf, err)
+			}
+		})
+	}
+}
+
+func TestParseCipherSuite(t *testing.T) {
+	for _, s := range []CipherSuite{CipherNaClBox, CipherXChaCha20Poly1305} {
+		if got, err := ParseCipherSuite(s.String()); err != nil || got != s {
+			t.Errorf("ParseCipherSuite(%q) = %v, %v", s, got, err)
+		}
+	}
+
+	if _, err := ParseCipherSuite("rot13"); err == nil {
+		t.Error("Expected an unknown suite to fail")
+	}
+}
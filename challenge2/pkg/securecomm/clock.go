@@ -0,0 +1,57 @@
+package securecomm
+
+import "time"
+
+// A Clock tells the time and makes timers for a SecureConn's keepalive
+// pings, idle timeout and rekey interval, and for what servers and
+// relays time by it: rate limits, mail expiry, audit entries and the
+// durations hooks and logs report. Tests can drive all of them with a
+// fake clock instead of waiting. Deadlines set on the underlying
+// net.Conn, such as the handshake timeouts, follow the system clock
+// whatever the Clock.
+type Clock interface {
+	Now() time.Time
+	NewTimer(d time.Duration) Timer
+}
+
+// A Timer made by a Clock sends the time on C once it fires, as a
+// time.Timer does.
+type Timer interface {
+	C() <-chan time.Time
+	Stop() bool
+	Reset(d time.Duration) bool
+}
+
+// systemClock is the Clock of the time package.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time { return time.Now() }
+
+func (systemClock) NewTimer(d time.Duration) Timer { return systemTimer{time.NewTimer(d)} }
+
+// systemTimer is a time.Timer as a Timer.
+type systemTimer struct{ *time.Timer }
+
+func (t systemTimer) C() <-chan time.Time { return t.Timer.C }
+
+// clockOr returns c, or the system clock when it is nil.
+func clockOr(c Clock) Clock {
+	if c != nil {
+		return c
+	}
+
+	return systemClock{}
+}
+
+func (cfg config) now() time.Time { return clockOr(cfg.clock).Now() }
+
+func (sr *SecureReader) now() time.Time { return clockOr(sr.clock).Now() }
+
+func (sw *SecureWriter) now() time.Time { return clockOr(sw.clock).Now() }
+
+// sleep waits on clock until t.
+func sleep(clock Clock, t time.Time) {
+	if d := t.Sub(clock.Now()); d > 0 {
+		<-clock.NewTimer(d).C()
+	}
+}
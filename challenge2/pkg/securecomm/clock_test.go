@@ -0,0 +1,229 @@
+package securecomm
+
+import (
+	"errors"
+	"runtime"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock that only moves when told to, so that tests of
+// timing run the same way every time and take no time at all.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) NewTimer(d time.Duration) Timer {
+	t := &fakeTimer{clock: c, c: make(chan time.Time, 1)}
+	c.mu.Lock()
+	c.timers = append(c.timers, t)
+	c.mu.Unlock()
+	t.Reset(d)
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers due by then.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	for _, t := range c.timers {
+		if t.active && !t.when.After(c.now) {
+			t.fireLocked()
+		}
+	}
+}
+
+// waitTimers waits until n timers are pending, which is how a test
+// knows that the goroutines it is driving have caught up with the
+// clock.
+func (c *fakeClock) waitTimers(t *testing.T, n int) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; runtime.Gosched() {
+		c.mu.Lock()
+		var pending int
+		for _, timer := range c.timers {
+			if timer.active {
+				pending++
+			}
+		}
+		c.mu.Unlock()
+		if pending == n {
+			return
+		}
+	}
+	t.Fatalf("Timed out waiting for %d pending timers", n)
+}
+
+// fakeTimer is a Timer of a fakeClock.
+type fakeTimer struct {
+	clock  *fakeClock
+	c      chan time.Time
+	when   time.Time
+	active bool
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.c }
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.active = false
+	return active
+}
+
+func (t *fakeTimer) Reset(d time.Duration) bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	active := t.active
+	t.when, t.active = t.clock.now.Add(d), true
+	if d <= 0 {
+		t.fireLocked()
+	}
+	return active
+}
+
+func (t *fakeTimer) fireLocked() {
+	t.active = false
+	select {
+	case t.c <- t.clock.now:
+	default:
+	}
+}
+
+// waitErr waits for f to fail, as it does once a goroutine the test
+// drove through the clock closed the connection.
+func waitErr(t *testing.T, f func() error) error {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; runtime.Gosched() {
+		if err := f(); err != nil {
+			return err
+		}
+	}
+	t.Fatal("Timed out waiting for an error")
+	return nil
+}
+
+func TestSimulatedKeepalive(t *testing.T) {
+	clock := newFakeClock()
+	client, server, err := testPipe(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// The server never reads, so no ping is answered.
+	client.SetKeepalivePolicy(KeepalivePolicy{Interval: time.Minute, MaxMissed: 2})
+	for i := 0; i < 2; i++ {
+		clock.waitTimers(t, 1)
+		clock.Advance(time.Minute)
+	}
+	clock.waitTimers(t, 1)
+	if err := client.WriteMsg([]byte("still here")); err != nil {
+		t.Fatalf("Expected the connection to survive two missed pings, got %v", err)
+	}
+
+	clock.Advance(time.Minute)
+	err = waitErr(t, func() error { return client.WriteMsg([]byte("hello?")) })
+	if !errors.Is(err, ErrPeerUnresponsive) {
+		t.Fatalf("Expected ErrPeerUnresponsive, got %v", err)
+	}
+	if _, err := client.ReadMsg(); !errors.Is(err, ErrPeerUnresponsive) {
+		t.Fatalf("Expected reads to fail with ErrPeerUnresponsive too, got %v", err)
+	}
+}
+
+func TestSimulatedIdlePolicy(t *testing.T) {
+	clock := newFakeClock()
+	client, server, err := testPipe(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	messages := make(chan error)
+	go func() {
+		for {
+			_, err := server.ReadMsg()
+			messages <- err
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	server.SetIdlePolicy(IdlePolicy{Read: time.Hour})
+	clock.waitTimers(t, 1)
+
+	// A frame just before the hour is up starts it again.
+	clock.Advance(59 * time.Minute)
+	if err := client.WriteMsg([]byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-messages; err != nil {
+		t.Fatal(err)
+	}
+	clock.Advance(2 * time.Minute)
+	clock.waitTimers(t, 1)
+	if err := server.WriteMsg([]byte("hello")); err != nil {
+		t.Fatalf("Expected the connection to stay open after a frame, got %v", err)
+	}
+
+	clock.Advance(58 * time.Minute)
+	err = waitErr(t, func() error { return server.WriteMsg([]byte("hello?")) })
+	if !errors.Is(err, ErrIdleTimeout) {
+		t.Fatalf("Expected ErrIdleTimeout, got %v", err)
+	}
+}
+
+func TestSimulatedRekeyInterval(t *testing.T) {
+	clock := newFakeClock()
+	client, server, err := testPipe(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	client.SetRekeyPolicy(RekeyPolicy{Interval: time.Hour})
+	send := func(message string) [32]byte {
+		t.Helper()
+		if err := client.WriteMsg([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		if got, err := server.ReadMsg(); err != nil || string(got) != message {
+			t.Fatalf("Unexpected message %q, %v", got, err)
+		}
+		return client.writer.key
+	}
+
+	first := send("one")
+	clock.Advance(59 * time.Minute)
+	if send("two") != first {
+		t.Fatal("Expected no rekey within the interval")
+	}
+	clock.Advance(time.Minute)
+	if send("three") == first {
+		t.Fatal("Expected a rekey once the interval passed")
+	}
+
+	if elapsed := client.Stats().Elapsed; elapsed != time.Hour {
+		t.Fatalf("Expected the connection to be an hour old, got %v", elapsed)
+	}
+}
@@ -0,0 +1,184 @@
+package securecomm
+
+import (
+	"bytes"
+	"compress/flate"
+	"fmt"
+	"io"
+)
+
+// Compressed frames hold their payload compressed with the algorithm
+// the handshake chose: a raw DEFLATE stream unless both peers offered a
+// Compressor for Snappy or Zstandard. Each frame is compressed on its
+// own, so the reader never needs an earlier frame to make sense of a
+// later one, and what one message reveals about another through its
+// compressed length is limited to a frame.
+//
+// Compressing before encrypting lets an attacker who can inject data
+// next to a secret learn about the secret from frame lengths, as in
+// CRIME. Compression is therefore off unless asked for with
+// WithCompression.
+
+// A Compression is an algorithm frames can be compressed with.
+type Compression byte
+
+const (
+	// CompressionDeflate compresses frames with DEFLATE. It is built in
+	// and the only algorithm older peers speak.
+	CompressionDeflate Compression = iota
+
+	// CompressionSnappy compresses frames with Snappy, which is much
+	// faster than DEFLATE but compresses less.
+	CompressionSnappy
+
+	// CompressionZstd compresses frames with Zstandard, which is both
+	// faster than DEFLATE and compresses more.
+	CompressionZstd
+)
+
+func (c Compression) String() string {
+	switch c {
+	case CompressionDeflate:
+		return "deflate"
+	case CompressionSnappy:
+		return "snappy"
+	case CompressionZstd:
+		return "zstd"
+	default:
+		return fmt.Sprintf("Compression(%d)", byte(c))
+	}
+}
+
+// A Compressor compresses frame payloads with an algorithm other than
+// DEFLATE. The package has none of its own, so as not to depend on
+// their implementations; the compressbridge module provides Snappy and
+// Zstandard. A Compressor must be safe for concurrent use.
+type Compressor interface {
+	// Compression returns the algorithm it implements.
+	Compression() Compression
+
+	// Compress appends src compressed to dst.
+	Compress(dst, src []byte) ([]byte, error)
+
+	// Decompress appends src decompressed to dst. It must fail, without
+	// producing them, when src holds more than limit bytes.
+	Decompress(dst, src []byte, limit int) ([]byte, error)
+}
+
+// compressionFeatures maps the algorithms with a Compressor to the
+// features that offer them.
+var compressionFeatures = map[Compression]uint32{
+	CompressionSnappy: featureCompressionSnappy,
+	CompressionZstd:   featureCompressionZstd,
+}
+
+// negotiatedCompressor returns the Compressor of compressors for the
+// algorithm the negotiated features select, preferring Zstandard to
+// Snappy, or nil for DEFLATE.
+func negotiatedCompressor(features uint32, compressors []Compressor) Compressor {
+	if features&featureCompression == 0 {
+		return nil
+	}
+
+	for _, algorithm := range []Compression{CompressionZstd, CompressionSnappy} {
+		if features&compressionFeatures[algorithm] == 0 {
+			continue
+		}
+		for _, c := range compressors {
+			if c.Compression() == algorithm {
+				return c
+			}
+		}
+	}
+
+	return nil
+}
+
+// compressor compresses frame payloads, with codec if it is set and
+// otherwise with DEFLATE, reusing its state between frames.
+type compressor struct {
+	codec Compressor
+
+	w   *flate.Writer
+	buf bytes.Buffer
+
+	// out holds what codec compressed.
+	out []byte
+}
+
+// compress returns payload compressed. The result is only valid until
+// the next call.
+func (c *compressor) compress(payload []byte) ([]byte, error) {
+	if c.codec != nil {
+		out, err := c.codec.Compress(c.out[:0], payload)
+		c.out = out
+		return out, err
+	}
+
+	c.buf.Reset()
+	if c.w == nil {
+		w, err := flate.NewWriter(&c.buf, flate.BestSpeed)
+		if err != nil {
+			return nil, err
+		}
+		c.w = w
+	} else {
+		c.w.Reset(&c.buf)
+	}
+
+	if _, err := c.w.Write(payload); err != nil {
+		return nil, err
+	}
+	if err := c.w.Close(); err != nil {
+		return nil, err
+	}
+
+	return c.buf.Bytes(), nil
+}
+
+// decompressor decompresses frame payloads, with codec if it is set and
+// otherwise with DEFLATE, reusing its state between frames.
+type decompressor struct {
+	codec Compressor
+
+	r   io.ReadCloser
+	src bytes.Reader
+	buf bytes.Buffer
+
+	// out holds what codec decompressed.
+	out []byte
+}
+
+// decompress returns payload decompressed, refusing to produce more
+// than limit bytes so that a small frame cannot expand without bound.
+// The result is only valid until the next call.
+func (d *decompressor) decompress(payload []byte, limit int) ([]byte, error) {
+	if d.codec != nil {
+		out, err := d.codec.Decompress(d.out[:0], payload, limit)
+		d.out = out
+		if err != nil {
+			return nil, fmt.Errorf("decompress frame: %w", err)
+		}
+		if len(out) > limit {
+			return nil, fmt.Errorf("decompress frame to more than %d bytes: %w", limit, ErrMessageTooLarge)
+		}
+		return out, nil
+	}
+
+	d.src.Reset(payload)
+	if d.r == nil {
+		d.r = flate.NewReader(&d.src)
+	} else if err := d.r.(flate.Resetter).Reset(&d.src, nil); err != nil {
+		return nil, err
+	}
+
+	d.buf.Reset()
+	if _, err := d.buf.ReadFrom(io.LimitReader(d.r, int64(limit)+1)); err != nil {
+		return nil, fmt.Errorf("decompress frame: %w", err)
+	}
+	if d.buf.Len() > limit {
+		return nil, fmt.Errorf("decompress frame to more than %d bytes: %w", limit, ErrMessageTooLarge)
+	}
+
+	return d.buf.Bytes(), nil
+}
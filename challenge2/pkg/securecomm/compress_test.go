@@ -0,0 +1,182 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestCompressedFrames(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+	logs := []byte(strings.Repeat(`{"level":"info","msg":"request served"}`+"\n", 100))
+	noise := make([]byte, 1000)
+	if _, err := rand.Read(noise); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name     string
+		message  []byte
+		compress bool
+		padding  PaddingPolicy
+		smaller  bool
+	}{
+		{"uncompressed", logs, false, PaddingPolicy{}, false},
+		{"compressed", logs, true, PaddingPolicy{}, true},
+		{"compressed and padded", logs, true, PaddingPolicy{Buckets: []int{1024}}, true},
+		{"incompressible", noise, true, PaddingPolicy{}, false},
+	}
+
+	for _, test := range tests {
+		var buf bytes.Buffer
+		secureW := NewSecureWriter(&buf, priv, pub)
+		secureW.Compress = test.compress
+		secureW.Padding = test.padding
+		if err := secureW.WriteMsg(test.message); err != nil {
+			t.Fatal(err)
+		}
+
+		if smaller := buf.Len() < len(test.message); smaller != test.smaller {
+			t.Errorf("%s: sent %d bytes for a message of %d", test.name, buf.Len(), len(test.message))
+		}
+
+		secureR := NewSecureReader(&buf, priv, pub)
+		if message, err := secureR.ReadMsg(); err != nil || !bytes.Equal(message, test.message) {
+			t.Errorf("%s: unexpected message of %d bytes, %v", test.name, len(message), err)
+		}
+	}
+}
+
+func TestCompressedFrameTooLarge(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	// A megabyte of zeros deflates into a frame well within the
+	// reader's limit, but must not be inflated past it.
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	secureW.MaxMessageSize = 1 << 20
+	secureW.Compress = true
+	if err := secureW.WriteMsg(make([]byte, 1<<20)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.Len() > DefaultMaxMessageSize {
+		t.Fatalf("Expected a small frame, got %d bytes", buf.Len())
+	}
+
+	secureR := NewSecureReader(&buf, priv, pub)
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestCompressionNegotiation(t *testing.T) {
+	tests := []struct {
+		name       string
+		server     []Option
+		client     []Option
+		compressed bool
+	}{
+		{"neither", nil, nil, false},
+		{"client only", nil, []Option{WithCompression()}, false},
+		{"server only", []Option{WithCompression()}, nil, false},
+		{"both", []Option{WithCompression()}, []Option{WithCompression()}, true},
+	}
+
+	for _, test := range tests {
+		l := testutil.Listen(t)
+		go Serve(l, nil, test.server...)
+
+		conn, err := Dial(l.Addr().String(), test.client...)
+		if err != nil {
+			l.Close()
+			t.Fatal(err)
+		}
+		if conn.writer.Compress != test.compressed {
+			t.Errorf("%s: compression is %v", test.name, conn.writer.Compress)
+		}
+
+		message := bytes.Repeat([]byte("compress me "), 100)
+		if err := conn.WriteMsg(message); err != nil {
+			t.Fatal(err)
+		}
+		if echo, err := conn.ReadMsg(); err != nil || !bytes.Equal(echo, message) {
+			t.Errorf("%s: unexpected echo of %d bytes, %v", test.name, len(echo), err)
+		}
+
+		conn.Close()
+		l.Close()
+	}
+}
+
+// rleCompressor is a Compressor standing in for Snappy, run-length
+// encoding payloads as pairs of a count and a byte.
+type rleCompressor struct{}
+
+func (rleCompressor) Compression() Compression { return CompressionSnappy }
+
+func (rleCompressor) Compress(dst, src []byte) ([]byte, error) {
+	for len(src) > 0 {
+		n := 1
+		for n < len(src) && n < 255 && src[n] == src[0] {
+			n++
+		}
+		dst = append(dst, byte(n), src[0])
+		src = src[n:]
+	}
+
+	return dst, nil
+}
+
+func (rleCompressor) Decompress(dst, src []byte, limit int) ([]byte, error) {
+	start := len(dst)
+	for ; len(src) >= 2; src = src[2:] {
+		if len(dst)-start+int(src[0]) > limit {
+			return nil, ErrMessageTooLarge
+		}
+		dst = append(dst, bytes.Repeat(src[1:2], int(src[0]))...)
+	}
+
+	return dst, nil
+}
+
+func TestCompressorNegotiation(t *testing.T) {
+	tests := []struct {
+		name   string
+		server []Compressor
+		client []Compressor
+		want   Compression
+	}{
+		{"server lacks it", nil, []Compressor{rleCompressor{}}, CompressionDeflate},
+		{"client lacks it", []Compressor{rleCompressor{}}, nil, CompressionDeflate},
+		{"both", []Compressor{rleCompressor{}}, []Compressor{rleCompressor{}}, CompressionSnappy},
+	}
+
+	for _, test := range tests {
+		l := testutil.Listen(t)
+		go Serve(l, nil, WithCompression(test.server...))
+
+		conn, err := Dial(l.Addr().String(), WithCompression(test.client...))
+		if err != nil {
+			l.Close()
+			t.Fatal(err)
+		}
+		if got, ok := conn.Compression(); !ok || got != test.want {
+			t.Errorf("%s: compression is %v, %v", test.name, got, ok)
+		}
+
+		message := bytes.Repeat([]byte{'a'}, 5000)
+		if err := conn.WriteMsg(message); err != nil {
+			t.Fatal(err)
+		}
+		if echo, err := conn.ReadMsg(); err != nil || !bytes.Equal(echo, message) {
+			t.Errorf("%s: unexpected echo of %d bytes, %v", test.name, len(echo), err)
+		}
+
+		conn.Close()
+		l.Close()
+	}
+}
@@ -0,0 +1,263 @@
+package securecomm
+
+import (
+	"crypto/ed25519"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A SecureConn is a net.Conn that encrypts everything written to it and
+// decrypts everything read from it. Addresses and deadlines are those of
+// the underlying connection.
+//
+// Any number of goroutines may write to a SecureConn at once; each
+// Write or WriteMsg arrives whole. Reads must come from one goroutine
+// at a time.
+type SecureConn struct {
+	conn   net.Conn
+	reader *SecureReader
+	writer *SecureWriter
+
+	// peer is the public key the peer proved it holds and identified
+	// says whether it is a long-term key rather than one generated for
+	// this connection. version and features are what the handshake
+	// negotiated.
+	peer       *[32]byte
+	identified bool
+	version    byte
+	features   uint32
+
+	// signer is the Ed25519 key the peer signed the handshake with.
+	signer ed25519.PublicKey
+
+	// peerNext is the identity key a server announced it will rotate
+	// to.
+	peerNext *[32]byte
+
+	// resumed says whether the connection resumed an earlier session.
+	// session is the ticket a server issued to us, to resume this
+	// session later.
+	resumed bool
+	session *session
+
+	keepalive keepalive
+	acks      acks
+
+	// established is when the handshake completed, by clock, which
+	// times the connection's pings, idle timeout and rekeys, and
+	// handshakeTime how long it took.
+	established   time.Time
+	clock         Clock
+	handshakeTime time.Duration
+
+	// closing is closed once either end announced that it is about to
+	// close the connection for reaching the end of its LifetimePolicy.
+	closing     chan struct{}
+	closingOnce sync.Once
+
+	// onClose is called the first time the connection is closed.
+	onClose   func()
+	closeOnce sync.Once
+
+	// rejectOnce tears the connection down after the first frame it
+	// rejects.
+	rejectOnce sync.Once
+}
+
+// PeerIdentity returns the long-term public key the peer proved it
+// holds: its static key after a Noise handshake, or its identity key if
+// it presented one during the legacy handshake. ok is false when the
+// peer only used a key generated for this connection.
+func (c *SecureConn) PeerIdentity() (key [32]byte, ok bool) {
+	if !c.identified {
+		return [32]byte{}, false
+	}
+
+	return *c.peer, true
+}
+
+// PeerSigningKey returns the Ed25519 key the peer signed the handshake
+// with. ok is false when the peer did not sign it.
+func (c *SecureConn) PeerSigningKey() (key ed25519.PublicKey, ok bool) {
+	return c.signer, c.signer != nil
+}
+
+// CipherSuite returns the cipher suite the handshake chose for sealing
+// frames.
+func (c *SecureConn) CipherSuite() CipherSuite {
+	return c.writer.suite
+}
+
+// Compression returns the algorithm the handshake chose for compressing
+// frames, and whether it chose to compress them at all.
+func (c *SecureConn) Compression() (Compression, bool) {
+	if c.writer.deflate.codec != nil {
+		return c.writer.deflate.codec.Compression(), c.writer.Compress
+	}
+
+	return CompressionDeflate, c.writer.Compress
+}
+
+// Resumed reports whether the connection resumed an earlier session
+// with a ticket rather than performing a full key exchange.
+func (c *SecureConn) Resumed() bool {
+	return c.resumed
+}
+
+// Read reads and decrypts data from the connection.
+func (c *SecureConn) Read(b []byte) (int, error) {
+	n, err := c.reader.Read(b)
+	return n, c.keepaliveErr(c.reject(err))
+}
+
+// Write encrypts b and writes it to the connection.
+func (c *SecureConn) Write(b []byte) (int, error) {
+	n, err := c.writer.Write(b)
+	return n, c.keepaliveErr(c.exhausted(err))
+}
+
+// ReadFrom sends everything read from r until io.EOF, making io.Copy to
+// the connection skip an intermediate buffer.
+func (c *SecureConn) ReadFrom(r io.Reader) (int64, error) {
+	n, err := c.writer.ReadFrom(r)
+	return n, c.keepaliveErr(c.exhausted(err))
+}
+
+// WriteTo writes everything read from the connection to w until the
+// peer ends the stream, making io.Copy from the connection skip an
+// intermediate buffer.
+func (c *SecureConn) WriteTo(w io.Writer) (int64, error) {
+	n, err := c.reader.WriteTo(w)
+	return n, c.keepaliveErr(c.reject(err))
+}
+
+// ReadMsg reads and decrypts exactly one message sent with WriteMsg (or
+// a single Write), so callers do not have to guess a buffer size.
+func (c *SecureConn) ReadMsg() ([]byte, error) {
+	message, err := c.reader.ReadMsg()
+	return message, c.keepaliveErr(c.reject(err))
+}
+
+// WriteMsg encrypts and writes message so that the peer's ReadMsg
+// returns it whole.
+func (c *SecureConn) WriteMsg(message []byte) error {
+	return c.keepaliveErr(c.exhausted(c.writer.WriteMsg(message)))
+}
+
+// SetMaxMessageSize sets the largest frame payload the connection will
+// send or accept. Zero restores DefaultMaxMessageSize.
+func (c *SecureConn) SetMaxMessageSize(n int) {
+	// The reader's lock is held while it waits for a frame, so the
+	// limit is handed over atomically instead.
+	atomic.StoreInt64(&c.reader.maxSize, int64(maxMessageSize(n)))
+
+	c.writer.mu.Lock()
+	c.writer.MaxMessageSize = n
+	c.writer.mu.Unlock()
+}
+
+// SetRekeyPolicy sets when the connection replaces the key it sends
+// with. The zero RekeyPolicy only rekeys when the key is about to run
+// out of nonces. It has no effect when the peer did not advertise
+// support for rekeying.
+func (c *SecureConn) SetRekeyPolicy(policy RekeyPolicy) {
+	if c.features&featureRekey != 0 {
+		c.writer.mu.Lock()
+		c.writer.Rekey = policy
+		c.writer.mu.Unlock()
+	}
+}
+
+// SetPaddingPolicy sets how the connection pads the frames it sends.
+// The zero PaddingPolicy does not pad. It has no effect when the peer
+// did not advertise support for padded frames.
+func (c *SecureConn) SetPaddingPolicy(policy PaddingPolicy) {
+	if c.features&featurePadding != 0 {
+		c.writer.mu.Lock()
+		c.writer.Padding = policy
+		c.writer.mu.Unlock()
+	}
+}
+
+// CloseWrite shuts down the writing side of the connection. The peer
+// reads io.EOF once it has read everything sent before, while we can
+// still read what it sends back. When the peer understands close
+// frames, the end of the stream is authenticated with one.
+func (c *SecureConn) CloseWrite() error {
+	if c.features&featureClose != 0 {
+		if err := c.writer.Close(); err != nil {
+			return err
+		}
+	} else {
+		c.writer.mu.Lock()
+		c.writer.closed = true
+		c.writer.mu.Unlock()
+	}
+
+	if cw, ok := c.conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return nil
+}
+
+// peerFingerprint returns the fingerprint of the peer's identity key,
+// or "none" if it has none, for logging.
+func (c *SecureConn) peerFingerprint() string {
+	if identity, ok := c.PeerIdentity(); ok {
+		return Fingerprint(identity)
+	}
+
+	return "none"
+}
+
+// bytesTransferred returns how many bytes of frames the connection has
+// read and written since the handshake.
+func (c *SecureConn) bytesTransferred() (in, out int64) {
+	return atomic.LoadInt64(&c.reader.bytes), atomic.LoadInt64(&c.writer.bytes)
+}
+
+// Close stops any keepalive pings and idle timeout, closes the
+// underlying connection and wipes the connection's keys and the
+// plaintext it holds.
+func (c *SecureConn) Close() error {
+	c.stopTimers()
+	err := c.conn.Close()
+	c.reader.wipe()
+	c.writer.wipe()
+	if c.onClose != nil {
+		c.closeOnce.Do(c.onClose)
+	}
+
+	return err
+}
+
+// LocalAddr returns the local network address.
+func (c *SecureConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *SecureConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the underlying
+// connection.
+func (c *SecureConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying connection.
+func (c *SecureConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the underlying
+// connection.
+func (c *SecureConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
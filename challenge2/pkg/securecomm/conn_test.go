@@ -0,0 +1,274 @@
+package securecomm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Make sure SecureConn can be used anywhere a net.Conn is expected.
+var _ net.Conn = (*SecureConn)(nil)
+
+func TestSecureConn(t *testing.T) {
+	l := testutil.Listen(t)
+
+	go Serve(l, nil)
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if got := conn.RemoteAddr().String(); got != l.Addr().String() {
+		t.Errorf("Unexpected remote address: %s != %s", got, l.Addr())
+	}
+	if conn.LocalAddr() == nil {
+		t.Error("Expected a local address")
+	}
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got != "ping" {
+		t.Fatalf("Unexpected echo: %q", got)
+	}
+
+	// Nothing else is coming, so a read deadline must fire.
+	if err := conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond)); err != nil {
+		t.Fatal(err)
+	}
+	var netErr net.Error
+	if _, err := conn.Read(buf); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Expected a timeout error, got %v", err)
+	}
+}
+
+func TestSecureConnMessages(t *testing.T) {
+	l := testutil.Listen(t)
+
+	go Serve(l, nil)
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	messages := []string{"one", "a much longer second message"}
+	for _, message := range messages {
+		if err := conn.WriteMsg([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Read part of the first echo as a stream, then switch to messages.
+	buf := make([]byte, 2)
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	rest, err := conn.ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(buf) + string(rest); got != messages[0] {
+		t.Fatalf("Unexpected first message: %q", got)
+	}
+
+	second, err := conn.ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(second) != messages[1] {
+		t.Fatalf("Unexpected second message: %q", second)
+	}
+}
+
+func TestSecureConnRejectsReflection(t *testing.T) {
+	l := testutil.Listen(t)
+
+	servers := make(chan *SecureConn, 1)
+	go func() {
+		defer close(servers)
+
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		pub, priv, err := box.GenerateKey(rand.Reader)
+		if err != nil {
+			return
+		}
+
+		if server, err := handshake(conn, pub, priv, true, config{}); err == nil {
+			servers <- server
+		}
+	}()
+
+	client, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	server := <-servers
+	if server == nil {
+		t.Fatal("server handshake failed")
+	}
+	defer server.Close()
+
+	// Capture what the client puts on the wire, then reflect it back.
+	var sent bytes.Buffer
+	client.writer.Writer = &sent
+	if err := client.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Both readers pick up the sequence where the handshake left it.
+	reflected := newSecureReader(bytes.NewReader(sent.Bytes()), &client.reader.key, nil)
+	reflected.seq = client.writer.seq - 1
+	if _, err := reflected.ReadMsg(); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatal("Expected a reflected frame to be rejected")
+	}
+
+	// The server, reading the client's direction, accepts it.
+	forwarded := newSecureReader(bytes.NewReader(sent.Bytes()), &server.reader.key, nil)
+	forwarded.seq = server.reader.seq
+	message, err := forwarded.ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(message) != "ping" {
+		t.Fatalf("Unexpected message: %q", message)
+	}
+}
+
+func TestSecureConnCloseWrite(t *testing.T) {
+	l := testutil.Listen(t)
+	go Serve(l, nil)
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// Send a request, then half-close to mark its end; the echo server
+	// answers and half-closes in turn.
+	request := bytes.Repeat([]byte("request "), 10000)
+	if _, err := conn.Write(request); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	response, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(response, request) {
+		t.Fatalf("Unexpected response of %d bytes, expected %d", len(response), len(request))
+	}
+
+	if _, err := conn.Write([]byte("late")); !errors.Is(err, ErrWriteClosed) {
+		t.Fatalf("Expected ErrWriteClosed, got %v", err)
+	}
+}
+
+func TestSecureConnReadTimeoutRetry(t *testing.T) {
+	release := make(chan struct{})
+	s := &Server{Handler: func(ctx context.Context, conn *SecureConn) error {
+		<-release
+		return conn.WriteMsg(bytes.Repeat([]byte("late"), DefaultMaxMessageSize))
+	}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+	defer close(release)
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(20 * time.Millisecond))
+	_, err = conn.ReadMsg()
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+
+	// The message spans several frames, and the retries time out
+	// wherever they happen to in them.
+	release <- struct{}{}
+	var message []byte
+	for message == nil {
+		conn.SetReadDeadline(time.Now().Add(time.Millisecond))
+		if message, err = conn.ReadMsg(); err != nil && !errors.As(err, &netErr) {
+			t.Fatal(err)
+		}
+	}
+	if !bytes.Equal(message, bytes.Repeat([]byte("late"), DefaultMaxMessageSize)) {
+		t.Fatalf("Got a message of %d bytes after timeouts, expected %d", len(message), 4*DefaultMaxMessageSize)
+	}
+}
+
+func TestSecureConnSetMaxMessageSizeWhileReading(t *testing.T) {
+	client, server, err := testPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// The limit may change while frames arrive.
+	const messages = 100
+	read := make(chan error, 1)
+	go func() {
+		for i := 0; i < messages; i++ {
+			if _, err := server.ReadMsg(); err != nil {
+				read <- err
+				return
+			}
+		}
+		_, err := server.ReadMsg()
+		read <- err
+	}()
+	go func() {
+		for i := 0; i < messages; i++ {
+			if err := client.WriteMsg([]byte("small")); err != nil {
+				return
+			}
+		}
+	}()
+	for i := 0; i < messages; i++ {
+		server.SetMaxMessageSize(1024 + i)
+	}
+
+	// And a read already waiting for its frame gets the new one.
+	server.SetMaxMessageSize(1024)
+	client.SetMaxMessageSize(4096)
+	go client.WriteMsg(make([]byte, 2048))
+	if err := <-read; !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Expected ErrMessageTooLarge, got %v", err)
+	}
+}
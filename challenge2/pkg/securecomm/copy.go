@@ -0,0 +1,96 @@
+package securecomm
+
+import (
+	"io"
+)
+
+// maxPayloadOffset is the most room a frame's plaintext needs ahead of
+// its payload.
+const maxPayloadOffset = frameFlagsSize + paddedLengthSize
+
+// ReadFrom reads from r until io.EOF and sends what it reads, with each
+// read becoming one message. The data is read straight into the buffer
+// it is sealed in, so io.Copy to a SecureWriter makes no extra copies.
+func (sw *SecureWriter) ReadFrom(r io.Reader) (int64, error) {
+	var written int64
+	for {
+		n, err := sw.sendFrom(r)
+		written += n
+		if err == io.EOF {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
+// sendFrom makes one read from r, of at most one frame's worth of
+// payload, and sends what it read as a frame.
+func (sw *SecureWriter) sendFrom(r io.Reader) (int64, error) {
+	sw.mu.Lock()
+	closed, limit := sw.closed, maxMessageSize(sw.MaxMessageSize)
+	if sw.pads() {
+		limit -= paddedLengthSize
+	}
+	sw.mu.Unlock()
+
+	if closed {
+		return 0, ErrWriteClosed
+	}
+
+	// Other writers may go ahead while we wait for r.
+	buf := getBuffer(maxPayloadOffset + limit)
+	defer putBuffer(buf)
+	n, err := r.Read((*buf)[maxPayloadOffset:])
+	if n == 0 {
+		return 0, err
+	}
+
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return 0, ErrWriteClosed
+	}
+	if sw.rekeyDue(sw.now()) {
+		if err := sw.rekey(); err != nil {
+			return 0, err
+		}
+	}
+
+	plaintext := (*buf)[maxPayloadOffset-sw.payloadOffset() : maxPayloadOffset+n]
+	if err := sw.sealFrame(0, plaintext); err != nil {
+		return 0, err
+	}
+
+	return int64(n), err
+}
+
+// WriteTo writes everything the peer sends to w until the end of the
+// stream. Decrypted frames are written to w as they are, so io.Copy
+// from a SecureReader makes no extra copies.
+func (sr *SecureReader) WriteTo(w io.Writer) (int64, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	var written int64
+	for {
+		if len(sr.unread) == 0 {
+			if err := sr.readFrame(); err != nil {
+				if err == io.EOF {
+					return written, nil
+				}
+				return written, err
+			}
+			continue
+		}
+
+		n, err := w.Write(sr.unread)
+		sr.unread = sr.unread[n:]
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// Make sure io.Copy takes the fast paths.
+var (
+	_ io.ReaderFrom = (*SecureConn)(nil)
+	_ io.WriterTo   = (*SecureConn)(nil)
+)
+
+func TestReadFromWriteTo(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	expected := make([]byte, 1<<20)
+	for i := range expected {
+		expected[i] = byte(i * 13)
+	}
+
+	tests := map[string]func(*SecureWriter){
+		"plain":  func(*SecureWriter) {},
+		"small":  func(sw *SecureWriter) { sw.MaxMessageSize = 1000 },
+		"padded": func(sw *SecureWriter) { sw.Padding = PaddingPolicy{Buckets: []int{4096}, Random: 100} },
+	}
+	for name, setup := range tests {
+		t.Run(name, func(t *testing.T) {
+			var frames bytes.Buffer
+			secureW := NewSecureWriter(&frames, priv, pub)
+			setup(secureW)
+
+			n, err := secureW.ReadFrom(iotest.HalfReader(bytes.NewReader(expected)))
+			if err != nil || n != int64(len(expected)) {
+				t.Fatalf("ReadFrom returned %d, %v", n, err)
+			}
+
+			var got bytes.Buffer
+			secureR := NewSecureReader(&frames, priv, pub)
+			if n, err := secureR.WriteTo(&got); err != nil || n != int64(len(expected)) {
+				t.Fatalf("WriteTo returned %d, %v", n, err)
+			}
+			if !bytes.Equal(got.Bytes(), expected) {
+				t.Fatal("Unexpected result after copying through the secure layer")
+			}
+		})
+	}
+}
+
+func TestSecureConnCopy(t *testing.T) {
+	l := testutil.Listen(t)
+	go Serve(l, nil)
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(10 * time.Second))
+
+	file := make([]byte, 8<<20)
+	for i := range file {
+		file[i] = byte(i * 31)
+	}
+	expected := sha256.Sum256(file)
+
+	go func() {
+		// Hide the bytes.Reader's WriteTo, as a file would not have
+		// one, so io.Copy uses ReadFrom.
+		if _, err := io.Copy(conn, struct{ io.Reader }{bytes.NewReader(file)}); err != nil {
+			t.Error(err)
+		}
+		conn.CloseWrite()
+	}()
+
+	h := sha256.New()
+	n, err := io.Copy(h, conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(file)) || !bytes.Equal(h.Sum(nil), expected[:]) {
+		t.Fatalf("Echo of %d bytes does not match the %d sent", n, len(file))
+	}
+}
+
+func BenchmarkSecureCopy(b *testing.B) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	secureW := NewSecureWriter(ioutil.Discard, priv, pub)
+	file := make([]byte, 1<<20)
+
+	b.SetBytes(int64(len(file)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := io.Copy(secureW, struct{ io.Reader }{bytes.NewReader(file)}); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,976 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// The datagram mode runs over UDP for applications that would rather
+// lose a message than wait for it, as TCP makes them when a segment is
+// retransmitted. Every packet starts with a type byte.
+//
+// The client opens with a hello holding its ephemeral public key. A
+// server that has not heard from the client's address answers with a
+// cookie, a MAC over that address and key, which the client must echo
+// in a second hello. Only then does the server keep any state or answer
+// with its own ephemeral public key, so spoofed hellos cost it nothing
+// and cannot make it flood a victim. Both sides then derive keys as the
+// legacy handshake does, mixing in the pre-shared key if configured.
+//
+// Each data packet carries the nonce it was sealed with, whose last
+// eight bytes hold its sequence number. Packets may be lost or
+// reordered, but a replay window refuses any sequence number seen
+// before, or too old to tell.
+//
+// The hello also says how many data and parity shards make up a group
+// for forward error correction, zero for none, and both sides then
+// protect what they send the same way. The data packets with sequence
+// numbers from g*data up to (g+1)*data form group g, and are followed
+// by that many parity packets computed over them. Parity packets are
+// sealed like data packets, with sequence numbers of their own that
+// have the top bit set, and let the reader rebuild lost data packets
+// without waiting for a retransmission.
+//
+// A client whose address changes, as when a phone moves from Wi-Fi to
+// its cellular network, can take its session along. Both sides derive a
+// connection ID from the session keys, and the client sends a migrate
+// packet from its new address carrying that ID in the clear ahead of a
+// sealed payload. Migrate packets have sequence numbers of their own,
+// with the second highest bit set and a replay window apart from that
+// of data packets. Opening one proves the sender holds the session key,
+// but not that it can receive at the address it came from, so the
+// server answers it with a cookie over that address and the connection
+// ID, and moves the session only once the client seals that cookie
+// into another migrate packet. The server acknowledges with an empty
+// migrate packet of its own and sends there from then on.
+const (
+	packetHello byte = 1 + iota
+	packetCookie
+	packetReply
+	packetData
+	packetParity
+	packetMigrate
+)
+
+const (
+	cookieSize      = 16
+	helloSize       = 1 + 32 + 2
+	cookieHelloSize = helloSize + cookieSize
+	replySize       = 1 + 32
+
+	// MaxDatagramSize is the largest payload a DatagramConn sends in
+	// one packet, chosen so that sealed packets fit the smallest MTU
+	// common on the internet without fragmenting.
+	MaxDatagramSize = 1200
+
+	datagramOverhead = 1 + nonceSize + box.Overhead
+
+	// A parity packet protects data packets of up to maxPacketSize
+	// bytes, each prefixed with its length.
+	shardLengthSize = 2
+	maxPacketSize   = datagramOverhead + shardLengthSize + datagramOverhead + MaxDatagramSize
+
+	// parityBit marks the sequence numbers of parity packets, and
+	// controlBit those of migrate packets.
+	parityBit  = 1 << 63
+	controlBit = 1 << 62
+
+	connIDSize        = 8
+	migrateOverhead   = 1 + connIDSize + nonceSize + box.Overhead
+	connectionIDLabel = "go-mentor secure datagram connection id"
+
+	// fecGroupWindow is how many groups behind the latest one the
+	// reader still collects shards for.
+	fecGroupWindow = 8
+
+	// cookieInterval is how often the server changes the time mixed into
+	// its cookies. A cookie is accepted during the interval it was made
+	// in and the next one.
+	cookieInterval = time.Minute
+
+	// handshakeRetransmit is how long the client waits for an answer to
+	// its hello before sending it again.
+	handshakeRetransmit = 250 * time.Millisecond
+
+	// datagramSessionTimeout is how long the server keeps a session its
+	// client has gone quiet on.
+	datagramSessionTimeout = 2 * time.Minute
+)
+
+// datagramSession holds the keys and sequence numbers of one datagram
+// connection.
+type datagramSession struct {
+	suite CipherSuite
+
+	// id names the session in migrate packets.
+	id [connIDSize]byte
+
+	// fec is the erasure code protecting packets, nil without forward
+	// error correction.
+	fec *fecCode
+
+	// mu guards the sending half, which concurrent writes share.
+	// sendGroup holds the data packets of the group being sent.
+	mu         sync.Mutex
+	sendKey    [32]byte
+	sendSeq    uint64
+	sendAEAD   aeadCache
+	sendGroup  [][]byte
+	controlSeq uint64
+	random     io.Reader
+
+	// groups holds the shards received of recent groups, the latest of
+	// which is latestGroup.
+	receiveKey    [32]byte
+	receiveAEAD   aeadCache
+	window        replayWindow
+	controlWindow replayWindow
+	groups        map[uint64]*fecGroup
+	latestGroup   uint64
+}
+
+// fecGroup collects the shards of one group, nil where not received.
+type fecGroup struct {
+	shards   [][]byte
+	received int
+}
+
+// fecParams are the data and parity shards per group the client asks
+// for in its hello.
+type fecParams struct {
+	data, parity byte
+}
+
+// newDatagramSession derives the keys of a datagram connection from both
+// sides' ephemeral public keys and our private one.
+func newDatagramSession(clientPub, serverPub, priv *[32]byte, server bool, fec fecParams, cfg config) (*datagramSession, error) {
+	peer := serverPub
+	if server {
+		peer = clientPub
+	}
+
+	secret := precompute(peer, priv)
+	secret = append(secret, cfg.psk...)
+
+	// The salt covers the error correction the client asked for, so it
+	// cannot be changed on the way.
+	salt := make([]byte, 0, 66)
+	salt = append(salt, clientPub[:]...)
+	salt = append(salt, serverPub[:]...)
+	salt = append(salt, fec.data, fec.parity)
+
+	sendLabel, receiveLabel := clientToServerLabel, serverToClientLabel
+	if server {
+		sendLabel, receiveLabel = receiveLabel, sendLabel
+	}
+
+	sendKey, err := deriveKey(secret, salt, sendLabel)
+	if err != nil {
+		return nil, err
+	}
+	receiveKey, err := deriveKey(secret, salt, receiveLabel)
+	if err != nil {
+		return nil, err
+	}
+	id, err := deriveKey(secret, salt, connectionIDLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	session := &datagramSession{
+		sendKey:    *sendKey,
+		receiveKey: *receiveKey,
+		random:     cfg.random(),
+	}
+	copy(session.id[:], id[:])
+	if fec.data != 0 || fec.parity != 0 {
+		if session.fec, err = newFECCode(int(fec.data), int(fec.parity)); err != nil {
+			return nil, err
+		}
+		session.groups = make(map[uint64]*fecGroup)
+	}
+
+	return session, nil
+}
+
+// seal returns payload sealed into a data packet, followed by the
+// parity packets of its group if it completes one.
+func (s *datagramSession) seal(payload []byte) ([][]byte, error) {
+	if len(payload) > MaxDatagramSize {
+		return nil, fmt.Errorf("send datagram of %d bytes: %w", len(payload), ErrMessageTooLarge)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	packet, err := s.sealPacket(packetData, s.sendSeq, payload)
+	if err != nil {
+		return nil, err
+	}
+	s.sendSeq++
+
+	packets := [][]byte{packet}
+	if s.fec == nil {
+		return packets, nil
+	}
+
+	s.sendGroup = append(s.sendGroup, packet)
+	if len(s.sendGroup) < s.fec.data {
+		return packets, nil
+	}
+
+	group := (s.sendSeq - 1) / uint64(s.fec.data)
+	for i, shard := range s.fec.encode(shards(s.sendGroup)) {
+		parity, err := s.sealPacket(packetParity, parityBit|(group*uint64(s.fec.parity)+uint64(i)), shard)
+		if err != nil {
+			return nil, err
+		}
+		packets = append(packets, parity)
+	}
+	s.sendGroup = s.sendGroup[:0]
+
+	return packets, nil
+}
+
+// sealPacket seals payload into a packet of the given type with the
+// sequence number seq. The caller must hold mu.
+func (s *datagramSession) sealPacket(packetType byte, seq uint64, payload []byte) ([]byte, error) {
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(s.random, nonce[:seqOffset]); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint64(nonce[seqOffset:], seq)
+
+	packet := make([]byte, 1+nonceSize, datagramOverhead+len(payload))
+	packet[0] = packetType
+	copy(packet[1:], nonce[:])
+
+	return s.suite.seal(packet, payload, &nonce, &s.sendKey, &s.sendAEAD), nil
+}
+
+// sealMigrate seals payload into a migrate packet with the next control
+// sequence number.
+func (s *datagramSession) sealMigrate(payload []byte) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(s.random, nonce[:seqOffset]); err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint64(nonce[seqOffset:], controlBit|s.controlSeq)
+	s.controlSeq++
+
+	packet := make([]byte, 1+connIDSize+nonceSize, migrateOverhead+len(payload))
+	packet[0] = packetMigrate
+	copy(packet[1:], s.id[:])
+	copy(packet[1+connIDSize:], nonce[:])
+
+	return s.suite.seal(packet, payload, &nonce, &s.sendKey, &s.sendAEAD), nil
+}
+
+// openMigrate authenticates and decrypts a migrate packet of this
+// session, returning its payload. ok is false for packets that fail to
+// open or were seen before.
+func (s *datagramSession) openMigrate(packet []byte) (payload []byte, ok bool) {
+	if len(packet) < migrateOverhead || packet[0] != packetMigrate || !bytes.Equal(packet[1:1+connIDSize], s.id[:]) {
+		return nil, false
+	}
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], packet[1+connIDSize:])
+
+	payload, ok = s.suite.open(nil, packet[1+connIDSize+nonceSize:], &nonce, &s.receiveKey, &s.receiveAEAD)
+	seq := binary.BigEndian.Uint64(nonce[seqOffset:])
+	if !ok || seq&parityBit != 0 || seq&controlBit == 0 || !s.controlWindow.accept(seq) {
+		return nil, false
+	}
+
+	return payload, true
+}
+
+// shards returns the data packets of a group as shards of equal length
+// for the erasure code, each holding a packet preceded by its length.
+func shards(packets [][]byte) [][]byte {
+	var size int
+	for _, packet := range packets {
+		if len(packet) > size {
+			size = len(packet)
+		}
+	}
+
+	shards := make([][]byte, len(packets))
+	for i, packet := range packets {
+		shards[i] = packetShard(packet, shardLengthSize+size)
+	}
+
+	return shards
+}
+
+// packetShard returns a shard of size bytes holding packet.
+func packetShard(packet []byte, size int) []byte {
+	shard := make([]byte, size)
+	binary.BigEndian.PutUint16(shard, uint16(len(packet)))
+	copy(shard[shardLengthSize:], packet)
+
+	return shard
+}
+
+// receive returns the payloads a packet delivers: that of a data
+// packet, along with any data packets of its group it lets us rebuild.
+// Packets that are malformed, forged or replayed deliver nothing.
+func (s *datagramSession) receive(packet []byte) [][]byte {
+	if len(packet) < datagramOverhead {
+		return nil
+	}
+
+	switch packet[0] {
+	case packetData:
+		payload, seq, ok := s.open(packet)
+		if !ok || seq >= controlBit || !s.window.accept(seq) {
+			return nil
+		}
+		payloads := [][]byte{payload}
+		if s.fec != nil {
+			k := uint64(s.fec.data)
+			payloads = append(payloads, s.addShard(seq/k, int(seq%k), packet)...)
+		}
+		return payloads
+
+	case packetParity:
+		if s.fec == nil {
+			return nil
+		}
+		shard, seq, ok := s.open(packet)
+		if !ok || seq&parityBit == 0 {
+			return nil
+		}
+		m := uint64(s.fec.parity)
+		seq &^= parityBit
+		return s.addShard(seq/m, s.fec.data+int(seq%m), shard)
+	}
+
+	return nil
+}
+
+// open authenticates and decrypts a packet, returning its payload and
+// sequence number. ok is false for packets that fail to open.
+func (s *datagramSession) open(packet []byte) (payload []byte, seq uint64, ok bool) {
+	var nonce [nonceSize]byte
+	copy(nonce[:], packet[1:])
+
+	payload, ok = s.suite.open(nil, packet[1+nonceSize:], &nonce, &s.receiveKey, &s.receiveAEAD)
+	if !ok {
+		return nil, 0, false
+	}
+
+	return payload, binary.BigEndian.Uint64(nonce[seqOffset:]), true
+}
+
+// addShard records shard number index of group, and once enough of
+// the group has arrived, rebuilds its lost data packets and returns
+// their payloads. Data shards are the packets themselves and parity
+// shards what the parity packets hold.
+func (s *datagramSession) addShard(group uint64, index int, shard []byte) [][]byte {
+	if group+fecGroupWindow < s.latestGroup {
+		return nil
+	}
+	if group > s.latestGroup {
+		s.latestGroup = group
+		for old := range s.groups {
+			if old+fecGroupWindow < group {
+				delete(s.groups, old)
+			}
+		}
+	}
+
+	g, ok := s.groups[group]
+	if !ok {
+		g = &fecGroup{shards: make([][]byte, s.fec.data+s.fec.parity)}
+		s.groups[group] = g
+	}
+	if g.shards == nil || g.shards[index] != nil {
+		return nil
+	}
+	g.shards[index] = append([]byte(nil), shard...)
+	g.received++
+	if g.received < s.fec.data {
+		return nil
+	}
+
+	// The group is complete or can be completed; either way its shards
+	// are no longer needed.
+	all := g.shards
+	g.shards = nil
+
+	missing := false
+	for _, shard := range all[:s.fec.data] {
+		missing = missing || shard == nil
+	}
+	if !missing {
+		return nil
+	}
+
+	// Parity shards are as long as the longest data shard of their
+	// group, so the data packets we have are padded to match.
+	var size int
+	for _, shard := range all[s.fec.data:] {
+		if shard != nil {
+			size = len(shard)
+		}
+	}
+	rebuilt := make([]bool, s.fec.data)
+	for i, packet := range all[:s.fec.data] {
+		if packet == nil {
+			rebuilt[i] = true
+			continue
+		}
+		if shardLengthSize+len(packet) > size {
+			return nil
+		}
+		all[i] = packetShard(packet, size)
+	}
+	if err := s.fec.reconstruct(all); err != nil {
+		return nil
+	}
+
+	var payloads [][]byte
+	for i, shard := range all[:s.fec.data] {
+		if !rebuilt[i] {
+			continue
+		}
+		n := int(binary.BigEndian.Uint16(shard))
+		if n < datagramOverhead || shardLengthSize+n > len(shard) || shard[shardLengthSize] != packetData {
+			continue
+		}
+		payload, seq, ok := s.open(shard[shardLengthSize : shardLengthSize+n])
+		if ok && seq == group*uint64(s.fec.data)+uint64(i) && s.window.accept(seq) {
+			payloads = append(payloads, payload)
+		}
+	}
+
+	return payloads
+}
+
+// replayWindow remembers which of the latest sequence numbers were
+// received, like the anti-replay window of IPsec.
+type replayWindow struct {
+	// highest is one more than the highest sequence number seen, and
+	// bit i of seen is set when highest-1-i was received.
+	highest uint64
+	seen    uint64
+}
+
+// accept reports whether seq is new, and records it if so.
+func (w *replayWindow) accept(seq uint64) bool {
+	if seq >= w.highest {
+		shift := seq - w.highest + 1
+		if shift >= 64 {
+			w.seen = 0
+		} else {
+			w.seen <<= shift
+		}
+		w.seen |= 1
+		w.highest = seq + 1
+		return true
+	}
+
+	age := w.highest - 1 - seq
+	if age >= 64 || w.seen&(1<<age) != 0 {
+		return false
+	}
+	w.seen |= 1 << age
+
+	return true
+}
+
+// A DatagramConn is a secure connection over UDP. Each Write is sealed
+// into one packet and each Read returns one. Packets can be lost or
+// arrive out of order, but are never accepted if they were altered,
+// forged or seen before; such packets are silently dropped.
+//
+// Any number of goroutines may write to a DatagramConn at once. Reads
+// must come from one goroutine at a time.
+type DatagramConn struct {
+	conn    net.Conn
+	session *datagramSession
+	buf     [maxPacketSize]byte
+
+	// timeout bounds how long Migrate waits for the server.
+	timeout time.Duration
+
+	// pending holds payloads rebuilt by forward error correction that
+	// Read has yet to return.
+	pending [][]byte
+}
+
+// DialUDP performs the datagram handshake with the server at addr and
+// returns the resulting connection. It honors WithPSK, WithFEC, WithRand
+// and WithHandshakeTimeout; other options need the stream handshake.
+func DialUDP(addr string, opts ...Option) (*DatagramConn, error) {
+	cfg := newConfig(opts)
+
+	fec := fecParams{data: byte(cfg.fecData), parity: byte(cfg.fecParity)}
+	if cfg.fecData != 0 || cfg.fecParity != 0 {
+		if _, err := newFECCode(cfg.fecData, cfg.fecParity); err != nil {
+			return nil, err
+		}
+	}
+
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	pub, priv, err := box.GenerateKey(cfg.random())
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("generate key pair: %w", err)
+	}
+
+	timeout := handshakeTimeout(cfg.handshakeTimeout)
+	serverPub, err := datagramHandshake(conn, pub, fec, time.Now().Add(timeout))
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	session, err := newDatagramSession(pub, serverPub, priv, false, fec, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &DatagramConn{conn: conn, session: session, timeout: timeout}, nil
+}
+
+// datagramHandshake sends hellos, echoing the server's cookie once it
+// sends one, until the server replies with its public key or deadline
+// passes.
+func datagramHandshake(conn net.Conn, pub *[32]byte, fec fecParams, deadline time.Time) (*[32]byte, error) {
+	hello := make([]byte, helloSize, cookieHelloSize)
+	hello[0] = packetHello
+	copy(hello[1:], pub[:])
+	hello[1+32], hello[1+32+1] = fec.data, fec.parity
+
+	var buf [maxPacketSize]byte
+	for {
+		if _, err := conn.Write(hello); err != nil {
+			return nil, fmt.Errorf("send hello: %w", err)
+		}
+
+		wait := time.Now().Add(handshakeRetransmit)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		if err := conn.SetReadDeadline(wait); err != nil {
+			return nil, err
+		}
+
+		for {
+			n, err := conn.Read(buf[:])
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if !time.Now().Before(deadline) {
+					return nil, fmt.Errorf("datagram handshake: %w", err)
+				}
+				break
+			}
+			if err != nil {
+				return nil, fmt.Errorf("datagram handshake: %w", err)
+			}
+
+			packet := buf[:n]
+			switch {
+			case n == 1+cookieSize && packet[0] == packetCookie:
+				hello = append(hello[:helloSize], packet[1:]...)
+			case n == replySize && packet[0] == packetReply:
+				var serverPub [32]byte
+				copy(serverPub[:], packet[1:])
+				return &serverPub, conn.SetReadDeadline(time.Time{})
+			default:
+				continue
+			}
+			break
+		}
+	}
+}
+
+// Migrate moves the connection to a new local socket, as a client must
+// when its network changes, and has the server send to it there. It
+// gives up after the handshake timeout, leaving the connection on its
+// old socket. Migrate must not run at the same time as Read or Write.
+func (c *DatagramConn) Migrate() error {
+	conn, err := net.Dial("udp", c.conn.RemoteAddr().String())
+	if err != nil {
+		return err
+	}
+
+	if err := c.migrate(conn, time.Now().Add(c.timeout)); err != nil {
+		conn.Close()
+		return err
+	}
+
+	old := c.conn
+	c.conn = conn
+
+	return old.Close()
+}
+
+// migrate sends migrate packets from conn, sealing in the server's
+// cookie once it sends one, until the server acknowledges the move or
+// deadline passes. Data packets that arrive meanwhile are kept for Read.
+func (c *DatagramConn) migrate(conn net.Conn, deadline time.Time) error {
+	var cookie []byte
+	for {
+		packet, err := c.session.sealMigrate(cookie)
+		if err != nil {
+			return err
+		}
+		if _, err := conn.Write(packet); err != nil {
+			return fmt.Errorf("send migrate: %w", err)
+		}
+
+		wait := time.Now().Add(handshakeRetransmit)
+		if wait.After(deadline) {
+			wait = deadline
+		}
+		if err := conn.SetReadDeadline(wait); err != nil {
+			return err
+		}
+
+		for {
+			n, err := conn.Read(c.buf[:])
+			var netErr net.Error
+			if errors.As(err, &netErr) && netErr.Timeout() {
+				if !time.Now().Before(deadline) {
+					return fmt.Errorf("migrate: %w", err)
+				}
+				break
+			}
+			if err != nil {
+				return fmt.Errorf("migrate: %w", err)
+			}
+
+			packet := c.buf[:n]
+			switch {
+			case n == 1+cookieSize && packet[0] == packetCookie:
+				cookie = append([]byte(nil), packet[1:]...)
+			case n > 0 && packet[0] == packetMigrate:
+				if _, ok := c.session.openMigrate(packet); ok {
+					return conn.SetReadDeadline(time.Time{})
+				}
+				continue
+			default:
+				c.pending = append(c.pending, c.session.receive(packet)...)
+				continue
+			}
+			break
+		}
+	}
+}
+
+// Read reads the next packet from the peer into b. Like a read from a
+// UDP socket, it drops whatever of the packet does not fit. Packets
+// rebuilt by forward error correction are returned in turn after the
+// packet that completed their group.
+func (c *DatagramConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		n, err := c.conn.Read(c.buf[:])
+		if err != nil {
+			return 0, err
+		}
+
+		c.pending = c.session.receive(c.buf[:n])
+	}
+
+	payload := c.pending[0]
+	c.pending = c.pending[1:]
+
+	return copy(b, payload), nil
+}
+
+// Write seals b into a single packet and sends it, along with parity
+// packets when it completes a group. Messages larger than
+// MaxDatagramSize fail with ErrMessageTooLarge.
+func (c *DatagramConn) Write(b []byte) (int, error) {
+	packets, err := c.session.seal(b)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, packet := range packets {
+		if _, err := c.conn.Write(packet); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(b), nil
+}
+
+// Close closes the underlying UDP socket.
+func (c *DatagramConn) Close() error {
+	return c.conn.Close()
+}
+
+// LocalAddr returns the local network address.
+func (c *DatagramConn) LocalAddr() net.Addr {
+	return c.conn.LocalAddr()
+}
+
+// RemoteAddr returns the remote network address.
+func (c *DatagramConn) RemoteAddr() net.Addr {
+	return c.conn.RemoteAddr()
+}
+
+// SetDeadline sets the read and write deadlines of the underlying
+// socket.
+func (c *DatagramConn) SetDeadline(t time.Time) error {
+	return c.conn.SetDeadline(t)
+}
+
+// SetReadDeadline sets the read deadline of the underlying socket.
+func (c *DatagramConn) SetReadDeadline(t time.Time) error {
+	return c.conn.SetReadDeadline(t)
+}
+
+// SetWriteDeadline sets the write deadline of the underlying socket.
+func (c *DatagramConn) SetWriteDeadline(t time.Time) error {
+	return c.conn.SetWriteDeadline(t)
+}
+
+// ServeUDP answers datagram handshakes on pc and echoes every packet
+// back to the client that sent it, with the forward error correction
+// the client asked for. Clients that migrate are followed to their new
+// address. It honors WithPSK, WithRand and WithErrorHandler.
+func ServeUDP(pc net.PacketConn, opts ...Option) error {
+	cfg := newConfig(opts)
+
+	s := &datagramServer{
+		pc:       pc,
+		cfg:      cfg,
+		sessions: make(map[string]*serverSession),
+		byID:     make(map[[connIDSize]byte]*serverSession),
+	}
+	if _, err := io.ReadFull(cfg.random(), s.cookieKey[:]); err != nil {
+		return fmt.Errorf("generate cookie key: %w", err)
+	}
+
+	var buf [maxPacketSize]byte
+	for {
+		n, addr, err := pc.ReadFrom(buf[:])
+		if err != nil {
+			return fmt.Errorf("read packet: %w", err)
+		}
+
+		if err := s.handle(buf[:n], addr, time.Now()); err != nil {
+			s.cfg.handleError(s.cfg.logger().With("remote", addr.String()), addr, err)
+		}
+	}
+}
+
+// datagramServer is the state ServeUDP keeps between packets. sessions
+// are keyed by client address, and byID holds the same sessions by
+// connection ID.
+type datagramServer struct {
+	pc        net.PacketConn
+	cfg       config
+	cookieKey [32]byte
+	sessions  map[string]*serverSession
+	byID      map[[connIDSize]byte]*serverSession
+}
+
+// serverSession is a client's session along with the hello that set it
+// up, so that a retransmitted hello is answered with the same reply.
+// addr is where the client is now, and lastSeen is when it last sent a
+// packet we accepted.
+type serverSession struct {
+	*datagramSession
+	hello    [helloSize]byte
+	reply    []byte
+	addr     string
+	lastSeen time.Time
+}
+
+// handle acts on one packet from addr.
+func (s *datagramServer) handle(packet []byte, addr net.Addr, now time.Time) error {
+	if len(packet) == 0 {
+		return nil
+	}
+
+	switch packet[0] {
+	case packetHello:
+		return s.hello(packet, addr, now)
+	case packetMigrate:
+		return s.migrate(packet, addr, now)
+	}
+
+	session, ok := s.sessions[addr.String()]
+	if !ok {
+		return nil
+	}
+
+	payloads := session.receive(packet)
+	if len(payloads) > 0 {
+		session.lastSeen = now
+	}
+	for _, payload := range payloads {
+		echo, err := session.seal(payload)
+		if err != nil {
+			return err
+		}
+		for _, packet := range echo {
+			if _, err := s.pc.WriteTo(packet, addr); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// hello answers a client's hello with a cookie, or with our public key
+// if it already carries a valid one.
+func (s *datagramServer) hello(packet []byte, addr net.Addr, now time.Time) error {
+	var hello [helloSize]byte
+	switch len(packet) {
+	case helloSize, cookieHelloSize:
+		copy(hello[:], packet)
+	default:
+		return nil
+	}
+
+	if session, ok := s.sessions[addr.String()]; ok && session.hello == hello {
+		_, err := s.pc.WriteTo(session.reply, addr)
+		return err
+	}
+
+	interval := now.Unix() / int64(cookieInterval/time.Second)
+	if len(packet) == helloSize {
+		_, err := s.pc.WriteTo(append([]byte{packetCookie}, s.cookie(addr, hello[:], interval)...), addr)
+		return err
+	}
+
+	if !s.validCookie(packet[helloSize:], addr, hello[:], interval) {
+		return nil
+	}
+
+	var clientPub [32]byte
+	copy(clientPub[:], hello[1:])
+	fec := fecParams{data: hello[1+32], parity: hello[1+32+1]}
+
+	pub, priv, err := box.GenerateKey(s.cfg.random())
+	if err != nil {
+		return fmt.Errorf("generate key pair: %w", err)
+	}
+	session, err := newDatagramSession(&clientPub, pub, priv, true, fec, s.cfg)
+	if err != nil {
+		return err
+	}
+
+	s.expire(now)
+	if old, ok := s.sessions[addr.String()]; ok {
+		delete(s.byID, old.id)
+	}
+	reply := append([]byte{packetReply}, pub[:]...)
+	ss := &serverSession{
+		datagramSession: session,
+		hello:           hello,
+		reply:           reply,
+		addr:            addr.String(),
+		lastSeen:        now,
+	}
+	s.sessions[ss.addr] = ss
+	s.byID[session.id] = ss
+
+	_, err = s.pc.WriteTo(reply, addr)
+	return err
+}
+
+// migrate answers a migrate packet from addr. An empty one earns a
+// cookie for addr, and one holding that cookie moves the session there.
+// Either way the packet must open with the session's key.
+func (s *datagramServer) migrate(packet []byte, addr net.Addr, now time.Time) error {
+	if len(packet) < migrateOverhead {
+		return nil
+	}
+
+	var id [connIDSize]byte
+	copy(id[:], packet[1:])
+	session, ok := s.byID[id]
+	if !ok {
+		return nil
+	}
+	cookie, ok := session.openMigrate(packet)
+	if !ok {
+		return nil
+	}
+
+	// A migrate packet from where the session already is means the client
+	// lost our acknowledgement, which it gets again.
+	if session.addr != addr.String() {
+		interval := now.Unix() / int64(cookieInterval/time.Second)
+		if len(cookie) == 0 {
+			_, err := s.pc.WriteTo(append([]byte{packetCookie}, s.cookie(addr, id[:], interval)...), addr)
+			return err
+		}
+		if !s.validCookie(cookie, addr, id[:], interval) {
+			return nil
+		}
+
+		if s.sessions[session.addr] == session {
+			delete(s.sessions, session.addr)
+		}
+		if old, ok := s.sessions[addr.String()]; ok {
+			delete(s.byID, old.id)
+		}
+		session.addr = addr.String()
+		s.sessions[session.addr] = session
+	}
+	session.lastSeen = now
+
+	ack, err := session.sealMigrate(nil)
+	if err != nil {
+		return err
+	}
+	_, err = s.pc.WriteTo(ack, addr)
+	return err
+}
+
+// cookie returns the cookie a client at addr must echo along with bound,
+// the hello or connection ID it is for, during the given cookie
+// interval.
+func (s *datagramServer) cookie(addr net.Addr, bound []byte, interval int64) []byte {
+	mac := hmac.New(sha256.New, s.cookieKey[:])
+	mac.Write([]byte(addr.String()))
+	mac.Write(bound)
+	binary.Write(mac, binary.BigEndian, interval)
+
+	return mac.Sum(nil)[:cookieSize]
+}
+
+// validCookie reports whether cookie is the one for addr and bound made
+// during the current cookie interval or the one before.
+func (s *datagramServer) validCookie(cookie []byte, addr net.Addr, bound []byte, interval int64) bool {
+	return hmac.Equal(cookie, s.cookie(addr, bound, interval)) || hmac.Equal(cookie, s.cookie(addr, bound, interval-1))
+}
+
+// expire forgets the sessions whose clients have gone quiet.
+func (s *datagramServer) expire(now time.Time) {
+	for addr, session := range s.sessions {
+		if now.Sub(session.lastSeen) > datagramSessionTimeout {
+			delete(s.sessions, addr)
+			delete(s.byID, session.id)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestReplayWindow(t *testing.T) {
+	var w replayWindow
+
+	tests := []struct {
+		seq    uint64
+		accept bool
+	}{
+		{0, true},
+		{0, false},
+		{2, true},
+		{1, true},
+		{2, false},
+		{100, true},
+		{37, true},
+		{36, false}, // 64 behind the highest, too old to tell
+		{37, false},
+		{99, true},
+		{1000, true},
+		{999, true},
+		{100, false},
+	}
+
+	for _, test := range tests {
+		if got := w.accept(test.seq); got != test.accept {
+			t.Errorf("accept(%d) = %v, expected %v", test.seq, got, test.accept)
+		}
+	}
+}
+
+func TestDatagramEcho(t *testing.T) {
+	for _, opts := range [][]Option{nil, {WithPSK([]byte("shared secret"))}} {
+		pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go ServeUDP(pc, opts...)
+
+		conn, err := DialUDP(pc.LocalAddr().String(), opts...)
+		if err != nil {
+			pc.Close()
+			t.Fatal(err)
+		}
+
+		for _, message := range []string{"hello world", "another datagram"} {
+			if _, err := conn.Write([]byte(message)); err != nil {
+				t.Fatal(err)
+			}
+
+			conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+			buf := make([]byte, MaxDatagramSize)
+			n, err := conn.Read(buf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(buf[:n]) != message {
+				t.Fatalf("Unexpected echo %q, expected %q", buf[:n], message)
+			}
+		}
+
+		if _, err := conn.Write(make([]byte, MaxDatagramSize+1)); !errors.Is(err, ErrMessageTooLarge) {
+			t.Errorf("Expected ErrMessageTooLarge for an oversized datagram, got %v", err)
+		}
+
+		conn.Close()
+		pc.Close()
+	}
+}
+
+func TestDatagramCookie(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	go ServeUDP(pc)
+
+	conn, err := net.Dial("udp", pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	exchange := func(packet []byte) []byte {
+		if _, err := conn.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, 1500)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf[:n]
+	}
+
+	hello := make([]byte, helloSize)
+	hello[0] = packetHello
+	rand.Read(hello[1 : 1+32])
+
+	// A hello without a cookie only earns one, and no larger than the
+	// hello itself.
+	answer := exchange(hello)
+	if answer[0] != packetCookie || len(answer) > len(hello) {
+		t.Fatalf("Expected a cookie, got %x", answer)
+	}
+	cookie := answer[1:]
+
+	// A hello with a wrong cookie goes unanswered.
+	forged := append(append([]byte(nil), hello...), bytes.Repeat([]byte{0}, cookieSize)...)
+	if _, err := conn.Write(forged); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	var netErr net.Error
+	if _, err := conn.Read(make([]byte, 1500)); !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Expected no answer to a forged cookie, got %v", err)
+	}
+
+	// The right cookie gets the server's key, every time it is sent.
+	reply := exchange(append(append([]byte(nil), hello...), cookie...))
+	if reply[0] != packetReply || len(reply) != replySize {
+		t.Fatalf("Expected a reply, got %x", reply)
+	}
+	if again := exchange(append(append([]byte(nil), hello...), cookie...)); !bytes.Equal(again, reply) {
+		t.Fatal("Expected a retransmitted hello to get the same reply")
+	}
+}
+
+func TestDatagramDropsBadPackets(t *testing.T) {
+	clientPub, clientPriv := testutil.KeyPair(t)
+	serverPub, serverPriv := testutil.KeyPair(t)
+
+	client, err := newDatagramSession(clientPub, serverPub, clientPriv, false, fecParams{}, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := newDatagramSession(clientPub, serverPub, serverPriv, true, fecParams{}, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	packets, err := client.seal([]byte("payload"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet := packets[0]
+	tampered := append([]byte(nil), packet...)
+	tampered[len(tampered)-1] ^= 1
+
+	if payloads := server.receive(tampered); len(payloads) != 0 {
+		t.Error("Expected a tampered packet to be dropped")
+	}
+	if payloads := server.receive(packet); len(payloads) != 1 || string(payloads[0]) != "payload" {
+		t.Fatalf("Unexpected payloads %q", payloads)
+	}
+	if payloads := server.receive(packet); len(payloads) != 0 {
+		t.Error("Expected a replayed packet to be dropped")
+	}
+	if payloads := client.receive(packet); len(payloads) != 0 {
+		t.Error("Expected a packet reflected back to its sender to be dropped")
+	}
+}
+
+func TestDatagramFEC(t *testing.T) {
+	clientPub, clientPriv := testutil.KeyPair(t)
+	serverPub, serverPriv := testutil.KeyPair(t)
+
+	fec := fecParams{data: 4, parity: 2}
+	client, err := newDatagramSession(clientPub, serverPub, clientPriv, false, fec, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	server, err := newDatagramSession(clientPub, serverPub, serverPriv, true, fec, config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var messages []string
+	var packets [][]byte
+	for i := 0; i < 8; i++ {
+		message := strings.Repeat("x", i*10) + fmt.Sprint(i)
+		sealed, err := client.seal([]byte(message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		messages = append(messages, message)
+		packets = append(packets, sealed...)
+	}
+	if len(packets) != 12 {
+		t.Fatalf("Expected two groups of four data and two parity packets, got %d packets", len(packets))
+	}
+
+	// Lose two data packets of the first group and one of the second,
+	// along with a parity packet.
+	lost := map[int]bool{0: true, 2: true, 7: true, 11: true}
+
+	received := make(map[string]bool)
+	for i, packet := range packets {
+		if lost[i] {
+			continue
+		}
+		for _, payload := range server.receive(packet) {
+			if received[string(payload)] {
+				t.Errorf("%q delivered twice", payload)
+			}
+			received[string(payload)] = true
+		}
+	}
+	for _, message := range messages {
+		if !received[message] {
+			t.Errorf("%q was not recovered", message)
+		}
+	}
+}
+
+func TestDatagramEchoFEC(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	go ServeUDP(pc)
+
+	if _, err := DialUDP(pc.LocalAddr().String(), WithFEC(0, 1)); err == nil {
+		t.Error("Expected forward error correction without data shards to be refused")
+	}
+
+	conn, err := DialUDP(pc.LocalAddr().String(), WithFEC(2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	for i := 0; i < 4; i++ {
+		message := fmt.Sprint("datagram ", i)
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, MaxDatagramSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != message {
+			t.Fatalf("Unexpected echo %q, expected %q", buf[:n], message)
+		}
+	}
+}
+
+func TestDatagramMigrate(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	go ServeUDP(pc)
+
+	conn, err := DialUDP(pc.LocalAddr().String(), WithFEC(2, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	echo := func(message string) {
+		t.Helper()
+		if _, err := conn.Write([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		buf := make([]byte, MaxDatagramSize)
+		n, err := conn.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(buf[:n]) != message {
+			t.Fatalf("Unexpected echo %q, expected %q", buf[:n], message)
+		}
+	}
+
+	echo("before")
+
+	old := conn.LocalAddr().String()
+	if err := conn.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	if conn.LocalAddr().String() == old {
+		t.Fatal("Expected Migrate to move to a new socket")
+	}
+
+	for i := 0; i < 3; i++ {
+		echo(fmt.Sprint("after ", i))
+	}
+}
+
+func TestDatagramMigrateNeedsCookie(t *testing.T) {
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	go ServeUDP(pc)
+
+	conn, err := DialUDP(pc.LocalAddr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	dial := func() net.Conn {
+		c, err := net.Dial("udp", pc.LocalAddr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { c.Close() })
+		return c
+	}
+	send := func(c net.Conn, packet []byte) []byte {
+		if _, err := c.Write(packet); err != nil {
+			t.Fatal(err)
+		}
+		c.SetReadDeadline(time.Now().Add(200 * time.Millisecond))
+		buf := make([]byte, 1500)
+		n, err := c.Read(buf)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		return buf[:n]
+	}
+	seal := func(payload []byte) []byte {
+		packet, err := conn.session.sealMigrate(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return packet
+	}
+
+	// A migrate packet earns a cookie for the address it came from, but
+	// only the first time it is seen.
+	elsewhere := dial()
+	probe := seal(nil)
+	answer := send(elsewhere, probe)
+	if len(answer) != 1+cookieSize || answer[0] != packetCookie {
+		t.Fatalf("Expected a cookie, got %x", answer)
+	}
+	if again := send(elsewhere, probe); again != nil {
+		t.Fatalf("Expected a replayed migrate packet to go unanswered, got %x", again)
+	}
+
+	// The cookie of one address does not move the session to another,
+	// nor does a packet that fails to open.
+	if answer := send(dial(), seal(answer[1:])); answer != nil {
+		t.Fatalf("Expected a cookie from another address to be refused, got %x", answer)
+	}
+	forged := seal(nil)
+	forged[len(forged)-1] ^= 1
+	if answer := send(dial(), forged); answer != nil {
+		t.Fatalf("Expected a forged migrate packet to go unanswered, got %x", answer)
+	}
+
+	// The session stays where it was.
+	if _, err := conn.Write([]byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, MaxDatagramSize)
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(buf[:n]) != "still here" {
+		t.Fatalf("Unexpected echo %q", buf[:n])
+	}
+}
@@ -0,0 +1,142 @@
+package securecomm
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+// debugDumpSize is how many bytes of each frame's ciphertext, or of each
+// handshake write or read, WrapDebug dumps.
+const debugDumpSize = 64
+
+// WrapDebug returns a connection that passes everything through to conn
+// and logs what goes over the wire to w, for debugging interoperability
+// with other implementations. Until a SecureConn is made over it, each
+// write and read is dumped as handshake bytes. After that the stream is
+// taken apart into frames, and each is logged with its direction, its
+// length, its nonce and the start of its ciphertext.
+//
+// WrapDebug is meant for the transport a handshake runs over, such as
+// one a Dialer's Transport returns; WithDebugWire wraps every
+// connection a handshake runs over this way.
+func WrapDebug(conn net.Conn, w io.Writer) net.Conn {
+	dc := &debugConn{Conn: conn, w: w}
+	dc.sent.name, dc.received.name = "send", "recv"
+	return dc
+}
+
+// A debugConn is a connection WrapDebug logs the traffic of.
+type debugConn struct {
+	net.Conn
+
+	// framing is set once the handshake is done and the stream holds
+	// nothing but frames.
+	framing int32
+
+	mu             sync.Mutex // guards w and the directions
+	w              io.Writer
+	sent, received debugDirection
+}
+
+// A debugDirection is one direction of a debugConn's traffic.
+type debugDirection struct {
+	name   string
+	frames int64
+	wire   wireParser
+}
+
+func (dc *debugConn) Read(p []byte) (int, error) {
+	n, err := dc.Conn.Read(p)
+	dc.log(&dc.received, p[:n])
+	return n, err
+}
+
+func (dc *debugConn) Write(p []byte) (int, error) {
+	n, err := dc.Conn.Write(p)
+	dc.log(&dc.sent, p[:n])
+	return n, err
+}
+
+func (dc *debugConn) startFraming(sc *SecureConn) {
+	atomic.StoreInt32(&dc.framing, 1)
+	if fc, ok := dc.Conn.(framedConn); ok {
+		fc.startFraming(sc)
+	}
+}
+
+func (dc *debugConn) log(d *debugDirection, p []byte) {
+	if len(p) == 0 {
+		return
+	}
+
+	dc.mu.Lock()
+	defer dc.mu.Unlock()
+
+	if atomic.LoadInt32(&dc.framing) == 0 {
+		fmt.Fprintf(dc.w, "%s handshake: %d bytes\n", d.name, len(p))
+		dumpTruncated(dc.w, p, len(p))
+		return
+	}
+	d.wire.parse(p, func(frame []byte) {
+		fmt.Fprintf(dc.w, "%s frame %d: %d bytes, nonce %x\n", d.name, d.frames, len(frame)-frameHeaderSize, frame[4:frameHeaderSize])
+		dumpTruncated(dc.w, frame[frameHeaderSize:], len(frame)-frameHeaderSize)
+		d.frames++
+	})
+}
+
+// A framedConn is a connection wrapper that needs to know when the
+// handshake over it is done, from which point only the frames of sc go
+// over it.
+type framedConn interface {
+	startFraming(sc *SecureConn)
+}
+
+// A wireParser takes one direction of a stream of frames apart as it
+// goes by, however the stream is split into reads or writes.
+type wireParser struct {
+	frame []byte // the frame so far
+}
+
+// parse takes in p, calling emit with each frame it completes. The frame
+// is only valid until emit returns.
+func (wp *wireParser) parse(p []byte, emit func(frame []byte)) {
+	for len(p) > 0 {
+		n := wp.size() - len(wp.frame)
+		if n > len(p) {
+			n = len(p)
+		}
+		wp.frame = append(wp.frame, p[:n]...)
+		p = p[n:]
+
+		if len(wp.frame) >= frameHeaderSize && len(wp.frame) == wp.size() {
+			emit(wp.frame)
+			wp.frame = wp.frame[:0]
+		}
+	}
+}
+
+// size returns how long the frame being parsed is, as far as is known.
+func (wp *wireParser) size() int {
+	if len(wp.frame) < frameHeaderSize {
+		return frameHeaderSize
+	}
+
+	return frameHeaderSize + int(binary.BigEndian.Uint32(wp.frame[:4]))
+}
+
+// dumpTruncated writes a hex dump of b, the first bytes of size, noting
+// how many more there were.
+func dumpTruncated(w io.Writer, b []byte, size int) {
+	if len(b) > debugDumpSize {
+		b = b[:debugDumpSize]
+	}
+	io.WriteString(w, hex.Dump(b))
+	if more := size - len(b); more > 0 {
+		fmt.Fprintf(w, "... %d more bytes\n", more)
+	}
+}
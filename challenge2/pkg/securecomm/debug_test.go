@@ -0,0 +1,67 @@
+package securecomm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestDebugWire(t *testing.T) {
+	addr := serveHandler(t, EchoHandler)
+
+	var log lockedBuffer
+	conn, err := Dial(addr, WithDebugWire(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMsg([]byte("debug me")); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.ReadMsg(); err != nil || string(reply) != "debug me" {
+		t.Fatalf("Unexpected reply %q, %v", reply, err)
+	}
+
+	out := log.String()
+	for _, want := range []string{"send handshake: ", "recv handshake: ", "send frame 0: ", "recv frame 0: ", ", nonce "} {
+		if !strings.Contains(out, want) {
+			t.Errorf("Expected the wire log to contain %q:\n%s", want, out)
+		}
+	}
+}
+
+func TestDebugWireSplitFrames(t *testing.T) {
+	pub, priv := testutil.KeyPair(t)
+	var stream bytes.Buffer
+	sw := NewSecureWriter(&stream, priv, pub)
+	if _, err := sw.Write(bytes.Repeat([]byte("x"), 200)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := sw.Write([]byte("y")); err != nil {
+		t.Fatal(err)
+	}
+	frames := stream.Bytes()
+
+	var log bytes.Buffer
+	dc := &debugConn{w: &log, framing: 1}
+	dc.received.name = "recv"
+	for i := range frames {
+		dc.log(&dc.received, frames[i:i+1])
+	}
+
+	out := log.String()
+	first := fmt.Sprintf("recv frame 0: %d bytes, nonce %x\n", binary.BigEndian.Uint32(frames), frames[4:frameHeaderSize])
+	if !strings.HasPrefix(out, first) {
+		t.Fatalf("Expected the log to start with %q:\n%s", first, out)
+	}
+	if !strings.Contains(out, "recv frame 1: ") || strings.Contains(out, "recv frame 2") {
+		t.Fatalf("Expected exactly two frames:\n%s", out)
+	}
+	if !strings.Contains(out, " more bytes\n") {
+		t.Fatalf("Expected the long frame's dump to be truncated:\n%s", out)
+	}
+}
@@ -0,0 +1,187 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestDialerHandshakeTimeout(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// A server that accepts connections but never answers.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	d := Dialer{HandshakeTimeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err = d.Dial(l.Addr().String())
+
+	var netErr net.Error
+	if !errors.As(err, &netErr) || !netErr.Timeout() {
+		t.Fatalf("Expected a timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Dial took %v to time out", elapsed)
+	}
+}
+
+func TestDialContext(t *testing.T) {
+	l := testutil.Listen(t)
+
+	// A server that accepts connections but never answers.
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	start := time.Now()
+	if _, err := DialContext(ctx, l.Addr().String()); !errors.Is(err, context.Canceled) {
+		t.Fatalf("Expected context.Canceled, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Fatalf("Cancelling took %v", elapsed)
+	}
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	d := Dialer{HandshakeTimeout: time.Minute}
+	if _, err := d.DialContext(ctx, l.Addr().String()); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+}
+
+func TestDialerLocalAddr(t *testing.T) {
+	l := testutil.Listen(t)
+	go Serve(l, nil)
+
+	local := &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)}
+	d := Dialer{LocalAddr: local, KeepAlive: time.Minute}
+	conn, err := d.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if got := conn.LocalAddr().(*net.TCPAddr).IP; !got.Equal(local.IP) {
+		t.Fatalf("Dialed from %v, expected %v", got, local.IP)
+	}
+}
+
+func TestDialerUnix(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "secure.sock")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go Serve(l, nil)
+
+	d := Dialer{Network: "unix"}
+	conn, err := d.Dial(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := conn.ReadMsg(); err != nil || string(echo) != "ping" {
+		t.Fatalf("Unexpected echo %q, %v", echo, err)
+	}
+
+	// Half-closing works over Unix sockets too.
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); err != io.EOF {
+		t.Fatalf("Expected io.EOF once the server finished, got %v", err)
+	}
+}
+
+// redirectTransport dials every address over TCP to one address.
+type redirectTransport struct {
+	to    string
+	dials int
+}
+
+func (t *redirectTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	t.dials++
+	var d net.Dialer
+	return d.DialContext(ctx, "tcp", t.to)
+}
+
+func TestDialerTransport(t *testing.T) {
+	l := testutil.Listen(t)
+	go Serve(l, nil)
+
+	transport := &redirectTransport{to: l.Addr().String()}
+	d := Dialer{Transport: transport}
+	conn, err := d.Dial("unreachable.invalid:1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if transport.dials != 1 {
+		t.Fatalf("Expected the transport to be dialed once, got %d", transport.dials)
+	}
+	if err := conn.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := conn.ReadMsg(); err != nil || string(echo) != "ping" {
+		t.Fatalf("Unexpected echo %q, %v", echo, err)
+	}
+}
+
+func TestServeHandshakeTimeout(t *testing.T) {
+	l := testutil.Listen(t)
+	go Serve(l, nil, WithHandshakeTimeout(100*time.Millisecond))
+
+	// Connect but never send a preamble; the server must give up and
+	// close the connection.
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.Copy(ioutil.Discard, conn); err != nil {
+		t.Fatalf("Expected the server to close the connection, got %v", err)
+	}
+}
@@ -0,0 +1,492 @@
+package securecomm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// mdnsService is the DNS-SD service type servers advertise themselves
+// under.
+const mdnsService = "_go-mentor._tcp.local."
+
+// mdnsTTL is how long, in seconds, the records a server advertises may
+// be cached.
+const mdnsTTL = 120
+
+// mdnsGroup is the multicast address mDNS runs on.
+var mdnsGroup = &net.UDPAddr{IP: net.IPv4(224, 0, 0, 251), Port: 5353}
+
+// DNS record types and the class mDNS uses.
+const (
+	dnsTypeA   = 1
+	dnsTypePTR = 12
+	dnsTypeTXT = 16
+	dnsTypeSRV = 33
+	dnsTypeANY = 255
+
+	dnsClassIN = 1
+)
+
+// A Peer is a server found by Browse.
+type Peer struct {
+	// Name is the name the server advertises itself under.
+	Name string
+
+	// Addr is the host:port to dial it at.
+	Addr string
+
+	// Fingerprint is the fingerprint of the server's identity key, or
+	// empty if it has none. Anyone on the network can advertise any
+	// fingerprint, so pin servers with known hosts before trusting
+	// them.
+	Fingerprint string
+}
+
+// Advertise answers mDNS queries on the local network until ctx is done,
+// announcing a server called name that listens on port with the
+// identity key of the given fingerprint, which may be empty. Clients
+// find it with Browse.
+func Advertise(ctx context.Context, name string, port int, fingerprint string) error {
+	if name == "" || len(name) > 63 || strings.Contains(name, ".") {
+		return fmt.Errorf("advertise: invalid name %q", name)
+	}
+
+	pc, err := net.ListenMulticastUDP("udp4", nil, mdnsGroup)
+	if err != nil {
+		return fmt.Errorf("advertise: %w", err)
+	}
+	defer pc.Close()
+	stop := context.AfterFunc(ctx, func() { pc.Close() })
+	defer stop()
+
+	host, err := os.Hostname()
+	if err != nil {
+		host = "localhost"
+	}
+	r := &mdnsResponder{
+		name:        name,
+		host:        strings.SplitN(host, ".", 2)[0] + ".local.",
+		port:        uint16(port),
+		fingerprint: fingerprint,
+		ips:         hostIPs(),
+	}
+
+	// Tell the clients already browsing.
+	if _, err := pc.WriteTo(r.response(0, nil), mdnsGroup); err != nil {
+		return fmt.Errorf("advertise: %w", err)
+	}
+	if err := r.serve(pc); err != nil && ctx.Err() == nil {
+		return fmt.Errorf("advertise: %w", err)
+	}
+
+	return nil
+}
+
+// Browse asks the local network for servers advertised with Advertise
+// and returns those that answer within timeout.
+func Browse(timeout time.Duration) ([]Peer, error) {
+	pc, err := net.ListenPacket("udp4", ":0")
+	if err != nil {
+		return nil, fmt.Errorf("browse: %w", err)
+	}
+	defer pc.Close()
+
+	peers, err := browse(pc, mdnsGroup, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("browse: %w", err)
+	}
+
+	return peers, nil
+}
+
+// LookupPeer returns the address of the server advertised as name, among
+// those that answer Browse within timeout.
+func LookupPeer(name string, timeout time.Duration) (Peer, error) {
+	peers, err := Browse(timeout)
+	if err != nil {
+		return Peer{}, err
+	}
+	for _, p := range peers {
+		if strings.EqualFold(p.Name, name) {
+			return p, nil
+		}
+	}
+
+	return Peer{}, fmt.Errorf("no server called %q found on the local network", name)
+}
+
+// mdnsResponder answers queries for one server.
+type mdnsResponder struct {
+	name, host  string
+	port        uint16
+	fingerprint string
+	ips         []net.IP
+}
+
+func (r *mdnsResponder) instance() string {
+	return r.name + "." + mdnsService
+}
+
+// serve answers the queries that arrive on pc until reading fails.
+func (r *mdnsResponder) serve(pc net.PacketConn) error {
+	buf := make([]byte, 9000)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		msg, err := parseDNSMessage(buf[:n])
+		if err != nil || msg.flags&0x8000 != 0 || !r.asked(msg.questions) {
+			continue
+		}
+
+		// A query from a port other than mDNS's own comes from a simple
+		// resolver, which expects the answer back at that port, with
+		// its ID and question.
+		to := net.Addr(mdnsGroup)
+		var id uint16
+		var questions []dnsQuestion
+		if udp, ok := addr.(*net.UDPAddr); ok && udp.Port != mdnsGroup.Port {
+			to, id, questions = addr, msg.id, msg.questions
+		}
+		pc.WriteTo(r.response(id, questions), to)
+	}
+}
+
+// asked reports whether any of questions is about the server.
+func (r *mdnsResponder) asked(questions []dnsQuestion) bool {
+	for _, q := range questions {
+		switch {
+		case strings.EqualFold(q.name, mdnsService) && (q.typ == dnsTypePTR || q.typ == dnsTypeANY):
+			return true
+		case strings.EqualFold(q.name, r.instance()):
+			return true
+		}
+	}
+
+	return false
+}
+
+// response returns the answer to questions, which points at the server
+// and tells where it is and its fingerprint.
+func (r *mdnsResponder) response(id uint16, questions []dnsQuestion) []byte {
+	var b dnsBuilder
+	b.header(id, 0x8400, len(questions), 1, 2+len(r.ips))
+	for _, q := range questions {
+		b.name(q.name)
+		b.uint16(q.typ)
+		b.uint16(q.class)
+	}
+
+	b.record(mdnsService, dnsTypePTR, func() { b.name(r.instance()) })
+
+	b.record(r.instance(), dnsTypeSRV, func() {
+		b.uint16(0) // priority
+		b.uint16(0) // weight
+		b.uint16(r.port)
+		b.name(r.host)
+	})
+	b.record(r.instance(), dnsTypeTXT, func() {
+		txt := "fp=" + r.fingerprint
+		if r.fingerprint == "" {
+			txt = "fp"
+		}
+		b.buf = append(b.buf, byte(len(txt)))
+		b.buf = append(b.buf, txt...)
+	})
+	for _, ip := range r.ips {
+		b.record(r.host, dnsTypeA, func() { b.buf = append(b.buf, ip.To4()...) })
+	}
+
+	return b.buf
+}
+
+// hostIPs returns the IPv4 addresses of this machine's interfaces, other
+// than loopback ones unless there are no others.
+func hostIPs() []net.IP {
+	addrs, _ := net.InterfaceAddrs()
+	var ips, loopback []net.IP
+	for _, addr := range addrs {
+		ipnet, ok := addr.(*net.IPNet)
+		if !ok || ipnet.IP.To4() == nil {
+			continue
+		}
+		if ipnet.IP.IsLoopback() {
+			loopback = append(loopback, ipnet.IP)
+		} else {
+			ips = append(ips, ipnet.IP)
+		}
+	}
+	if len(ips) == 0 {
+		return loopback
+	}
+
+	return ips
+}
+
+// browse sends a query for servers to dst from pc and gathers the
+// answers that arrive within timeout.
+func browse(pc net.PacketConn, dst net.Addr, timeout time.Duration) ([]Peer, error) {
+	var b dnsBuilder
+	b.header(0, 0, 1, 0, 0)
+	b.name(mdnsService)
+	b.uint16(dnsTypePTR)
+	b.uint16(dnsClassIN)
+	if _, err := pc.WriteTo(b.buf, dst); err != nil {
+		return nil, err
+	}
+
+	if err := pc.SetReadDeadline(time.Now().Add(timeout)); err != nil {
+		return nil, err
+	}
+	found := make(map[string]Peer)
+	buf := make([]byte, 9000)
+	for {
+		n, addr, err := pc.ReadFrom(buf)
+		if ne, ok := err.(net.Error); ok && ne.Timeout() {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		msg, err := parseDNSMessage(buf[:n])
+		if err != nil || msg.flags&0x8000 == 0 {
+			continue
+		}
+		for _, p := range msg.peers(addr) {
+			found[strings.ToLower(p.Name)] = p
+		}
+	}
+
+	peers := make([]Peer, 0, len(found))
+	for _, p := range found {
+		peers = append(peers, p)
+	}
+	sort.Slice(peers, func(i, j int) bool { return peers[i].Name < peers[j].Name })
+
+	return peers, nil
+}
+
+// peers returns the servers a response from addr points at.
+func (msg *dnsMessage) peers(addr net.Addr) []Peer {
+	type service struct {
+		host string
+		port uint16
+	}
+	var instances []string
+	services := make(map[string]service)
+	fingerprints := make(map[string]string)
+	ips := make(map[string]net.IP)
+	for _, rr := range msg.records {
+		name := strings.ToLower(rr.name)
+		switch rr.typ {
+		case dnsTypePTR:
+			if target, _, err := readDNSName(msg.raw, rr.off); err == nil && strings.EqualFold(rr.name, mdnsService) {
+				instances = append(instances, target)
+			}
+		case dnsTypeSRV:
+			if len(rr.data) < 7 {
+				continue
+			}
+			if target, _, err := readDNSName(msg.raw, rr.off+6); err == nil {
+				services[name] = service{strings.ToLower(target), binary.BigEndian.Uint16(rr.data[4:])}
+			}
+		case dnsTypeTXT:
+			for data := rr.data; len(data) > 0 && int(data[0]) < len(data); data = data[1+data[0]:] {
+				if s := string(data[1 : 1+data[0]]); strings.HasPrefix(s, "fp=") {
+					fingerprints[name] = strings.TrimPrefix(s, "fp=")
+				}
+			}
+		case dnsTypeA:
+			if len(rr.data) == net.IPv4len {
+				ips[name] = net.IP(rr.data)
+			}
+		}
+	}
+
+	var peers []Peer
+	for _, instance := range instances {
+		key := strings.ToLower(instance)
+		srv, ok := services[key]
+		if !ok || !strings.HasSuffix(key, "."+mdnsService) {
+			continue
+		}
+		ip := ips[srv.host]
+		if ip == nil {
+			// Reach it where the answer came from.
+			udp, ok := addr.(*net.UDPAddr)
+			if !ok {
+				continue
+			}
+			ip = udp.IP
+		}
+		peers = append(peers, Peer{
+			Name:        instance[:len(instance)-len("."+mdnsService)],
+			Addr:        net.JoinHostPort(ip.String(), strconv.Itoa(int(srv.port))),
+			Fingerprint: fingerprints[key],
+		})
+	}
+
+	return peers
+}
+
+// A dnsMessage is a parsed DNS message, as far as mDNS needs.
+type dnsMessage struct {
+	raw       []byte
+	id, flags uint16
+	questions []dnsQuestion
+
+	// records are the answers and additional records together.
+	records []dnsRecord
+}
+
+type dnsQuestion struct {
+	name       string
+	typ, class uint16
+}
+
+type dnsRecord struct {
+	name string
+	typ  uint16
+	data []byte
+
+	// off is where data starts in the message, for names in it that
+	// point back into the message.
+	off int
+}
+
+var errDNSMalformed = errors.New("malformed DNS message")
+
+func parseDNSMessage(raw []byte) (*dnsMessage, error) {
+	if len(raw) < 12 {
+		return nil, errDNSMalformed
+	}
+	msg := &dnsMessage{
+		raw:   raw,
+		id:    binary.BigEndian.Uint16(raw),
+		flags: binary.BigEndian.Uint16(raw[2:]),
+	}
+	counts := [4]int{}
+	for i := range counts {
+		counts[i] = int(binary.BigEndian.Uint16(raw[4+2*i:]))
+	}
+
+	off := 12
+	for i := 0; i < counts[0]; i++ {
+		name, next, err := readDNSName(raw, off)
+		if err != nil || next+4 > len(raw) {
+			return nil, errDNSMalformed
+		}
+		msg.questions = append(msg.questions, dnsQuestion{
+			name:  name,
+			typ:   binary.BigEndian.Uint16(raw[next:]),
+			class: binary.BigEndian.Uint16(raw[next+2:]) &^ 0x8000,
+		})
+		off = next + 4
+	}
+	for i := 0; i < counts[1]+counts[2]+counts[3]; i++ {
+		name, next, err := readDNSName(raw, off)
+		if err != nil || next+10 > len(raw) {
+			return nil, errDNSMalformed
+		}
+		length := int(binary.BigEndian.Uint16(raw[next+8:]))
+		start := next + 10
+		if start+length > len(raw) {
+			return nil, errDNSMalformed
+		}
+		msg.records = append(msg.records, dnsRecord{
+			name: name,
+			typ:  binary.BigEndian.Uint16(raw[next:]),
+			data: raw[start : start+length],
+			off:  start,
+		})
+		off = start + length
+	}
+
+	return msg, nil
+}
+
+// readDNSName reads the possibly compressed name at off in msg, and
+// returns it and the offset after it.
+func readDNSName(msg []byte, off int) (string, int, error) {
+	var name strings.Builder
+	next := -1
+	for jumps := 0; ; {
+		if off >= len(msg) {
+			return "", 0, errDNSMalformed
+		}
+		length := int(msg[off])
+		switch {
+		case length == 0:
+			if next < 0 {
+				next = off + 1
+			}
+			if name.Len() == 0 {
+				name.WriteByte('.')
+			}
+			return name.String(), next, nil
+		case length&0xc0 == 0xc0:
+			if off+1 >= len(msg) || jumps > 16 {
+				return "", 0, errDNSMalformed
+			}
+			if next < 0 {
+				next = off + 2
+			}
+			off = int(binary.BigEndian.Uint16(msg[off:]) & 0x3fff)
+			jumps++
+		case length > 63 || off+1+length > len(msg):
+			return "", 0, errDNSMalformed
+		default:
+			name.Write(msg[off+1 : off+1+length])
+			name.WriteByte('.')
+			off += 1 + length
+		}
+	}
+}
+
+// dnsBuilder builds a DNS message, without compressing names.
+type dnsBuilder struct {
+	buf []byte
+}
+
+func (b *dnsBuilder) uint16(v uint16) {
+	b.buf = binary.BigEndian.AppendUint16(b.buf, v)
+}
+
+func (b *dnsBuilder) header(id, flags uint16, questions, answers, additional int) {
+	for _, v := range []uint16{id, flags, uint16(questions), uint16(answers), 0, uint16(additional)} {
+		b.uint16(v)
+	}
+}
+
+func (b *dnsBuilder) name(name string) {
+	for _, label := range strings.Split(strings.TrimSuffix(name, "."), ".") {
+		if label == "" {
+			continue
+		}
+		b.buf = append(b.buf, byte(len(label)))
+		b.buf = append(b.buf, label...)
+	}
+	b.buf = append(b.buf, 0)
+}
+
+// record appends a record of the given name and type, with the data
+// data appends.
+func (b *dnsBuilder) record(name string, typ uint16, data func()) {
+	b.name(name)
+	b.uint16(typ)
+	b.uint16(dnsClassIN)
+	b.buf = binary.BigEndian.AppendUint32(b.buf, mdnsTTL)
+	length := len(b.buf)
+	b.uint16(0)
+	data()
+	binary.BigEndian.PutUint16(b.buf[length:], uint16(len(b.buf)-length-2))
+}
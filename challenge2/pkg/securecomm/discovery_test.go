@@ -0,0 +1,83 @@
+package securecomm
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func TestBrowse(t *testing.T) {
+	// Stand in for the multicast group with a socket on loopback, so
+	// the test needs no multicast routing.
+	pc, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pc.Close()
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &mdnsResponder{
+		name:        "Office Printer",
+		host:        "office.local.",
+		port:        8080,
+		fingerprint: Fingerprint(key.Public),
+		ips:         []net.IP{net.IPv4(192, 0, 2, 7)},
+	}
+	go r.serve(pc)
+
+	client, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+
+	peers, err := browse(client, pc.LocalAddr(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Peer{Name: "Office Printer", Addr: "192.0.2.7:8080", Fingerprint: Fingerprint(key.Public)}
+	if len(peers) != 1 || peers[0] != want {
+		t.Fatalf("Expected %+v, got %+v", want, peers)
+	}
+
+	// Without an address record, the server is reached where it answered
+	// from.
+	bare, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bare.Close()
+	go (&mdnsResponder{name: "Office Printer", host: "office.local.", port: 8080}).serve(bare)
+
+	peers, err = browse(client, bare.LocalAddr(), 200*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want = Peer{Name: "Office Printer", Addr: "127.0.0.1:8080"}
+	if len(peers) != 1 || peers[0] != want {
+		t.Fatalf("Expected %+v, got %+v", want, peers)
+	}
+}
+
+func TestReadDNSName(t *testing.T) {
+	// "local." at 0, then "a.local." pointing back to it.
+	msg := []byte{5, 'l', 'o', 'c', 'a', 'l', 0, 1, 'a', 0xc0, 0}
+	name, next, err := readDNSName(msg, 7)
+	if err != nil || name != "a.local." || next != len(msg) {
+		t.Errorf("Unexpected name %q, %d, %v", name, next, err)
+	}
+
+	for _, bad := range [][]byte{
+		{3, 'a', 'b'},     // truncated label
+		{0xc0, 0},         // pointer to itself
+		{0xc0},            // truncated pointer
+		{64, 'a', 'b', 0}, // label too long
+	} {
+		if _, _, err := readDNSName(bad, 0); err == nil {
+			t.Errorf("Expected %v to be refused", bad)
+		}
+	}
+}
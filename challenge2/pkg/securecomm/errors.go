@@ -0,0 +1,144 @@
+package securecomm
+
+import "github.com/jpreese/go-mentor/challenge2/internal/errcode"
+
+// ErrMessageTooLarge is returned when a peer's frame announces a payload
+// larger than the reader's MaxMessageSize, or sends a message larger
+// than its MaxReassembledSize.
+var ErrMessageTooLarge = errcode.New(errcode.SecureMessageTooLarge, "message too large")
+
+// ErrReplayed is returned when a frame arrives out of sequence, which
+// means it was replayed, reordered or dropped on the way.
+var ErrReplayed = errcode.New(errcode.SecureReplayed, "frame out of sequence")
+
+// ErrDecryptFailed is returned when a frame does not decrypt, because it
+// was corrupted or forged or sealed with another key. Readers return it
+// wrapped in a *DecryptError saying which frame it was.
+var ErrDecryptFailed = errcode.New(errcode.SecureDecryptFailed, "message failed to decrypt")
+
+// ErrBadHandshake is returned when the peer breaks the handshake
+// protocol: it does not speak it, offers no mode we can use, or sends
+// handshake messages that are malformed or fail authentication.
+var ErrBadHandshake = errcode.New(errcode.SecureBadHandshake, "bad handshake")
+
+// ErrTranscriptMismatch is returned by the handshake when the peer saw
+// different preambles or keys than we did, which means someone altered
+// them in transit.
+var ErrTranscriptMismatch = errcode.New(errcode.SecureTranscriptMismatch, "handshake transcript mismatch")
+
+// ErrPassphraseRequired is returned when loading an encrypted key
+// without a passphrase.
+var ErrPassphraseRequired = errcode.New(errcode.SecurePassphraseRequired, "key is encrypted and needs a passphrase")
+
+// ErrIncorrectPassphrase is returned when an encrypted key does not open
+// with the passphrase given.
+var ErrIncorrectPassphrase = errcode.New(errcode.SecureIncorrectPassphrase, "incorrect key passphrase")
+
+// ErrHostKeyRejected is returned when KnownHosts.Confirm declines to
+// trust a new server.
+var ErrHostKeyRejected = errcode.New(errcode.SecureHostKeyRejected, "host key rejected")
+
+// ErrPeerNotFound is returned by DialRendezvous when the peer is not
+// waiting at the relay.
+var ErrPeerNotFound = errcode.New(errcode.SecurePeerNotFound, "peer not waiting at the relay")
+
+// ErrRelayFull is returned by DialRendezvous when the relay is relaying
+// as many pairs of peers as it may.
+var ErrRelayFull = errcode.New(errcode.SecureRelayFull, "relay is full")
+
+// ErrUnexpectedPeer is returned by DialRendezvous when the peer it
+// reached does not hold the key it asked for.
+var ErrUnexpectedPeer = errcode.New(errcode.SecureUnexpectedPeer, "peer holds an unexpected identity key")
+
+// ErrNoPeerIdentity is returned when the server must be verified but
+// did not present an identity key.
+var ErrNoPeerIdentity = errcode.New(errcode.SecureNoPeerIdentity, "peer presented no identity key")
+
+// ErrUnauthorizedKey is returned when a client's identity key is not
+// among the server's authorized keys.
+var ErrUnauthorizedKey = errcode.New(errcode.SecureUnauthorizedKey, "identity key not authorized")
+
+// ErrBadSignature is returned when the peer's handshake signature does
+// not verify.
+var ErrBadSignature = errcode.New(errcode.SecureBadSignature, "bad handshake signature")
+
+// ErrUntrustedSigner is returned when the peer signed the handshake with
+// a key that is not among the trusted signers.
+var ErrUntrustedSigner = errcode.New(errcode.SecureUntrustedSigner, "handshake signed by an untrusted key")
+
+// ErrWriteClosed is returned when writing after CloseWrite.
+var ErrWriteClosed = errcode.New(errcode.SecureWriteClosed, "write after close")
+
+// ErrPSKMismatch is returned by the handshake when only one side is
+// configured with a pre-shared key.
+var ErrPSKMismatch = errcode.New(errcode.SecurePSKMismatch, "only one side uses a pre-shared key")
+
+// ErrPeerUnresponsive is returned by reads and writes on a connection
+// closed because the peer stopped answering keepalive pings.
+var ErrPeerUnresponsive = errcode.New(errcode.SecurePeerUnresponsive, "peer stopped answering keepalive pings")
+
+// ErrProxyRefused is returned when a proxy refuses to connect us to the
+// server, or to accept our credentials.
+var ErrProxyRefused = errcode.New(errcode.SecureProxyRefused, "proxy refused the connection")
+
+// ErrPassphraseMismatch is returned by the handshake when only one side
+// is configured with a passphrase.
+var ErrPassphraseMismatch = errcode.New(errcode.SecurePassphraseMismatch, "only one side uses a passphrase")
+
+// ErrServerClosed is returned by Server.Serve once the server is shut
+// down or closed.
+var ErrServerClosed = errcode.New(errcode.SecureServerClosed, "server closed")
+
+// ErrTooManyConnections is returned for a connection LimitConnections
+// turned away.
+var ErrTooManyConnections = errcode.New(errcode.SecureTooManyConnections, "too many connections")
+
+// ErrAckUnsupported is returned by WriteMsgAck when the peer does not
+// acknowledge messages.
+var ErrAckUnsupported = errcode.New(errcode.SecureAckUnsupported, "peer does not acknowledge messages")
+
+// ErrChecksumMismatch is returned when a file sent with SendFile does
+// not match the SHA-256 in its manifest once received.
+var ErrChecksumMismatch = errcode.New(errcode.SecureChecksumMismatch, "file does not match its checksum")
+
+// ErrRateLimited is returned when a client sends faster than a
+// RateLimiter allows. The server closes the connection, and the client's
+// reads fail with it too when it understands close reasons.
+var ErrRateLimited = errcode.New(errcode.SecureRateLimited, "rate limit exceeded")
+
+// ErrNonceExhausted is returned when a connection sealed as many frames
+// with one key as it safely may and its peer cannot rekey, or when the
+// peer sent more than that. The connection is closed.
+var ErrNonceExhausted = errcode.New(errcode.SecureNonceExhausted, "nonces exhausted")
+
+// ErrFrameRejected is returned by reads on a connection whose peer
+// rejected a frame we sent, as failing to decrypt, out of sequence or
+// too large. The peer does not say which.
+var ErrFrameRejected = errcode.New(errcode.SecureFrameRejected, "peer rejected a frame")
+
+// ErrIdleTimeout is returned by reads and writes on a connection closed
+// because it went without frames for longer than its IdlePolicy allows.
+var ErrIdleTimeout = errcode.New(errcode.SecureIdleTimeout, "connection idle for too long")
+
+// ErrMaxLifetime is returned by reads and writes on a connection closed
+// because it reached the end of its LifetimePolicy, and by the peer's
+// reads when it understands close reasons.
+var ErrMaxLifetime = errcode.New(errcode.SecureMaxLifetime, "connection reached its maximum lifetime")
+
+// ErrBanned is returned for a client the server's BanList refuses.
+var ErrBanned = errcode.New(errcode.SecureBanned, "client is banned")
+
+// ErrAgentKeyNotFound is returned by an agent asked to use a key it does
+// not hold.
+var ErrAgentKeyNotFound = errcode.New(errcode.SecureAgentKeyNotFound, "key not held by the agent")
+
+// ErrIncorrectPIN is returned when a PIV token rejects its PIN.
+var ErrIncorrectPIN = errcode.New(errcode.SecureIncorrectPIN, "incorrect PIN")
+
+// ErrNotRecipient is returned by OpenSealed for a message not sealed for
+// the key it was given.
+var ErrNotRecipient = errcode.New(errcode.SecureNotRecipient, "not a recipient of the message")
+
+// ErrNoCaptureKeys is returned by Replay for a connection its capture
+// holds no keys for, as one made without Capture.Keys.
+var ErrNoCaptureKeys = errcode.New(errcode.SecureNoCaptureKeys, "capture holds no keys")
@@ -0,0 +1,187 @@
+package securecomm
+
+import (
+	"errors"
+	"fmt"
+)
+
+// fecCode is a systematic Reed-Solomon erasure code over GF(2^8): data
+// shards are sent as they are, followed by parity shards, and any data
+// shards among them that go missing can be rebuilt from any others
+// that arrive, as long as at least as many shards arrive in total as
+// there were data shards.
+//
+// Parity is computed with a Cauchy matrix, every square submatrix of
+// which is invertible, so any choice of surviving shards will do.
+type fecCode struct {
+	data, parity int
+
+	// matrix holds the coefficients of each parity shard.
+	matrix [][]byte
+}
+
+// maxFECShards bounds the data and parity shards of a group, which the
+// receiver must hold until the group is complete.
+const maxFECShards = 64
+
+func newFECCode(data, parity int) (*fecCode, error) {
+	if data < 1 || parity < 1 || data+parity > maxFECShards {
+		return nil, fmt.Errorf("forward error correction with %d data and %d parity shards: need at least one of each and at most %d in all", data, parity, maxFECShards)
+	}
+
+	c := &fecCode{data: data, parity: parity}
+	c.matrix = make([][]byte, parity)
+	for i := range c.matrix {
+		c.matrix[i] = c.row(data + i)
+	}
+
+	return c, nil
+}
+
+// row returns the coefficients that make up shard i from the data
+// shards.
+func (c *fecCode) row(i int) []byte {
+	row := make([]byte, c.data)
+	if i < c.data {
+		row[i] = 1
+		return row
+	}
+
+	for j := range row {
+		row[j] = gfInv(byte(i) ^ byte(j))
+	}
+
+	return row
+}
+
+// encode returns the parity shards for data, whose shards must all be
+// the same length.
+func (c *fecCode) encode(data [][]byte) [][]byte {
+	parity := make([][]byte, c.parity)
+	for i, coefficients := range c.matrix {
+		parity[i] = make([]byte, len(data[0]))
+		for j, shard := range data {
+			gfMulAdd(parity[i], shard, coefficients[j])
+		}
+	}
+
+	return parity
+}
+
+var errTooFewShards = errors.New("too few shards to reconstruct")
+
+// reconstruct fills in the missing data shards of shards, which holds
+// the data shards followed by the parity shards, nil where missing. The
+// shards present must all be the same length.
+func (c *fecCode) reconstruct(shards [][]byte) error {
+	// Solve for the data from the first data shards present, then
+	// parity shards for the rest.
+	rows := make([][]byte, 0, c.data)
+	var present [][]byte
+	for i, shard := range shards {
+		if shard != nil && len(rows) < c.data {
+			rows = append(rows, c.row(i))
+			present = append(present, shard)
+		}
+	}
+	if len(rows) < c.data {
+		return errTooFewShards
+	}
+
+	inverse, err := gfInvert(rows)
+	if err != nil {
+		return err
+	}
+
+	for i := 0; i < c.data; i++ {
+		if shards[i] != nil {
+			continue
+		}
+		shards[i] = make([]byte, len(present[0]))
+		for j, shard := range present {
+			gfMulAdd(shards[i], shard, inverse[i][j])
+		}
+	}
+
+	return nil
+}
+
+// GF(2^8) with the polynomial x^8 + x^4 + x^3 + x^2 + 1, generated by 2.
+var gfExp, gfLog = gfTables()
+
+func gfTables() (exp [512]byte, log [256]byte) {
+	x := 1
+	for i := 0; i < 255; i++ {
+		exp[i] = byte(x)
+		log[x] = byte(i)
+		x <<= 1
+		if x&0x100 != 0 {
+			x ^= 0x11d
+		}
+	}
+	for i := 255; i < len(exp); i++ {
+		exp[i] = exp[i-255]
+	}
+
+	return exp, log
+}
+
+func gfMul(a, b byte) byte {
+	if a == 0 || b == 0 {
+		return 0
+	}
+
+	return gfExp[int(gfLog[a])+int(gfLog[b])]
+}
+
+func gfInv(a byte) byte {
+	return gfExp[255-int(gfLog[a])]
+}
+
+// gfMulAdd adds c times src to dst.
+func gfMulAdd(dst, src []byte, c byte) {
+	for i, b := range src {
+		dst[i] ^= gfMul(c, b)
+	}
+}
+
+// gfInvert returns the inverse of the square matrix m, found by
+// Gauss-Jordan elimination.
+func gfInvert(m [][]byte) ([][]byte, error) {
+	n := len(m)
+	work := make([][]byte, n)
+	for i := range work {
+		work[i] = make([]byte, 2*n)
+		copy(work[i], m[i])
+		work[i][n+i] = 1
+	}
+
+	for col := 0; col < n; col++ {
+		pivot := col
+		for pivot < n && work[pivot][col] == 0 {
+			pivot++
+		}
+		if pivot == n {
+			return nil, errors.New("singular matrix")
+		}
+		work[col], work[pivot] = work[pivot], work[col]
+
+		scale := gfInv(work[col][col])
+		for j := range work[col] {
+			work[col][j] = gfMul(work[col][j], scale)
+		}
+
+		for i := range work {
+			if i != col && work[i][col] != 0 {
+				gfMulAdd(work[i], work[col], work[i][col])
+			}
+		}
+	}
+
+	inverse := make([][]byte, n)
+	for i := range inverse {
+		inverse[i] = work[i][n:]
+	}
+
+	return inverse, nil
+}
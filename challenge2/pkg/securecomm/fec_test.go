@@ -0,0 +1,72 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"testing"
+)
+
+func TestFECReconstruct(t *testing.T) {
+	const data, parity = 4, 3
+
+	c, err := newFECCode(data, parity)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	original := make([][]byte, data)
+	for i := range original {
+		original[i] = make([]byte, 100)
+		if _, err := rand.Read(original[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	all := append(append([][]byte(nil), original...), c.encode(original)...)
+
+	// Every way of losing as many shards as there are parity shards
+	// must be recoverable.
+	for lost := 0; lost < 1<<(data+parity); lost++ {
+		if popcount(lost) != parity {
+			continue
+		}
+
+		shards := make([][]byte, len(all))
+		for i := range shards {
+			if lost&(1<<i) == 0 {
+				shards[i] = all[i]
+			}
+		}
+
+		if err := c.reconstruct(shards); err != nil {
+			t.Fatalf("Losing shards %07b: %v", lost, err)
+		}
+		for i := range original {
+			if !bytes.Equal(shards[i], original[i]) {
+				t.Fatalf("Losing shards %07b: data shard %d rebuilt wrong", lost, i)
+			}
+		}
+	}
+
+	shards := make([][]byte, len(all))
+	copy(shards, all[:data-1])
+	if err := c.reconstruct(shards); !errors.Is(err, errTooFewShards) {
+		t.Fatalf("Expected errTooFewShards, got %v", err)
+	}
+}
+
+func TestNewFECCode(t *testing.T) {
+	for _, test := range []struct{ data, parity int }{{0, 1}, {1, 0}, {40, 30}} {
+		if _, err := newFECCode(test.data, test.parity); err == nil {
+			t.Errorf("Expected %d data and %d parity shards to be refused", test.data, test.parity)
+		}
+	}
+}
+
+func popcount(x int) int {
+	n := 0
+	for ; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
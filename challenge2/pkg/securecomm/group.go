@@ -0,0 +1,497 @@
+package securecomm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Messages between the members of a group and the relay, each an
+// operation, a peer's identity key, and a payload.
+const (
+	// groupMembers is sent by the relay to every member whenever the
+	// group changes, carrying the identity keys of all its members.
+	groupMembers = 1
+
+	// groupKey carries a member's sender key sealed for one other
+	// member, addressed to that member on the way to the relay and
+	// naming the sender on the way from it.
+	groupKey = 2
+
+	// groupText carries a message sealed with the sender's key, sent
+	// to every other member and naming the sender on the way from the
+	// relay.
+	groupText = 3
+)
+
+// maxGroupMembers bounds the members of a group, so that the relay's
+// list of them fits in a message.
+const maxGroupMembers = 256
+
+// groupKeyLabel derives the key two members seal their sender keys for
+// each other with from their identity keys.
+const groupKeyLabel = "go-mentor secure group key"
+
+// groupHeaderSize is the size of the epoch and sequence number that
+// start a sealed group message.
+const groupHeaderSize = 4 + 8
+
+// errGroupFull is returned to a peer joining a group with
+// maxGroupMembers members already.
+var errGroupFull = fmt.Errorf("group has %d members already", maxGroupMembers)
+
+// groupFrame is a message between a group member and the relay.
+type groupFrame struct {
+	op      byte
+	peer    [32]byte
+	payload []byte
+}
+
+func (f groupFrame) marshal() []byte {
+	return append(append([]byte{f.op}, f.peer[:]...), f.payload...)
+}
+
+func (f *groupFrame) unmarshal(b []byte) error {
+	if len(b) < 1+32 {
+		return errors.New("group message truncated")
+	}
+	f.op = b[0]
+	copy(f.peer[:], b[1:])
+	f.payload = b[1+32:]
+
+	return nil
+}
+
+// groupRooms is the groups a Relay serves, by name.
+type groupRooms struct {
+	mu    sync.Mutex
+	rooms map[string]map[[32]byte]*relayClient
+}
+
+// serve keeps the peer with identity in the group named name until it
+// hangs up or ctx is done, passing sealed keys and messages between it
+// and the other members.
+func (g *groupRooms) serve(ctx context.Context, identity [32]byte, sc *SecureConn, name string) error {
+	c := newRelayClient(sc)
+	if err := g.join(name, identity, c); err != nil {
+		return fmt.Errorf("group %q: %w", name, err)
+	}
+	defer g.leave(name, identity)
+
+	return c.serve(ctx, func(message []byte) error {
+		var f groupFrame
+		if err := f.unmarshal(message); err != nil {
+			return err
+		}
+
+		switch f.op {
+		case groupKey:
+			g.send(name, f.peer, groupFrame{op: groupKey, peer: identity, payload: f.payload})
+		case groupText:
+			g.broadcast(name, identity, groupFrame{op: groupText, peer: identity, payload: f.payload})
+		default:
+			return fmt.Errorf("unknown group operation %d", f.op)
+		}
+
+		return nil
+	})
+}
+
+// join adds c to the group as identity and tells every member.
+func (g *groupRooms) join(name string, identity [32]byte, c *relayClient) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.rooms == nil {
+		g.rooms = make(map[string]map[[32]byte]*relayClient)
+	}
+	room := g.rooms[name]
+	if room == nil {
+		room = make(map[[32]byte]*relayClient)
+		g.rooms[name] = room
+	}
+	if room[identity] != nil {
+		return fmt.Errorf("%s is a member already", Fingerprint(identity))
+	}
+	if len(room) == maxGroupMembers {
+		return errGroupFull
+	}
+	room[identity] = c
+	g.announceLocked(room)
+
+	return nil
+}
+
+// leave takes identity out of the group and tells the members left.
+func (g *groupRooms) leave(name string, identity [32]byte) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	room := g.rooms[name]
+	delete(room, identity)
+	if len(room) == 0 {
+		delete(g.rooms, name)
+		return
+	}
+	g.announceLocked(room)
+}
+
+// announceLocked sends every member of room the list of them.
+func (g *groupRooms) announceLocked(room map[[32]byte]*relayClient) {
+	f := groupFrame{op: groupMembers, payload: make([]byte, 0, 32*len(room))}
+	for identity := range room {
+		f.payload = append(f.payload, identity[:]...)
+	}
+	message := f.marshal()
+	for _, c := range room {
+		c.enqueue(message)
+	}
+}
+
+// send queues f for the member to, if it is still in the group.
+func (g *groupRooms) send(name string, to [32]byte, f groupFrame) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if c := g.rooms[name][to]; c != nil {
+		c.enqueue(f.marshal())
+	}
+}
+
+// broadcast queues f for every member but from.
+func (g *groupRooms) broadcast(name string, from [32]byte, f groupFrame) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	message := f.marshal()
+	for identity, c := range g.rooms[name] {
+		if identity != from {
+			c.enqueue(message)
+		}
+	}
+}
+
+// A Group is our membership of a group of peers meeting at a relay,
+// whose messages are encrypted end to end so that the relay, which
+// only passes them on, cannot read them.
+//
+// Each member seals its messages with a sender key of its own, which it
+// sends every other member sealed with a key their identity keys agree
+// on. Whenever a member joins or leaves, every member replaces its
+// sender key and sends the new one only to the members there now, so
+// that those who left cannot read what follows and those who joined
+// cannot read what came before. Messages are numbered, so that the
+// relay cannot replay them either; it is trusted to say which member a
+// message comes from only as far as each sender key reaches the members
+// it was sealed for.
+//
+// The relay does decide who the members are, as the list of them comes
+// from it. A relay that names a key of its own as a member is sent our
+// sender key like any other member and can read what follows. To keep
+// the relay out, give JoinGroup WithAuthorizedKeys listing the keys of
+// everyone who may be in the group: members the relay names that are
+// not among them are refused, neither sent our sender key nor heard.
+//
+// Send and Receive may be called from different goroutines.
+type Group struct {
+	conn     *SecureConn
+	identity IdentityKey
+	self     [32]byte
+
+	// roster is who may be a member, anyone the relay names when nil.
+	roster *AuthorizedKeys
+
+	// mu guards what Send and Receive share: the members, our sender
+	// key and where it is in its epoch, and the keys of the others.
+	mu      sync.Mutex
+	members [][32]byte
+	epoch   uint32
+	key     [32]byte
+	seq     uint64
+	keys    map[[32]byte]*senderKey
+
+	// pairwise holds the keys sender keys are sealed with, by member.
+	pairwise map[[32]byte]*[32]byte
+}
+
+// senderKey is another member's sender key, and the sequence number its
+// next message must have at least.
+type senderKey struct {
+	epoch uint32
+	key   [32]byte
+	next  uint64
+}
+
+// A GroupMessage is what Receive returns: a message From a member, or,
+// with no message, the Members of the group now that they changed.
+// Refused holds the members the relay named that the authorized keys
+// did not allow, who are left out of Members.
+type GroupMessage struct {
+	From    [32]byte
+	Message []byte
+	Members [][32]byte
+	Refused [][32]byte
+}
+
+// JoinGroup joins the group called name at the relay conn is connected
+// to, as the holder of identity, the key conn was dialed with. It
+// returns once it has told the members there its sender key. It honors
+// WithAuthorizedKeys, which limits who it takes for a member.
+func JoinGroup(conn *SecureConn, identity IdentityKey, name string, opts ...Option) (*Group, error) {
+	if identity == nil {
+		return nil, errors.New("group: an identity key is required")
+	}
+	if len(name) > 255 {
+		return nil, fmt.Errorf("group: name %q longer than 255 bytes", name)
+	}
+	if err := conn.WriteMsg(append([]byte{rendezvousGroup}, name...)); err != nil {
+		return nil, fmt.Errorf("group: %w", err)
+	}
+
+	g := &Group{
+		conn:     conn,
+		identity: identity,
+		self:     *identity.PublicKey(),
+		roster:   newConfig(opts).authorized,
+		keys:     make(map[[32]byte]*senderKey),
+		pairwise: make(map[[32]byte]*[32]byte),
+	}
+	for {
+		m, err := g.Receive()
+		if err != nil {
+			return nil, err
+		}
+		if m.Members != nil {
+			return g, nil
+		}
+	}
+}
+
+// Members returns the identity keys of the members of the group, us
+// included, as of the last change Receive reported.
+func (g *Group) Members() [][32]byte {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return append([][32]byte(nil), g.members...)
+}
+
+// Send sends message to the other members of the group.
+func (g *Group) Send(message []byte) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	// The lock is held until the message is on its way, so that it
+	// never goes out sealed with a key the members have not been sent.
+	return g.conn.WriteMsg(groupFrame{op: groupText, payload: g.sealLocked(message)}.marshal())
+}
+
+// sealLocked seals message with our sender key, numbering it. The
+// sender key is used only once for each number, which makes the number
+// the nonce.
+func (g *Group) sealLocked(message []byte) []byte {
+	var header [groupHeaderSize]byte
+	binary.BigEndian.PutUint32(header[:4], g.epoch)
+	binary.BigEndian.PutUint64(header[4:], g.seq)
+	var nonce [24]byte
+	copy(nonce[:], header[:])
+	g.seq++
+
+	return secretbox.Seal(header[:], message, &nonce, &g.key)
+}
+
+// Receive returns the next message from another member, or the members
+// of the group once they change. Messages that cannot be read, such as
+// those sent before we joined, are skipped.
+func (g *Group) Receive() (GroupMessage, error) {
+	for {
+		message, err := g.conn.ReadMsg()
+		if err != nil {
+			return GroupMessage{}, err
+		}
+		var f groupFrame
+		if err := f.unmarshal(message); err != nil {
+			return GroupMessage{}, fmt.Errorf("group: %w", err)
+		}
+
+		switch f.op {
+		case groupMembers:
+			members, refused, err := g.rekey(f.payload)
+			if err != nil {
+				return GroupMessage{}, err
+			}
+			return GroupMessage{Members: members, Refused: refused}, nil
+		case groupKey:
+			if err := g.receiveKey(f.peer, f.payload); err != nil {
+				return GroupMessage{}, err
+			}
+		case groupText:
+			if m, ok := g.open(f.peer, f.payload); ok {
+				return GroupMessage{From: f.peer, Message: m}, nil
+			}
+		default:
+			return GroupMessage{}, fmt.Errorf("group: unknown operation %d", f.op)
+		}
+	}
+}
+
+// Close leaves the group and closes the connection to the relay.
+func (g *Group) Close() error {
+	return g.conn.Close()
+}
+
+// rekey takes the list of members the relay sent, forgets the keys of
+// those who left, and sends a new sender key to the rest. It returns the
+// members, and those of the list the roster refused.
+func (g *Group) rekey(list []byte) (members, refused [][32]byte, err error) {
+	if len(list)%32 != 0 {
+		return nil, nil, errors.New("group: malformed member list")
+	}
+	members = make([][32]byte, 0, len(list)/32)
+	present := make(map[[32]byte]bool)
+	for i := 0; i < len(list); i += 32 {
+		var member [32]byte
+		copy(member[:], list[i:])
+		if !g.allowed(member) {
+			refused = append(refused, member)
+			continue
+		}
+		members = append(members, member)
+		present[member] = true
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.members = members
+	for member := range g.keys {
+		if !present[member] {
+			delete(g.keys, member)
+			delete(g.pairwise, member)
+		}
+	}
+
+	g.epoch++
+	g.seq = 0
+	if _, err := io.ReadFull(rand.Reader, g.key[:]); err != nil {
+		return nil, nil, fmt.Errorf("group: generate sender key: %w", err)
+	}
+
+	var plain [32 + 4 + 32]byte
+	copy(plain[:32], g.self[:])
+	binary.BigEndian.PutUint32(plain[32:], g.epoch)
+	copy(plain[36:], g.key[:])
+	for _, member := range members {
+		if member == g.self {
+			continue
+		}
+		pairwise, err := g.pairwiseKey(member)
+		if err != nil {
+			return nil, nil, err
+		}
+		var nonce [24]byte
+		if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+			return nil, nil, fmt.Errorf("group: generate nonce: %w", err)
+		}
+		sealed := secretbox.Seal(nonce[:], plain[:], &nonce, pairwise)
+		if err := g.conn.WriteMsg(groupFrame{op: groupKey, peer: member, payload: sealed}.marshal()); err != nil {
+			return nil, nil, fmt.Errorf("group: send sender key: %w", err)
+		}
+	}
+
+	return append([][32]byte(nil), members...), refused, nil
+}
+
+// allowed reports whether the roster lets member be in the group. We
+// always may.
+func (g *Group) allowed(member [32]byte) bool {
+	return g.roster == nil || member == g.self || g.roster.Allowed(member)
+}
+
+// receiveKey opens the sender key from sent by from and keeps it. Keys
+// from those the roster refuses are ignored, so that nothing they send
+// can be read.
+func (g *Group) receiveKey(from [32]byte, sealed []byte) error {
+	if !g.allowed(from) {
+		return nil
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	pairwise, err := g.pairwiseKey(from)
+	if err != nil {
+		return err
+	}
+	if len(sealed) < 24 {
+		return errors.New("group: sender key truncated")
+	}
+	var nonce [24]byte
+	copy(nonce[:], sealed)
+	plain, ok := secretbox.Open(nil, sealed[24:], &nonce, pairwise)
+	// The sender names itself inside the seal, so that a key cannot be
+	// passed off as coming from the member it was sealed for.
+	if !ok || len(plain) != 32+4+32 || [32]byte(plain[:32]) != from {
+		return fmt.Errorf("group: sender key from %s: %w", Fingerprint(from), ErrDecryptFailed)
+	}
+
+	sk := &senderKey{epoch: binary.BigEndian.Uint32(plain[32:])}
+	copy(sk.key[:], plain[36:])
+	if old := g.keys[from]; old != nil && sk.epoch <= old.epoch {
+		return fmt.Errorf("group: sender key from %s: %w", Fingerprint(from), ErrReplayed)
+	}
+	g.keys[from] = sk
+
+	return nil
+}
+
+// open opens a message from sent with its sender key, reporting whether
+// it could.
+func (g *Group) open(from [32]byte, sealed []byte) ([]byte, bool) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	sk := g.keys[from]
+	if sk == nil || len(sealed) < groupHeaderSize {
+		return nil, false
+	}
+	epoch, seq := binary.BigEndian.Uint32(sealed), binary.BigEndian.Uint64(sealed[4:])
+	if epoch != sk.epoch || seq < sk.next {
+		return nil, false
+	}
+	var nonce [24]byte
+	copy(nonce[:], sealed[:groupHeaderSize])
+	message, ok := secretbox.Open(nil, sealed[groupHeaderSize:], &nonce, &sk.key)
+	if !ok {
+		return nil, false
+	}
+	sk.next = seq + 1
+
+	return message, true
+}
+
+// pairwiseKey returns the key our sender keys and member's are sealed
+// with for each other.
+func (g *Group) pairwiseKey(member [32]byte) (*[32]byte, error) {
+	if key := g.pairwise[member]; key != nil {
+		return key, nil
+	}
+
+	shared, err := precomputeWith(g.identity, &member)
+	if err != nil {
+		return nil, fmt.Errorf("group: identity key: %w", err)
+	}
+	key, err := deriveKey(shared, nil, groupKeyLabel)
+	if err != nil {
+		return nil, err
+	}
+	g.pairwise[member] = key
+
+	return key, nil
+}
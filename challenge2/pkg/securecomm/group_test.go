@@ -0,0 +1,278 @@
+package securecomm
+
+import (
+	"context"
+	"encoding/hex"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// joinGroup dials the relay at addr as a new member of the group name.
+func joinGroup(t *testing.T, addr, name string) (*Group, *KeyPair) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := Dial(addr, WithIdentity(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, err := JoinGroup(conn, key, name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { g.Close() })
+
+	return g, key
+}
+
+// receiveGroup returns the next message g receives, failing the test if
+// none comes.
+func receiveGroup(t *testing.T, g *Group) GroupMessage {
+	t.Helper()
+	g.conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	m, err := g.Receive()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return m
+}
+
+func TestGroup(t *testing.T) {
+	r := new(Relay)
+	s := &Server{Handler: r.Handler()}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	alice, aliceKey := joinGroup(t, addr, "band")
+	if members := alice.Members(); len(members) != 1 || members[0] != aliceKey.Public {
+		t.Fatalf("Expected only ourselves in a new group, got %x", members)
+	}
+
+	bob, bobKey := joinGroup(t, addr, "band")
+	if m := receiveGroup(t, alice); len(m.Members) != 2 {
+		t.Fatalf("Expected to be told of the second member, got %+v", m)
+	}
+	if len(bob.Members()) != 2 {
+		t.Fatalf("Expected the joining member to see both, got %x", bob.Members())
+	}
+
+	// Another group does not hear them.
+	other, _ := joinGroup(t, addr, "other band")
+
+	if err := alice.Send([]byte("one, two")); err != nil {
+		t.Fatal(err)
+	}
+	if m := receiveGroup(t, bob); m.From != aliceKey.Public || string(m.Message) != "one, two" {
+		t.Errorf("Unexpected message %+v", m)
+	}
+	if err := bob.Send([]byte("three, four")); err != nil {
+		t.Fatal(err)
+	}
+	if m := receiveGroup(t, alice); m.From != bobKey.Public || string(m.Message) != "three, four" {
+		t.Errorf("Unexpected message %+v", m)
+	}
+
+	// A third member joins, and everyone switches to new keys.
+	carol, carolKey := joinGroup(t, addr, "band")
+	for _, g := range []*Group{alice, bob} {
+		if m := receiveGroup(t, g); len(m.Members) != 3 {
+			t.Fatalf("Expected to be told of the third member, got %+v", m)
+		}
+	}
+	if err := carol.Send([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	for _, g := range []*Group{alice, bob} {
+		if m := receiveGroup(t, g); m.From != carolKey.Public || string(m.Message) != "hello" {
+			t.Errorf("Unexpected message %+v", m)
+		}
+	}
+
+	// Once one leaves, the rest carry on with keys it never saw.
+	bob.Close()
+	for _, g := range []*Group{alice, carol} {
+		if m := receiveGroup(t, g); len(m.Members) != 2 {
+			t.Fatalf("Expected to be told the member left, got %+v", m)
+		}
+	}
+	if err := alice.Send([]byte("just us")); err != nil {
+		t.Fatal(err)
+	}
+	if m := receiveGroup(t, carol); m.From != aliceKey.Public || string(m.Message) != "just us" {
+		t.Errorf("Unexpected message %+v", m)
+	}
+	if _, ok := carol.keys[bobKey.Public]; ok {
+		t.Error("Expected the key of the member who left to be forgotten")
+	}
+
+	other.conn.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+	if m, err := other.Receive(); err == nil {
+		t.Errorf("Expected nothing for another group, got %+v", m)
+	}
+}
+
+func TestGroupOpen(t *testing.T) {
+	sender := &Group{epoch: 2, key: [32]byte{1}}
+	from := [32]byte{9}
+	receiver := &Group{keys: map[[32]byte]*senderKey{from: {epoch: 2, key: [32]byte{1}}}}
+
+	first, second := sender.sealLocked([]byte("first")), sender.sealLocked([]byte("second"))
+	if m, ok := receiver.open(from, first); !ok || string(m) != "first" {
+		t.Fatalf("Expected to open the first message, got %q, %v", m, ok)
+	}
+
+	// The relay can neither replay messages nor pass them off as
+	// another member's, nor alter them.
+	if _, ok := receiver.open(from, first); ok {
+		t.Error("Expected a replayed message to be skipped")
+	}
+	if _, ok := receiver.open([32]byte{8}, second); ok {
+		t.Error("Expected a message from a member without a key to be skipped")
+	}
+	tampered := append([]byte(nil), second...)
+	tampered[len(tampered)-1] ^= 1
+	if _, ok := receiver.open(from, tampered); ok {
+		t.Error("Expected a tampered message to be skipped")
+	}
+	if m, ok := receiver.open(from, second); !ok || string(m) != "second" {
+		t.Errorf("Expected to open the second message, got %q, %v", m, ok)
+	}
+
+	// Nor can it pass off a message sealed with an earlier key.
+	sender.epoch--
+	if _, ok := receiver.open(from, sender.sealLocked([]byte("stale"))); ok {
+		t.Error("Expected a message from an earlier epoch to be skipped")
+	}
+}
+
+// injectingRelay starts a relay that adds mallory, whose key it holds,
+// to the group of whoever joins, passes them mallory's sender key and a
+// message sealed with it, and then announces the members again. It
+// sends on the returned channel the members each sender key it is given
+// is for.
+func injectingRelay(t *testing.T, mallory *KeyPair) (string, <-chan [32]byte) {
+	sentTo := make(chan [32]byte, 16)
+	handler := func(ctx context.Context, conn *SecureConn) error {
+		defer close(sentTo)
+
+		if _, err := conn.ReadMsg(); err != nil {
+			return err
+		}
+		joined, _ := conn.PeerIdentity()
+		members := groupFrame{op: groupMembers, payload: append(joined[:], mallory.Public[:]...)}
+		if err := conn.WriteMsg(members.marshal()); err != nil {
+			return err
+		}
+
+		m := &Group{identity: mallory, epoch: 1, key: [32]byte{7}, pairwise: make(map[[32]byte]*[32]byte)}
+		pairwise, err := m.pairwiseKey(joined)
+		if err != nil {
+			return err
+		}
+		var plain [32 + 4 + 32]byte
+		copy(plain[:32], mallory.Public[:])
+		plain[35] = 1
+		copy(plain[36:], m.key[:])
+		var nonce [24]byte
+		key := groupFrame{op: groupKey, peer: mallory.Public, payload: secretbox.Seal(nonce[:], plain[:], &nonce, pairwise)}
+		text := groupFrame{op: groupText, peer: mallory.Public, payload: m.sealLocked([]byte("from the relay"))}
+		for _, f := range []groupFrame{key, text, members} {
+			if err := conn.WriteMsg(f.marshal()); err != nil {
+				return err
+			}
+		}
+
+		for {
+			conn.SetReadDeadline(time.Now().Add(time.Second))
+			message, err := conn.ReadMsg()
+			if err != nil {
+				return nil
+			}
+			var f groupFrame
+			if err := f.unmarshal(message); err == nil && f.op == groupKey {
+				sentTo <- f.peer
+			}
+		}
+	}
+
+	s := &Server{Handler: handler}
+	addr, _ := startServer(t, s)
+	t.Cleanup(func() { s.Close() })
+
+	return addr, sentTo
+}
+
+func TestGroupRelayInjectsMember(t *testing.T) {
+	alice, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	mallory, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "authorized_keys")
+	if err := ioutil.WriteFile(path, []byte(hex.EncodeToString(bob.Public[:])+" bob\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	roster, err := LoadAuthorizedKeys(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	join := func(opts ...Option) (*Group, <-chan [32]byte) {
+		addr, sentTo := injectingRelay(t, mallory)
+		conn, err := Dial(addr, WithIdentity(alice))
+		if err != nil {
+			t.Fatal(err)
+		}
+		g, err := JoinGroup(conn, alice, "band", opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { g.Close() })
+
+		return g, sentTo
+	}
+
+	// Without a roster the relay is trusted with who is in the group:
+	// the member it made up gets our sender key and is heard.
+	g, sentTo := join()
+	if members := g.Members(); len(members) != 2 {
+		t.Fatalf("Expected the relay's member to be taken for one, got %x", members)
+	}
+	if m := receiveGroup(t, g); m.From != mallory.Public || string(m.Message) != "from the relay" {
+		t.Fatalf("Expected the relay's member to be heard, got %+v", m)
+	}
+	if to := <-sentTo; to != mallory.Public {
+		t.Fatalf("Expected our sender key to go to the relay's member, went to %x", to)
+	}
+
+	// With one, it is refused, and neither gets our sender key nor is
+	// heard.
+	g, sentTo = join(WithAuthorizedKeys(roster))
+	if members := g.Members(); len(members) != 1 || members[0] != alice.Public {
+		t.Fatalf("Expected only ourselves in the group, got %x", members)
+	}
+	m := receiveGroup(t, g)
+	if m.Message != nil || len(m.Members) != 1 {
+		t.Fatalf("Expected the relay's message to be skipped, got %+v", m)
+	}
+	if len(m.Refused) != 1 || m.Refused[0] != mallory.Public {
+		t.Errorf("Expected the relay's member to be reported refused, got %x", m.Refused)
+	}
+	for to := range sentTo {
+		t.Errorf("Expected no sender key to be sent, one went to %x", to)
+	}
+}
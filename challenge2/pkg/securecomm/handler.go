@@ -0,0 +1,91 @@
+package securecomm
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+)
+
+// A Handler serves a connection once its handshake completes. ctx is
+// done once the server starts shutting down, which a long-running
+// handler should take as a request to finish up. The server closes conn
+// when the handler returns, and passes any error it returns to the
+// error handler.
+type Handler func(ctx context.Context, conn *SecureConn) error
+
+// EchoHandler sends back whatever the client sends until it half-closes
+// the connection, then half-closes it in turn. It is the handler Serve
+// uses when given none.
+func EchoHandler(ctx context.Context, conn *SecureConn) error {
+	if _, err := io.Copy(conn, conn); err != nil {
+		return fmt.Errorf("echo: %w", err)
+	}
+
+	// Tell a client that half-closed the connection that the echo is
+	// complete.
+	if err := conn.CloseWrite(); err != nil {
+		return fmt.Errorf("close write: %w", err)
+	}
+
+	return nil
+}
+
+// A Middleware wraps a Handler with behavior of its own, such as
+// logging or limiting connections.
+type Middleware func(Handler) Handler
+
+// Chain wraps h in middleware, the first outermost, so that it sees each
+// connection first.
+func Chain(h Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		h = middleware[i](h)
+	}
+
+	return h
+}
+
+// Logging logs each connection's peer, and how long it lasted and how it
+// ended, to logger, or slog's default logger when nil.
+func Logging(logger *slog.Logger) Middleware {
+	if logger == nil {
+		logger = slog.Default()
+	}
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, conn *SecureConn) error {
+			logger := logger.With("remote", conn.RemoteAddr().String())
+			logger.Info("connected", "peer", conn.peerFingerprint())
+
+			start := conn.clock.Now()
+			err := next(ctx, conn)
+			duration := conn.clock.Now().Sub(start)
+			if err != nil {
+				logger.Info("disconnected", "duration", duration, "err", err)
+			} else {
+				logger.Info("disconnected", "duration", duration)
+			}
+
+			return err
+		}
+	}
+}
+
+// LimitConnections refuses connections beyond the first n at once,
+// closing them with ErrTooManyConnections.
+func LimitConnections(n int) Middleware {
+	slots := make(chan struct{}, n)
+
+	return func(next Handler) Handler {
+		return func(ctx context.Context, conn *SecureConn) error {
+			select {
+			case slots <- struct{}{}:
+			default:
+				return ErrTooManyConnections
+			}
+			defer func() { <-slots }()
+
+			return next(ctx, conn)
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package securecomm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestServeHandler(t *testing.T) {
+	l := testutil.Listen(t)
+
+	go Serve(l, func(ctx context.Context, conn *SecureConn) error {
+		message, err := conn.ReadMsg()
+		if err != nil {
+			return err
+		}
+		return conn.WriteMsg(bytes.ToUpper(message))
+	})
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := conn.WriteMsg([]byte("shout")); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.ReadMsg(); err != nil || string(reply) != "SHOUT" {
+		t.Fatalf("Unexpected reply %q, %v", reply, err)
+	}
+	// The server closes the connection once the handler returns.
+	if _, err := conn.ReadMsg(); err == nil {
+		t.Fatal("Expected the connection to be closed")
+	}
+}
+
+func TestChain(t *testing.T) {
+	var order []string
+	trace := func(name string) Middleware {
+		return func(next Handler) Handler {
+			return func(ctx context.Context, conn *SecureConn) error {
+				order = append(order, name)
+				return next(ctx, conn)
+			}
+		}
+	}
+
+	h := Chain(func(ctx context.Context, conn *SecureConn) error {
+		order = append(order, "handler")
+		return nil
+	}, trace("outer"), trace("inner"))
+	if err := h(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := strings.Join(order, " "); got != "outer inner handler" {
+		t.Fatalf("Ran %q, expected the middleware in order before the handler", got)
+	}
+}
+
+// lockedBuffer is a bytes.Buffer safe to log to from the server's
+// goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestLogging(t *testing.T) {
+	l := testutil.Listen(t)
+
+	var logs lockedBuffer
+	done := make(chan struct{})
+	logged := func(next Handler) Handler {
+		return func(ctx context.Context, conn *SecureConn) error {
+			defer close(done)
+			return next(ctx, conn)
+		}
+	}
+	go Serve(l, Chain(EchoHandler, logged, Logging(slog.New(slog.NewTextHandler(&logs, nil)))))
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.Copy(ioutil.Discard, conn); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("The handler did not return")
+	}
+	remote := "remote=" + conn.LocalAddr().String()
+	for _, expected := range []string{"msg=connected " + remote + " peer=none\n", "msg=disconnected " + remote + " duration="} {
+		if !strings.Contains(logs.String(), expected) {
+			t.Errorf("Expected the log to contain %q, got %q", expected, logs.String())
+		}
+	}
+}
+
+func TestLimitConnections(t *testing.T) {
+	l := testutil.Listen(t)
+
+	errs := make(chan error, 16)
+	go Serve(l, Chain(EchoHandler, LimitConnections(1)), WithErrorHandler(func(addr net.Addr, err error) {
+		select {
+		case errs <- err:
+		default:
+		}
+	}))
+
+	first := dialEchoed(t, l.Addr().String())
+	defer first.Close()
+
+	second, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	second.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := second.ReadMsg(); err == nil {
+		t.Error("Expected a connection over the limit to be closed")
+	}
+	if err := <-errs; !errors.Is(err, ErrTooManyConnections) {
+		t.Errorf("Expected ErrTooManyConnections, got %v", err)
+	}
+
+	// Once the first hangs up there is room again.
+	first.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := Dial(l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		err = conn.WriteMsg([]byte("ping"))
+		if err == nil {
+			_, err = conn.ReadMsg()
+		}
+		conn.Close()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("No room after the first connection closed: %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestHandlerContextDoneOnShutdown(t *testing.T) {
+	finishing := make(chan struct{})
+	s := &Server{Handler: func(ctx context.Context, conn *SecureConn) error {
+		if err := conn.WriteMsg([]byte("ready")); err != nil {
+			return err
+		}
+		<-ctx.Done()
+		close(finishing)
+		return nil
+	}}
+	addr, _ := startServer(t, s)
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ReadMsg(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+	select {
+	case <-finishing:
+	default:
+		t.Fatal("Expected the handler to see its context done")
+	}
+}
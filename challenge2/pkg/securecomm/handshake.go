@@ -0,0 +1,727 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/hkdf"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/salsa20/salsa"
+)
+
+// Every handshake opens with a preamble: the magic bytes, the lowest and
+// highest protocol versions the sender speaks and a bitmap of the
+// optional features it supports. Both sides then use the highest version
+// and the features they have in common, so new frame types and ciphers
+// can be introduced without breaking older peers.
+const (
+	preambleMagic = "GMSC"
+	preambleSize  = len(preambleMagic) + 2 + 4
+
+	minVersion = 1
+	maxVersion = 1
+)
+
+// Optional protocol features.
+const (
+	// featureRekey means the peer understands rekey frames.
+	featureRekey uint32 = 1 << iota
+
+	// featureNoiseXX and featureNoiseIK mean the peer wants to use, or
+	// as a server will answer, a Noise handshake with that pattern.
+	// They are only advertised when configured with WithNoise.
+	featureNoiseXX
+	featureNoiseIK
+
+	// featureIdentity means the peer sends an identity key along with
+	// its key for the legacy key swap.
+	featureIdentity
+
+	// featureSigned means the peer signs the legacy handshake with an
+	// Ed25519 key.
+	featureSigned
+
+	// featurePSK means the peer mixes a pre-shared key into the
+	// session keys.
+	featurePSK
+
+	// featurePassphrase means the peer mixes a stretched passphrase
+	// into the session keys and sends a salt after its preamble.
+	featurePassphrase
+
+	// featureXChaCha20Poly1305 means the peer can seal frames with
+	// CipherXChaCha20Poly1305. It is only advertised when configured
+	// with WithCipherSuite.
+	featureXChaCha20Poly1305
+
+	// featurePadding means the peer understands padded frames.
+	featurePadding
+
+	// featureTickets means the peer issues session tickets as a server
+	// or keeps them as a client.
+	featureTickets
+
+	// featureResume means the client sends a session ticket and a nonce
+	// after its preamble, hoping to resume that session.
+	featureResume
+
+	// featureClose means the peer understands close frames.
+	featureClose
+
+	// featureBinding means the peer binds its frame keys to the
+	// handshake once it completes.
+	featureBinding
+
+	// featureCompression means the peer wants compressed frames. It is
+	// only advertised when configured with WithCompression.
+	featureCompression
+
+	// featureKeepalive means the peer answers ping frames.
+	featureKeepalive
+
+	// featureAck means the peer acknowledges messages that ask for it.
+	featureAck
+
+	// featureLifetime means the peer understands a notice that we are
+	// about to close the connection for reaching its maximum lifetime.
+	featureLifetime
+
+	// featureRotation means the server announces the identity key it
+	// is rotating to once the legacy handshake completes, or the
+	// client pins identity keys and wants to hear of it.
+	featureRotation
+
+	// featureCompressionSnappy and featureCompressionZstd mean the peer
+	// can compress frames with that algorithm rather than DEFLATE. They
+	// are only advertised for the Compressors given to WithCompression.
+	featureCompressionSnappy
+	featureCompressionZstd
+)
+
+// supportedFeatures is the feature bitmap we always advertise.
+const supportedFeatures = featureRekey | featurePadding | featureClose | featureBinding | featureKeepalive | featureAck | featureLifetime
+
+// A VersionError is returned by the handshake when the peer speaks no
+// protocol version in common with us.
+type VersionError struct {
+	// Min and Max are the versions we support.
+	Min, Max int
+
+	// PeerMin and PeerMax are the versions the peer supports.
+	PeerMin, PeerMax int
+}
+
+func (e *VersionError) Error() string {
+	return fmt.Sprintf("incompatible protocol versions: we speak %d-%d, the peer speaks %d-%d", e.Min, e.Max, e.PeerMin, e.PeerMax)
+}
+
+// preamble returns the preamble we send when offering features.
+func preamble(features uint32) []byte {
+	p := make([]byte, preambleSize)
+	copy(p, preambleMagic)
+	p[len(preambleMagic)] = minVersion
+	p[len(preambleMagic)+1] = maxVersion
+	binary.BigEndian.PutUint32(p[len(preambleMagic)+2:], features)
+
+	return p
+}
+
+// negotiate checks the peer's preamble and returns the version and the
+// features both the peer and we offered.
+func negotiate(peer []byte, offered uint32) (byte, uint32, error) {
+	if !bytes.Equal(peer[:len(preambleMagic)], []byte(preambleMagic)) {
+		return 0, 0, fmt.Errorf("peer does not speak the secure protocol: %w", ErrBadHandshake)
+	}
+
+	peerMin, peerMax := peer[len(preambleMagic)], peer[len(preambleMagic)+1]
+
+	version := byte(maxVersion)
+	if peerMax < version {
+		version = peerMax
+	}
+	if version < minVersion || version < peerMin {
+		return 0, 0, &VersionError{
+			Min:     minVersion,
+			Max:     maxVersion,
+			PeerMin: int(peerMin),
+			PeerMax: int(peerMax),
+		}
+	}
+
+	return version, offered & preambleFeatures(peer), nil
+}
+
+// preambleFeatures returns the features a preamble offers.
+func preambleFeatures(p []byte) uint32 {
+	return binary.BigEndian.Uint32(p[len(preambleMagic)+2:])
+}
+
+// Traffic in each direction is sealed with its own key, so a frame sent
+// by one side can never be reflected back and accepted by it.
+const (
+	clientToServerLabel = "go-mentor secure client to server"
+	serverToClientLabel = "go-mentor secure server to client"
+
+	bindingLabel = "go-mentor secure channel binding"
+)
+
+// handshake exchanges preambles over conn, then performs the key
+// exchange they settled on and returns the resulting SecureConn. pub and
+// priv are the key pair for the legacy key swap, generated for this
+// connection. server says which side of the connection we are.
+func handshake(conn net.Conn, pub, priv *[32]byte, server bool, cfg config) (sc *SecureConn, err error) {
+	start := cfg.now()
+	endTrace := traceHandshake(cfg, server, conn)
+	defer func() {
+		if sc != nil {
+			sc.handshakeTime = sc.clock.Now().Sub(start)
+		}
+		endTrace(sc, err)
+	}()
+
+	if _, ok := conn.(*debugConn); cfg.debugWire != nil && !ok {
+		conn = WrapDebug(conn, cfg.debugWire)
+	}
+	if cfg.capture != nil {
+		conn = cfg.capture.wrap(conn)
+	}
+
+	if server {
+		cfg = cfg.rotate(cfg.now())
+	}
+
+	offered := supportedFeatures
+	if cfg.noise != nil {
+		offered |= noiseFeatures(cfg.noise, server)
+	} else {
+		if cfg.identity != nil {
+			offered |= featureIdentity
+		}
+		if cfg.signer != nil {
+			offered |= featureSigned
+		}
+		if (server && cfg.rotation != nil) || (!server && cfg.knownHosts != nil) {
+			offered |= featureRotation
+		}
+	}
+
+	if cfg.psk != nil {
+		offered |= featurePSK
+	}
+	if cfg.passphrase != nil {
+		offered |= featurePassphrase
+	}
+	if cfg.suite == CipherXChaCha20Poly1305 {
+		offered |= featureXChaCha20Poly1305
+	}
+	if cfg.compress {
+		offered |= featureCompression
+		for _, c := range cfg.compressors {
+			offered |= compressionFeatures[c.Compression()]
+		}
+	}
+	if resumable(cfg) {
+		if (server && cfg.ticketKey != nil) || (!server && cfg.sessions != nil) {
+			offered |= featureTickets
+		}
+		if !server && cfg.session != nil {
+			offered |= featureResume
+		}
+	}
+
+	ours := preamble(offered)
+
+	// In passphrase mode our salt follows the preamble.
+	var salt []byte
+	if cfg.passphrase != nil {
+		salt = make([]byte, passphraseSaltSize)
+		if _, err := io.ReadFull(cfg.random(), salt); err != nil {
+			return nil, fmt.Errorf("generate salt: %w", err)
+		}
+		ours = append(ours, salt...)
+	}
+
+	// A client hoping to resume follows with its ticket and a nonce.
+	var resumeNonce []byte
+	if offered&featureResume != 0 {
+		resumeNonce = make([]byte, resumeNonceSize)
+		if _, err := io.ReadFull(cfg.random(), resumeNonce); err != nil {
+			return nil, fmt.Errorf("generate resumption nonce: %w", err)
+		}
+
+		var length [2]byte
+		binary.BigEndian.PutUint16(length[:], uint16(len(cfg.session.ticket)))
+		ours = append(append(append(ours, length[:]...), cfg.session.ticket...), resumeNonce...)
+	}
+	hello := len(ours)
+
+	if cfg.noise == nil {
+		// The legacy key swap needs nothing from the peer's preamble,
+		// so our keys go out with it to save a round trip.
+		ours = append(ours, pub[:]...)
+		if cfg.identity != nil {
+			ours = append(ours, cfg.identity.PublicKey()[:]...)
+		}
+	}
+	phases := cfg.phases(conn)
+	if err := phases.send(); err != nil {
+		return nil, fmt.Errorf("set send deadline: %w", err)
+	}
+	if _, err := conn.Write(ours); err != nil {
+		return nil, fmt.Errorf("write preamble: %w", err)
+	}
+
+	if err := phases.receive(); err != nil {
+		return nil, fmt.Errorf("set receive deadline: %w", err)
+	}
+	var peerPreamble [preambleSize]byte
+	if _, err := io.ReadFull(conn, peerPreamble[:]); err != nil {
+		return nil, fmt.Errorf("read preamble: %w", err)
+	}
+
+	version, features, err := negotiate(peerPreamble[:], offered)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys derived with and without a pre-shared key never match, so
+	// report a mismatch plainly rather than as a failure to decrypt.
+	if (cfg.psk != nil) != (preambleFeatures(peerPreamble[:])&featurePSK != 0) {
+		return nil, ErrPSKMismatch
+	}
+	if (cfg.passphrase != nil) != (preambleFeatures(peerPreamble[:])&featurePassphrase != 0) {
+		return nil, ErrPassphraseMismatch
+	}
+
+	theirs := peerPreamble[:]
+	psk := cfg.psk
+	if cfg.passphrase != nil {
+		peerSalt := make([]byte, passphraseSaltSize)
+		if _, err := io.ReadFull(conn, peerSalt); err != nil {
+			return nil, fmt.Errorf("read salt: %w", err)
+		}
+		theirs = append(theirs, peerSalt...)
+
+		clientSalt, serverSalt := salt, peerSalt
+		if server {
+			clientSalt, serverSalt = serverSalt, clientSalt
+		}
+		psk = append(append([]byte(nil), psk...), stretchPassphrase(cfg.passphrase, clientSalt, serverSalt)...)
+	}
+
+	var peerTicket []byte
+	if server && preambleFeatures(peerPreamble[:])&featureResume != 0 {
+		var length [2]byte
+		if _, err := io.ReadFull(conn, length[:]); err != nil {
+			return nil, fmt.Errorf("read session ticket: %w", err)
+		}
+		ticket := make([]byte, int(binary.BigEndian.Uint16(length[:]))+resumeNonceSize)
+		if _, err := io.ReadFull(conn, ticket); err != nil {
+			return nil, fmt.Errorf("read session ticket: %w", err)
+		}
+		theirs = append(append(theirs, length[:]...), ticket...)
+		peerTicket, resumeNonce = ticket[:len(ticket)-resumeNonceSize], ticket[len(ticket)-resumeNonceSize:]
+	}
+
+	if pattern, ok := noiseNegotiated(features); ok {
+		// The preambles are the Noise prologue, so the Noise handshake
+		// itself fails if either was tampered with.
+		client, serverHello := ours[:hello], theirs
+		if server {
+			client, serverHello = serverHello, client
+		}
+
+		if err := phases.end(); err != nil {
+			return nil, fmt.Errorf("clear phase deadline: %w", err)
+		}
+		sendKey, receiveKey, staticPriv, peerStatic, binding, err := runNoise(conn, cfg.noise, pattern, server, append(client, serverHello...), cfg.random())
+		if err != nil {
+			return nil, fmt.Errorf("noise handshake: %w", err)
+		}
+
+		if psk != nil {
+			sendLabel, receiveLabel := directionLabels(server)
+			if sendKey, err = deriveKey(append(sendKey[:], psk...), nil, sendLabel); err != nil {
+				return nil, err
+			}
+			if receiveKey, err = deriveKey(append(receiveKey[:], psk...), nil, receiveLabel); err != nil {
+				return nil, err
+			}
+		}
+
+		if server {
+			if err := cfg.checkBanned(*peerStatic); err != nil {
+				return nil, err
+			}
+		}
+
+		sc := newSecureConn(conn, sendKey, receiveKey, staticPriv, peerStatic, version, features, cfg.compressors, cfg.random(), cfg.clock)
+		sc.identified = true
+		if err := sc.bindChannel(binding); err != nil {
+			return nil, err
+		}
+
+		return sc, nil
+	}
+	if cfg.noise != nil {
+		return nil, fmt.Errorf("peer does not support the noise handshake: %w", ErrBadHandshake)
+	}
+
+	var peerPublicKey [32]byte
+	if _, err := io.ReadFull(conn, peerPublicKey[:]); err != nil {
+		return nil, fmt.Errorf("read public key: %w", err)
+	}
+	theirs = append(theirs, peerPublicKey[:]...)
+
+	var peerIdentity *[32]byte
+	if preambleFeatures(peerPreamble[:])&featureIdentity != 0 {
+		peerIdentity = new([32]byte)
+		if _, err := io.ReadFull(conn, peerIdentity[:]); err != nil {
+			return nil, fmt.Errorf("read identity key: %w", err)
+		}
+		theirs = append(theirs, peerIdentity[:]...)
+
+		// The key is not proven yet, but a client claiming a banned
+		// one is not worth finishing the handshake with.
+		if server {
+			if err := cfg.checkBanned(*peerIdentity); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if err := phases.end(); err != nil {
+		return nil, fmt.Errorf("clear phase deadline: %w", err)
+	}
+
+	// A server answers a ticket with whether it accepted it, once both
+	// sides have sent everything a full handshake needs in case it did
+	// not.
+	var resumed *session
+	if server && peerTicket != nil {
+		if cfg.ticketKey != nil && resumable(cfg) {
+			resumed = openTicket(cfg.ticketKey, peerTicket, cfg.ticketLifetime, cfg.now())
+		}
+
+		answer := []byte{0}
+		if resumed != nil {
+			answer[0] = 1
+		}
+		if _, err := conn.Write(answer); err != nil {
+			return nil, fmt.Errorf("write resumption answer: %w", err)
+		}
+		ours = append(ours, answer...)
+	} else if offered&featureResume != 0 {
+		var answer [1]byte
+		if _, err := io.ReadFull(conn, answer[:]); err != nil {
+			return nil, fmt.Errorf("read resumption answer: %w", err)
+		}
+		theirs = append(theirs, answer[:]...)
+
+		if answer[0] == 1 {
+			resumed = cfg.session
+		}
+	}
+
+	if resumed != nil {
+		if server && resumed.identified {
+			if err := cfg.checkBanned(resumed.peer); err != nil {
+				return nil, err
+			}
+		}
+		return resume(conn, resumed, resumeNonce, pub, priv, &peerPublicKey, server, version, features, cfg.compressors, ours, theirs, cfg.random(), cfg.clock)
+	}
+
+	// Identity keys prove themselves by taking part in the key
+	// agreement, since only their holder can compute a shared secret
+	// with them. Both sides mix the secrets in the same order: the
+	// client's key with the server's identity, then the client's
+	// identity with the server's key.
+	secret := precompute(&peerPublicKey, priv)
+	var withPeerIdentity, withOurIdentity []byte
+	if peerIdentity != nil {
+		withPeerIdentity = precompute(peerIdentity, priv)
+	}
+	if cfg.identity != nil {
+		var err error
+		if withOurIdentity, err = precomputeWith(cfg.identity, &peerPublicKey); err != nil {
+			return nil, fmt.Errorf("identity key: %w", err)
+		}
+	}
+	if server {
+		secret = append(append(secret, withOurIdentity...), withPeerIdentity...)
+	} else {
+		secret = append(append(secret, withPeerIdentity...), withOurIdentity...)
+	}
+
+	// A pre-shared key or passphrase goes last, so someone who got in
+	// the middle of the key exchange still cannot derive the session
+	// keys without it.
+	secret = append(secret, psk...)
+
+	sendLabel, receiveLabel := directionLabels(server)
+	sendKey, err := deriveKey(secret, nil, sendLabel)
+	if err != nil {
+		return nil, err
+	}
+	receiveKey, err := deriveKey(secret, nil, receiveLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	sc = newSecureConn(conn, sendKey, receiveKey, &KeyPair{Public: *pub, Private: *priv}, &peerPublicKey, version, features, cfg.compressors, cfg.random(), cfg.clock)
+	sc.reader.ownsPriv = true
+	if peerIdentity != nil {
+		sc.peer, sc.identified = peerIdentity, true
+	}
+
+	// Confirm that both sides saw the same handshake. Anyone tampering
+	// with the preambles, for instance to strip features, is caught here
+	// rather than once the weakened connection is in use.
+	client, serverHello := ours, theirs
+	if server {
+		client, serverHello = theirs, ours
+	}
+	transcript := transcriptHash(client, serverHello, version, features)
+	if err := sc.confirmTranscript(transcript); err != nil {
+		return nil, err
+	}
+	if err := sc.bindChannel(transcript); err != nil {
+		return nil, err
+	}
+
+	peerSigns := preambleFeatures(peerPreamble[:])&featureSigned != 0
+	if err := sc.exchangeSignatures(cfg, transcript, pub, &peerPublicKey, server, peerSigns); err != nil {
+		return nil, err
+	}
+
+	if features&featureRotation != 0 {
+		if err := sc.exchangeRotation(cfg, transcript, &peerPublicKey, priv, server); err != nil {
+			return nil, err
+		}
+	}
+
+	if features&featureTickets != 0 {
+		if err := sc.exchangeTicket(cfg, secret, transcript, server); err != nil {
+			return nil, err
+		}
+	}
+
+	return sc, nil
+}
+
+// resume sets up a connection whose keys come from a resumed session
+// instead of a key agreement. pub and priv are our key pair for this
+// connection and peerPub the peer's, which rekeying builds on.
+func resume(conn net.Conn, s *session, nonce []byte, pub, priv, peerPub *[32]byte, server bool, version byte, features uint32, compressors []Compressor, ours, theirs []byte, random io.Reader, clock Clock) (*SecureConn, error) {
+	clientPub, serverPub := pub, peerPub
+	client, serverHello := ours, theirs
+	if server {
+		clientPub, serverPub = serverPub, clientPub
+		client, serverHello = serverHello, client
+	}
+
+	salt := append(append(append([]byte(nil), nonce...), clientPub[:]...), serverPub[:]...)
+	sendLabel, receiveLabel := directionLabels(server)
+	sendKey, err := deriveKey(s.secret[:], salt, sendLabel)
+	if err != nil {
+		return nil, err
+	}
+	receiveKey, err := deriveKey(s.secret[:], salt, receiveLabel)
+	if err != nil {
+		return nil, err
+	}
+
+	sc := newSecureConn(conn, sendKey, receiveKey, &KeyPair{Public: *pub, Private: *priv}, peerPub, version, features, compressors, random, clock)
+	sc.reader.ownsPriv = true
+	sc.resumed = true
+	if s.identified {
+		peer := s.peer
+		sc.peer, sc.identified = &peer, true
+	}
+
+	// Only the holders of the resumption secret can confirm the
+	// transcript, which proves the ticket was not stolen.
+	transcript := transcriptHash(client, serverHello, version, features)
+	if err := sc.confirmTranscript(transcript); err != nil {
+		return nil, err
+	}
+	if err := sc.bindChannel(transcript); err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+// exchangeTicket derives the resumption secret of a full handshake and
+// sends it to the client in a ticket, or receives that ticket.
+func (c *SecureConn) exchangeTicket(cfg config, secret, transcript []byte, server bool) error {
+	resumptionSecret, err := deriveKey(secret, transcript, resumptionLabel)
+	if err != nil {
+		return err
+	}
+
+	if server {
+		ticket, err := sealTicket(cfg.ticketKey, resumptionSecret, c.peer, c.identified, cfg.now(), cfg.random())
+		if err != nil {
+			return fmt.Errorf("seal session ticket: %w", err)
+		}
+		if err := c.writer.WriteMsg(ticket); err != nil {
+			return fmt.Errorf("write session ticket: %w", err)
+		}
+		return nil
+	}
+
+	ticket, err := c.reader.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("read session ticket: %w", err)
+	}
+	c.session = &session{ticket: ticket, secret: *resumptionSecret, peer: *c.peer, identified: c.identified}
+
+	return nil
+}
+
+// newSecureConn wraps conn once the handshake has agreed on keys. priv
+// is our private key and peer the peer's public key, which rekeying
+// builds on. random is the writer's source of randomness.
+func newSecureConn(conn net.Conn, sendKey, receiveKey *[32]byte, priv IdentityKey, peer *[32]byte, version byte, features uint32, compressors []Compressor, random io.Reader, clock Clock) *SecureConn {
+	clock = clockOr(clock)
+	sc := SecureConn{
+		conn:     conn,
+		reader:   newSecureReader(conn, receiveKey, priv),
+		writer:   newSecureWriter(conn, sendKey, peer),
+		peer:     peer,
+		version:  version,
+		features: features,
+
+		established: clock.Now(),
+		clock:       clock,
+		closing:     make(chan struct{}),
+	}
+	if features&featureRekey != 0 {
+		sc.writer.Rekey = DefaultRekeyPolicy
+		sc.writer.peerRekeys = true
+	}
+	sc.writer.Rand = random
+	sc.reader.clock, sc.writer.clock = clock, clock
+	sc.reader.suite = negotiatedSuite(features)
+	sc.writer.suite = sc.reader.suite
+	sc.writer.Compress = features&featureCompression != 0
+	sc.writer.deflate.codec = negotiatedCompressor(features, compressors)
+	sc.reader.inflate.codec = sc.writer.deflate.codec
+	sc.reader.control = sc.control
+	if fc, ok := conn.(framedConn); ok {
+		fc.startFraming(&sc)
+	}
+
+	return &sc
+}
+
+// transcriptHash hashes everything both sides sent during the handshake,
+// along with the parameters chosen from it.
+func transcriptHash(client, server []byte, version byte, features uint32) []byte {
+	h := sha256.New()
+	h.Write(client)
+	h.Write(server)
+
+	var chosen [5]byte
+	chosen[0] = version
+	binary.BigEndian.PutUint32(chosen[1:], features)
+	h.Write(chosen[:])
+
+	return h.Sum(nil)
+}
+
+// confirmTranscript sends our transcript hash as the first encrypted
+// message and checks that the peer's first message holds the same hash.
+func (c *SecureConn) confirmTranscript(transcript []byte) error {
+	if err := c.writer.WriteMsg(transcript); err != nil {
+		return fmt.Errorf("write transcript: %w", err)
+	}
+
+	peerTranscript, err := c.reader.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("read transcript: %w", err)
+	}
+
+	if !hmac.Equal(transcript, peerTranscript) {
+		return ErrTranscriptMismatch
+	}
+
+	return nil
+}
+
+// bindChannel binds the connection's keys to binding, a hash of the
+// handshake that covers both sides' public keys, when both sides
+// support it. Every frame sent afterwards is then authenticated along
+// with the binding, so it is only accepted by the session it was sent
+// in, even if another session somehow arrived at the same keys. nacl/box
+// takes no associated data, so the binding is mixed into the keys
+// instead, which works the same for every cipher suite.
+func (c *SecureConn) bindChannel(binding []byte) error {
+	if c.features&featureBinding == 0 {
+		return nil
+	}
+
+	send, err := deriveKey(c.writer.key[:], binding, bindingLabel)
+	if err != nil {
+		return err
+	}
+	receive, err := deriveKey(c.reader.key[:], binding, bindingLabel)
+	if err != nil {
+		return err
+	}
+	c.writer.key, c.reader.key = *send, *receive
+	if c.writer.keyed != nil {
+		c.writer.keyed()
+	}
+	if c.reader.keyed != nil {
+		c.reader.keyed()
+	}
+
+	return nil
+}
+
+// directionLabels returns the key derivation labels for the direction we
+// send in and the direction we receive in.
+func directionLabels(server bool) (send, receive string) {
+	if server {
+		return serverToClientLabel, clientToServerLabel
+	}
+
+	return clientToServerLabel, serverToClientLabel
+}
+
+// precompute returns the shared secret between a private and a public
+// key.
+func precompute(pub, priv *[32]byte) []byte {
+	var shared [32]byte
+	box.Precompute(&shared, pub, priv)
+	return shared[:]
+}
+
+// precomputeWith is precompute for a key that may be held elsewhere.
+func precomputeWith(key IdentityKey, pub *[32]byte) ([]byte, error) {
+	shared, err := key.ECDH(pub)
+	if err != nil {
+		return nil, err
+	}
+	salsa.HSalsa20(&shared, new([16]byte), &shared, &salsa.Sigma)
+
+	return shared[:], nil
+}
+
+// deriveKey expands a shared secret into a key for the purpose named by
+// label, mixing in salt when one is given.
+func deriveKey(secret, salt []byte, label string) (*[32]byte, error) {
+	var key [32]byte
+	if _, err := io.ReadFull(hkdf.New(sha256.New, secret, salt, []byte(label)), key[:]); err != nil {
+		return nil, fmt.Errorf("derive %s key: %w", label, err)
+	}
+
+	return &key, nil
+}
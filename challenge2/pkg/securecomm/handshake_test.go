@@ -0,0 +1,275 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestNegotiate(t *testing.T) {
+	peer := func(min, max byte, features uint32) []byte {
+		p := preamble(supportedFeatures)
+		p[len(preambleMagic)] = min
+		p[len(preambleMagic)+1] = max
+		binary.BigEndian.PutUint32(p[len(preambleMagic)+2:], features)
+		return p
+	}
+
+	version, features, err := negotiate(preamble(supportedFeatures), supportedFeatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != maxVersion || features != supportedFeatures {
+		t.Errorf("Unexpected negotiation with ourselves: version %d, features %b", version, features)
+	}
+
+	// A newer peer falls back to our highest version and only the
+	// features we know about.
+	version, features, err = negotiate(peer(minVersion, maxVersion+3, 0xffffffff), supportedFeatures)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if version != maxVersion || features != supportedFeatures {
+		t.Errorf("Unexpected negotiation with a newer peer: version %d, features %b", version, features)
+	}
+
+	// A peer without optional features disables them.
+	if _, features, _ := negotiate(peer(minVersion, maxVersion, 0), supportedFeatures); features != 0 {
+		t.Errorf("Expected no features in common, got %b", features)
+	}
+
+	var versionErr *VersionError
+	if _, _, err := negotiate(peer(maxVersion+1, maxVersion+2, 0), supportedFeatures); !errors.As(err, &versionErr) {
+		t.Errorf("Expected a VersionError, got %v", err)
+	} else if versionErr.PeerMin != maxVersion+1 {
+		t.Errorf("Unexpected VersionError: %v", versionErr)
+	}
+
+	bad := preamble(supportedFeatures)
+	copy(bad, "HTTP")
+	if _, _, err := negotiate(bad, supportedFeatures); !errors.Is(err, ErrBadHandshake) {
+		t.Errorf("Expected ErrBadHandshake for a preamble with the wrong magic, got %v", err)
+	}
+}
+
+func TestHandshakeIncompatibleVersion(t *testing.T) {
+	l := testutil.Listen(t)
+
+	// A peer from the future that no longer speaks our version.
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		p := preamble(supportedFeatures)
+		p[len(preambleMagic)] = maxVersion + 1
+		p[len(preambleMagic)+1] = maxVersion + 1
+		conn.Write(append(p, make([]byte, 32)...))
+	}()
+
+	var versionErr *VersionError
+	if _, err := Dial(l.Addr().String()); !errors.As(err, &versionErr) {
+		t.Fatalf("Expected a VersionError, got %v", err)
+	}
+}
+
+func TestHandshakeDetectsTampering(t *testing.T) {
+	l := testutil.Listen(t)
+
+	go Serve(l, nil)
+
+	// Relay the handshake, stripping every feature the client offers.
+	proxy := testutil.Listen(t)
+
+	go func() {
+		client, err := proxy.Accept()
+		if err != nil {
+			return
+		}
+		defer client.Close()
+
+		server, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			return
+		}
+		defer server.Close()
+
+		hello := make([]byte, preambleSize)
+		if _, err := io.ReadFull(client, hello); err != nil {
+			return
+		}
+		binary.BigEndian.PutUint32(hello[len(preambleMagic)+2:], 0)
+		server.Write(hello)
+
+		go io.Copy(client, server)
+		io.Copy(server, client)
+	}()
+
+	if _, err := Dial(proxy.Addr().String()); !errors.Is(err, ErrTranscriptMismatch) {
+		t.Fatalf("Expected ErrTranscriptMismatch, got %v", err)
+	}
+}
+
+func TestHandshakeIdentity(t *testing.T) {
+	serverKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := testutil.Listen(t)
+
+	servers := make(chan *SecureConn)
+	go func() {
+		defer close(servers)
+
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			pub, priv, err := box.GenerateKey(rand.Reader)
+			if err != nil {
+				return
+			}
+
+			server, err := handshake(conn, pub, priv, true, newConfig([]Option{WithIdentity(serverKey)}))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			servers <- server
+		}
+	}()
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{"anonymous client", nil},
+		{"identified client", []Option{WithIdentity(clientKey)}},
+	}
+
+	for _, test := range tests {
+		client, err := Dial(l.Addr().String(), test.opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := <-servers
+
+		if identity, ok := client.PeerIdentity(); !ok || identity != serverKey.Public {
+			t.Errorf("%s: client did not see the server's identity", test.name)
+		}
+
+		identity, ok := server.PeerIdentity()
+		if test.opts == nil && ok {
+			t.Errorf("%s: server saw an identity the client does not have", test.name)
+		}
+		if test.opts != nil && (!ok || identity != clientKey.Public) {
+			t.Errorf("%s: server did not see the client's identity", test.name)
+		}
+
+		if err := client.WriteMsg([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		if message, err := server.ReadMsg(); err != nil || string(message) != "ping" {
+			t.Errorf("%s: unexpected message %q, %v", test.name, message, err)
+		}
+
+		client.Close()
+		server.Close()
+	}
+}
+
+func TestChannelBinding(t *testing.T) {
+	key := &[32]byte{'k', 'e', 'y'}
+
+	// Two sessions that by accident share their keys but not their
+	// handshakes.
+	newConn := func(binding string) *SecureConn {
+		sc := newSecureConn(&fuzzConn{}, key, key, nil, nil, maxVersion, supportedFeatures, nil, rand.Reader, nil)
+		if err := sc.bindChannel([]byte(binding)); err != nil {
+			t.Fatal(err)
+		}
+		return sc
+	}
+
+	var frame bytes.Buffer
+	sender := newConn("session a")
+	sender.writer.Writer = &frame
+	if err := sender.WriteMsg([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	same := newConn("session a")
+	same.reader.Reader = bytes.NewReader(frame.Bytes())
+	if message, err := same.ReadMsg(); err != nil || string(message) != "hello" {
+		t.Fatalf("Unexpected result in the same session: %q, %v", message, err)
+	}
+
+	other := newConn("session b")
+	other.reader.Reader = bytes.NewReader(frame.Bytes())
+	if _, err := other.ReadMsg(); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("Expected a frame pasted into another session to fail with ErrDecryptFailed, got %v", err)
+	}
+}
+
+// fuzzConn is a connection that reads what the fuzzer gives it and
+// throws away what is written to it.
+type fuzzConn struct {
+	net.Conn
+	r io.Reader
+}
+
+func (c *fuzzConn) Read(b []byte) (int, error)       { return c.r.Read(b) }
+func (c *fuzzConn) Write(b []byte) (int, error)      { return len(b), nil }
+func (c *fuzzConn) Close() error                     { return nil }
+func (c *fuzzConn) SetDeadline(time.Time) error      { return nil }
+func (c *fuzzConn) SetReadDeadline(time.Time) error  { return nil }
+func (c *fuzzConn) SetWriteDeadline(time.Time) error { return nil }
+func (c *fuzzConn) RemoteAddr() net.Addr             { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+func (c *fuzzConn) LocalAddr() net.Addr              { return &net.TCPAddr{IP: net.IPv4(127, 0, 0, 1)} }
+
+func FuzzHandshake(f *testing.F) {
+	identity := &KeyPair{Public: [32]byte{'p', 'u', 'b'}, Private: [32]byte{'p', 'r', 'i', 'v'}}
+	modes := [][]Option{
+		nil,
+		{WithIdentity(identity)},
+		{WithNoise(NoiseConfig{}), WithIdentity(identity)},
+		{WithPSK([]byte("pre-shared key")), WithCipherSuite(CipherXChaCha20Poly1305), WithCompression()},
+	}
+
+	key := bytes.Repeat([]byte{9}, 32)
+	f.Add(append(preamble(supportedFeatures), key...), false, uint8(0))
+	f.Add(append(append(preamble(supportedFeatures|featureIdentity), key...), key...), true, uint8(1))
+	f.Add(append(preamble(supportedFeatures|noiseFeatures(&NoiseConfig{}, false)), make([]byte, 34)...), true, uint8(2))
+	f.Add(append(preamble(supportedFeatures|featurePSK|featureXChaCha20Poly1305|featureCompression), key...), false, uint8(3))
+
+	f.Fuzz(func(t *testing.T, input []byte, server bool, mode uint8) {
+		cfg := newConfig(append(modes[int(mode)%len(modes)], WithRand(deterministicRand(1))))
+		pub, priv, err := box.GenerateKey(cfg.random())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Whatever the input, the handshake must fail or succeed rather
+		// than panic, and it cannot hang, as the input runs out.
+		if sc, err := handshake(&fuzzConn{r: bytes.NewReader(input)}, pub, priv, server, cfg); err == nil {
+			sc.ReadMsg()
+		}
+	})
+}
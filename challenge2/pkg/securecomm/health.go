@@ -0,0 +1,99 @@
+package securecomm
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+// Health serves the health of a Server over HTTP, for container
+// orchestrators to probe: /healthz answers 200 OK for as long as the
+// process can answer at all, and /readyz answers 200 OK only while the
+// server is accepting connections and every check passes, and 503
+// Service Unavailable otherwise. Both describe the server in a JSON
+// body. Mount it at the root of its own listener, away from the
+// connections it reports on.
+type Health struct {
+	// Server is the server reported on.
+	Server *Server
+
+	// Checks are what else the server needs working to be ready, by
+	// name, such as IdentityCheck for its identity key. Each returns
+	// nil while what it checks is working.
+	Checks map[string]func() error
+}
+
+// healthReport is the JSON body Health answers with.
+type healthReport struct {
+	Status       string            `json:"status"`
+	Listeners    int               `json:"listeners"`
+	Conns        int               `json:"active_connections"`
+	Handshakes   int               `json:"handshakes"`
+	ShuttingDown bool              `json:"shutting_down,omitempty"`
+	Checks       map[string]string `json:"checks,omitempty"`
+}
+
+// ServeHTTP answers /healthz and /readyz.
+func (h *Health) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/healthz" && r.URL.Path != "/readyz" {
+		http.NotFound(w, r)
+		return
+	}
+
+	report, ready := h.report()
+	code := http.StatusOK
+	if r.URL.Path == "/readyz" && !ready {
+		code = http.StatusServiceUnavailable
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
+
+// report describes the server and runs the checks, reporting whether
+// it is ready.
+func (h *Health) report() (healthReport, bool) {
+	status := h.Server.Status()
+	report := healthReport{
+		Listeners:    status.Listeners,
+		Conns:        status.Conns,
+		Handshakes:   status.Handshakes,
+		ShuttingDown: status.ShuttingDown,
+	}
+	ready := status.Listeners > 0 && !status.ShuttingDown
+
+	names := make([]string, 0, len(h.Checks))
+	for name := range h.Checks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if report.Checks == nil {
+			report.Checks = make(map[string]string)
+		}
+		if err := h.Checks[name](); err != nil {
+			report.Checks[name] = err.Error()
+			ready = false
+		} else {
+			report.Checks[name] = "ok"
+		}
+	}
+
+	report.Status = "ready"
+	if !ready {
+		report.Status = "not ready"
+	}
+
+	return report, ready
+}
+
+// IdentityCheck returns a check for Health that key can still be used,
+// as a key held by an agent or a hardware token can stop being.
+func IdentityCheck(key IdentityKey) func() error {
+	return func() error {
+		_, err := key.ECDH(key.PublicKey())
+		return err
+	}
+}
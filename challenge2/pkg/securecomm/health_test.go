@@ -0,0 +1,84 @@
+package securecomm
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+// probe asks h about path and returns the status code and report.
+func probe(t *testing.T, h *Health, path string) (int, healthReport) {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+
+	var report healthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("%s: %v: %q", path, err, rec.Body)
+	}
+	return rec.Code, report
+}
+
+func TestHealth(t *testing.T) {
+	s := &Server{}
+	var keyErr error
+	h := &Health{Server: s, Checks: map[string]func() error{
+		"key": func() error { return keyErr },
+	}}
+
+	// Not listening yet.
+	if code, report := probe(t, h, "/healthz"); code != http.StatusOK || report.Listeners != 0 {
+		t.Errorf("Unexpected liveness before serving: %d %+v", code, report)
+	}
+	if code, report := probe(t, h, "/readyz"); code != http.StatusServiceUnavailable || report.Status != "not ready" {
+		t.Errorf("Unexpected readiness before serving: %d %+v", code, report)
+	}
+
+	addr, _ := startServer(t, s)
+	conn := dialEchoed(t, addr)
+	defer conn.Close()
+
+	code, report := probe(t, h, "/readyz")
+	want := healthReport{Status: "ready", Listeners: 1, Conns: 1, Checks: map[string]string{"key": "ok"}}
+	if code != http.StatusOK || report.Status != want.Status || report.Listeners != want.Listeners || report.Conns != want.Conns || report.Checks["key"] != "ok" {
+		t.Errorf("Expected %+v, got %d %+v", want, code, report)
+	}
+
+	// A failing check makes the server unready, but still alive.
+	keyErr = errors.New("agent gone")
+	if code, report := probe(t, h, "/readyz"); code != http.StatusServiceUnavailable || report.Checks["key"] != "agent gone" {
+		t.Errorf("Unexpected readiness with a failing check: %d %+v", code, report)
+	}
+	if code, _ := probe(t, h, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected liveness with a failing check, got %d", code)
+	}
+	keyErr = nil
+
+	s.Close()
+	if code, report := probe(t, h, "/readyz"); code != http.StatusServiceUnavailable || !report.ShuttingDown {
+		t.Errorf("Unexpected readiness once closed: %d %+v", code, report)
+	}
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("Expected 404 for /, got %d", rec.Code)
+	}
+}
+
+func TestIdentityCheck(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := IdentityCheck(key)(); err != nil {
+		t.Errorf("Expected a loaded key to pass, got %v", err)
+	}
+
+	agentKey := AgentKey{Socket: filepath.Join(t.TempDir(), "agent.sock"), Public: key.Public}
+	if err := IdentityCheck(agentKey)(); err == nil {
+		t.Error("Expected a key whose agent is gone to fail")
+	}
+}
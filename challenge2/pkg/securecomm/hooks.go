@@ -0,0 +1,83 @@
+package securecomm
+
+import (
+	"net"
+	"time"
+)
+
+// Hooks are called as connections come and go, so that an embedder can
+// do its own accounting and alerting. Any of them may be nil. They are
+// called on the connection's own goroutine, so must not block for long,
+// and may be called concurrently for different connections.
+type Hooks struct {
+	// OnHandshake is called once a connection completes the handshake,
+	// with Duration how long it took.
+	OnHandshake func(ConnInfo)
+
+	// OnConnect is called once a connection is ready for use: on the
+	// server, just before the Handler is called, and on the dialer, just
+	// before Dial returns it.
+	OnConnect func(ConnInfo)
+
+	// OnDisconnect is called once a connection OnConnect was called for
+	// ends, with Duration how long it lasted: on the server, when its
+	// Handler returns, and on the dialer, when it is closed.
+	OnDisconnect func(ConnInfo)
+
+	// OnError is called with the error a connection failed with, on the
+	// server including those its Handler returns. Peer is empty if the
+	// connection failed during the handshake.
+	OnError func(ConnInfo, error)
+}
+
+// ConnInfo describes a connection to Hooks.
+type ConnInfo struct {
+	// Peer is the fingerprint of the peer's long-term key, or empty if
+	// it did not prove one.
+	Peer string
+
+	RemoteAddr net.Addr
+
+	// Duration is how long the handshake or the connection took, as
+	// described for each hook.
+	Duration time.Duration
+
+	// BytesIn and BytesOut count the frames read and written since the
+	// handshake.
+	BytesIn, BytesOut int64
+}
+
+// connInfo describes sc, which has been going for d.
+func connInfo(sc *SecureConn, d time.Duration) ConnInfo {
+	info := ConnInfo{RemoteAddr: sc.RemoteAddr(), Duration: d}
+	if identity, ok := sc.PeerIdentity(); ok {
+		info.Peer = Fingerprint(identity)
+	}
+	info.BytesIn, info.BytesOut = sc.bytesTransferred()
+
+	return info
+}
+
+func (h *Hooks) handshake(info ConnInfo) {
+	if h.OnHandshake != nil {
+		h.OnHandshake(info)
+	}
+}
+
+func (h *Hooks) connect(info ConnInfo) {
+	if h.OnConnect != nil {
+		h.OnConnect(info)
+	}
+}
+
+func (h *Hooks) disconnect(info ConnInfo) {
+	if h.OnDisconnect != nil {
+		h.OnDisconnect(info)
+	}
+}
+
+func (h *Hooks) error(info ConnInfo, err error) {
+	if h.OnError != nil {
+		h.OnError(info, err)
+	}
+}
@@ -0,0 +1,146 @@
+package securecomm
+
+import (
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+type hookEvent struct {
+	name string
+	info ConnInfo
+	err  error
+}
+
+// recordHooks returns Hooks that send every call to the channel.
+func recordHooks() (Hooks, <-chan hookEvent) {
+	events := make(chan hookEvent, 16)
+	record := func(name string) func(ConnInfo) {
+		return func(info ConnInfo) { events <- hookEvent{name: name, info: info} }
+	}
+
+	return Hooks{
+		OnHandshake:  record("handshake"),
+		OnConnect:    record("connect"),
+		OnDisconnect: record("disconnect"),
+		OnError: func(info ConnInfo, err error) {
+			events <- hookEvent{name: "error", info: info, err: err}
+		},
+	}, events
+}
+
+func nextEvent(t *testing.T, events <-chan hookEvent, name string) hookEvent {
+	t.Helper()
+
+	select {
+	case e := <-events:
+		if e.name != name {
+			t.Fatalf("Expected %s, got %s (%v)", name, e.name, e.err)
+		}
+		return e
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Timed out waiting for %s", name)
+		return hookEvent{}
+	}
+}
+
+func TestHooks(t *testing.T) {
+	identity, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	serverHooks, serverEvents := recordHooks()
+	s := &Server{Hooks: serverHooks, Options: []Option{WithErrorHandler(func(net.Addr, error) {})}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	dialerHooks, dialerEvents := recordHooks()
+	d := &Dialer{Hooks: dialerHooks}
+	conn, err := d.Dial(addr, WithIdentity(identity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	nextEvent(t, dialerEvents, "handshake")
+	nextEvent(t, dialerEvents, "connect")
+
+	if err := conn.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); err != nil {
+		t.Fatal(err)
+	}
+	// Let the echo finish cleanly, so the server has no error to report.
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); err != io.EOF {
+		t.Fatalf("Expected io.EOF, got %v", err)
+	}
+	conn.Close()
+	conn.Close()
+
+	e := nextEvent(t, dialerEvents, "disconnect")
+	if e.info.BytesIn == 0 || e.info.BytesOut == 0 || e.info.RemoteAddr.String() != addr {
+		t.Errorf("Unexpected dialer disconnect %+v", e.info)
+	}
+	select {
+	case e := <-dialerEvents:
+		t.Errorf("Unexpected %s after closing twice", e.name)
+	default:
+	}
+
+	nextEvent(t, serverEvents, "handshake")
+	nextEvent(t, serverEvents, "connect")
+	e = nextEvent(t, serverEvents, "disconnect")
+	if e.info.Peer != Fingerprint(identity.Public) {
+		t.Errorf("Expected peer %s, got %q", Fingerprint(identity.Public), e.info.Peer)
+	}
+	if e.info.BytesIn == 0 || e.info.BytesOut == 0 || e.info.Duration <= 0 {
+		t.Errorf("Unexpected server disconnect %+v", e.info)
+	}
+
+	// A client that fails the handshake is reported to the server's
+	// OnError.
+	bad, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Write(make([]byte, 64))
+	bad.Close()
+	e = nextEvent(t, serverEvents, "error")
+	if e.info.Peer != "" || e.info.RemoteAddr == nil {
+		t.Errorf("Unexpected server error %+v", e.info)
+	}
+}
+
+func TestHooksDialError(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Close()
+		}
+	}()
+
+	hooks, events := recordHooks()
+	d := &Dialer{Hooks: hooks}
+	_, err = d.Dial(l.Addr().String())
+	if err == nil {
+		t.Fatal("Expected the handshake to fail")
+	}
+
+	e := nextEvent(t, events, "error")
+	if !errors.Is(e.err, err) || e.info.RemoteAddr == nil {
+		t.Errorf("Unexpected error event %+v: %v", e.info, e.err)
+	}
+}
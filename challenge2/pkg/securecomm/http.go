@@ -0,0 +1,184 @@
+package securecomm
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// A SecureListener is a net.Listener whose Accept returns connections
+// that have completed the server's side of the handshake, so that
+// anything serving a net.Listener, such as an http.Server, can serve
+// secure connections. Handshakes run in the background, so a slow
+// client holds up no one else, and those that fail go to the error
+// handler. The Accept method returns *SecureConn connections.
+type SecureListener struct {
+	l         net.Listener
+	cfg       config
+	pub, priv *[32]byte
+
+	conns chan *SecureConn
+
+	// done is closed, with err set, once the listener stops accepting.
+	done      chan struct{}
+	closeOnce sync.Once
+	err       error
+}
+
+// NewSecureListener returns a SecureListener accepting connections on l
+// and handshaking with opts.
+func NewSecureListener(l net.Listener, opts ...Option) (*SecureListener, error) {
+	cfg := newConfig(opts)
+	pub, priv, err := serverKeys(&cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	sl := &SecureListener{
+		l:     l,
+		cfg:   cfg,
+		pub:   pub,
+		priv:  priv,
+		conns: make(chan *SecureConn),
+		done:  make(chan struct{}),
+	}
+	go sl.acceptLoop()
+
+	return sl, nil
+}
+
+// Listen listens on the network address addr, as net.Listen does, and
+// returns a SecureListener handshaking on it with opts, proving key as
+// the server's identity unless it is nil. Closing the SecureListener
+// closes the network listener too.
+func Listen(network, addr string, key IdentityKey, opts ...Option) (*SecureListener, error) {
+	l, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, err
+	}
+
+	if key != nil {
+		opts = append([]Option{WithIdentityKey(key)}, opts...)
+	}
+	sl, err := NewSecureListener(l, opts...)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+
+	return sl, nil
+}
+
+// Accept waits for the next connection to complete the handshake and
+// returns it.
+func (l *SecureListener) Accept() (net.Conn, error) {
+	select {
+	case sc := <-l.conns:
+		return sc, nil
+	case <-l.done:
+		return nil, l.err
+	}
+}
+
+// Close closes the underlying listener. Connections still in the
+// handshake are dropped; those already accepted are left open.
+func (l *SecureListener) Close() error {
+	err := l.l.Close()
+	l.stop(net.ErrClosed)
+
+	return err
+}
+
+// Addr returns the address of the underlying listener.
+func (l *SecureListener) Addr() net.Addr {
+	return l.l.Addr()
+}
+
+// stop makes Accept fail with err from now on, unless it already fails.
+func (l *SecureListener) stop(err error) {
+	l.closeOnce.Do(func() {
+		l.err = err
+		close(l.done)
+	})
+}
+
+func (l *SecureListener) acceptLoop() {
+	var delay time.Duration
+	for {
+		conn, err := l.l.Accept()
+		if err != nil {
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				delay = acceptRetryDelay(delay)
+				l.cfg.logger().Warn("accept failed", "err", err, "retry_in", delay)
+				time.Sleep(delay)
+				continue
+			}
+			l.stop(err)
+			return
+		}
+		delay = 0
+
+		go l.handshake(conn)
+	}
+}
+
+// handshake sets up the secure connection on conn and hands it to
+// Accept.
+func (l *SecureListener) handshake(conn net.Conn) {
+	logger := l.cfg.logger().With("remote", conn.RemoteAddr().String())
+	fail := func(err error) {
+		conn.Close()
+		l.cfg.handleError(logger, conn.RemoteAddr(), err)
+	}
+
+	if l.cfg.banList != nil && l.cfg.banList.BannedAddr(conn.RemoteAddr()) {
+		fail(ErrBanned)
+		return
+	}
+	cfg := l.cfg
+	cfg.deadline = time.Now().Add(handshakeTimeout(cfg.handshakeTimeout))
+	if err := conn.SetDeadline(cfg.deadline); err != nil {
+		fail(err)
+		return
+	}
+	sc, err := handshake(conn, l.pub, l.priv, true, cfg)
+	if err != nil {
+		fail(fmt.Errorf("handshake: %w", err))
+		return
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		fail(err)
+		return
+	}
+	if err := l.cfg.setUpServerConn(sc); err != nil {
+		fail(err)
+		return
+	}
+
+	select {
+	case l.conns <- sc:
+	case <-l.done:
+		sc.Close()
+	}
+}
+
+// HTTPTransport returns an http.Transport that makes its connections
+// with d and opts, for an http.Client to speak ordinary HTTP through the
+// secure channel to an http.Server serving a SecureListener. Both
+// http:// and https:// URLs go through the secure channel, which takes
+// the place of TLS; the host in the URL is the address dialed.
+func (d *Dialer) HTTPTransport(opts ...Option) *http.Transport {
+	dial := func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return d.DialContext(ctx, addr, opts...)
+	}
+
+	return &http.Transport{
+		DialContext:         dial,
+		DialTLSContext:      dial,
+		MaxIdleConnsPerHost: http.DefaultMaxIdleConnsPerHost,
+		IdleConnTimeout:     90 * time.Second,
+	}
+}
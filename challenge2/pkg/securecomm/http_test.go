@@ -0,0 +1,155 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestHTTPOverSecureListener(t *testing.T) {
+	serverKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := testutil.Listen(t)
+	sl, err := NewSecureListener(l, WithIdentity(serverKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		identity := "none"
+		if key, ok := r.Context().Value(secureConnKey{}).(*SecureConn).PeerIdentity(); ok {
+			identity = Fingerprint(key)
+		}
+		fmt.Fprintf(w, "%s %s from %s", r.Method, r.URL.Path, identity)
+	}), ConnContext: func(ctx context.Context, c net.Conn) context.Context {
+		return context.WithValue(ctx, secureConnKey{}, c)
+	}}
+	go srv.Serve(sl)
+	defer srv.Close()
+
+	var d Dialer
+	client := &http.Client{Transport: d.HTTPTransport(WithIdentity(clientKey))}
+	for _, scheme := range []string{"http", "https"} {
+		resp, err := client.Get(scheme + "://" + l.Addr().String() + "/hello")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := "GET /hello from " + Fingerprint(clientKey.Public); string(body) != want {
+			t.Errorf("Unexpected %s response %q, want %q", scheme, body, want)
+		}
+	}
+}
+
+// secureConnKey is the context key TestHTTPOverSecureListener keeps the
+// connection of a request under.
+type secureConnKey struct{}
+
+func TestSecureListenerSlowHandshake(t *testing.T) {
+	l := testutil.Listen(t)
+	handshakeErrs := make(chan error, 1)
+	sl, err := NewSecureListener(l, WithHandshakeTimeout(100*time.Millisecond), WithErrorHandler(func(addr net.Addr, err error) {
+		handshakeErrs <- err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sl.Close()
+
+	// A client that never handshakes must not hold up the next.
+	silent, err := net.Dial("tcp", sl.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer silent.Close()
+
+	accepted := make(chan net.Conn, 1)
+	go func() {
+		conn, err := sl.Accept()
+		if err != nil {
+			t.Error(err)
+		}
+		accepted <- conn
+	}()
+	sc, err := Dial(sl.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sc.Close()
+	if conn := <-accepted; conn == nil {
+		t.FailNow()
+	} else {
+		conn.Close()
+	}
+
+	if err := <-handshakeErrs; err == nil {
+		t.Error("Expected the silent client's handshake to fail")
+	}
+
+	sl.Close()
+	if _, err := sl.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected net.ErrClosed after Close, got %v", err)
+	}
+}
+
+func TestListen(t *testing.T) {
+	serverKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l, err := Listen("tcp", "127.0.0.1:0", serverKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	// Any code serving a net.Listener gets connections ready to use.
+	var nl net.Listener = l
+	go func() {
+		conn, err := nl.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if key, ok := conn.PeerIdentity(); !ok || key != serverKey.Public {
+		t.Fatal("Expected the server to prove the identity it listens with")
+	}
+	if err := conn.WriteMsg([]byte("through Listen")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := conn.ReadMsg(); err != nil || string(echo) != "through Listen" {
+		t.Fatalf("Unexpected echo %q, %v", echo, err)
+	}
+
+	l.Close()
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Error("Expected closing the listener to stop listening on its address")
+	}
+}
@@ -0,0 +1,80 @@
+package securecomm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// An IdlePolicy says how long a SecureConn may go without frames before
+// it is closed, so that clients that went away without a word do not
+// hold on to a server's resources forever. Only authenticated frames
+// count, keepalive pings and pongs included, so an attacker on the path
+// cannot keep an abandoned connection open. The zero IdlePolicy never
+// closes the connection.
+type IdlePolicy struct {
+	// Read is how long the peer may send nothing. Zero means no limit.
+	Read time.Duration
+
+	// Write is how long we may send nothing. Zero means no limit.
+	Write time.Duration
+}
+
+// SetIdlePolicy sets how long the connection may sit idle, replacing
+// any earlier policy, and counting from now. Once it has been idle for
+// too long, it is closed and its reads and writes fail with
+// ErrIdleTimeout.
+func (c *SecureConn) SetIdlePolicy(policy IdlePolicy) {
+	c.keepalive.mu.Lock()
+	defer c.keepalive.mu.Unlock()
+
+	if c.keepalive.stopIdle != nil {
+		close(c.keepalive.stopIdle)
+		c.keepalive.stopIdle = nil
+	}
+	if policy.Read > 0 || policy.Write > 0 {
+		c.keepalive.stopIdle = make(chan struct{})
+		go c.reapIdle(policy, c.clock.Now(), c.keepalive.stopIdle)
+	}
+}
+
+// reapIdle closes the connection once it has been idle for longer than
+// policy allows since start, unless stop is closed first.
+func (c *SecureConn) reapIdle(policy IdlePolicy, start time.Time, stop chan struct{}) {
+	timer := c.clock.NewTimer(0)
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-timer.C():
+		}
+
+		now := c.clock.Now()
+		wait := time.Duration(-1)
+		for _, limit := range []struct {
+			timeout time.Duration
+			last    *int64
+		}{{policy.Read, &c.reader.lastFrame}, {policy.Write, &c.writer.lastFrame}} {
+			if limit.timeout <= 0 {
+				continue
+			}
+			last := time.Unix(0, atomic.LoadInt64(limit.last))
+			if last.Before(start) {
+				last = start
+			}
+			left := last.Add(limit.timeout).Sub(now)
+			if left <= 0 {
+				c.keepalive.mu.Lock()
+				c.keepalive.err = ErrIdleTimeout
+				c.keepalive.mu.Unlock()
+				c.conn.Close()
+				return
+			}
+			if wait < 0 || left < wait {
+				wait = left
+			}
+		}
+		timer.Reset(wait)
+	}
+}
@@ -0,0 +1,71 @@
+package securecomm
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestIdlePolicyKeepalive(t *testing.T) {
+	clock := newFakeClock()
+	client, server, err := testPipe(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	for _, conn := range []*SecureConn{client, server} {
+		go func(conn *SecureConn) {
+			for {
+				if _, err := conn.ReadMsg(); err != nil {
+					return
+				}
+			}
+		}(conn)
+	}
+
+	// The client's pings count, even with nothing else sent.
+	server.SetIdlePolicy(IdlePolicy{Read: time.Hour})
+	client.SetKeepalivePolicy(KeepalivePolicy{Interval: 20 * time.Minute})
+	for i := 0; i < 9; i++ {
+		clock.waitTimers(t, 2)
+		clock.Advance(20 * time.Minute)
+		clock.waitTimers(t, 2)
+		waitPong(t, client)
+	}
+	if err := server.WriteMsg([]byte("hello")); err != nil {
+		t.Fatalf("Expected the pinged connection to stay open, got %v", err)
+	}
+
+	// Until they stop.
+	client.SetKeepalivePolicy(KeepalivePolicy{})
+	clock.waitTimers(t, 1)
+	clock.Advance(time.Hour)
+	err = waitErr(t, func() error { return server.WriteMsg([]byte("hello?")) })
+	if !errors.Is(err, ErrIdleTimeout) {
+		t.Fatalf("Expected ErrIdleTimeout, got %v", err)
+	}
+}
+
+func TestServeIdlePolicy(t *testing.T) {
+	errs := make(chan error, 1)
+	s := &Server{Options: []Option{
+		WithIdlePolicy(IdlePolicy{Read: 50 * time.Millisecond}),
+		WithErrorHandler(func(addr net.Addr, err error) { errs <- err }),
+	}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn := dialEchoed(t, addr)
+	defer conn.Close()
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.ReadMsg(); err == nil {
+		t.Fatal("Expected the idle connection to be closed")
+	}
+	if err := <-errs; !errors.Is(err, ErrIdleTimeout) {
+		t.Fatalf("Expected ErrIdleTimeout, got %v", err)
+	}
+}
@@ -0,0 +1,184 @@
+package securecomm
+
+import (
+	"encoding/binary"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A KeepalivePolicy says how often a SecureConn pings its peer, so that
+// a tunnel that sits idle for a long time notices when the peer has
+// gone away without closing the TCP connection. Pings and the pongs
+// answering them are sealed like any other frame, so an attacker on
+// the path cannot keep a dead connection looking alive. The zero
+// KeepalivePolicy sends no pings.
+//
+// Pings are answered, and pongs noticed, by whoever reads from the
+// connection, so both sides must keep reading for keepalives to work.
+type KeepalivePolicy struct {
+	// Interval is how long to wait between pings.
+	Interval time.Duration
+
+	// MaxMissed is how many pings in a row may go unanswered before the
+	// connection is closed and its reads and writes fail with
+	// ErrPeerUnresponsive. Zero means DefaultKeepaliveMaxMissed.
+	MaxMissed int
+}
+
+// DefaultKeepaliveMaxMissed is the number of unanswered pings a
+// KeepalivePolicy with a zero MaxMissed tolerates.
+const DefaultKeepaliveMaxMissed = 3
+
+func (p KeepalivePolicy) maxMissed() int32 {
+	if p.MaxMissed > 0 {
+		return int32(p.MaxMissed)
+	}
+
+	return DefaultKeepaliveMaxMissed
+}
+
+// keepalive is the state a SecureConn keeps for pinging its peer.
+type keepalive struct {
+	// mu guards stop, which stops the goroutine sending pings, stopIdle
+	// and stopLifetime, which stop the ones enforcing the IdlePolicy and
+	// LifetimePolicy, and err, which is set once one of them closed the
+	// connection.
+	mu           sync.Mutex
+	stop         chan struct{}
+	stopIdle     chan struct{}
+	stopLifetime chan struct{}
+	err          error
+
+	// missed counts pings sent since the last pong, and peerClosed is
+	// set once the peer sent its close frame, after which it no longer
+	// reads our pings.
+	missed     int32
+	peerClosed int32
+}
+
+// SetKeepalivePolicy sets how often the connection pings the peer,
+// replacing any earlier policy. The zero KeepalivePolicy stops pinging.
+// It has no effect when the peer did not advertise support for pings.
+func (c *SecureConn) SetKeepalivePolicy(policy KeepalivePolicy) {
+	if c.features&featureKeepalive == 0 {
+		return
+	}
+
+	c.keepalive.mu.Lock()
+	defer c.keepalive.mu.Unlock()
+
+	c.stopKeepaliveLocked()
+	if policy.Interval > 0 {
+		c.keepalive.stop = make(chan struct{})
+		go c.ping(policy, c.keepalive.stop)
+	}
+}
+
+// ping sends a ping every policy.Interval until stop is closed, and
+// closes the connection once too many of them went unanswered.
+func (c *SecureConn) ping(policy KeepalivePolicy, stop chan struct{}) {
+	timer := c.clock.NewTimer(policy.Interval)
+	defer timer.Stop()
+
+	var id [8]byte
+	for n := uint64(1); ; n++ {
+		select {
+		case <-stop:
+			return
+		case <-timer.C():
+		}
+
+		if atomic.LoadInt32(&c.keepalive.peerClosed) != 0 {
+			return
+		}
+		if atomic.AddInt32(&c.keepalive.missed, 1) > policy.maxMissed() {
+			c.keepalive.mu.Lock()
+			c.keepalive.err = ErrPeerUnresponsive
+			c.keepalive.mu.Unlock()
+			c.conn.Close()
+			return
+		}
+
+		// A failed ping means we closed our side or the connection
+		// broke, which the next read or write reports.
+		binary.BigEndian.PutUint64(id[:], n)
+		if err := c.writer.writeControl(flagPing, id[:]); err != nil {
+			return
+		}
+		timer.Reset(policy.Interval)
+	}
+}
+
+// control answers the peer's pings and requests for acknowledgement,
+// and notes its pongs, acknowledgements, closing notice and close frame.
+func (c *SecureConn) control(flags byte, payload []byte) error {
+	switch {
+	case flags&flagClosing == flagClosing:
+		c.closingOnce.Do(func() { close(c.closing) })
+	case flags&flagPing != 0:
+		// Once we closed our side the peer reads no pongs, and its
+		// keepalive stops when it reads our close frame.
+		if err := c.writer.writeControl(flagPong, payload); err != nil && !errors.Is(err, ErrWriteClosed) {
+			return err
+		}
+	case flags&flagPong != 0:
+		atomic.StoreInt32(&c.keepalive.missed, 0)
+		if flags&flagAck != 0 {
+			c.acks.acknowledged(payload)
+		}
+	case flags&flagAck != 0:
+		if err := c.writer.writeControl(flagPong|flagAck, payload); err != nil && !errors.Is(err, ErrWriteClosed) {
+			return err
+		}
+	case flags&flagClose != 0:
+		atomic.StoreInt32(&c.keepalive.peerClosed, 1)
+	}
+
+	return nil
+}
+
+// stopKeepaliveLocked stops pinging the peer. The caller must hold
+// keepalive.mu.
+func (c *SecureConn) stopKeepaliveLocked() {
+	if c.keepalive.stop != nil {
+		close(c.keepalive.stop)
+		c.keepalive.stop = nil
+	}
+}
+
+// stopTimers stops pinging the peer and enforcing the IdlePolicy and
+// LifetimePolicy.
+func (c *SecureConn) stopTimers() {
+	c.keepalive.mu.Lock()
+	defer c.keepalive.mu.Unlock()
+
+	c.stopKeepaliveLocked()
+	if c.keepalive.stopIdle != nil {
+		close(c.keepalive.stopIdle)
+		c.keepalive.stopIdle = nil
+	}
+	if c.keepalive.stopLifetime != nil {
+		close(c.keepalive.stopLifetime)
+		c.keepalive.stopLifetime = nil
+	}
+}
+
+// keepaliveErr replaces err with ErrPeerUnresponsive, ErrIdleTimeout or
+// ErrMaxLifetime when the connection failed because the peer stopped
+// answering pings, it sat idle for too long or it lived too long.
+func (c *SecureConn) keepaliveErr(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	c.keepalive.mu.Lock()
+	defer c.keepalive.mu.Unlock()
+
+	if c.keepalive.err != nil {
+		return c.keepalive.err
+	}
+
+	return err
+}
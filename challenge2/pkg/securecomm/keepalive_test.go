@@ -0,0 +1,88 @@
+package securecomm
+
+import (
+	"bytes"
+	"errors"
+	"runtime"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestKeepalive(t *testing.T) {
+	clock := newFakeClock()
+	client, server, err := testPipe(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// Both sides keep reading, so the server answers every ping.
+	messages := make(chan error, 1)
+	go func() {
+		for {
+			message, err := server.ReadMsg()
+			if err == nil && string(message) != "still here" {
+				err = errors.New("unexpected message " + string(message))
+			}
+			messages <- err
+			if err != nil {
+				return
+			}
+		}
+	}()
+	go func() {
+		for {
+			if _, err := client.ReadMsg(); err != nil {
+				return
+			}
+		}
+	}()
+
+	// Far more intervals than pings may be missed.
+	client.SetKeepalivePolicy(KeepalivePolicy{Interval: time.Minute, MaxMissed: 2})
+	for i := 0; i < 10; i++ {
+		clock.waitTimers(t, 1)
+		clock.Advance(time.Minute)
+		clock.waitTimers(t, 1)
+		waitPong(t, client)
+	}
+
+	if err := client.WriteMsg([]byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-messages; err != nil {
+		t.Fatalf("Expected an idle connection with a live peer to survive, got %v", err)
+	}
+}
+
+// waitPong waits until c has had a pong for every ping it sent.
+func waitPong(t *testing.T, c *SecureConn) {
+	t.Helper()
+	for start := time.Now(); time.Since(start) < 5*time.Second; runtime.Gosched() {
+		if atomic.LoadInt32(&c.keepalive.missed) == 0 {
+			return
+		}
+	}
+	t.Fatal("Timed out waiting for a pong")
+}
+
+func TestKeepaliveIgnoredWithoutReader(t *testing.T) {
+	// A plain SecureReader has nobody to answer pings and skips them.
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	if err := secureW.writeControl(flagPing, []byte("12345678")); err != nil {
+		t.Fatal(err)
+	}
+	if err := secureW.WriteMsg([]byte("data")); err != nil {
+		t.Fatal(err)
+	}
+
+	secureR := NewSecureReader(&buf, priv, pub)
+	if message, err := secureR.ReadMsg(); err != nil || string(message) != "data" {
+		t.Fatalf("Unexpected message %q, %v", message, err)
+	}
+}
@@ -0,0 +1,300 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+	"golang.org/x/crypto/ssh/terminal"
+)
+
+// A KeyPair is a long-term X25519 identity key. Unlike the keys
+// generated for each connection, it identifies a peer across
+// connections.
+type KeyPair struct {
+	Public, Private [32]byte
+}
+
+// An IdentityKey is a long-term X25519 key whose private half only
+// takes part in key agreement, so it may be kept out of this process, by
+// an agent or on a hardware token, and lent out for that alone. A
+// KeyPair is an IdentityKey held in memory.
+type IdentityKey interface {
+	// PublicKey returns the public half of the key.
+	PublicKey() *[32]byte
+
+	// ECDH returns the X25519 shared secret of the private half of the
+	// key and peer.
+	ECDH(peer *[32]byte) ([32]byte, error)
+}
+
+// PublicKey returns k.Public.
+func (k *KeyPair) PublicKey() *[32]byte {
+	return &k.Public
+}
+
+// ECDH returns the X25519 shared secret of k.Private and peer.
+func (k *KeyPair) ECDH(peer *[32]byte) ([32]byte, error) {
+	var shared [32]byte
+	curve25519.ScalarMult(&shared, &k.Private, peer)
+
+	return shared, nil
+}
+
+// GenerateKey generates a new identity key.
+func GenerateKey() (*KeyPair, error) {
+	pub, priv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("generate identity key: %w", err)
+	}
+
+	return &KeyPair{Public: *pub, Private: *priv}, nil
+}
+
+// newKeyPair derives the public half of a private key.
+func newKeyPair(private []byte) *KeyPair {
+	var key KeyPair
+	copy(key.Private[:], private)
+	curve25519.ScalarBaseMult(&key.Public, &key.Private)
+
+	return &key
+}
+
+// PassphraseEnv names the environment variable LoadKey and
+// LoadOrGenerateKey read a key file passphrase from.
+const PassphraseEnv = "SECURE_KEY_PASSPHRASE"
+
+// A PassphraseFunc supplies the passphrase protecting a key file. It is
+// only called when one is needed.
+type PassphraseFunc func() ([]byte, error)
+
+// EnvOrTerminalPassphrase returns the passphrase held in PassphraseEnv
+// or, when that is unset, prompts for it on the terminal.
+func EnvOrTerminalPassphrase() ([]byte, error) {
+	return ReadPassphrase(PassphraseEnv, "Key passphrase: ")
+}
+
+// ReadPassphrase returns the value of the environment variable env or,
+// when it is unset, prompts for a passphrase on the terminal.
+func ReadPassphrase(env, prompt string) ([]byte, error) {
+	if passphrase, ok := os.LookupEnv(env); ok {
+		return []byte(passphrase), nil
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !terminal.IsTerminal(fd) {
+		return nil, fmt.Errorf("set %s or run from a terminal: %w", env, ErrPassphraseRequired)
+	}
+
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := terminal.ReadPassword(fd)
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, fmt.Errorf("read passphrase: %w", err)
+	}
+
+	return passphrase, nil
+}
+
+// LoadOrGenerateKey loads the identity key stored at path. If there is
+// no file at path, a new key is generated and saved there, readable only
+// by the current user. The new key is encrypted when PassphraseEnv is
+// set.
+func LoadOrGenerateKey(path string) (*KeyPair, error) {
+	key, err := LoadKey(path)
+	if !errors.Is(err, os.ErrNotExist) {
+		return key, err
+	}
+
+	if key, err = GenerateKey(); err != nil {
+		return nil, err
+	}
+
+	passphrase, _ := os.LookupEnv(PassphraseEnv)
+	if err := SaveKey(path, key, []byte(passphrase)); err != nil {
+		return nil, err
+	}
+
+	return key, nil
+}
+
+// LoadKey loads the identity key stored at path. Encrypted keys are
+// opened with EnvOrTerminalPassphrase.
+func LoadKey(path string) (*KeyPair, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load identity key: %w", err)
+	}
+
+	key, err := ParseKey(data, EnvOrTerminalPassphrase)
+	if err != nil {
+		return nil, fmt.Errorf("load identity key %s: %w", path, err)
+	}
+
+	return key, nil
+}
+
+// SaveKey writes key to a new file at path, readable only by the current
+// user, encrypting it when passphrase is not empty. An existing file is
+// never overwritten.
+func SaveKey(path string, key *KeyPair, passphrase []byte) error {
+	data, err := key.MarshalPEM(passphrase)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return fmt.Errorf("save identity key: %w", err)
+	}
+
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return fmt.Errorf("save identity key: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("save identity key: %w", err)
+	}
+
+	return nil
+}
+
+// Key files are PEM encoded. Encrypted keys are sealed with secretbox
+// under a key stretched from the passphrase with argon2id; the salt and
+// argon2 parameters travel in the PEM headers so they can be raised
+// later without breaking existing files.
+const (
+	pemKeyType          = "SECURE PRIVATE KEY"
+	pemEncryptedKeyType = "SECURE ENCRYPTED PRIVATE KEY"
+
+	argonTime    = 3
+	argonMemory  = 64 * 1024
+	argonThreads = 4
+	argonSalt    = 16
+)
+
+// MarshalPEM encodes the private key as a PEM block, encrypted with the
+// passphrase unless it is empty.
+func (k *KeyPair) MarshalPEM(passphrase []byte) ([]byte, error) {
+	if len(passphrase) == 0 {
+		return pem.EncodeToMemory(&pem.Block{Type: pemKeyType, Bytes: k.Private[:]}), nil
+	}
+
+	salt := make([]byte, argonSalt)
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, salt); err != nil {
+		return nil, fmt.Errorf("generate salt: %w", err)
+	}
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, fmt.Errorf("generate nonce: %w", err)
+	}
+
+	var sealKey [32]byte
+	copy(sealKey[:], argon2.IDKey(passphrase, salt, argonTime, argonMemory, argonThreads, 32))
+
+	block := pem.Block{
+		Type: pemEncryptedKeyType,
+		Headers: map[string]string{
+			"KDF":     "argon2id",
+			"Salt":    hex.EncodeToString(salt),
+			"Time":    strconv.Itoa(argonTime),
+			"Memory":  strconv.Itoa(argonMemory),
+			"Threads": strconv.Itoa(argonThreads),
+		},
+		Bytes: secretbox.Seal(nonce[:], k.Private[:], &nonce, &sealKey),
+	}
+
+	return pem.EncodeToMemory(&block), nil
+}
+
+// ParseKey decodes a key file. passphrase is called only if the key is
+// encrypted. Files holding a bare hex encoded key, as written by earlier
+// versions, are accepted too.
+func ParseKey(data []byte, passphrase PassphraseFunc) (*KeyPair, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		private, err := hex.DecodeString(string(bytes.TrimSpace(data)))
+		if err != nil || len(private) != 32 {
+			return nil, errors.New("not a PEM or hex encoded 32 byte key")
+		}
+		return newKeyPair(private), nil
+	}
+
+	switch block.Type {
+	case pemKeyType:
+		if len(block.Bytes) != 32 {
+			return nil, fmt.Errorf("key holds %d bytes, expected 32", len(block.Bytes))
+		}
+		return newKeyPair(block.Bytes), nil
+	case pemEncryptedKeyType:
+		return openKey(block, passphrase)
+	default:
+		return nil, fmt.Errorf("unexpected PEM block %q", block.Type)
+	}
+}
+
+func openKey(block *pem.Block, passphrase PassphraseFunc) (*KeyPair, error) {
+	if kdf := block.Headers["KDF"]; kdf != "argon2id" {
+		return nil, fmt.Errorf("unsupported key derivation %q", kdf)
+	}
+
+	salt, err := hex.DecodeString(block.Headers["Salt"])
+	if err != nil {
+		return nil, fmt.Errorf("invalid salt: %w", err)
+	}
+
+	var params [3]uint64
+	for i, name := range []string{"Time", "Memory", "Threads"} {
+		if params[i], err = strconv.ParseUint(block.Headers[name], 10, 32); err != nil {
+			return nil, fmt.Errorf("invalid %s: %w", strings.ToLower(name), err)
+		}
+	}
+	if params[2] > 255 {
+		return nil, fmt.Errorf("invalid threads: %d", params[2])
+	}
+
+	if len(block.Bytes) < 24+secretbox.Overhead {
+		return nil, errors.New("encrypted key is truncated")
+	}
+	var nonce [24]byte
+	copy(nonce[:], block.Bytes)
+
+	if passphrase == nil {
+		return nil, ErrPassphraseRequired
+	}
+	secret, err := passphrase()
+	if err != nil {
+		return nil, err
+	}
+	if len(secret) == 0 {
+		return nil, ErrPassphraseRequired
+	}
+
+	var sealKey [32]byte
+	copy(sealKey[:], argon2.IDKey(secret, salt, uint32(params[0]), uint32(params[1]), uint8(params[2]), 32))
+
+	private, ok := secretbox.Open(nil, block.Bytes[24:], &nonce, &sealKey)
+	if !ok || len(private) != 32 {
+		return nil, ErrIncorrectPassphrase
+	}
+
+	return newKeyPair(private), nil
+}
+
+// String returns the hex encoded public key, which is safe to share.
+func (k *KeyPair) String() string {
+	return hex.EncodeToString(k.Public[:])
+}
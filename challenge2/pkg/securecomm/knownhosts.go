@@ -0,0 +1,224 @@
+package securecomm
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Fingerprint returns a short, printable digest of a public key for
+// people to compare.
+func Fingerprint(key [32]byte) string {
+	sum := sha256.Sum256(key[:])
+	return "SHA256:" + base64.RawStdEncoding.EncodeToString(sum[:])
+}
+
+// A HostKeyChangedError is returned when a server presents a different
+// identity key than the one recorded for it. Either the server's key was
+// replaced or someone is intercepting the connection.
+type HostKeyChangedError struct {
+	Host      string
+	Known     [32]byte
+	Presented [32]byte
+}
+
+func (e *HostKeyChangedError) Error() string {
+	return fmt.Sprintf("WARNING: THE IDENTITY OF %s HAS CHANGED! Someone could be intercepting this connection. "+
+		"Expected key %s but the server presented %s. Remove the old entry from the known hosts file if the change is legitimate.",
+		e.Host, Fingerprint(e.Known), Fingerprint(e.Presented))
+}
+
+// KnownHosts pins the identity keys of servers, trusting each server's
+// key the first time it is seen. It is safe for concurrent use.
+//
+// The file holds one "host hex-public-key" line per server, or more
+// while a server rotates its key, oldest first; blank lines and lines
+// starting with # are ignored.
+type KnownHosts struct {
+	// Confirm, when set, is asked whether to trust a server seen for
+	// the first time. When nil, new servers are trusted automatically.
+	Confirm func(host, fingerprint string) bool
+
+	path  string
+	mu    sync.Mutex
+	hosts map[string][][32]byte
+}
+
+// LoadKnownHosts reads the known hosts file at path. A missing file is
+// treated as empty and created once a host is recorded.
+func LoadKnownHosts(path string) (*KnownHosts, error) {
+	kh := KnownHosts{path: path, hosts: make(map[string][][32]byte)}
+
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &kh, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load known hosts: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		fields := strings.Fields(text)
+		key, err := hex.DecodeString(fields[len(fields)-1])
+		if len(fields) != 2 || err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("load known hosts: %s:%d: expected a host and a hex encoded key", path, line)
+		}
+
+		var pinned [32]byte
+		copy(pinned[:], key)
+		kh.hosts[fields[0]] = append(kh.hosts[fields[0]], pinned)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("load known hosts: %w", err)
+	}
+
+	return &kh, nil
+}
+
+// Verify checks key against the keys recorded for host. An unknown host
+// is recorded, after asking Confirm if it is set. A host presenting a
+// key it announced with Rotate has the keys recorded before it retired.
+// A host whose key changed otherwise fails with a *HostKeyChangedError.
+func (kh *KnownHosts) Verify(host string, key [32]byte) error {
+	kh.mu.Lock()
+	defer kh.mu.Unlock()
+
+	if known, ok := kh.hosts[host]; ok {
+		for i, k := range known {
+			if k != key {
+				continue
+			}
+			if i > 0 {
+				if err := kh.retire(host, known[:i]); err != nil {
+					return err
+				}
+				kh.hosts[host] = known[i:]
+			}
+			return nil
+		}
+		return &HostKeyChangedError{Host: host, Known: known[len(known)-1], Presented: key}
+	}
+
+	if kh.Confirm != nil && !kh.Confirm(host, Fingerprint(key)) {
+		return fmt.Errorf("%s: %w", host, ErrHostKeyRejected)
+	}
+
+	if err := kh.record(host, key); err != nil {
+		return err
+	}
+	kh.hosts[host] = [][32]byte{key}
+
+	return nil
+}
+
+// Rotate records next as a key host may present from now on, as the
+// server announces during the handshake before rotating its identity
+// key, so that the rotation goes unnoticed. It does nothing unless
+// current is the key the host is known by, so only a host that proved
+// it holds a pinned key can vouch for its next.
+func (kh *KnownHosts) Rotate(host string, current, next [32]byte) error {
+	kh.mu.Lock()
+	defer kh.mu.Unlock()
+
+	known := kh.hosts[host]
+	pinned := false
+	for _, k := range known {
+		if k == next {
+			return nil
+		}
+		pinned = pinned || k == current
+	}
+	if !pinned {
+		return nil
+	}
+
+	if err := kh.record(host, next); err != nil {
+		return err
+	}
+	kh.hosts[host] = append(known, next)
+
+	return nil
+}
+
+// record appends a line for host and key to the file.
+func (kh *KnownHosts) record(host string, key [32]byte) error {
+	file, err := os.OpenFile(kh.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("record known host: %w", err)
+	}
+
+	if _, err := fmt.Fprintf(file, "%s %s\n", host, hex.EncodeToString(key[:])); err != nil {
+		file.Close()
+		return fmt.Errorf("record known host: %w", err)
+	}
+
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("record known host: %w", err)
+	}
+
+	return nil
+}
+
+// retire rewrites the file without the lines for host and the keys
+// retired, leaving the rest as they were.
+func (kh *KnownHosts) retire(host string, retired [][32]byte) error {
+	contents, err := os.ReadFile(kh.path)
+	if err != nil {
+		return fmt.Errorf("retire known host key: %w", err)
+	}
+
+	var kept []string
+	for _, line := range strings.SplitAfter(string(contents), "\n") {
+		if fields := strings.Fields(line); len(fields) == 2 && fields[0] == host && containsKey(retired, fields[1]) {
+			continue
+		}
+		kept = append(kept, line)
+	}
+
+	// Written whole and then renamed, so that a crash halfway leaves
+	// the old file rather than half of the new one.
+	tmp, err := os.CreateTemp(filepath.Dir(kh.path), filepath.Base(kh.path)+".*")
+	if err != nil {
+		return fmt.Errorf("retire known host key: %w", err)
+	}
+	if _, err := tmp.WriteString(strings.Join(kept, "")); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return fmt.Errorf("retire known host key: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("retire known host key: %w", err)
+	}
+	if err := os.Rename(tmp.Name(), kh.path); err != nil {
+		os.Remove(tmp.Name())
+		return fmt.Errorf("retire known host key: %w", err)
+	}
+
+	return nil
+}
+
+// containsKey reports whether the hex encoded key is among keys.
+func containsKey(keys [][32]byte, encoded string) bool {
+	for _, key := range keys {
+		if strings.EqualFold(hex.EncodeToString(key[:]), encoded) {
+			return true
+		}
+	}
+
+	return false
+}
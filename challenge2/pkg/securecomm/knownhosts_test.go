@@ -0,0 +1,106 @@
+package securecomm
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestKnownHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure-known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "known_hosts")
+	first, second := [32]byte{1}, [32]byte{2}
+
+	kh, err := LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kh.Verify("example.com:1234", first); err != nil {
+		t.Fatalf("First use was not trusted: %v", err)
+	}
+
+	// A fresh load sees the recorded key.
+	kh, err = LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kh.Verify("example.com:1234", first); err != nil {
+		t.Fatalf("Recorded key was not accepted: %v", err)
+	}
+
+	var changed *HostKeyChangedError
+	if err := kh.Verify("example.com:1234", second); !errors.As(err, &changed) {
+		t.Fatalf("Expected a HostKeyChangedError, got %v", err)
+	}
+	if changed.Known != first || changed.Presented != second {
+		t.Errorf("Unexpected keys in %v", changed)
+	}
+	if !strings.Contains(changed.Error(), Fingerprint(second)) {
+		t.Errorf("Error does not name the presented fingerprint: %v", changed)
+	}
+
+	var asked string
+	kh.Confirm = func(host, fingerprint string) bool {
+		asked = fingerprint
+		return false
+	}
+	if err := kh.Verify("other.example.com:1234", second); !errors.Is(err, ErrHostKeyRejected) {
+		t.Fatalf("Expected ErrHostKeyRejected, got %v", err)
+	}
+	if asked != Fingerprint(second) {
+		t.Errorf("Confirm was asked about %q", asked)
+	}
+}
+
+func TestDialKnownHosts(t *testing.T) {
+	dir, err := ioutil.TempDir("", "secure-known-hosts")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	serverKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	identified := testutil.Listen(t)
+	go Serve(identified, nil, WithIdentity(serverKey))
+
+	anonymous := testutil.Listen(t)
+	go Serve(anonymous, nil)
+
+	kh, err := LoadKnownHosts(filepath.Join(dir, "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		conn, err := Dial(identified.Addr().String(), WithKnownHosts(kh))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+	}
+
+	if _, err := Dial(anonymous.Addr().String(), WithKnownHosts(kh)); !errors.Is(err, ErrNoPeerIdentity) {
+		t.Fatalf("Expected ErrNoPeerIdentity, got %v", err)
+	}
+
+	// Pretend the server we trusted was replaced by an impostor.
+	kh.hosts[identified.Addr().String()] = [][32]byte{{42}}
+	var changed *HostKeyChangedError
+	if _, err := Dial(identified.Addr().String(), WithKnownHosts(kh)); !errors.As(err, &changed) {
+		t.Fatalf("Expected a HostKeyChangedError, got %v", err)
+	}
+}
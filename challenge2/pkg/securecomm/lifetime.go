@@ -0,0 +1,104 @@
+package securecomm
+
+import "time"
+
+// closeReasonLifetime is the payload of the close frame sent when a
+// connection reaches the end of its LifetimePolicy.
+const closeReasonLifetime = 3
+
+// flagClosing, the flags of a ping and a close frame together, marks a
+// control frame announcing that the writer will soon close the
+// connection. Only peers that advertise featureLifetime are sent one.
+const flagClosing = flagClose | flagPing
+
+// DefaultLifetimeWarning is how long before closing a connection a
+// LifetimePolicy with a zero Warning announces it.
+const DefaultLifetimeWarning = 30 * time.Second
+
+// A LifetimePolicy says how long a SecureConn may live before it is
+// closed, so that long-lived sessions are made to handshake again from
+// time to time, with fresh keys and a fresh check of who the peer is.
+// The zero LifetimePolicy never closes the connection.
+type LifetimePolicy struct {
+	// Max is how long after the handshake the connection is closed.
+	// Zero means no limit.
+	Max time.Duration
+
+	// Warning is how long before closing the connection it is
+	// announced, to the peer if it understands such notices and to
+	// Closing on both ends. Zero means DefaultLifetimeWarning, or Max
+	// if that is shorter.
+	Warning time.Duration
+}
+
+func (p LifetimePolicy) warning() time.Duration {
+	warning := p.Warning
+	if warning <= 0 {
+		warning = DefaultLifetimeWarning
+	}
+	if warning > p.Max {
+		warning = p.Max
+	}
+
+	return warning
+}
+
+// SetLifetimePolicy sets how long the connection may live, counting
+// from its handshake and replacing any earlier policy. Once it has
+// lived that long, the peer is sent a close frame, the connection is
+// closed, and its reads and writes fail with ErrMaxLifetime, as do the
+// peer's reads if it understands close reasons.
+func (c *SecureConn) SetLifetimePolicy(policy LifetimePolicy) {
+	c.keepalive.mu.Lock()
+	defer c.keepalive.mu.Unlock()
+
+	if c.keepalive.stopLifetime != nil {
+		close(c.keepalive.stopLifetime)
+		c.keepalive.stopLifetime = nil
+	}
+	if policy.Max > 0 {
+		c.keepalive.stopLifetime = make(chan struct{})
+		go c.expire(policy, c.keepalive.stopLifetime)
+	}
+}
+
+// Closing returns a channel that is closed once either end announced
+// that it is about to close the connection for reaching the end of its
+// LifetimePolicy, so that the application can wind down and connect
+// again.
+func (c *SecureConn) Closing() <-chan struct{} {
+	return c.closing
+}
+
+// expire announces that the connection is closing as policy says, then
+// closes it, unless stop is closed first.
+func (c *SecureConn) expire(policy LifetimePolicy, stop chan struct{}) {
+	end := c.established.Add(policy.Max)
+	timer := c.clock.NewTimer(end.Add(-policy.warning()).Sub(c.clock.Now()))
+	defer timer.Stop()
+
+	select {
+	case <-stop:
+		return
+	case <-timer.C():
+	}
+	if c.features&featureLifetime != 0 {
+		// A failed notice means the connection is going anyway.
+		c.writer.writeControl(flagClosing, nil)
+	}
+	c.closingOnce.Do(func() { close(c.closing) })
+
+	timer.Reset(end.Sub(c.clock.Now()))
+	select {
+	case <-stop:
+		return
+	case <-timer.C():
+	}
+	c.keepalive.mu.Lock()
+	c.keepalive.err = ErrMaxLifetime
+	c.keepalive.mu.Unlock()
+	if c.features&featureClose != 0 {
+		c.writer.close([]byte{closeReasonLifetime})
+	}
+	c.Close()
+}
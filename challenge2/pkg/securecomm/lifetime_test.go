@@ -0,0 +1,114 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLifetimePolicy(t *testing.T) {
+	clock := newFakeClock()
+	client, server, err := testPipe(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	reads := make(chan error, 1)
+	go func() {
+		for {
+			if _, err := server.ReadMsg(); err != nil {
+				reads <- err
+				return
+			}
+		}
+	}()
+
+	client.SetLifetimePolicy(LifetimePolicy{Max: time.Hour, Warning: time.Minute})
+	clock.waitTimers(t, 1)
+	clock.Advance(58 * time.Minute)
+	select {
+	case <-client.Closing():
+		t.Fatal("Expected no closing notice before the warning")
+	default:
+	}
+
+	clock.Advance(time.Minute)
+	for _, sc := range []*SecureConn{client, server} {
+		select {
+		case <-sc.Closing():
+		case <-time.After(5 * time.Second):
+			t.Fatal("Timed out waiting for the closing notice")
+		}
+	}
+	if err := client.WriteMsg([]byte("still here")); err != nil {
+		t.Fatalf("Expected the connection to stay open until its lifetime is up, got %v", err)
+	}
+
+	clock.waitTimers(t, 1)
+	clock.Advance(time.Minute)
+	err = waitErr(t, func() error { return client.WriteMsg([]byte("hello?")) })
+	if !errors.Is(err, ErrMaxLifetime) {
+		t.Fatalf("Expected ErrMaxLifetime, got %v", err)
+	}
+	if err := <-reads; !errors.Is(err, ErrMaxLifetime) {
+		t.Fatalf("Expected the peer to read ErrMaxLifetime, got %v", err)
+	}
+}
+
+func TestLifetimePolicyStopped(t *testing.T) {
+	clock := newFakeClock()
+	client, server, err := testPipe(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	client.SetLifetimePolicy(LifetimePolicy{Max: time.Hour})
+	clock.waitTimers(t, 1)
+	client.SetLifetimePolicy(LifetimePolicy{})
+	clock.waitTimers(t, 0)
+
+	clock.Advance(2 * time.Hour)
+	select {
+	case <-client.Closing():
+		t.Fatal("Expected no closing notice once the policy was cleared")
+	default:
+	}
+	if err := client.WriteMsg([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWithLifetimePolicy(t *testing.T) {
+	addr := serveHandler(t, func(ctx context.Context, conn *SecureConn) error {
+		for {
+			if _, err := conn.ReadMsg(); err != nil {
+				return err
+			}
+		}
+	}, WithLifetimePolicy(LifetimePolicy{Max: 200 * time.Millisecond, Warning: 100 * time.Millisecond}))
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	reads := make(chan error, 1)
+	go func() {
+		_, err := conn.ReadMsg()
+		reads <- err
+	}()
+	select {
+	case <-conn.Closing():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the server's closing notice")
+	}
+	if err := <-reads; !errors.Is(err, ErrMaxLifetime) {
+		t.Fatalf("Expected ErrMaxLifetime, got %v", err)
+	}
+}
@@ -0,0 +1,154 @@
+package securecomm
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// A LoadTest drives an echo server with many clients at once, each
+// sending a message, waiting for its echo and sending the next, to show
+// how the server's latency holds up as load grows.
+type LoadTest struct {
+	// Clients is how many clients run at once. Zero means one.
+	Clients int
+
+	// Size is how many bytes each message has. Zero means 1024.
+	Size int
+
+	// Dial connects a client to the server. A client whose connection
+	// fails dials again.
+	Dial func(ctx context.Context) (*SecureConn, error)
+}
+
+// LoadTestResult sums up a LoadTest.
+type LoadTestResult struct {
+	// Elapsed is how long the clients ran.
+	Elapsed time.Duration
+
+	// RoundTrips is how many messages came back intact, and Errors how
+	// many round trips or dials failed.
+	RoundTrips, Errors int64
+
+	// The latencies of the round trips that succeeded, at the median,
+	// the 99th percentile and the slowest.
+	P50, P99, Max time.Duration
+}
+
+// Rate returns the round trips a second.
+func (r LoadTestResult) Rate() float64 {
+	return perSecond(r.RoundTrips, r.Elapsed)
+}
+
+// ErrorRate returns the share of attempts that failed.
+func (r LoadTestResult) ErrorRate() float64 {
+	if r.RoundTrips+r.Errors == 0 {
+		return 0
+	}
+
+	return float64(r.Errors) / float64(r.RoundTrips+r.Errors)
+}
+
+func (r LoadTestResult) String() string {
+	return fmt.Sprintf("%d round trips in %s (%.0f/s), %d errors (%.2f%%), latency p50 %s p99 %s max %s",
+		r.RoundTrips, r.Elapsed.Round(time.Millisecond), r.Rate(), r.Errors, 100*r.ErrorRate(), r.P50, r.P99, r.Max)
+}
+
+// Run runs the clients until ctx is done.
+func (lt LoadTest) Run(ctx context.Context) LoadTestResult {
+	clients, size := lt.Clients, lt.Size
+	if clients <= 0 {
+		clients = 1
+	}
+	if size <= 0 {
+		size = 1024
+	}
+
+	latencies := make([][]time.Duration, clients)
+	errs := make([]int64, clients)
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			latencies[i], errs[i] = lt.client(ctx, size)
+		}(i)
+	}
+	wg.Wait()
+
+	result := LoadTestResult{Elapsed: time.Since(start)}
+	var all []time.Duration
+	for i := range latencies {
+		all = append(all, latencies[i]...)
+		result.Errors += errs[i]
+	}
+	result.RoundTrips = int64(len(all))
+	if len(all) > 0 {
+		sort.Slice(all, func(i, j int) bool { return all[i] < all[j] })
+		result.P50 = all[len(all)/2]
+		result.P99 = all[len(all)*99/100]
+		result.Max = all[len(all)-1]
+	}
+
+	return result
+}
+
+// client runs one client until ctx is done, returning the latency of
+// each round trip that succeeded and how many attempts failed.
+func (lt LoadTest) client(ctx context.Context, size int) ([]time.Duration, int64) {
+	var latencies []time.Duration
+	var errs int64
+	message, echo := make([]byte, size), make([]byte, size)
+	for ctx.Err() == nil {
+		conn, err := lt.Dial(ctx)
+		if err != nil {
+			if ctx.Err() == nil {
+				errs++
+			}
+			continue
+		}
+		// Closing the connection is what cuts a round trip short when
+		// ctx is done.
+		stop := context.AfterFunc(ctx, func() { conn.Close() })
+
+		for n := 0; ; n++ {
+			copy(message, fmt.Sprint(n))
+			began := time.Now()
+			err := roundTripMessage(conn, message, echo)
+			if ctx.Err() != nil {
+				break
+			}
+			if err != nil {
+				errs++
+				break
+			}
+			latencies = append(latencies, time.Since(began))
+		}
+		stop()
+		conn.Close()
+	}
+
+	return latencies, errs
+}
+
+// roundTripMessage sends message over conn and reads its echo into echo,
+// checking that it came back as sent.
+func roundTripMessage(conn *SecureConn, message, echo []byte) error {
+	if _, err := conn.Write(message); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(conn, echo); err != nil {
+		return err
+	}
+	if !bytes.Equal(echo, message) {
+		return errors.New("echo does not match the message")
+	}
+
+	return nil
+}
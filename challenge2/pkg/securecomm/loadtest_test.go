@@ -0,0 +1,55 @@
+package securecomm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLoadTest(t *testing.T) {
+	s := new(Server)
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	result := LoadTest{Clients: 8, Size: 4096, Dial: func(ctx context.Context) (*SecureConn, error) {
+		return DialContext(ctx, addr)
+	}}.Run(ctx)
+
+	if result.RoundTrips == 0 {
+		t.Fatal("Expected round trips to succeed")
+	}
+	if result.Errors != 0 {
+		t.Errorf("Expected no errors, got %d: %s", result.Errors, result)
+	}
+	if result.P50 <= 0 || result.P50 > result.P99 || result.P99 > result.Max {
+		t.Errorf("Expected ordered latencies, got %s", result)
+	}
+}
+
+func TestLoadTestErrors(t *testing.T) {
+	// A server that hangs up on each client after its first message.
+	s := &Server{Handler: func(ctx context.Context, conn *SecureConn) error {
+		message, err := conn.ReadMsg()
+		if err != nil {
+			return err
+		}
+		return conn.WriteMsg(message)
+	}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	result := LoadTest{Clients: 4, Size: 16, Dial: func(ctx context.Context) (*SecureConn, error) {
+		return DialContext(ctx, addr)
+	}}.Run(ctx)
+
+	if result.RoundTrips == 0 || result.Errors == 0 {
+		t.Fatalf("Expected both round trips and errors, got %s", result)
+	}
+	if rate := result.ErrorRate(); rate < 0.2 || rate > 0.8 {
+		t.Errorf("Expected about half the attempts to fail, got %.2f", rate)
+	}
+}
@@ -0,0 +1,374 @@
+package securecomm
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// Retention limits of a Mailbox whose MaxMessages or MaxAge is zero.
+const (
+	DefaultMailboxMaxMessages = 1000
+	DefaultMailboxMaxAge      = 7 * 24 * time.Hour
+)
+
+// A Mail is a message held for a client identified by its key. Sent is
+// set by the server.
+type Mail struct {
+	// Peer is the recipient of mail a client sends, and the sender of
+	// mail it receives.
+	Peer    [32]byte
+	Sent    time.Time
+	Payload []byte
+}
+
+// mailHeaderSize is the size of the peer and the time sent, which
+// precede the payload of an encoded Mail.
+const mailHeaderSize = 32 + 8
+
+// MarshalBinary encodes m as the peer, the time sent in Unix seconds and
+// the payload.
+func (m Mail) MarshalBinary() ([]byte, error) {
+	b := make([]byte, mailHeaderSize, mailHeaderSize+len(m.Payload))
+	copy(b, m.Peer[:])
+	if !m.Sent.IsZero() {
+		binary.BigEndian.PutUint64(b[32:], uint64(m.Sent.Unix()))
+	}
+
+	return append(b, m.Payload...), nil
+}
+
+// UnmarshalBinary decodes mail encoded by MarshalBinary.
+func (m *Mail) UnmarshalBinary(b []byte) error {
+	if len(b) < mailHeaderSize {
+		return errors.New("mail truncated")
+	}
+
+	copy(m.Peer[:], b)
+	m.Sent = time.Time{}
+	if sent := binary.BigEndian.Uint64(b[32:]); sent != 0 {
+		m.Sent = time.Unix(int64(sent), 0)
+	}
+	m.Payload = append([]byte(nil), b[mailHeaderSize:]...)
+
+	return nil
+}
+
+// A Mailbox stores mail for clients that are not connected, in a
+// directory holding a file per recipient. Each message is sealed with
+// the mailbox key along with its recipient, so the files reveal no more
+// than who has mail and roughly how much. It is safe for concurrent use.
+type Mailbox struct {
+	// MaxMessages is how many messages are kept for each recipient;
+	// the oldest go first. DefaultMailboxMaxMessages when zero.
+	MaxMessages int
+
+	// MaxAge is how long a message is kept. DefaultMailboxMaxAge when
+	// zero.
+	MaxAge time.Duration
+
+	// Clock tells the time for Put and Take, the system clock when
+	// nil. A MailboxHandler goes by the clock of each connection, set
+	// with WithClock.
+	Clock Clock
+
+	dir string
+	key [32]byte
+	mu  sync.Mutex
+}
+
+// OpenMailbox returns the mailbox kept in dir, creating the directory if
+// needed, whose messages are sealed with key.
+func OpenMailbox(dir string, key *[32]byte) (*Mailbox, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("open mailbox: %w", err)
+	}
+
+	return &Mailbox{dir: dir, key: *key}, nil
+}
+
+// Put stores a message from one client to another.
+func (mb *Mailbox) Put(to, from [32]byte, payload []byte) error {
+	now := clockOr(mb.Clock).Now()
+	return mb.put(to, Mail{Peer: from, Sent: now, Payload: payload}, now)
+}
+
+// Take removes and returns the messages stored for a client, oldest
+// first.
+func (mb *Mailbox) Take(to [32]byte) ([]Mail, error) {
+	return mb.take(to, clockOr(mb.Clock).Now())
+}
+
+func (mb *Mailbox) put(to [32]byte, mail Mail, now time.Time) error {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	stored, err := mb.load(to, now)
+	if err != nil {
+		return err
+	}
+	stored = append(stored, mail)
+	if max := mb.maxMessages(); len(stored) > max {
+		stored = stored[len(stored)-max:]
+	}
+
+	return mb.store(to, stored)
+}
+
+func (mb *Mailbox) take(to [32]byte, now time.Time) ([]Mail, error) {
+	mb.mu.Lock()
+	defer mb.mu.Unlock()
+
+	stored, err := mb.load(to, now)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Remove(mb.path(to)); err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("take mail: %w", err)
+	}
+
+	return stored, nil
+}
+
+func (mb *Mailbox) maxMessages() int {
+	if mb.MaxMessages > 0 {
+		return mb.MaxMessages
+	}
+
+	return DefaultMailboxMaxMessages
+}
+
+func (mb *Mailbox) maxAge() time.Duration {
+	if mb.MaxAge > 0 {
+		return mb.MaxAge
+	}
+
+	return DefaultMailboxMaxAge
+}
+
+func (mb *Mailbox) path(to [32]byte) string {
+	return filepath.Join(mb.dir, hex.EncodeToString(to[:]))
+}
+
+// load returns the messages stored for to that are not expired by now.
+// Messages that do not open, or are sealed for another recipient, are
+// dropped.
+func (mb *Mailbox) load(to [32]byte, now time.Time) ([]Mail, error) {
+	data, err := ioutil.ReadFile(mb.path(to))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("load mail: %w", err)
+	}
+
+	var stored []Mail
+	for len(data) > 0 {
+		if len(data) < 4 || uint64(len(data)-4) < uint64(binary.BigEndian.Uint32(data)) {
+			return nil, fmt.Errorf("load mail for %s: file truncated", Fingerprint(to))
+		}
+		n := binary.BigEndian.Uint32(data)
+		sealed := data[4 : 4+n]
+		data = data[4+n:]
+
+		mail, ok := mb.open(to, sealed)
+		if !ok || now.Sub(mail.Sent) > mb.maxAge() {
+			continue
+		}
+		stored = append(stored, mail)
+	}
+
+	return stored, nil
+}
+
+// store replaces the messages stored for to, by way of a temporary file
+// so that a crash leaves either the old messages or the new.
+func (mb *Mailbox) store(to [32]byte, stored []Mail) error {
+	var data bytes.Buffer
+	for _, mail := range stored {
+		sealed, err := mb.seal(to, mail)
+		if err != nil {
+			return err
+		}
+		var length [4]byte
+		binary.BigEndian.PutUint32(length[:], uint32(len(sealed)))
+		data.Write(length[:])
+		data.Write(sealed)
+	}
+
+	file, err := ioutil.TempFile(mb.dir, ".mail")
+	if err != nil {
+		return fmt.Errorf("store mail: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(data.Bytes()); err != nil {
+		file.Close()
+		return fmt.Errorf("store mail: %w", err)
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("store mail: %w", err)
+	}
+	if err := os.Rename(file.Name(), mb.path(to)); err != nil {
+		return fmt.Errorf("store mail: %w", err)
+	}
+
+	return nil
+}
+
+// seal seals mail for to: the recipient comes first in the plaintext, so
+// that a message moved to another recipient's file does not open.
+func (mb *Mailbox) seal(to [32]byte, mail Mail) ([]byte, error) {
+	encoded, err := mail.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+	plaintext := append(append(make([]byte, 0, 32+len(encoded)), to[:]...), encoded...)
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	return secretbox.Seal(nonce[:], plaintext, &nonce, &mb.key), nil
+}
+
+func (mb *Mailbox) open(to [32]byte, sealed []byte) (Mail, bool) {
+	var mail Mail
+	if len(sealed) < 24+secretbox.Overhead {
+		return mail, false
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], sealed)
+	plaintext, ok := secretbox.Open(nil, sealed[24:], &nonce, &mb.key)
+	if !ok || len(plaintext) < 32 || !bytes.Equal(plaintext[:32], to[:]) {
+		return mail, false
+	}
+	if err := mail.UnmarshalBinary(plaintext[32:]); err != nil {
+		return mail, false
+	}
+
+	return mail, true
+}
+
+// MailboxHandler returns a Handler that passes Mail between clients
+// identified by their keys. Mail for a connected client is delivered at
+// once; mail for one that is not is kept in mb and delivered when it
+// next connects. Clients without an identity key are refused with
+// ErrNoPeerIdentity.
+func MailboxHandler(mb *Mailbox) Handler {
+	po := &postOffice{mailbox: mb, online: make(map[[32]byte]map[*relayClient]struct{})}
+	return po.serve
+}
+
+// postOffice is the clients a MailboxHandler serves, by identity.
+type postOffice struct {
+	mailbox *Mailbox
+
+	// mu orders checking whether a client is online and storing mail
+	// for it against the client coming online and collecting its mail,
+	// so that no mail is stored after it was collected.
+	mu     sync.Mutex
+	online map[[32]byte]map[*relayClient]struct{}
+}
+
+func (po *postOffice) serve(ctx context.Context, conn *SecureConn) error {
+	identity, ok := conn.PeerIdentity()
+	if !ok {
+		return ErrNoPeerIdentity
+	}
+	c := newRelayClient(conn)
+
+	stored, err := po.connect(identity, c, conn.clock.Now())
+	if err != nil {
+		return err
+	}
+	defer po.disconnect(identity, c)
+
+	// Stored mail goes out before anything sent since, and back into
+	// the mailbox if it does not make it.
+	for i, mail := range stored {
+		message, err := mail.MarshalBinary()
+		if err == nil {
+			err = conn.WriteMsg(message)
+		}
+		if err != nil {
+			for _, mail := range stored[i:] {
+				if err := po.mailbox.put(identity, mail, conn.clock.Now()); err != nil {
+					return err
+				}
+			}
+			return fmt.Errorf("deliver stored mail: %w", err)
+		}
+	}
+
+	return c.serve(ctx, func(message []byte) error {
+		var mail Mail
+		if err := mail.UnmarshalBinary(message); err != nil {
+			return err
+		}
+
+		return po.send(mail.Peer, Mail{Peer: identity, Sent: conn.clock.Now(), Payload: mail.Payload})
+	})
+}
+
+// connect marks c as connected for identity and collects its mail at
+// now.
+func (po *postOffice) connect(identity [32]byte, c *relayClient, now time.Time) ([]Mail, error) {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+
+	stored, err := po.mailbox.take(identity, now)
+	if err != nil {
+		return nil, err
+	}
+	if po.online[identity] == nil {
+		po.online[identity] = make(map[*relayClient]struct{})
+	}
+	po.online[identity][c] = struct{}{}
+
+	return stored, nil
+}
+
+func (po *postOffice) disconnect(identity [32]byte, c *relayClient) {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+
+	delete(po.online[identity], c)
+	if len(po.online[identity]) == 0 {
+		delete(po.online, identity)
+	}
+}
+
+// send delivers mail to every connection of to, or stores it if there
+// are none.
+func (po *postOffice) send(to [32]byte, mail Mail) error {
+	po.mu.Lock()
+	defer po.mu.Unlock()
+
+	if len(po.online[to]) == 0 {
+		return po.mailbox.put(to, mail, mail.Sent)
+	}
+
+	message, err := mail.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	for c := range po.online[to] {
+		c.enqueue(message)
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package securecomm
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func testMailbox(t *testing.T) (*Mailbox, func()) {
+	dir, err := ioutil.TempDir("", "mailbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mb, err := OpenMailbox(filepath.Join(dir, "mail"), &[32]byte{'k', 'e', 'y'})
+	if err != nil {
+		os.RemoveAll(dir)
+		t.Fatal(err)
+	}
+
+	return mb, func() { os.RemoveAll(dir) }
+}
+
+func TestMailbox(t *testing.T) {
+	mb, cleanup := testMailbox(t)
+	defer cleanup()
+
+	alice, bob := [32]byte{'a'}, [32]byte{'b'}
+	for _, payload := range []string{"first", "second"} {
+		if err := mb.Put(bob, alice, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Nothing is stored in the clear.
+	data, err := ioutil.ReadFile(mb.path(bob))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(data, []byte("first")) || bytes.Contains(data, alice[:]) {
+		t.Error("Expected the stored mail to be sealed")
+	}
+
+	if mail, err := mb.Take(alice); err != nil || len(mail) != 0 {
+		t.Fatalf("Expected no mail for alice, got %v, %v", mail, err)
+	}
+	mail, err := mb.Take(bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mail) != 2 || string(mail[0].Payload) != "first" || string(mail[1].Payload) != "second" || mail[0].Peer != alice {
+		t.Fatalf("Unexpected mail %+v", mail)
+	}
+	if mail, err := mb.Take(bob); err != nil || len(mail) != 0 {
+		t.Fatalf("Expected mail to be taken once, got %v, %v", mail, err)
+	}
+}
+
+func TestMailboxRetention(t *testing.T) {
+	mb, cleanup := testMailbox(t)
+	defer cleanup()
+	mb.MaxMessages = 3
+	mb.MaxAge = time.Hour
+
+	clock := newFakeClock()
+	mb.Clock = clock
+
+	to, from := [32]byte{'t', 'o'}, [32]byte{'f', 'r', 'o', 'm'}
+	for i := 0; i < 5; i++ {
+		if err := mb.Put(to, from, []byte(fmt.Sprint(i))); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(time.Minute)
+	}
+
+	// Only the newest three are kept, and of those only the ones less
+	// than an hour old by the time they are taken.
+	clock.Advance(time.Hour - time.Minute - 30*time.Second)
+	mail, err := mb.Take(to)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mail) != 1 || string(mail[0].Payload) != "4" {
+		t.Fatalf("Unexpected mail %+v", mail)
+	}
+}
+
+func TestMailboxRejectsMovedMail(t *testing.T) {
+	mb, cleanup := testMailbox(t)
+	defer cleanup()
+
+	alice, bob := [32]byte{'a'}, [32]byte{'b'}
+	if err := mb.Put(bob, alice, []byte("for bob")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Rename(mb.path(bob), mb.path(alice)); err != nil {
+		t.Fatal(err)
+	}
+
+	if mail, err := mb.Take(alice); err != nil || len(mail) != 0 {
+		t.Fatalf("Expected mail moved to alice's file not to open, got %v, %v", mail, err)
+	}
+}
+
+func TestMailboxHandler(t *testing.T) {
+	mb, cleanup := testMailbox(t)
+	defer cleanup()
+
+	s := &Server{Handler: MailboxHandler(mb)}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	aliceKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bobKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(conn *SecureConn, to *KeyPair, payload string) {
+		t.Helper()
+		message, _ := Mail{Peer: to.Public, Payload: []byte(payload)}.MarshalBinary()
+		if err := conn.WriteMsg(message); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(conn *SecureConn, from *KeyPair, payload string) {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		message, err := conn.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var mail Mail
+		if err := mail.UnmarshalBinary(message); err != nil {
+			t.Fatal(err)
+		}
+		if mail.Peer != from.Public || string(mail.Payload) != payload || mail.Sent.IsZero() {
+			t.Fatalf("Unexpected mail %+v, expected %q", mail, payload)
+		}
+	}
+
+	alice, err := Dial(addr, WithIdentity(aliceKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer alice.Close()
+
+	// Bob is offline, so his mail waits for him. Alice mails herself
+	// after it to know the server has seen to it.
+	send(alice, bobKey, "while you were out")
+	send(alice, aliceKey, "sent")
+	expect(alice, aliceKey, "sent")
+
+	bob, err := Dial(addr, WithIdentity(bobKey))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer bob.Close()
+	expect(bob, aliceKey, "while you were out")
+
+	// Now he is online, mail reaches him at once.
+	send(alice, bobKey, "welcome back")
+	expect(bob, aliceKey, "welcome back")
+	send(bob, aliceKey, "thanks")
+	expect(alice, bobKey, "thanks")
+
+	// Clients must be identified to have a mailbox.
+	anonymous, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer anonymous.Close()
+	anonymous.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := anonymous.ReadMsg(); err == nil {
+		t.Fatal("Expected a client without an identity to be refused")
+	}
+}
@@ -0,0 +1,122 @@
+package securecomm
+
+import (
+	"expvar"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// handlerDurationBuckets are the upper bounds, in seconds, of the
+// buckets handler durations are counted in. Connections range from
+// single requests to tunnels left open for hours.
+var handlerDurationBuckets = [...]float64{0.001, 0.01, 0.1, 1, 10, 60, 600, 3600}
+
+// Metrics counts what servers and their connections do, for monitoring.
+// It is an http.Handler serving the counts in the Prometheus text
+// format, ready to be scraped from /metrics. A Metrics may be shared by
+// several servers to count them together. The zero Metrics is ready to
+// use, and it is safe for concurrent use.
+type Metrics struct {
+	// The counters are accessed atomically, so they come first to be
+	// aligned for that everywhere.
+	activeConns      int64
+	conns            int64
+	handshakesFailed int64
+	framesEncrypted  int64
+	framesDecrypted  int64
+	bytesIn          int64
+	bytesOut         int64
+	rekeys           int64
+
+	// mu guards the histogram of handler durations.
+	mu          sync.Mutex
+	durations   [len(handlerDurationBuckets) + 1]uint64 // the last is +Inf
+	durationSum float64
+}
+
+func (m *Metrics) decrypted(n int) {
+	atomic.AddInt64(&m.framesDecrypted, 1)
+	atomic.AddInt64(&m.bytesIn, int64(n))
+}
+
+func (m *Metrics) encrypted(n int) {
+	atomic.AddInt64(&m.framesEncrypted, 1)
+	atomic.AddInt64(&m.bytesOut, int64(n))
+}
+
+func (m *Metrics) rekeyed() {
+	atomic.AddInt64(&m.rekeys, 1)
+}
+
+// handled records that a handler ran for d.
+func (m *Metrics) handled(d time.Duration) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	seconds := d.Seconds()
+	i := 0
+	for i < len(handlerDurationBuckets) && seconds > handlerDurationBuckets[i] {
+		i++
+	}
+	m.durations[i]++
+	m.durationSum += seconds
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+	for _, metric := range []struct {
+		name, kind, help string
+		value            *int64
+	}{
+		{"secure_active_connections", "gauge", "Connections past the handshake and not yet closed.", &m.activeConns},
+		{"secure_connections_total", "counter", "Connections that completed the handshake.", &m.conns},
+		{"secure_handshakes_failed_total", "counter", "Connections that failed the handshake.", &m.handshakesFailed},
+		{"secure_frames_encrypted_total", "counter", "Frames sealed and sent.", &m.framesEncrypted},
+		{"secure_frames_decrypted_total", "counter", "Frames received and opened.", &m.framesDecrypted},
+		{"secure_received_bytes_total", "counter", "Bytes of frames received.", &m.bytesIn},
+		{"secure_sent_bytes_total", "counter", "Bytes of frames sent.", &m.bytesOut},
+		{"secure_rekeys_total", "counter", "Keys replaced by rekeying, in either direction.", &m.rekeys},
+	} {
+		fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n%s %d\n", metric.name, metric.help, metric.name, metric.kind, metric.name, atomic.LoadInt64(metric.value))
+	}
+
+	m.mu.Lock()
+	durations, sum := m.durations, m.durationSum
+	m.mu.Unlock()
+
+	const name = "secure_handler_duration_seconds"
+	fmt.Fprintf(w, "# HELP %s How long handlers took to serve connections.\n# TYPE %s histogram\n", name, name)
+	var count uint64
+	for i, n := range durations {
+		count += n
+		le := "+Inf"
+		if i < len(handlerDurationBuckets) {
+			le = strconv.FormatFloat(handlerDurationBuckets[i], 'g', -1, 64)
+		}
+		fmt.Fprintf(w, "%s_bucket{le=%q} %d\n", name, le, count)
+	}
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", name, strconv.FormatFloat(sum, 'g', -1, 64), name, count)
+}
+
+// Var returns the counters as an expvar.Var, to publish with
+// expvar.Publish alongside the runtime's own variables.
+func (m *Metrics) Var() expvar.Var {
+	return expvar.Func(func() interface{} {
+		return map[string]int64{
+			"active_connections": atomic.LoadInt64(&m.activeConns),
+			"connections":        atomic.LoadInt64(&m.conns),
+			"handshakes_failed":  atomic.LoadInt64(&m.handshakesFailed),
+			"frames_encrypted":   atomic.LoadInt64(&m.framesEncrypted),
+			"frames_decrypted":   atomic.LoadInt64(&m.framesDecrypted),
+			"received_bytes":     atomic.LoadInt64(&m.bytesIn),
+			"sent_bytes":         atomic.LoadInt64(&m.bytesOut),
+			"rekeys":             atomic.LoadInt64(&m.rekeys),
+		}
+	})
+}
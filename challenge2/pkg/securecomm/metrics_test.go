@@ -0,0 +1,102 @@
+package securecomm
+
+import (
+	"encoding/json"
+	"net"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMetrics(t *testing.T) {
+	m := new(Metrics)
+	s := &Server{Options: []Option{
+		WithMetrics(m),
+		WithErrorHandler(func(net.Addr, error) {}),
+	}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	// One client fails the handshake.
+	bad, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad.Write(make([]byte, 64))
+	bad.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		if _, err := bad.Read(make([]byte, 64)); err != nil {
+			break
+		}
+	}
+	bad.Close()
+
+	// Another stays connected.
+	conn := dialEchoed(t, addr)
+	defer conn.Close()
+
+	scrape := func() string {
+		rec := httptest.NewRecorder()
+		m.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+		if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/plain; version=0.0.4") {
+			t.Errorf("Unexpected content type %q", ct)
+		}
+		return rec.Body.String()
+	}
+
+	body := scrape()
+	for _, line := range []string{
+		"# TYPE secure_active_connections gauge\nsecure_active_connections 1\n",
+		"secure_connections_total 1\n",
+		"secure_handshakes_failed_total 1\n",
+		"secure_frames_encrypted_total ",
+		"# TYPE secure_handler_duration_seconds histogram\n",
+		"secure_handler_duration_seconds_count 0\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in the metrics, got:\n%s", line, body)
+		}
+	}
+	for _, zero := range []string{"secure_frames_decrypted_total 0\n", "secure_received_bytes_total 0\n", "secure_sent_bytes_total 0\n"} {
+		if strings.Contains(body, zero) {
+			t.Errorf("Expected the echo to be counted, got %q", zero)
+		}
+	}
+
+	// Once the client hangs up, its handler's duration is counted.
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for !strings.Contains(body, "secure_handler_duration_seconds_count 1\n") {
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected the handler to be counted, got:\n%s", body)
+		}
+		time.Sleep(10 * time.Millisecond)
+		body = scrape()
+	}
+	for _, line := range []string{
+		"secure_active_connections 0\n",
+		`secure_handler_duration_seconds_bucket{le="+Inf"} 1` + "\n",
+		`secure_handler_duration_seconds_bucket{le="3600"} 1` + "\n",
+	} {
+		if !strings.Contains(body, line) {
+			t.Errorf("Expected %q in the metrics, got:\n%s", line, body)
+		}
+	}
+}
+
+func TestMetricsVar(t *testing.T) {
+	m := new(Metrics)
+	m.rekeyed()
+	m.rekeyed()
+	atomic.AddInt64(&m.activeConns, 1)
+
+	var vars map[string]int64
+	if err := json.Unmarshal([]byte(m.Var().String()), &vars); err != nil {
+		t.Fatal(err)
+	}
+	if vars["rekeys"] != 2 || vars["active_connections"] != 1 {
+		t.Errorf("Unexpected variables %v", vars)
+	}
+}
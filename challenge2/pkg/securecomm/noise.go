@@ -0,0 +1,437 @@
+package securecomm
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/curve25519"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// A NoisePattern is a Noise handshake pattern.
+type NoisePattern int
+
+const (
+	// NoiseXX exchanges static keys during the handshake, so neither
+	// side needs to know the other's key in advance. Both static keys
+	// are encrypted, hiding the identities from passive observers.
+	NoiseXX NoisePattern = iota
+
+	// NoiseIK sends the dialer's static key in the first message,
+	// encrypted to the server's static key, which the dialer must
+	// already know. It saves a round trip over NoiseXX.
+	NoiseIK
+)
+
+func (p NoisePattern) String() string {
+	switch p {
+	case NoiseXX:
+		return "XX"
+	case NoiseIK:
+		return "IK"
+	default:
+		return fmt.Sprintf("NoisePattern(%d)", int(p))
+	}
+}
+
+// A NoiseConfig configures the Noise handshake.
+type NoiseConfig struct {
+	// Pattern is the handshake pattern the dialer uses. Servers answer
+	// either pattern.
+	Pattern NoisePattern
+
+	// StaticPub and StaticPriv are the long-term key pair the handshake
+	// proves ownership of. When they are nil a key pair is generated
+	// for each connection.
+	StaticPub, StaticPriv *[32]byte
+
+	// static is the identity key standing in for StaticPub and
+	// StaticPriv when they are not given.
+	static IdentityKey
+
+	// PeerStatic is the static key the peer must hold. It is required
+	// to dial with NoiseIK. With NoiseXX, a peer presenting another key
+	// fails the handshake; when nil any key is accepted.
+	PeerStatic *[32]byte
+}
+
+// noiseProtocolName returns the full Noise protocol name, which seeds
+// the handshake hash.
+func noiseProtocolName(pattern NoisePattern) string {
+	return "Noise_" + pattern.String() + "_25519_ChaChaPoly_SHA256"
+}
+
+// noiseMessages lists the tokens of each handshake message, alternating
+// between initiator and responder.
+var noiseMessages = map[NoisePattern][][]string{
+	NoiseXX: {
+		{"e"},
+		{"e", "ee", "s", "es"},
+		{"s", "se"},
+	},
+	NoiseIK: {
+		{"e", "es", "s", "ss"},
+		{"e", "ee", "se"},
+	},
+}
+
+// noiseTagSize is the size of a ChaChaPoly authentication tag.
+const noiseTagSize = 16
+
+// noiseSymmetric is the SymmetricState of the Noise specification,
+// together with the CipherState it owns.
+type noiseSymmetric struct {
+	ck, h [32]byte
+	k     *[32]byte
+	n     uint64
+}
+
+func (s *noiseSymmetric) mixHash(data []byte) {
+	hash := sha256.New()
+	hash.Write(s.h[:])
+	hash.Write(data)
+	hash.Sum(s.h[:0])
+}
+
+func (s *noiseSymmetric) mixKey(ikm []byte) {
+	var k [32]byte
+	s.ck, k = noiseHKDF(&s.ck, ikm)
+	s.k, s.n = &k, 0
+}
+
+func (s *noiseSymmetric) aead() (cipher.AEAD, []byte, error) {
+	aead, err := chacha20poly1305.New(s.k[:])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.LittleEndian.PutUint64(nonce[4:], s.n)
+	s.n++
+
+	return aead, nonce, nil
+}
+
+func (s *noiseSymmetric) encryptAndHash(dst, plaintext []byte) ([]byte, error) {
+	if s.k == nil {
+		s.mixHash(plaintext)
+		return append(dst, plaintext...), nil
+	}
+
+	aead, nonce, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	out := aead.Seal(dst, nonce, plaintext, s.h[:])
+	s.mixHash(out[len(dst):])
+
+	return out, nil
+}
+
+func (s *noiseSymmetric) decryptAndHash(ciphertext []byte) ([]byte, error) {
+	if s.k == nil {
+		s.mixHash(ciphertext)
+		return ciphertext, nil
+	}
+
+	aead, nonce, err := s.aead()
+	if err != nil {
+		return nil, err
+	}
+
+	plaintext, err := aead.Open(nil, nonce, ciphertext, s.h[:])
+	if err != nil {
+		return nil, fmt.Errorf("noise handshake message failed authentication: %w", ErrBadHandshake)
+	}
+	s.mixHash(ciphertext)
+
+	return plaintext, nil
+}
+
+// split derives the initiator's and responder's sending keys.
+func (s *noiseSymmetric) split() (initiator, responder [32]byte) {
+	return noiseHKDF(&s.ck, nil)
+}
+
+// noiseHKDF is the two output HKDF of the Noise specification.
+func noiseHKDF(ck *[32]byte, ikm []byte) (out1, out2 [32]byte) {
+	mac := hmac.New(sha256.New, ck[:])
+	mac.Write(ikm)
+	tempKey := mac.Sum(nil)
+
+	mac = hmac.New(sha256.New, tempKey)
+	mac.Write([]byte{1})
+	mac.Sum(out1[:0])
+
+	mac = hmac.New(sha256.New, tempKey)
+	mac.Write(out1[:])
+	mac.Write([]byte{2})
+	mac.Sum(out2[:0])
+
+	return out1, out2
+}
+
+// noiseHandshake is the HandshakeState of the Noise specification.
+type noiseHandshake struct {
+	noiseSymmetric
+
+	pattern   NoisePattern
+	initiator bool
+
+	s      IdentityKey
+	e      struct{ pub, priv *[32]byte }
+	rs, re *[32]byte
+
+	// turn is the index of the next message in the pattern.
+	turn int
+
+	// random is the source of the keys we generate.
+	random io.Reader
+}
+
+func newNoiseHandshake(cfg *NoiseConfig, pattern NoisePattern, initiator bool, prologue []byte, random io.Reader) (*noiseHandshake, error) {
+	hs := noiseHandshake{pattern: pattern, initiator: initiator, random: random}
+	hs.h = sha256.Sum256([]byte(noiseProtocolName(pattern)))
+	hs.ck = hs.h
+	hs.mixHash(prologue)
+
+	hs.s = cfg.static
+	if cfg.StaticPub != nil && cfg.StaticPriv != nil {
+		hs.s = &KeyPair{Public: *cfg.StaticPub, Private: *cfg.StaticPriv}
+	}
+	if hs.s == nil {
+		pub, priv, err := box.GenerateKey(random)
+		if err != nil {
+			return nil, fmt.Errorf("generate static key: %w", err)
+		}
+		hs.s = &KeyPair{Public: *pub, Private: *priv}
+	}
+
+	// IK's pre-message: the responder's static key is known up front.
+	if pattern == NoiseIK {
+		if initiator {
+			if cfg.PeerStatic == nil {
+				return nil, errors.New("the IK noise pattern needs the server's static key")
+			}
+			hs.rs = cfg.PeerStatic
+			hs.mixHash(hs.rs[:])
+		} else {
+			hs.mixHash(hs.s.PublicKey()[:])
+		}
+	}
+
+	return &hs, nil
+}
+
+func (hs *noiseHandshake) done() bool {
+	return hs.turn == len(noiseMessages[hs.pattern])
+}
+
+// ourTurn reports whether the next message is ours to send.
+func (hs *noiseHandshake) ourTurn() bool {
+	return (hs.turn%2 == 0) == hs.initiator
+}
+
+func (hs *noiseHandshake) dh(priv, pub *[32]byte) []byte {
+	var shared [32]byte
+	curve25519.ScalarMult(&shared, priv, pub)
+	return shared[:]
+}
+
+// mixDH performs the DH named by token. The first letter of the token is
+// the initiator's key and the second the responder's.
+func (hs *noiseHandshake) mixDH(token string) error {
+	local, remote := token[0], token[1]
+	if !hs.initiator {
+		local, remote = remote, local
+	}
+
+	pub := hs.re
+	if remote == 's' {
+		pub = hs.rs
+	}
+	if local == 's' {
+		shared, err := hs.s.ECDH(pub)
+		if err != nil {
+			return fmt.Errorf("static key: %w", err)
+		}
+		hs.mixKey(shared[:])
+		return nil
+	}
+
+	hs.mixKey(hs.dh(hs.e.priv, pub))
+	return nil
+}
+
+func (hs *noiseHandshake) writeMessage() ([]byte, error) {
+	var msg []byte
+	for _, token := range noiseMessages[hs.pattern][hs.turn] {
+		switch token {
+		case "e":
+			pub, priv, err := box.GenerateKey(hs.random)
+			if err != nil {
+				return nil, fmt.Errorf("generate ephemeral key: %w", err)
+			}
+			hs.e.pub, hs.e.priv = pub, priv
+			msg = append(msg, pub[:]...)
+			hs.mixHash(pub[:])
+		case "s":
+			var err error
+			if msg, err = hs.encryptAndHash(msg, hs.s.PublicKey()[:]); err != nil {
+				return nil, err
+			}
+		default:
+			if err := hs.mixDH(token); err != nil {
+				return nil, err
+			}
+		}
+	}
+	hs.turn++
+
+	// Every message ends with a payload, empty here, which
+	// authenticates the message once a key has been mixed in.
+	return hs.encryptAndHash(msg, nil)
+}
+
+func (hs *noiseHandshake) readMessage(msg []byte) error {
+	for _, token := range noiseMessages[hs.pattern][hs.turn] {
+		switch token {
+		case "e":
+			if len(msg) < 32 {
+				return fmt.Errorf("noise handshake message too short: %w", ErrBadHandshake)
+			}
+			var re [32]byte
+			copy(re[:], msg)
+			msg = msg[32:]
+			hs.re = &re
+			hs.mixHash(re[:])
+		case "s":
+			size := 32
+			if hs.k != nil {
+				size += noiseTagSize
+			}
+			if len(msg) < size {
+				return fmt.Errorf("noise handshake message too short: %w", ErrBadHandshake)
+			}
+			static, err := hs.decryptAndHash(msg[:size])
+			if err != nil {
+				return err
+			}
+			msg = msg[size:]
+			var rs [32]byte
+			copy(rs[:], static)
+			hs.rs = &rs
+		default:
+			if err := hs.mixDH(token); err != nil {
+				return err
+			}
+		}
+	}
+	hs.turn++
+
+	_, err := hs.decryptAndHash(msg)
+	return err
+}
+
+// noiseNegotiated returns the pattern the negotiated features select, if
+// any.
+func noiseNegotiated(features uint32) (NoisePattern, bool) {
+	switch {
+	case features&featureNoiseIK != 0:
+		return NoiseIK, true
+	case features&featureNoiseXX != 0:
+		return NoiseXX, true
+	default:
+		return 0, false
+	}
+}
+
+// noiseFeatures returns the features to advertise for cfg. Dialers offer
+// the pattern they use; servers answer either.
+func noiseFeatures(cfg *NoiseConfig, server bool) uint32 {
+	if server {
+		return featureNoiseXX | featureNoiseIK
+	}
+	if cfg.Pattern == NoiseIK {
+		return featureNoiseIK
+	}
+
+	return featureNoiseXX
+}
+
+// runNoise performs a Noise handshake over conn and returns the sending
+// and receiving keys for the frame layer, our static private key, the
+// peer's static public key and the handshake hash, which identifies the
+// session for channel binding.
+func runNoise(conn net.Conn, cfg *NoiseConfig, pattern NoisePattern, server bool, prologue []byte, random io.Reader) (send, receive *[32]byte, priv IdentityKey, peer *[32]byte, binding []byte, err error) {
+	hs, err := newNoiseHandshake(cfg, pattern, !server, prologue, random)
+	if err != nil {
+		return nil, nil, nil, nil, nil, err
+	}
+
+	for !hs.done() {
+		if hs.ourTurn() {
+			msg, err := hs.writeMessage()
+			if err != nil {
+				return nil, nil, nil, nil, nil, err
+			}
+			if err := writeNoiseMessage(conn, msg); err != nil {
+				return nil, nil, nil, nil, nil, err
+			}
+			continue
+		}
+
+		msg, err := readNoiseMessage(conn)
+		if err != nil {
+			return nil, nil, nil, nil, nil, err
+		}
+		if err := hs.readMessage(msg); err != nil {
+			return nil, nil, nil, nil, nil, err
+		}
+	}
+
+	if cfg.PeerStatic != nil && !hmac.Equal(cfg.PeerStatic[:], hs.rs[:]) {
+		return nil, nil, nil, nil, nil, fmt.Errorf("peer presented an unexpected static key: %w", ErrBadHandshake)
+	}
+
+	initiatorKey, responderKey := hs.split()
+	send, receive = &initiatorKey, &responderKey
+	if server {
+		send, receive = receive, send
+	}
+
+	return send, receive, hs.s, hs.rs, hs.h[:], nil
+}
+
+// Noise handshake messages are sent with a two byte length prefix.
+func writeNoiseMessage(w io.Writer, msg []byte) error {
+	frame := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(frame, uint16(len(msg)))
+	if _, err := w.Write(append(frame, msg...)); err != nil {
+		return fmt.Errorf("write noise handshake message: %w", err)
+	}
+
+	return nil
+}
+
+func readNoiseMessage(r io.Reader) ([]byte, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return nil, fmt.Errorf("read noise handshake message: %w", err)
+	}
+
+	msg := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, fmt.Errorf("read noise handshake message: %w", err)
+	}
+
+	return msg, nil
+}
@@ -0,0 +1,149 @@
+package securecomm
+
+import (
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestNoiseHandshakeStates(t *testing.T) {
+	for _, pattern := range []NoisePattern{NoiseXX, NoiseIK} {
+		t.Run(pattern.String(), func(t *testing.T) {
+			initiatorPub, initiatorPriv := testutil.KeyPair(t)
+			responderPub, responderPriv := testutil.KeyPair(t)
+
+			prologue := []byte("prologue")
+			initiator, err := newNoiseHandshake(&NoiseConfig{
+				StaticPub:  initiatorPub,
+				StaticPriv: initiatorPriv,
+				PeerStatic: responderPub,
+			}, pattern, true, prologue, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+			responder, err := newNoiseHandshake(&NoiseConfig{
+				StaticPub:  responderPub,
+				StaticPriv: responderPriv,
+			}, pattern, false, prologue, rand.Reader)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			sender, receiver := initiator, responder
+			for !initiator.done() {
+				msg, err := sender.writeMessage()
+				if err != nil {
+					t.Fatal(err)
+				}
+				if err := receiver.readMessage(msg); err != nil {
+					t.Fatal(err)
+				}
+				sender, receiver = receiver, sender
+			}
+			if !responder.done() {
+				t.Fatal("Responder expects more handshake messages")
+			}
+
+			if *initiator.rs != *responderPub || *responder.rs != *initiatorPub {
+				t.Error("Static keys were not exchanged")
+			}
+			if initiator.h != responder.h {
+				t.Error("Handshake hashes differ")
+			}
+
+			i1, i2 := initiator.split()
+			r1, r2 := responder.split()
+			if i1 != r1 || i2 != r2 || i1 == i2 {
+				t.Error("Unexpected transport keys")
+			}
+		})
+	}
+}
+
+func TestNoiseHandshakeDifferentPrologue(t *testing.T) {
+	initiator, err := newNoiseHandshake(&NoiseConfig{}, NoiseXX, true, []byte("one"), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	responder, err := newNoiseHandshake(&NoiseConfig{}, NoiseXX, false, []byte("two"), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	msg, err := initiator.writeMessage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := responder.readMessage(msg); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first message is unencrypted; the second fails to
+	// authenticate because the prologues differ.
+	if msg, err = responder.writeMessage(); err != nil {
+		t.Fatal(err)
+	}
+	if err := initiator.readMessage(msg); !errors.Is(err, ErrBadHandshake) {
+		t.Fatalf("Expected differing prologues to fail the handshake with ErrBadHandshake, got %v", err)
+	}
+}
+
+func TestNoiseConn(t *testing.T) {
+	serverPub, serverPriv := testutil.KeyPair(t)
+
+	l := testutil.Listen(t)
+
+	go Serve(l, nil, WithNoise(NoiseConfig{StaticPub: serverPub, StaticPriv: serverPriv}))
+
+	for _, pattern := range []NoisePattern{NoiseXX, NoiseIK} {
+		t.Run(pattern.String(), func(t *testing.T) {
+			conn, err := Dial(l.Addr().String(), WithNoise(NoiseConfig{Pattern: pattern, PeerStatic: serverPub}))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			if identity, ok := conn.PeerIdentity(); !ok || identity != *serverPub {
+				t.Error("Expected the peer key to be the server's static key")
+			}
+
+			if err := conn.WriteMsg([]byte("ping")); err != nil {
+				t.Fatal(err)
+			}
+			echo, err := conn.ReadMsg()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(echo) != "ping" {
+				t.Fatalf("Unexpected echo: %q", echo)
+			}
+		})
+	}
+
+	t.Run("wrong server key", func(t *testing.T) {
+		otherPub, _ := testutil.KeyPair(t)
+
+		for _, pattern := range []NoisePattern{NoiseXX, NoiseIK} {
+			if conn, err := Dial(l.Addr().String(), WithNoise(NoiseConfig{Pattern: pattern, PeerStatic: otherPub})); err == nil {
+				conn.Close()
+				t.Errorf("%v: expected the handshake to fail", pattern)
+			}
+		}
+	})
+}
+
+func TestNoiseRequired(t *testing.T) {
+	l := testutil.Listen(t)
+
+	go Serve(l, nil)
+
+	conn, err := Dial(l.Addr().String(), WithNoise(NoiseConfig{}))
+	if err == nil {
+		conn.Close()
+	}
+	if !errors.Is(err, ErrBadHandshake) {
+		t.Fatalf("Expected a noise dial to a legacy server to fail with ErrBadHandshake, got %v", err)
+	}
+}
@@ -0,0 +1,459 @@
+package securecomm
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/trace"
+)
+
+// An Option configures the handshake performed by Dial or Serve.
+type Option func(*config)
+
+// config holds the settings Options change. The zero config performs the
+// legacy handshake.
+type config struct {
+	noise      *NoiseConfig
+	identity   IdentityKey
+	rotation   *KeyRotation
+	knownHosts *KnownHosts
+	authorized *AuthorizedKeys
+	banList    *BanList
+
+	signer         ed25519.PrivateKey
+	trustedSigners []ed25519.PublicKey
+
+	psk        []byte
+	passphrase []byte
+
+	suite     CipherSuite
+	padding   PaddingPolicy
+	compress  bool
+	keepalive KeepalivePolicy
+	idle      IdlePolicy
+	lifetime  LifetimePolicy
+
+	// compressors are the algorithms WithCompression offers besides
+	// DEFLATE.
+	compressors []Compressor
+
+	// fecData and fecParity are the shards per group of the forward
+	// error correction DialUDP asks for.
+	fecData, fecParity int
+
+	// ticketKey seals the session tickets a server issues, which are
+	// accepted for ticketLifetime. sessions holds a client's tickets
+	// and session is the one Dial is about to resume.
+	ticketKey      *[32]byte
+	ticketLifetime time.Duration
+	sessions       *SessionCache
+	session        *session
+
+	handshakeTimeout time.Duration
+	timeouts         HandshakeTimeouts
+
+	// deadline is when the handshake under way must be done by, zero
+	// for never, and interrupt is closed if it is abandoned before.
+	// They are set for each connection, not by an Option.
+	deadline  time.Time
+	interrupt <-chan struct{}
+
+	// tracer traces handshakes and frames, and traceContext holds the
+	// span they are traced under, set for each connection like deadline.
+	tracer       trace.Tracer
+	traceContext context.Context
+
+	// rateLimiter limits how fast the clients of Serve may send.
+	rateLimiter *RateLimiter
+
+	// errorHandler is told of the errors that end a connection Serve
+	// or ServeUDP accepted.
+	errorHandler func(addr net.Addr, err error)
+
+	// log records what servers do, slog.Default() when nil.
+	log *slog.Logger
+
+	// metrics counts what servers and their connections do.
+	metrics *Metrics
+
+	// audit records the sessions Serve establishes.
+	audit *AuditLog
+
+	// debugWire is where WrapDebug logs the connections handshakes run
+	// over, when set.
+	debugWire io.Writer
+
+	// capture records the connections handshakes run over, when set.
+	capture *Capture
+
+	// relayOnly makes rendezvous peers skip hole punching.
+	relayOnly bool
+
+	// rand is the source of all randomness, crypto/rand when nil.
+	rand io.Reader
+
+	// clock times connections, the system clock when nil.
+	clock Clock
+}
+
+// random returns the source of randomness the handshake and the
+// connection it sets up use.
+func (cfg config) random() io.Reader {
+	if cfg.rand != nil {
+		return cfg.rand
+	}
+
+	return rand.Reader
+}
+
+// logger returns the logger servers record what they do with.
+func (cfg config) logger() *slog.Logger {
+	if cfg.log != nil {
+		return cfg.log
+	}
+
+	return slog.Default()
+}
+
+// handleError reports err, which ended the server's connection with
+// the client at addr, to the error handler, or logs it to logger if
+// there is none.
+func (cfg config) handleError(logger *slog.Logger, addr net.Addr, err error) {
+	if cfg.errorHandler != nil {
+		cfg.errorHandler(addr, err)
+		return
+	}
+
+	logger.Warn("connection failed", "err", err)
+}
+
+func newConfig(opts []Option) config {
+	var cfg config
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	// The identity key doubles as the Noise static key unless one was
+	// given explicitly.
+	if cfg.noise != nil && cfg.identity != nil && cfg.noise.StaticPriv == nil {
+		cfg.noise.static = cfg.identity
+	}
+
+	return cfg
+}
+
+// WithNoise makes the handshake use the Noise protocol framework instead
+// of the legacy key swap. Both sides must be configured with it; a peer
+// that is not fails the handshake.
+func WithNoise(noise NoiseConfig) Option {
+	return func(cfg *config) {
+		cfg.noise = &noise
+	}
+}
+
+// WithIdentity sets the long-term key that identifies us to peers. The
+// legacy handshake sends it alongside the key generated for each
+// connection and proves we hold it; the Noise handshake uses it as the
+// static key.
+func WithIdentity(key *KeyPair) Option {
+	return func(cfg *config) {
+		if key == nil {
+			cfg.identity = nil
+			return
+		}
+		cfg.identity = key
+	}
+}
+
+// WithIdentityKey is WithIdentity for a key whose private half may be
+// held elsewhere, such as by an agent.
+func WithIdentityKey(key IdentityKey) Option {
+	return func(cfg *config) {
+		cfg.identity = key
+	}
+}
+
+// WithKeyRotation makes Serve rotate its identity key, set with
+// WithIdentity or WithIdentityKey, as r schedules.
+func WithKeyRotation(r KeyRotation) Option {
+	return func(cfg *config) {
+		cfg.rotation = &r
+	}
+}
+
+// WithKnownHosts makes Dial verify the server's identity key against
+// known hosts, recording servers seen for the first time. Servers that
+// present no identity key are refused.
+func WithKnownHosts(kh *KnownHosts) Option {
+	return func(cfg *config) {
+		cfg.knownHosts = kh
+	}
+}
+
+// WithAuthorizedKeys makes Serve accept only clients whose identity key
+// is in ak. Other clients are disconnected right after the handshake,
+// before any of their data is read.
+func WithAuthorizedKeys(ak *AuthorizedKeys) Option {
+	return func(cfg *config) {
+		cfg.authorized = ak
+	}
+}
+
+// WithSigningKey makes the legacy handshake sign our per-connection key
+// and the handshake transcript with key, proving to the peer that we
+// hold it.
+func WithSigningKey(key ed25519.PrivateKey) Option {
+	return func(cfg *config) {
+		cfg.signer = key
+	}
+}
+
+// WithTrustedSigners makes the legacy handshake require the peer to sign
+// it with one of keys.
+func WithTrustedSigners(keys ...ed25519.PublicKey) Option {
+	return func(cfg *config) {
+		cfg.trustedSigners = keys
+	}
+}
+
+// WithPSK mixes a pre-shared key into the session keys, so traffic stays
+// private even from someone who intercepts the key exchange, unless they
+// also know the key. Both sides must be configured with the same key.
+func WithPSK(psk []byte) Option {
+	return func(cfg *config) {
+		cfg.psk = append([]byte(nil), psk...)
+	}
+}
+
+// WithPassphrase binds the session keys to a passphrase both sides know,
+// for quick tunnels between people who share nothing but a password. The
+// passphrase is stretched with argon2id using salts both sides
+// contribute during the handshake, so each connection needs a fresh
+// guessing effort.
+func WithPassphrase(passphrase []byte) Option {
+	return func(cfg *config) {
+		cfg.passphrase = append([]byte(nil), passphrase...)
+	}
+}
+
+// WithCipherSuite offers suite for sealing frames alongside the default
+// CipherNaClBox. It is used when the peer offers it too; otherwise the
+// connection falls back to CipherNaClBox.
+func WithCipherSuite(suite CipherSuite) Option {
+	return func(cfg *config) {
+		cfg.suite = suite
+	}
+}
+
+// WithPadding pads the frames of connections set up by Dial or Serve to
+// hide message lengths. Peers that cannot strip the padding are sent
+// unpadded frames.
+func WithPadding(policy PaddingPolicy) Option {
+	return func(cfg *config) {
+		cfg.padding = policy
+	}
+}
+
+// WithCompression compresses the frames of connections set up by Dial
+// or Serve when the peer was configured with it too. It suits highly
+// compressible traffic such as logs or JSON, but lets an attacker who
+// can mix their own data with a secret learn about the secret from the
+// length of frames, so it is off by default.
+//
+// Frames are compressed with DEFLATE unless both peers offer a
+// Compressor for a better algorithm, Zstandard before Snappy.
+func WithCompression(compressors ...Compressor) Option {
+	return func(cfg *config) {
+		cfg.compress = true
+		cfg.compressors = compressors
+	}
+}
+
+// WithKeepalive makes connections set up by Dial or Serve ping the peer
+// according to policy, and fail once it stops answering.
+func WithKeepalive(policy KeepalivePolicy) Option {
+	return func(cfg *config) {
+		cfg.keepalive = policy
+	}
+}
+
+// WithFEC makes DialUDP protect each group of data packets sent in
+// either direction with parity packets, so that up to parity packets of
+// a group can be lost and still delivered without a retransmission.
+// Groups hold at most 64 packets in all. Parity packets are only sent
+// once a group is complete, so the last packets before a pause are not
+// protected until more follow.
+func WithFEC(data, parity int) Option {
+	return func(cfg *config) {
+		cfg.fecData, cfg.fecParity = data, parity
+	}
+}
+
+// WithSessionTickets makes Serve issue session tickets, valid for
+// lifetime, that let clients reconnect without a fresh key exchange.
+func WithSessionTickets(lifetime time.Duration) Option {
+	return func(cfg *config) {
+		cfg.ticketLifetime = lifetime
+	}
+}
+
+// WithSessionCache makes Dial keep the session tickets servers issue in
+// cache and resume those sessions when it reconnects.
+func WithSessionCache(cache *SessionCache) Option {
+	return func(cfg *config) {
+		cfg.sessions = cache
+	}
+}
+
+// WithHandshakeTimeout bounds how long Serve waits for a client to
+// complete the handshake before dropping it. The default is
+// DefaultHandshakeTimeout; Dial is bounded by Dialer.HandshakeTimeout
+// instead.
+func WithHandshakeTimeout(timeout time.Duration) Option {
+	return func(cfg *config) {
+		cfg.handshakeTimeout = timeout
+	}
+}
+
+// WithHandshakeTimeouts bounds each phase of setting up a connection
+// with Dial or Serve, within the timeout of the handshake as a whole.
+// The Connect timeout only applies to Dial.
+func WithHandshakeTimeouts(timeouts HandshakeTimeouts) Option {
+	return func(cfg *config) {
+		cfg.timeouts = timeouts
+	}
+}
+
+// WithBanList makes Serve refuse the clients on bl, dropping those from
+// banned networks before the handshake starts and those with a banned
+// identity key before it completes.
+func WithBanList(bl *BanList) Option {
+	return func(cfg *config) {
+		cfg.banList = bl
+	}
+}
+
+// WithIdlePolicy makes Serve close connections that sit idle for
+// longer than policy allows.
+func WithIdlePolicy(policy IdlePolicy) Option {
+	return func(cfg *config) {
+		cfg.idle = policy
+	}
+}
+
+// WithLifetimePolicy makes connections set up by Dial or Serve close
+// once they are as old as policy allows, so that the peers have to
+// handshake again.
+func WithLifetimePolicy(policy LifetimePolicy) Option {
+	return func(cfg *config) {
+		cfg.lifetime = policy
+	}
+}
+
+// WithLogger makes Dial, Serve and ServeUDP log to logger instead of
+// slog.Default(). Each connection a server accepts is logged with its
+// ID and the client's address.
+func WithLogger(logger *slog.Logger) Option {
+	return func(cfg *config) {
+		cfg.log = logger
+	}
+}
+
+// WithMetrics makes Serve count its connections, their frames and
+// bytes, and how long the Handler takes with each, in m.
+func WithMetrics(m *Metrics) Option {
+	return func(cfg *config) {
+		cfg.metrics = m
+	}
+}
+
+// WithTracer traces each handshake with t, and every frame read and
+// written once it is done. DialContext traces them under the span of its
+// context. Any Tracer of github.com/jpreese/go-mentor/trace, such as
+// otelbridge's, will do.
+func WithTracer(t trace.Tracer) Option {
+	return func(cfg *config) {
+		cfg.tracer = t
+	}
+}
+
+// WithDebugWire logs the handshake and every frame of each connection
+// to w, as WrapDebug does.
+func WithDebugWire(w io.Writer) Option {
+	return func(cfg *config) {
+		cfg.debugWire = w
+	}
+}
+
+// WithCapture records the frames of each connection to c, and its keys
+// if c.Keys is set.
+func WithCapture(c *Capture) Option {
+	return func(cfg *config) {
+		cfg.capture = c
+	}
+}
+
+// WithAuditLog makes Serve record the start and end of each session in
+// a.
+func WithAuditLog(a *AuditLog) Option {
+	return func(cfg *config) {
+		cfg.audit = a
+	}
+}
+
+// WithRelayOnly makes AcceptRendezvous and DialRendezvous carry the
+// session through the relay rather than try to connect directly, which
+// saves the wait on networks known to defeat hole punching.
+func WithRelayOnly() Option {
+	return func(cfg *config) {
+		cfg.relayOnly = true
+	}
+}
+
+// WithErrorHandler makes Serve and ServeUDP pass the errors that end a
+// connection with one client to handler, along with the client's
+// address, instead of logging them. Either way the server goes on
+// accepting other clients. handler may be called from several
+// goroutines at once.
+func WithErrorHandler(handler func(addr net.Addr, err error)) Option {
+	return func(cfg *config) {
+		cfg.errorHandler = handler
+	}
+}
+
+// WithRateLimiter makes Serve hold each client to the limits of l,
+// closing the connection of one that sends faster with ErrRateLimited.
+// The same l may be shared by several servers to limit them together.
+func WithRateLimiter(l *RateLimiter) Option {
+	return func(cfg *config) {
+		cfg.rateLimiter = l
+	}
+}
+
+// WithRand makes the handshake and the connection it sets up draw all
+// their randomness, from ephemeral keys to nonces, from r instead of
+// crypto/rand. It exists so tests and known-answer vectors can produce
+// the same bytes on every run; a predictable r makes the connection
+// insecure.
+func WithRand(r io.Reader) Option {
+	return func(cfg *config) {
+		cfg.rand = r
+	}
+}
+
+// WithClock makes the connection the handshake sets up time its
+// keepalive pings, idle timeout and rekey interval by c instead of the
+// system clock, and the session tickets it issues and accepts too, as
+// well as what is timed around the connection: its rate limits, audit
+// entries, relayed pairs, mail and the durations hooks and logs report.
+// It exists so tests can move time forward rather than wait for it.
+func WithClock(c Clock) Option {
+	return func(cfg *config) {
+		cfg.clock = c
+	}
+}
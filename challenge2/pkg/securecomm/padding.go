@@ -0,0 +1,62 @@
+package securecomm
+
+import (
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math/big"
+)
+
+// A PaddingPolicy hides how long messages are by padding each frame
+// before it is sealed, so an observer only sees padded frame lengths.
+// The padding is stripped again by the reader. The zero PaddingPolicy
+// does not pad.
+//
+// Padding never takes a frame past the writer's MaxMessageSize.
+type PaddingPolicy struct {
+	// Buckets pads each frame up to the smallest of these sizes, in
+	// bytes, that holds it. Frames larger than every bucket are not
+	// padded up.
+	Buckets []int
+
+	// Random adds between zero and Random bytes of padding, chosen
+	// uniformly, on top of any bucket padding.
+	Random int
+}
+
+// A padded frame holds the length of its payload, so the reader can tell
+// the payload from the padding that follows it.
+const paddedLengthSize = 4
+
+func (p PaddingPolicy) enabled() bool {
+	return len(p.Buckets) > 0 || p.Random > 0
+}
+
+// padding returns how many bytes of padding to add to a frame of size
+// bytes so that it holds no more than limit bytes. Random padding is
+// drawn from random.
+func (p PaddingPolicy) padding(size, limit int, random io.Reader) (int, error) {
+	padded := size
+	for _, bucket := range p.Buckets {
+		if bucket >= size && (padded == size || bucket < padded) {
+			padded = bucket
+		}
+	}
+
+	if p.Random > 0 {
+		n, err := rand.Int(random, big.NewInt(int64(p.Random)+1))
+		if err != nil {
+			return 0, fmt.Errorf("choose padding: %w", err)
+		}
+		padded += int(n.Int64())
+	}
+
+	if padded > limit {
+		padded = limit
+	}
+	if padded < size {
+		return 0, nil
+	}
+
+	return padded - size, nil
+}
@@ -0,0 +1,108 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"io"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestPaddingPolicy(t *testing.T) {
+	tests := []struct {
+		policy      PaddingPolicy
+		size, limit int
+		expected    int
+	}{
+		{PaddingPolicy{}, 10, 100, 0},
+		{PaddingPolicy{Buckets: []int{64, 16, 256}}, 10, 1000, 6},
+		{PaddingPolicy{Buckets: []int{64, 16, 256}}, 17, 1000, 47},
+		{PaddingPolicy{Buckets: []int{64, 16, 256}}, 300, 1000, 0},
+		{PaddingPolicy{Buckets: []int{256}}, 10, 100, 90},
+	}
+
+	for _, test := range tests {
+		got, err := test.policy.padding(test.size, test.limit, rand.Reader)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != test.expected {
+			t.Errorf("%+v padding %d bytes up to %d: got %d, expected %d", test.policy, test.size, test.limit, got, test.expected)
+		}
+	}
+
+	random := PaddingPolicy{Random: 8}
+	for i := 0; i < 100; i++ {
+		if got, err := random.padding(10, 100, rand.Reader); err != nil || got < 0 || got > 8 {
+			t.Fatalf("Random padding of %d bytes, %v", got, err)
+		}
+	}
+}
+
+func TestPaddedFrames(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	secureW.Padding = PaddingPolicy{Buckets: []int{256}}
+
+	messages := []string{"a", "a longer message"}
+	var sizes []int
+	for _, message := range messages {
+		before := buf.Len()
+		if err := secureW.WriteMsg([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, buf.Len()-before)
+	}
+	if sizes[0] != sizes[1] {
+		t.Fatalf("Padded frames leak their length: %v", sizes)
+	}
+
+	secureR := NewSecureReader(&buf, priv, pub)
+	for _, expected := range messages {
+		if got, err := secureR.ReadMsg(); err != nil || string(got) != expected {
+			t.Fatalf("Unexpected result: %q, %v", got, err)
+		}
+	}
+}
+
+func TestPaddedChunkedWrite(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	secureW.Padding = PaddingPolicy{Random: 1 << 20}
+
+	expected := bytes.Repeat([]byte("0123456789"), 10000)
+	if err := secureW.WriteMsg(expected); err != nil {
+		t.Fatal(err)
+	}
+
+	// Padding must never push a frame past the reader's limit.
+	secureR := NewSecureReader(&buf, priv, pub)
+	if got, err := secureR.ReadMsg(); err != nil || !bytes.Equal(got, expected) {
+		t.Fatalf("Unexpected result: %d bytes, %v", len(got), err)
+	}
+}
+
+func TestPaddingOverConn(t *testing.T) {
+	l := testutil.Listen(t)
+	policy := PaddingPolicy{Buckets: []int{512}, Random: 64}
+	go Serve(l, nil, WithPadding(policy))
+
+	conn, err := Dial(l.Addr().String(), WithPadding(policy))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 4)
+	if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+		t.Fatalf("Unexpected echo: %q, %v", buf, err)
+	}
+}
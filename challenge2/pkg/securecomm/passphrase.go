@@ -0,0 +1,14 @@
+package securecomm
+
+import "golang.org/x/crypto/argon2"
+
+// passphraseSaltSize is the size of the salt each side sends in
+// passphrase mode.
+const passphraseSaltSize = 16
+
+// stretchPassphrase derives a key from a passphrase with argon2id, salted
+// by both sides so neither can force a salt it precomputed guesses for.
+func stretchPassphrase(passphrase, clientSalt, serverSalt []byte) []byte {
+	salt := append(append([]byte(nil), clientSalt...), serverSalt...)
+	return argon2.IDKey(passphrase, salt, argonTime, argonMemory, argonThreads, 32)
+}
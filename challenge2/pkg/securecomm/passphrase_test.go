@@ -0,0 +1,50 @@
+package securecomm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestStretchPassphrase(t *testing.T) {
+	a := stretchPassphrase([]byte("hunter2"), []byte("client"), []byte("server"))
+	b := stretchPassphrase([]byte("hunter2"), []byte("client"), []byte("server"))
+	if !bytes.Equal(a, b) || len(a) != 32 {
+		t.Fatal("Stretching is not deterministic")
+	}
+
+	if bytes.Equal(a, stretchPassphrase([]byte("hunter2"), []byte("client"), []byte("other"))) {
+		t.Fatal("The salt does not change the key")
+	}
+}
+
+func TestPassphrase(t *testing.T) {
+	l := testutil.Listen(t)
+	go Serve(l, nil, WithPassphrase([]byte("correct horse")))
+
+	ping := func(opts ...Option) error {
+		conn, err := Dial(l.Addr().String(), opts...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if err := conn.WriteMsg([]byte("ping")); err != nil {
+			return err
+		}
+		_, err = conn.ReadMsg()
+		return err
+	}
+
+	if err := ping(WithPassphrase([]byte("correct horse"))); err != nil {
+		t.Fatalf("Matching passphrases failed: %v", err)
+	}
+	if err := ping(WithPassphrase([]byte("battery staple"))); err == nil {
+		t.Error("Expected a wrong passphrase to fail")
+	}
+	if err := ping(); !errors.Is(err, ErrPassphraseMismatch) {
+		t.Errorf("Expected ErrPassphraseMismatch, got %v", err)
+	}
+}
@@ -0,0 +1,156 @@
+package securecomm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// pcapngLinkType is the link type of the interfaces WritePcapng writes,
+// LINKTYPE_USER0, which is reserved for private use. Wireshark shows
+// such packets as raw data unless told how to dissect them.
+const pcapngLinkType = 147
+
+// pcapng block types and option codes.
+const (
+	pcapngSectionHeader  = 0x0a0d0d0a
+	pcapngInterface      = 1
+	pcapngEnhancedPacket = 6
+	pcapngByteOrderMagic = 0x1a2b3c4d
+	pcapngOptEnd         = 0
+	pcapngOptComment     = 1
+	pcapngOptIfName      = 2
+	pcapngOptFlags       = 2
+	pcapngFlagInbound    = 1
+	pcapngFlagOutbound   = 2
+)
+
+// WritePcapng writes the frames of a Capture to w as a pcapng file, for
+// looking at the structure of sessions in Wireshark without a dissector
+// for them. Each connection in the capture is an interface of its own,
+// named after its number. Each frame is a packet marked inbound or
+// outbound and commented with its sequence number, and with a rekey
+// marker if its direction changed keys after it, which only a capture
+// made with Keys records.
+func WritePcapng(w io.Writer, records []CaptureRecord) error {
+	// Key changes are recorded after the frame they follow, so find
+	// the frames they follow first.
+	type direction struct {
+		conn int64
+		dir  string
+	}
+	rekeyed := make(map[int]bool)
+	last := make(map[direction]int)
+	for i, record := range records {
+		dir := direction{record.Conn, record.Dir}
+		if record.Frame != nil {
+			last[dir] = i
+		} else if prev, ok := last[dir]; ok {
+			rekeyed[prev] = true
+		}
+	}
+
+	bw := &pcapngWriter{w: w}
+	bw.block(pcapngSectionHeader, func(b *bytes.Buffer) {
+		binary.Write(b, binary.LittleEndian, uint32(pcapngByteOrderMagic))
+		binary.Write(b, binary.LittleEndian, uint16(1)) // major version
+		binary.Write(b, binary.LittleEndian, uint16(0)) // minor version
+		binary.Write(b, binary.LittleEndian, int64(-1)) // section length unknown
+	})
+
+	interfaces := make(map[int64]uint32)
+	for i, record := range records {
+		if record.Frame == nil {
+			continue
+		}
+		if len(record.Frame) < frameHeaderSize {
+			return fmt.Errorf("captured frame of %d bytes is too short to hold a header", len(record.Frame))
+		}
+
+		id, ok := interfaces[record.Conn]
+		if !ok {
+			id = uint32(len(interfaces))
+			interfaces[record.Conn] = id
+			bw.block(pcapngInterface, func(b *bytes.Buffer) {
+				binary.Write(b, binary.LittleEndian, uint16(pcapngLinkType))
+				binary.Write(b, binary.LittleEndian, uint16(0)) // reserved
+				binary.Write(b, binary.LittleEndian, uint32(0)) // no snapshot length
+				pcapngOption(b, pcapngOptIfName, []byte(fmt.Sprintf("conn %d", record.Conn)))
+				pcapngOption(b, pcapngOptEnd, nil)
+			})
+		}
+
+		comment := fmt.Sprintf("%s seq %d", record.Dir, binary.BigEndian.Uint64(record.Frame[4+seqOffset:frameHeaderSize]))
+		if rekeyed[i] {
+			comment += ", rekey"
+		}
+		var flags [4]byte
+		binary.LittleEndian.PutUint32(flags[:], pcapngFlagInbound)
+		if record.Dir == captureSend {
+			binary.LittleEndian.PutUint32(flags[:], pcapngFlagOutbound)
+		}
+
+		// In microseconds, the default resolution.
+		ts := uint64(record.Time.UnixMicro())
+		bw.block(pcapngEnhancedPacket, func(b *bytes.Buffer) {
+			binary.Write(b, binary.LittleEndian, id)
+			binary.Write(b, binary.LittleEndian, uint32(ts>>32))
+			binary.Write(b, binary.LittleEndian, uint32(ts))
+			binary.Write(b, binary.LittleEndian, uint32(len(record.Frame))) // captured
+			binary.Write(b, binary.LittleEndian, uint32(len(record.Frame))) // original
+			b.Write(record.Frame)
+			pcapngPad(b)
+			pcapngOption(b, pcapngOptComment, []byte(comment))
+			pcapngOption(b, pcapngOptFlags, flags[:])
+			pcapngOption(b, pcapngOptEnd, nil)
+		})
+	}
+
+	return bw.err
+}
+
+// A pcapngWriter writes pcapng blocks, keeping the first error.
+type pcapngWriter struct {
+	w   io.Writer
+	buf bytes.Buffer
+	err error
+}
+
+// block writes a block of type typ with the body body writes.
+func (bw *pcapngWriter) block(typ uint32, body func(b *bytes.Buffer)) {
+	if bw.err != nil {
+		return
+	}
+
+	bw.buf.Reset()
+	body(&bw.buf)
+	// The type, the length before the body and the length again after.
+	length := uint32(12 + bw.buf.Len())
+
+	var header [8]byte
+	binary.LittleEndian.PutUint32(header[:4], typ)
+	binary.LittleEndian.PutUint32(header[4:], length)
+	if _, bw.err = bw.w.Write(header[:]); bw.err != nil {
+		return
+	}
+	if _, bw.err = bw.w.Write(bw.buf.Bytes()); bw.err != nil {
+		return
+	}
+	_, bw.err = bw.w.Write(header[4:])
+}
+
+// pcapngOption appends an option to a block body.
+func pcapngOption(b *bytes.Buffer, code uint16, value []byte) {
+	binary.Write(b, binary.LittleEndian, code)
+	binary.Write(b, binary.LittleEndian, uint16(len(value)))
+	b.Write(value)
+	pcapngPad(b)
+}
+
+// pcapngPad pads a block body to a multiple of four bytes.
+func pcapngPad(b *bytes.Buffer) {
+	for b.Len()%4 != 0 {
+		b.WriteByte(0)
+	}
+}
@@ -0,0 +1,127 @@
+package securecomm
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// A pcapngPacket is an enhanced packet block read back from pcapng.
+type pcapngPacket struct {
+	data    []byte
+	comment string
+	flags   uint32
+}
+
+// readPcapng returns the link types of the interfaces and the packets
+// in a pcapng file.
+func readPcapng(t *testing.T, b []byte) ([]uint16, []pcapngPacket) {
+	if len(b) < 12 || binary.LittleEndian.Uint32(b) != pcapngSectionHeader || binary.LittleEndian.Uint32(b[8:]) != pcapngByteOrderMagic {
+		t.Fatal("Expected a little endian section header first")
+	}
+
+	var links []uint16
+	var packets []pcapngPacket
+	for len(b) > 0 {
+		typ, length := binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:])
+		if length%4 != 0 || int(length) > len(b) || binary.LittleEndian.Uint32(b[length-4:]) != length {
+			t.Fatalf("Malformed block of type %d and length %d", typ, length)
+		}
+		body := b[8 : length-4]
+		b = b[length:]
+
+		switch typ {
+		case pcapngInterface:
+			links = append(links, binary.LittleEndian.Uint16(body))
+		case pcapngEnhancedPacket:
+			var p pcapngPacket
+			n := binary.LittleEndian.Uint32(body[12:])
+			p.data = body[20 : 20+n]
+			options := body[20+(n+3)/4*4:]
+			for len(options) >= 4 {
+				code, size := binary.LittleEndian.Uint16(options), binary.LittleEndian.Uint16(options[2:])
+				value := options[4 : 4+size]
+				switch code {
+				case pcapngOptComment:
+					p.comment = string(value)
+				case pcapngOptFlags:
+					p.flags = binary.LittleEndian.Uint32(value)
+				}
+				options = options[4+(size+3)/4*4:]
+			}
+			packets = append(packets, p)
+		}
+	}
+
+	return links, packets
+}
+
+func TestWritePcapng(t *testing.T) {
+	records := captureSession(t, true, []byte("one"), []byte("two"))
+
+	var frames []CaptureRecord
+	for _, record := range records {
+		if record.Frame != nil {
+			frames = append(frames, record)
+		}
+	}
+
+	var out bytes.Buffer
+	if err := WritePcapng(&out, records); err != nil {
+		t.Fatal(err)
+	}
+	links, packets := readPcapng(t, out.Bytes())
+
+	if len(links) != 1 || links[0] != pcapngLinkType {
+		t.Fatalf("Expected one interface of the custom link type, got %v", links)
+	}
+	if len(packets) != len(frames) {
+		t.Fatalf("Got %d packets for %d frames", len(packets), len(frames))
+	}
+	var sendSeq uint64
+	var rekeys int
+	for i, p := range packets {
+		if !bytes.Equal(p.data, frames[i].Frame) {
+			t.Fatalf("Packet %d does not hold its frame", i)
+		}
+		want := uint32(pcapngFlagInbound)
+		if frames[i].Dir == captureSend {
+			want = pcapngFlagOutbound
+			if seq := fmt.Sprintf("send seq %d", sendSeq); p.comment != seq && p.comment != seq+", rekey" {
+				t.Fatalf("Packet %d commented %q, expected send seq %d", i, p.comment, sendSeq)
+			}
+			sendSeq++
+		}
+		if p.flags != want {
+			t.Fatalf("Packet %d has flags %d, expected %d", i, p.flags, want)
+		}
+		if strings.HasSuffix(p.comment, ", rekey") {
+			rekeys++
+		}
+	}
+	// Both sides change keys to bind the channel after the transcript,
+	// and the client rekeys between its messages as well.
+	if rekeys <= 2 {
+		t.Fatalf("Expected more than two rekey markers, got %d", rekeys)
+	}
+}
+
+func TestWritePcapngWithoutKeys(t *testing.T) {
+	records := captureSession(t, false, []byte("one"))
+
+	var out bytes.Buffer
+	if err := WritePcapng(&out, records); err != nil {
+		t.Fatal(err)
+	}
+	_, packets := readPcapng(t, out.Bytes())
+	if len(packets) == 0 {
+		t.Fatal("Expected packets for the frames")
+	}
+	for _, p := range packets {
+		if strings.Contains(p.comment, "rekey") {
+			t.Fatalf("Expected no rekey markers without keys, got %q", p.comment)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package securecomm
+
+import (
+	"net"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/memconn"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// testPipe returns both ends of an in-memory connection that has
+// completed the handshake. opts configure both ends.
+func testPipe(opts ...Option) (client, server *SecureConn, err error) {
+	clientConn, serverConn := memconn.Pipe()
+	cfg := newConfig(opts)
+
+	type result struct {
+		sc     *SecureConn
+		server bool
+		err    error
+	}
+	results := make(chan result, 2)
+	for _, end := range []struct {
+		conn   net.Conn
+		server bool
+	}{{clientConn, false}, {serverConn, true}} {
+		go func(conn net.Conn, server bool) {
+			pub, priv, err := box.GenerateKey(cfg.random())
+			if err != nil {
+				results <- result{server: server, err: err}
+				return
+			}
+			sc, err := handshake(conn, pub, priv, server, cfg)
+			if err != nil {
+				// Unblock the other end.
+				conn.Close()
+			}
+			results <- result{sc, server, err}
+		}(end.conn, end.server)
+	}
+
+	for i := 0; i < 2; i++ {
+		r := <-results
+		if r.err != nil && err == nil {
+			err = r.err
+		}
+		if r.server {
+			server = r.sc
+		} else {
+			client = r.sc
+		}
+	}
+	if err != nil {
+		clientConn.Close()
+		serverConn.Close()
+		return nil, nil, err
+	}
+
+	return client, server, nil
+}
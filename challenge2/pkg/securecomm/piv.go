@@ -0,0 +1,220 @@
+package securecomm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// A SmartCard exchanges APDUs with a smart card, such as over PC/SC,
+// which the pcscbridge module provides. Transmit sends a command APDU
+// and returns the response APDU, data followed by the two status bytes.
+type SmartCard interface {
+	Transmit(command []byte) ([]byte, error)
+}
+
+// PIV key slots that can hold a key for key agreement.
+const (
+	PIVSlotAuthentication = 0x9a
+	PIVSlotKeyManagement  = 0x9d
+)
+
+// pivAID is the application identifier of the PIV applet.
+var pivAID = []byte{0xa0, 0x00, 0x00, 0x03, 0x08}
+
+// PIV instructions, including the YubiKey metadata command.
+const (
+	pivInsSelect      = 0xa4
+	pivInsVerify      = 0x20
+	pivInsGeneralAuth = 0x87
+	pivInsGetResponse = 0xc0
+	pivInsGetMetadata = 0xf7
+)
+
+// pivAlgorithmX25519 identifies X25519 keys, which YubiKeys support from
+// firmware 5.7 on.
+const pivAlgorithmX25519 = 0xe1
+
+// pivPINReference names the application PIN, which is padded with 0xff
+// to pivMaxPINLength.
+const (
+	pivPINReference = 0x80
+	pivMaxPINLength = 8
+)
+
+// Tags of the dynamic authentication template of GENERAL AUTHENTICATE,
+// and of the metadata of a slot.
+const (
+	pivTagDynamicAuth  = 0x7c
+	pivTagResponse     = 0x82
+	pivTagExponentiate = 0x85
+
+	pivTagMetadataAlg   = 0x01
+	pivTagMetadataPub   = 0x04
+	pivTagX25519PubPart = 0x86
+)
+
+// A PIVKey is an X25519 identity key on a PIV token, such as a YubiKey,
+// which computes the key agreements the handshake needs without the key
+// ever leaving it. It is safe for concurrent use.
+type PIVKey struct {
+	card   SmartCard
+	slot   byte
+	public [32]byte
+
+	// mu keeps the APDUs of one operation together.
+	mu sync.Mutex
+}
+
+// OpenPIVKey selects the PIV applet on card, unlocks it with pin, unless
+// empty, and returns the X25519 key in slot, such as
+// PIVSlotKeyManagement. It reads the public key with the YubiKey
+// metadata command.
+func OpenPIVKey(card SmartCard, slot byte, pin []byte) (*PIVKey, error) {
+	k := &PIVKey{card: card, slot: slot}
+	if _, err := k.transmit(0x00, pivInsSelect, 0x04, 0x00, pivAID); err != nil {
+		return nil, fmt.Errorf("piv: select applet: %w", err)
+	}
+
+	if len(pin) > 0 {
+		if len(pin) > pivMaxPINLength {
+			return nil, fmt.Errorf("piv: PIN longer than %d bytes", pivMaxPINLength)
+		}
+		padded := bytes.Repeat([]byte{0xff}, pivMaxPINLength)
+		copy(padded, pin)
+		if _, err := k.transmit(0x00, pivInsVerify, 0x00, pivPINReference, padded); err != nil {
+			return nil, fmt.Errorf("piv: verify PIN: %w", err)
+		}
+	}
+
+	metadata, err := k.transmit(0x00, pivInsGetMetadata, 0x00, slot, nil)
+	if err != nil {
+		return nil, fmt.Errorf("piv: read slot %02x: %w", slot, err)
+	}
+	tags, err := parseTLV(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("piv: read slot %02x: %w", slot, err)
+	}
+	if alg := tags[pivTagMetadataAlg]; len(alg) != 1 || alg[0] != pivAlgorithmX25519 {
+		return nil, fmt.Errorf("piv: slot %02x holds no X25519 key", slot)
+	}
+	pub, err := parseTLV(tags[pivTagMetadataPub])
+	if err != nil || len(pub[pivTagX25519PubPart]) != 32 {
+		return nil, fmt.Errorf("piv: slot %02x has a malformed public key", slot)
+	}
+	copy(k.public[:], pub[pivTagX25519PubPart])
+
+	return k, nil
+}
+
+// PublicKey returns the public half of the key.
+func (k *PIVKey) PublicKey() *[32]byte {
+	return &k.public
+}
+
+// ECDH has the token compute the shared secret of the key and peer.
+func (k *PIVKey) ECDH(peer *[32]byte) ([32]byte, error) {
+	var shared [32]byte
+	request := appendTLV(nil, pivTagDynamicAuth, appendTLV(appendTLV(nil, pivTagResponse, nil), pivTagExponentiate, peer[:]))
+	response, err := k.transmit(0x00, pivInsGeneralAuth, pivAlgorithmX25519, k.slot, request)
+	if err != nil {
+		return shared, fmt.Errorf("piv: key agreement: %w", err)
+	}
+
+	outer, err := parseTLV(response)
+	if err != nil {
+		return shared, fmt.Errorf("piv: key agreement: %w", err)
+	}
+	inner, err := parseTLV(outer[pivTagDynamicAuth])
+	if err != nil || len(inner[pivTagResponse]) != len(shared) {
+		return shared, errors.New("piv: key agreement: malformed response")
+	}
+	copy(shared[:], inner[pivTagResponse])
+
+	return shared, nil
+}
+
+// transmit sends a command APDU and returns the data of the response,
+// collecting the rest of it as long as the card says there is more.
+func (k *PIVKey) transmit(cla, ins, p1, p2 byte, data []byte) ([]byte, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	command := []byte{cla, ins, p1, p2}
+	if len(data) > 0 {
+		command = append(append(command, byte(len(data))), data...)
+	}
+
+	var out []byte
+	for {
+		response, err := k.card.Transmit(command)
+		if err != nil {
+			return nil, err
+		}
+		if len(response) < 2 {
+			return nil, fmt.Errorf("response of %d bytes", len(response))
+		}
+		sw1, sw2 := response[len(response)-2], response[len(response)-1]
+		out = append(out, response[:len(response)-2]...)
+
+		switch {
+		case sw1 == 0x90 && sw2 == 0x00:
+			return out, nil
+		case sw1 == 0x61:
+			command = []byte{0x00, pivInsGetResponse, 0x00, 0x00, sw2}
+		case sw1 == 0x63:
+			return nil, fmt.Errorf("%d tries left: %w", sw2&0x0f, ErrIncorrectPIN)
+		case sw1 == 0x69 && sw2 == 0x83:
+			return nil, errors.New("PIN blocked")
+		default:
+			return nil, fmt.Errorf("card answered %02x%02x", sw1, sw2)
+		}
+	}
+}
+
+// appendTLV appends a BER-TLV with tag and value to b.
+func appendTLV(b []byte, tag byte, value []byte) []byte {
+	b = append(b, tag)
+	switch n := len(value); {
+	case n < 0x80:
+		b = append(b, byte(n))
+	case n <= 0xff:
+		b = append(b, 0x81, byte(n))
+	default:
+		b = append(b, 0x82, byte(n>>8), byte(n))
+	}
+
+	return append(b, value...)
+}
+
+// parseTLV parses a run of single byte tag BER-TLVs into the values of
+// each tag.
+func parseTLV(b []byte) (map[byte][]byte, error) {
+	tags := make(map[byte][]byte)
+	for len(b) > 0 {
+		if len(b) < 2 {
+			return nil, errors.New("truncated TLV")
+		}
+		tag, n := b[0], int(b[1])
+		b = b[2:]
+		switch n {
+		case 0x81:
+			if len(b) < 1 {
+				return nil, errors.New("truncated TLV")
+			}
+			n, b = int(b[0]), b[1:]
+		case 0x82:
+			if len(b) < 2 {
+				return nil, errors.New("truncated TLV")
+			}
+			n, b = int(b[0])<<8|int(b[1]), b[2:]
+		}
+		if n > len(b) {
+			return nil, errors.New("truncated TLV")
+		}
+		tags[tag], b = b[:n], b[n:]
+	}
+
+	return tags, nil
+}
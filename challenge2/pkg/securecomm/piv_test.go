@@ -0,0 +1,132 @@
+package securecomm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// fakePIVCard is a PIV token holding an X25519 key in one slot. It
+// answers in chunks of chunk bytes, if positive, to exercise GET
+// RESPONSE.
+type fakePIVCard struct {
+	key   *KeyPair
+	slot  byte
+	pin   []byte
+	chunk int
+
+	selected, verified bool
+	pending            []byte
+}
+
+func (c *fakePIVCard) Transmit(command []byte) ([]byte, error) {
+	ins, p1, p2 := command[1], command[2], command[3]
+	var data []byte
+	if len(command) > 5 {
+		data = command[5 : 5+int(command[4])]
+	}
+
+	switch {
+	case ins == pivInsSelect && bytes.Equal(data, pivAID):
+		c.selected = true
+		return c.respond(nil), nil
+	case !c.selected:
+		return []byte{0x6d, 0x00}, nil
+	case ins == pivInsVerify:
+		if !bytes.Equal(data, append(append([]byte(nil), c.pin...), bytes.Repeat([]byte{0xff}, pivMaxPINLength-len(c.pin))...)) {
+			return []byte{0x63, 0xc2}, nil
+		}
+		c.verified = true
+		return c.respond(nil), nil
+	case ins == pivInsGetMetadata && p2 == c.slot:
+		pub := appendTLV(nil, pivTagX25519PubPart, c.key.Public[:])
+		return c.respond(appendTLV(appendTLV(nil, pivTagMetadataAlg, []byte{pivAlgorithmX25519}), pivTagMetadataPub, pub)), nil
+	case ins == pivInsGeneralAuth && p1 == pivAlgorithmX25519 && p2 == c.slot:
+		if !c.verified {
+			return []byte{0x69, 0x82}, nil
+		}
+		outer, _ := parseTLV(data)
+		inner, _ := parseTLV(outer[pivTagDynamicAuth])
+		var peer [32]byte
+		copy(peer[:], inner[pivTagExponentiate])
+		shared, _ := c.key.ECDH(&peer)
+		return c.respond(appendTLV(nil, pivTagDynamicAuth, appendTLV(nil, pivTagResponse, shared[:]))), nil
+	case ins == pivInsGetResponse:
+		return c.respond(c.pending), nil
+	default:
+		return []byte{0x6a, 0x80}, nil
+	}
+}
+
+// respond answers with data, or its first chunk if it is longer.
+func (c *fakePIVCard) respond(data []byte) []byte {
+	c.pending = nil
+	if c.chunk > 0 && len(data) > c.chunk {
+		c.pending = data[c.chunk:]
+		rest := len(c.pending)
+		if rest > 0xff {
+			rest = 0
+		}
+		return append(append([]byte(nil), data[:c.chunk]...), 0x61, byte(rest))
+	}
+
+	return append(append([]byte(nil), data...), 0x90, 0x00)
+}
+
+func TestPIVKey(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	peer, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, chunk := range []int{0, 16} {
+		card := &fakePIVCard{key: key, slot: PIVSlotKeyManagement, pin: []byte("123456"), chunk: chunk}
+		pk, err := OpenPIVKey(card, PIVSlotKeyManagement, []byte("123456"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *pk.PublicKey() != key.Public {
+			t.Errorf("Unexpected public key read in chunks of %d", chunk)
+		}
+		shared, err := pk.ECDH(&peer.Public)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want, _ := key.ECDH(&peer.Public); shared != want {
+			t.Errorf("Expected the token to agree on the shared secret, in chunks of %d", chunk)
+		}
+	}
+
+	card := &fakePIVCard{key: key, slot: PIVSlotKeyManagement, pin: []byte("123456")}
+	if _, err := OpenPIVKey(card, PIVSlotKeyManagement, []byte("000000")); !errors.Is(err, ErrIncorrectPIN) {
+		t.Errorf("Expected ErrIncorrectPIN, got %v", err)
+	}
+	if _, err := OpenPIVKey(card, PIVSlotAuthentication, []byte("123456")); err == nil {
+		t.Error("Expected an empty slot to fail")
+	}
+}
+
+func TestPIVHandshake(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	pk, err := OpenPIVKey(&fakePIVCard{key: key, slot: PIVSlotKeyManagement, pin: []byte("1234")}, PIVSlotKeyManagement, []byte("1234"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Options: []Option{WithIdentityKey(pk)}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn := dialEchoed(t, addr)
+	defer conn.Close()
+	if identity, ok := conn.PeerIdentity(); !ok || identity != key.Public {
+		t.Errorf("Expected the server to prove the key on the token")
+	}
+}
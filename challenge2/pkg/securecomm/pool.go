@@ -0,0 +1,33 @@
+package securecomm
+
+import (
+	"sync"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// framePool holds the buffers frames are built and read in, so sending
+// or receiving a frame does not allocate once the connection is warm.
+// Buffers start large enough for a frame of DefaultMaxMessageSize and
+// grow to fit larger MaxMessageSize settings.
+var framePool = sync.Pool{
+	New: func() interface{} {
+		buf := make([]byte, 0, frameHeaderSize+box.Overhead+frameFlagsSize+paddedLengthSize+DefaultMaxMessageSize)
+		return &buf
+	},
+}
+
+// getBuffer returns a pooled buffer of length size.
+func getBuffer(size int) *[]byte {
+	buf := framePool.Get().(*[]byte)
+	if cap(*buf) < size {
+		*buf = make([]byte, size)
+	}
+	*buf = (*buf)[:size]
+
+	return buf
+}
+
+func putBuffer(buf *[]byte) {
+	framePool.Put(buf)
+}
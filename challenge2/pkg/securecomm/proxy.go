@@ -0,0 +1,232 @@
+package securecomm
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// proxyTransport connects through a SOCKS5 or HTTP CONNECT proxy, which
+// it reaches with base.
+type proxyTransport struct {
+	proxy *url.URL
+	base  Transport
+}
+
+func (t proxyTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	var connect func(net.Conn, string, *url.Userinfo) (net.Conn, error)
+	switch t.proxy.Scheme {
+	case "socks5":
+		connect = socks5Connect
+	case "http":
+		connect = httpConnect
+	default:
+		return nil, fmt.Errorf("unsupported proxy scheme %q", t.proxy.Scheme)
+	}
+
+	conn, err := t.base.Dial(ctx, t.proxy.Host)
+	if err != nil {
+		return nil, fmt.Errorf("dial proxy: %w", err)
+	}
+	deadline, _ := ctx.Deadline()
+	if err := conn.SetDeadline(deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	stop := interruptOnDone(ctx, conn)
+	tunnel, err := connect(conn, addr, t.proxy.User)
+	stop()
+	if ctxErr := contextErr(ctx, systemClock{}); ctxErr != nil {
+		err = ctxErr
+	}
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("connect through %s proxy: %w", t.proxy.Scheme, err)
+	}
+
+	return tunnel, nil
+}
+
+// SOCKS5, as described in RFC 1928, with username and password
+// authentication as described in RFC 1929.
+const (
+	socks5Version = 5
+
+	socks5NoAuth       = 0
+	socks5PasswordAuth = 2
+
+	socks5PasswordVersion = 1
+
+	socks5CommandConnect = 1
+
+	socks5IPv4   = 1
+	socks5Domain = 3
+	socks5IPv6   = 4
+)
+
+// socks5Connect asks the SOCKS5 proxy at the other end of conn to
+// connect it to addr, authenticating as user if given.
+func socks5Connect(conn net.Conn, addr string, user *url.Userinfo) (net.Conn, error) {
+	host, portString, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	port, err := strconv.ParseUint(portString, 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("bad port %q: %w", portString, err)
+	}
+
+	method := byte(socks5NoAuth)
+	if user != nil {
+		method = socks5PasswordAuth
+	}
+	if _, err := conn.Write([]byte{socks5Version, 1, method}); err != nil {
+		return nil, err
+	}
+
+	var reply [2]byte
+	if _, err := io.ReadFull(conn, reply[:]); err != nil {
+		return nil, fmt.Errorf("read method: %w", err)
+	}
+	if reply[0] != socks5Version {
+		return nil, fmt.Errorf("proxy speaks SOCKS version %d", reply[0])
+	}
+	if reply[1] != method {
+		return nil, fmt.Errorf("no acceptable authentication method: %w", ErrProxyRefused)
+	}
+
+	if method == socks5PasswordAuth {
+		password, _ := user.Password()
+		if len(user.Username()) > 255 || len(password) > 255 {
+			return nil, errors.New("proxy username or password longer than 255 bytes")
+		}
+
+		auth := []byte{socks5PasswordVersion, byte(len(user.Username()))}
+		auth = append(auth, user.Username()...)
+		auth = append(auth, byte(len(password)))
+		auth = append(auth, password...)
+		if _, err := conn.Write(auth); err != nil {
+			return nil, err
+		}
+
+		if _, err := io.ReadFull(conn, reply[:]); err != nil {
+			return nil, fmt.Errorf("read authentication status: %w", err)
+		}
+		if reply[1] != 0 {
+			return nil, fmt.Errorf("credentials rejected: %w", ErrProxyRefused)
+		}
+	}
+
+	request := []byte{socks5Version, socks5CommandConnect, 0}
+	if ip := net.ParseIP(host); ip.To4() != nil {
+		request = append(append(request, socks5IPv4), ip.To4()...)
+	} else if ip != nil {
+		request = append(append(request, socks5IPv6), ip.To16()...)
+	} else {
+		if len(host) > 255 {
+			return nil, fmt.Errorf("host name %q too long", host)
+		}
+		request = append(append(request, socks5Domain, byte(len(host))), host...)
+	}
+	request = append(request, byte(port>>8), byte(port))
+	if _, err := conn.Write(request); err != nil {
+		return nil, err
+	}
+
+	// The reply ends with the address the proxy connected from, which
+	// we have no use for but must read past.
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return nil, fmt.Errorf("read connect reply: %w", err)
+	}
+	if header[1] != 0 {
+		return nil, fmt.Errorf("connect failed with code %d: %w", header[1], ErrProxyRefused)
+	}
+
+	var skip int
+	switch header[3] {
+	case socks5IPv4:
+		skip = net.IPv4len
+	case socks5IPv6:
+		skip = net.IPv6len
+	case socks5Domain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return nil, fmt.Errorf("read connect reply: %w", err)
+		}
+		skip = int(n[0])
+	default:
+		return nil, fmt.Errorf("unknown address type %d in connect reply", header[3])
+	}
+	bound := make([]byte, skip+2)
+	if _, err := io.ReadFull(conn, bound); err != nil {
+		return nil, fmt.Errorf("read connect reply: %w", err)
+	}
+
+	return conn, nil
+}
+
+// httpConnect asks the HTTP proxy at the other end of conn to tunnel it
+// to addr with a CONNECT request, authenticating as user if given.
+func httpConnect(conn net.Conn, addr string, user *url.Userinfo) (net.Conn, error) {
+	req := &http.Request{
+		Method: http.MethodConnect,
+		URL:    &url.URL{Opaque: addr},
+		Host:   addr,
+		Header: make(http.Header),
+	}
+	if user != nil {
+		password, _ := user.Password()
+		req.SetBasicAuth(user.Username(), password)
+		req.Header["Proxy-Authorization"] = req.Header["Authorization"]
+		delete(req.Header, "Authorization")
+	}
+	if err := req.Write(conn); err != nil {
+		return nil, err
+	}
+
+	br := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(br, req)
+	if err != nil {
+		return nil, fmt.Errorf("read CONNECT response: %w", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("CONNECT answered %q: %w", resp.Status, ErrProxyRefused)
+	}
+
+	// The server sends its preamble without waiting for ours, so it may
+	// already have been read along with the response.
+	if br.Buffered() > 0 {
+		return &bufferedConn{Conn: conn, r: br}, nil
+	}
+
+	return conn, nil
+}
+
+// bufferedConn is a net.Conn whose reads start with what a
+// bufio.Reader already read from it.
+type bufferedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *bufferedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+// CloseWrite half-closes the underlying connection, if it can be.
+func (c *bufferedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return nil
+}
@@ -0,0 +1,173 @@
+package securecomm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// relay connects client to the server at addr and copies between them
+// until either side is done.
+func relay(client net.Conn, addr string) {
+	server, err := net.Dial("tcp", addr)
+	if err != nil {
+		return
+	}
+	defer server.Close()
+
+	go io.Copy(server, client)
+	io.Copy(client, server)
+}
+
+// serveSOCKS5 runs a minimal SOCKS5 proxy on l that only accepts user
+// and password, when user is set.
+func serveSOCKS5(l net.Listener, user, password string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			greeting := make([]byte, 2)
+			if _, err := io.ReadFull(conn, greeting); err != nil {
+				return
+			}
+			methods := make([]byte, greeting[1])
+			if _, err := io.ReadFull(conn, methods); err != nil {
+				return
+			}
+
+			want := byte(socks5NoAuth)
+			if user != "" {
+				want = socks5PasswordAuth
+			}
+			if methods[0] != want {
+				conn.Write([]byte{socks5Version, 0xff})
+				return
+			}
+			conn.Write([]byte{socks5Version, want})
+
+			if user != "" {
+				r := bufio.NewReader(conn)
+				r.ReadByte()
+				n, _ := r.ReadByte()
+				gotUser := make([]byte, n)
+				io.ReadFull(r, gotUser)
+				n, _ = r.ReadByte()
+				gotPassword := make([]byte, n)
+				io.ReadFull(r, gotPassword)
+				if string(gotUser) != user || string(gotPassword) != password {
+					conn.Write([]byte{socks5PasswordVersion, 1})
+					return
+				}
+				conn.Write([]byte{socks5PasswordVersion, 0})
+			}
+
+			header := make([]byte, 4)
+			if _, err := io.ReadFull(conn, header); err != nil || header[3] != socks5IPv4 {
+				return
+			}
+			target := make([]byte, net.IPv4len+2)
+			if _, err := io.ReadFull(conn, target); err != nil {
+				return
+			}
+			addr := &net.TCPAddr{IP: net.IP(target[:net.IPv4len]), Port: int(binary.BigEndian.Uint16(target[net.IPv4len:]))}
+
+			conn.Write([]byte{socks5Version, 0, 0, socks5IPv4, 0, 0, 0, 0, 0, 0})
+			relay(conn, addr.String())
+		}(conn)
+	}
+}
+
+// serveConnect runs a minimal HTTP proxy on l that answers CONNECT
+// requests, requiring the given Proxy-Authorization when set.
+func serveConnect(l net.Listener, authorization string) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			req, err := http.ReadRequest(bufio.NewReader(conn))
+			if err != nil || req.Method != http.MethodConnect {
+				return
+			}
+			if authorization != "" && req.Header.Get("Proxy-Authorization") != authorization {
+				io.WriteString(conn, "HTTP/1.1 407 Proxy Authentication Required\r\n\r\n")
+				return
+			}
+
+			io.WriteString(conn, "HTTP/1.1 200 Connection established\r\n\r\n")
+			relay(conn, req.Host)
+		}(conn)
+	}
+}
+
+func TestDialerProxy(t *testing.T) {
+	l := testutil.Listen(t)
+	go Serve(l, nil)
+
+	tests := []struct {
+		name  string
+		serve func(net.Listener)
+		proxy string
+		err   error
+	}{
+		{"socks5", func(l net.Listener) { serveSOCKS5(l, "", "") }, "socks5://%s", nil},
+		{"socks5 with password", func(l net.Listener) { serveSOCKS5(l, "alice", "secret") }, "socks5://alice:secret@%s", nil},
+		{"socks5 with wrong password", func(l net.Listener) { serveSOCKS5(l, "alice", "secret") }, "socks5://alice:guess@%s", ErrProxyRefused},
+		{"socks5 without password", func(l net.Listener) { serveSOCKS5(l, "alice", "secret") }, "socks5://%s", ErrProxyRefused},
+		{"http", func(l net.Listener) { serveConnect(l, "") }, "http://%s", nil},
+		{"http with password", func(l net.Listener) { serveConnect(l, "Basic YWxpY2U6c2VjcmV0") }, "http://alice:secret@%s", nil},
+		{"http without password", func(l net.Listener) { serveConnect(l, "Basic YWxpY2U6c2VjcmV0") }, "http://%s", ErrProxyRefused},
+	}
+
+	for _, test := range tests {
+		pl := testutil.Listen(t)
+		go test.serve(pl)
+
+		proxy, err := url.Parse(fmt.Sprintf(test.proxy, pl.Addr()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		d := Dialer{Proxy: proxy}
+		conn, err := d.Dial(l.Addr().String())
+		if test.err != nil {
+			if !errors.Is(err, test.err) {
+				t.Errorf("%s: expected %v, got %v", test.name, test.err, err)
+			}
+			if conn != nil {
+				conn.Close()
+			}
+			pl.Close()
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if err := conn.WriteMsg([]byte("through the proxy")); err != nil {
+			t.Fatal(err)
+		}
+		if echo, err := conn.ReadMsg(); err != nil || string(echo) != "through the proxy" {
+			t.Errorf("%s: unexpected echo %q, %v", test.name, echo, err)
+		}
+
+		conn.Close()
+		pl.Close()
+	}
+}
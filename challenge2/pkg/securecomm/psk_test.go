@@ -0,0 +1,49 @@
+package securecomm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestPSK(t *testing.T) {
+	psk := []byte("shared by the operators only")
+
+	l := testutil.Listen(t)
+	go Serve(l, nil, WithPSK(psk))
+
+	noise := testutil.Listen(t)
+	go Serve(noise, nil, WithPSK(psk), WithNoise(NoiseConfig{}))
+
+	ping := func(addr string, opts ...Option) error {
+		conn, err := Dial(addr, opts...)
+		if err != nil {
+			return err
+		}
+		defer conn.Close()
+
+		if err := conn.WriteMsg([]byte("ping")); err != nil {
+			return err
+		}
+		_, err = conn.ReadMsg()
+		return err
+	}
+
+	if err := ping(l.Addr().String(), WithPSK(psk)); err != nil {
+		t.Fatalf("Matching pre-shared keys failed: %v", err)
+	}
+	if err := ping(noise.Addr().String(), WithPSK(psk), WithNoise(NoiseConfig{})); err != nil {
+		t.Fatalf("Matching pre-shared keys failed over noise: %v", err)
+	}
+
+	if err := ping(l.Addr().String()); !errors.Is(err, ErrPSKMismatch) {
+		t.Errorf("Expected ErrPSKMismatch without a pre-shared key, got %v", err)
+	}
+	if err := ping(l.Addr().String(), WithPSK([]byte("guessed"))); err == nil {
+		t.Error("Expected a different pre-shared key to fail")
+	}
+	if err := ping(noise.Addr().String(), WithPSK([]byte("guessed")), WithNoise(NoiseConfig{})); err == nil {
+		t.Error("Expected a different pre-shared key to fail over noise")
+	}
+}
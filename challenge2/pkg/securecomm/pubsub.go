@@ -0,0 +1,144 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// A PubSubOp says what a PubSubMessage asks for or carries.
+type PubSubOp byte
+
+const (
+	// PubSubSubscribe asks for the messages published to a topic.
+	PubSubSubscribe PubSubOp = iota
+
+	// PubSubUnsubscribe undoes PubSubSubscribe.
+	PubSubUnsubscribe
+
+	// PubSubPublish sends a payload to the subscribers of a topic. It
+	// is also how they receive it.
+	PubSubPublish
+)
+
+// A PubSubMessage is what the clients of a PubSubHandler and the handler
+// send each other, each in a message of its own.
+type PubSubMessage struct {
+	Op      PubSubOp
+	Topic   string
+	Payload []byte
+}
+
+// MarshalBinary encodes m as the operation, the length of the topic in a
+// byte, the topic, and the payload.
+func (m PubSubMessage) MarshalBinary() ([]byte, error) {
+	if len(m.Topic) > 255 {
+		return nil, fmt.Errorf("topic %q longer than 255 bytes", m.Topic)
+	}
+
+	b := make([]byte, 0, 2+len(m.Topic)+len(m.Payload))
+	b = append(b, byte(m.Op), byte(len(m.Topic)))
+	b = append(b, m.Topic...)
+
+	return append(b, m.Payload...), nil
+}
+
+// UnmarshalBinary decodes a message encoded by MarshalBinary.
+func (m *PubSubMessage) UnmarshalBinary(b []byte) error {
+	if len(b) < 2 || len(b) < 2+int(b[1]) {
+		return errors.New("pub/sub message truncated")
+	}
+
+	m.Op = PubSubOp(b[0])
+	m.Topic = string(b[2 : 2+b[1]])
+	m.Payload = append([]byte(nil), b[2+b[1]:]...)
+
+	return nil
+}
+
+// maxSubscriptions bounds the topics one client may subscribe to, which
+// the server must remember for as long as it stays connected.
+const maxSubscriptions = 256
+
+// PubSubHandler returns a Handler that lets clients subscribe to topics
+// and publish to them with PubSubMessages. Each message published to a
+// topic goes to every client subscribed to it, the publisher included,
+// sealed on each subscriber's own connection. As with BroadcastHandler,
+// a client that falls too far behind is disconnected.
+func PubSubHandler() Handler {
+	ps := &pubSub{topics: make(map[string]map[*relayClient]struct{})}
+	return ps.serve
+}
+
+// pubSub is the subscriptions of the clients a PubSubHandler serves.
+type pubSub struct {
+	mu     sync.Mutex
+	topics map[string]map[*relayClient]struct{}
+}
+
+func (ps *pubSub) serve(ctx context.Context, conn *SecureConn) error {
+	c := newRelayClient(conn)
+
+	subscribed := make(map[string]bool)
+	defer func() {
+		for topic := range subscribed {
+			ps.unsubscribe(c, topic)
+		}
+	}()
+
+	return c.serve(ctx, func(message []byte) error {
+		var m PubSubMessage
+		if err := m.UnmarshalBinary(message); err != nil {
+			return err
+		}
+
+		switch m.Op {
+		case PubSubSubscribe:
+			if !subscribed[m.Topic] && len(subscribed) == maxSubscriptions {
+				return fmt.Errorf("more than %d subscriptions", maxSubscriptions)
+			}
+			subscribed[m.Topic] = true
+			ps.subscribe(c, m.Topic)
+		case PubSubUnsubscribe:
+			delete(subscribed, m.Topic)
+			ps.unsubscribe(c, m.Topic)
+		case PubSubPublish:
+			// The message is delivered just as it was published.
+			ps.publish(m.Topic, message)
+		default:
+			return fmt.Errorf("unknown pub/sub operation %d", m.Op)
+		}
+
+		return nil
+	})
+}
+
+func (ps *pubSub) subscribe(c *relayClient, topic string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if ps.topics[topic] == nil {
+		ps.topics[topic] = make(map[*relayClient]struct{})
+	}
+	ps.topics[topic][c] = struct{}{}
+}
+
+func (ps *pubSub) unsubscribe(c *relayClient, topic string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	delete(ps.topics[topic], c)
+	if len(ps.topics[topic]) == 0 {
+		delete(ps.topics, topic)
+	}
+}
+
+func (ps *pubSub) publish(topic string, message []byte) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	for c := range ps.topics[topic] {
+		c.enqueue(message)
+	}
+}
@@ -0,0 +1,116 @@
+package securecomm
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestPubSubMessageEncoding(t *testing.T) {
+	m := PubSubMessage{Op: PubSubPublish, Topic: "weather", Payload: []byte("rain")}
+	b, err := m.MarshalBinary()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded PubSubMessage
+	if err := decoded.UnmarshalBinary(b); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Op != m.Op || decoded.Topic != m.Topic || !bytes.Equal(decoded.Payload, m.Payload) {
+		t.Fatalf("Decoded %+v, expected %+v", decoded, m)
+	}
+
+	if err := decoded.UnmarshalBinary(b[:4]); err == nil {
+		t.Error("Expected a truncated message to be rejected")
+	}
+}
+
+func TestPubSubHandler(t *testing.T) {
+	s := &Server{Handler: PubSubHandler()}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	send := func(conn *SecureConn, op PubSubOp, topic, payload string) {
+		t.Helper()
+		b, err := PubSubMessage{Op: op, Topic: topic, Payload: []byte(payload)}.MarshalBinary()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.WriteMsg(b); err != nil {
+			t.Fatal(err)
+		}
+	}
+	expect := func(conn *SecureConn, topic, payload string) {
+		t.Helper()
+		conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+		b, err := conn.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m PubSubMessage
+		if err := m.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if m.Op != PubSubPublish || m.Topic != topic || string(m.Payload) != payload {
+			t.Fatalf("Received %+v, expected %q on %q", m, payload, topic)
+		}
+	}
+	// subscribe subscribes conn to topic and waits until the server has
+	// seen to it, by publishing to a topic of its own.
+	subscribe := func(conn *SecureConn, op PubSubOp, topic string) {
+		t.Helper()
+		own := conn.LocalAddr().String()
+		send(conn, op, topic, "")
+		send(conn, PubSubSubscribe, own, "")
+		send(conn, PubSubPublish, own, "sync")
+		expect(conn, own, "sync")
+		send(conn, PubSubUnsubscribe, own, "")
+	}
+
+	dial := func() *SecureConn {
+		t.Helper()
+		conn, err := Dial(addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return conn
+	}
+	weather, news, publisher := dial(), dial(), dial()
+	defer weather.Close()
+	defer news.Close()
+	defer publisher.Close()
+
+	subscribe(weather, PubSubSubscribe, "weather")
+	subscribe(news, PubSubSubscribe, "news")
+
+	// Each subscriber gets only its own topic, in the order published.
+	send(publisher, PubSubPublish, "news", "headline")
+	send(publisher, PubSubPublish, "weather", "rain")
+	send(publisher, PubSubPublish, "sports", "nobody listens")
+	send(publisher, PubSubPublish, "weather", "sun")
+	expect(weather, "weather", "rain")
+	expect(weather, "weather", "sun")
+	expect(news, "news", "headline")
+
+	subscribe(weather, PubSubUnsubscribe, "weather")
+	subscribe(news, PubSubSubscribe, "weather")
+	send(publisher, PubSubPublish, "weather", "fog")
+	expect(news, "weather", "fog")
+
+	// weather unsubscribed, so the next thing it hears is on a topic it
+	// is still subscribed to.
+	subscribe(weather, PubSubSubscribe, "news")
+	send(publisher, PubSubPublish, "news", "extra")
+	expect(weather, "news", "extra")
+	expect(news, "news", "extra")
+
+	// A message the server does not understand ends the connection.
+	if err := publisher.WriteMsg([]byte{0xff, 0}); err != nil {
+		t.Fatal(err)
+	}
+	publisher.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := publisher.ReadMsg(); err == nil {
+		t.Fatal("Expected the connection to be closed")
+	}
+}
@@ -0,0 +1,119 @@
+package securecomm
+
+import (
+	"bytes"
+	mathrand "math/rand"
+	"net"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+	"golang.org/x/crypto/nacl/box"
+)
+
+// deterministicRand returns a predictable source of randomness, for
+// tests only.
+func deterministicRand(seed int64) *mathrand.Rand {
+	return mathrand.New(mathrand.NewSource(seed))
+}
+
+func TestWriterRand(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	encrypt := func(seed int64) []byte {
+		var buf bytes.Buffer
+		secureW := NewSecureWriter(&buf, priv, pub)
+		secureW.Rand = deterministicRand(seed)
+		secureW.Padding = PaddingPolicy{Random: 64}
+		for _, message := range []string{"hello", "world"} {
+			if err := secureW.WriteMsg([]byte(message)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.Bytes()
+	}
+
+	if !bytes.Equal(encrypt(1), encrypt(1)) {
+		t.Fatal("The same source of randomness produced different ciphertext")
+	}
+	if bytes.Equal(encrypt(1), encrypt(2)) {
+		t.Fatal("Different sources of randomness produced the same ciphertext")
+	}
+}
+
+// recordingConn records everything written to it.
+type recordingConn struct {
+	net.Conn
+	sent bytes.Buffer
+}
+
+func (c *recordingConn) Write(b []byte) (int, error) {
+	c.sent.Write(b)
+	return c.Conn.Write(b)
+}
+
+func TestHandshakeRand(t *testing.T) {
+	// run performs a handshake and an exchange of messages with both
+	// sides drawing from seeded sources, and returns what the client
+	// sent.
+	run := func(opts ...Option) []byte {
+		l := testutil.Listen(t)
+
+		done := make(chan error, 1)
+		go func() {
+			conn, err := l.Accept()
+			if err != nil {
+				done <- err
+				return
+			}
+			defer conn.Close()
+
+			cfg := newConfig(append(opts, WithRand(deterministicRand(2))))
+			pub, priv, err := box.GenerateKey(cfg.random())
+			if err != nil {
+				done <- err
+				return
+			}
+			sc, err := handshake(conn, pub, priv, true, cfg)
+			if err != nil {
+				done <- err
+				return
+			}
+			_, err = sc.ReadMsg()
+			done <- err
+		}()
+
+		conn, err := net.Dial("tcp", l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer conn.Close()
+		recorder := &recordingConn{Conn: conn}
+
+		cfg := newConfig(append(opts, WithRand(deterministicRand(1))))
+		pub, priv, err := box.GenerateKey(cfg.random())
+		if err != nil {
+			t.Fatal(err)
+		}
+		sc, err := handshake(recorder, pub, priv, false, cfg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := sc.WriteMsg([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if err := <-done; err != nil {
+			t.Fatal(err)
+		}
+
+		return recorder.sent.Bytes()
+	}
+
+	for name, opts := range map[string][]Option{
+		"legacy": nil,
+		"noise":  {WithNoise(NoiseConfig{})},
+	} {
+		if !bytes.Equal(run(opts...), run(opts...)) {
+			t.Errorf("%s: seeded handshakes sent different bytes", name)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package securecomm
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"sync"
+	"time"
+)
+
+// closeReasonRateLimited is the payload of the close frame a server
+// sends a client it cuts off for sending too fast. Peers that predate
+// close reasons ignore the payload and read a plain end of stream.
+const closeReasonRateLimited = 1
+
+// rateLimiterPruneSize is how many clients a RateLimiter remembers
+// before it forgets those that have not sent anything lately.
+const rateLimiterPruneSize = 1024
+
+// A RateLimit bounds the messages and bytes a second sent to a server,
+// as token buckets. A zero rate means no limit.
+type RateLimit struct {
+	// Messages is how many messages a second are allowed on average,
+	// and MessageBurst how many may come at once. A zero MessageBurst
+	// allows a second's worth.
+	Messages     float64
+	MessageBurst int
+
+	// Bytes is how many bytes of payload a second are allowed on
+	// average, and ByteBurst how many may come at once. A zero
+	// ByteBurst allows a second's worth, but no less than
+	// DefaultMaxMessageSize, since a frame must fit in the burst to
+	// ever be allowed.
+	Bytes     float64
+	ByteBurst int
+}
+
+func (rl RateLimit) messageBurst() float64 {
+	if rl.MessageBurst > 0 {
+		return float64(rl.MessageBurst)
+	}
+
+	return math.Max(math.Ceil(rl.Messages), 1)
+}
+
+func (rl RateLimit) byteBurst() float64 {
+	if rl.ByteBurst > 0 {
+		return float64(rl.ByteBurst)
+	}
+
+	return math.Max(math.Ceil(rl.Bytes), DefaultMaxMessageSize)
+}
+
+// A RateLimiter limits how fast the clients of a server send, each by
+// PerClient and all together by Global. Clients are told apart by their
+// identity key, or by their IP address when they have none. The
+// exported fields must not be changed once the limiter is in use.
+type RateLimiter struct {
+	PerClient RateLimit
+	Global    RateLimit
+
+	mu      sync.Mutex
+	clients map[string]*rateBuckets
+	global  rateBuckets
+}
+
+// rateBuckets is the token buckets for one RateLimit.
+type rateBuckets struct {
+	messages, bytes tokenBucket
+}
+
+// A tokenBucket holds tokens as of last. The zero tokenBucket is full.
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// available returns the tokens in b at now, given the rate they are
+// added at and the most b holds.
+func (b *tokenBucket) available(rate, burst float64, now time.Time) float64 {
+	if b.last.IsZero() {
+		return burst
+	}
+
+	return math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+}
+
+// take removes n tokens from b at now. It must only be called after
+// available showed they are there.
+func (b *tokenBucket) take(n, rate, burst float64, now time.Time) {
+	b.tokens = b.available(rate, burst, now) - n
+	b.last = now
+}
+
+// check reports which limit of rl sending a frame of n bytes at now
+// would exceed, if any. last says whether the frame ends a message.
+func (rb *rateBuckets) check(rl RateLimit, n int, last bool, now time.Time) string {
+	if rl.Messages > 0 && last && rb.messages.available(rl.Messages, rl.messageBurst(), now) < 1 {
+		return "message rate"
+	}
+	if rl.Bytes > 0 && rb.bytes.available(rl.Bytes, rl.byteBurst(), now) < float64(n) {
+		return "byte rate"
+	}
+
+	return ""
+}
+
+// take uses up what sending a frame of n bytes at now costs.
+func (rb *rateBuckets) take(rl RateLimit, n int, last bool, now time.Time) {
+	if rl.Messages > 0 && last {
+		rb.messages.take(1, rl.Messages, rl.messageBurst(), now)
+	}
+	if rl.Bytes > 0 {
+		rb.bytes.take(float64(n), rl.Bytes, rl.byteBurst(), now)
+	}
+}
+
+// full reports whether rb is as it would be for a new client.
+func (rb *rateBuckets) full(rl RateLimit, now time.Time) bool {
+	return rb.messages.available(rl.Messages, rl.messageBurst(), now) >= rl.messageBurst() &&
+		rb.bytes.available(rl.Bytes, rl.byteBurst(), now) >= rl.byteBurst()
+}
+
+// allow takes what a frame of n bytes from the client named key costs
+// at now, or fails with ErrRateLimited if that exceeds a limit, in
+// which case nothing is taken.
+func (l *RateLimiter) allow(key string, n int, last bool, now time.Time) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	client, ok := l.clients[key]
+	if !ok {
+		if l.clients == nil {
+			l.clients = make(map[string]*rateBuckets)
+		}
+		if len(l.clients) >= rateLimiterPruneSize {
+			l.pruneLocked(now)
+		}
+		client = new(rateBuckets)
+		l.clients[key] = client
+	}
+
+	if exceeded := client.check(l.PerClient, n, last, now); exceeded != "" {
+		return fmt.Errorf("client %s: %w", exceeded, ErrRateLimited)
+	}
+	if exceeded := l.global.check(l.Global, n, last, now); exceeded != "" {
+		return fmt.Errorf("global %s: %w", exceeded, ErrRateLimited)
+	}
+	client.take(l.PerClient, n, last, now)
+	l.global.take(l.Global, n, last, now)
+
+	return nil
+}
+
+// pruneLocked forgets the clients whose buckets have filled up again,
+// which costs them nothing.
+func (l *RateLimiter) pruneLocked(now time.Time) {
+	for key, client := range l.clients {
+		if client.full(l.PerClient, now) {
+			delete(l.clients, key)
+		}
+	}
+}
+
+// limit returns the function a server's reader consults for each data
+// frame from sc.
+func (l *RateLimiter) limit(sc *SecureConn) func(n int, last bool) error {
+	key := sc.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(key); err == nil {
+		key = host
+	}
+	if identity, ok := sc.PeerIdentity(); ok {
+		key = Fingerprint(identity)
+	}
+
+	return func(n int, last bool) error {
+		return l.allow(key, n, last, sc.clock.Now())
+	}
+}
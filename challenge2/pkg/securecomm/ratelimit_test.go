@@ -0,0 +1,121 @@
+package securecomm
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := &RateLimiter{
+		PerClient: RateLimit{Messages: 2, Bytes: 100, ByteBurst: 100},
+		Global:    RateLimit{Messages: 3},
+	}
+	now := time.Unix(1000000, 0)
+
+	allowed := func(key string, n int, last bool) bool {
+		t.Helper()
+		err := l.allow(key, n, last, now)
+		if err != nil && !errors.Is(err, ErrRateLimited) {
+			t.Fatalf("Expected ErrRateLimited, got %v", err)
+		}
+		return err == nil
+	}
+
+	// Frames that do not end a message only count towards bytes.
+	if !allowed("alice", 10, false) || !allowed("alice", 10, true) || !allowed("alice", 10, true) {
+		t.Fatal("Expected alice's burst to be allowed")
+	}
+	if allowed("alice", 10, true) {
+		t.Fatal("Expected alice's third message to be refused")
+	}
+
+	// Bob has his own bucket, but all share the global one.
+	if !allowed("bob", 10, true) {
+		t.Fatal("Expected bob's first message to be allowed")
+	}
+	if allowed("bob", 10, true) {
+		t.Fatal("Expected the global limit to refuse bob's second message")
+	}
+
+	// Buckets refill over time, up to their burst.
+	now = now.Add(time.Hour)
+	if !allowed("alice", 10, true) || !allowed("alice", 10, true) || allowed("alice", 10, true) {
+		t.Fatal("Expected alice's burst to be allowed again, and no more")
+	}
+
+	// Refused frames cost nothing.
+	now = now.Add(time.Hour)
+	if allowed("bob", 101, false) {
+		t.Fatal("Expected a frame larger than the byte burst to be refused")
+	}
+	if !allowed("bob", 100, false) {
+		t.Fatal("Expected a frame filling the byte burst to be allowed")
+	}
+}
+
+func TestRateLimiterForgetsIdleClients(t *testing.T) {
+	l := &RateLimiter{PerClient: RateLimit{Messages: 1}}
+	now := time.Unix(1000000, 0)
+	for i := 0; i < rateLimiterPruneSize; i++ {
+		if err := l.allow(fmt.Sprint(i), 1, true, now); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := l.allow("late", 1, true, now.Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if len(l.clients) != 1 {
+		t.Errorf("Expected idle clients to be forgotten, %d are remembered", len(l.clients))
+	}
+}
+
+func TestServeRateLimited(t *testing.T) {
+	errs := make(chan error, 1)
+	clock := newFakeClock()
+	s := &Server{Options: []Option{
+		WithClock(clock),
+		WithRateLimiter(&RateLimiter{PerClient: RateLimit{Messages: 1, MessageBurst: 3}}),
+		WithErrorHandler(func(addr net.Addr, err error) { errs <- err }),
+	}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	for i := 0; i < 3; i++ {
+		if err := conn.WriteMsg([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.ReadMsg(); err != nil {
+			t.Fatalf("Message %d within the burst: %v", i, err)
+		}
+	}
+
+	// A second later, by the server's clock, one more is allowed.
+	clock.Advance(time.Second)
+	if err := conn.WriteMsg([]byte("a second later")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); err != nil {
+		t.Fatalf("Message a second after the burst: %v", err)
+	}
+
+	if err := conn.WriteMsg([]byte("one too many")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected the client to read ErrRateLimited, got %v", err)
+	}
+	if err := <-errs; !errors.Is(err, ErrRateLimited) {
+		t.Fatalf("Expected the server to end the connection with ErrRateLimited, got %v", err)
+	}
+}
@@ -0,0 +1,140 @@
+package securecomm
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"time"
+)
+
+// A ReconnectPolicy says how a client keeps a connection to a server up:
+// how long it waits between attempts to dial it again, and whom it tells
+// as the connection comes and goes.
+//
+// The wait starts at InitialDelay and doubles with each attempt that
+// fails in a row, up to MaxDelay if positive. Jitter shortens each wait
+// by a random fraction of up to Jitter, so that clients cut off
+// together do not all come back at once.
+type ReconnectPolicy struct {
+	InitialDelay time.Duration
+	MaxDelay     time.Duration
+	Jitter       float64
+
+	// MaxAttempts, if positive, is how many attempts in a row may fail
+	// before giving up.
+	MaxAttempts int
+
+	// OnStateChange, if set, is told of each change of state, with the
+	// error of the last attempt when Reconnecting and the error the
+	// connection was lost with when Disconnected.
+	OnStateChange func(state ReconnectState, err error)
+}
+
+// DefaultReconnectPolicy is the policy of the -reconnect flag.
+var DefaultReconnectPolicy = ReconnectPolicy{
+	InitialDelay: 100 * time.Millisecond,
+	MaxDelay:     time.Minute,
+	Jitter:       0.5,
+}
+
+// A ReconnectState is a stage a ReconnectPolicy takes a connection
+// through.
+type ReconnectState int
+
+const (
+	// Reconnecting means dialing, after a failed attempt if there was
+	// one.
+	Reconnecting ReconnectState = iota
+
+	// Connected means the handshake completed.
+	Connected
+
+	// Disconnected means the connection was lost.
+	Disconnected
+)
+
+func (s ReconnectState) String() string {
+	switch s {
+	case Reconnecting:
+		return "reconnecting"
+	case Connected:
+		return "connected"
+	case Disconnected:
+		return "disconnected"
+	default:
+		return fmt.Sprintf("ReconnectState(%d)", int(s))
+	}
+}
+
+// Redial calls dial until it succeeds, waiting between attempts as the
+// policy says. It gives up when ctx is done, returning ctx.Err(), or
+// after MaxAttempts failed attempts, returning the last error.
+func (p ReconnectPolicy) Redial(ctx context.Context, dial func(ctx context.Context) (*SecureConn, error)) (*SecureConn, error) {
+	var err error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+				return nil, err
+			}
+
+			t := time.NewTimer(p.delay(attempt))
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil, ctx.Err()
+			}
+		}
+
+		p.changeState(Reconnecting, err)
+		var sc *SecureConn
+		if sc, err = dial(ctx); err == nil {
+			p.changeState(Connected, nil)
+			return sc, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// Run keeps a connection up for use: it dials with dial, as Redial does,
+// passes the connection to use, and once use returns, taking the
+// connection to be lost, closes it and dials again. It returns when ctx
+// is done or Redial gives up.
+func (p ReconnectPolicy) Run(ctx context.Context, dial func(ctx context.Context) (*SecureConn, error), use func(*SecureConn) error) error {
+	for {
+		sc, err := p.Redial(ctx, dial)
+		if err != nil {
+			return err
+		}
+
+		err = use(sc)
+		sc.Close()
+		p.changeState(Disconnected, err)
+	}
+}
+
+// delay returns how long to wait before the given retry, counting from
+// one.
+func (p ReconnectPolicy) delay(attempt int) time.Duration {
+	d := p.InitialDelay
+	for i := 1; i < attempt && d < math.MaxInt64/2 && (p.MaxDelay <= 0 || d < p.MaxDelay); i++ {
+		d *= 2
+	}
+	if p.MaxDelay > 0 && d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if p.Jitter > 0 {
+		d -= time.Duration(p.Jitter * rand.Float64() * float64(d))
+	}
+
+	return d
+}
+
+func (p ReconnectPolicy) changeState(state ReconnectState, err error) {
+	if p.OnStateChange != nil {
+		p.OnStateChange(state, err)
+	}
+}
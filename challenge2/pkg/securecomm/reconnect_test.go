@@ -0,0 +1,119 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReconnectPolicyDelay(t *testing.T) {
+	p := ReconnectPolicy{InitialDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, want := range []time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 4: 800 * time.Millisecond, 5: time.Second, 6: time.Second} {
+		if attempt == 0 {
+			continue
+		}
+		if got := p.delay(attempt); got != want {
+			t.Errorf("delay(%d) = %v, want %v", attempt, got, want)
+		}
+	}
+
+	p.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if d := p.delay(6); d < 500*time.Millisecond || d > time.Second {
+			t.Fatalf("Jittered delay %v out of range", d)
+		}
+	}
+
+	if d := (ReconnectPolicy{InitialDelay: time.Second}).delay(1000); d <= 0 {
+		t.Errorf("Uncapped delay overflowed to %v", d)
+	}
+}
+
+func TestReconnectPolicyRun(t *testing.T) {
+	// The server is down at first.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := l.Addr().String()
+	l.Close()
+
+	var mu sync.Mutex
+	var states []ReconnectState
+	p := ReconnectPolicy{
+		InitialDelay: 10 * time.Millisecond,
+		MaxDelay:     50 * time.Millisecond,
+		OnStateChange: func(state ReconnectState, err error) {
+			mu.Lock()
+			defer mu.Unlock()
+			states = append(states, state)
+		},
+	}
+
+	s := new(Server)
+	defer s.Close()
+	attempts := 0
+	dial := func(ctx context.Context) (*SecureConn, error) {
+		attempts++
+		if attempts == 3 {
+			l, err := net.Listen("tcp", addr)
+			if err != nil {
+				t.Error(err)
+				return nil, err
+			}
+			go s.Serve(l)
+		}
+		return DialContext(ctx, addr)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	uses := 0
+	lost := errors.New("lost")
+	err = p.Run(ctx, dial, func(sc *SecureConn) error {
+		if err := sc.WriteMsg([]byte("ping")); err != nil {
+			return err
+		}
+		if _, err := sc.ReadMsg(); err != nil {
+			return err
+		}
+		if uses++; uses == 2 {
+			cancel()
+		}
+		return lost
+	})
+	if err != context.Canceled {
+		t.Fatalf("Expected the context's error, got %v", err)
+	}
+	if uses != 2 {
+		t.Errorf("Expected the connection to be used twice, got %d", uses)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []ReconnectState{Reconnecting, Reconnecting, Reconnecting, Connected, Disconnected, Reconnecting, Connected, Disconnected, Reconnecting}
+	if len(states) != len(want) {
+		t.Fatalf("Expected states %v, got %v", want, states)
+	}
+	for i := range want {
+		if states[i] != want[i] {
+			t.Fatalf("Expected states %v, got %v", want, states)
+		}
+	}
+}
+
+func TestReconnectPolicyMaxAttempts(t *testing.T) {
+	refused := errors.New("refused")
+	attempts := 0
+	p := ReconnectPolicy{InitialDelay: time.Millisecond, MaxAttempts: 3}
+	_, err := p.Redial(context.Background(), func(context.Context) (*SecureConn, error) {
+		attempts++
+		return nil, refused
+	})
+	if err != refused || attempts != 3 {
+		t.Errorf("Expected 3 attempts ending in %v, got %d, %v", refused, attempts, err)
+	}
+}
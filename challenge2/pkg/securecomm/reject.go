@@ -0,0 +1,48 @@
+package securecomm
+
+import (
+	"errors"
+	"time"
+)
+
+// closeReasonRejected is the payload of the close frame sent to a peer
+// whose frame we rejected. Frames that fail to decrypt, have bad
+// padding, arrive out of sequence, announce too large a payload or go
+// past the frames allowed under one key all share it, so that an
+// attacker tampering with frames learns nothing of which check caught
+// it. The detailed reason is only returned locally.
+const closeReasonRejected = 2
+
+// rejectDelay is how long after a rejected frame's header arrived the
+// connection is torn down. A length is rejected as soon as the header
+// is read, and a forged box only once the whole frame is in and failed
+// to open; waiting out the same delay after both hides that difference,
+// and any in the time taken to open the box, from the peer.
+const rejectDelay = 20 * time.Millisecond
+
+// rejected reports whether err means the peer sent a frame that must be
+// rejected.
+func rejected(err error) bool {
+	return errors.Is(err, ErrDecryptFailed) || errors.Is(err, ErrReplayed) ||
+		errors.Is(err, ErrMessageTooLarge) || errors.Is(err, ErrNonceExhausted)
+}
+
+// reject tears the connection down when err rejects the peer's frame: at
+// rejectDelay after the frame's header arrived, it sends a close frame
+// with the generic closeReasonRejected, if the peer understands close
+// frames, and closes the connection. It returns err unchanged.
+func (c *SecureConn) reject(err error) error {
+	if !rejected(err) {
+		return err
+	}
+
+	c.rejectOnce.Do(func() {
+		sleep(c.clock, c.reader.headerAt.Add(rejectDelay))
+		if c.features&featureClose != 0 {
+			c.writer.close([]byte{closeReasonRejected})
+		}
+		c.Close()
+	})
+
+	return err
+}
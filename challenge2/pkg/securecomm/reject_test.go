@@ -0,0 +1,84 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRejectUniform(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper tamper
+		local  error
+	}{
+		{"forged box", flipBit(frameHeaderSize + 5), ErrDecryptFailed},
+		{"inflated length", flipBit(0), ErrMessageTooLarge},
+		{"replayed", func(i int, frame []byte) ([][]byte, bool) {
+			if i == 1 {
+				return [][]byte{frame, frame}, false
+			}
+			return [][]byte{frame}, false
+		}, ErrReplayed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			failed := make(chan error, 1)
+			s := &Server{Handler: func(ctx context.Context, conn *SecureConn) error {
+				for {
+					message, err := conn.ReadMsg()
+					if err != nil {
+						failed <- err
+						return err
+					}
+					if string(message) == "handshake done" {
+						if err := conn.WriteMsg(message); err != nil {
+							return err
+						}
+					}
+				}
+			}}
+			addr, _ := startServer(t, s)
+			defer s.Close()
+
+			proxy := &tamperProxy{tamper: test.tamper}
+			conn, err := Dial(proxy.start(t, addr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+			if err := conn.WriteMsg([]byte("handshake done")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := conn.ReadMsg(); err != nil {
+				t.Fatal(err)
+			}
+			proxy.armed.Store(true)
+
+			sent := time.Now()
+			for _, message := range []string{"first", "second"} {
+				if err := conn.WriteMsg([]byte(message)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The client only learns that its frame was rejected, and
+			// no sooner than rejectDelay whichever check caught it.
+			if _, err := conn.ReadMsg(); !errors.Is(err, ErrFrameRejected) {
+				t.Fatalf("Expected ErrFrameRejected, got %v", err)
+			}
+			if elapsed := time.Since(sent); elapsed < rejectDelay {
+				t.Errorf("Rejected after %s, expected at least %s", elapsed, rejectDelay)
+			}
+
+			// The server keeps the detailed reason to itself.
+			if err := <-failed; !errors.Is(err, test.local) {
+				t.Errorf("Expected %v locally, got %v", test.local, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,176 @@
+package securecomm
+
+import (
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// A RekeyPolicy says when a SecureWriter replaces its key. Whichever
+// limit is reached first triggers a rekey; zero fields are ignored, so
+// the zero RekeyPolicy never rekeys, short of the writer running out of
+// nonces for its key.
+//
+// To rekey, the writer generates an ephemeral key pair and sends its
+// public half in a rekey frame sealed with the current key. Both sides
+// then derive the next key from the ephemeral shared secret and the
+// current key, so the application never sees the exchange.
+type RekeyPolicy struct {
+	// Bytes is how much payload may be sent with one key.
+	Bytes int64
+
+	// Frames is how many frames may be sent with one key. A write
+	// larger than MaxMessageSize spans several frames.
+	Frames int64
+
+	// Interval is how long one key may be used.
+	Interval time.Duration
+}
+
+// DefaultRekeyPolicy is the policy of connections set up by Dial and
+// Serve.
+var DefaultRekeyPolicy = RekeyPolicy{
+	Bytes:    1 << 30,
+	Frames:   1 << 20,
+	Interval: time.Hour,
+}
+
+const rekeyLabel = "go-mentor secure rekey"
+
+// keyFrameLimit is how many frames may be sealed with one key. Each
+// frame's nonce ends in its sequence number, so no nonce repeats under a
+// key unless that wraps while the key is in use, which the limit keeps
+// far out of reach. A writer past it fails with ErrNonceExhausted, and
+// so does a reader whose peer sends more.
+const keyFrameLimit = 1 << 48
+
+// forcedRekeyMargin is how many frames short of keyFrameLimit a writer
+// whose peer understands rekey frames replaces its key, whatever its
+// RekeyPolicy says. The margin leaves room for control frames, like
+// pongs, that go out between writes without checking.
+const forcedRekeyMargin = 1 << 20
+
+// keyUsage counts what has been sent with the current key.
+type keyUsage struct {
+	bytes  int64
+	frames int64
+	since  time.Time
+}
+
+func (u *keyUsage) add(payload int) {
+	u.bytes += int64(payload)
+	u.frames++
+}
+
+// due reports whether the key described by usage should be replaced
+// before sending another frame.
+func (p RekeyPolicy) due(usage *keyUsage, now time.Time) bool {
+	if usage.since.IsZero() {
+		usage.since = now
+	}
+
+	return (p.Bytes > 0 && usage.bytes >= p.Bytes) ||
+		(p.Frames > 0 && usage.frames >= p.Frames) ||
+		(p.Interval > 0 && now.Sub(usage.since) >= p.Interval)
+}
+
+// rekeyDue reports whether the writer should replace its key before
+// sending the next data frame.
+func (sw *SecureWriter) rekeyDue(now time.Time) bool {
+	if sw.peer == nil {
+		return false
+	}
+
+	return sw.Rekey.due(&sw.usage, now) || (sw.peerRekeys && sw.usage.frames >= keyFrameLimit-forcedRekeyMargin)
+}
+
+// exhausted closes the connection when err says its writer ran out of
+// nonces, since nothing more can be sent on it. It returns err
+// unchanged.
+func (c *SecureConn) exhausted(err error) error {
+	if errors.Is(err, ErrNonceExhausted) {
+		c.Close()
+	}
+
+	return err
+}
+
+// rekey sends a fresh ephemeral public key and switches to the key
+// derived from it.
+func (sw *SecureWriter) rekey() error {
+	ephemeralPub, ephemeralPriv, err := box.GenerateKey(sw.random())
+	if err != nil {
+		return fmt.Errorf("generate rekey key pair: %w", err)
+	}
+	defer clear(ephemeralPriv[:])
+
+	if err := sw.writeFrame(flagRekey, ephemeralPub[:]); err != nil {
+		return fmt.Errorf("write rekey frame: %w", err)
+	}
+
+	shared := precompute(sw.peer, ephemeralPriv)
+	defer clear(shared)
+	key, err := deriveKey(shared, sw.key[:], rekeyLabel)
+	if err != nil {
+		return err
+	}
+	defer clear(key[:])
+
+	// Overwriting the key in place leaves no copy of the old one.
+	sw.key = *key
+	sw.aead.wipe()
+	sw.usage = keyUsage{}
+	atomic.AddInt64(&sw.rekeys, 1)
+	if sw.metrics != nil {
+		sw.metrics.rekeyed()
+	}
+	if sw.keyed != nil {
+		sw.keyed()
+	}
+
+	return nil
+}
+
+// rekey switches to the key derived from the ephemeral public key the
+// peer sent in a rekey frame.
+func (sr *SecureReader) rekey(payload []byte) error {
+	if sr.replayed {
+		return nil
+	}
+	if sr.priv == nil {
+		return errors.New("rekey frame received without a handshake to rekey from")
+	}
+	if len(payload) != 32 {
+		return fmt.Errorf("rekey frame holds %d bytes, expected a 32 byte key", len(payload))
+	}
+
+	var ephemeralPub [32]byte
+	copy(ephemeralPub[:], payload)
+
+	shared, err := precomputeWith(sr.priv, &ephemeralPub)
+	if err != nil {
+		return err
+	}
+	defer clear(shared)
+	key, err := deriveKey(shared, sr.key[:], rekeyLabel)
+	if err != nil {
+		return err
+	}
+	defer clear(key[:])
+
+	sr.key = *key
+	sr.keyFrames = 0
+	sr.aead.wipe()
+	atomic.AddInt64(&sr.rekeys, 1)
+	if sr.metrics != nil {
+		sr.metrics.rekeyed()
+	}
+	if sr.keyed != nil {
+		sr.keyed()
+	}
+
+	return nil
+}
@@ -0,0 +1,183 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestRekeyPolicy(t *testing.T) {
+	start := time.Now()
+
+	tests := []struct {
+		policy RekeyPolicy
+		usage  keyUsage
+		now    time.Time
+		due    bool
+	}{
+		{RekeyPolicy{}, keyUsage{bytes: 1 << 40, frames: 1 << 40, since: start}, start.Add(24 * time.Hour), false},
+		{RekeyPolicy{Bytes: 10}, keyUsage{bytes: 9, since: start}, start, false},
+		{RekeyPolicy{Bytes: 10}, keyUsage{bytes: 10, since: start}, start, true},
+		{RekeyPolicy{Frames: 2}, keyUsage{frames: 2, since: start}, start, true},
+		{RekeyPolicy{Interval: time.Minute}, keyUsage{since: start}, start.Add(time.Second), false},
+		{RekeyPolicy{Interval: time.Minute}, keyUsage{since: start}, start.Add(time.Minute), true},
+	}
+
+	for _, test := range tests {
+		if got := test.policy.due(&test.usage, test.now); got != test.due {
+			t.Errorf("%+v with %+v: due = %v, expected %v", test.policy, test.usage, got, test.due)
+		}
+	}
+}
+
+func TestRekey(t *testing.T) {
+	readerPub, readerPriv := testutil.KeyPair(t)
+
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	secureW := newSecureWriter(&buf, &key, readerPub)
+	secureW.Rekey = RekeyPolicy{Frames: 2}
+	secureW.MaxMessageSize = 4
+
+	var expected []string
+	for i := 0; i < 5; i++ {
+		message := fmt.Sprintf("message %d", i)
+		if err := secureW.WriteMsg([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, message)
+	}
+	if secureW.key == key {
+		t.Fatal("Expected the writer to have rekeyed")
+	}
+
+	secureR := newSecureReader(&buf, &key, &KeyPair{Public: *readerPub, Private: *readerPriv})
+	for _, message := range expected {
+		got, err := secureR.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(got) != message {
+			t.Fatalf("Unexpected message: %q != %q", got, message)
+		}
+	}
+	if secureR.key != secureW.key {
+		t.Fatal("Reader and writer disagree on the current key")
+	}
+}
+
+func TestSecureConnRekey(t *testing.T) {
+	l := testutil.Listen(t)
+
+	go Serve(l, nil)
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetRekeyPolicy(RekeyPolicy{Frames: 1})
+
+	for i := 0; i < 5; i++ {
+		message := fmt.Sprintf("ping %d", i)
+		if err := conn.WriteMsg([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+
+		echo, err := conn.ReadMsg()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(echo) != message {
+			t.Fatalf("Unexpected echo: %q != %q", echo, message)
+		}
+	}
+}
+
+func TestForcedRekey(t *testing.T) {
+	s := &Server{}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A policy that never rekeys still gives way before the key runs
+	// out of nonces.
+	conn.SetRekeyPolicy(RekeyPolicy{})
+	conn.writer.usage.frames = keyFrameLimit - forcedRekeyMargin
+	key := conn.writer.key
+
+	if err := conn.WriteMsg([]byte("near the limit")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := conn.ReadMsg(); err != nil || string(echo) != "near the limit" {
+		t.Fatalf("Unexpected echo %q, %v", echo, err)
+	}
+	if conn.writer.key == key {
+		t.Fatal("Expected the writer to have rekeyed")
+	}
+	if conn.writer.usage.frames >= keyFrameLimit-forcedRekeyMargin {
+		t.Fatalf("Expected a fresh count of frames for the new key, got %d", conn.writer.usage.frames)
+	}
+}
+
+func TestNonceExhausted(t *testing.T) {
+	s := &Server{}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	// A peer that cannot rekey leaves only closing the connection.
+	conn.writer.peerRekeys = false
+	conn.writer.usage.frames = keyFrameLimit
+
+	if err := conn.WriteMsg([]byte("one too many")); !errors.Is(err, ErrNonceExhausted) {
+		t.Fatalf("Expected ErrNonceExhausted, got %v", err)
+	}
+	if err := conn.WriteMsg([]byte("another")); !errors.Is(err, ErrNonceExhausted) {
+		t.Fatalf("Expected later writes to fail with ErrNonceExhausted too, got %v", err)
+	}
+	if _, err := conn.ReadMsg(); !errors.Is(err, net.ErrClosed) {
+		t.Fatalf("Expected the connection to be closed, got %v", err)
+	}
+}
+
+func TestReaderNonceExhausted(t *testing.T) {
+	var key [32]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	secureW := newSecureWriter(&buf, &key, nil)
+	if err := secureW.WriteMsg([]byte("past the limit")); err != nil {
+		t.Fatal(err)
+	}
+
+	// A peer that sends more frames with one key than it may is cut
+	// off.
+	secureR := newSecureReader(&buf, &key, nil)
+	secureR.keyFrames = keyFrameLimit
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrNonceExhausted) {
+		t.Fatalf("Expected ErrNonceExhausted, got %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// relayQueueSize is how many messages may wait to be sent to a relay
+// client before it is dropped for falling behind.
+const relayQueueSize = 64
+
+// errFellBehind ends the connection of a client that does not read its
+// messages as fast as the others send them.
+var errFellBehind = errors.New("client fell behind the relay")
+
+// relayClient is a client of a handler that relays messages between
+// clients, such as BroadcastHandler. Messages for it are queued and
+// written from a goroutine of its own, so that a client slow to read
+// never holds up the others.
+type relayClient struct {
+	conn *SecureConn
+	out  chan []byte
+
+	// dropped is closed when the client fell behind.
+	dropped  chan struct{}
+	dropOnce sync.Once
+}
+
+func newRelayClient(conn *SecureConn) *relayClient {
+	return &relayClient{
+		conn:    conn,
+		out:     make(chan []byte, relayQueueSize),
+		dropped: make(chan struct{}),
+	}
+}
+
+// enqueue queues message for c, dropping c if its queue is full.
+func (c *relayClient) enqueue(message []byte) {
+	select {
+	case c.out <- message:
+	default:
+		c.drop()
+	}
+}
+
+// drop disconnects c, which may be stuck writing to a client that
+// stopped reading.
+func (c *relayClient) drop() {
+	c.dropOnce.Do(func() {
+		close(c.dropped)
+		c.conn.Close()
+	})
+}
+
+// serve writes queued messages to the client and passes each message it
+// sends to handle, until it hangs up or falls behind, or ctx is done.
+func (c *relayClient) serve(ctx context.Context, handle func(message []byte) error) error {
+	// Closing the connection stops the reads below.
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		defer c.conn.Close()
+		for {
+			select {
+			case message := <-c.out:
+				if err := c.conn.WriteMsg(message); err != nil {
+					return
+				}
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	for {
+		message, err := c.conn.ReadMsg()
+		select {
+		case <-c.dropped:
+			return errFellBehind
+		default:
+		}
+		if err == io.EOF || ctx.Err() != nil {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("read: %w", err)
+		}
+
+		if err := handle(message); err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,300 @@
+package securecomm
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// A Relay introduces peers that meet at it, waiting with
+// AcceptRendezvous or reaching one with DialRendezvous, and relays their
+// sessions between them, or the messages of the groups they join with
+// JoinGroup. It only ever sees the peers' sessions already encrypted
+// end to end, and forwards them as they come, without the keys to read
+// them. The exported fields must not be changed once its
+// handler is in use.
+type Relay struct {
+	// Direct lets the peers of a pair try to connect to each other
+	// directly, telling each where the other is, and only relays those
+	// that cannot. Otherwise each pair is relayed, and the peers learn
+	// nothing of each other's address.
+	Direct bool
+
+	// PairRate, if positive, caps the bytes a second relayed between
+	// the peers of a pair, both ways together.
+	PairRate float64
+
+	// MaxPairs, if positive, is how many pairs may be relayed at once.
+	// Peers beyond it fail with ErrRelayFull.
+	MaxPairs int
+
+	// The counters are accessed atomically, so they come first to be
+	// aligned for that everywhere.
+	activePairs int64
+	pairs       int64
+	direct      int64
+	refused     int64
+	bytes       int64
+
+	mu      sync.Mutex
+	waiting map[[32]byte][]*rendezvousWaiter
+
+	groups groupRooms
+}
+
+// RelayStats counts what a Relay did.
+type RelayStats struct {
+	// ActivePairs is how many pairs are being relayed now, and Pairs
+	// how many have been in all.
+	ActivePairs int64
+	Pairs       int64
+
+	// Direct is how many pairs connected directly instead.
+	Direct int64
+
+	// Refused is how many peers were turned away for MaxPairs.
+	Refused int64
+
+	// Bytes is how many bytes were relayed, both ways.
+	Bytes int64
+}
+
+// Stats returns what r did so far.
+func (r *Relay) Stats() RelayStats {
+	return RelayStats{
+		ActivePairs: atomic.LoadInt64(&r.activePairs),
+		Pairs:       atomic.LoadInt64(&r.pairs),
+		Direct:      atomic.LoadInt64(&r.direct),
+		Refused:     atomic.LoadInt64(&r.refused),
+		Bytes:       atomic.LoadInt64(&r.bytes),
+	}
+}
+
+// rendezvousWaiter is a peer waiting at the relay to be reached.
+type rendezvousWaiter struct {
+	sc *SecureConn
+
+	// done receives the outcome once the peer has been introduced, and
+	// ends its handler.
+	done chan error
+}
+
+// Handler returns the Handler that serves the peers meeting at r. They
+// must present identity keys.
+func (r *Relay) Handler() Handler {
+	return func(ctx context.Context, sc *SecureConn) error {
+		identity, ok := sc.PeerIdentity()
+		if !ok {
+			return fmt.Errorf("rendezvous: %w", ErrNoPeerIdentity)
+		}
+
+		request, err := sc.ReadMsg()
+		if err != nil {
+			return fmt.Errorf("rendezvous: %w", err)
+		}
+		switch {
+		case len(request) == 1 && request[0] == rendezvousRegister:
+			return r.wait(ctx, identity, sc)
+
+		case len(request) == 1+32 && request[0] == rendezvousConnect:
+			var key [32]byte
+			copy(key[:], request[1:])
+			w := r.take(key)
+			if w == nil {
+				sc.WriteMsg([]byte{rendezvousNotFound})
+				return fmt.Errorf("rendezvous: %s is not waiting", Fingerprint(key))
+			}
+
+			err := r.introduce(w.sc, sc)
+			w.done <- err
+			return err
+
+		case len(request) >= 1 && request[0] == rendezvousGroup && len(request) <= 1+255:
+			return r.groups.serve(ctx, identity, sc, string(request[1:]))
+
+		default:
+			return fmt.Errorf("rendezvous: unexpected request %x", request)
+		}
+	}
+}
+
+// wait keeps sc waiting under identity until a peer reaches it, or ctx
+// is done.
+func (r *Relay) wait(ctx context.Context, identity [32]byte, sc *SecureConn) error {
+	w := &rendezvousWaiter{sc: sc, done: make(chan error, 1)}
+	r.mu.Lock()
+	if r.waiting == nil {
+		r.waiting = make(map[[32]byte][]*rendezvousWaiter)
+	}
+	r.waiting[identity] = append(r.waiting[identity], w)
+	r.mu.Unlock()
+
+	select {
+	case err := <-w.done:
+		return err
+	case <-ctx.Done():
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for i, other := range r.waiting[identity] {
+		if other == w {
+			r.waiting[identity] = append(r.waiting[identity][:i], r.waiting[identity][i+1:]...)
+			if len(r.waiting[identity]) == 0 {
+				delete(r.waiting, identity)
+			}
+			return nil
+		}
+	}
+
+	// A peer took w just as ctx was done.
+	return <-w.done
+}
+
+// take removes the first peer waiting under key, if any.
+func (r *Relay) take(key [32]byte) *rendezvousWaiter {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	queue := r.waiting[key]
+	if len(queue) == 0 {
+		return nil
+	}
+	w := queue[0]
+	if r.waiting[key] = queue[1:]; len(r.waiting[key]) == 0 {
+		delete(r.waiting, key)
+	}
+
+	return w
+}
+
+// introduce tells the peers a and b where the other is, if r lets them
+// connect directly, and relays between them unless both report they
+// did.
+func (r *Relay) introduce(a, b *SecureConn) error {
+	// Count the pair as relayed from the start, so that MaxPairs holds
+	// while it decides.
+	if n := atomic.AddInt64(&r.activePairs, 1); r.MaxPairs > 0 && n > int64(r.MaxPairs) {
+		atomic.AddInt64(&r.activePairs, -1)
+		atomic.AddInt64(&r.refused, 2)
+		for _, sc := range []*SecureConn{a, b} {
+			sc.WriteMsg([]byte{rendezvousFull})
+		}
+		return fmt.Errorf("rendezvous: %w", ErrRelayFull)
+	}
+	defer atomic.AddInt64(&r.activePairs, -1)
+
+	deadline := time.Now().Add(rendezvousReportTimeout)
+	for _, sc := range []*SecureConn{a, b} {
+		if err := sc.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("rendezvous: %w", err)
+		}
+	}
+	for _, pair := range [][2]*SecureConn{{a, b}, {b, a}} {
+		introduction := []byte{rendezvousIntroduce}
+		if r.Direct {
+			introduction = append(introduction, pair[1].RemoteAddr().String()...)
+		}
+		if err := pair[0].WriteMsg(introduction); err != nil {
+			return fmt.Errorf("rendezvous: %w", err)
+		}
+	}
+
+	verdict := byte(rendezvousDirect)
+	for _, sc := range []*SecureConn{a, b} {
+		report, err := sc.ReadMsg()
+		if err != nil {
+			return fmt.Errorf("rendezvous: %w", err)
+		}
+		if !r.Direct || len(report) != 1 || report[0] != rendezvousPunched {
+			verdict = rendezvousRelayed
+		}
+	}
+	for _, sc := range []*SecureConn{a, b} {
+		if err := sc.WriteMsg([]byte{verdict}); err != nil {
+			return fmt.Errorf("rendezvous: %w", err)
+		}
+		if err := sc.SetDeadline(time.Time{}); err != nil {
+			return fmt.Errorf("rendezvous: %w", err)
+		}
+	}
+
+	if verdict == rendezvousDirect {
+		atomic.AddInt64(&r.direct, 1)
+		return nil
+	}
+
+	atomic.AddInt64(&r.pairs, 1)
+	var limiter *pairLimiter
+	if r.PairRate > 0 {
+		limiter = &pairLimiter{rate: r.PairRate, clock: a.clock}
+	}
+	var relayed int64
+	start := a.clock.Now()
+	err := splice(relayedConn{a, limiter, &relayed}, relayedConn{b, limiter, &relayed})
+	atomic.AddInt64(&r.bytes, atomic.LoadInt64(&relayed))
+	slog.Info("relayed pair closed", "a", a.peerFingerprint(), "b", b.peerFingerprint(),
+		"bytes", atomic.LoadInt64(&relayed), "duration", a.clock.Now().Sub(start).Round(time.Millisecond))
+
+	return err
+}
+
+// relayedConn is one peer's connection to a relay, counting what it
+// reads into bytes and pacing it by limiter, if not nil. It hides the
+// WriteTo and ReadFrom of the connection, which would go around Read.
+type relayedConn struct {
+	net.Conn
+	limiter *pairLimiter
+	bytes   *int64
+}
+
+func (c relayedConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 {
+		atomic.AddInt64(c.bytes, int64(n))
+		c.limiter.wait(n)
+	}
+
+	return n, err
+}
+
+func (c relayedConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return nil
+}
+
+// pairLimiter paces the bytes relayed between a pair of peers to rate a
+// second by clock, allowing a second's worth at once.
+type pairLimiter struct {
+	rate  float64
+	clock Clock
+
+	mu     sync.Mutex
+	bucket tokenBucket
+}
+
+// wait takes n bytes' worth of tokens from l, if not nil, sleeping for as
+// long as it then owes.
+func (l *pairLimiter) wait(n int) {
+	if l == nil {
+		return
+	}
+
+	l.mu.Lock()
+	now := l.clock.Now()
+	l.bucket.take(float64(n), l.rate, math.Max(l.rate, 1), now)
+	owed := -l.bucket.tokens
+	l.mu.Unlock()
+
+	if owed > 0 {
+		sleep(l.clock, now.Add(time.Duration(owed/l.rate*float64(time.Second))))
+	}
+}
@@ -0,0 +1,80 @@
+package securecomm
+
+import (
+	"errors"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestRelay(t *testing.T) {
+	r := new(Relay)
+	addr, s := startRelay(t, r.Handler())
+	defer s.Close()
+
+	// Without Direct, even peers that could punch through are relayed.
+	testRendezvous(t, addr)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for r.Stats().ActivePairs > 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	stats := r.Stats()
+	if stats.ActivePairs != 0 || stats.Pairs != 1 || stats.Direct != 0 || stats.Refused != 0 {
+		t.Errorf("Unexpected stats %+v", stats)
+	}
+	if stats.Bytes == 0 {
+		t.Errorf("Expected the relayed bytes to be counted")
+	}
+}
+
+func TestRelayPairRate(t *testing.T) {
+	const rate = 64 << 10
+	r := &Relay{PairRate: rate}
+	addr, s := startRelay(t, r.Handler())
+	defer s.Close()
+
+	dialed, accepted, err := meetAt(t, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Close()
+	defer accepted.Close()
+
+	// The first second's worth goes at once, the second takes a second.
+	start := time.Now()
+	go func() {
+		dialed.Write(make([]byte, 2*rate))
+		dialed.CloseWrite()
+	}()
+	n, err := io.Copy(io.Discard, accepted)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2*rate {
+		t.Fatalf("Received %d bytes, want %d", n, 2*rate)
+	}
+	if elapsed := time.Since(start); elapsed < 800*time.Millisecond {
+		t.Errorf("Relayed %d bytes in %v, faster than %d a second", n, elapsed, rate)
+	}
+}
+
+func TestRelayMaxPairs(t *testing.T) {
+	r := &Relay{MaxPairs: 1}
+	addr, s := startRelay(t, r.Handler())
+	defer s.Close()
+
+	dialed, accepted, err := meetAt(t, addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Close()
+	defer accepted.Close()
+
+	if _, _, err := meetAt(t, addr); !errors.Is(err, ErrRelayFull) {
+		t.Fatalf("Expected ErrRelayFull, got %v", err)
+	}
+	if stats := r.Stats(); stats.Refused != 2 {
+		t.Errorf("Expected both peers to be refused, got %+v", stats)
+	}
+}
@@ -0,0 +1,213 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// Messages that introduce two peers at a rendezvous relay.
+const (
+	// rendezvousRegister is sent by a peer waiting to be reached under
+	// its identity key, and rendezvousConnect, followed by that key, by
+	// a peer that wants to reach it.
+	rendezvousRegister = 1
+	rendezvousConnect  = 2
+
+	// rendezvousIntroduce is sent by the relay to both peers, followed
+	// by the address it sees the other at, for them to punch through
+	// to, or by nothing if they are not to try.
+	rendezvousIntroduce = 3
+
+	// rendezvousPunched and rendezvousUnpunched answer it, reporting
+	// whether a direct connection came up.
+	rendezvousPunched   = 4
+	rendezvousUnpunched = 5
+
+	// rendezvousDirect tells both peers to use the direct connection,
+	// and rendezvousRelayed to carry their session through the relay.
+	rendezvousDirect  = 6
+	rendezvousRelayed = 7
+
+	// rendezvousNotFound tells a peer that the peer it wants to reach is
+	// not waiting at the relay, and rendezvousFull that the relay is
+	// relaying as many pairs as it may.
+	rendezvousNotFound = 8
+	rendezvousFull     = 9
+
+	// rendezvousGroup, followed by a group's name, is sent by a peer
+	// joining that group with JoinGroup.
+	rendezvousGroup = 10
+)
+
+// rendezvousPunchTimeout bounds how long peers try to open a direct
+// connection before falling back to the relay.
+const rendezvousPunchTimeout = 3 * time.Second
+
+// rendezvousReportTimeout bounds how long the relay waits for the peers
+// to report how punching went.
+const rendezvousReportTimeout = rendezvousPunchTimeout + 5*time.Second
+
+// RendezvousHandler returns a Handler for a relay that introduces peers
+// behind NATs to each other, a Relay that lets them connect directly.
+func RendezvousHandler() Handler {
+	r := &Relay{Direct: true}
+	return r.Handler()
+}
+
+// AcceptRendezvous waits at the relay at addr, running RendezvousHandler,
+// for a peer running DialRendezvous with our identity key, and returns
+// the secure connection to it, made directly if possible. It performs
+// the server's side of the handshake, so WithAuthorizedKeys limits who
+// may reach us. WithIdentity is required.
+func AcceptRendezvous(addr string, opts ...Option) (*SecureConn, error) {
+	return rendezvous(addr, []byte{rendezvousRegister}, nil, opts)
+}
+
+// DialRendezvous reaches the peer with the identity key peer, waiting at
+// the relay at addr with AcceptRendezvous, and returns the secure
+// connection to it, made directly if possible. WithIdentity is required.
+func DialRendezvous(addr string, peer [32]byte, opts ...Option) (*SecureConn, error) {
+	return rendezvous(addr, append([]byte{rendezvousConnect}, peer[:]...), &peer, opts)
+}
+
+// rendezvous sends request to the relay at addr and sets up the
+// connection to the peer it introduces, as the client if we know the
+// peer's key and the server otherwise.
+func rendezvous(addr string, request []byte, peer *[32]byte, opts []Option) (*SecureConn, error) {
+	cfg := newConfig(opts)
+	if cfg.identity == nil {
+		return nil, errors.New("rendezvous: an identity key is required")
+	}
+
+	// Dial the relay from a port we can dial the peer from too, so that
+	// the NAT maps both to the same public address.
+	d := Dialer{Transport: reusePortTransport{}}
+	relay, err := d.Dial(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("rendezvous: %w", err)
+	}
+	conn, err := meet(relay, request, cfg)
+	if err != nil {
+		relay.Close()
+		return nil, fmt.Errorf("rendezvous: %w", err)
+	}
+
+	pub, priv, err := box.GenerateKey(cfg.random())
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("generate key pair: %w", err)
+	}
+	cfg.deadline = time.Now().Add(handshakeTimeout(0))
+	if err := conn.SetDeadline(cfg.deadline); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	sc, err := handshake(conn, pub, priv, peer == nil, cfg)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("handshake: %w", err)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		sc.Close()
+		return nil, err
+	}
+
+	if peer != nil {
+		identity, ok := sc.PeerIdentity()
+		if !ok || identity != *peer {
+			sc.Close()
+			return nil, fmt.Errorf("rendezvous: %w", ErrUnexpectedPeer)
+		}
+	} else if cfg.authorized != nil {
+		if err := authorize(sc, cfg.authorized); err != nil {
+			sc.Close()
+			return nil, err
+		}
+	}
+	sc.SetPaddingPolicy(cfg.padding)
+	sc.SetKeepalivePolicy(cfg.keepalive)
+
+	return sc, nil
+}
+
+// meet sends request to the relay, punches through to the peer it
+// introduces and returns the connection the peers agree on: a direct
+// one, or relay itself.
+func meet(relay *SecureConn, request []byte, cfg config) (net.Conn, error) {
+	if err := relay.WriteMsg(request); err != nil {
+		return nil, err
+	}
+	introduction, err := relay.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+	if len(introduction) == 1 && introduction[0] == rendezvousNotFound {
+		return nil, ErrPeerNotFound
+	}
+	if len(introduction) == 1 && introduction[0] == rendezvousFull {
+		return nil, ErrRelayFull
+	}
+	if len(introduction) < 1 || introduction[0] != rendezvousIntroduce {
+		return nil, fmt.Errorf("unexpected introduction %x", introduction)
+	}
+
+	var direct net.Conn
+	report := byte(rendezvousUnpunched)
+	if !cfg.relayOnly && canReusePort && len(introduction) > 1 {
+		if direct, err = punch(relay.LocalAddr(), string(introduction[1:])); err == nil {
+			report = rendezvousPunched
+		}
+	}
+	if err := relay.WriteMsg([]byte{report}); err != nil {
+		return nil, err
+	}
+	verdict, err := relay.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case len(verdict) == 1 && verdict[0] == rendezvousDirect && direct != nil:
+		relay.Close()
+		return direct, nil
+	case len(verdict) == 1 && verdict[0] == rendezvousRelayed:
+		if direct != nil {
+			direct.Close()
+		}
+		return relay, nil
+	default:
+		return nil, fmt.Errorf("unexpected verdict %x", verdict)
+	}
+}
+
+// punch opens a TCP connection from local to remote while the peer at
+// remote does the same the other way, each side's SYN opening the way
+// through its own NAT for the other's.
+func punch(local net.Addr, remote string) (net.Conn, error) {
+	deadline := time.Now().Add(rendezvousPunchTimeout)
+	d := net.Dialer{LocalAddr: local, Control: reusePort, Deadline: deadline}
+	for {
+		conn, err := d.Dial("tcp", remote)
+		if err == nil {
+			return conn, nil
+		}
+		if time.Now().Add(100 * time.Millisecond).After(deadline) {
+			return nil, err
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+// reusePortTransport dials TCP connections whose local port can be
+// dialed from again while they are open.
+type reusePortTransport struct{}
+
+func (reusePortTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	d := net.Dialer{Control: reusePort}
+	return d.DialContext(ctx, "tcp", addr)
+}
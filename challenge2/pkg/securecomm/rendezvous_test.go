@@ -0,0 +1,126 @@
+package securecomm
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+// startRelay starts a server running h.
+func startRelay(t *testing.T, h Handler) (string, *Server) {
+	t.Helper()
+
+	relayKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &Server{
+		Handler: h,
+		Options: []Option{WithIdentity(relayKey), WithErrorHandler(func(net.Addr, error) {})},
+	}
+	addr, _ := startServer(t, s)
+
+	return addr, s
+}
+
+// meetAt has Bob reach Alice at the relay at addr, returning Bob's
+// connection, Alice's and the error Bob got.
+func meetAt(t *testing.T, addr string, opts ...Option) (dialed, accepted *SecureConn, err error) {
+	t.Helper()
+
+	alice, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	bob, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acceptedc := make(chan *SecureConn, 1)
+	go func() {
+		sc, _ := AcceptRendezvous(addr, append(opts, WithIdentity(alice))...)
+		acceptedc <- sc
+	}()
+
+	// Give Alice time to register.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		dialed, err = DialRendezvous(addr, alice.Public, append(opts, WithIdentity(bob))...)
+		if !errors.Is(err, ErrPeerNotFound) || time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	accepted = <-acceptedc
+	if accepted == nil {
+		dialed.Close()
+		t.Fatal("Alice was not reached")
+	}
+	if identity, ok := accepted.PeerIdentity(); !ok || identity != bob.Public {
+		t.Errorf("Expected Alice to see Bob's key")
+	}
+
+	return dialed, accepted, nil
+}
+
+// testRendezvous introduces two peers at the relay at addr and checks
+// that they can talk.
+func testRendezvous(t *testing.T, addr string, opts ...Option) {
+	t.Helper()
+
+	dialed, accepted, err := meetAt(t, addr, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer dialed.Close()
+	defer accepted.Close()
+
+	if err := dialed.WriteMsg([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := accepted.ReadMsg(); err != nil || string(msg) != "hello" {
+		t.Fatalf("Unexpected message %q, %v", msg, err)
+	}
+	if err := accepted.WriteMsg([]byte("hi")); err != nil {
+		t.Fatal(err)
+	}
+	if msg, err := dialed.ReadMsg(); err != nil || string(msg) != "hi" {
+		t.Fatalf("Unexpected message %q, %v", msg, err)
+	}
+}
+
+func TestRendezvousPunched(t *testing.T) {
+	if !canReusePort {
+		t.Skip("hole punching is not supported on this platform")
+	}
+	addr, s := startRelay(t, RendezvousHandler())
+	defer s.Close()
+
+	testRendezvous(t, addr)
+}
+
+func TestRendezvousRelayed(t *testing.T) {
+	addr, s := startRelay(t, RendezvousHandler())
+	defer s.Close()
+
+	testRendezvous(t, addr, WithRelayOnly())
+}
+
+func TestRendezvousNotFound(t *testing.T) {
+	addr, s := startRelay(t, RendezvousHandler())
+	defer s.Close()
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DialRendezvous(addr, [32]byte{1}, WithIdentity(key)); !errors.Is(err, ErrPeerNotFound) {
+		t.Fatalf("Expected ErrPeerNotFound, got %v", err)
+	}
+}
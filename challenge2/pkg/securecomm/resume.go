@@ -0,0 +1,125 @@
+package securecomm
+
+import (
+	"encoding/binary"
+	"io"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// A server configured with WithSessionTickets hands each client a ticket
+// at the end of a full legacy handshake. The ticket holds the session's
+// resumption secret and the client's identity, sealed with a key only
+// the server knows. A client that sends the ticket back when it
+// reconnects skips the key agreement: both sides derive the new session
+// keys from the resumption secret and values fresh to the connection.
+//
+// Resumption is not offered with the Noise handshake or when the
+// handshake is signed, whose guarantees it would bypass.
+const (
+	resumptionLabel = "go-mentor secure resumption"
+	resumeNonceSize = 16
+
+	// A ticket holds the time it was issued, the resumption secret and
+	// the peer's key, preceded by whether that key is an identity key.
+	ticketPlaintextSize = 8 + 32 + 1 + 32
+)
+
+// session is what the client keeps to resume a session.
+type session struct {
+	ticket []byte
+	secret [32]byte
+
+	// peer is the server's identity, when identified says it presented
+	// one.
+	peer       [32]byte
+	identified bool
+}
+
+// A SessionCache holds the session tickets Dial received, by address,
+// so reconnecting to the same server can skip the key exchange. It is
+// safe for concurrent use.
+type SessionCache struct {
+	mu       sync.Mutex
+	sessions map[string]*session
+}
+
+// NewSessionCache returns an empty SessionCache.
+func NewSessionCache() *SessionCache {
+	return &SessionCache{sessions: make(map[string]*session)}
+}
+
+func (c *SessionCache) get(addr string) *session {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.sessions[addr]
+}
+
+func (c *SessionCache) put(addr string, s *session) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.sessions[addr] = s
+}
+
+func (c *SessionCache) remove(addr string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.sessions, addr)
+}
+
+// resumable reports whether the handshake may issue or accept session
+// tickets.
+func resumable(cfg config) bool {
+	return cfg.noise == nil && cfg.signer == nil && len(cfg.trustedSigners) == 0
+}
+
+// sealTicket returns a ticket for the session with the given resumption
+// secret and peer key.
+func sealTicket(key *[32]byte, secret *[32]byte, peer *[32]byte, identified bool, now time.Time, random io.Reader) ([]byte, error) {
+	plaintext := make([]byte, ticketPlaintextSize)
+	binary.BigEndian.PutUint64(plaintext, uint64(now.Unix()))
+	copy(plaintext[8:], secret[:])
+	if identified {
+		plaintext[40] = 1
+	}
+	copy(plaintext[41:], peer[:])
+
+	var nonce [24]byte
+	if _, err := io.ReadFull(random, nonce[:]); err != nil {
+		return nil, err
+	}
+
+	return secretbox.Seal(nonce[:], plaintext, &nonce, key), nil
+}
+
+// openTicket returns the session a ticket describes, or nil if the
+// ticket is forged, corrupt or older than lifetime.
+func openTicket(key *[32]byte, ticket []byte, lifetime time.Duration, now time.Time) *session {
+	if len(ticket) != 24+secretbox.Overhead+ticketPlaintextSize {
+		return nil
+	}
+
+	var nonce [24]byte
+	copy(nonce[:], ticket)
+
+	plaintext, ok := secretbox.Open(nil, ticket[24:], &nonce, key)
+	if !ok {
+		return nil
+	}
+
+	issued := time.Unix(int64(binary.BigEndian.Uint64(plaintext)), 0)
+	if now.Sub(issued) > lifetime {
+		return nil
+	}
+
+	s := session{identified: plaintext[40] == 1}
+	copy(s.secret[:], plaintext[8:])
+	copy(s.peer[:], plaintext[41:])
+
+	return &s
+}
@@ -0,0 +1,94 @@
+package securecomm
+
+import (
+	"crypto/rand"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestTicket(t *testing.T) {
+	key, secret, peer := &[32]byte{'k'}, &[32]byte{'s'}, &[32]byte{'p'}
+	now := time.Now()
+
+	ticket, err := sealTicket(key, secret, peer, true, now, rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := openTicket(key, ticket, time.Hour, now.Add(time.Minute))
+	if s == nil {
+		t.Fatal("Expected a fresh ticket to open")
+	}
+	if s.secret != *secret || s.peer != *peer || !s.identified {
+		t.Fatalf("Unexpected session: %+v", s)
+	}
+
+	if openTicket(key, ticket, time.Hour, now.Add(2*time.Hour)) != nil {
+		t.Error("Expected an expired ticket to be refused")
+	}
+	if openTicket(&[32]byte{'o'}, ticket, time.Hour, now) != nil {
+		t.Error("Expected a ticket sealed with another key to be refused")
+	}
+
+	ticket[len(ticket)-1] ^= 1
+	if openTicket(key, ticket, time.Hour, now) != nil {
+		t.Error("Expected a tampered ticket to be refused")
+	}
+}
+
+func TestResumption(t *testing.T) {
+	serverKey, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := testutil.Listen(t)
+	go Serve(l, nil, WithIdentity(serverKey), WithSessionTickets(time.Hour))
+
+	other := testutil.Listen(t)
+	go Serve(other, nil, WithSessionTickets(time.Hour))
+
+	cache := NewSessionCache()
+	ping := func(addr string) *SecureConn {
+		conn, err := Dial(addr, WithSessionCache(cache))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := conn.Write([]byte("ping")); err != nil {
+			t.Fatal(err)
+		}
+		buf := make([]byte, 4)
+		if _, err := io.ReadFull(conn, buf); err != nil || string(buf) != "ping" {
+			t.Fatalf("Unexpected echo: %q, %v", buf, err)
+		}
+
+		conn.Close()
+		return conn
+	}
+
+	if ping(l.Addr().String()).Resumed() {
+		t.Fatal("The first connection cannot be resumed")
+	}
+
+	conn := ping(l.Addr().String())
+	if !conn.Resumed() {
+		t.Fatal("Expected the second connection to resume the session")
+	}
+	if identity, ok := conn.PeerIdentity(); !ok || identity != serverKey.Public {
+		t.Fatal("The resumed connection lost the server's identity")
+	}
+
+	// A server that cannot open the ticket falls back to a full
+	// handshake and issues a ticket of its own.
+	cache.put(other.Addr().String(), cache.get(l.Addr().String()))
+	if ping(other.Addr().String()).Resumed() {
+		t.Fatal("Expected a foreign ticket to be refused")
+	}
+	if !ping(other.Addr().String()).Resumed() {
+		t.Fatal("Expected the replacement ticket to resume")
+	}
+}
@@ -0,0 +1,16 @@
+//go:build !(darwin || dragonfly || freebsd || linux || netbsd || openbsd)
+
+package securecomm
+
+import (
+	"errors"
+	"syscall"
+)
+
+// canReusePort says whether reusePort works here, so that rendezvous
+// peers can punch through NATs. Here they always go through the relay.
+const canReusePort = false
+
+func reusePort(network, address string, c syscall.RawConn) error {
+	return errors.New("reusing ports is not supported on this platform")
+}
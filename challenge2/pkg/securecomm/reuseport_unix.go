@@ -0,0 +1,29 @@
+//go:build darwin || dragonfly || freebsd || linux || netbsd || openbsd
+
+package securecomm
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// canReusePort says whether reusePort works here, so that rendezvous
+// peers can punch through NATs.
+const canReusePort = true
+
+// reusePort lets a socket bind to a local address that others are bound
+// to, as a net.Dialer's Control function.
+func reusePort(network, address string, c syscall.RawConn) error {
+	var err error
+	if cerr := c.Control(func(fd uintptr) {
+		if err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEADDR, 1); err != nil {
+			return
+		}
+		err = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	}); cerr != nil {
+		return cerr
+	}
+
+	return err
+}
@@ -0,0 +1,113 @@
+package securecomm
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"time"
+)
+
+// rotationLabel derives the proof that a server holds the identity key
+// it announces as its next.
+const rotationLabel = "go-mentor secure identity rotation"
+
+// A KeyRotation schedules the replacement of a server's identity key.
+// Until At, the server handshakes with its current key, and from
+// Overlap before At it also announces Next to clients, proving it holds
+// it, so that clients pinning the current key with KnownHosts can pin
+// Next alongside it. From At on, the server handshakes with Next, which
+// those clients accept while others see a *HostKeyChangedError.
+//
+// Next is only announced during the legacy handshake, not the Noise
+// handshake or a resumed session.
+type KeyRotation struct {
+	// Next is the identity key that replaces the current one.
+	Next IdentityKey
+
+	// At is when Next replaces the current key.
+	At time.Time
+
+	// Overlap is how long before At the server starts announcing Next.
+	// Zero announces it from the start.
+	Overlap time.Duration
+}
+
+// rotate returns cfg as a server configured with it handshakes at now:
+// with the next identity key once the rotation is due, and announcing
+// it only during the overlap before.
+func (cfg config) rotate(now time.Time) config {
+	r := cfg.rotation
+	if r == nil {
+		return cfg
+	}
+
+	switch {
+	case !now.Before(r.At):
+		cfg.identity = r.Next
+		if cfg.noise != nil && cfg.noise.StaticPriv == nil {
+			noise := *cfg.noise
+			noise.static = r.Next
+			cfg.noise = &noise
+		}
+		cfg.rotation = nil
+	case r.Overlap > 0 && now.Before(r.At.Add(-r.Overlap)), cfg.identity == nil:
+		// Without a current key, nothing vouches for the next.
+		cfg.rotation = nil
+	}
+
+	return cfg
+}
+
+// exchangeRotation sends the client the server's next identity key,
+// along with proof that the server holds it bound to this handshake, or
+// receives and checks them. The proof is the next key's shared secret
+// with the client's key for the legacy key swap, which the server
+// computes from peerPub and the client from its own priv.
+func (c *SecureConn) exchangeRotation(cfg config, transcript []byte, peerPub, priv *[32]byte, server bool) error {
+	if server {
+		next := cfg.rotation.Next
+		shared, err := precomputeWith(next, peerPub)
+		if err != nil {
+			return fmt.Errorf("next identity key: %w", err)
+		}
+		proof, err := deriveKey(shared, transcript, rotationLabel)
+		if err != nil {
+			return err
+		}
+		if err := c.writer.WriteMsg(append(next.PublicKey()[:], proof[:]...)); err != nil {
+			return fmt.Errorf("write next identity key: %w", err)
+		}
+		return nil
+	}
+
+	announcement, err := c.reader.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("read next identity key: %w", err)
+	}
+	if len(announcement) != 64 {
+		return fmt.Errorf("next identity key message holds %d bytes: %w", len(announcement), ErrBadHandshake)
+	}
+
+	var next [32]byte
+	copy(next[:], announcement)
+	proof, err := deriveKey(precompute(&next, priv), transcript, rotationLabel)
+	if err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(proof[:], announcement[32:]) != 1 {
+		return fmt.Errorf("next identity key not proven: %w", ErrBadHandshake)
+	}
+	c.peerNext = &next
+
+	return nil
+}
+
+// PeerNextIdentity returns the identity key the server announced it
+// will present once it retires its current one. ok is false when it
+// announced none.
+func (c *SecureConn) PeerNextIdentity() (key [32]byte, ok bool) {
+	if c.peerNext == nil {
+		return [32]byte{}, false
+	}
+
+	return *c.peerNext, true
+}
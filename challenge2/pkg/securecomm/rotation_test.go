@@ -0,0 +1,144 @@
+package securecomm
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestKeyRotation(t *testing.T) {
+	current, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clock := newFakeClock()
+	rotation := KeyRotation{Next: next, At: clock.Now().Add(48 * time.Hour), Overlap: 24 * time.Hour}
+	s := &Server{Options: []Option{
+		WithIdentity(current),
+		WithKeyRotation(rotation),
+		WithClock(clock),
+		WithErrorHandler(func(net.Addr, error) {}),
+	}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	kh, err := LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dial := func() *SecureConn {
+		t.Helper()
+		conn, err := Dial(addr, WithKnownHosts(kh))
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.Close()
+		return conn
+	}
+	pinned := func() string {
+		contents, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(contents)
+	}
+
+	// Before the overlap, only the current key is pinned.
+	if _, ok := dial().PeerNextIdentity(); ok {
+		t.Error("Expected no next key before the overlap")
+	}
+
+	// During it, the next key is pinned alongside.
+	clock.Advance(25 * time.Hour)
+	if got, ok := dial().PeerNextIdentity(); !ok || got != next.Public {
+		t.Errorf("Expected the next key to be announced, got %x, %v", got, ok)
+	}
+	if contents := pinned(); !strings.Contains(contents, current.String()) || !strings.Contains(contents, next.String()) {
+		t.Errorf("Expected both keys pinned, got %q", contents)
+	}
+
+	// A client that knew of it carries on once the server rotates, and
+	// forgets the retired key, while one that did not is warned.
+	clock.Advance(24 * time.Hour)
+	conn := dial()
+	if got, _ := conn.PeerIdentity(); got != next.Public {
+		t.Errorf("Expected the server to present its next key, got %x", got)
+	}
+	if contents := pinned(); strings.Contains(contents, current.String()) || !strings.Contains(contents, next.String()) {
+		t.Errorf("Expected only the next key pinned, got %q", contents)
+	}
+
+	stale, err := LoadKnownHosts(filepath.Join(t.TempDir(), "known_hosts"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := stale.Verify(addr, current.Public); err != nil {
+		t.Fatal(err)
+	}
+	var changed *HostKeyChangedError
+	if _, err := Dial(addr, WithKnownHosts(stale)); !errors.As(err, &changed) {
+		t.Errorf("Expected a HostKeyChangedError for a client that missed the overlap, got %v", err)
+	}
+}
+
+func TestKnownHostsRotate(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(path, []byte("# servers\nother:1 "+strings.Repeat("03", 32)+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	kh, err := LoadKnownHosts(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	current, next, stranger := [32]byte{1}, [32]byte{2}, [32]byte{4}
+
+	if err := kh.Verify("example.com:1", current); err != nil {
+		t.Fatal(err)
+	}
+
+	// Only a pinned key vouches for a next one.
+	if err := kh.Rotate("example.com:1", stranger, next); err != nil {
+		t.Fatal(err)
+	}
+	if err := kh.Verify("example.com:1", next); err == nil {
+		t.Error("Expected a key vouched for by an unpinned one to be refused")
+	}
+
+	if err := kh.Rotate("example.com:1", current, next); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range [][32]byte{current, next} {
+		reloaded, err := LoadKnownHosts(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := reloaded.Verify("example.com:1", key); err != nil {
+			t.Errorf("Expected %x to be accepted during the rotation: %v", key, err)
+		}
+	}
+
+	if err := kh.Verify("example.com:1", next); err != nil {
+		t.Fatal(err)
+	}
+	if err := kh.Verify("example.com:1", current); err == nil {
+		t.Error("Expected the retired key to be refused")
+	}
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# servers\nother:1 " + strings.Repeat("03", 32) + "\nexample.com:1 02" + strings.Repeat("00", 31) + "\n"
+	if string(contents) != want {
+		t.Errorf("Expected the file\n%s\ngot\n%s", want, contents)
+	}
+}
@@ -0,0 +1,129 @@
+package securecomm
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+
+	"golang.org/x/crypto/nacl/box"
+	"golang.org/x/crypto/nacl/secretbox"
+)
+
+// sealedVersion starts every message sealed with SealForMany.
+const sealedVersion = 1
+
+// sealedWrapSize is the size of the content key wrapped for one
+// recipient.
+const sealedWrapSize = 32 + box.Overhead
+
+// maxSealedRecipients is how many recipients a message may be sealed
+// for, as their count travels in two bytes.
+const maxSealedRecipients = 1<<16 - 1
+
+// SealForMany encrypts msg once so that any of recipients can open it
+// with OpenSealed, and no one else. The message is sealed with a random
+// content key, which is then sealed for each recipient with a key
+// agreed between it and a key generated for the message, as in an
+// anonymous sealed box. Neither the sender nor the recipients can be
+// told from the result, only how many recipients there are.
+//
+// The result is the version, the generated public key, the number of
+// recipients and the content key wrapped for each, followed by the
+// nonce and the sealed message.
+func SealForMany(msg []byte, recipients []*[32]byte) ([]byte, error) {
+	if len(recipients) == 0 {
+		return nil, errors.New("seal: no recipients")
+	}
+	if len(recipients) > maxSealedRecipients {
+		return nil, fmt.Errorf("seal: %d recipients, more than %d", len(recipients), maxSealedRecipients)
+	}
+
+	ephemeralPub, ephemeralPriv, err := box.GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, fmt.Errorf("seal: %w", err)
+	}
+	var contentKey [32]byte
+	if _, err := io.ReadFull(rand.Reader, contentKey[:]); err != nil {
+		return nil, fmt.Errorf("seal: %w", err)
+	}
+
+	out := make([]byte, 0, 1+32+2+len(recipients)*sealedWrapSize+nonceSize+len(msg)+secretbox.Overhead)
+	out = append(out, sealedVersion)
+	out = append(out, ephemeralPub[:]...)
+	out = binary.BigEndian.AppendUint16(out, uint16(len(recipients)))
+	for _, recipient := range recipients {
+		var wrapKey [32]byte
+		box.Precompute(&wrapKey, recipient, ephemeralPriv)
+		out = box.SealAfterPrecomputation(out, contentKey[:], sealedWrapNonce(ephemeralPub, recipient), &wrapKey)
+	}
+
+	var nonce [nonceSize]byte
+	if _, err := io.ReadFull(rand.Reader, nonce[:]); err != nil {
+		return nil, fmt.Errorf("seal: %w", err)
+	}
+	out = append(out, nonce[:]...)
+
+	return secretbox.Seal(out, msg, &nonce, &contentKey), nil
+}
+
+// OpenSealed opens a message sealed with SealForMany for key, one of its
+// recipients, failing with ErrNotRecipient if it is not.
+func OpenSealed(sealed []byte, key IdentityKey) ([]byte, error) {
+	if len(sealed) < 1+32+2 || sealed[0] != sealedVersion {
+		return nil, errors.New("open sealed message: not a sealed message")
+	}
+	var ephemeralPub [32]byte
+	copy(ephemeralPub[:], sealed[1:])
+	count := int(binary.BigEndian.Uint16(sealed[1+32:]))
+	wraps, rest := sealed[1+32+2:], []byte(nil)
+	if len(wraps) < count*sealedWrapSize+nonceSize+secretbox.Overhead {
+		return nil, errors.New("open sealed message: truncated")
+	}
+	wraps, rest = wraps[:count*sealedWrapSize], wraps[count*sealedWrapSize:]
+
+	shared, err := precomputeWith(key, &ephemeralPub)
+	if err != nil {
+		return nil, fmt.Errorf("open sealed message: %w", err)
+	}
+	var wrapKey [32]byte
+	copy(wrapKey[:], shared)
+	nonce := sealedWrapNonce(&ephemeralPub, key.PublicKey())
+
+	// The wrapped keys do not say whom they are for, so try each.
+	for i := 0; i < count; i++ {
+		contentKey, ok := box.OpenAfterPrecomputation(nil, wraps[i*sealedWrapSize:(i+1)*sealedWrapSize], nonce, &wrapKey)
+		if !ok || len(contentKey) != 32 {
+			continue
+		}
+
+		var k [32]byte
+		copy(k[:], contentKey)
+		var messageNonce [nonceSize]byte
+		copy(messageNonce[:], rest)
+		msg, ok := secretbox.Open(nil, rest[nonceSize:], &messageNonce, &k)
+		if !ok {
+			return nil, fmt.Errorf("open sealed message: %w", ErrDecryptFailed)
+		}
+		return msg, nil
+	}
+
+	return nil, fmt.Errorf("open sealed message: %w", ErrNotRecipient)
+}
+
+// sealedWrapNonce returns the nonce the content key is wrapped for
+// recipient with. Each key generated for a message only wraps once for
+// each recipient, so it need not be random.
+func sealedWrapNonce(ephemeralPub, recipient *[32]byte) *[nonceSize]byte {
+	h := sha256.New()
+	h.Write([]byte("go-mentor sealed message"))
+	h.Write(ephemeralPub[:])
+	h.Write(recipient[:])
+
+	var nonce [nonceSize]byte
+	copy(nonce[:], h.Sum(nil))
+
+	return &nonce
+}
@@ -0,0 +1,89 @@
+package securecomm
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestSealForMany(t *testing.T) {
+	var keys []*KeyPair
+	var recipients []*[32]byte
+	for i := 0; i < 3; i++ {
+		key, err := GenerateKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+		keys = append(keys, key)
+		recipients = append(recipients, &key.Public)
+	}
+
+	msg := []byte("for your eyes only, and theirs")
+	sealed, err := SealForMany(msg, recipients)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(sealed, msg) {
+		t.Fatal("sealed message holds the plaintext")
+	}
+	for _, key := range keys {
+		if bytes.Contains(sealed, key.Public[:]) {
+			t.Fatal("sealed message names a recipient")
+		}
+	}
+
+	for i, key := range keys {
+		opened, err := OpenSealed(sealed, key)
+		if err != nil {
+			t.Fatalf("recipient %d: %v", i, err)
+		}
+		if !bytes.Equal(opened, msg) {
+			t.Fatalf("recipient %d opened %q, want %q", i, opened, msg)
+		}
+	}
+}
+
+func TestOpenSealedNotRecipient(t *testing.T) {
+	recipient, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sealed, err := SealForMany([]byte("hello"), []*[32]byte{&recipient.Public})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := OpenSealed(sealed, other); !errors.Is(err, ErrNotRecipient) {
+		t.Fatalf("got %v, want ErrNotRecipient", err)
+	}
+}
+
+func TestOpenSealedTampered(t *testing.T) {
+	recipient, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sealed, err := SealForMany([]byte("hello"), []*[32]byte{&recipient.Public})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tampered := append([]byte(nil), sealed...)
+	tampered[len(tampered)-1] ^= 1
+	if _, err := OpenSealed(tampered, recipient); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("tampered message: got %v, want ErrDecryptFailed", err)
+	}
+	if _, err := OpenSealed(sealed[:len(sealed)-20], recipient); err == nil {
+		t.Fatal("truncated message opened")
+	}
+}
+
+func TestSealForManyNoRecipients(t *testing.T) {
+	if _, err := SealForMany([]byte("hello"), nil); err == nil {
+		t.Fatal("sealed a message for no one")
+	}
+}
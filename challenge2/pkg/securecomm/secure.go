@@ -0,0 +1,868 @@
+// Package securecomm implements an encrypted, authenticated channel over
+// any reliable stream: SecureReader and SecureWriter seal and open its
+// frames, Dial and Server run the handshake that keys them, and the
+// rest builds chat, file transfer, relaying and mail on SecureConn.
+package securecomm
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// DefaultMaxMessageSize is the largest frame payload a SecureReader or
+// SecureWriter accepts when its MaxMessageSize is zero.
+const DefaultMaxMessageSize = 32 * 1024
+
+// reassembledFrames is how many frames of MaxMessageSize a message
+// ReadMsg reassembles may span when the reader's MaxReassembledSize is
+// zero.
+const reassembledFrames = 1024
+
+// A SecureReader reads and decrypts encrypted messages.
+type SecureReader struct {
+	// lastFrame is when the last authenticated frame arrived, in Unix
+	// nanoseconds, bytes and frames how many bytes of frames and frames
+	// were read, rekeys how often the peer replaced the key, and
+	// maxSize, once SecureConn.SetMaxMessageSize set it during reads,
+	// the limit that replaces MaxMessageSize. They are accessed
+	// atomically, so they come first to be aligned for that everywhere.
+	lastFrame int64
+	bytes     int64
+	frames    int64
+	rekeys    int64
+	maxSize   int64
+
+	io.Reader
+
+	// mu is held for the length of each read, so that wiping the reader
+	// waits for one in progress.
+	mu sync.Mutex
+
+	// metrics, if set, counts the frames read.
+	metrics *Metrics
+
+	// tracer, if set, traces the frames read.
+	tracer *frameTracer
+
+	key   [32]byte
+	suite CipherSuite
+
+	// keyed, if set, is called whenever key changes, for a Capture to
+	// record it. replayed marks a reader Replay feeds a capture
+	// through, which takes its keys from the capture rather than from
+	// rekey frames.
+	keyed    func()
+	replayed bool
+
+	// clock tells the time frames arrive, the system clock when nil.
+	clock Clock
+
+	// MaxMessageSize is the largest frame payload, in bytes of
+	// plaintext, the reader accepts. Larger frames fail with
+	// ErrMessageTooLarge before anything is allocated for them. Messages
+	// split across several frames may be larger. Zero means
+	// DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// MaxReassembledSize is the largest message, in bytes of plaintext,
+	// ReadMsg reassembles from several frames. A message that grows
+	// past it fails with ErrMessageTooLarge, as does every read after,
+	// since the rest of it would be taken for the next message. Zero
+	// means 1024 times MaxMessageSize.
+	MaxReassembledSize int
+
+	// plaintext holds the most recently decrypted frame and unread is
+	// the part of it not yet returned by Read. more records whether the
+	// message that frame belongs to continues in the next frame.
+	plaintext []byte
+	unread    []byte
+	more      bool
+
+	// closed records that the writer ended the stream with a close
+	// frame.
+	closed bool
+
+	// header, nonce and aead are kept between frames to avoid
+	// allocating them for each one.
+	header [frameHeaderSize]byte
+	nonce  [nonceSize]byte
+	aead   aeadCache
+
+	// A read cut short part way through a frame, as by a read deadline,
+	// leaves what arrived of it here: headerN bytes of the header, and
+	// bodyN bytes of the sealed box in body once the header is whole.
+	// The next read picks up from there instead of out of step with the
+	// stream.
+	headerN, bodyN int
+	body           *[]byte
+
+	// headerAt is when the header of the last frame was read whole, from
+	// which a rejected frame's teardown is timed.
+	headerAt time.Time
+
+	// assembled holds the frames of a message ReadMsg is reassembling,
+	// kept across a read cut short between them.
+	assembled []byte
+
+	// inflate decompresses compressed frames.
+	inflate decompressor
+
+	// seq is the sequence number the next frame must carry, and
+	// keyFrames how many frames were opened with the current key.
+	seq       uint64
+	keyFrames int64
+
+	// priv is our private key, needed to follow the peer's rekey
+	// frames. It is nil for readers that were not set up by a
+	// handshake. ownsPriv says whether it was made for this reader
+	// alone, to be wiped along with it.
+	priv     IdentityKey
+	ownsPriv bool
+
+	// control is told about ping, pong and close frames as they
+	// arrive. Readers that were not set up by a handshake have none and
+	// ignore pings and pongs.
+	control func(flags byte, payload []byte) error
+
+	// limit, if set, is consulted for each data frame with the size of
+	// its payload and whether it ends a message, and fails the read if
+	// it returns an error.
+	limit func(n int, last bool) error
+
+	// closeErr is what reads return once the close frame arrived.
+	closeErr error
+}
+
+// NewSecureReader creates a new SecureReader.
+func NewSecureReader(r io.Reader, priv *[32]byte, pub *[32]byte) *SecureReader {
+	sr := &SecureReader{Reader: r}
+	box.Precompute(&sr.key, pub, priv)
+	return sr
+}
+
+// newSecureReader creates a SecureReader that opens frames with a key
+// agreed on during a handshake. priv is our private key, used to follow
+// the peer's rekeys.
+func newSecureReader(r io.Reader, key *[32]byte, priv IdentityKey) *SecureReader {
+	return &SecureReader{Reader: r, key: *key, priv: priv}
+}
+
+// A DecryptError is returned when a frame fails to decrypt, because it
+// was corrupted or forged or sealed with another key, or holds a
+// malformed payload once opened. It unwraps to ErrDecryptFailed.
+type DecryptError struct {
+	// Frame is the number of the frame since the handshake, counting
+	// from zero, and Offset where it starts in the stream, in bytes.
+	Frame, Offset int64
+
+	// Reason says what was wrong with it.
+	Reason string
+}
+
+func (e *DecryptError) Error() string {
+	return fmt.Sprintf("frame %d at byte %d: %s: %v", e.Frame, e.Offset, e.Reason, ErrDecryptFailed)
+}
+
+func (e *DecryptError) Unwrap() error {
+	return ErrDecryptFailed
+}
+
+// Each encrypted message travels in its own frame: a header holding the
+// length of the sealed box and the nonce it was sealed with, followed by
+// the sealed box itself. The explicit length lets the reader collect the
+// whole box even when the network splits it across several reads.
+//
+// The first byte of every sealed box is a set of frame flags, so they
+// are authenticated along with the payload that follows them.
+//
+// The nonce is random apart from its last eight bytes, which hold the
+// frame's sequence number. Since the nonce is bound into the box, a
+// frame cannot be replayed or moved to another position in the stream
+// without the reader noticing.
+const (
+	nonceSize       = 24
+	frameHeaderSize = 4 + nonceSize
+	frameFlagsSize  = 1
+	seqOffset       = nonceSize - 8
+)
+
+// Frame flags.
+const (
+	// flagMore marks a frame whose message continues in the next frame.
+	flagMore byte = 1 << iota
+
+	// flagRekey marks a control frame carrying the writer's next
+	// ephemeral public key rather than application data.
+	flagRekey
+
+	// flagPadded marks a frame whose payload is preceded by its length
+	// and followed by padding.
+	flagPadded
+
+	// flagClose marks the writer's last frame. Unlike the end of the
+	// underlying stream, it cannot be forged by cutting the connection.
+	flagClose
+
+	// flagCompressed marks a frame whose payload is compressed.
+	flagCompressed
+
+	// flagPing marks a control frame asking the reader to send its
+	// payload straight back in a flagPong frame, proving that it is
+	// still there.
+	flagPing
+	flagPong
+
+	// flagAck on the last frame of a message asks the reader to
+	// acknowledge it once decrypted, which it does with a flagPong frame
+	// that also has flagAck set and carries the frame's sequence number.
+	flagAck
+)
+
+func maxMessageSize(configured int) int {
+	if configured > 0 {
+		return configured
+	}
+
+	return DefaultMaxMessageSize
+}
+
+// maxMessageSize returns the largest frame payload sr accepts.
+func (sr *SecureReader) maxMessageSize() int {
+	if n := atomic.LoadInt64(&sr.maxSize); n > 0 {
+		return int(n)
+	}
+
+	return maxMessageSize(sr.MaxMessageSize)
+}
+
+// Read will read the given encrypted message and attempt to decrypt it.
+// A message larger than the given buffer is kept and returned across
+// as many calls as it takes, like a bufio.Reader.
+func (sr *SecureReader) Read(message []byte) (int, error) {
+	if len(message) == 0 {
+		return 0, nil
+	}
+
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	for len(sr.unread) == 0 {
+		if err := sr.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(message, sr.unread)
+	sr.unread = sr.unread[n:]
+
+	return n, nil
+}
+
+// ReadMsg reads and decrypts exactly one message, however large,
+// reassembling it from as many frames as the writer split it into. If an
+// earlier Read consumed only part of a message, the rest of that message
+// is returned. The returned slice belongs to the caller.
+func (sr *SecureReader) ReadMsg() ([]byte, error) {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	if len(sr.unread) == 0 && !sr.more {
+		if err := sr.readFrame(); err != nil {
+			return nil, err
+		}
+	}
+
+	sr.assembled = append(sr.assembled, sr.unread...)
+	sr.unread = nil
+
+	limit := sr.MaxReassembledSize
+	if limit <= 0 {
+		limit = reassembledFrames * sr.maxMessageSize()
+	}
+	for sr.more {
+		if err := sr.readFrame(); err != nil {
+			if err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, fmt.Errorf("read continuation frame: %w", err)
+		}
+		if len(sr.assembled)+len(sr.unread) > limit {
+			sr.assembled, sr.unread = nil, nil
+			sr.closed = true
+			sr.closeErr = fmt.Errorf("reassemble message of more than %d bytes: %w", limit, ErrMessageTooLarge)
+			return nil, sr.closeErr
+		}
+		sr.assembled = append(sr.assembled, sr.unread...)
+		sr.unread = nil
+	}
+
+	message := sr.assembled
+	sr.assembled = nil
+
+	return message, nil
+}
+
+// readFrame reads and decrypts the next data frame into unread,
+// replacing whatever was left of the previous one. Control frames are
+// handled along the way and never surface to the caller.
+func (sr *SecureReader) readFrame() error {
+	if sr.closed {
+		return sr.closeErr
+	}
+
+	for {
+		control, err := sr.readOneFrame()
+		if err != nil || !control {
+			return err
+		}
+	}
+}
+
+// readOneFrame reads and decrypts a single frame. It reports whether
+// the frame was a control frame, which has already been acted on.
+func (sr *SecureReader) readOneFrame() (control bool, err error) {
+	header := sr.header[:]
+	if err := sr.fill(header, &sr.headerN); err != nil {
+		// A clean end of stream between frames is reported as a bare
+		// io.EOF, as io.Reader callers like io.Copy expect.
+		if err == io.EOF {
+			return false, io.EOF
+		}
+		return false, fmt.Errorf("read frame header: %w", err)
+	}
+	if sr.body == nil {
+		sr.headerAt = sr.now()
+	}
+
+	nonce := &sr.nonce
+	copy(nonce[:], header[4:])
+
+	// The counts only take in the frame once it is read whole, so for
+	// now they say where it starts.
+	frame, offset := atomic.LoadInt64(&sr.frames), atomic.LoadInt64(&sr.bytes)
+	decryptErr := func(format string, args ...interface{}) error {
+		return &DecryptError{Frame: frame, Offset: offset, Reason: fmt.Sprintf(format, args...)}
+	}
+
+	boxSize := binary.BigEndian.Uint32(header[:4])
+	if boxSize < box.Overhead+frameFlagsSize {
+		return false, decryptErr("frame of %d bytes is too small to hold a message", boxSize)
+	}
+	if payloadSize := int64(boxSize) - box.Overhead - frameFlagsSize; payloadSize > int64(sr.maxMessageSize()) {
+		return false, fmt.Errorf("read message of %d bytes: %w", payloadSize, ErrMessageTooLarge)
+	}
+
+	if sr.body == nil {
+		sr.body = getBuffer(int(boxSize))
+	}
+	if err := sr.fill(*sr.body, &sr.bodyN); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return false, fmt.Errorf("read message: %w", err)
+	}
+	buf := sr.body
+	sr.body, sr.headerN, sr.bodyN = nil, 0, 0
+	defer putBuffer(buf)
+	atomic.AddInt64(&sr.bytes, int64(frameHeaderSize)+int64(boxSize))
+	atomic.AddInt64(&sr.frames, 1)
+	if sr.metrics != nil {
+		sr.metrics.decrypted(frameHeaderSize + int(boxSize))
+	}
+	if span := sr.tracer.start("securecomm.frame.read", frame, frameHeaderSize+int(boxSize)); span != nil {
+		defer func() { span.End(err) }()
+	}
+
+	dec, ok := sr.suite.open(sr.plaintext[:0], *buf, nonce, &sr.key, &sr.aead)
+	if !ok {
+		return false, decryptErr("open message")
+	}
+	sr.plaintext = dec
+
+	if seq := binary.BigEndian.Uint64(nonce[seqOffset:]); seq != sr.seq {
+		return false, fmt.Errorf("frame %d received, expected %d: %w", seq, sr.seq, ErrReplayed)
+	}
+	sr.seq++
+	if sr.keyFrames++; sr.keyFrames > keyFrameLimit {
+		return false, fmt.Errorf("more than %d frames opened with one key: %w", keyFrameLimit, ErrNonceExhausted)
+	}
+	atomic.StoreInt64(&sr.lastFrame, sr.now().UnixNano())
+
+	payload := dec[frameFlagsSize:]
+	if dec[0]&flagPadded != 0 {
+		if len(payload) < paddedLengthSize {
+			return false, decryptErr("padded frame of %d bytes is too small to hold its length", len(payload))
+		}
+		n := binary.BigEndian.Uint32(payload)
+		if int64(n) > int64(len(payload)-paddedLengthSize) {
+			return false, decryptErr("padded frame claims %d bytes of payload but holds %d", n, len(payload)-paddedLengthSize)
+		}
+		payload = payload[paddedLengthSize : paddedLengthSize+int(n)]
+	}
+
+	if dec[0]&flagCompressed != 0 {
+		var err error
+		if payload, err = sr.inflate.decompress(payload, sr.maxMessageSize()); err != nil {
+			return false, err
+		}
+	}
+
+	if dec[0]&flagClosing == flagClosing {
+		if sr.control != nil {
+			if err := sr.control(flagClosing, payload); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	if dec[0]&flagClose != 0 {
+		sr.closed = true
+		sr.closeErr = io.EOF
+		if len(payload) > 0 {
+			switch payload[0] {
+			case closeReasonRateLimited:
+				sr.closeErr = ErrRateLimited
+			case closeReasonRejected:
+				sr.closeErr = ErrFrameRejected
+			case closeReasonLifetime:
+				sr.closeErr = ErrMaxLifetime
+			}
+		}
+		if sr.control != nil {
+			if err := sr.control(flagClose, nil); err != nil {
+				return false, err
+			}
+		}
+		return false, sr.closeErr
+	}
+
+	if dec[0]&(flagPing|flagPong) != 0 {
+		if sr.control != nil {
+			if err := sr.control(dec[0]&(flagPing|flagPong|flagAck), payload); err != nil {
+				return false, err
+			}
+		}
+		return true, nil
+	}
+
+	if dec[0]&flagRekey != 0 {
+		if err := sr.rekey(payload); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+
+	if sr.limit != nil {
+		if err := sr.limit(len(payload), dec[0]&flagMore == 0); err != nil {
+			return false, err
+		}
+	}
+
+	sr.more = dec[0]&flagMore != 0
+	sr.unread = payload
+
+	if dec[0]&flagAck != 0 && sr.control != nil {
+		if err := sr.control(flagAck, nonce[seqOffset:]); err != nil {
+			return false, err
+		}
+	}
+
+	return false, nil
+}
+
+// fill reads into buf from *n on until it is full, adding what arrives
+// to *n, so that a read cut short can be taken up again where it
+// stopped. Like io.ReadFull, it fails with io.EOF only if nothing of buf
+// arrived, and with io.ErrUnexpectedEOF if some did.
+func (sr *SecureReader) fill(buf []byte, n *int) error {
+	for *n < len(buf) {
+		m, err := sr.Reader.Read(buf[*n:])
+		*n += m
+		if err != nil {
+			if err == io.EOF && *n > 0 {
+				if *n >= len(buf) {
+					return nil
+				}
+				err = io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// A SecureWriter writes encrypted messages. It is safe for concurrent
+// use: each call to Write, WriteMsg or Close sends its frames without
+// any from another call in between. The exported fields must not be
+// changed while it is in use.
+type SecureWriter struct {
+	// lastFrame is when the last frame was sent, in Unix nanoseconds,
+	// bytes and frames how many bytes of frames and frames were
+	// written, and rekeys how often the writer replaced its key. They
+	// are accessed atomically, so they come first to be aligned for
+	// that everywhere.
+	lastFrame int64
+	bytes     int64
+	frames    int64
+	rekeys    int64
+
+	io.Writer
+
+	// metrics, if set, counts the frames written.
+	metrics *Metrics
+
+	// tracer, if set, traces the frames written.
+	tracer *frameTracer
+
+	key   [32]byte
+	suite CipherSuite
+
+	// keyed, if set, is called whenever key changes, for a Capture to
+	// record it.
+	keyed func()
+
+	// clock tells the time frames are sent and when to rekey, the
+	// system clock when nil.
+	clock Clock
+
+	// mu serializes writes, which must not interleave frames or reuse
+	// sequence numbers.
+	mu sync.Mutex
+
+	// MaxMessageSize is the largest frame payload, in bytes, the writer
+	// sends. Larger writes are split across several frames. Zero means
+	// DefaultMaxMessageSize.
+	MaxMessageSize int
+
+	// Rekey says when the writer replaces its key. It only takes
+	// effect for writers set up by a handshake, which know the peer's
+	// public key.
+	Rekey RekeyPolicy
+
+	// Padding says how frames are padded to hide message lengths.
+	Padding PaddingPolicy
+
+	// Compress compresses the payload of each frame it makes smaller.
+	// Only set it when the peer's SecureReader understands compressed
+	// frames.
+	Compress bool
+
+	// Rand is the source of nonces, rekey keys and random padding. Nil
+	// means crypto/rand.Reader. Only tests should set it.
+	Rand io.Reader
+
+	// seq is the sequence number of the next frame.
+	seq uint64
+
+	// peer is the peer's public key, used to rekey, and usage counts
+	// what has been sent with the current key. peerRekeys says whether
+	// the peer understands rekey frames, so that the writer may rekey
+	// before it runs out of nonces even if its Rekey policy never would.
+	peer       *[32]byte
+	usage      keyUsage
+	peerRekeys bool
+
+	// closed records that the close frame was sent.
+	closed bool
+
+	// broken is the error a write failed with part way through a frame,
+	// as on a write deadline. That leaves the stream out of step for
+	// good, so every later write fails with it too.
+	broken error
+
+	// nonce and aead are kept between frames to avoid allocating them
+	// for each one.
+	nonce [nonceSize]byte
+	aead  aeadCache
+
+	// deflate compresses frames when Compress is set.
+	deflate compressor
+}
+
+// NewSecureWriter creates a new SecureWriter
+func NewSecureWriter(w io.Writer, priv *[32]byte, pub *[32]byte) *SecureWriter {
+	sw := &SecureWriter{Writer: w}
+	box.Precompute(&sw.key, pub, priv)
+	return sw
+}
+
+// newSecureWriter creates a SecureWriter that seals frames with a key
+// agreed on during a handshake. peer is the peer's public key, used to
+// rekey.
+func newSecureWriter(w io.Writer, key *[32]byte, peer *[32]byte) *SecureWriter {
+	return &SecureWriter{Writer: w, key: *key, peer: peer}
+}
+
+// Write will encrypt the given bytes to the writer. Messages larger than
+// MaxMessageSize are split across several frames, which the peer's
+// SecureReader joins back together.
+func (sw *SecureWriter) Write(message []byte) (int, error) {
+	return sw.write(message, nil)
+}
+
+// write is Write, but when acked is not nil it asks the peer to
+// acknowledge the message, first passing acked the sequence number of
+// the frame the acknowledgement will name.
+func (sw *SecureWriter) write(message []byte, acked func(seq uint64)) (int, error) {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return 0, ErrWriteClosed
+	}
+
+	limit := maxMessageSize(sw.MaxMessageSize)
+	if sw.pads() {
+		limit -= paddedLengthSize
+	}
+
+	var written int
+	for {
+		chunk, flags := message[written:], byte(0)
+		if len(chunk) > limit {
+			chunk, flags = chunk[:limit], flagMore
+		}
+
+		if sw.rekeyDue(sw.now()) {
+			if err := sw.rekey(); err != nil {
+				return written, err
+			}
+		}
+
+		if flags&flagMore == 0 && acked != nil {
+			flags |= flagAck
+			acked(sw.seq)
+		}
+
+		if err := sw.writeFrame(flags, chunk); err != nil {
+			return written, err
+		}
+		written += len(chunk)
+
+		if flags&flagMore == 0 {
+			return written, nil
+		}
+	}
+}
+
+// writeFrame seals the flags and payload into a single frame and writes
+// it with one call to the underlying writer.
+func (sw *SecureWriter) writeFrame(flags byte, payload []byte) error {
+	buf := getBuffer(sw.payloadOffset())
+	defer putBuffer(buf)
+	*buf = append(*buf, payload...)
+
+	return sw.sealFrame(flags, *buf)
+}
+
+func (sw *SecureWriter) random() io.Reader {
+	if sw.Rand != nil {
+		return sw.Rand
+	}
+
+	return rand.Reader
+}
+
+// payloadOffset returns where the payload starts in a frame's
+// plaintext, after the flags and, for padded frames, its length.
+func (sw *SecureWriter) payloadOffset() int {
+	if sw.pads() {
+		return frameFlagsSize + paddedLengthSize
+	}
+
+	return frameFlagsSize
+}
+
+// sealFrame compresses the payload in plaintext, fills in the flags
+// and payload length that precede it, pads it, and seals and writes the
+// frame.
+func (sw *SecureWriter) sealFrame(flags byte, plaintext []byte) error {
+	if sw.broken != nil {
+		return sw.broken
+	}
+	if sw.usage.frames >= keyFrameLimit {
+		sw.broken = fmt.Errorf("%d frames sealed with one key: %w", sw.usage.frames, ErrNonceExhausted)
+		return sw.broken
+	}
+
+	// The plaintext is staged in a pooled buffer, which must not carry
+	// it on to its next user.
+	defer func() { clear(plaintext) }()
+
+	offset := sw.payloadOffset()
+	payload := plaintext[offset:]
+
+	if sw.Compress && flags&(flagRekey|flagPing|flagPong) == 0 && len(payload) > 0 {
+		compressed, err := sw.deflate.compress(payload)
+		if err != nil {
+			return fmt.Errorf("compress frame: %w", err)
+		}
+		if len(compressed) < len(payload) {
+			plaintext = plaintext[:offset+copy(payload, compressed)]
+			payload = plaintext[offset:]
+			flags |= flagCompressed
+		}
+	}
+
+	nonce := &sw.nonce
+	if _, err := io.ReadFull(sw.random(), nonce[:seqOffset]); err != nil {
+		return err
+	}
+	binary.BigEndian.PutUint64(nonce[seqOffset:], sw.seq)
+	sw.seq++
+
+	var padding int
+	if sw.pads() {
+		var err error
+		if padding, err = sw.Padding.padding(paddedLengthSize+len(payload), maxMessageSize(sw.MaxMessageSize), sw.random()); err != nil {
+			return err
+		}
+		flags |= flagPadded
+	}
+
+	plaintext[0] = flags
+	if flags&flagPadded != 0 {
+		binary.BigEndian.PutUint32(plaintext[frameFlagsSize:], uint32(len(payload)))
+	}
+	for i := 0; i < padding; i++ {
+		plaintext = append(plaintext, 0)
+	}
+
+	frameBuf := getBuffer(frameHeaderSize)
+	defer putBuffer(frameBuf)
+	frame := *frameBuf
+	binary.BigEndian.PutUint32(frame, uint32(len(plaintext)+box.Overhead))
+	copy(frame[4:], nonce[:])
+	frame = sw.suite.seal(frame, plaintext, nonce, &sw.key, &sw.aead)
+	*frameBuf = frame
+
+	span := sw.tracer.start("securecomm.frame.write", atomic.LoadInt64(&sw.frames), len(frame))
+	n, err := sw.Writer.Write(frame)
+	endSpan(span, err)
+	if err != nil {
+		if n == 0 {
+			// Nothing of the frame went out, so the next one can
+			// take its sequence number and the stream stays whole.
+			sw.seq--
+		} else {
+			sw.broken = fmt.Errorf("write cut short part way through a frame: %w", err)
+		}
+		return err
+	}
+	sw.usage.add(len(payload))
+	atomic.AddInt64(&sw.bytes, int64(len(frame)))
+	atomic.AddInt64(&sw.frames, 1)
+	if sw.metrics != nil {
+		sw.metrics.encrypted(len(frame))
+	}
+	atomic.StoreInt64(&sw.lastFrame, sw.now().UnixNano())
+
+	return nil
+}
+
+// pads reports whether frames are padded. Padding is skipped when
+// MaxMessageSize leaves no room for the payload length it needs.
+func (sw *SecureWriter) pads() bool {
+	return sw.Padding.enabled() && maxMessageSize(sw.MaxMessageSize) > paddedLengthSize
+}
+
+// Close sends a close frame, after which the peer's SecureReader reports
+// io.EOF, and refuses further writes. It does not close the underlying
+// writer.
+func (sw *SecureWriter) Close() error {
+	return sw.close(nil)
+}
+
+// close sends the close frame, carrying reason, which says why the
+// stream ended if it is not empty.
+func (sw *SecureWriter) close(reason []byte) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return nil
+	}
+
+	if err := sw.writeFrame(flagClose, reason); err != nil {
+		return fmt.Errorf("write close frame: %w", err)
+	}
+	sw.closed = true
+
+	return nil
+}
+
+// writeControl sends a control frame carrying payload. It fails with
+// ErrWriteClosed once the close frame was sent, since the peer reads no
+// further frames.
+func (sw *SecureWriter) writeControl(flags byte, payload []byte) error {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	if sw.closed {
+		return ErrWriteClosed
+	}
+
+	return sw.writeFrame(flags, payload)
+}
+
+// WriteMsg encrypts and writes message as a single message, which the
+// peer's ReadMsg returns whole however many frames it spans.
+func (sw *SecureWriter) WriteMsg(message []byte) error {
+	_, err := sw.Write(message)
+	return err
+}
+
+// Dial creates a secure connection on the given address
+func Dial(addr string, opts ...Option) (*SecureConn, error) {
+	var d Dialer
+	return d.Dial(addr, opts...)
+}
+
+// DialContext creates a secure connection on the given address, giving
+// up as soon as ctx is done.
+func DialContext(ctx context.Context, addr string, opts ...Option) (*SecureConn, error) {
+	var d Dialer
+	return d.DialContext(ctx, addr, opts...)
+}
+
+// verifyHost checks the server's identity against known hosts.
+func verifyHost(sc *SecureConn, addr string, kh *KnownHosts) error {
+	identity, ok := sc.PeerIdentity()
+	if !ok {
+		return fmt.Errorf("verify %s: %w", addr, ErrNoPeerIdentity)
+	}
+
+	return kh.Verify(addr, identity)
+}
+
+// Serve starts a secure server on the given listener, passing each
+// connection to handler, or EchoHandler when nil.
+func Serve(l net.Listener, handler Handler, opts ...Option) error {
+	s := &Server{Handler: handler, Options: opts}
+	return s.Serve(l)
+}
+
+// authorize checks the client's identity against the authorized keys.
+func authorize(sc *SecureConn, ak *AuthorizedKeys) error {
+	identity, ok := sc.PeerIdentity()
+	if !ok {
+		return ErrNoPeerIdentity
+	}
+
+	if !ak.Allowed(identity) {
+		return fmt.Errorf("%s: %w", Fingerprint(identity), ErrUnauthorizedKey)
+	}
+
+	return nil
+}
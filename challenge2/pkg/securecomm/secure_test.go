@@ -0,0 +1,836 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"testing/iotest"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/errcode"
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+	"golang.org/x/crypto/nacl/box"
+)
+
+func TestReadWriterPing(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	r, w := io.Pipe()
+	secureR := NewSecureReader(r, priv, pub)
+	secureW := NewSecureWriter(w, priv, pub)
+
+	// Encrypt hello world
+	go func() {
+		fmt.Fprintf(secureW, "hello world\n")
+		w.Close()
+	}()
+
+	// Decrypt message
+	buf := make([]byte, 1024)
+	n, err := secureR.Read(buf)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	buf = buf[:n]
+
+	// Make sure we have hello world back
+	if res := string(buf); res != "hello world\n" {
+		t.Fatalf("Unexpected result: %s != %s", res, "hello world")
+	}
+}
+
+func TestSecureWriter(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	r, w := io.Pipe()
+	secureW := NewSecureWriter(w, priv, pub)
+
+	// Make sure we are secure
+	// Encrypt hello world
+	go func() {
+		fmt.Fprintf(secureW, "hello world\n")
+		w.Close()
+	}()
+
+	// Read from the underlying transport instead of the decoder
+	buf, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make sure we dont' read the plain text message.
+	if res := string(buf); res == "hello world\n" {
+		t.Fatal("Unexpected result. The message is not encrypted.")
+	}
+
+	r, w = io.Pipe()
+	secureW = NewSecureWriter(w, priv, pub)
+
+	// Make sure we are unique
+	// Encrypt hello world
+	go func() {
+		fmt.Fprintf(secureW, "hello world\n")
+		w.Close()
+	}()
+
+	// Read from the underlying transport instead of the decoder
+	buf2, err := ioutil.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Make sure we dont' read the plain text message.
+	if string(buf) == string(buf2) {
+		t.Fatal("Unexpected result. The encrypted message is not unique.")
+	}
+
+}
+
+func TestSecureServe(t *testing.T) {
+	// Create a random listener
+	l := testutil.Listen(t)
+
+	// Start the server
+	go Serve(l, nil)
+
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	unexpected := "hello world\n"
+	if _, err := fmt.Fprintf(conn, unexpected); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, 2048)
+	n, err := conn.Read(buf)
+	if err != nil && err != io.EOF {
+		t.Fatal(err)
+	}
+	if got := string(buf[:n]); got == unexpected {
+		t.Fatalf("Unexpected result:\nGot raw data instead of serialized key")
+	}
+}
+
+func TestSecureDial(t *testing.T) {
+	// Create a random listener
+	l := testutil.Listen(t)
+
+	// Start the server
+	go func(l net.Listener) {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				defer c.Close()
+				pub, priv, err := box.GenerateKey(rand.Reader)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if _, err := handshake(c, pub, priv, true, config{}); err != nil {
+					t.Error(err)
+					return
+				}
+				buf := make([]byte, 2048)
+				n, err := c.Read(buf)
+				if err != nil && err != io.EOF {
+					t.Error(err)
+					return
+				}
+				if got := string(buf[:n]); got == "hello world\n" {
+					t.Error("Unexpected result. Got raw data instead of encrypted")
+				}
+			}(conn)
+		}
+	}(l)
+
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	expected := "hello world\n"
+	if _, err := fmt.Fprintf(conn, expected); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServeAbruptDisconnect(t *testing.T) {
+	l := testutil.Listen(t)
+
+	errs := make(chan error, 1)
+	go Serve(l, nil, WithErrorHandler(func(addr net.Addr, err error) {
+		errs <- err
+	}))
+
+	disconnects := []struct {
+		name       string
+		disconnect func(addr string) error
+	}{
+		{"before the preamble", func(addr string) error {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				return err
+			}
+			return conn.Close()
+		}},
+		{"mid-preamble", func(addr string) error {
+			conn, err := net.Dial("tcp", addr)
+			if err != nil {
+				return err
+			}
+			if _, err := conn.Write(make([]byte, 10)); err != nil {
+				return err
+			}
+			return conn.Close()
+		}},
+		{"mid-frame", func(addr string) error {
+			conn, err := Dial(addr)
+			if err != nil {
+				return err
+			}
+			// A length prefix promising more than ever arrives.
+			if _, err := conn.conn.Write([]byte{0, 0, 1, 0, 'x'}); err != nil {
+				return err
+			}
+			return conn.conn.Close()
+		}},
+	}
+
+	for _, test := range disconnects {
+		if err := test.disconnect(l.Addr().String()); err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		select {
+		case err := <-errs:
+			if err == nil {
+				t.Errorf("%s: expected an error, got nil", test.name)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%s: the error handler was not called", test.name)
+		}
+	}
+
+	// The server is still accepting.
+	conn, err := Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.Write([]byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	buf := make([]byte, len("still here"))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	if string(buf) != "still here" {
+		t.Fatalf("Unexpected echo %q", buf)
+	}
+}
+
+func TestReadWriterSegmented(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	// Deliver the frame one byte at a time, as a congested TCP
+	// connection might.
+	r, w := io.Pipe()
+	secureR := NewSecureReader(iotest.OneByteReader(r), priv, pub)
+	secureW := NewSecureWriter(w, priv, pub)
+
+	messages := []string{"hello world\n", "a second message", strings.Repeat("long ", 1000)}
+	go func() {
+		for _, message := range messages {
+			fmt.Fprint(secureW, message)
+		}
+		w.Close()
+	}()
+
+	buf := make([]byte, 8192)
+	for _, expected := range messages {
+		n, err := secureR.Read(buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(buf[:n]); got != expected {
+			t.Fatalf("Unexpected result: %q != %q", got, expected)
+		}
+	}
+
+	if _, err := secureR.Read(buf); err != io.EOF {
+		t.Fatalf("Expected io.EOF after the last message, got %v", err)
+	}
+}
+
+func TestReadSmallBuffer(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	r, w := io.Pipe()
+	secureR := NewSecureReader(r, priv, pub)
+	secureW := NewSecureWriter(w, priv, pub)
+
+	expected := strings.Repeat("0123456789abcdef", 256)
+	go func() {
+		fmt.Fprint(secureW, expected)
+		fmt.Fprint(secureW, "tail")
+		w.Close()
+	}()
+
+	// Read the 4KB message and the short one that follows it through a
+	// 512 byte buffer.
+	var got strings.Builder
+	buf := make([]byte, 512)
+	for {
+		n, err := secureR.Read(buf)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n > len(buf) {
+			t.Fatalf("Read returned %d bytes into a %d byte buffer", n, len(buf))
+		}
+		got.Write(buf[:n])
+	}
+
+	if got.String() != expected+"tail" {
+		t.Fatalf("Unexpected result: got %d bytes, expected %d", got.Len(), len(expected)+4)
+	}
+}
+
+func TestMaxMessageSize(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	secureW.MaxMessageSize = 1 << 20
+	if _, err := secureW.Write(make([]byte, DefaultMaxMessageSize+1)); err != nil {
+		t.Fatal(err)
+	}
+
+	// The reader still has the default limit and must refuse the frame.
+	secureR := NewSecureReader(&buf, priv, pub)
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Expected ErrMessageTooLarge reading past the limit, got %v", err)
+	}
+}
+
+func TestMaxReassembledSize(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	// A writer that never finishes its message.
+	r, w := io.Pipe()
+	defer r.Close()
+	go func() {
+		secureW := NewSecureWriter(w, priv, pub)
+		for secureW.writeFrame(flagMore, make([]byte, 1024)) == nil {
+		}
+	}()
+
+	secureR := NewSecureReader(r, priv, pub)
+	secureR.MaxMessageSize = 1024
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Expected ErrMessageTooLarge reassembling endless frames, got %v", err)
+	}
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Errorf("Expected ErrMessageTooLarge to stick, got %v", err)
+	}
+
+	// MaxReassembledSize lowers the limit.
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	if err := secureW.WriteMsg(make([]byte, 3*DefaultMaxMessageSize)); err != nil {
+		t.Fatal(err)
+	}
+	secureR = NewSecureReader(&buf, priv, pub)
+	secureR.MaxReassembledSize = 2 * DefaultMaxMessageSize
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Expected ErrMessageTooLarge past MaxReassembledSize, got %v", err)
+	}
+}
+
+func TestOversizedLengthPrefix(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	// A forged header announcing a 4GB frame must be rejected from the
+	// header alone.
+	header := make([]byte, frameHeaderSize)
+	binary.BigEndian.PutUint32(header, math.MaxUint32)
+
+	secureR := NewSecureReader(bytes.NewReader(header), priv, pub)
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrMessageTooLarge) {
+		t.Fatalf("Expected ErrMessageTooLarge, got %v", err)
+	}
+}
+
+func TestChunkedWrite(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	expected := make([]byte, 10<<20)
+	for i := range expected {
+		expected[i] = byte(i * 7)
+	}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	if n, err := secureW.Write(expected); err != nil || n != len(expected) {
+		t.Fatalf("Write returned %d, %v", n, err)
+	}
+	if err := secureW.WriteMsg([]byte("next")); err != nil {
+		t.Fatal(err)
+	}
+
+	secureR := NewSecureReader(bytes.NewReader(buf.Bytes()), priv, pub)
+	message, err := secureR.ReadMsg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(message, expected) {
+		t.Fatalf("Unexpected result: got %d bytes, expected %d", len(message), len(expected))
+	}
+
+	if next, err := secureR.ReadMsg(); err != nil || string(next) != "next" {
+		t.Fatalf("Unexpected message after chunked write: %q, %v", next, err)
+	}
+
+	// The same frames read as a plain stream.
+	var got bytes.Buffer
+	if _, err := io.Copy(&got, NewSecureReader(bytes.NewReader(buf.Bytes()), priv, pub)); err != nil {
+		t.Fatal(err)
+	}
+	if got.Len() != len(expected)+len("next") || !bytes.Equal(got.Bytes()[:len(expected)], expected) {
+		t.Fatalf("Unexpected stream: got %d bytes", got.Len())
+	}
+}
+
+func TestChunkedWriteTruncated(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	secureW.MaxMessageSize = 4
+	if err := secureW.WriteMsg([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+
+	// Drop the final frame so the message is never completed.
+	frames := buf.Bytes()[:2*(frameHeaderSize+box.Overhead+frameFlagsSize+4)]
+
+	secureR := NewSecureReader(bytes.NewReader(frames), priv, pub)
+	if _, err := secureR.ReadMsg(); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, got %v", err)
+	}
+}
+
+func TestReplayedFrames(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	for _, message := range []string{"first", "second"} {
+		if err := secureW.WriteMsg([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	first := buf.Next(frameHeaderSize + box.Overhead + frameFlagsSize + len("first"))
+	second := buf.Bytes()
+
+	tests := map[string][][]byte{
+		"replayed":  {first, first},
+		"reordered": {second, first},
+	}
+	for name, frames := range tests {
+		secureR := NewSecureReader(bytes.NewReader(bytes.Join(frames, nil)), priv, pub)
+
+		var err error
+		for err == nil {
+			_, err = secureR.ReadMsg()
+		}
+		if !errors.Is(err, ErrReplayed) {
+			t.Errorf("%s: expected ErrReplayed, got %v", name, err)
+		}
+	}
+}
+
+func TestCloseFrame(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	if err := secureW.WriteMsg([]byte("last words")); err != nil {
+		t.Fatal(err)
+	}
+	if err := secureW.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := secureW.Write([]byte("more")); !errors.Is(err, ErrWriteClosed) {
+		t.Fatalf("Expected ErrWriteClosed, got %v", err)
+	}
+
+	// Anything following the close frame is never read.
+	buf.WriteString("trailing garbage")
+
+	secureR := NewSecureReader(&buf, priv, pub)
+	if message, err := secureR.ReadMsg(); err != nil || string(message) != "last words" {
+		t.Fatalf("Unexpected result: %q, %v", message, err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := secureR.Read(make([]byte, 16)); err != io.EOF {
+			t.Fatalf("Expected io.EOF after the close frame, got %v", err)
+		}
+	}
+}
+
+func TestDecryptFailed(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	if err := NewSecureWriter(&buf, priv, pub).WriteMsg([]byte("hello world")); err != nil {
+		t.Fatal(err)
+	}
+	frame := buf.Bytes()
+	frame[len(frame)-1] ^= 1
+
+	secureR := NewSecureReader(bytes.NewReader(frame), priv, pub)
+	if _, err := secureR.ReadMsg(); !errors.Is(err, ErrDecryptFailed) {
+		t.Fatalf("Expected ErrDecryptFailed for a tampered frame, got %v", err)
+	}
+}
+
+func TestDecryptErrorLocatesFrame(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	var offset int
+	for _, message := range []string{"first", "second", "third"} {
+		offset = buf.Len()
+		if err := secureW.WriteMsg([]byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	frames := buf.Bytes()
+	frames[len(frames)-1] ^= 1
+
+	secureR := NewSecureReader(bytes.NewReader(frames), priv, pub)
+	for i := 0; i < 2; i++ {
+		if _, err := secureR.ReadMsg(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := secureR.ReadMsg()
+	var decryptErr *DecryptError
+	if !errors.As(err, &decryptErr) {
+		t.Fatalf("Expected a DecryptError, got %v", err)
+	}
+	if decryptErr.Frame != 2 || decryptErr.Offset != int64(offset) {
+		t.Fatalf("Expected frame 2 at byte %d, got frame %d at byte %d", offset, decryptErr.Frame, decryptErr.Offset)
+	}
+	if !errors.Is(err, ErrDecryptFailed) {
+		t.Fatal("Expected a DecryptError to be an ErrDecryptFailed")
+	}
+	if code := errcode.Of(err); code != errcode.SecureDecryptFailed {
+		t.Fatalf("Expected code %s, got %q", errcode.SecureDecryptFailed, code)
+	}
+}
+
+func TestConcurrentWriters(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	r, w := io.Pipe()
+	secureW := NewSecureWriter(w, priv, pub)
+	secureW.MaxMessageSize = 64
+
+	// Each writer sends messages spanning several frames, which must
+	// not interleave with the frames of other writers.
+	const writers, messages = 8, 50
+	var wg sync.WaitGroup
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			message := bytes.Repeat([]byte{byte('a' + i)}, 1000)
+			for j := 0; j < messages; j++ {
+				if err := secureW.WriteMsg(message); err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(i)
+	}
+	go func() {
+		wg.Wait()
+		w.Close()
+	}()
+
+	secureR := NewSecureReader(r, priv, pub)
+	counts := make(map[byte]int)
+	for {
+		message, err := secureR.ReadMsg()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(message) != 1000 || !bytes.Equal(message, bytes.Repeat(message[:1], 1000)) {
+			t.Fatalf("Message of %d bytes was interleaved with another", len(message))
+		}
+		counts[message[0]]++
+	}
+
+	for i := 0; i < writers; i++ {
+		if got := counts[byte('a'+i)]; got != messages {
+			t.Errorf("Writer %d: read %d messages, expected %d", i, got, messages)
+		}
+	}
+}
+
+func BenchmarkSecureWrite(b *testing.B) {
+	for _, suite := range []CipherSuite{CipherNaClBox, CipherXChaCha20Poly1305} {
+		b.Run(suite.String(), func(b *testing.B) {
+			benchmarkSecureWrite(b, suite)
+		})
+	}
+}
+
+func benchmarkSecureWrite(b *testing.B, suite CipherSuite) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	secureW := NewSecureWriter(ioutil.Discard, priv, pub)
+	secureW.suite = suite
+	message := make([]byte, 16*1024)
+
+	b.SetBytes(int64(len(message)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := secureW.Write(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkSecureRead(b *testing.B) {
+	for _, suite := range []CipherSuite{CipherNaClBox, CipherXChaCha20Poly1305} {
+		b.Run(suite.String(), func(b *testing.B) {
+			benchmarkSecureRead(b, suite)
+		})
+	}
+}
+
+func benchmarkSecureRead(b *testing.B, suite CipherSuite) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	// Encode a batch of frames once and read it over and over, starting
+	// the sequence afresh with each pass.
+	const batch = 256
+	var frames bytes.Buffer
+	secureW := NewSecureWriter(&frames, priv, pub)
+	secureW.suite = suite
+	message := make([]byte, 16*1024)
+	for i := 0; i < batch; i++ {
+		if _, err := secureW.Write(message); err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	r := bytes.NewReader(frames.Bytes())
+	secureR := NewSecureReader(r, priv, pub)
+	secureR.suite = suite
+	buf := make([]byte, len(message))
+
+	b.SetBytes(int64(len(message)))
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i%batch == 0 {
+			r.Reset(frames.Bytes())
+			secureR.seq = 0
+		}
+		if _, err := io.ReadFull(secureR, buf); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// sealFrames seals data into a stream of frames as a SecureWriter with
+// key would, so that fuzzing reaches past the authenticator. Each frame
+// takes the next n bytes of data as its flags and payload, n being the
+// byte before them.
+func sealFrames(key *[32]byte, data []byte) []byte {
+	var stream []byte
+	for seq := uint64(0); len(data) > 0; seq++ {
+		n := int(data[0])
+		data = data[1:]
+		if n > len(data) {
+			n = len(data)
+		}
+		var nonce [nonceSize]byte
+		binary.BigEndian.PutUint64(nonce[seqOffset:], seq)
+		sealed := box.SealAfterPrecomputation(nil, data[:n], &nonce, key)
+		data = data[n:]
+
+		stream = binary.BigEndian.AppendUint32(stream, uint32(len(sealed)))
+		stream = append(append(stream, nonce[:]...), sealed...)
+	}
+
+	return stream
+}
+
+// maxFuzzFrameInput bounds the inputs FuzzReadFrame tries. Inputs with
+// new coverage are minimized by trying to remove every run of their
+// bytes, which takes time quadratic in their length, and longer inputs
+// only run the same loops more times.
+const maxFuzzFrameInput = 512
+
+func FuzzReadFrame(f *testing.F) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	// The key is agreed on once, as it costs more than reading the
+	// frames does.
+	var key [32]byte
+	box.Precompute(&key, pub, priv)
+
+	var buf bytes.Buffer
+	secureW := NewSecureWriter(&buf, priv, pub)
+	secureW.MaxMessageSize = 16
+	secureW.Padding = PaddingPolicy{Random: 8}
+	secureW.Compress = true
+	for _, message := range []string{"hello", strings.Repeat("split across frames ", 2)} {
+		if err := secureW.WriteMsg([]byte(message)); err != nil {
+			f.Fatal(err)
+		}
+	}
+	secureW.Close()
+	f.Add(buf.Bytes())
+	f.Add([]byte{6, 0, 'h', 'e', 'l', 'l', 'o'})
+	f.Add([]byte{3, flagMore, 'h', 'e', 2, 0, 'y'})
+	f.Add([]byte{6, flagPadded, 0, 0, 0, 1, 'x', 1, flagPadded, 8, flagPadded, 0xff, 0xff, 0xff, 0xff, 0, 0, 0})
+	f.Add([]byte{5, flagCompressed, 0xff, 0xff, 0xff, 0xff, 1, flagRekey})
+	f.Add([]byte{2, flagPing, 'p', 2, flagPong | flagAck, 'p', 2, flagClose, closeReasonRateLimited})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		if len(data) > maxFuzzFrameInput {
+			return
+		}
+
+		// The bytes are tried both as they come, to exercise the frame
+		// headers, and sealed into frames, to exercise what is in them.
+		// Messages are limited to less than the inputs can hold, so
+		// that going over the limit is covered too.
+		for _, stream := range [][]byte{data, sealFrames(&key, data)} {
+			secureR := newSecureReader(bytes.NewReader(stream), &key, nil)
+			secureR.MaxMessageSize = 256
+			for {
+				msg, err := secureR.ReadMsg()
+				if err != nil {
+					break
+				}
+				if len(msg) > len(stream) && !bytes.Contains(stream, []byte{flagCompressed}) {
+					t.Fatalf("read a message of %d bytes out of a stream of %d", len(msg), len(stream))
+				}
+			}
+		}
+	})
+}
+
+func TestReadResumesAfterTimeout(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	var frames bytes.Buffer
+	secureW := NewSecureWriter(&frames, priv, pub)
+	secureW.MaxMessageSize = 64
+	message := bytes.Repeat([]byte("resume "), 30)
+	if err := secureW.WriteMsg(message); err != nil {
+		t.Fatal(err)
+	}
+	stream := frames.Bytes()
+	frameSize := frameHeaderSize + box.Overhead + frameFlagsSize + 64
+
+	// Time the read out inside a header, inside a sealed box, between
+	// the frames of the message and just before its end.
+	for _, cut := range []int{10, frameHeaderSize + 20, frameSize, len(stream) - 1} {
+		local, remote := net.Pipe()
+		secureR := NewSecureReader(local, priv, pub)
+		secureR.MaxMessageSize = 64
+
+		go remote.Write(stream[:cut])
+		local.SetReadDeadline(time.Now().Add(50 * time.Millisecond))
+		if _, err := secureR.ReadMsg(); !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("Cut at %d: expected the deadline to pass, got %v", cut, err)
+		}
+
+		local.SetReadDeadline(time.Time{})
+		go remote.Write(stream[cut:])
+		got, err := secureR.ReadMsg()
+		if err != nil {
+			t.Fatalf("Cut at %d: retry failed: %v", cut, err)
+		}
+		if !bytes.Equal(got, message) {
+			t.Fatalf("Cut at %d: retry read %q, expected %q", cut, got, message)
+		}
+		local.Close()
+		remote.Close()
+	}
+}
+
+// cutWriter writes only the first n bytes of each write it is given
+// before failing.
+type cutWriter struct {
+	w io.Writer
+	n int
+}
+
+func (c *cutWriter) Write(b []byte) (int, error) {
+	if len(b) > c.n {
+		n, _ := c.w.Write(b[:c.n])
+		return n, os.ErrDeadlineExceeded
+	}
+	return c.w.Write(b)
+}
+
+func TestWriteRetryAfterTimeout(t *testing.T) {
+	priv, pub := &[32]byte{'p', 'r', 'i', 'v'}, &[32]byte{'p', 'u', 'b'}
+
+	// A write that times out before any of its frame goes out can be
+	// tried again.
+	var frames bytes.Buffer
+	cut := &cutWriter{w: &frames}
+	secureW := NewSecureWriter(cut, priv, pub)
+	if err := secureW.WriteMsg([]byte("first try")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected the deadline to pass, got %v", err)
+	}
+	cut.n = math.MaxInt
+	if err := secureW.WriteMsg([]byte("second try")); err != nil {
+		t.Fatal(err)
+	}
+	secureR := NewSecureReader(&frames, priv, pub)
+	if got, err := secureR.ReadMsg(); err != nil || string(got) != "second try" {
+		t.Fatalf("Read %q, %v after the retry", got, err)
+	}
+
+	// One that times out part way through a frame leaves the stream out
+	// of step, so later writes fail rather than send what the peer
+	// cannot read.
+	cut.n = 10
+	if err := secureW.WriteMsg([]byte("cut short")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected the deadline to pass, got %v", err)
+	}
+	cut.n = math.MaxInt
+	if err := secureW.WriteMsg([]byte("too late")); !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatalf("Expected writes after a cut frame to fail, got %v", err)
+	}
+}
@@ -0,0 +1,542 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/crypto/nacl/box"
+)
+
+// A Server accepts secure connections and passes each to its Handler.
+// Unlike Serve, it can be shut down. The zero Server is ready to use.
+type Server struct {
+	// Handler serves each connection, EchoHandler when nil.
+	Handler Handler
+
+	// Options configure the handshake of every connection.
+	Options []Option
+
+	// Goodbye makes Shutdown send each established connection a close
+	// frame, so its client reads io.EOF and knows to hang up, rather
+	// than waiting for clients to finish by themselves.
+	Goodbye bool
+
+	// MaxConns, if positive, is the most connections served at once,
+	// counting those still in the handshake. Beyond it, connections are
+	// closed as soon as they are accepted, with ErrTooManyConnections
+	// going to the error handler, unless QueueConns is set, in which
+	// case they wait to be accepted until one of the others finishes.
+	MaxConns   int
+	QueueConns bool
+
+	// Hooks are called as connections come and go.
+	Hooks Hooks
+
+	mu         sync.Mutex
+	reconfig   []Option
+	generation uint64
+	lastConnID uint64
+	slots      chan struct{}
+	listeners  map[net.Listener]struct{}
+	conns      map[net.Conn]*SecureConn
+	inShutdown bool
+	wg         sync.WaitGroup
+
+	// ctx is handed to the Handler and cancelled when the server starts
+	// shutting down.
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Serve accepts connections on l, performs the handshake on each and
+// passes it to the Handler, until l fails or the server is shut
+// down, when it returns ErrServerClosed. Serve closes l when it
+// returns.
+func (s *Server) Serve(l net.Listener) error {
+	opts, generation := s.options()
+	cfg := newConfig(opts)
+	pub, priv, err := serverKeys(&cfg)
+	if err != nil {
+		return err
+	}
+
+	if !s.trackListener(l) {
+		l.Close()
+		return ErrServerClosed
+	}
+	defer s.untrackListener(l)
+
+	slots, ctx := s.connSlots(), s.context()
+	var delay time.Duration
+	for {
+		queued := false
+		if slots != nil && s.QueueConns {
+			select {
+			case slots <- struct{}{}:
+				queued = true
+			case <-ctx.Done():
+				return ErrServerClosed
+			}
+		}
+
+		conn, err := l.Accept()
+		if err != nil {
+			if queued {
+				<-slots
+			}
+			if s.shuttingDown() {
+				return ErrServerClosed
+			}
+			// Running out of file descriptors and the like should
+			// pass, so wait for it rather than give up.
+			if ne, ok := err.(net.Error); ok && ne.Temporary() {
+				delay = acceptRetryDelay(delay)
+				cfg.logger().Warn("accept failed", "err", err, "retry_in", delay)
+				time.Sleep(delay)
+				continue
+			}
+			return fmt.Errorf("create connection: %w", err)
+		}
+		delay = 0
+
+		if opts, current := s.options(); current != generation {
+			next := newConfig(opts)
+			if err := ticketKey(&next, cfg.ticketKey); err != nil {
+				conn.Close()
+				return err
+			}
+			cfg, generation = next, current
+		}
+
+		if cfg.banList != nil && cfg.banList.BannedAddr(conn.RemoteAddr()) {
+			if queued {
+				<-slots
+			}
+			conn.Close()
+			cfg.handleError(cfg.logger().With("remote", conn.RemoteAddr().String()), conn.RemoteAddr(), ErrBanned)
+			s.Hooks.error(ConnInfo{RemoteAddr: conn.RemoteAddr()}, ErrBanned)
+			continue
+		}
+		if slots != nil && !queued {
+			select {
+			case slots <- struct{}{}:
+			default:
+				conn.Close()
+				cfg.handleError(cfg.logger().With("remote", conn.RemoteAddr().String()), conn.RemoteAddr(), ErrTooManyConnections)
+				s.Hooks.error(ConnInfo{RemoteAddr: conn.RemoteAddr()}, ErrTooManyConnections)
+				continue
+			}
+		}
+		id, ok := s.trackConn(conn)
+		if !ok {
+			if slots != nil {
+				<-slots
+			}
+			conn.Close()
+			return ErrServerClosed
+		}
+
+		go func(conn net.Conn) {
+			if slots != nil {
+				defer func() { <-slots }()
+			}
+			defer s.untrackConn(conn)
+			defer conn.Close()
+
+			logger := cfg.logger().With("conn", id, "remote", conn.RemoteAddr().String())
+			logger.Debug("connection accepted")
+			if err := s.serveConn(conn, pub, priv, cfg, logger); err != nil {
+				cfg.handleError(logger, conn.RemoteAddr(), err)
+			}
+		}(conn)
+	}
+}
+
+// serveConn performs the server's side of the handshake on conn and
+// hands the connection it sets up to the Handler, logging to logger.
+func (s *Server) serveConn(conn net.Conn, pub, priv *[32]byte, cfg config, logger *slog.Logger) (err error) {
+	start := cfg.now()
+	var sc *SecureConn
+	defer func() {
+		if err == nil {
+			return
+		}
+		info := ConnInfo{RemoteAddr: conn.RemoteAddr(), Duration: cfg.now().Sub(start)}
+		if sc != nil {
+			info = connInfo(sc, info.Duration)
+		}
+		s.Hooks.error(info, err)
+	}()
+
+	// A misbehaving client must only cost its own connection, not take
+	// the whole server down, and one that goes quiet must not hold it
+	// open forever.
+	cfg.deadline = time.Now().Add(handshakeTimeout(cfg.handshakeTimeout))
+	if err := conn.SetDeadline(cfg.deadline); err != nil {
+		return fmt.Errorf("set handshake deadline: %w", err)
+	}
+	sc, err = handshake(conn, pub, priv, true, cfg)
+	if err != nil {
+		if cfg.metrics != nil {
+			atomic.AddInt64(&cfg.metrics.handshakesFailed, 1)
+		}
+		return fmt.Errorf("handshake: %w", err)
+	}
+	s.Hooks.handshake(connInfo(sc, cfg.now().Sub(start)))
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		return fmt.Errorf("clear handshake deadline: %w", err)
+	}
+
+	if err := cfg.setUpServerConn(sc); err != nil {
+		return err
+	}
+	defer sc.Close()
+
+	logger.Info("connection established", "peer", sc.peerFingerprint(), "cipher", sc.CipherSuite().String(), "resumed", sc.Resumed())
+	defer func(start time.Time) {
+		in, out := sc.bytesTransferred()
+		logger.Info("connection closed", "bytes_in", in, "bytes_out", out, "duration", cfg.now().Sub(start))
+	}(cfg.now())
+
+	ctx, ok := s.established(conn, sc)
+	if !ok {
+		return nil
+	}
+
+	handler := s.Handler
+	if handler == nil {
+		handler = EchoHandler
+	}
+
+	if cfg.metrics != nil {
+		atomic.AddInt64(&cfg.metrics.conns, 1)
+		atomic.AddInt64(&cfg.metrics.activeConns, 1)
+		defer atomic.AddInt64(&cfg.metrics.activeConns, -1)
+		defer func(start time.Time) { cfg.metrics.handled(cfg.now().Sub(start)) }(cfg.now())
+	}
+
+	if cfg.audit != nil {
+		if err := cfg.audit.start(sc); err != nil {
+			logger.Error("audit failed", "err", err)
+		}
+		defer func(start time.Time) {
+			if auditErr := cfg.audit.end(sc, start, err); auditErr != nil {
+				logger.Error("audit failed", "err", auditErr)
+			}
+		}(cfg.now())
+	}
+	s.Hooks.connect(connInfo(sc, 0))
+	defer func(start time.Time) { s.Hooks.disconnect(connInfo(sc, cfg.now().Sub(start))) }(cfg.now())
+
+	err = handler(ctx, sc)
+	if errors.Is(err, ErrRateLimited) && sc.features&featureClose != 0 {
+		// Tell the client why it is being cut off.
+		sc.writer.close([]byte{closeReasonRateLimited})
+	}
+
+	return err
+}
+
+// serverKeys generates the ephemeral key pair a server handshakes with
+// and, if cfg issues session tickets, the key that seals them.
+func serverKeys(cfg *config) (pub, priv *[32]byte, err error) {
+	pub, priv, err = box.GenerateKey(cfg.random())
+	if err != nil {
+		return nil, nil, fmt.Errorf("generate keys: %w", err)
+	}
+	if err := ticketKey(cfg, nil); err != nil {
+		return nil, nil, err
+	}
+
+	return pub, priv, nil
+}
+
+// ticketKey sets the key that seals the session tickets cfg issues, if
+// it issues them, to key, generating one if key is nil.
+func ticketKey(cfg *config, key *[32]byte) error {
+	if cfg.ticketLifetime <= 0 {
+		return nil
+	}
+	if key == nil {
+		key = new([32]byte)
+		if _, err := io.ReadFull(cfg.random(), key[:]); err != nil {
+			return fmt.Errorf("generate ticket key: %w", err)
+		}
+	}
+	cfg.ticketKey = key
+
+	return nil
+}
+
+// Reconfigure makes the server set up the connections it accepts from
+// now on with opts applied after Options, replacing those of any earlier
+// call, so that authorized keys, ban lists, rate limits and the like can
+// change without a restart. Connections already established keep the
+// configuration they were set up with, as do MaxConns and QueueConns.
+func (s *Server) Reconfigure(opts ...Option) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.reconfig = opts
+	s.generation++
+}
+
+// options returns the options connections are set up with now, and how
+// many times the server has been reconfigured.
+func (s *Server) options() ([]Option, uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	opts := make([]Option, 0, len(s.Options)+len(s.reconfig))
+	return append(append(opts, s.Options...), s.reconfig...), s.generation
+}
+
+// acceptRetryDelay returns how long to wait before accepting again after
+// a temporary failure, given the wait after the last one, if any.
+func acceptRetryDelay(last time.Duration) time.Duration {
+	if last == 0 {
+		return 5 * time.Millisecond
+	}
+	if last *= 2; last > time.Second {
+		return time.Second
+	}
+
+	return last
+}
+
+// setUpServerConn checks that the client of sc, fresh from the
+// server's side of the handshake, is authorized, and applies the
+// policies and limits of cfg to it.
+func (cfg config) setUpServerConn(sc *SecureConn) error {
+	if cfg.authorized != nil {
+		if err := authorize(sc, cfg.authorized); err != nil {
+			return err
+		}
+	}
+	if cfg.metrics != nil {
+		// Before anything else starts using the connection.
+		sc.reader.metrics, sc.writer.metrics = cfg.metrics, cfg.metrics
+	}
+	sc.SetPaddingPolicy(cfg.padding)
+	sc.SetKeepalivePolicy(cfg.keepalive)
+	sc.SetIdlePolicy(cfg.idle)
+	sc.SetLifetimePolicy(cfg.lifetime)
+	if cfg.rateLimiter != nil {
+		sc.reader.limit = cfg.rateLimiter.limit(sc)
+	}
+
+	return nil
+}
+
+// Shutdown stops the server accepting connections and drops those still
+// in the handshake, then waits for the established ones to finish,
+// first sending them a close frame if Goodbye is set. If ctx is done
+// before they have all finished, Shutdown closes the rest and returns
+// ctx's error.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutDownLocked()
+	for conn, sc := range s.conns {
+		switch {
+		case sc == nil:
+			conn.Close()
+		case s.Goodbye:
+			// The close frame can wait behind a write the peer is
+			// slow to read, so it must not hold up the others.
+			go sc.CloseWrite()
+		}
+	}
+	s.mu.Unlock()
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		s.Close()
+		return ctx.Err()
+	}
+}
+
+// Close closes the server's listeners and every connection at once.
+// For a graceful shutdown, use Shutdown.
+func (s *Server) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.shutDownLocked()
+	for conn := range s.conns {
+		conn.Close()
+	}
+
+	return nil
+}
+
+// shutDownLocked stops the server accepting connections and tells the
+// handlers it is shutting down.
+func (s *Server) shutDownLocked() {
+	s.inShutdown = true
+	for l := range s.listeners {
+		l.Close()
+		delete(s.listeners, l)
+	}
+	if s.cancel != nil {
+		s.cancel()
+	}
+}
+
+// ServerStatus is what a Server is doing at a moment.
+type ServerStatus struct {
+	// Listeners is how many listeners it is accepting connections on.
+	Listeners int
+
+	// Conns is how many connections are past the handshake, and
+	// Handshakes how many are still in it.
+	Conns, Handshakes int
+
+	// ShuttingDown is set once Shutdown or Close has been called.
+	ShuttingDown bool
+}
+
+// Status returns what s is doing now.
+func (s *Server) Status() ServerStatus {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := ServerStatus{Listeners: len(s.listeners), ShuttingDown: s.inShutdown}
+	for _, sc := range s.conns {
+		if sc == nil {
+			status.Handshakes++
+		} else {
+			status.Conns++
+		}
+	}
+
+	return status
+}
+
+func (s *Server) shuttingDown() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.inShutdown
+}
+
+// trackListener records l so that shutting down closes it, and reports
+// false if the server is already shutting down.
+func (s *Server) trackListener(l net.Listener) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inShutdown {
+		return false
+	}
+	if s.listeners == nil {
+		s.listeners = make(map[net.Listener]struct{})
+	}
+	s.listeners[l] = struct{}{}
+
+	return true
+}
+
+func (s *Server) untrackListener(l net.Listener) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.listeners[l]; ok {
+		l.Close()
+		delete(s.listeners, l)
+	}
+}
+
+// trackConn records conn, still in the handshake, so that shutting down
+// closes it, and returns the ID it is logged with. It reports false if
+// the server is already shutting down.
+func (s *Server) trackConn(conn net.Conn) (uint64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inShutdown {
+		return 0, false
+	}
+	if s.conns == nil {
+		s.conns = make(map[net.Conn]*SecureConn)
+	}
+	s.conns[conn] = nil
+	s.wg.Add(1)
+	s.lastConnID++
+
+	return s.lastConnID, true
+}
+
+// established records that conn completed the handshake as sc and
+// returns the context for its handler, or reports false if the server
+// started shutting down meanwhile, in which case the connection should
+// be dropped.
+func (s *Server) established(conn net.Conn, sc *SecureConn) (context.Context, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.inShutdown {
+		return nil, false
+	}
+	s.conns[conn] = sc
+
+	return s.contextLocked(), true
+}
+
+// context returns the context handed to the Handler, which is cancelled
+// when the server starts shutting down.
+func (s *Server) context() context.Context {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.contextLocked()
+}
+
+func (s *Server) contextLocked() context.Context {
+	if s.ctx == nil {
+		s.ctx, s.cancel = context.WithCancel(context.Background())
+		if s.inShutdown {
+			s.cancel()
+		}
+	}
+
+	return s.ctx
+}
+
+// connSlots returns the semaphore that enforces MaxConns across every
+// Serve call, or nil if there is no limit.
+func (s *Server) connSlots() chan struct{} {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.MaxConns <= 0 {
+		return nil
+	}
+	if s.slots == nil {
+		s.slots = make(chan struct{}, s.MaxConns)
+	}
+
+	return s.slots
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.conns, conn)
+	s.wg.Done()
+}
@@ -0,0 +1,364 @@
+package securecomm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// startServer serves s on a fresh listener and returns its address along
+// with the channel Serve's result arrives on.
+func startServer(t *testing.T, s *Server) (string, <-chan error) {
+	l := testutil.Listen(t)
+
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(l)
+	}()
+
+	return l.Addr().String(), served
+}
+
+// serveHandler serves handler with opts on a fresh listener until the
+// test ends, and returns its address.
+func serveHandler(t *testing.T, handler Handler, opts ...Option) string {
+	s := &Server{Handler: handler, Options: opts}
+	addr, _ := startServer(t, s)
+	t.Cleanup(func() { s.Close() })
+
+	return addr
+}
+
+// dialEchoed dials addr and waits for an echo, so that the server has
+// finished setting the connection up.
+func dialEchoed(t *testing.T, addr string) *SecureConn {
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := conn.ReadMsg(); err != nil || string(echo) != "ping" {
+		t.Fatalf("Unexpected echo %q, %v", echo, err)
+	}
+
+	return conn
+}
+
+func TestServerShutdown(t *testing.T) {
+	s := &Server{Goodbye: true}
+	addr, served := startServer(t, s)
+
+	conn := dialEchoed(t, addr)
+	defer conn.Close()
+
+	// A client still in the handshake is dropped at once.
+	pending, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pending.Close()
+	pending.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := pending.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- s.Shutdown(context.Background())
+	}()
+
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed from Serve, got %v", err)
+	}
+	if _, err := io.Copy(ioutil.Discard, pending); err != nil {
+		t.Errorf("Expected the connection in the handshake to be closed, got %v", err)
+	}
+
+	// The established client is told goodbye and hangs up.
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.ReadMsg(); err != io.EOF {
+		t.Fatalf("Expected io.EOF after the goodbye, got %v", err)
+	}
+	select {
+	case err := <-shutdown:
+		t.Fatalf("Shutdown returned %v before the client hung up", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+	conn.Close()
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatalf("Shutdown: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Shutdown did not return after the last client hung up")
+	}
+
+	if _, err := Dial(addr); err == nil {
+		t.Fatal("Expected a shut down server to refuse connections")
+	}
+}
+
+func TestServerShutdownDeadline(t *testing.T) {
+	s := new(Server)
+	addr, served := startServer(t, s)
+
+	conn := dialEchoed(t, addr)
+	defer conn.Close()
+
+	// Without a goodbye the client never learns to hang up, so the
+	// server must close the connection itself once out of time.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := s.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected context.DeadlineExceeded, got %v", err)
+	}
+	if err := <-served; !errors.Is(err, ErrServerClosed) {
+		t.Errorf("Expected ErrServerClosed from Serve, got %v", err)
+	}
+
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.ReadMsg(); err == nil {
+		t.Fatal("Expected the connection to be closed")
+	} else if netErr, ok := err.(net.Error); ok && netErr.Timeout() {
+		t.Fatal("Expected the server to close the connection, timed out waiting")
+	}
+}
+
+func TestServerClosedBeforeServe(t *testing.T) {
+	s := new(Server)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	l := testutil.Listen(t)
+	if err := s.Serve(l); !errors.Is(err, ErrServerClosed) {
+		t.Fatalf("Expected ErrServerClosed, got %v", err)
+	}
+	if _, err := net.Dial("tcp", l.Addr().String()); err == nil {
+		t.Fatal("Expected Serve to close the listener")
+	}
+}
+
+func TestServerMaxConns(t *testing.T) {
+	errs := make(chan error, 1)
+	s := &Server{
+		MaxConns: 1,
+		Options:  []Option{WithErrorHandler(func(addr net.Addr, err error) { errs <- err })},
+	}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn := dialEchoed(t, addr)
+
+	// A second client is turned away at once.
+	if _, err := Dial(addr); err == nil {
+		t.Fatal("Expected the second client to be refused")
+	}
+	if err := <-errs; !errors.Is(err, ErrTooManyConnections) {
+		t.Fatalf("Expected ErrTooManyConnections, got %v", err)
+	}
+
+	// Until the first hangs up.
+	conn.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		conn, err := Dial(addr)
+		if err == nil {
+			conn.Close()
+			break
+		}
+		<-errs
+		if time.Now().After(deadline) {
+			t.Fatalf("Expected a client to be served once the first left, got %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestServerQueueConns(t *testing.T) {
+	s := &Server{MaxConns: 1, QueueConns: true}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn := dialEchoed(t, addr)
+
+	// A second client waits for the first to hang up.
+	dialed := make(chan error, 1)
+	go func() {
+		conn, err := Dial(addr)
+		if err == nil {
+			conn.Close()
+		}
+		dialed <- err
+	}()
+	select {
+	case err := <-dialed:
+		t.Fatalf("Second client got through with the first still connected: %v", err)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	conn.Close()
+	if err := <-dialed; err != nil {
+		t.Fatalf("Expected the second client to be served once the first left, got %v", err)
+	}
+}
+
+// temporaryError is what accept fails with when the process runs out of
+// file descriptors, say.
+type temporaryError struct{}
+
+func (temporaryError) Error() string   { return "too many open files" }
+func (temporaryError) Temporary() bool { return true }
+func (temporaryError) Timeout() bool   { return false }
+
+// flakyListener fails its first few accepts with a temporary error.
+type flakyListener struct {
+	net.Listener
+	failures int
+}
+
+func (l *flakyListener) Accept() (net.Conn, error) {
+	if l.failures > 0 {
+		l.failures--
+		return nil, temporaryError{}
+	}
+
+	return l.Listener.Accept()
+}
+
+func TestServerReconfigure(t *testing.T) {
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "banned")
+	if err := os.WriteFile(path, []byte(key.String()+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	bl, err := LoadBanList(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Server{Options: []Option{WithErrorHandler(func(net.Addr, error) {})}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	established, err := Dial(addr, WithIdentity(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer established.Close()
+	if err := established.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := established.ReadMsg(); err != nil {
+		t.Fatal(err)
+	}
+
+	// New connections are refused, while the established one carries on.
+	s.Reconfigure(WithBanList(bl))
+	if _, err := Dial(addr, WithIdentity(key)); err == nil {
+		t.Error("Expected the key banned by the new configuration to be refused")
+	}
+	if err := established.WriteMsg([]byte("still here")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := established.ReadMsg(); err != nil || string(echo) != "still here" {
+		t.Errorf("Expected the established connection to carry on, got %q, %v", echo, err)
+	}
+
+	// Reconfiguring again replaces the options rather than adding to them.
+	s.Reconfigure()
+	conn, err := Dial(addr, WithIdentity(key))
+	if err != nil {
+		t.Fatalf("Expected the key to be let in again, got %v", err)
+	}
+	conn.Close()
+}
+
+func TestServerAcceptBackoff(t *testing.T) {
+	l := testutil.Listen(t)
+
+	s := &Server{}
+	served := make(chan error, 1)
+	go func() {
+		served <- s.Serve(&flakyListener{Listener: l, failures: 3})
+	}()
+	defer s.Close()
+
+	conn := dialEchoed(t, l.Addr().String())
+	conn.Close()
+
+	select {
+	case err := <-served:
+		t.Fatalf("Serve returned %v on a temporary error", err)
+	default:
+	}
+}
+
+func TestServerLogs(t *testing.T) {
+	var logs lockedBuffer
+	s := &Server{Options: []Option{WithLogger(slog.New(slog.NewJSONHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))}}
+	addr, _ := startServer(t, s)
+
+	key, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn, err := Dial(addr, WithIdentity(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	records := make(map[string]map[string]interface{})
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		var record map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &record); err != nil {
+			t.Fatalf("Record %q is not JSON: %v", line, err)
+		}
+		records[record["msg"].(string)] = record
+	}
+
+	established, closed := records["connection established"], records["connection closed"]
+	if established == nil || closed == nil {
+		t.Fatalf("Expected the connection to be logged, got %q", logs.String())
+	}
+	if established["peer"] != Fingerprint(key.Public) {
+		t.Errorf("Expected the client's fingerprint to be logged, got %v", established["peer"])
+	}
+	if established["conn"] != closed["conn"] || established["conn"] == nil {
+		t.Errorf("Expected both records to carry the same connection ID, got %v and %v", established["conn"], closed["conn"])
+	}
+	if in, _ := closed["bytes_in"].(float64); in == 0 {
+		t.Errorf("Expected the bytes read to be logged, got %v", closed["bytes_in"])
+	}
+	if out, _ := closed["bytes_out"].(float64); out == 0 {
+		t.Errorf("Expected the bytes written to be logged, got %v", closed["bytes_out"])
+	}
+}
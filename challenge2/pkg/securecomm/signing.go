@@ -0,0 +1,76 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"fmt"
+)
+
+// Each side's signature covers its own per-connection key and the hash
+// of the whole handshake, under a label naming its role, so a signature
+// can be neither replayed on another connection nor reflected back.
+const (
+	clientSignatureLabel = "go-mentor secure client signature"
+	serverSignatureLabel = "go-mentor secure server signature"
+)
+
+func signedMessage(ephemeral *[32]byte, transcript []byte, server bool) []byte {
+	label := clientSignatureLabel
+	if server {
+		label = serverSignatureLabel
+	}
+
+	message := append([]byte(label), ephemeral[:]...)
+	return append(message, transcript...)
+}
+
+// exchangeSignatures sends our signature when we have a signing key and
+// checks the peer's when it advertised one. Each signature travels as
+// an encrypted message holding the Ed25519 public key followed by the
+// signature.
+func (c *SecureConn) exchangeSignatures(cfg config, transcript []byte, ephemeral, peerEphemeral *[32]byte, server, peerSigns bool) error {
+	if cfg.signer != nil {
+		message := signedMessage(ephemeral, transcript, server)
+		payload := append([]byte(cfg.signer.Public().(ed25519.PublicKey)), ed25519.Sign(cfg.signer, message)...)
+		if err := c.writer.WriteMsg(payload); err != nil {
+			return fmt.Errorf("write signature: %w", err)
+		}
+	}
+
+	if !peerSigns {
+		if len(cfg.trustedSigners) > 0 {
+			return fmt.Errorf("peer did not sign the handshake: %w", ErrNoPeerIdentity)
+		}
+		return nil
+	}
+
+	payload, err := c.reader.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("read signature: %w", err)
+	}
+	if len(payload) != ed25519.PublicKeySize+ed25519.SignatureSize {
+		return fmt.Errorf("signature message holds %d bytes: %w", len(payload), ErrBadSignature)
+	}
+
+	signer := ed25519.PublicKey(payload[:ed25519.PublicKeySize])
+	if !ed25519.Verify(signer, signedMessage(peerEphemeral, transcript, !server), payload[ed25519.PublicKeySize:]) {
+		return ErrBadSignature
+	}
+
+	if len(cfg.trustedSigners) > 0 && !trusted(signer, cfg.trustedSigners) {
+		return ErrUntrustedSigner
+	}
+	c.signer = signer
+
+	return nil
+}
+
+func trusted(key ed25519.PublicKey, keys []ed25519.PublicKey) bool {
+	for _, candidate := range keys {
+		if bytes.Equal(candidate, key) {
+			return true
+		}
+	}
+
+	return false
+}
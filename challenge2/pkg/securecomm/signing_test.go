@@ -0,0 +1,73 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"errors"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestSignedHandshake(t *testing.T) {
+	serverPub, serverPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientPub, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed := testutil.Listen(t)
+	go Serve(signed, nil, WithSigningKey(serverPriv), WithTrustedSigners(clientPub))
+
+	conn, err := Dial(signed.Addr().String(), WithSigningKey(clientPriv), WithTrustedSigners(serverPub))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key, ok := conn.PeerSigningKey(); !ok || !bytes.Equal(key, serverPub) {
+		t.Error("Expected the server's signing key")
+	}
+	if err := conn.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := conn.ReadMsg(); err != nil || string(echo) != "ping" {
+		t.Fatalf("Unexpected echo: %q, %v", echo, err)
+	}
+	conn.Close()
+
+	if _, err := Dial(signed.Addr().String(), WithTrustedSigners(otherPub)); !errors.Is(err, ErrUntrustedSigner) {
+		t.Errorf("Expected ErrUntrustedSigner, got %v", err)
+	}
+
+	// The server trusts only the client's key, so an unsigned client is
+	// dropped.
+	if conn, err := Dial(signed.Addr().String()); err == nil {
+		if _, err := conn.ReadMsg(); err == nil {
+			t.Error("Expected an unsigned client to be refused")
+		}
+		conn.Close()
+	}
+
+	unsigned := testutil.Listen(t)
+	go Serve(unsigned, nil)
+
+	if _, err := Dial(unsigned.Addr().String(), WithTrustedSigners(serverPub)); !errors.Is(err, ErrNoPeerIdentity) {
+		t.Errorf("Expected ErrNoPeerIdentity from an unsigned server, got %v", err)
+	}
+}
+
+func TestSignatureBindsRole(t *testing.T) {
+	ephemeral := &[32]byte{1}
+	transcript := []byte("transcript")
+
+	if bytes.Equal(signedMessage(ephemeral, transcript, false), signedMessage(ephemeral, transcript, true)) {
+		t.Fatal("Client and server sign the same message")
+	}
+}
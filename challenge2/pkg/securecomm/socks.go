@@ -0,0 +1,163 @@
+package securecomm
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+)
+
+// SOCKS5 codes only the server side needs.
+const (
+	socks5NoAcceptableMethods = 0xff
+
+	socks5Succeeded               = 0
+	socks5GeneralFailure          = 1
+	socks5HostUnreachable         = 4
+	socks5ConnectionRefused       = 5
+	socks5CommandNotSupported     = 7
+	socks5AddressTypeNotSupported = 8
+)
+
+// SOCKS5Handler returns a Handler that acts as a SOCKS5 proxy for each
+// client, connecting it to whichever host it asks for. Paired with
+// Tunnel on the client's side, it lets any program that speaks SOCKS5
+// reach the server's network through the secure channel. Clients are
+// already authenticated by the handshake, so no SOCKS5 authentication
+// is offered, and only CONNECT is supported.
+func SOCKS5Handler() Handler {
+	return func(ctx context.Context, conn *SecureConn) error {
+		addr, err := socks5Accept(conn)
+		if err != nil {
+			return fmt.Errorf("socks5: %w", err)
+		}
+
+		var d net.Dialer
+		target, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			socks5Reply(conn, socks5DialFailure(err), nil)
+			return fmt.Errorf("socks5: %w", err)
+		}
+		defer target.Close()
+
+		if err := socks5Reply(conn, socks5Succeeded, target.LocalAddr()); err != nil {
+			return fmt.Errorf("socks5: %w", err)
+		}
+
+		return splice(conn, target)
+	}
+}
+
+// socks5Accept negotiates with the SOCKS5 client at the other end of
+// conn and returns the address it asks to be connected to.
+func socks5Accept(conn net.Conn) (string, error) {
+	var greeting [2]byte
+	if _, err := io.ReadFull(conn, greeting[:]); err != nil {
+		return "", fmt.Errorf("read greeting: %w", err)
+	}
+	if greeting[0] != socks5Version {
+		return "", fmt.Errorf("client speaks SOCKS version %d", greeting[0])
+	}
+	methods := make([]byte, greeting[1])
+	if _, err := io.ReadFull(conn, methods); err != nil {
+		return "", fmt.Errorf("read greeting: %w", err)
+	}
+
+	method := byte(socks5NoAcceptableMethods)
+	for _, m := range methods {
+		if m == socks5NoAuth {
+			method = socks5NoAuth
+		}
+	}
+	if _, err := conn.Write([]byte{socks5Version, method}); err != nil {
+		return "", err
+	}
+	if method == socks5NoAcceptableMethods {
+		return "", errors.New("client does not offer to go without authentication")
+	}
+
+	var header [4]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return "", fmt.Errorf("read request: %w", err)
+	}
+	if header[0] != socks5Version {
+		return "", fmt.Errorf("client speaks SOCKS version %d", header[0])
+	}
+	if header[1] != socks5CommandConnect {
+		socks5Reply(conn, socks5CommandNotSupported, nil)
+		return "", fmt.Errorf("unsupported command %d", header[1])
+	}
+
+	var host string
+	switch header[3] {
+	case socks5IPv4, socks5IPv6:
+		ip := make(net.IP, net.IPv4len)
+		if header[3] == socks5IPv6 {
+			ip = make(net.IP, net.IPv6len)
+		}
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return "", fmt.Errorf("read request: %w", err)
+		}
+		host = ip.String()
+	case socks5Domain:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return "", fmt.Errorf("read request: %w", err)
+		}
+		name := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, name); err != nil {
+			return "", fmt.Errorf("read request: %w", err)
+		}
+		host = string(name)
+	default:
+		socks5Reply(conn, socks5AddressTypeNotSupported, nil)
+		return "", fmt.Errorf("unknown address type %d in request", header[3])
+	}
+
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return "", fmt.Errorf("read request: %w", err)
+	}
+
+	return net.JoinHostPort(host, strconv.Itoa(int(binary.BigEndian.Uint16(port[:])))), nil
+}
+
+// socks5Reply answers a SOCKS5 request with code, giving bound as the
+// address connected from if it is a TCP address.
+func socks5Reply(conn net.Conn, code byte, bound net.Addr) error {
+	reply := []byte{socks5Version, code, 0}
+	tcp, _ := bound.(*net.TCPAddr)
+	switch {
+	case tcp != nil && tcp.IP.To4() != nil:
+		reply = append(append(reply, socks5IPv4), tcp.IP.To4()...)
+	case tcp != nil:
+		reply = append(append(reply, socks5IPv6), tcp.IP.To16()...)
+	default:
+		reply = append(reply, socks5IPv4, 0, 0, 0, 0)
+	}
+	var port int
+	if tcp != nil {
+		port = tcp.Port
+	}
+	reply = append(reply, byte(port>>8), byte(port))
+
+	_, err := conn.Write(reply)
+	return err
+}
+
+// socks5DialFailure picks the reply code for a failure to connect.
+func socks5DialFailure(err error) byte {
+	var dnsErr *net.DNSError
+	var opErr *net.OpError
+	switch {
+	case errors.As(err, &dnsErr):
+		return socks5HostUnreachable
+	case errors.As(err, &opErr):
+		return socks5ConnectionRefused
+	default:
+		return socks5GeneralFailure
+	}
+}
@@ -0,0 +1,71 @@
+package securecomm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+func TestSOCKS5Handler(t *testing.T) {
+	backend := testutil.Listen(t)
+	go serveReversed(backend)
+
+	// Find a port nobody listens on.
+	l := testutil.Listen(t)
+	unreachable := l.Addr().String()
+	l.Close()
+
+	s := &Server{
+		Handler: SOCKS5Handler(),
+		Options: []Option{WithErrorHandler(func(net.Addr, error) {})},
+	}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	local := testutil.Listen(t)
+	go Tunnel(local, func() (net.Conn, error) {
+		return Dial(addr)
+	})
+
+	connect := func(target string) (net.Conn, error) {
+		conn, err := net.Dial("tcp", local.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+		if _, err := socks5Connect(conn, target, nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+		return conn, nil
+	}
+
+	conn, err := connect(backend.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := io.WriteString(conn, "through the proxy"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := ioutil.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(reply, []byte("yxorp eht hguorht")) {
+		t.Fatalf("Got %q through the proxy", reply)
+	}
+
+	if _, err := connect(unreachable); !errors.Is(err, ErrProxyRefused) {
+		t.Fatalf("Expected ErrProxyRefused for an unreachable host, got %v", err)
+	}
+}
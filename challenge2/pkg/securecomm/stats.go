@@ -0,0 +1,108 @@
+package securecomm
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// ConnStats counts the traffic of a connection since its handshake, in
+// bytes and frames on the wire, headers and overhead included, and the
+// times its key was replaced. The difference of two taken a while
+// apart, from Sub, counts the traffic in between, so its rates are
+// those of that while.
+type ConnStats struct {
+	// Elapsed is how long the counts are over.
+	Elapsed time.Duration
+
+	BytesIn, BytesOut   int64
+	FramesIn, FramesOut int64
+
+	// RekeysIn counts the peer's rekeys and RekeysOut ours.
+	RekeysIn, RekeysOut int64
+
+	// HandshakeDuration is how long the handshake took, and
+	// LastActivity when the last frame was sent or received, or when
+	// the handshake completed if none was since. Sub keeps them as
+	// they are in the later ConnStats.
+	HandshakeDuration time.Duration
+	LastActivity      time.Time
+}
+
+// Stats returns the traffic of c so far. It is safe to call while c is
+// in use.
+func (c *SecureConn) Stats() ConnStats {
+	last := c.established
+	for _, t := range []int64{atomic.LoadInt64(&c.reader.lastFrame), atomic.LoadInt64(&c.writer.lastFrame)} {
+		if t != 0 && time.Unix(0, t).After(last) {
+			last = time.Unix(0, t)
+		}
+	}
+
+	return ConnStats{
+		Elapsed:   c.clock.Now().Sub(c.established),
+		BytesIn:   atomic.LoadInt64(&c.reader.bytes),
+		BytesOut:  atomic.LoadInt64(&c.writer.bytes),
+		FramesIn:  atomic.LoadInt64(&c.reader.frames),
+		FramesOut: atomic.LoadInt64(&c.writer.frames),
+		RekeysIn:  atomic.LoadInt64(&c.reader.rekeys),
+		RekeysOut: atomic.LoadInt64(&c.writer.rekeys),
+
+		HandshakeDuration: c.handshakeTime,
+		LastActivity:      last,
+	}
+}
+
+// Sub returns the traffic counted in s but not yet in prev, taken
+// earlier from the same connection.
+func (s ConnStats) Sub(prev ConnStats) ConnStats {
+	return ConnStats{
+		Elapsed:   s.Elapsed - prev.Elapsed,
+		BytesIn:   s.BytesIn - prev.BytesIn,
+		BytesOut:  s.BytesOut - prev.BytesOut,
+		FramesIn:  s.FramesIn - prev.FramesIn,
+		FramesOut: s.FramesOut - prev.FramesOut,
+		RekeysIn:  s.RekeysIn - prev.RekeysIn,
+		RekeysOut: s.RekeysOut - prev.RekeysOut,
+
+		HandshakeDuration: s.HandshakeDuration,
+		LastActivity:      s.LastActivity,
+	}
+}
+
+// InRate returns the bytes a second received over Elapsed.
+func (s ConnStats) InRate() float64 {
+	return perSecond(s.BytesIn, s.Elapsed)
+}
+
+// OutRate returns the bytes a second sent over Elapsed.
+func (s ConnStats) OutRate() float64 {
+	return perSecond(s.BytesOut, s.Elapsed)
+}
+
+// AvgFrameIn returns the average size of the frames received, or zero
+// if there were none.
+func (s ConnStats) AvgFrameIn() float64 {
+	if s.FramesIn == 0 {
+		return 0
+	}
+
+	return float64(s.BytesIn) / float64(s.FramesIn)
+}
+
+// AvgFrameOut returns the average size of the frames sent, or zero if
+// there were none.
+func (s ConnStats) AvgFrameOut() float64 {
+	if s.FramesOut == 0 {
+		return 0
+	}
+
+	return float64(s.BytesOut) / float64(s.FramesOut)
+}
+
+func perSecond(n int64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return float64(n) / d.Seconds()
+}
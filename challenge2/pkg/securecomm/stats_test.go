@@ -0,0 +1,97 @@
+package securecomm
+
+import (
+	"testing"
+	"time"
+)
+
+func TestConnStats(t *testing.T) {
+	addr, _ := startServer(t, new(Server))
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	before := conn.Stats()
+	for i := 0; i < 3; i++ {
+		if err := conn.WriteMsg(make([]byte, 100)); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := conn.ReadMsg(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stats := conn.Stats().Sub(before)
+	if stats.FramesOut != 3 || stats.FramesIn != 3 {
+		t.Fatalf("Expected 3 frames each way, got %+v", stats)
+	}
+	if stats.AvgFrameOut() < 100 || stats.AvgFrameIn() < 100 {
+		t.Errorf("Expected frames of at least 100 bytes, got %+v", stats)
+	}
+	if stats.Elapsed <= 0 || stats.OutRate() <= 0 || stats.InRate() <= 0 {
+		t.Errorf("Expected positive rates, got %+v", stats)
+	}
+	if (ConnStats{}).AvgFrameIn() != 0 || (ConnStats{BytesIn: 10}).InRate() != 0 {
+		t.Errorf("Expected empty stats to have zero averages and rates")
+	}
+	if rate := (ConnStats{Elapsed: 2 * time.Second, BytesIn: 10}).InRate(); rate != 5 {
+		t.Errorf("InRate = %v, want 5", rate)
+	}
+}
+
+func TestConnStatsRekeysAndActivity(t *testing.T) {
+	clock := newFakeClock()
+	client, server, err := testPipe(WithClock(clock))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	if stats := client.Stats(); !stats.LastActivity.Equal(clock.Now()) {
+		t.Fatalf("Expected activity at the handshake, got %v", stats.LastActivity)
+	}
+
+	client.SetRekeyPolicy(RekeyPolicy{Frames: 1})
+	clock.Advance(5 * time.Minute)
+	for i := 0; i < 3; i++ {
+		if err := client.WriteMsg([]byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := server.ReadMsg(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// The handshake's transcript used up the first key, so each message
+	// went under a key of its own.
+	sent, received := client.Stats(), server.Stats()
+	if sent.RekeysOut != 3 || received.RekeysIn != 3 || sent.RekeysIn != 0 || received.RekeysOut != 0 {
+		t.Fatalf("Expected three rekeys from client to server, got %+v and %+v", sent, received)
+	}
+	for _, stats := range []ConnStats{sent, received} {
+		if !stats.LastActivity.Equal(clock.Now()) {
+			t.Fatalf("Expected activity %v, got %v", clock.Now(), stats.LastActivity)
+		}
+	}
+	if sub := sent.Sub(ConnStats{RekeysOut: 1}); sub.RekeysOut != 2 || !sub.LastActivity.Equal(sent.LastActivity) {
+		t.Fatalf("Unexpected difference %+v", sub)
+	}
+}
+
+func TestConnStatsHandshakeDuration(t *testing.T) {
+	client, server, err := testPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	for _, conn := range []*SecureConn{client, server} {
+		if d := conn.Stats().HandshakeDuration; d <= 0 || d > time.Minute {
+			t.Fatalf("Unexpected handshake duration %v", d)
+		}
+	}
+}
@@ -0,0 +1,32 @@
+package securecomm
+
+import (
+	"io"
+	"net"
+)
+
+// PipeIO sends what it reads from r to the peer and writes what the peer
+// sends to w, like netcat does with standard input and output. The end
+// of r reaches the peer as a half-close, and PipeIO returns once both
+// directions are done. If either fails, conn is closed.
+func PipeIO(conn net.Conn, r io.Reader, w io.Writer) error {
+	errs := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(conn, r)
+		if cw, ok := conn.(interface{ CloseWrite() error }); ok && err == nil {
+			err = cw.CloseWrite()
+		}
+		if err != nil {
+			conn.Close()
+		}
+		errs <- err
+	}()
+
+	if _, err := io.Copy(w, conn); err != nil {
+		conn.Close()
+		<-errs
+		return err
+	}
+
+	return <-errs
+}
@@ -0,0 +1,37 @@
+package securecomm
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestPipeIO(t *testing.T) {
+	client, server, err := testPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	// Each side only finishes once the other's input has run out, so
+	// both half-closes must get through.
+	var fromServer, fromClient bytes.Buffer
+	errs := make(chan error, 1)
+	go func() {
+		errs <- PipeIO(server, strings.NewReader("from the server"), &fromClient)
+	}()
+	if err := PipeIO(client, strings.NewReader(strings.Repeat("from the client ", 10000)), &fromServer); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-errs; err != nil {
+		t.Fatal(err)
+	}
+
+	if fromServer.String() != "from the server" {
+		t.Errorf("Client got %q", fromServer.String())
+	}
+	if fromClient.String() != strings.Repeat("from the client ", 10000) {
+		t.Errorf("Server got %d bytes, not what was sent", fromClient.Len())
+	}
+}
@@ -0,0 +1,222 @@
+package securecomm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// A tamper decides what a tamperProxy sends on in place of the i-th
+// frame it intercepts, counting from when it was armed: nothing to drop
+// it, or several frames. cut ends the stream after them.
+type tamper func(i int, frame []byte) (out [][]byte, cut bool)
+
+// tamperProxy sits between a client and a server, passing traffic on
+// untouched until it is armed, once the handshake is done. From then on
+// it picks the frames the client sends out of the stream and lets its
+// tamper have its way with them.
+type tamperProxy struct {
+	tamper tamper
+	armed  atomic.Bool
+}
+
+// start listens for a client and connects it to the server at target,
+// returning the address to dial.
+func (p *tamperProxy) start(t *testing.T, target string) string {
+	l := testutil.Listen(t)
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		client, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer client.Close()
+		server, err := net.Dial("tcp", target)
+		if err != nil {
+			return
+		}
+		defer server.Close()
+
+		go io.Copy(client, server)
+		p.intercept(server, bufio.NewReader(client))
+	}()
+
+	return l.Addr().String()
+}
+
+// intercept passes what the client sends on to server.
+func (p *tamperProxy) intercept(server net.Conn, client *bufio.Reader) {
+	for i := 0; ; {
+		// Waiting for more to arrive before looking at armed makes sure
+		// everything before arming went through untouched.
+		if _, err := client.Peek(1); err != nil {
+			return
+		}
+		if !p.armed.Load() {
+			b, _ := client.Peek(client.Buffered())
+			server.Write(b)
+			client.Discard(len(b))
+			continue
+		}
+
+		frame := make([]byte, frameHeaderSize)
+		if _, err := io.ReadFull(client, frame); err != nil {
+			return
+		}
+		frame = append(frame, make([]byte, binary.BigEndian.Uint32(frame))...)
+		if _, err := io.ReadFull(client, frame[frameHeaderSize:]); err != nil {
+			return
+		}
+
+		out, cut := p.tamper(i, frame)
+		i++
+		for _, f := range out {
+			server.Write(f)
+		}
+		if cut {
+			return
+		}
+	}
+}
+
+// flipBit returns a tamper that flips a bit of the byte at offset in the
+// second frame.
+func flipBit(offset int) tamper {
+	return func(i int, frame []byte) ([][]byte, bool) {
+		if i == 1 {
+			frame[offset] ^= 0x01
+		}
+		return [][]byte{frame}, false
+	}
+}
+
+func TestTamperDetected(t *testing.T) {
+	var held []byte
+	tests := []struct {
+		name   string
+		tamper tamper
+		want   error
+	}{
+		{"flip sealed box", flipBit(frameHeaderSize + 5), ErrDecryptFailed},
+		{"flip authenticator", flipBit(frameHeaderSize), ErrDecryptFailed},
+		{"flip nonce", flipBit(4 + 3), ErrDecryptFailed},
+		{"flip sequence number", flipBit(4 + nonceSize - 1), ErrDecryptFailed},
+		{"shorten length", flipBit(3), ErrDecryptFailed},
+		{"inflate length", flipBit(0), ErrMessageTooLarge},
+		{"duplicate", func(i int, frame []byte) ([][]byte, bool) {
+			if i == 1 {
+				return [][]byte{frame, frame}, false
+			}
+			return [][]byte{frame}, false
+		}, ErrReplayed},
+		{"drop", func(i int, frame []byte) ([][]byte, bool) {
+			if i == 1 {
+				return nil, false
+			}
+			return [][]byte{frame}, false
+		}, ErrReplayed},
+		{"reorder", func(i int, frame []byte) ([][]byte, bool) {
+			switch i {
+			case 1:
+				held = frame
+				return nil, false
+			case 2:
+				return [][]byte{frame, held}, false
+			}
+			return [][]byte{frame}, false
+		}, ErrReplayed},
+		{"replace", func(i int, frame []byte) ([][]byte, bool) {
+			if i == 1 {
+				forged := append([]byte(nil), frame[:frameHeaderSize]...)
+				forged = append(forged, bytes.Repeat([]byte{0xaa}, len(frame)-frameHeaderSize)...)
+				return [][]byte{forged}, false
+			}
+			return [][]byte{frame}, false
+		}, ErrDecryptFailed},
+		{"truncate", func(i int, frame []byte) ([][]byte, bool) {
+			if i == 1 {
+				return [][]byte{frame[:len(frame)/2]}, true
+			}
+			return [][]byte{frame}, false
+		}, io.ErrUnexpectedEOF},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			received := make(chan []byte, 10)
+			failed := make(chan error, 1)
+			s := &Server{Handler: func(ctx context.Context, conn *SecureConn) error {
+				for {
+					message, err := conn.ReadMsg()
+					if err != nil {
+						failed <- err
+						return err
+					}
+					received <- message
+					if string(message) == "handshake done" {
+						if err := conn.WriteMsg(message); err != nil {
+							return err
+						}
+					}
+				}
+			}}
+			addr, _ := startServer(t, s)
+			defer s.Close()
+
+			proxy := &tamperProxy{tamper: test.tamper}
+			conn, err := Dial(proxy.start(t, addr))
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+
+			// The echo shows that everything sent so far went through,
+			// so that the proxy starts on a frame once armed.
+			if err := conn.WriteMsg([]byte("handshake done")); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := conn.ReadMsg(); err != nil {
+				t.Fatal(err)
+			}
+			<-received
+			proxy.armed.Store(true)
+
+			sent := []string{"first", "second", "third", "fourth"}
+			for _, message := range sent {
+				if err := conn.WriteMsg([]byte(message)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			select {
+			case err := <-failed:
+				if !errors.Is(err, test.want) {
+					t.Fatalf("Expected %v, got %v", test.want, err)
+				}
+			case <-time.After(5 * time.Second):
+				t.Fatal("Tampering went unnoticed")
+			}
+
+			// Whatever came through before the tampering was noticed
+			// must be what was sent, in order.
+			close(received)
+			i := 0
+			for message := range received {
+				if i >= len(sent) || string(message) != sent[i] {
+					t.Fatalf("Received %q as message %d", message, i)
+				}
+				i++
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package securecomm
+
+import (
+	"net"
+	"time"
+)
+
+// Default timeouts of the phases of a handshake, which all fit within
+// DefaultHandshakeTimeout.
+const (
+	DefaultConnectTimeout = 10 * time.Second
+	DefaultSendTimeout    = 10 * time.Second
+	DefaultReceiveTimeout = 10 * time.Second
+)
+
+// HandshakeTimeouts bound the phases of setting up a connection, so that
+// a peer that stalls part way through cannot hold on to the goroutine
+// waiting for it until the handshake as a whole times out. Each is cut
+// short by the overall handshake timeout. Zero fields mean the defaults.
+type HandshakeTimeouts struct {
+	// Connect bounds how long Dial waits for the underlying connection,
+	// through any proxy, before the handshake starts.
+	Connect time.Duration
+
+	// Send bounds writing our preamble and, in the legacy handshake,
+	// our public keys.
+	Send time.Duration
+
+	// Receive bounds reading the peer's preamble and, in the legacy
+	// handshake, its public keys, once ours are sent.
+	Receive time.Duration
+}
+
+func (t HandshakeTimeouts) connect() time.Duration {
+	return timeoutOr(t.Connect, DefaultConnectTimeout)
+}
+
+func (t HandshakeTimeouts) send() time.Duration {
+	return timeoutOr(t.Send, DefaultSendTimeout)
+}
+
+func (t HandshakeTimeouts) receive() time.Duration {
+	return timeoutOr(t.Receive, DefaultReceiveTimeout)
+}
+
+func timeoutOr(configured, fallback time.Duration) time.Duration {
+	if configured > 0 {
+		return configured
+	}
+
+	return fallback
+}
+
+// handshakePhases sets the deadlines of conn for the phases of a
+// handshake, and puts back the deadline of the handshake as a whole once
+// they are over.
+type handshakePhases struct {
+	conn     net.Conn
+	timeouts HandshakeTimeouts
+
+	// deadline is that of the whole handshake, zero for none, and
+	// interrupt is closed when the handshake is abandoned, which sets a
+	// deadline in the past that must not be undone.
+	deadline  time.Time
+	interrupt <-chan struct{}
+}
+
+func (cfg config) phases(conn net.Conn) handshakePhases {
+	return handshakePhases{conn: conn, timeouts: cfg.timeouts, deadline: cfg.deadline, interrupt: cfg.interrupt}
+}
+
+// within returns timeout from now, or the deadline of the handshake if
+// that comes first.
+func (p handshakePhases) within(timeout time.Duration) time.Time {
+	t := time.Now().Add(timeout)
+	if !p.deadline.IsZero() && p.deadline.Before(t) {
+		return p.deadline
+	}
+
+	return t
+}
+
+// send starts the phase of sending our keys.
+func (p handshakePhases) send() error {
+	return p.conn.SetWriteDeadline(p.within(p.timeouts.send()))
+}
+
+// receive starts the phase of receiving the peer's keys.
+func (p handshakePhases) receive() error {
+	return p.conn.SetReadDeadline(p.within(p.timeouts.receive()))
+}
+
+// end puts back the deadline of the whole handshake.
+func (p handshakePhases) end() error {
+	if err := p.conn.SetDeadline(p.deadline); err != nil {
+		return err
+	}
+
+	// Setting the deadline may have undone that of an interrupt that
+	// came just before.
+	select {
+	case <-p.interrupt:
+		return p.conn.SetDeadline(time.Unix(1, 0))
+	default:
+		return nil
+	}
+}
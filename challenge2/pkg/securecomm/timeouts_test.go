@@ -0,0 +1,178 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// stallTransport connects to nothing: its connections never deliver
+// anything, and writes to them block, as if the peer stopped reading.
+type stallTransport struct{}
+
+func (stallTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	conn, _ := net.Pipe()
+	return conn, nil
+}
+
+// hangTransport never manages to connect.
+type hangTransport struct{}
+
+func (hangTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func TestHandshakeTimeoutsClient(t *testing.T) {
+	silent := testutil.Listen(t)
+	go func() {
+		for {
+			conn, err := silent.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	timeouts := HandshakeTimeouts{Connect: 50 * time.Millisecond, Send: 50 * time.Millisecond, Receive: 50 * time.Millisecond}
+	tests := []struct {
+		name      string
+		transport Transport
+		want      error
+	}{
+		{"connect", hangTransport{}, context.DeadlineExceeded},
+		{"send", stallTransport{}, os.ErrDeadlineExceeded},
+		{"receive", nil, os.ErrDeadlineExceeded},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			d := Dialer{Transport: test.transport}
+			start := time.Now()
+			_, err := d.Dial(silent.Addr().String(), WithHandshakeTimeouts(timeouts))
+			if !errors.Is(err, test.want) {
+				t.Fatalf("Expected %v, got %v", test.want, err)
+			}
+			if elapsed := time.Since(start); elapsed > 5*time.Second {
+				t.Fatalf("Gave up after %s, well past the phase timeout", elapsed)
+			}
+		})
+	}
+}
+
+func TestHandshakeTimeoutsServer(t *testing.T) {
+	errs := make(chan error, 1)
+	s := &Server{Options: []Option{
+		WithHandshakeTimeouts(HandshakeTimeouts{Receive: 50 * time.Millisecond}),
+		WithErrorHandler(func(addr net.Addr, err error) { errs <- err }),
+	}}
+	l := &deadlineListener{Listener: testutil.Listen(t)}
+	go s.Serve(l)
+	defer s.Close()
+	addr := l.Addr().String()
+
+	// A client that connects and says nothing is dropped once the
+	// receive phase times out, not the whole handshake.
+	stalled, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stalled.Close()
+	select {
+	case err := <-errs:
+		if !errors.Is(err, os.ErrDeadlineExceeded) {
+			t.Fatalf("Expected the receive phase to time out, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Expected the stalled client to be dropped")
+	}
+
+	// The phase timeouts end with the handshake. They are deadlines of
+	// the connection, which the system clock rather than a Clock runs
+	// out, so rather than wait for one to pass, check that none is left
+	// once the server echoes.
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMsg([]byte("established")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := conn.ReadMsg(); err != nil || string(echo) != "established" {
+		t.Fatalf("Unexpected echo %q, %v", echo, err)
+	}
+	if read, write := l.last().deadlines(); !read.IsZero() || !write.IsZero() {
+		t.Fatalf("Expected the handshake to clear its deadlines, got read %v and write %v", read, write)
+	}
+}
+
+// deadlineListener accepts connections that remember their deadlines.
+type deadlineListener struct {
+	net.Listener
+
+	mu    sync.Mutex
+	conns []*deadlineConn
+}
+
+func (l *deadlineListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	dc := &deadlineConn{Conn: conn}
+	l.mu.Lock()
+	l.conns = append(l.conns, dc)
+	l.mu.Unlock()
+
+	return dc, nil
+}
+
+// last returns the connection l accepted last.
+func (l *deadlineListener) last() *deadlineConn {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.conns[len(l.conns)-1]
+}
+
+// deadlineConn is a connection that remembers the deadlines set on it.
+type deadlineConn struct {
+	net.Conn
+
+	mu          sync.Mutex
+	read, write time.Time
+}
+
+func (c *deadlineConn) SetDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.read, c.write = t, t
+	c.mu.Unlock()
+	return c.Conn.SetDeadline(t)
+}
+
+func (c *deadlineConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.read = t
+	c.mu.Unlock()
+	return c.Conn.SetReadDeadline(t)
+}
+
+func (c *deadlineConn) SetWriteDeadline(t time.Time) error {
+	c.mu.Lock()
+	c.write = t
+	c.mu.Unlock()
+	return c.Conn.SetWriteDeadline(t)
+}
+
+func (c *deadlineConn) deadlines() (read, write time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.read, c.write
+}
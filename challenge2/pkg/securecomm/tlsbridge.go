@@ -0,0 +1,70 @@
+package securecomm
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"os"
+)
+
+// TLSBridge terminates TLS for the clients connecting on l and forwards
+// each through a secure connection made with dial, typically to a server
+// using ForwardHandler, until l fails. It lets clients that only speak
+// TLS reach services exposed over the secure channel while they are
+// moved over to it. Errors with a single connection are logged, as
+// Tunnel does.
+func TLSBridge(l net.Listener, config *tls.Config, dial func() (net.Conn, error)) error {
+	return Tunnel(tls.NewListener(l, config), dial)
+}
+
+// TLSForwardHandler returns a Handler that connects each client to the
+// TLS service at addr and copies between the two, as ForwardHandler does
+// for plaintext ones, so that services only reachable over TLS can be
+// reached through the secure channel. A nil config verifies the service
+// against the system roots under the host name in addr.
+func TLSForwardHandler(addr string, config *tls.Config) Handler {
+	return func(ctx context.Context, conn *SecureConn) error {
+		d := tls.Dialer{Config: config}
+		target, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Errorf("forward: %w", err)
+		}
+		defer target.Close()
+
+		return splice(conn, target)
+	}
+}
+
+// LoadTLSServerConfig returns the TLS configuration of a server with the
+// certificate chain and key in the PEM files certFile and keyFile.
+func LoadTLSServerConfig(certFile, keyFile string) (*tls.Config, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS certificate: %w", err)
+	}
+
+	return &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}, nil
+}
+
+// LoadTLSClientConfig returns the TLS configuration of a client that
+// trusts the certificates in the PEM file caFile, or the system roots if
+// it is empty.
+func LoadTLSClientConfig(caFile string) (*tls.Config, error) {
+	config := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile == "" {
+		return config, nil
+	}
+
+	data, err := os.ReadFile(caFile)
+	if err != nil {
+		return nil, fmt.Errorf("load TLS roots: %w", err)
+	}
+	config.RootCAs = x509.NewCertPool()
+	if !config.RootCAs.AppendCertsFromPEM(data) {
+		return nil, fmt.Errorf("load TLS roots: no certificates in %s", caFile)
+	}
+
+	return config, nil
+}
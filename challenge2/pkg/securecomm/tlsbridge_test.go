@@ -0,0 +1,165 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// testTLSConfigs returns the configuration of a TLS server for
+// 127.0.0.1, with a self-signed certificate, and of a client trusting it.
+func testTLSConfigs(t testing.TB) (server, client *tls.Config) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "127.0.0.1"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	roots := x509.NewCertPool()
+	roots.AddCert(cert)
+
+	return &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{der}, PrivateKey: key}}},
+		&tls.Config{RootCAs: roots}
+}
+
+// reversed returns message reversed, as serveReversed answers it.
+func reversed(message string) []byte {
+	b := []byte(message)
+	for i, j := 0, len(b)-1; i < j; i, j = i+1, j-1 {
+		b[i], b[j] = b[j], b[i]
+	}
+
+	return b
+}
+
+func TestTLSBridge(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+
+	backend := testutil.Listen(t)
+	go serveReversed(backend)
+
+	s := &Server{Handler: ForwardHandler(backend.Addr().String())}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	local := testutil.Listen(t)
+	go TLSBridge(local, serverConfig, func() (net.Conn, error) {
+		return Dial(addr)
+	})
+
+	conn, err := tls.Dial("tcp", local.Addr().String(), clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, "tls only client"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := reversed("tls only client"); !bytes.Equal(reply, expected) {
+		t.Fatalf("Got %q through the bridge, expected %q", reply, expected)
+	}
+}
+
+func TestTLSForwardHandler(t *testing.T) {
+	serverConfig, clientConfig := testTLSConfigs(t)
+
+	backend, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go serveReversed(backend)
+
+	s := &Server{Handler: TLSForwardHandler(backend.Addr().String(), clientConfig)}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	if _, err := io.WriteString(conn, "to a tls service"); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	reply, err := io.ReadAll(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := reversed("to a tls service"); !bytes.Equal(reply, expected) {
+		t.Fatalf("Got %q from the TLS service, expected %q", reply, expected)
+	}
+}
+
+func TestTLSForwardHandlerUntrusted(t *testing.T) {
+	serverConfig, _ := testTLSConfigs(t)
+
+	backend, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer backend.Close()
+	go serveReversed(backend)
+
+	errs := make(chan error, 1)
+	s := &Server{
+		Handler: TLSForwardHandler(backend.Addr().String(), &tls.Config{RootCAs: x509.NewCertPool()}),
+		Options: []Option{WithErrorHandler(func(addr net.Addr, err error) { errs <- err })},
+	}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.ReadMsg(); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+	if err := <-errs; err == nil {
+		t.Error("Expected the untrusted certificate to reach the error handler")
+	}
+}
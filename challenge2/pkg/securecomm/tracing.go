@@ -0,0 +1,76 @@
+package securecomm
+
+import (
+	"context"
+	"net"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/trace"
+)
+
+// frameTracer starts the spans of the frames one connection reads and
+// writes, under the span of whoever set the connection up.
+type frameTracer struct {
+	tracer trace.Tracer
+	ctx    context.Context
+
+	// attrs describe the connection, and are added to every span.
+	attrs []trace.Attribute
+}
+
+// start starts a span for the frame numbered frame, of size bytes. It
+// returns nil when t is nil, so that untraced connections only pay for
+// the check.
+func (t *frameTracer) start(name string, frame int64, size int) trace.Span {
+	if t == nil {
+		return nil
+	}
+
+	attrs := append([]trace.Attribute{trace.Int("securecomm.frame", frame), trace.Int("securecomm.frame.bytes", int64(size))}, t.attrs...)
+	_, span := t.tracer.Start(t.ctx, name, attrs...)
+	return span
+}
+
+// traceHandshake starts the span of a handshake on the server side if
+// server, and returns a function that ends it with the outcome of the
+// handshake, and sets sc up to trace its frames if it succeeded.
+func traceHandshake(cfg config, server bool, conn net.Conn) (end func(sc *SecureConn, err error)) {
+	if cfg.tracer == nil {
+		return func(*SecureConn, error) {}
+	}
+
+	ctx := cfg.traceContext
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	role := "client"
+	if server {
+		role = "server"
+	}
+	attrs := []trace.Attribute{trace.String("securecomm.role", role)}
+	if remote := conn.RemoteAddr(); remote != nil {
+		attrs = append(attrs, trace.String("net.peer.addr", remote.String()))
+	}
+	_, span := cfg.tracer.Start(ctx, "securecomm.handshake", attrs...)
+
+	return func(sc *SecureConn, err error) {
+		if sc != nil {
+			attrs := []trace.Attribute{
+				trace.String("securecomm.role", role),
+				trace.String("securecomm.peer", sc.peerFingerprint()),
+				trace.String("securecomm.cipher", sc.CipherSuite().String()),
+			}
+			span.SetAttributes(append(attrs, trace.Bool("securecomm.resumed", sc.Resumed()))...)
+
+			t := &frameTracer{tracer: cfg.tracer, ctx: ctx, attrs: attrs}
+			sc.reader.tracer, sc.writer.tracer = t, t
+		}
+		span.End(err)
+	}
+}
+
+// endSpan ends span, if there is one, with err.
+func endSpan(span trace.Span, err error) {
+	if span != nil {
+		span.End(err)
+	}
+}
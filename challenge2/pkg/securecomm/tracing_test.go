@@ -0,0 +1,90 @@
+package securecomm
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/trace"
+)
+
+func TestTracer(t *testing.T) {
+	var serverRec, clientRec trace.Recorder
+	s := &Server{Options: []Option{WithTracer(&serverRec)}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	ctx, parent := clientRec.Start(context.Background(), "test")
+	conn, err := DialContext(ctx, addr, WithTracer(&clientRec))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Write([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.ReadFull(conn, make([]byte, 4)); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	parent.End(nil)
+
+	spans := map[string][]*trace.RecordedSpan{}
+	for _, span := range clientRec.Spans() {
+		spans[span.Name] = append(spans[span.Name], span)
+	}
+
+	handshakes := spans["securecomm.handshake"]
+	if len(handshakes) != 1 {
+		t.Fatalf("expected one handshake span, got %d", len(handshakes))
+	}
+	hs := handshakes[0]
+	if hs.Parent == nil || hs.Parent.Name != "test" || hs.Err != nil {
+		t.Errorf("unexpected handshake span: %+v", hs)
+	}
+	if role, _ := hs.Attr("securecomm.role"); role != "client" {
+		t.Errorf("expected the client role, got %v", role)
+	}
+	if peer, _ := hs.Attr("securecomm.peer"); peer != conn.peerFingerprint() {
+		t.Errorf("expected peer %s, got %v", conn.peerFingerprint(), peer)
+	}
+
+	// The server ends its handshake span before echoing.
+	served := serverRec.Spans()
+	if len(served) == 0 || served[0].Name != "securecomm.handshake" || served[0].Parent != nil {
+		t.Fatalf("expected the server to trace its handshake, got %+v", served)
+	}
+	if role, _ := served[0].Attr("securecomm.role"); role != "server" {
+		t.Errorf("expected the server role, got %v", role)
+	}
+
+	for _, name := range []string{"securecomm.frame.write", "securecomm.frame.read"} {
+		if len(spans[name]) == 0 {
+			t.Errorf("expected %s spans", name)
+			continue
+		}
+		span := spans[name][0]
+		if span.Parent == nil || span.Parent.Name != "test" {
+			t.Errorf("expected %s under the dialing span, got %+v", name, span.Parent)
+		}
+		if n, _ := span.Attr("securecomm.frame.bytes"); n.(int64) <= frameHeaderSize {
+			t.Errorf("expected %s to count the frame's bytes, got %v", name, n)
+		}
+	}
+}
+
+func TestTracerRecordsHandshakeErrors(t *testing.T) {
+	var rec trace.Recorder
+	s := &Server{Options: []Option{WithPSK([]byte("server")), WithErrorHandler(func(net.Addr, error) {})}}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	if _, err := Dial(addr, WithPSK([]byte("client")), WithTracer(&rec)); err == nil {
+		t.Fatal("expected mismatched keys to fail the handshake")
+	}
+
+	spans := rec.Spans()
+	if len(spans) != 1 || spans[0].Name != "securecomm.handshake" || spans[0].Err == nil {
+		t.Fatalf("expected a failed handshake span, got %+v", spans)
+	}
+}
@@ -0,0 +1,240 @@
+package securecomm
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// transferChunkSize is how much of a file goes in each message.
+const transferChunkSize = DefaultMaxMessageSize
+
+// Transfer statuses the receiver ends a transfer with.
+const (
+	transferOK       = 0
+	transferMismatch = 1
+)
+
+// A FileManifest describes a file sent with SendFile. It is the first
+// message of a transfer.
+type FileManifest struct {
+	Name   string
+	Size   int64
+	SHA256 [sha256.Size]byte
+}
+
+// MarshalBinary encodes m as the size in 8 bytes, the SHA-256, and the
+// name.
+func (m FileManifest) MarshalBinary() ([]byte, error) {
+	if len(m.Name) > 255 {
+		return nil, fmt.Errorf("file name %q longer than 255 bytes", m.Name)
+	}
+
+	b := make([]byte, 8, 8+sha256.Size+len(m.Name))
+	binary.BigEndian.PutUint64(b, uint64(m.Size))
+	b = append(b, m.SHA256[:]...)
+
+	return append(b, m.Name...), nil
+}
+
+// UnmarshalBinary decodes a manifest encoded by MarshalBinary.
+func (m *FileManifest) UnmarshalBinary(b []byte) error {
+	if len(b) < 8+sha256.Size {
+		return errors.New("file manifest truncated")
+	}
+
+	m.Size = int64(binary.BigEndian.Uint64(b))
+	if m.Size < 0 {
+		return fmt.Errorf("file size %d out of range", uint64(m.Size))
+	}
+	copy(m.SHA256[:], b[8:])
+	m.Name = string(b[8+sha256.Size:])
+
+	return nil
+}
+
+// SendFile sends the file at path to a peer running ReceiveFile. If the
+// peer already has the start of it from an interrupted transfer, only
+// the rest is sent. progress, if not nil, is called after each chunk
+// with how much of the file the peer has.
+func SendFile(conn *SecureConn, path string, progress func(done, total int64)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	manifest := FileManifest{Name: filepath.Base(path)}
+	h := sha256.New()
+	if manifest.Size, err = io.Copy(h, f); err != nil {
+		return fmt.Errorf("hash %s: %w", path, err)
+	}
+	copy(manifest.SHA256[:], h.Sum(nil))
+
+	message, err := manifest.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	if err := conn.WriteMsg(message); err != nil {
+		return fmt.Errorf("send manifest: %w", err)
+	}
+
+	reply, err := conn.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("read offset: %w", err)
+	}
+	if len(reply) != 8 {
+		return fmt.Errorf("unexpected offset of %d bytes", len(reply))
+	}
+	offset := int64(binary.BigEndian.Uint64(reply))
+	if offset < 0 || offset > manifest.Size {
+		return fmt.Errorf("offset %d out of range", uint64(offset))
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	chunk := make([]byte, transferChunkSize)
+	for done := offset; done < manifest.Size; {
+		n, err := io.ReadFull(f, chunk[:min(int64(len(chunk)), manifest.Size-done)])
+		if err != nil {
+			return fmt.Errorf("read %s: %w", path, err)
+		}
+		if err := conn.WriteMsg(chunk[:n]); err != nil {
+			return fmt.Errorf("send chunk: %w", err)
+		}
+		done += int64(n)
+		if progress != nil {
+			progress(done, manifest.Size)
+		}
+	}
+
+	status, err := conn.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("read status: %w", err)
+	}
+	if len(status) != 1 || status[0] != transferOK {
+		return ErrChecksumMismatch
+	}
+
+	return nil
+}
+
+// ReceiveFile receives a file sent with SendFile into dir and returns
+// its manifest. The file is written under a temporary name and only
+// takes its own once its SHA-256 checks out. The temporary file is kept
+// if the transfer is interrupted, so that sending the same file again
+// picks up where it stopped. progress, if not nil, is called after each
+// chunk with how much of the file has arrived.
+func ReceiveFile(conn *SecureConn, dir string, progress func(done, total int64)) (FileManifest, error) {
+	var manifest FileManifest
+	message, err := conn.ReadMsg()
+	if err != nil {
+		return manifest, fmt.Errorf("read manifest: %w", err)
+	}
+	if err := manifest.UnmarshalBinary(message); err != nil {
+		return manifest, err
+	}
+	if manifest.Name == "" || manifest.Name == "." || manifest.Name == ".." || strings.ContainsAny(manifest.Name, `/\`) {
+		return manifest, fmt.Errorf("bad file name %q", manifest.Name)
+	}
+
+	// Naming the partial file after the checksum too means a different
+	// file of the same name is never resumed onto it.
+	path := filepath.Join(dir, manifest.Name)
+	partial := filepath.Join(dir, fmt.Sprintf(".%s.%s.part", manifest.Name, hex.EncodeToString(manifest.SHA256[:8])))
+	f, err := os.OpenFile(partial, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return manifest, err
+	}
+	defer f.Close()
+
+	offset, err := f.Seek(0, io.SeekEnd)
+	if err != nil {
+		return manifest, err
+	}
+	if offset > manifest.Size {
+		if err := f.Truncate(0); err != nil {
+			return manifest, err
+		}
+		if offset, err = f.Seek(0, io.SeekStart); err != nil {
+			return manifest, err
+		}
+	}
+
+	reply := make([]byte, 8)
+	binary.BigEndian.PutUint64(reply, uint64(offset))
+	if err := conn.WriteMsg(reply); err != nil {
+		return manifest, fmt.Errorf("send offset: %w", err)
+	}
+
+	for done := offset; done < manifest.Size; {
+		chunk, err := conn.ReadMsg()
+		if err != nil {
+			return manifest, fmt.Errorf("read chunk: %w", err)
+		}
+		if int64(len(chunk)) > manifest.Size-done {
+			return manifest, errors.New("file larger than its manifest")
+		}
+		if _, err := f.Write(chunk); err != nil {
+			return manifest, err
+		}
+		done += int64(len(chunk))
+		if progress != nil {
+			progress(done, manifest.Size)
+		}
+	}
+
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return manifest, err
+	}
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return manifest, fmt.Errorf("hash %s: %w", partial, err)
+	}
+	var sum [sha256.Size]byte
+	copy(sum[:], h.Sum(nil))
+	if sum != manifest.SHA256 {
+		f.Close()
+		os.Remove(partial)
+		conn.WriteMsg([]byte{transferMismatch})
+		return manifest, fmt.Errorf("%s: %w", manifest.Name, ErrChecksumMismatch)
+	}
+
+	if err := f.Close(); err != nil {
+		return manifest, err
+	}
+	if err := os.Rename(partial, path); err != nil {
+		return manifest, err
+	}
+	if err := conn.WriteMsg([]byte{transferOK}); err != nil {
+		return manifest, fmt.Errorf("send status: %w", err)
+	}
+
+	return manifest, nil
+}
+
+// ReceiveHandler returns a Handler that receives a file sent with
+// SendFile from each client into dir.
+func ReceiveHandler(dir string) Handler {
+	return func(ctx context.Context, conn *SecureConn) error {
+		manifest, err := ReceiveFile(conn, dir, nil)
+		if err != nil {
+			return fmt.Errorf("receive: %w", err)
+		}
+
+		stats := conn.Stats()
+		slog.Info("file received", "remote", conn.RemoteAddr().String(), "name", manifest.Name, "bytes", manifest.Size,
+			"duration", stats.Elapsed.Round(time.Millisecond), "bytes_per_second", int64(stats.InRate()))
+		return nil
+	}
+}
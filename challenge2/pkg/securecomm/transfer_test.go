@@ -0,0 +1,126 @@
+package securecomm
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// transfer sends the file at path from one end of a pipe and receives it
+// into dir at the other, returning what each side reported.
+func transfer(t *testing.T, path, dir string) (sendErr, receiveErr error, received int64) {
+	t.Helper()
+	client, server, err := testPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- SendFile(client, path, nil)
+	}()
+
+	first := int64(-1)
+	_, receiveErr = ReceiveFile(server, dir, func(done, total int64) {
+		if first < 0 {
+			first = done
+		}
+		received = done
+	})
+	if receiveErr != nil {
+		server.Close()
+	}
+
+	return <-errs, receiveErr, received - first
+}
+
+func TestSendFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transfer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	in, out := filepath.Join(dir, "in"), filepath.Join(dir, "out")
+	for _, d := range []string{in, out} {
+		if err := os.Mkdir(d, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	data := bytes.Repeat([]byte("0123456789"), 10000)
+	path := filepath.Join(in, "data.bin")
+	if err := ioutil.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	sum := sha256.Sum256(data)
+	partial := filepath.Join(out, fmt.Sprintf(".data.bin.%s.part", hex.EncodeToString(sum[:8])))
+
+	// An interrupted transfer left the first part behind, so only the
+	// rest is sent.
+	if err := ioutil.WriteFile(partial, data[:60000], 0600); err != nil {
+		t.Fatal(err)
+	}
+	sendErr, receiveErr, _ := transfer(t, path, out)
+	if sendErr != nil || receiveErr != nil {
+		t.Fatalf("Transfer failed: %v, %v", sendErr, receiveErr)
+	}
+	got, err := ioutil.ReadFile(filepath.Join(out, "data.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("Received file differs from the one sent")
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file to be gone, got %v", err)
+	}
+
+	// A partial file that does not match is thrown away.
+	corrupt := append([]byte(nil), data[:60000]...)
+	corrupt[0] ^= 1
+	if err := ioutil.WriteFile(partial, corrupt, 0600); err != nil {
+		t.Fatal(err)
+	}
+	sendErr, receiveErr, _ = transfer(t, path, out)
+	if !errors.Is(sendErr, ErrChecksumMismatch) || !errors.Is(receiveErr, ErrChecksumMismatch) {
+		t.Fatalf("Expected ErrChecksumMismatch on both sides, got %v, %v", sendErr, receiveErr)
+	}
+	if _, err := os.Stat(partial); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial file to be removed, got %v", err)
+	}
+
+	// So the next attempt starts over.
+	sendErr, receiveErr, sent := transfer(t, path, out)
+	if sendErr != nil || receiveErr != nil {
+		t.Fatalf("Transfer failed: %v, %v", sendErr, receiveErr)
+	}
+	if sent+transferChunkSize < int64(len(data)) {
+		t.Errorf("Expected the whole file to be sent again, only %d bytes were", sent)
+	}
+}
+
+func TestReceiveFileRejectsPaths(t *testing.T) {
+	for _, name := range []string{"", ".", "..", "../escape", "sub/file"} {
+		client, server, err := testPipe()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message, _ := FileManifest{Name: name}.MarshalBinary()
+		go client.WriteMsg(message)
+		if _, err := ReceiveFile(server, os.TempDir(), nil); err == nil {
+			t.Errorf("Expected the name %q to be refused", name)
+		}
+
+		client.Close()
+		server.Close()
+	}
+}
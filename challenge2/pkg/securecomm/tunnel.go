@@ -0,0 +1,239 @@
+package securecomm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"time"
+)
+
+// ForwardHandler returns a Handler that connects each client to the
+// plaintext service at addr and copies between the two, so that a
+// protocol with no encryption of its own can be reached through the
+// secure channel.
+func ForwardHandler(addr string) Handler {
+	return func(ctx context.Context, conn *SecureConn) error {
+		var d net.Dialer
+		target, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return fmt.Errorf("forward: %w", err)
+		}
+		defer target.Close()
+
+		return splice(conn, target)
+	}
+}
+
+// Tunnel accepts plaintext connections on l and forwards each through a
+// secure connection made with dial, typically to a server using
+// ForwardHandler, until l fails. Errors with a single connection are
+// logged.
+func Tunnel(l net.Listener, dial func() (net.Conn, error)) error {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return fmt.Errorf("create connection: %w", err)
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			sc, err := dial()
+			if err != nil {
+				slog.Warn("tunnel dial failed", "remote", conn.RemoteAddr().String(), "err", err)
+				return
+			}
+			defer sc.Close()
+
+			if err := splice(conn, sc); err != nil {
+				slog.Warn("tunnel connection failed", "remote", conn.RemoteAddr().String(), "err", err)
+			}
+		}(conn)
+	}
+}
+
+// splice copies between a and b in both directions until both are done.
+// Each side's end of stream reaches the other as a half-close, so
+// protocols that rely on one still work. If either direction fails,
+// both connections are closed.
+func splice(a, b net.Conn) error {
+	errs := make(chan error, 2)
+	go func() { errs <- copyAndCloseWrite(a, b) }()
+	go func() { errs <- copyAndCloseWrite(b, a) }()
+
+	if err := <-errs; err != nil {
+		a.Close()
+		b.Close()
+		<-errs
+		return err
+	}
+
+	return <-errs
+}
+
+// copyAndCloseWrite copies src to dst, then half-closes dst if it can.
+func copyAndCloseWrite(dst, src net.Conn) error {
+	if _, err := io.Copy(dst, src); err != nil {
+		return err
+	}
+
+	if cw, ok := dst.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+
+	return nil
+}
+
+// Messages that set up a reverse tunnel connection.
+const (
+	// reverseConnect is sent by the server to a waiting client when it
+	// has a connection for it.
+	reverseConnect = 1
+
+	// reverseConnected and reverseFailed answer reverseConnect,
+	// reporting whether the client reached its service.
+	reverseConnected = 2
+	reverseFailed    = 3
+)
+
+// reverseIdle is how many connections ReverseTunnel keeps waiting at
+// the server.
+const reverseIdle = 4
+
+// reverseRetryDelay is how long ReverseTunnel waits before replacing a
+// connection that failed, so that a server that keeps turning it away
+// is not hammered.
+const reverseRetryDelay = time.Second
+
+// reverseHandoffTimeout bounds how long the server waits for a client to
+// answer reverseConnect before trying another.
+const reverseHandoffTimeout = 10 * time.Second
+
+// ReverseHandler returns a Handler for clients running ReverseTunnel. It
+// accepts plaintext connections on l, on the server's side, and hands
+// each to a waiting client, which connects it to a service on its own
+// side. This makes a service behind the client's NAT or firewall
+// reachable from the server's network.
+func ReverseHandler(l net.Listener) Handler {
+	conns := make(chan net.Conn)
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				slog.Error("reverse tunnel accept failed", "err", err)
+				return
+			}
+			conns <- conn
+		}
+	}()
+
+	return func(ctx context.Context, sc *SecureConn) error {
+		var conn net.Conn
+		select {
+		case conn = <-conns:
+		case <-ctx.Done():
+			return nil
+		}
+
+		status, err := reverseHandoff(sc)
+		if err != nil {
+			// The client is gone, so let another one have the
+			// connection.
+			go func() { conns <- conn }()
+			return fmt.Errorf("reverse tunnel: %w", err)
+		}
+		defer conn.Close()
+		if status != reverseConnected {
+			return errors.New("reverse tunnel: client could not reach its service")
+		}
+
+		return splice(sc, conn)
+	}
+}
+
+// reverseHandoff tells a waiting client there is a connection for it and
+// returns its answer.
+func reverseHandoff(sc *SecureConn) (byte, error) {
+	if err := sc.SetDeadline(time.Now().Add(reverseHandoffTimeout)); err != nil {
+		return 0, err
+	}
+	if err := sc.WriteMsg([]byte{reverseConnect}); err != nil {
+		return 0, err
+	}
+	answer, err := sc.ReadMsg()
+	if err != nil {
+		return 0, err
+	}
+	if len(answer) != 1 {
+		return 0, fmt.Errorf("unexpected answer of %d bytes", len(answer))
+	}
+	if err := sc.SetDeadline(time.Time{}); err != nil {
+		return 0, err
+	}
+
+	return answer[0], nil
+}
+
+// ReverseTunnel keeps secure connections made with dial waiting at a
+// server using ReverseHandler, and connects each connection the server
+// hands over to the service at target. It returns when dialing the
+// server fails. Errors with a single connection are logged.
+func ReverseTunnel(target string, dial func() (*SecureConn, error)) error {
+	errs := make(chan error, reverseIdle)
+	for i := 0; i < reverseIdle; i++ {
+		go func() {
+			for {
+				sc, err := dial()
+				if err != nil {
+					errs <- err
+					return
+				}
+				if err := reverseWait(sc, target); err != nil {
+					slog.Warn("reverse tunnel connection failed", "err", err)
+					time.Sleep(reverseRetryDelay)
+				}
+			}
+		}()
+	}
+
+	return <-errs
+}
+
+// reverseWait waits on sc for the server to hand over a connection, then
+// connects it to target from a goroutine of its own.
+func reverseWait(sc *SecureConn, target string) error {
+	request, err := sc.ReadMsg()
+	if err != nil {
+		sc.Close()
+		return err
+	}
+	if len(request) != 1 || request[0] != reverseConnect {
+		sc.Close()
+		return fmt.Errorf("unexpected request %x", request)
+	}
+
+	service, err := net.Dial("tcp", target)
+	if err != nil {
+		sc.WriteMsg([]byte{reverseFailed})
+		sc.Close()
+		return err
+	}
+	if err := sc.WriteMsg([]byte{reverseConnected}); err != nil {
+		service.Close()
+		sc.Close()
+		return err
+	}
+
+	go func() {
+		defer sc.Close()
+		defer service.Close()
+		if err := splice(service, sc); err != nil {
+			slog.Warn("reverse tunnel connection failed", "target", target, "err", err)
+		}
+	}()
+
+	return nil
+}
@@ -0,0 +1,151 @@
+package securecomm
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/testutil"
+)
+
+// serveReversed answers each connection on l with everything it sent,
+// reversed, once the client half-closes it. It only works if the end of
+// stream makes it through.
+func serveReversed(l net.Listener) {
+	for {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+
+		go func(conn net.Conn) {
+			defer conn.Close()
+
+			data, err := ioutil.ReadAll(conn)
+			if err != nil {
+				return
+			}
+			for i, j := 0, len(data)-1; i < j; i, j = i+1, j-1 {
+				data[i], data[j] = data[j], data[i]
+			}
+			conn.Write(data)
+		}(conn)
+	}
+}
+
+func TestTunnel(t *testing.T) {
+	backend := testutil.Listen(t)
+	go serveReversed(backend)
+
+	s := &Server{Handler: ForwardHandler(backend.Addr().String())}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	local := testutil.Listen(t)
+	go Tunnel(local, func() (net.Conn, error) {
+		return Dial(addr)
+	})
+
+	for _, message := range []string{"legacy protocol", "another connection"} {
+		conn, err := net.Dial("tcp", local.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if _, err := io.WriteString(conn, message); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []byte(message)
+		for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+			expected[i], expected[j] = expected[j], expected[i]
+		}
+		if !bytes.Equal(reply, expected) {
+			t.Fatalf("Got %q through the tunnel, expected %q", reply, expected)
+		}
+	}
+}
+
+func TestForwardHandlerUnreachable(t *testing.T) {
+	// Find a port nobody listens on.
+	l := testutil.Listen(t)
+	unreachable := l.Addr().String()
+	l.Close()
+
+	errs := make(chan error, 1)
+	s := &Server{
+		Handler: ForwardHandler(unreachable),
+		Options: []Option{WithErrorHandler(func(addr net.Addr, err error) { errs <- err })},
+	}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := conn.ReadMsg(); err == nil {
+		t.Error("Expected the connection to be closed")
+	}
+	if err := <-errs; err == nil {
+		t.Error("Expected the failure to reach the error handler")
+	}
+}
+
+func TestReverseTunnel(t *testing.T) {
+	// The service is on the client's side this time.
+	backend := testutil.Listen(t)
+	go serveReversed(backend)
+
+	public := testutil.Listen(t)
+
+	s := &Server{Handler: ReverseHandler(public)}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	go ReverseTunnel(backend.Addr().String(), func() (*SecureConn, error) {
+		return Dial(addr)
+	})
+
+	for _, message := range []string{"from outside", "and again"} {
+		conn, err := net.Dial("tcp", public.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+		conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+		if _, err := io.WriteString(conn, message); err != nil {
+			t.Fatal(err)
+		}
+		if err := conn.(*net.TCPConn).CloseWrite(); err != nil {
+			t.Fatal(err)
+		}
+		reply, err := ioutil.ReadAll(conn)
+		conn.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []byte(message)
+		for i, j := 0, len(expected)-1; i < j; i, j = i+1, j-1 {
+			expected[i], expected[j] = expected[j], expected[i]
+		}
+		if !bytes.Equal(reply, expected) {
+			t.Fatalf("Got %q through the reverse tunnel, expected %q", reply, expected)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package securecomm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+// Test vectors pin down the wire format with fixed keys and nonces, so
+// implementations of the protocol in other languages can check that
+// they produce and accept exactly the same bytes. All byte strings are
+// hex encoded.
+type Vectors struct {
+	Frames     []FrameVector     `json:"frames"`
+	Handshakes []HandshakeVector `json:"handshakes"`
+}
+
+// A FrameVector is a single frame sealed with a known key and nonce.
+type FrameVector struct {
+	Name  string `json:"name"`
+	Suite string `json:"suite"`
+	Key   string `json:"key"`
+
+	// NoncePrefix is the random part of the nonce; the sequence number
+	// Seq makes up the rest.
+	NoncePrefix string `json:"nonce_prefix"`
+	Seq         uint64 `json:"seq"`
+
+	Flags   byte   `json:"flags"`
+	Payload string `json:"payload"`
+
+	// Padding is how many bytes of padding the frame holds; the frame
+	// is padded when it is not zero.
+	Padding int `json:"padding,omitempty"`
+
+	Frame string `json:"frame"`
+}
+
+// A HandshakeVector is a legacy key swap between a client and a server
+// whose per-connection private keys are known, offering Features.
+type HandshakeVector struct {
+	Name          string `json:"name"`
+	ClientPrivate string `json:"client_private"`
+	ServerPrivate string `json:"server_private"`
+	Features      uint32 `json:"features"`
+
+	// ClientHello and ServerHello are what each side sends: its
+	// preamble and its public key.
+	ClientHello string `json:"client_hello"`
+	ServerHello string `json:"server_hello"`
+
+	ClientToServerKey string `json:"client_to_server_key"`
+	ServerToClientKey string `json:"server_to_client_key"`
+	Transcript        string `json:"transcript"`
+
+	// BoundClientToServerKey and BoundServerToClientKey are the keys
+	// after they are bound to the transcript, when Features includes
+	// channel binding.
+	BoundClientToServerKey string `json:"bound_client_to_server_key,omitempty"`
+	BoundServerToClientKey string `json:"bound_server_to_client_key,omitempty"`
+}
+
+// LoadVectors reads the test vectors in the file at path.
+func LoadVectors(path string) (*Vectors, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("load vectors: %w", err)
+	}
+
+	var v Vectors
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, fmt.Errorf("load vectors: %s: %w", path, err)
+	}
+
+	return &v, nil
+}
+
+// Verify checks the frame vector against this implementation: sealing
+// its payload must give its frame, and opening its frame its payload.
+func (v FrameVector) Verify() error {
+	suite, err := ParseCipherSuite(v.Suite)
+	if err != nil {
+		return err
+	}
+	key, err := decodeKey(v.Key)
+	if err != nil {
+		return fmt.Errorf("key: %w", err)
+	}
+	prefix, err := hex.DecodeString(v.NoncePrefix)
+	if err != nil || len(prefix) != seqOffset {
+		return fmt.Errorf("nonce prefix must be %d hex encoded bytes", seqOffset)
+	}
+	payload, err := hex.DecodeString(v.Payload)
+	if err != nil {
+		return fmt.Errorf("payload: %w", err)
+	}
+	expected, err := hex.DecodeString(v.Frame)
+	if err != nil {
+		return fmt.Errorf("frame: %w", err)
+	}
+
+	var frame bytes.Buffer
+	sw := newSecureWriter(&frame, key, nil)
+	sw.suite, sw.seq, sw.Rand = suite, v.Seq, bytes.NewReader(prefix)
+	if v.Padding > 0 {
+		sw.Padding = PaddingPolicy{Buckets: []int{paddedLengthSize + len(payload) + v.Padding}}
+	}
+	if err := sw.writeFrame(v.Flags, payload); err != nil {
+		return err
+	}
+	if !bytes.Equal(frame.Bytes(), expected) {
+		return fmt.Errorf("sealed frame %x, expected %x", frame.Bytes(), expected)
+	}
+
+	sr := newSecureReader(bytes.NewReader(expected), key, nil)
+	sr.suite, sr.seq = suite, v.Seq
+	_, err = sr.readOneFrame()
+	if v.Flags&flagClose != 0 {
+		if err != io.EOF {
+			return fmt.Errorf("opening a close frame gave %v, expected io.EOF", err)
+		}
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("open frame: %w", err)
+	}
+	if !bytes.Equal(sr.unread, payload) {
+		return fmt.Errorf("opened payload %x, expected %x", sr.unread, payload)
+	}
+
+	return nil
+}
+
+// Verify checks the handshake vector against this implementation: both
+// sides must send its hellos and derive its keys and transcript.
+func (v HandshakeVector) Verify() error {
+	clientPriv, err := decodeKey(v.ClientPrivate)
+	if err != nil {
+		return fmt.Errorf("client private key: %w", err)
+	}
+	serverPriv, err := decodeKey(v.ServerPrivate)
+	if err != nil {
+		return fmt.Errorf("server private key: %w", err)
+	}
+
+	var clientPub, serverPub [32]byte
+	curve25519.ScalarBaseMult(&clientPub, clientPriv)
+	curve25519.ScalarBaseMult(&serverPub, serverPriv)
+
+	clientHello := append(preamble(v.Features), clientPub[:]...)
+	serverHello := append(preamble(v.Features), serverPub[:]...)
+
+	version, features, err := negotiate(serverHello[:preambleSize], v.Features)
+	if err != nil {
+		return err
+	}
+
+	clientSecret := precompute(&serverPub, clientPriv)
+	if !bytes.Equal(clientSecret, precompute(&clientPub, serverPriv)) {
+		return errors.New("client and server computed different shared secrets")
+	}
+	clientToServer, err := deriveKey(clientSecret, nil, clientToServerLabel)
+	if err != nil {
+		return err
+	}
+	serverToClient, err := deriveKey(clientSecret, nil, serverToClientLabel)
+	if err != nil {
+		return err
+	}
+
+	transcript := transcriptHash(clientHello, serverHello, version, features)
+	checks := []vectorCheck{
+		{"client hello", clientHello, v.ClientHello},
+		{"server hello", serverHello, v.ServerHello},
+		{"client to server key", clientToServer[:], v.ClientToServerKey},
+		{"server to client key", serverToClient[:], v.ServerToClientKey},
+		{"transcript", transcript, v.Transcript},
+	}
+	if features&featureBinding != 0 {
+		boundClientToServer, err := deriveKey(clientToServer[:], transcript, bindingLabel)
+		if err != nil {
+			return err
+		}
+		boundServerToClient, err := deriveKey(serverToClient[:], transcript, bindingLabel)
+		if err != nil {
+			return err
+		}
+		checks = append(checks,
+			vectorCheck{"bound client to server key", boundClientToServer[:], v.BoundClientToServerKey},
+			vectorCheck{"bound server to client key", boundServerToClient[:], v.BoundServerToClientKey},
+		)
+	}
+
+	for _, check := range checks {
+		if hex.EncodeToString(check.got) != check.expected {
+			return fmt.Errorf("%s %x, expected %s", check.name, check.got, check.expected)
+		}
+	}
+
+	return nil
+}
+
+// A vectorCheck compares a value computed from a vector with the hex
+// encoded value the vector expects.
+type vectorCheck struct {
+	name     string
+	got      []byte
+	expected string
+}
+
+func decodeKey(s string) (*[32]byte, error) {
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != 32 {
+		return nil, errors.New("expected 32 hex encoded bytes")
+	}
+
+	var key [32]byte
+	copy(key[:], b)
+	return &key, nil
+}
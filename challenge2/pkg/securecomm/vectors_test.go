@@ -0,0 +1,167 @@
+package securecomm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"io/ioutil"
+	"testing"
+
+	"golang.org/x/crypto/curve25519"
+)
+
+var updateVectors = flag.Bool("update-vectors", false, "regenerate testdata/vectors.json")
+
+const vectorsPath = "testdata/vectors.json"
+
+// generateVectors builds the test vectors from fixed keys and nonces.
+func generateVectors(t *testing.T) Vectors {
+	key := bytes.Repeat([]byte{0x42}, 32)
+	prefix := make([]byte, seqOffset)
+	for i := range prefix {
+		prefix[i] = byte(i)
+	}
+
+	frames := []FrameVector{
+		{Name: "first frame", Suite: "nacl-box", Payload: "hello world"},
+		{Name: "later frame", Suite: "nacl-box", Seq: 1 << 40, Payload: "hello world"},
+		{Name: "continued message", Suite: "nacl-box", Seq: 3, Flags: flagMore, Payload: "to be continued"},
+		{Name: "empty message", Suite: "nacl-box", Seq: 4},
+		{Name: "padded frame", Suite: "nacl-box", Seq: 5, Payload: "short", Padding: 23},
+		{Name: "close frame", Suite: "nacl-box", Seq: 6, Flags: flagClose},
+		{Name: "xchacha20-poly1305 frame", Suite: "xchacha20-poly1305", Payload: "hello world"},
+		{Name: "xchacha20-poly1305 padded frame", Suite: "xchacha20-poly1305", Seq: 7, Payload: "short", Padding: 11},
+	}
+	for i := range frames {
+		v := &frames[i]
+		v.Key, v.NoncePrefix = hex.EncodeToString(key), hex.EncodeToString(prefix)
+		v.Payload = hex.EncodeToString([]byte(v.Payload))
+
+		suite, err := ParseCipherSuite(v.Suite)
+		if err != nil {
+			t.Fatal(err)
+		}
+		payload, _ := hex.DecodeString(v.Payload)
+
+		var frame bytes.Buffer
+		var k [32]byte
+		copy(k[:], key)
+		sw := newSecureWriter(&frame, &k, nil)
+		sw.suite, sw.seq, sw.Rand = suite, v.Seq, bytes.NewReader(prefix)
+		if v.Padding > 0 {
+			sw.Padding = PaddingPolicy{Buckets: []int{paddedLengthSize + len(payload) + v.Padding}}
+		}
+		if err := sw.writeFrame(v.Flags, payload); err != nil {
+			t.Fatal(err)
+		}
+		v.Frame = hex.EncodeToString(frame.Bytes())
+	}
+
+	var handshakes []HandshakeVector
+	for _, hs := range []struct {
+		name     string
+		features uint32
+	}{
+		{"legacy", 0},
+		{"legacy with rekeying", featureRekey},
+		{"legacy with channel binding", featureRekey | featureBinding},
+	} {
+		var clientPriv, serverPriv, clientPub, serverPub [32]byte
+		for i := range clientPriv {
+			clientPriv[i], serverPriv[i] = byte(i+1), byte(0xff-i)
+		}
+		curve25519.ScalarBaseMult(&clientPub, &clientPriv)
+		curve25519.ScalarBaseMult(&serverPub, &serverPriv)
+
+		clientHello := append(preamble(hs.features), clientPub[:]...)
+		serverHello := append(preamble(hs.features), serverPub[:]...)
+		secret := precompute(&serverPub, &clientPriv)
+		clientToServer, err := deriveKey(secret, nil, clientToServerLabel)
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverToClient, err := deriveKey(secret, nil, serverToClientLabel)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		transcript := transcriptHash(clientHello, serverHello, maxVersion, hs.features)
+		vector := HandshakeVector{
+			Name:              hs.name,
+			ClientPrivate:     hex.EncodeToString(clientPriv[:]),
+			ServerPrivate:     hex.EncodeToString(serverPriv[:]),
+			Features:          hs.features,
+			ClientHello:       hex.EncodeToString(clientHello),
+			ServerHello:       hex.EncodeToString(serverHello),
+			ClientToServerKey: hex.EncodeToString(clientToServer[:]),
+			ServerToClientKey: hex.EncodeToString(serverToClient[:]),
+			Transcript:        hex.EncodeToString(transcript),
+		}
+		if hs.features&featureBinding != 0 {
+			boundClientToServer, err := deriveKey(clientToServer[:], transcript, bindingLabel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			boundServerToClient, err := deriveKey(serverToClient[:], transcript, bindingLabel)
+			if err != nil {
+				t.Fatal(err)
+			}
+			vector.BoundClientToServerKey = hex.EncodeToString(boundClientToServer[:])
+			vector.BoundServerToClientKey = hex.EncodeToString(boundServerToClient[:])
+		}
+		handshakes = append(handshakes, vector)
+	}
+
+	return Vectors{Frames: frames, Handshakes: handshakes}
+}
+
+func TestVectors(t *testing.T) {
+	if *updateVectors {
+		data, err := json.MarshalIndent(generateVectors(t), "", "  ")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(vectorsPath, append(data, '\n'), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	v, err := LoadVectors(vectorsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(v.Frames) == 0 || len(v.Handshakes) == 0 {
+		t.Fatal("The vector file holds no vectors")
+	}
+
+	for _, frame := range v.Frames {
+		if err := frame.Verify(); err != nil {
+			t.Errorf("frame %s: %v", frame.Name, err)
+		}
+	}
+	for _, hs := range v.Handshakes {
+		if err := hs.Verify(); err != nil {
+			t.Errorf("handshake %s: %v", hs.Name, err)
+		}
+	}
+}
+
+func TestVectorsDetectMismatch(t *testing.T) {
+	v, err := LoadVectors(vectorsPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frame := v.Frames[0]
+	frame.Payload = hex.EncodeToString([]byte("hello wOrld"))
+	if frame.Verify() == nil {
+		t.Error("Expected a frame vector with the wrong payload to fail")
+	}
+
+	hs := v.Handshakes[0]
+	hs.Transcript = hex.EncodeToString(make([]byte, 32))
+	if hs.Verify() == nil {
+		t.Error("Expected a handshake vector with the wrong transcript to fail")
+	}
+}
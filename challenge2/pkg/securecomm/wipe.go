@@ -0,0 +1,85 @@
+package securecomm
+
+import (
+	"bytes"
+	"net"
+)
+
+// Closing a SecureConn wipes the key material and plaintext it holds,
+// so that a process whose memory is later read, through a core dump,
+// swap or an exploit, does not give away the traffic of connections
+// that ended long before. Rekeying likewise overwrites the key it
+// replaces and the ephemeral secrets it derived the new one from.
+//
+// Only what the connection owns is wiped: the session keys, the
+// ephemeral key pair of a legacy handshake and the buffers frames were
+// decrypted and built in. An identity or Noise static key belongs to
+// its caller, who may still need it. Go gives no guarantee that the
+// runtime kept no other copy, as when a stack grows, and the AEAD a
+// cipher suite makes keeps its own copy of the key beyond reach, but
+// the copies that stay live for the life of the connection are gone.
+
+// wipeBuffer zeroes buf up to its capacity.
+func wipeBuffer(buf []byte) {
+	clear(buf[:cap(buf)])
+}
+
+// wipeBytesBuffer zeroes what buf has held and empties it.
+func wipeBytesBuffer(buf *bytes.Buffer) {
+	buf.Reset()
+	wipeBuffer(buf.Bytes())
+}
+
+// wipe forgets the AEAD and zeroes the key it was made for.
+func (c *aeadCache) wipe() {
+	clear(c.key[:])
+	c.aead = nil
+}
+
+// wipe zeroes the compressor's buffer and drops its deflate state,
+// which holds recent plaintext.
+func (c *compressor) wipe() {
+	wipeBytesBuffer(&c.buf)
+	clear(c.out[:cap(c.out)])
+	c.w = nil
+}
+
+// wipe zeroes the decompressor's buffer and drops its inflate state.
+func (d *decompressor) wipe() {
+	wipeBytesBuffer(&d.buf)
+	clear(d.out[:cap(d.out)])
+	d.src.Reset(nil)
+	d.r = nil
+}
+
+// wipe zeroes the reader's key, the plaintext it holds and its private
+// key, if the reader owns it. It waits for a read in progress to return
+// first, so the underlying connection must be closed already.
+func (sr *SecureReader) wipe() {
+	sr.mu.Lock()
+	defer sr.mu.Unlock()
+
+	clear(sr.key[:])
+	sr.aead.wipe()
+	wipeBuffer(sr.plaintext)
+	wipeBuffer(sr.assembled)
+	sr.plaintext, sr.unread, sr.assembled = nil, nil, nil
+	sr.inflate.wipe()
+	if kp, ok := sr.priv.(*KeyPair); ok && sr.ownsPriv {
+		clear(kp.Private[:])
+	}
+}
+
+// wipe zeroes the writer's key, leaving it unable to seal frames. It
+// waits for a write in progress to return first.
+func (sw *SecureWriter) wipe() {
+	sw.mu.Lock()
+	defer sw.mu.Unlock()
+
+	clear(sw.key[:])
+	sw.aead.wipe()
+	sw.deflate.wipe()
+	if sw.broken == nil {
+		sw.broken = net.ErrClosed
+	}
+}
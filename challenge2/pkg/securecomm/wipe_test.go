@@ -0,0 +1,110 @@
+package securecomm
+
+import (
+	"errors"
+	"net"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestCloseWipesKeys(t *testing.T) {
+	s := &Server{}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr, WithCompression())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMsg([]byte("secret secret secret secret")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); err != nil {
+		t.Fatal(err)
+	}
+	priv := conn.reader.priv.(*KeyPair)
+	plaintext := conn.reader.plaintext[:cap(conn.reader.plaintext)]
+	conn.Close()
+
+	var zero [32]byte
+	if conn.reader.key != zero || conn.writer.key != zero {
+		t.Error("Expected the session keys to be wiped")
+	}
+	if conn.reader.aead.key != zero || conn.writer.aead.key != zero {
+		t.Error("Expected the cached AEAD keys to be wiped")
+	}
+	if priv.Private != zero {
+		t.Error("Expected the ephemeral private key to be wiped")
+	}
+	for _, b := range plaintext {
+		if b != 0 {
+			t.Fatal("Expected the decrypted plaintext to be wiped")
+		}
+	}
+	if err := conn.WriteMsg([]byte("late")); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("Expected writing with wiped keys to fail with net.ErrClosed, got %v", err)
+	}
+}
+
+func TestCloseKeepsIdentityKey(t *testing.T) {
+	identity, err := GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	private := identity.Private
+
+	s := &Server{}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr, WithIdentity(identity))
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// The caller's key outlives the connection.
+	if identity.Private != private {
+		t.Fatal("Expected closing a connection to leave the identity key alone")
+	}
+}
+
+func TestClosedConnCollected(t *testing.T) {
+	s := &Server{}
+	addr, _ := startServer(t, s)
+	defer s.Close()
+
+	conn, err := Dial(addr, WithKeepalive(KeepalivePolicy{Interval: time.Hour}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteMsg([]byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.ReadMsg(); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	// Nothing, like a keepalive goroutine, may hold on to the
+	// connection and the keys it held once it is closed. The finalizer
+	// goes on the writer, which only the connection refers to, since
+	// the connection is in a cycle with its reader's control callback
+	// and cycles are never finalized.
+	collected := make(chan struct{})
+	runtime.SetFinalizer(conn.writer, func(*SecureWriter) { close(collected) })
+	conn = nil
+
+	deadline := time.After(5 * time.Second)
+	for {
+		runtime.GC()
+		select {
+		case <-collected:
+			return
+		case <-deadline:
+			t.Fatal("Expected the closed connection to be garbage collected")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
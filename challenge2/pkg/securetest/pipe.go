@@ -0,0 +1,112 @@
+package securetest
+
+import (
+	"context"
+	"net"
+	"sync"
+
+	"github.com/jpreese/go-mentor/challenge2/internal/memconn"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// Pipe returns both ends of an in-memory connection that has completed
+// the handshake, for unit testing code that uses a SecureConn without
+// binding a port. opts configure both ends, the client as Dial and the
+// server as Serve would, except that the server's errors fail Pipe
+// rather than go to any error handler opts set.
+func Pipe(opts ...securecomm.Option) (client, server *securecomm.SecureConn, err error) {
+	clientConn, serverConn := memconn.Pipe()
+
+	failed := make(chan error, 1)
+	serverOpts := append(opts[:len(opts):len(opts)], securecomm.WithErrorHandler(func(addr net.Addr, err error) {
+		select {
+		case failed <- err:
+		default:
+		}
+	}))
+	l, err := securecomm.NewSecureListener(newPipeListener(serverConn), serverOpts...)
+	if err != nil {
+		clientConn.Close()
+		serverConn.Close()
+		return nil, nil, err
+	}
+	defer l.Close()
+
+	type result struct {
+		sc  *securecomm.SecureConn
+		err error
+	}
+	accepted := make(chan result, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			accepted <- result{err: err}
+			return
+		}
+		accepted <- result{sc: conn.(*securecomm.SecureConn)}
+	}()
+
+	d := securecomm.Dialer{Transport: pipeTransport{clientConn}}
+	client, err = d.Dial("pipe", opts...)
+	if err != nil {
+		// Unblock the server's end.
+		serverConn.Close()
+		return nil, nil, err
+	}
+
+	select {
+	case r := <-accepted:
+		if r.err != nil {
+			client.Close()
+			return nil, nil, r.err
+		}
+		return client, r.sc, nil
+	case err := <-failed:
+		client.Close()
+		return nil, nil, err
+	}
+}
+
+// pipeTransport dials the client's end of a pipe.
+type pipeTransport struct {
+	conn net.Conn
+}
+
+func (t pipeTransport) Dial(ctx context.Context, addr string) (net.Conn, error) {
+	return t.conn, nil
+}
+
+// pipeListener accepts the server's end of a pipe, once.
+type pipeListener struct {
+	addr net.Addr
+
+	mu   sync.Mutex
+	conn net.Conn
+
+	closed    chan struct{}
+	closeOnce sync.Once
+}
+
+func newPipeListener(conn net.Conn) *pipeListener {
+	return &pipeListener{addr: conn.LocalAddr(), conn: conn, closed: make(chan struct{})}
+}
+
+func (l *pipeListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	conn := l.conn
+	l.conn = nil
+	l.mu.Unlock()
+	if conn != nil {
+		return conn, nil
+	}
+
+	<-l.closed
+	return nil, net.ErrClosed
+}
+
+func (l *pipeListener) Close() error {
+	l.closeOnce.Do(func() { close(l.closed) })
+	return nil
+}
+
+func (l *pipeListener) Addr() net.Addr { return l.addr }
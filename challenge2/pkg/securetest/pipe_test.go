@@ -0,0 +1,93 @@
+package securetest
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+func TestPipe(t *testing.T) {
+	key, err := securecomm.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client, server, err := Pipe(securecomm.WithIdentity(key))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	if identity, ok := client.PeerIdentity(); !ok || identity != key.Public {
+		t.Error("Expected the client to see the identity both ends were given")
+	}
+
+	go func() {
+		io.Copy(server, server)
+		server.CloseWrite()
+	}()
+
+	if err := client.WriteMsg([]byte("ping")); err != nil {
+		t.Fatal(err)
+	}
+	if echo, err := client.ReadMsg(); err != nil || string(echo) != "ping" {
+		t.Fatalf("Unexpected echo %q, %v", echo, err)
+	}
+
+	if err := client.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.ReadMsg(); err != io.EOF {
+		t.Fatalf("Expected io.EOF once the server finished, got %v", err)
+	}
+}
+
+func TestPipeHandshakeFails(t *testing.T) {
+	// The IK pattern cannot start without the server's static key.
+	if client, server, err := Pipe(securecomm.WithNoise(securecomm.NoiseConfig{Pattern: securecomm.NoiseIK})); err == nil {
+		client.Close()
+		server.Close()
+		t.Fatal("Expected the handshake to fail")
+	}
+}
+
+func TestPipeDebugWire(t *testing.T) {
+	var log lockedBuffer
+	client, server, err := Pipe(securecomm.WithDebugWire(&log))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer client.Close()
+	defer server.Close()
+
+	go client.WriteMsg([]byte("hello"))
+	if message, err := server.ReadMsg(); err != nil || string(message) != "hello" {
+		t.Fatalf("Unexpected message %q, %v", message, err)
+	}
+	if !strings.Contains(log.String(), "send frame") {
+		t.Fatal("Expected the frames to be logged")
+	}
+}
+
+// lockedBuffer is a bytes.Buffer both ends of a pipe can log to.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
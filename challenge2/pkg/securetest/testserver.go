@@ -0,0 +1,77 @@
+// Package securetest provides utilities for testing code that uses
+// securecomm: a server on a loopback address, for integration tests
+// that go through the real accept and handshake path without wiring up
+// listeners by hand, and an in-memory pipe, for unit tests of protocol
+// handlers that bind no port at all.
+package securetest
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// A TestServer is a securecomm.Server on a loopback address, for
+// integration tests.
+type TestServer struct {
+	// Addr is the address the server listens on.
+	Addr string
+
+	// Server is the server itself, for tests that inspect it or shut
+	// it down by other means.
+	Server *securecomm.Server
+
+	// Dialer is what Dial connects with. Tests may change it before
+	// dialing.
+	Dialer *securecomm.Dialer
+
+	t         testing.TB
+	served    chan error
+	closeOnce sync.Once
+}
+
+// StartTestServer starts a securecomm.Server serving handler,
+// securecomm.EchoHandler when nil, with opts, and closes it when the
+// test ends. It fails the test if the server cannot start.
+func StartTestServer(t testing.TB, handler securecomm.Handler, opts ...securecomm.Option) *TestServer {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("start test server: %v", err)
+	}
+
+	ts := &TestServer{
+		Addr:   l.Addr().String(),
+		Server: &securecomm.Server{Handler: handler, Options: opts},
+		Dialer: &securecomm.Dialer{},
+		t:      t,
+		served: make(chan error, 1),
+	}
+	go func() {
+		ts.served <- ts.Server.Serve(l)
+	}()
+	t.Cleanup(ts.Close)
+
+	return ts
+}
+
+// Dial connects a client to the server with opts.
+func (ts *TestServer) Dial(opts ...securecomm.Option) (*securecomm.SecureConn, error) {
+	return ts.Dialer.Dial(ts.Addr, opts...)
+}
+
+// Close closes the server and its connections and waits for it to stop,
+// failing the test if it stopped for any other reason. It is called
+// when the test ends, but may be called earlier.
+func (ts *TestServer) Close() {
+	ts.closeOnce.Do(func() {
+		ts.Server.Close()
+		if err := <-ts.served; !errors.Is(err, securecomm.ErrServerClosed) {
+			ts.t.Errorf("test server stopped: %v", err)
+		}
+	})
+}
@@ -0,0 +1,53 @@
+package securetest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+func TestStartTestServer(t *testing.T) {
+	ts := StartTestServer(t, func(ctx context.Context, conn *securecomm.SecureConn) error {
+		message, err := conn.ReadMsg()
+		if err != nil {
+			return err
+		}
+		return conn.WriteMsg([]byte(strings.ToUpper(string(message))))
+	})
+
+	conn, err := ts.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if err := conn.WriteMsg([]byte("integration")); err != nil {
+		t.Fatal(err)
+	}
+	if reply, err := conn.ReadMsg(); err != nil || string(reply) != "INTEGRATION" {
+		t.Fatalf("Unexpected reply %q, %v", reply, err)
+	}
+
+	ts.Close()
+	if _, err := ts.Dial(); err == nil {
+		t.Fatal("Expected dialing a closed test server to fail")
+	}
+}
+
+func TestStartTestServerOptions(t *testing.T) {
+	serverKey, err := securecomm.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := StartTestServer(t, nil, securecomm.WithIdentity(serverKey))
+
+	conn, err := ts.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if key, ok := conn.PeerIdentity(); !ok || key != serverKey.Public {
+		t.Fatal("Expected the test server to handshake with its options")
+	}
+}
@@ -0,0 +1,157 @@
+// Package cli implements the command line of the mosaic command, which
+// builds photo mosaics and which the gomentor command also serves as its
+// mosaic subcommand.
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/jpreese/go-mentor/challenge3/pkg/mosaic"
+)
+
+const usage = `Usage: %s <command> [arguments]
+
+Commands:
+  index <dir>                    print the average color of every tile in the directory
+  generate <tiles> <target>      rebuild the target image from the tiles in the directory`
+
+// program is the name of the command; see Main.
+var program = "mosaic"
+
+// Main runs the mosaic command, and gomentor mosaic, with args[0]
+// naming index or generate. It takes its arguments as
+// [github.com/jpreese/go-mentor/cli.Main] does.
+func Main(name string, args []string) {
+	log.SetFlags(0)
+	program = name
+
+	if len(args) < 1 {
+		log.Fatalf(usage, program)
+	}
+
+	var err error
+	switch command, args := args[0], args[1:]; command {
+	case "index":
+		err = runIndex(args)
+	case "generate":
+		err = runGenerate(args)
+	default:
+		log.Fatalf("unknown command %q\n\n"+usage, command, program)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// indexFlags registers the flags that say how tiles are indexed.
+func indexFlags(flags *flag.FlagSet) (tileSize, workers *int) {
+	tileSize = flags.Int("tile", mosaic.DefaultTileSize, "width and height of each tile in pixels")
+	workers = flags.Int("workers", runtime.NumCPU(), "number of tiles to decode at once")
+
+	return tileSize, workers
+}
+
+// runIndex prints the path and average color of every tile in a
+// directory.
+func runIndex(args []string) error {
+	flags := flag.NewFlagSet("index", flag.ExitOnError)
+	tileSize, workers := indexFlags(flags)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s index [flags] <dir>\n", program)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	idx, err := mosaic.BuildIndex(flags.Arg(0), mosaic.WithTileSize(*tileSize), mosaic.WithWorkers(*workers))
+	if err != nil {
+		return err
+	}
+	for _, tile := range idx.Tiles {
+		fmt.Printf("#%02x%02x%02x  %s\n", tile.Color.R, tile.Color.G, tile.Color.B, tile.Path)
+	}
+
+	return nil
+}
+
+// runGenerate writes the mosaic of a target image built from the tiles
+// in a directory.
+func runGenerate(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	tileSize, workers := indexFlags(flags)
+	out := flags.String("o", "mosaic.png", "file to write the mosaic to, as a JPEG if it ends in .jpg or .jpeg and a PNG otherwise")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s generate [flags] <tiles> <target>\n", program)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	idx, err := mosaic.BuildIndex(flags.Arg(0), mosaic.WithTileSize(*tileSize), mosaic.WithWorkers(*workers))
+	if err != nil {
+		return err
+	}
+
+	target, err := decodeFile(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	m, err := mosaic.Generate(target, idx)
+	if err != nil {
+		return err
+	}
+
+	return encodeFile(*out, m)
+}
+
+func decodeFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return nil, fmt.Errorf("decode %s: %w", path, err)
+	}
+
+	return img, nil
+}
+
+// encodeFile writes img to path in the format its extension names.
+func encodeFile(path string, img image.Image) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jpg", ".jpeg":
+		err = jpeg.Encode(file, img, nil)
+	default:
+		err = png.Encode(file, img)
+	}
+	if err != nil {
+		file.Close()
+		return fmt.Errorf("encode %s: %w", path, err)
+	}
+
+	return file.Close()
+}
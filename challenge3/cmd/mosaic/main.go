@@ -0,0 +1,12 @@
+// Command mosaic builds photo mosaics out of directories of images.
+package main
+
+import (
+	"os"
+
+	"github.com/jpreese/go-mentor/challenge3/cli"
+)
+
+func main() {
+	cli.Main("mosaic", os.Args[1:])
+}
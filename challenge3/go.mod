@@ -0,0 +1,3 @@
+module github.com/jpreese/go-mentor/challenge3
+
+go 1.23
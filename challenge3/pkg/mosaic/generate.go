@@ -0,0 +1,32 @@
+package mosaic
+
+import (
+	"fmt"
+	"image"
+	"image/draw"
+)
+
+// Generate rebuilds target from the tiles of idx: each square of the
+// target as large as a tile is replaced by the tile whose average color
+// is closest to its own. The mosaic is the size of the target, with the
+// tiles along its right and bottom edges cropped to fit.
+func Generate(target image.Image, idx *Index) (*image.RGBA, error) {
+	if len(idx.Tiles) == 0 {
+		return nil, ErrNoTiles
+	}
+	if idx.TileSize < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidTileSize, idx.TileSize)
+	}
+
+	b := target.Bounds()
+	dst := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	for y := 0; y < b.Dy(); y += idx.TileSize {
+		for x := 0; x < b.Dx(); x += idx.TileSize {
+			r := image.Rect(x, y, x+idx.TileSize, y+idx.TileSize)
+			tile := idx.nearest(average(target, r.Add(b.Min)))
+			draw.Draw(dst, r, tile.Image, image.Point{}, draw.Src)
+		}
+	}
+
+	return dst, nil
+}
@@ -0,0 +1,55 @@
+package mosaic
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+func TestGenerate(t *testing.T) {
+	idx := &Index{
+		TileSize: 8,
+		Tiles: []Tile{
+			{Color: red, Image: solid(8, 8, red)},
+			{Color: green, Image: solid(8, 8, green)},
+			{Color: blue, Image: solid(8, 8, blue)},
+		},
+	}
+
+	// Reddish on the left and bluish on the right, with an edge that
+	// does not fall on a tile, in an image that does not start at the
+	// origin.
+	target := solid(20, 12, color.RGBA{R: 200, G: 40, B: 40, A: 255}).SubImage(image.Rect(2, 2, 20, 12)).(*image.RGBA)
+	draw.Draw(target, image.Rect(10, 2, 20, 12), image.NewUniform(color.RGBA{R: 10, G: 20, B: 180, A: 255}), image.Point{}, draw.Src)
+
+	m, err := Generate(target, idx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Bounds() != image.Rect(0, 0, 18, 10) {
+		t.Fatalf("expected a mosaic the size of the target, got %v", m.Bounds())
+	}
+
+	tData := []struct {
+		x, y     int
+		expected color.RGBA
+	}{
+		{0, 0, red},
+		{7, 9, red},
+		{8, 0, blue},
+		{17, 9, blue},
+	}
+	for _, exp := range tData {
+		if got := m.RGBAAt(exp.x, exp.y); got != exp.expected {
+			t.Errorf("pixel %d,%d is %v, expected %v", exp.x, exp.y, got, exp.expected)
+		}
+	}
+}
+
+func TestGenerateEmptyIndex(t *testing.T) {
+	if _, err := Generate(solid(8, 8, red), &Index{TileSize: 8}); !errors.Is(err, ErrNoTiles) {
+		t.Fatalf("expected ErrNoTiles, got %v", err)
+	}
+}
@@ -0,0 +1,133 @@
+package mosaic
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	// Tile images may be in any of the formats the standard library
+	// decodes.
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Tile is an image that may stand in for a part of the target.
+type Tile struct {
+	Path string
+
+	// Color is the average color of the tile.
+	Color color.RGBA
+
+	// Image is the tile scaled to the index's tile size.
+	Image *image.RGBA
+}
+
+// Index holds the tiles of a directory, ready to be placed.
+type Index struct {
+	TileSize int
+	Tiles    []Tile
+}
+
+// tileExts are the extensions of the files BuildIndex decodes.
+var tileExts = map[string]bool{
+	".gif":  true,
+	".jpeg": true,
+	".jpg":  true,
+	".png":  true,
+}
+
+// BuildIndex walks dir looking for GIF, JPEG and PNG images and indexes
+// each of them as a tile, decoding them concurrently. The tiles are in
+// the order of their paths.
+func BuildIndex(dir string, opts ...Option) (*Index, error) {
+	cfg := newConfig(opts)
+	if cfg.tileSize < 1 {
+		return nil, ErrInvalidTileSize
+	}
+
+	var paths []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && tileExts[strings.ToLower(filepath.Ext(path))] {
+			paths = append(paths, path)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("index %s: %w", dir, err)
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("index %s: %w", dir, ErrNoTiles)
+	}
+
+	// Each worker fills in the tiles whose positions it takes, so that
+	// they stay in the order WalkDir found them.
+	tiles := make([]Tile, len(paths))
+	errs := make([]error, len(paths))
+	next := make(chan int)
+	var wg sync.WaitGroup
+	for range min(cfg.workers, len(paths)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range next {
+				tiles[i], errs[i] = newTile(paths[i], cfg.tileSize)
+			}
+		}()
+	}
+	for i := range paths {
+		next <- i
+	}
+	close(next)
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("index %s: %w", dir, err)
+		}
+	}
+
+	return &Index{TileSize: cfg.tileSize, Tiles: tiles}, nil
+}
+
+func newTile(path string, size int) (Tile, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return Tile{}, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return Tile{}, fmt.Errorf("decode %s: %w", path, err)
+	}
+	thumb := thumbnail(img, size)
+
+	return Tile{
+		Path:  path,
+		Color: average(thumb, thumb.Bounds()),
+		Image: thumb,
+	}, nil
+}
+
+// nearest returns the tile whose average color is closest to c.
+func (idx *Index) nearest(c color.RGBA) *Tile {
+	var best *Tile
+	bestDistance := -1
+	for i := range idx.Tiles {
+		if d := distance(idx.Tiles[i].Color, c); best == nil || d < bestDistance {
+			best, bestDistance = &idx.Tiles[i], d
+		}
+	}
+
+	return best
+}
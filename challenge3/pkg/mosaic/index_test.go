@@ -0,0 +1,120 @@
+package mosaic
+
+import (
+	"errors"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// writeImage encodes img as a PNG or, by its extension, a JPEG at path.
+func writeImage(t *testing.T, path string, img image.Image) {
+	t.Helper()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	if filepath.Ext(path) == ".jpg" {
+		err = jpeg.Encode(file, img, &jpeg.Options{Quality: 100})
+	} else {
+		err = png.Encode(file, img)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// tileDir writes red, green and blue tiles to a new directory.
+func tileDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	writeImage(t, filepath.Join(dir, "red.png"), solid(40, 30, red))
+	writeImage(t, filepath.Join(dir, "more", "green.png"), solid(8, 8, green))
+	writeImage(t, filepath.Join(dir, "blue.jpg"), solid(16, 16, blue))
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not a tile"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	return dir
+}
+
+func TestBuildIndex(t *testing.T) {
+	dir := tileDir(t)
+
+	idx, err := BuildIndex(dir, WithTileSize(4))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if idx.TileSize != 4 {
+		t.Errorf("expected a tile size of 4, got %d", idx.TileSize)
+	}
+
+	expected := []string{"blue.jpg", filepath.Join("more", "green.png"), "red.png"}
+	var got []string
+	for _, tile := range idx.Tiles {
+		rel, err := filepath.Rel(dir, tile.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, rel)
+		if tile.Image.Bounds() != image.Rect(0, 0, 4, 4) {
+			t.Errorf("expected %s scaled to 4x4, got %v", rel, tile.Image.Bounds())
+		}
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("indexed %v, expected %v", got, expected)
+	}
+
+	if idx.Tiles[1].Color != green || idx.Tiles[2].Color != red {
+		t.Errorf("expected green and red tiles, got %v and %v", idx.Tiles[1].Color, idx.Tiles[2].Color)
+	}
+	// JPEG is lossy, even at its best quality.
+	if d := distance(idx.Tiles[0].Color, blue); d > 3*4*4 {
+		t.Errorf("expected a blue tile, got %v", idx.Tiles[0].Color)
+	}
+}
+
+func TestBuildIndexWorkers(t *testing.T) {
+	dir := tileDir(t)
+
+	one, err := BuildIndex(dir, WithWorkers(1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	many, err := BuildIndex(dir, WithWorkers(8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(one, many) {
+		t.Fatal("expected the same index however many workers build it")
+	}
+}
+
+func TestBuildIndexErrors(t *testing.T) {
+	if _, err := BuildIndex(t.TempDir()); !errors.Is(err, ErrNoTiles) {
+		t.Errorf("expected ErrNoTiles for an empty directory, got %v", err)
+	}
+
+	if _, err := BuildIndex(tileDir(t), WithTileSize(0)); !errors.Is(err, ErrInvalidTileSize) {
+		t.Errorf("expected ErrInvalidTileSize, got %v", err)
+	}
+
+	dir := tileDir(t)
+	if err := os.WriteFile(filepath.Join(dir, "broken.png"), []byte("not a png"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := BuildIndex(dir); err == nil {
+		t.Error("expected an image that does not decode to fail the index")
+	}
+}
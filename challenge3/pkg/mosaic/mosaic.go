@@ -0,0 +1,117 @@
+// Package mosaic builds photo mosaics: it indexes a directory of tile
+// images by their average color, then rebuilds a target image from the
+// tiles whose colors best match each part of it.
+package mosaic
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"runtime"
+)
+
+// DefaultTileSize is the width and height, in pixels, tiles are scaled
+// to unless WithTileSize says otherwise.
+const DefaultTileSize = 32
+
+// ErrNoTiles is returned when a directory holds no tile images.
+var ErrNoTiles = errors.New("no tile images found")
+
+// ErrInvalidTileSize is returned for a tile size that is not positive.
+var ErrInvalidTileSize = errors.New("tile size must be positive")
+
+type config struct {
+	tileSize int
+	workers  int
+}
+
+// Option configures how an index is built.
+type Option func(cfg *config)
+
+// WithTileSize scales tiles to size by size pixels, which is also the
+// size of the part of the target each tile replaces.
+func WithTileSize(size int) Option {
+	return func(cfg *config) {
+		cfg.tileSize = size
+	}
+}
+
+// WithWorkers decodes and scales up to n tile images at once. The
+// default is the number of CPUs.
+func WithWorkers(n int) Option {
+	return func(cfg *config) {
+		cfg.workers = n
+	}
+}
+
+func newConfig(opts []Option) config {
+	cfg := config{
+		tileSize: DefaultTileSize,
+		workers:  runtime.NumCPU(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	if cfg.workers < 1 {
+		cfg.workers = 1
+	}
+
+	return cfg
+}
+
+// average returns the average color of the pixels of img within r.
+func average(img image.Image, r image.Rectangle) color.RGBA {
+	r = r.Intersect(img.Bounds())
+	n := uint64(r.Dx() * r.Dy())
+	if n == 0 {
+		return color.RGBA{}
+	}
+
+	var sr, sg, sb, sa uint64
+	for y := r.Min.Y; y < r.Max.Y; y++ {
+		for x := r.Min.X; x < r.Max.X; x++ {
+			r, g, b, a := img.At(x, y).RGBA()
+			sr += uint64(r)
+			sg += uint64(g)
+			sb += uint64(b)
+			sa += uint64(a)
+		}
+	}
+
+	return color.RGBA{
+		R: uint8(sr / n >> 8),
+		G: uint8(sg / n >> 8),
+		B: uint8(sb / n >> 8),
+		A: uint8(sa / n >> 8),
+	}
+}
+
+// thumbnail crops the largest square from the middle of img and scales
+// it down to size by size pixels, averaging the pixels each one covers.
+func thumbnail(img image.Image, size int) *image.RGBA {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+	origin := b.Min.Add(image.Pt((b.Dx()-side)/2, (b.Dy()-side)/2))
+
+	dst := image.NewRGBA(image.Rect(0, 0, size, size))
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			// Every pixel covers at least one of the source's, even when
+			// scaling up.
+			r := image.Rect(x*side/size, y*side/size, max((x+1)*side/size, x*side/size+1), max((y+1)*side/size, y*side/size+1))
+			dst.SetRGBA(x, y, average(img, r.Add(origin)))
+		}
+	}
+
+	return dst
+}
+
+// distance returns the squared distance between two colors in RGB
+// space.
+func distance(a, b color.RGBA) int {
+	dr := int(a.R) - int(b.R)
+	dg := int(a.G) - int(b.G)
+	db := int(a.B) - int(b.B)
+
+	return dr*dr + dg*dg + db*db
+}
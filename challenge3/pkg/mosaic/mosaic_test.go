@@ -0,0 +1,62 @@
+package mosaic
+
+import (
+	"image"
+	"image/color"
+	"image/draw"
+	"testing"
+)
+
+var (
+	red   = color.RGBA{R: 255, A: 255}
+	green = color.RGBA{G: 255, A: 255}
+	blue  = color.RGBA{B: 255, A: 255}
+)
+
+// solid returns a w by h image filled with c.
+func solid(w, h int, c color.RGBA) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(img, img.Bounds(), image.NewUniform(c), image.Point{}, draw.Src)
+
+	return img
+}
+
+func TestAverage(t *testing.T) {
+	img := solid(4, 2, red)
+	draw.Draw(img, image.Rect(2, 0, 4, 2), image.NewUniform(blue), image.Point{}, draw.Src)
+
+	tData := []struct {
+		r        image.Rectangle
+		expected color.RGBA
+	}{
+		{image.Rect(0, 0, 2, 2), red},
+		{image.Rect(2, 0, 4, 2), blue},
+		{image.Rect(0, 0, 4, 2), color.RGBA{R: 127, B: 127, A: 255}},
+		{image.Rect(3, 0, 9, 9), blue},
+		{image.Rect(5, 5, 9, 9), color.RGBA{}},
+	}
+
+	for _, exp := range tData {
+		if got := average(img, exp.r); got != exp.expected {
+			t.Errorf("average of %v is %v, expected %v", exp.r, got, exp.expected)
+		}
+	}
+}
+
+func TestThumbnail(t *testing.T) {
+	// Red, green and blue columns, of which only green is in the middle
+	// square.
+	img := solid(12, 4, red)
+	draw.Draw(img, image.Rect(4, 0, 8, 4), image.NewUniform(green), image.Point{}, draw.Src)
+	draw.Draw(img, image.Rect(8, 0, 12, 4), image.NewUniform(blue), image.Point{}, draw.Src)
+
+	for _, size := range []int{2, 4, 16} {
+		thumb := thumbnail(img, size)
+		if thumb.Bounds() != image.Rect(0, 0, size, size) {
+			t.Fatalf("expected a %dx%[1]d thumbnail, got %v", size, thumb.Bounds())
+		}
+		if got := average(thumb, thumb.Bounds()); got != green {
+			t.Errorf("expected the %dx%[1]d thumbnail to be green, got %v", size, got)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+// Package cli implements the command line of the torrent command, which
+// inspects BitTorrent .torrent files and which the gomentor command also
+// serves as its torrent subcommand.
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/jpreese/go-mentor/challenge4/pkg/torrent"
+)
+
+const usage = `Usage: %s <command> [arguments]
+
+Commands:
+  show <file>...  print the metadata of .torrent files
+  hash <file>...  print the info hash of .torrent files`
+
+// program is the name of the command; see Main.
+var program = "torrent"
+
+// Main runs the torrent command, and gomentor torrent, with args[0]
+// naming show or hash. It takes its arguments as
+// [github.com/jpreese/go-mentor/cli.Main] does.
+func Main(name string, args []string) {
+	log.SetFlags(0)
+	program = name
+
+	if len(args) < 1 {
+		log.Fatalf(usage, program)
+	}
+
+	var err error
+	switch command, args := args[0], args[1:]; command {
+	case "show":
+		err = runShow(args)
+	case "hash":
+		err = runHash(args)
+	default:
+		log.Fatalf("unknown command %q\n\n"+usage, command, program)
+	}
+
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// runShow prints the metadata of each torrent file, as text or as JSON.
+func runShow(args []string) error {
+	flags := flag.NewFlagSet("show", flag.ExitOnError)
+	asJSON := flags.Bool("json", false, "print the metadata as JSON")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: %s show [flags] <file>...\n", program)
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	for i, path := range flags.Args() {
+		t, err := torrent.DecodeFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+
+		if *asJSON {
+			data, err := json.MarshalIndent(t, "", "  ")
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s\n", data)
+			continue
+		}
+
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(t)
+	}
+
+	return nil
+}
+
+// runHash prints the info hash of each torrent file, followed by its
+// path like sha1sum(1).
+func runHash(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf("usage: %s hash <file>...", program)
+	}
+
+	for _, path := range args {
+		t, err := torrent.DecodeFile(path)
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		fmt.Printf("%s  %s\n", t.InfoHash, path)
+	}
+
+	return nil
+}
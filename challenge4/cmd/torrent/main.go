@@ -0,0 +1,12 @@
+// Command torrent inspects BitTorrent .torrent files.
+package main
+
+import (
+	"os"
+
+	"github.com/jpreese/go-mentor/challenge4/cli"
+)
+
+func main() {
+	cli.Main("torrent", os.Args[1:])
+}
@@ -0,0 +1,3 @@
+module github.com/jpreese/go-mentor/challenge4
+
+go 1.23
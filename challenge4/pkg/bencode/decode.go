@@ -0,0 +1,202 @@
+// Package bencode encodes and decodes bencode, the format of BitTorrent
+// metadata.
+//
+// Decoded values are int64 for integers, string for byte strings, []any
+// for lists and map[string]any for dictionaries. Only the canonical
+// encoding of a value is accepted, with integers and lengths free of
+// leading zeros and dictionary keys sorted and unique, so that encoding
+// a decoded value gives back exactly the bytes it was decoded from.
+package bencode
+
+import (
+	"fmt"
+	"math"
+)
+
+// maxDepth is how deeply lists and dictionaries may nest, which keeps
+// hostile input from exhausting the stack.
+const maxDepth = 512
+
+// A SyntaxError describes malformed bencode and the offset of the byte
+// at which it was found.
+type SyntaxError struct {
+	Offset int64
+	msg    string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%s at offset %d", e.msg, e.Offset)
+}
+
+// Unmarshal decodes the single bencode value that data holds.
+func Unmarshal(data []byte) (any, error) {
+	d := decodeState{data: data}
+	v, err := d.value(0)
+	if err != nil {
+		return nil, err
+	}
+	if d.off != len(data) {
+		return nil, d.errorf("unexpected data after the value")
+	}
+
+	return v, nil
+}
+
+type decodeState struct {
+	data []byte
+	off  int
+}
+
+func (d *decodeState) errorf(format string, args ...any) error {
+	return &SyntaxError{Offset: int64(d.off), msg: fmt.Sprintf(format, args...)}
+}
+
+func (d *decodeState) value(depth int) (any, error) {
+	if d.off >= len(d.data) {
+		return nil, d.errorf("unexpected end of data")
+	}
+
+	switch c := d.data[d.off]; {
+	case c == 'i':
+		d.off++
+		return d.integer('e')
+	case c >= '0' && c <= '9':
+		return d.string()
+	case c == 'l':
+		return d.list(depth + 1)
+	case c == 'd':
+		return d.dict(depth + 1)
+	default:
+		return nil, d.errorf("invalid character %q looking for a value", c)
+	}
+}
+
+// integer reads a canonical decimal integer ending in end, and the end.
+func (d *decodeState) integer(end byte) (int64, error) {
+	start := d.off
+	negative := d.off < len(d.data) && d.data[d.off] == '-'
+	if negative {
+		d.off++
+	}
+
+	digits := d.off
+	var n uint64
+	for ; d.off < len(d.data) && d.data[d.off] >= '0' && d.data[d.off] <= '9'; d.off++ {
+		if n > (math.MaxInt64+1)/10 {
+			d.off = start
+			return 0, d.errorf("integer overflows 64 bits")
+		}
+		n = n*10 + uint64(d.data[d.off]-'0')
+	}
+
+	switch {
+	case d.off >= len(d.data):
+		return 0, d.errorf("unexpected end of data in integer")
+	case d.data[d.off] != end:
+		return 0, d.errorf("invalid character %q in integer", d.data[d.off])
+	case d.off == digits:
+		return 0, d.errorf("integer has no digits")
+	case d.data[digits] == '0' && d.off-digits > 1:
+		d.off = start
+		return 0, d.errorf("integer has a leading zero")
+	case negative && n == 0:
+		d.off = start
+		return 0, d.errorf("negative zero")
+	case n > math.MaxInt64 && !(negative && n == math.MaxInt64+1):
+		d.off = start
+		return 0, d.errorf("integer overflows 64 bits")
+	}
+	d.off++
+
+	if negative {
+		return -int64(n-1) - 1, nil
+	}
+
+	return int64(n), nil
+}
+
+func (d *decodeState) string() (string, error) {
+	start := d.off
+	if d.data[d.off] == '-' {
+		return "", d.errorf("negative string length")
+	}
+	n, err := d.integer(':')
+	if err != nil {
+		return "", err
+	}
+	if n > int64(len(d.data)-d.off) {
+		d.off = start
+		return "", d.errorf("string of %d bytes runs past the end of data", n)
+	}
+
+	s := string(d.data[d.off : d.off+int(n)])
+	d.off += int(n)
+
+	return s, nil
+}
+
+func (d *decodeState) list(depth int) ([]any, error) {
+	if depth > maxDepth {
+		return nil, d.errorf("nested more than %d deep", maxDepth)
+	}
+	d.off++
+
+	l := []any{}
+	for {
+		if d.off >= len(d.data) {
+			return nil, d.errorf("unexpected end of data in list")
+		}
+		if d.data[d.off] == 'e' {
+			d.off++
+			return l, nil
+		}
+
+		v, err := d.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		l = append(l, v)
+	}
+}
+
+func (d *decodeState) dict(depth int) (map[string]any, error) {
+	if depth > maxDepth {
+		return nil, d.errorf("nested more than %d deep", maxDepth)
+	}
+	d.off++
+
+	m := map[string]any{}
+	var last string
+	for {
+		if d.off >= len(d.data) {
+			return nil, d.errorf("unexpected end of data in dictionary")
+		}
+		if d.data[d.off] == 'e' {
+			d.off++
+			return m, nil
+		}
+
+		start := d.off
+		if c := d.data[d.off]; c < '0' || c > '9' {
+			return nil, d.errorf("invalid character %q looking for a dictionary key", c)
+		}
+		key, err := d.string()
+		if err != nil {
+			return nil, err
+		}
+		if len(m) > 0 && key <= last {
+			d.off = start
+			if key == last {
+				return nil, d.errorf("duplicate dictionary key %q", key)
+			}
+			return nil, d.errorf("dictionary key %q out of order", key)
+		}
+		last = key
+
+		v, err := d.value(depth)
+		if err != nil {
+			return nil, err
+		}
+		m[key] = v
+	}
+}
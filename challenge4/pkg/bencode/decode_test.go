@@ -0,0 +1,112 @@
+package bencode
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestUnmarshal(t *testing.T) {
+	tData := []struct {
+		input    string
+		expected any
+	}{
+		{"i0e", int64(0)},
+		{"i42e", int64(42)},
+		{"i-42e", int64(-42)},
+		{"i9223372036854775807e", int64(math.MaxInt64)},
+		{"i-9223372036854775808e", int64(math.MinInt64)},
+		{"0:", ""},
+		{"4:spam", "spam"},
+		{"le", []any{}},
+		{"l4:spami42ee", []any{"spam", int64(42)}},
+		{"de", map[string]any{}},
+		{"d3:cow3:moo4:spaml1:a1:bee", map[string]any{"cow": "moo", "spam": []any{"a", "b"}}},
+	}
+
+	for _, exp := range tData {
+		got, err := Unmarshal([]byte(exp.input))
+		if err != nil {
+			t.Errorf("Unmarshal(%q) failed: %v", exp.input, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, exp.expected) {
+			t.Errorf("Unmarshal(%q) = %#v, expected %#v", exp.input, got, exp.expected)
+		}
+	}
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	tData := []struct {
+		input  string
+		offset int64
+	}{
+		{"", 0},
+		{"x", 0},
+		{"i42", 3},
+		{"ie", 1},
+		{"i-e", 2},
+		{"i042e", 1},
+		{"i-0e", 1},
+		{"i4x2e", 2},
+		{"i9223372036854775808e", 1},
+		{"i-9223372036854775809e", 1},
+		{"i99999999999999999999e", 1},
+		{"5:spam", 0},
+		{"05:spams", 0},
+		{"4spam", 1},
+		{"l4:spam", 7},
+		{"d3:cow3:mooe4:spam", 12},
+		{"di1e3:mooe", 1},
+		{"d4:spam1:a3:cow3:mooe", 10},
+		{"d3:cow3:moo3:cow3:mooe", 11},
+		{"d3:cowe", 6},
+	}
+
+	for _, exp := range tData {
+		_, err := Unmarshal([]byte(exp.input))
+		var syntaxErr *SyntaxError
+		if !errors.As(err, &syntaxErr) {
+			t.Errorf("Unmarshal(%q) returned %v, expected a SyntaxError", exp.input, err)
+			continue
+		}
+		if syntaxErr.Offset != exp.offset {
+			t.Errorf("Unmarshal(%q) reported %q, expected offset %d", exp.input, err, exp.offset)
+		}
+	}
+}
+
+func TestUnmarshalDepth(t *testing.T) {
+	deep := bytes.Repeat([]byte("l"), maxDepth+1)
+	deep = append(deep, bytes.Repeat([]byte("e"), maxDepth+1)...)
+	if _, err := Unmarshal(deep); err == nil {
+		t.Fatal("expected lists nested too deeply to fail")
+	}
+	if _, err := Unmarshal(deep[1 : len(deep)-1]); err != nil {
+		t.Fatalf("expected lists nested %d deep to decode, got %v", maxDepth, err)
+	}
+}
+
+// FuzzUnmarshal checks that whatever decodes encodes back to the same
+// bytes.
+func FuzzUnmarshal(f *testing.F) {
+	for _, seed := range []string{"i-42e", "4:spam", "l4:spami42ee", "d3:cow3:moo4:spaml1:a1:bee", "d1:ad1:bli0eeee"} {
+		f.Add([]byte(seed))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		v, err := Unmarshal(data)
+		if err != nil {
+			return
+		}
+		encoded, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("unable to encode %#v: %v", v, err)
+		}
+		if !bytes.Equal(encoded, data) {
+			t.Fatalf("%q encoded back as %q", data, encoded)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package bencode
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+// ErrUnsupportedType is returned when asked to encode a value that has
+// no bencode representation.
+var ErrUnsupportedType = errors.New("unsupported type")
+
+// Marshal returns the canonical bencode encoding of v, which may be any
+// of the types Unmarshal returns, or an int, []byte, []string or
+// map[string]string for convenience.
+func Marshal(v any) ([]byte, error) {
+	return appendValue(nil, v)
+}
+
+func appendValue(b []byte, v any) ([]byte, error) {
+	switch v := v.(type) {
+	case int64:
+		return appendInt(b, v), nil
+	case int:
+		return appendInt(b, int64(v)), nil
+	case string:
+		return appendString(b, v), nil
+	case []byte:
+		return appendString(b, string(v)), nil
+	case []any:
+		b = append(b, 'l')
+		for _, e := range v {
+			var err error
+			if b, err = appendValue(b, e); err != nil {
+				return nil, err
+			}
+		}
+		return append(b, 'e'), nil
+	case []string:
+		b = append(b, 'l')
+		for _, e := range v {
+			b = appendString(b, e)
+		}
+		return append(b, 'e'), nil
+	case map[string]any:
+		b = append(b, 'd')
+		for _, key := range sortedKeys(v) {
+			b = appendString(b, key)
+			var err error
+			if b, err = appendValue(b, v[key]); err != nil {
+				return nil, fmt.Errorf("key %q: %w", key, err)
+			}
+		}
+		return append(b, 'e'), nil
+	case map[string]string:
+		b = append(b, 'd')
+		for _, key := range sortedKeys(v) {
+			b = appendString(appendString(b, key), v[key])
+		}
+		return append(b, 'e'), nil
+	default:
+		return nil, fmt.Errorf("%w %T", ErrUnsupportedType, v)
+	}
+}
+
+func appendInt(b []byte, n int64) []byte {
+	b = append(b, 'i')
+	b = strconv.AppendInt(b, n, 10)
+
+	return append(b, 'e')
+}
+
+func appendString(b []byte, s string) []byte {
+	b = strconv.AppendInt(b, int64(len(s)), 10)
+	b = append(b, ':')
+
+	return append(b, s...)
+}
+
+// sortedKeys returns the keys of m in the byte order bencode requires.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	return keys
+}
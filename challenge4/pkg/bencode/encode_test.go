@@ -0,0 +1,41 @@
+package bencode
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestMarshal(t *testing.T) {
+	tData := []struct {
+		input    any
+		expected string
+	}{
+		{int64(-7), "i-7e"},
+		{7, "i7e"},
+		{"", "0:"},
+		{[]byte("spam"), "4:spam"},
+		{[]any{}, "le"},
+		{[]string{"a", "b"}, "l1:a1:be"},
+		{map[string]any{"spam": []any{int64(1)}, "cow": "moo"}, "d3:cow3:moo4:spamli1eee"},
+		{map[string]string{"b": "2", "a": "1"}, "d1:a1:11:b1:2e"},
+	}
+
+	for _, exp := range tData {
+		got, err := Marshal(exp.input)
+		if err != nil {
+			t.Errorf("Marshal(%#v) failed: %v", exp.input, err)
+			continue
+		}
+		if string(got) != exp.expected {
+			t.Errorf("Marshal(%#v) = %q, expected %q", exp.input, got, exp.expected)
+		}
+	}
+}
+
+func TestMarshalUnsupportedType(t *testing.T) {
+	for _, v := range []any{3.14, nil, map[string]any{"a": []any{true}}} {
+		if _, err := Marshal(v); !errors.Is(err, ErrUnsupportedType) {
+			t.Errorf("Marshal(%#v) returned %v, expected ErrUnsupportedType", v, err)
+		}
+	}
+}
@@ -0,0 +1,510 @@
+// Package torrent decodes and encodes the metadata of BitTorrent
+// .torrent files: where to find the trackers, and the name, size and
+// piece hashes of the files shared.
+package torrent
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge4/pkg/bencode"
+)
+
+// ErrInvalidTorrent is returned for bencode that does not hold the
+// metadata of a torrent.
+var ErrInvalidTorrent = errors.New("invalid torrent")
+
+// A Hash is a SHA-1 digest, of a piece or of the info dictionary.
+type Hash [sha1.Size]byte
+
+func (h Hash) String() string {
+	return hex.EncodeToString(h[:])
+}
+
+// MarshalText renders the hash in hexadecimal, as String does.
+func (h Hash) MarshalText() ([]byte, error) {
+	return []byte(h.String()), nil
+}
+
+// File is one of the files of a torrent that shares several.
+type File struct {
+	Length int64
+
+	// Path holds the directories and name of the file, within the
+	// directory the torrent is named for.
+	Path []string
+
+	extra map[string]any
+}
+
+// Info describes what a torrent shares: a single file of Length bytes
+// called Name, or Files in a directory called Name.
+type Info struct {
+	Name        string
+	PieceLength int64
+	Pieces      []Hash
+	Length      int64
+	Files       []File
+	Private     bool
+
+	extra map[string]any
+}
+
+// Torrent is the metadata a .torrent file holds. Keys of the file it
+// has no field for, and keys whose values are the zero values of their
+// fields, are kept so that they are written back by WriteTo.
+type Torrent struct {
+	Announce     string
+	AnnounceList [][]string
+	Comment      string
+	CreatedBy    string
+	CreationDate time.Time
+	Info         Info
+
+	// InfoHash is the SHA-1 digest of the encoded info dictionary, which
+	// names the torrent to trackers and peers.
+	InfoHash Hash
+
+	extra map[string]any
+}
+
+// Decode decodes the torrent metadata r holds.
+func Decode(r io.Reader) (*Torrent, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, fmt.Errorf("unable to read torrent: %w", err)
+	}
+
+	v, err := bencode.Unmarshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("unable to decode torrent: %w", err)
+	}
+	m, ok := v.(map[string]any)
+	if !ok {
+		return nil, invalid("metadata is a %s, not a dictionary", typeName(v))
+	}
+
+	return newTorrent(m)
+}
+
+// DecodeFile decodes the .torrent file found at path.
+func DecodeFile(path string) (*Torrent, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return Decode(file)
+}
+
+// WriteTo encodes the torrent to w. It implements io.WriterTo.
+func (t *Torrent) WriteTo(w io.Writer) (int64, error) {
+	data, err := bencode.Marshal(t.dict())
+	if err != nil {
+		return 0, fmt.Errorf("unable to encode torrent: %w", err)
+	}
+
+	n, err := w.Write(data)
+	if err != nil {
+		return int64(n), fmt.Errorf("unable to write torrent: %w", err)
+	}
+
+	return int64(n), nil
+}
+
+// Length returns the number of bytes the torrent shares.
+func (t *Torrent) Length() int64 {
+	if t.Info.Files == nil {
+		return t.Info.Length
+	}
+
+	var n int64
+	for _, f := range t.Info.Files {
+		n += f.Length
+	}
+
+	return n
+}
+
+func (t *Torrent) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Name: %s\n", t.Info.Name)
+	fmt.Fprintf(&b, "Info hash: %s\n", t.InfoHash)
+	if t.Announce != "" {
+		fmt.Fprintf(&b, "Announce: %s\n", t.Announce)
+	}
+	for i, tier := range t.AnnounceList {
+		fmt.Fprintf(&b, "Tier %d: %s\n", i, strings.Join(tier, " "))
+	}
+	if t.Comment != "" {
+		fmt.Fprintf(&b, "Comment: %s\n", t.Comment)
+	}
+	if t.CreatedBy != "" {
+		fmt.Fprintf(&b, "Created by: %s\n", t.CreatedBy)
+	}
+	if !t.CreationDate.IsZero() {
+		fmt.Fprintf(&b, "Created: %s\n", t.CreationDate.Format(time.RFC3339))
+	}
+	if t.Info.Private {
+		b.WriteString("Private\n")
+	}
+	fmt.Fprintf(&b, "Pieces: %d of %d bytes\n", len(t.Info.Pieces), t.Info.PieceLength)
+	fmt.Fprintf(&b, "Length: %d\n", t.Length())
+	for _, f := range t.Info.Files {
+		fmt.Fprintf(&b, "%12d  %s\n", f.Length, path.Join(f.Path...))
+	}
+
+	return b.String()
+}
+
+func invalid(format string, args ...any) error {
+	return fmt.Errorf("%w: %s", ErrInvalidTorrent, fmt.Sprintf(format, args...))
+}
+
+func newTorrent(m map[string]any) (*Torrent, error) {
+	d := dict{m: m}
+	var t Torrent
+	var err error
+	if t.Announce, err = d.string("announce"); err != nil {
+		return nil, err
+	}
+	if t.AnnounceList, err = d.tiers("announce-list"); err != nil {
+		return nil, err
+	}
+	if t.Comment, err = d.string("comment"); err != nil {
+		return nil, err
+	}
+	if t.CreatedBy, err = d.string("created by"); err != nil {
+		return nil, err
+	}
+	date, err := d.int("creation date")
+	if err != nil {
+		return nil, err
+	}
+	if date != 0 {
+		t.CreationDate = time.Unix(date, 0).UTC()
+	}
+
+	info, ok := m["info"].(map[string]any)
+	if !ok {
+		return nil, invalid("no info dictionary")
+	}
+	delete(m, "info")
+	if t.Info, err = newInfo(info); err != nil {
+		return nil, err
+	}
+	encoded, err := bencode.Marshal(t.Info.dict())
+	if err != nil {
+		return nil, fmt.Errorf("unable to encode info: %w", err)
+	}
+	t.InfoHash = sha1.Sum(encoded)
+	t.extra = m
+
+	return &t, nil
+}
+
+func newInfo(m map[string]any) (Info, error) {
+	d := dict{m: m, name: "info"}
+	var info Info
+	var err error
+	if info.Name, err = d.string("name"); err != nil {
+		return Info{}, err
+	}
+	if info.Name == "" {
+		return Info{}, invalid("info has no name")
+	}
+	if info.PieceLength, err = d.int("piece length"); err != nil {
+		return Info{}, err
+	}
+	if info.PieceLength <= 0 {
+		return Info{}, invalid("info has piece length %d", info.PieceLength)
+	}
+
+	if _, ok := m["pieces"]; !ok {
+		return Info{}, invalid("info has no pieces")
+	}
+	pieces, err := d.string("pieces")
+	if err != nil {
+		return Info{}, err
+	}
+	if len(pieces)%len(Hash{}) != 0 {
+		return Info{}, invalid("pieces of %d bytes are not a whole number of hashes", len(pieces))
+	}
+	for i := 0; i < len(pieces); i += len(Hash{}) {
+		info.Pieces = append(info.Pieces, Hash([]byte(pieces[i:i+len(Hash{})])))
+	}
+
+	_, hasLength := m["length"]
+	if info.Length, err = d.int("length"); err != nil {
+		return Info{}, err
+	}
+	if info.Files, err = d.files("files"); err != nil {
+		return Info{}, err
+	}
+	if !hasLength && info.Files == nil {
+		return Info{}, invalid("info has neither a length nor files")
+	}
+	if info.Length < 0 {
+		return Info{}, invalid("info has length %d", info.Length)
+	}
+	if info.Length != 0 && info.Files != nil {
+		return Info{}, invalid("info has both a length and files")
+	}
+
+	if private, ok := m["private"].(int64); ok && private == 1 {
+		info.Private = true
+		delete(m, "private")
+	}
+	info.extra = m
+
+	return info, nil
+}
+
+// dict takes the values of the keys a dictionary has fields for out of
+// it, leaving those it has none for. Values that are the zero values of
+// their fields are left too, so that they can be written back.
+type dict struct {
+	m map[string]any
+
+	// name is where the dictionary is, to report in errors.
+	name string
+}
+
+func (d dict) wrongType(key string, v any) error {
+	if d.name != "" {
+		key = d.name + " " + key
+	}
+
+	return invalid("%s is a %s", key, typeName(v))
+}
+
+func (d dict) string(key string) (string, error) {
+	v, ok := d.m[key]
+	if !ok {
+		return "", nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", d.wrongType(key, v)
+	}
+	if s != "" {
+		delete(d.m, key)
+	}
+
+	return s, nil
+}
+
+func (d dict) int(key string) (int64, error) {
+	v, ok := d.m[key]
+	if !ok {
+		return 0, nil
+	}
+	n, ok := v.(int64)
+	if !ok {
+		return 0, d.wrongType(key, v)
+	}
+	if n != 0 {
+		delete(d.m, key)
+	}
+
+	return n, nil
+}
+
+func (d dict) strings(key string) ([]string, error) {
+	v, ok := d.m[key]
+	if !ok {
+		return nil, nil
+	}
+	l, err := stringList(v)
+	if err != nil {
+		return nil, d.wrongType(key, v)
+	}
+	if len(l) != 0 {
+		delete(d.m, key)
+	}
+
+	return l, nil
+}
+
+// tiers reads an announce list: a list of tiers of tracker URLs.
+func (d dict) tiers(key string) ([][]string, error) {
+	v, ok := d.m[key]
+	if !ok {
+		return nil, nil
+	}
+	l, ok := v.([]any)
+	if !ok {
+		return nil, d.wrongType(key, v)
+	}
+
+	var tiers [][]string
+	for i, e := range l {
+		tier, err := stringList(e)
+		if err != nil || len(tier) == 0 {
+			return nil, invalid("%s tier %d is not a list of URLs", key, i)
+		}
+		tiers = append(tiers, tier)
+	}
+	if len(tiers) != 0 {
+		delete(d.m, key)
+	}
+
+	return tiers, nil
+}
+
+func (d dict) files(key string) ([]File, error) {
+	v, ok := d.m[key]
+	if !ok {
+		return nil, nil
+	}
+	l, ok := v.([]any)
+	if !ok {
+		return nil, d.wrongType(key, v)
+	}
+	if len(l) == 0 {
+		return nil, invalid("%s %s is empty", d.name, key)
+	}
+
+	files := make([]File, 0, len(l))
+	for i, e := range l {
+		m, ok := e.(map[string]any)
+		if !ok {
+			return nil, invalid("info file %d is a %s", i, typeName(e))
+		}
+		fd := dict{m: m, name: fmt.Sprintf("info file %d", i)}
+
+		if _, ok := m["length"]; !ok {
+			return nil, invalid("info file %d has no length", i)
+		}
+		var f File
+		var err error
+		if f.Length, err = fd.int("length"); err != nil {
+			return nil, err
+		}
+		if f.Length < 0 {
+			return nil, invalid("info file %d has length %d", i, f.Length)
+		}
+		if f.Path, err = fd.strings("path"); err != nil {
+			return nil, err
+		}
+		if len(f.Path) == 0 {
+			return nil, invalid("info file %d has no path", i)
+		}
+		f.extra = m
+		files = append(files, f)
+	}
+	delete(d.m, key)
+
+	return files, nil
+}
+
+func stringList(v any) ([]string, error) {
+	l, ok := v.([]any)
+	if !ok {
+		return nil, errors.New("not a list")
+	}
+
+	strs := make([]string, 0, len(l))
+	for _, e := range l {
+		s, ok := e.(string)
+		if !ok {
+			return nil, errors.New("not a list of strings")
+		}
+		strs = append(strs, s)
+	}
+
+	return strs, nil
+}
+
+// typeName names the kind of a decoded bencode value for errors.
+func typeName(v any) string {
+	switch v.(type) {
+	case int64:
+		return "integer"
+	case string:
+		return "string"
+	case []any:
+		return "list"
+	case map[string]any:
+		return "dictionary"
+	default:
+		return fmt.Sprintf("%T", v)
+	}
+}
+
+// dict returns the torrent as a bencode dictionary.
+func (t *Torrent) dict() map[string]any {
+	m := clone(t.extra)
+	setString(m, "announce", t.Announce)
+	if len(t.AnnounceList) != 0 {
+		tiers := make([]any, len(t.AnnounceList))
+		for i, tier := range t.AnnounceList {
+			tiers[i] = tier
+		}
+		m["announce-list"] = tiers
+	}
+	setString(m, "comment", t.Comment)
+	setString(m, "created by", t.CreatedBy)
+	if !t.CreationDate.IsZero() {
+		m["creation date"] = t.CreationDate.Unix()
+	}
+	m["info"] = t.Info.dict()
+
+	return m
+}
+
+func (info *Info) dict() map[string]any {
+	m := clone(info.extra)
+	setString(m, "name", info.Name)
+	m["piece length"] = info.PieceLength
+
+	var pieces bytes.Buffer
+	for _, h := range info.Pieces {
+		pieces.Write(h[:])
+	}
+	m["pieces"] = pieces.String()
+
+	if info.Files == nil {
+		m["length"] = info.Length
+	} else {
+		files := make([]any, len(info.Files))
+		for i, f := range info.Files {
+			fm := clone(f.extra)
+			fm["length"] = f.Length
+			fm["path"] = f.Path
+			files[i] = fm
+		}
+		m["files"] = files
+	}
+	if info.Private {
+		m["private"] = int64(1)
+	}
+
+	return m
+}
+
+// setString sets key to s unless s is empty, leaving any value kept
+// from decoding.
+func setString(m map[string]any, key, s string) {
+	if s != "" {
+		m[key] = s
+	}
+}
+
+func clone(m map[string]any) map[string]any {
+	c := make(map[string]any, len(m))
+	for k, v := range m {
+		c[k] = v
+	}
+
+	return c
+}
@@ -0,0 +1,145 @@
+package torrent
+
+import (
+	"bytes"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge4/internal/testutil"
+	"github.com/jpreese/go-mentor/challenge4/pkg/bencode"
+)
+
+func TestDecodeFile(t *testing.T) {
+	testutil.GoldenFixtures(t, filepath.Join("..", "..", "fixtures", "*.torrent"), func(path string) (interface{}, error) {
+		return DecodeFile(path)
+	})
+}
+
+func TestDecodeMulti(t *testing.T) {
+	tr, err := DecodeFile(filepath.Join("..", "..", "fixtures", "multi.torrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !tr.Info.Private {
+		t.Error("expected a private torrent")
+	}
+	if len(tr.Info.Pieces) != 3 {
+		t.Errorf("expected 3 pieces, got %d", len(tr.Info.Pieces))
+	}
+	if n := tr.Length(); n != 65536 {
+		t.Errorf("expected 65536 bytes, got %d", n)
+	}
+	if len(tr.AnnounceList) != 2 || len(tr.AnnounceList[1]) != 2 {
+		t.Errorf("expected two tiers of trackers, got %v", tr.AnnounceList)
+	}
+	if got := tr.Info.Files[0].Path; !reflect.DeepEqual(got, []string{"kicks", "pattern_1.splice"}) {
+		t.Errorf("unexpected path %v", got)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, name := range []string{"single.torrent", "multi.torrent"} {
+		data := testutil.Fixture(t, "..", "..", "fixtures", name)
+		tr, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var encoded bytes.Buffer
+		if _, err := tr.WriteTo(&encoded); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(encoded.Bytes(), data) {
+			t.Errorf("%s encoded back as\n%q\nexpected\n%q", name, encoded.Bytes(), data)
+		}
+	}
+}
+
+func TestEditInfoHash(t *testing.T) {
+	tr, err := DecodeFile(filepath.Join("..", "..", "fixtures", "single.torrent"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The info hash covers the info dictionary only.
+	tr.Announce = "http://other.example.com/announce"
+	tr.Info.Name = "pattern_2.splice"
+	var encoded bytes.Buffer
+	if _, err := tr.WriteTo(&encoded); err != nil {
+		t.Fatal(err)
+	}
+	edited, err := Decode(&encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if edited.Announce != tr.Announce || edited.Info.Name != tr.Info.Name {
+		t.Fatalf("edits were lost: %v", edited)
+	}
+	if edited.InfoHash == tr.InfoHash {
+		t.Fatal("expected renaming the file to change the info hash")
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tData := []struct {
+		input    string
+		expected string
+	}{
+		{"le", "metadata is a list"},
+		{"d8:announcei1ee", "announce is a integer"},
+		{"de", "no info dictionary"},
+		{"d4:infod6:lengthi1e12:piece lengthi1e6:pieces0:ee", "info has no name"},
+		{"d4:infod6:lengthi1e4:name1:a6:pieces0:ee", "info has piece length 0"},
+		{"d4:infod6:lengthi1e4:name1:a12:piece lengthi1e6:pieces3:abcee", "not a whole number of hashes"},
+		{"d4:infod4:name1:a12:piece lengthi1e6:pieces0:ee", "neither a length nor files"},
+		{"d4:infod5:filesle4:name1:a12:piece lengthi1e6:pieces0:ee", "info files is empty"},
+		{"d4:infod5:filesld6:lengthi1e4:pathleee4:name1:a12:piece lengthi1e6:pieces0:ee", "info file 0 has no path"},
+		{"d4:infod5:filesld4:pathl1:aeee4:name1:a12:piece lengthi1e6:pieces0:ee", "info file 0 has no length"},
+		{"d4:infod5:filesld6:lengthi1e4:pathl1:aeee6:lengthi1e4:name1:a12:piece lengthi1e6:pieces0:ee", "both a length and files"},
+		{"d13:announce-listllee4:infod6:lengthi1e4:name1:a12:piece lengthi1e6:pieces0:ee", "announce-list tier 0"},
+	}
+
+	for _, exp := range tData {
+		_, err := Decode(strings.NewReader(exp.input))
+		if !errors.Is(err, ErrInvalidTorrent) || !strings.Contains(err.Error(), exp.expected) {
+			t.Errorf("Decode(%q) returned %v, expected %q", exp.input, err, exp.expected)
+		}
+	}
+
+	_, err := Decode(strings.NewReader("d4:info"))
+	var syntaxErr *bencode.SyntaxError
+	if !errors.As(err, &syntaxErr) || syntaxErr.Offset != 7 {
+		t.Errorf("expected a syntax error at offset 7, got %v", err)
+	}
+}
+
+// FuzzDecode checks that whatever decodes encodes to a torrent that
+// decodes the same.
+func FuzzDecode(f *testing.F) {
+	for _, name := range []string{"single.torrent", "multi.torrent"} {
+		f.Add(testutil.Fixture(f, "..", "..", "fixtures", name))
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		tr, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		var encoded bytes.Buffer
+		if _, err := tr.WriteTo(&encoded); err != nil {
+			t.Fatalf("unable to encode %v: %v", tr, err)
+		}
+		again, err := Decode(&encoded)
+		if err != nil {
+			t.Fatalf("unable to decode the torrent encoded from %q: %v", data, err)
+		}
+		if !reflect.DeepEqual(again, tr) {
+			t.Fatalf("%q decoded as\n%#v\nbut once encoded as\n%#v", data, tr, again)
+		}
+	})
+}
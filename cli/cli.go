@@ -0,0 +1,148 @@
+// Package cli is the command line of gomentor, which serves that of
+// every challenge as one of its subcommands:
+//
+//   - drum, for the drum machine patterns of challenge1, which the
+//     splice command serves too
+//   - secure, for the encrypted connections of challenge2, which the
+//     challenge2 command serves too
+//   - mosaic, for the photo mosaics of challenge3, which the mosaic
+//     command serves too
+//   - torrent, for the .torrent files of challenge4, which the torrent
+//     command serves too
+//
+// Its own subcommands, patterns, jam, conduct, follow, record and play,
+// share, edit and play the patterns of the one over the connections of
+// the other.
+//
+// The cli package of each challenge follows the conventions of this
+// one: a Main that the command and the gomentor subcommand both call,
+// and a program variable holding the name Main was given.
+package cli
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime/debug"
+
+	drum "github.com/jpreese/go-mentor/challenge1/cli"
+	secure "github.com/jpreese/go-mentor/challenge2/cli"
+	mosaic "github.com/jpreese/go-mentor/challenge3/cli"
+	torrent "github.com/jpreese/go-mentor/challenge4/cli"
+	"github.com/jpreese/go-mentor/errcode"
+)
+
+const usage = `Usage: %[1]s <command> [arguments]
+
+Commands:
+  drum <command>      inspect drum machine .splice files
+  secure <command>    run and talk to encrypted servers
+  mosaic <command>    build photo mosaics out of directories of images
+  torrent <command>   inspect BitTorrent .torrent files
+  patterns <command>  serve drum patterns over encrypted connections and fetch them
+  jam <host:port>     edit a pattern together with the clients of a broadcast server
+  conduct <port>      keep the beat for followers to play to
+  follow <host:port> <file>
+                      play a pattern to the beat of a conductor
+  record <device> <host:port>
+                      record a bar from a MIDI device and play it on a server
+  play <port>         play the patterns recorded and sent to it
+  profile <workload>  profile decoding patterns or a secure transfer
+  version             print the version of %[1]s and what it was built from
+
+Run %[1]s drum, %[1]s secure, %[1]s mosaic, %[1]s torrent
+or %[1]s patterns alone for their commands.`
+
+// Version is the version the version command reports, set at build time
+// with -ldflags "-X github.com/jpreese/go-mentor/cli.Version=...". When
+// it is empty, the version of the main module the binary was built from
+// is reported instead.
+var Version string
+
+// program is the name usage messages give the command, set by Main.
+var program = "gomentor"
+
+// Main runs the command named by the first of args with the rest, as
+// the program called name, and exits if it fails. Subcommands that a
+// challenge serves get the name with their own appended, so that
+// usage messages read "gomentor drum diff" where splice would read
+// "splice diff".
+func Main(name string, args []string) {
+	log.SetFlags(0)
+	program = name
+
+	if len(args) < 1 {
+		fmt.Fprintf(os.Stderr, usage+"\n", program)
+		os.Exit(2)
+	}
+
+	switch command, args := args[0], args[1:]; command {
+	case "drum":
+		drum.Main(program+" drum", args)
+	case "secure":
+		secure.Main(program+" secure", args)
+	case "mosaic":
+		mosaic.Main(program+" mosaic", args)
+	case "torrent":
+		torrent.Main(program+" torrent", args)
+	case "patterns":
+		fail(runPatterns(args))
+	case "jam":
+		fail(runJam(args))
+	case "conduct":
+		fail(runConduct(args))
+	case "follow":
+		fail(runFollow(args))
+	case "record":
+		fail(runRecord(args))
+	case "play":
+		fail(runPlay(args))
+	case "profile":
+		fail(runProfile(args))
+	case "version", "-version", "--version":
+		printVersion()
+	case "help", "-h", "-help", "--help":
+		fmt.Printf(usage+"\n", program)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", command, fmt.Sprintf(usage, program))
+		os.Exit(2)
+	}
+}
+
+// fail exits with the status errcode gives err, after printing it, if
+// it is not nil.
+func fail(err error) {
+	if err != nil {
+		log.Print(err)
+		os.Exit(errcode.ExitStatus(err))
+	}
+}
+
+// printVersion prints the version of the program, the Go release it was
+// built with and the versions of the challenge modules it includes.
+func printVersion() {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		fmt.Println(program, versionOr("(unknown)"))
+		return
+	}
+
+	fmt.Println(program, versionOr(info.Main.Version), info.GoVersion)
+	for _, dep := range info.Deps {
+		v := dep.Version
+		if dep.Replace != nil {
+			v = dep.Replace.Version
+		}
+		fmt.Printf("  %s %s\n", dep.Path, v)
+	}
+}
+
+// versionOr returns Version, or fallback when it was not set at build
+// time.
+func versionOr(fallback string) string {
+	if Version != "" {
+		return Version
+	}
+
+	return fallback
+}
@@ -0,0 +1,39 @@
+package cli
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+	"github.com/jpreese/go-mentor/errcode"
+)
+
+func TestUsage(t *testing.T) {
+	for _, u := range []string{usage, jamUsage, patternsUsage, profileUsage} {
+		got := fmt.Sprintf(u, "prog")
+		if strings.Contains(got, "%!") || strings.Contains(got, "gomentor") {
+			t.Errorf("usage not formatted for the program name:\n%s", got)
+		}
+		if !strings.Contains(got, "prog ") {
+			t.Errorf("usage does not name the program:\n%s", got)
+		}
+	}
+}
+
+func TestExitStatusOfChallengeErrors(t *testing.T) {
+	tData := []struct {
+		err  error
+		exit int
+	}{
+		{fmt.Errorf("decode: %w", drum.ErrBadMagic), 65},
+		{fmt.Errorf("dial: %w", securecomm.ErrUnauthorizedKey), 77},
+	}
+
+	for _, exp := range tData {
+		if got := errcode.ExitStatus(exp.err); got != exp.exit {
+			t.Errorf("ExitStatus(%v) = %d, expected %d", exp.err, got, exp.exit)
+		}
+	}
+}
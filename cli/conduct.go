@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+	"github.com/jpreese/go-mentor/pkg/conduct"
+)
+
+// runConduct keeps the beat for followers, reading new tempos from
+// standard input, one per line.
+func runConduct(args []string) error {
+	flags := flag.NewFlagSet("conduct", flag.ExitOnError)
+	tempo := flags.Float64("tempo", 120, "Beats per minute to start at")
+	key := flags.String("key", "", "Identity key file, created if it does not exist, for followers to pin; a new key each run when empty")
+	authorizedKeys := flags.String("authorized-keys", "", "Only let followers whose identity key is in this file connect")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: %s conduct [flags] <[host:]port>", program)
+	}
+	addr := flags.Arg(0)
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = ":" + addr
+	}
+
+	c, err := conduct.NewConductor(float32(*tempo))
+	if err != nil {
+		return err
+	}
+	var opts []securecomm.Option
+	if *key != "" {
+		identity, err := securecomm.LoadOrGenerateKey(*key)
+		if err != nil {
+			return err
+		}
+		log.Printf("identity %s", securecomm.Fingerprint(identity.Public))
+		opts = append(opts, securecomm.WithIdentity(identity))
+	}
+	if *authorizedKeys != "" {
+		ak, err := securecomm.LoadAuthorizedKeys(*authorizedKeys)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, securecomm.WithAuthorizedKeys(ak))
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("conducting at %v beats per minute on %s; type a tempo to change it", *tempo, l.Addr())
+	s := &securecomm.Server{Handler: c.Serve, Options: opts}
+	go func() {
+		lines := bufio.NewScanner(os.Stdin)
+		for lines.Scan() {
+			tempo, err := strconv.ParseFloat(strings.TrimSpace(lines.Text()), 32)
+			if err == nil {
+				err = c.SetTempo(float32(tempo))
+			}
+			if err != nil {
+				log.Print(err)
+			}
+		}
+	}()
+
+	return s.Serve(l)
+}
+
+// runFollow plays a pattern to the beat of a conductor, printing the
+// tracks that play on each step, until killed.
+func runFollow(args []string) error {
+	flags := flag.NewFlagSet("follow", flag.ExitOnError)
+	var client clientFlags
+	client.register(flags)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: %s follow [flags] <host:port> <pattern file>", program)
+	}
+
+	p, err := drum.DecodeFile(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	conn, err := client.dial(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	f := conduct.Follow(conn)
+	defer f.Close()
+
+	return f.Play(context.Background(), p, func(step int, tracks []drum.Track) {
+		names := make([]string, len(tracks))
+		for i, track := range tracks {
+			names[i] = track.Name
+		}
+		fmt.Printf("%2d %s\n", step, strings.Join(names, " "))
+	})
+}
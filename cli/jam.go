@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/pkg/jam"
+)
+
+const jamUsage = `usage: %[1]s jam [flags] <host:port> [pattern file]
+
+Edits a pattern together with the other clients of a server run with
+%[1]s secure serve -broadcast, starting from the pattern file if
+given. It prints the pattern whenever it changes and reads edits from
+standard input, one per line:
+
+  on <track> <step>        turn a step on
+  off <track> <step>       turn a step off
+  toggle <track> <step>    turn a step on if it is off, off if it is on
+  tempo <bpm>              set the tempo
+  show                     print the pattern`
+
+// runJam edits a pattern together with the other clients of a broadcast
+// server until standard input ends or the connection fails.
+func runJam(args []string) error {
+	flags := flag.NewFlagSet("jam", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), jamUsage+"\n\nFlags:\n", program)
+		flags.PrintDefaults()
+	}
+	var client clientFlags
+	client.register(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 || flags.NArg() > 2 {
+		return fmt.Errorf(jamUsage, program)
+	}
+
+	var p *drum.Pattern
+	if flags.NArg() == 2 {
+		var err error
+		if p, err = drum.DecodeFile(flags.Arg(1)); err != nil {
+			return err
+		}
+	}
+	conn, err := client.dial(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	s, err := jam.Join(conn, p)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer s.Close()
+
+	go func() {
+		for {
+			select {
+			case <-s.Changed():
+				fmt.Println(s.Pattern())
+			case <-s.Done():
+				log.Fatal(s.Err())
+			}
+		}
+	}()
+
+	lines := bufio.NewScanner(os.Stdin)
+	for lines.Scan() {
+		if err := jamEdit(s, strings.Fields(lines.Text())); err != nil {
+			log.Print(err)
+		}
+	}
+
+	return lines.Err()
+}
+
+// jamEdit applies the edit a line of input asks for.
+func jamEdit(s *jam.Session, fields []string) error {
+	if len(fields) == 0 {
+		return nil
+	}
+
+	switch command, args := fields[0], fields[1:]; command {
+	case "on", "off", "toggle":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s <track> <step>", command)
+		}
+		track, err := strconv.Atoi(args[0])
+		if err != nil {
+			return fmt.Errorf("parse track: %w", err)
+		}
+		step, err := strconv.Atoi(args[1])
+		if err != nil {
+			return fmt.Errorf("parse step: %w", err)
+		}
+		if command == "toggle" {
+			return s.Toggle(track, step)
+		}
+		return s.SetStep(track, step, command == "on")
+	case "tempo":
+		if len(args) != 1 {
+			return errors.New("usage: tempo <bpm>")
+		}
+		tempo, err := strconv.ParseFloat(args[0], 32)
+		if err != nil {
+			return fmt.Errorf("parse tempo: %w", err)
+		}
+		return s.SetTempo(float32(tempo))
+	case "show":
+		fmt.Println(s.Pattern())
+		return nil
+	default:
+		return fmt.Errorf("unknown edit %q", command)
+	}
+}
@@ -0,0 +1,179 @@
+package cli
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+	"github.com/jpreese/go-mentor/pkg/patterns"
+)
+
+const patternsUsage = `Usage: %s patterns <command> [flags] [arguments]
+
+Commands:
+  serve <[host:]port> <dir>     serve the .splice files in the directory
+  list <host:port>              list the patterns a server holds
+  get <host:port> <name>...     fetch patterns from a server and print them`
+
+// runPatterns runs the patterns command named by the first of args with
+// the rest.
+func runPatterns(args []string) error {
+	if len(args) < 1 {
+		return fmt.Errorf(patternsUsage, program)
+	}
+
+	switch command, args := args[0], args[1:]; command {
+	case "serve":
+		return servePatterns(args)
+	case "list":
+		return listPatterns(args)
+	case "get":
+		return getPatterns(args)
+	default:
+		return fmt.Errorf("unknown patterns command %q\n\n"+patternsUsage, command, program)
+	}
+}
+
+// servePatterns serves the patterns in a directory until killed.
+func servePatterns(args []string) error {
+	flags := flag.NewFlagSet("patterns serve", flag.ExitOnError)
+	key := flags.String("key", "", "Identity key file, created if it does not exist; a new key each run when empty")
+	authorizedKeys := flags.String("authorized-keys", "", "Only serve clients whose identity key is in this file")
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: %s patterns serve [flags] <[host:]port> <dir>", program)
+	}
+	addr, dir := flags.Arg(0), flags.Arg(1)
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = ":" + addr
+	}
+
+	store, err := drum.NewFileStore(dir)
+	if err != nil {
+		return err
+	}
+	var opts []securecomm.Option
+	if *key != "" {
+		identity, err := securecomm.LoadOrGenerateKey(*key)
+		if err != nil {
+			return err
+		}
+		log.Printf("identity %s", securecomm.Fingerprint(identity.Public))
+		opts = append(opts, securecomm.WithIdentity(identity))
+	}
+	if *authorizedKeys != "" {
+		ak, err := securecomm.LoadAuthorizedKeys(*authorizedKeys)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, securecomm.WithAuthorizedKeys(ak))
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("serving the patterns in %s on %s", dir, l.Addr())
+	s := &securecomm.Server{Handler: patterns.Handler(store), Options: opts}
+
+	return s.Serve(l)
+}
+
+// clientFlags configure how a client connects to a server.
+type clientFlags struct {
+	key, knownHosts string
+}
+
+func (f *clientFlags) register(flags *flag.FlagSet) {
+	flags.StringVar(&f.key, "key", "", "Identity key file, created if it does not exist")
+	flags.StringVar(&f.knownHosts, "known-hosts", "", "Pin server identities in this file, trusting new servers on first use")
+}
+
+// dial connects to the server at addr as the flags say.
+func (f *clientFlags) dial(addr string) (*securecomm.SecureConn, error) {
+	var opts []securecomm.Option
+	if f.key != "" {
+		identity, err := securecomm.LoadOrGenerateKey(f.key)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, securecomm.WithIdentity(identity))
+	}
+	if f.knownHosts != "" {
+		kh, err := securecomm.LoadKnownHosts(f.knownHosts)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, securecomm.WithKnownHosts(kh))
+	}
+
+	return securecomm.Dial(addr, opts...)
+}
+
+// dialPatterns parses the flags of a patterns client and connects to the
+// server named by the first argument left.
+func dialPatterns(name, usage string, args []string) (*patterns.Client, *flag.FlagSet, error) {
+	flags := flag.NewFlagSet(name, flag.ExitOnError)
+	var client clientFlags
+	client.register(flags)
+	flags.Parse(args)
+	if flags.NArg() < 1 {
+		return nil, nil, errors.New(usage)
+	}
+
+	conn, err := client.dial(flags.Arg(0))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return patterns.NewClient(conn), flags, nil
+}
+
+// listPatterns prints the names of the patterns a server holds.
+func listPatterns(args []string) error {
+	client, _, err := dialPatterns("patterns list", fmt.Sprintf("usage: %s patterns list [flags] <host:port>", program), args)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	names, err := client.List()
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		fmt.Println(name)
+	}
+
+	return nil
+}
+
+// getPatterns fetches patterns from a server and prints them.
+func getPatterns(args []string) error {
+	usage := fmt.Sprintf("usage: %s patterns get [flags] <host:port> <name>...", program)
+	client, flags, err := dialPatterns("patterns get", usage, args)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	if flags.NArg() < 2 {
+		return errors.New(usage)
+	}
+
+	for i, name := range flags.Args()[1:] {
+		p, err := client.Get(name)
+		if err != nil {
+			return err
+		}
+		if i > 0 {
+			fmt.Println()
+		}
+		fmt.Print(p)
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge1/pkg/midi"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+	"github.com/jpreese/go-mentor/pkg/playback"
+)
+
+// runRecord records a bar from a MIDI device, saves it, and sends it to
+// a playback server to play.
+func runRecord(args []string) error {
+	flags := flag.NewFlagSet("record", flag.ExitOnError)
+	tempo := flags.Float64("tempo", 120, "Beats per minute to quantize the hits to")
+	grid := flags.Int("grid", 1, "Steps between the grid lines hits are moved towards: 1, 2, 4 or 8")
+	strength := flags.Float64("strength", 1, "How far to move hits towards the grid, from 0 to 1")
+	out := flags.String("o", "recorded.splice", "Pattern file to save the recording in")
+	bars := flags.Int("bars", 4, "Number of times the server plays the pattern")
+	var client clientFlags
+	client.register(flags)
+	flags.Parse(args)
+	if flags.NArg() != 2 {
+		return fmt.Errorf("usage: %s record [flags] <midi device> <host:port>", program)
+	}
+
+	device, err := os.Open(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	log.Printf("recording a bar at %v beats per minute from %s; it starts with the first hit", *tempo, flags.Arg(0))
+	take, err := midi.RecordTake(device, float32(*tempo))
+	device.Close()
+	if err != nil {
+		return err
+	}
+	p, err := take.Quantize(midi.StepResolution(*grid), *strength)
+	if err != nil {
+		return err
+	}
+	fmt.Print(p)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	if _, err := p.WriteTo(f); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	conn, err := client.dial(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return playback.Send(conn, *out, *bars, func() {
+		log.Printf("%s playing %s", flags.Arg(1), *out)
+	})
+}
+
+// runPlay receives patterns from runRecord and plays them, printing the
+// tracks that play on each step, until killed.
+func runPlay(args []string) error {
+	flags := flag.NewFlagSet("play", flag.ExitOnError)
+	dir := flags.String("dir", ".", "Directory to keep the patterns received in")
+	key := flags.String("key", "", "Identity key file, created if it does not exist, for clients to pin; a new key each run when empty")
+	authorizedKeys := flags.String("authorized-keys", "", "Only let clients whose identity key is in this file connect")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf("usage: %s play [flags] <[host:]port>", program)
+	}
+	addr := flags.Arg(0)
+	if _, _, err := net.SplitHostPort(addr); err != nil {
+		addr = ":" + addr
+	}
+
+	var opts []securecomm.Option
+	if *key != "" {
+		identity, err := securecomm.LoadOrGenerateKey(*key)
+		if err != nil {
+			return err
+		}
+		log.Printf("identity %s", securecomm.Fingerprint(identity.Public))
+		opts = append(opts, securecomm.WithIdentity(identity))
+	}
+	if *authorizedKeys != "" {
+		ak, err := securecomm.LoadAuthorizedKeys(*authorizedKeys)
+		if err != nil {
+			return err
+		}
+		opts = append(opts, securecomm.WithAuthorizedKeys(ak))
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("playing the patterns sent to %s", l.Addr())
+	s := &securecomm.Server{
+		Handler: playback.Handler(*dir, func(name string, step int, tracks []drum.Track) {
+			names := make([]string, len(tracks))
+			for i, track := range tracks {
+				names[i] = track.Name
+			}
+			fmt.Printf("%s %2d %s\n", name, step, strings.Join(names, " "))
+		}),
+		Options: opts,
+	}
+
+	return s.Serve(l)
+}
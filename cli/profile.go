@@ -0,0 +1,90 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+	"github.com/jpreese/go-mentor/pkg/profile"
+)
+
+const profileUsage = `usage: %s profile [flags] <decode|transfer>
+
+Runs a fixed workload and writes CPU and heap profiles of it, for go
+tool pprof to read:
+
+  decode      decode -files generated pattern files with one decoder
+  transfer    send -mb megabytes over a secure connection on loopback`
+
+// runProfile runs a profile workload and prints its result.
+func runProfile(args []string) error {
+	flags := flag.NewFlagSet("profile", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), profileUsage+"\n\nFlags:\n", program)
+		flags.PrintDefaults()
+	}
+	files := flags.Int("files", 10000, "Number of pattern files the decode workload decodes")
+	mb := flags.Int64("mb", 1024, "Megabytes the transfer workload sends")
+	cipher := flags.String("cipher", "", "Cipher suite of the transfer workload: nacl-box or xchacha20-poly1305; the default when empty")
+	cpuProfile := flags.String("cpuprofile", "", "CPU profile file; <workload>.cpu.pprof when empty")
+	memProfile := flags.String("memprofile", "", "Heap profile file; <workload>.heap.pprof when empty")
+	flags.Parse(args)
+	if flags.NArg() != 1 {
+		return fmt.Errorf(profileUsage, program)
+	}
+
+	var w profile.Workload
+	switch name := flags.Arg(0); name {
+	case "decode":
+		w = profile.Decode{Files: *files}
+	case "transfer":
+		t := profile.Transfer{Size: *mb << 20}
+		if *cipher != "" {
+			suite, err := securecomm.ParseCipherSuite(*cipher)
+			if err != nil {
+				return err
+			}
+			t.Options = append(t.Options, securecomm.WithCipherSuite(suite))
+		}
+		w = t
+	default:
+		return fmt.Errorf("unknown workload %q\n\n"+profileUsage, name, program)
+	}
+
+	cpu, err := createOr(*cpuProfile, w.Name()+".cpu.pprof")
+	if err != nil {
+		return err
+	}
+	defer cpu.Close()
+	heap, err := createOr(*memProfile, w.Name()+".heap.pprof")
+	if err != nil {
+		return err
+	}
+	defer heap.Close()
+
+	r, err := profile.Run(w, cpu, heap)
+	if err != nil {
+		return err
+	}
+	fmt.Println(r)
+
+	for _, f := range []io.Closer{cpu, heap} {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("wrote %s and %s\n", cpu.Name(), heap.Name())
+
+	return nil
+}
+
+// createOr creates the file at path, or at fallback if path is empty.
+func createOr(path, fallback string) (*os.File, error) {
+	if path == "" {
+		path = fallback
+	}
+
+	return os.Create(path)
+}
@@ -0,0 +1,13 @@
+// Command gomentor serves the command line of every challenge as one of
+// its subcommands, and those that combine them. See package cli.
+package main
+
+import (
+	"os"
+
+	"github.com/jpreese/go-mentor/cli"
+)
+
+func main() {
+	cli.Main("gomentor", os.Args[1:])
+}
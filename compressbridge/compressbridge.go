@@ -0,0 +1,120 @@
+// Package compressbridge compresses the frames of secure connections
+// with Snappy or Zstandard rather than DEFLATE, when both peers offer
+// them:
+//
+//	zstd, err := compressbridge.NewZstd()
+//	conn, err := securecomm.Dial(addr, securecomm.WithCompression(zstd, compressbridge.Snappy{}))
+//
+// The codecs come from golang/snappy and klauspost/compress.
+package compressbridge
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// Snappy is a securecomm.Compressor for Snappy.
+type Snappy struct{}
+
+var _ securecomm.Compressor = Snappy{}
+
+// Compression returns securecomm.CompressionSnappy.
+func (Snappy) Compression() securecomm.Compression {
+	return securecomm.CompressionSnappy
+}
+
+// Compress appends src compressed to dst.
+func (Snappy) Compress(dst, src []byte) ([]byte, error) {
+	n := snappy.MaxEncodedLen(len(src))
+	if n < 0 {
+		return nil, snappy.ErrTooLarge
+	}
+
+	dst = slices.Grow(dst, n)
+	out := snappy.Encode(dst[len(dst):len(dst)+n], src)
+
+	return dst[:len(dst)+len(out)], nil
+}
+
+// Decompress appends src decompressed to dst, checking the length src
+// declares against limit before decoding it.
+func (Snappy) Decompress(dst, src []byte, limit int) ([]byte, error) {
+	n, err := snappy.DecodedLen(src)
+	if err != nil {
+		return nil, err
+	}
+	if n > limit {
+		return nil, fmt.Errorf("snappy block of %d bytes: %w", n, securecomm.ErrMessageTooLarge)
+	}
+
+	dst = slices.Grow(dst, n)
+	out, err := snappy.Decode(dst[len(dst):len(dst)+n], src)
+	if err != nil {
+		return nil, err
+	}
+
+	return dst[:len(dst)+len(out)], nil
+}
+
+// Zstd is a securecomm.Compressor for Zstandard.
+type Zstd struct {
+	encoder *zstd.Encoder
+	decoder *zstd.Decoder
+}
+
+var _ securecomm.Compressor = (*Zstd)(nil)
+
+// NewZstd returns a Zstd compressing at the fastest level, which suits
+// frames of at most a few tens of kilobytes.
+func NewZstd() (*Zstd, error) {
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest))
+	if err != nil {
+		return nil, err
+	}
+
+	decoder, err := zstd.NewReader(nil, zstd.WithDecodeAllCapLimit(true))
+	if err != nil {
+		return nil, err
+	}
+
+	return &Zstd{encoder: encoder, decoder: decoder}, nil
+}
+
+// Compression returns securecomm.CompressionZstd.
+func (z *Zstd) Compression() securecomm.Compression {
+	return securecomm.CompressionZstd
+}
+
+// Compress appends src compressed to dst, as a single frame that
+// declares its decompressed size.
+func (z *Zstd) Compress(dst, src []byte) ([]byte, error) {
+	return z.encoder.EncodeAll(src, dst), nil
+}
+
+// Decompress appends src decompressed to dst. src must be a single
+// frame declaring a size of at most limit bytes, and is decoded into no
+// more than that.
+func (z *Zstd) Decompress(dst, src []byte, limit int) ([]byte, error) {
+	var h zstd.Header
+	if err := h.Decode(src); err != nil {
+		return nil, err
+	}
+	if !h.HasFCS {
+		return nil, fmt.Errorf("zstd frame does not declare its size")
+	}
+	if h.FrameContentSize > uint64(limit) {
+		return nil, fmt.Errorf("zstd frame of %d bytes: %w", h.FrameContentSize, securecomm.ErrMessageTooLarge)
+	}
+
+	// The decoder stops at dst's capacity, so a frame cannot grow past
+	// the size it declared, nor can more frames follow it.
+	n := int(h.FrameContentSize)
+	dst = slices.Grow(dst, n)
+
+	return z.decoder.DecodeAll(src, dst[:len(dst):len(dst)+n])
+}
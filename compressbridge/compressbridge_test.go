@@ -0,0 +1,125 @@
+package compressbridge
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+func compressors(t *testing.T) []securecomm.Compressor {
+	t.Helper()
+
+	z, err := NewZstd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return []securecomm.Compressor{Snappy{}, z}
+}
+
+func TestRoundTrip(t *testing.T) {
+	logs := []byte(strings.Repeat(`{"level":"info","msg":"request served"}`+"\n", 100))
+
+	for _, c := range compressors(t) {
+		compressed, err := c.Compress([]byte("prefix"), logs)
+		if err != nil {
+			t.Fatalf("%v: %v", c.Compression(), err)
+		}
+		if !bytes.HasPrefix(compressed, []byte("prefix")) || len(compressed) >= len(logs) {
+			t.Errorf("%v: compressed %d bytes into %d", c.Compression(), len(logs), len(compressed))
+		}
+
+		decompressed, err := c.Decompress([]byte("prefix"), compressed[len("prefix"):], len(logs))
+		if err != nil {
+			t.Fatalf("%v: %v", c.Compression(), err)
+		}
+		if !bytes.Equal(decompressed, append([]byte("prefix"), logs...)) {
+			t.Errorf("%v: did not round trip", c.Compression())
+		}
+	}
+}
+
+func TestDecompressLimit(t *testing.T) {
+	zeros := make([]byte, 1<<20)
+
+	for _, c := range compressors(t) {
+		compressed, err := c.Compress(nil, zeros)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := c.Decompress(nil, compressed, len(zeros)-1); !errors.Is(err, securecomm.ErrMessageTooLarge) {
+			t.Errorf("%v: expected ErrMessageTooLarge, got %v", c.Compression(), err)
+		}
+	}
+}
+
+func TestZstdRejectsTrailingFrames(t *testing.T) {
+	z, err := NewZstd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	small, err := z.Compress(nil, []byte("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := z.Compress(nil, make([]byte, 1<<20))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := z.Decompress(nil, append(small, large...), 1024); err == nil {
+		t.Error("expected a frame followed by another to be rejected")
+	}
+}
+
+func TestNegotiation(t *testing.T) {
+	z, err := NewZstd()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		server []securecomm.Compressor
+		client []securecomm.Compressor
+		want   securecomm.Compression
+	}{
+		{"deflate", nil, []securecomm.Compressor{Snappy{}, z}, securecomm.CompressionDeflate},
+		{"snappy", []securecomm.Compressor{Snappy{}, z}, []securecomm.Compressor{Snappy{}}, securecomm.CompressionSnappy},
+		{"zstd", []securecomm.Compressor{Snappy{}, z}, []securecomm.Compressor{z, Snappy{}}, securecomm.CompressionZstd},
+	}
+
+	for _, test := range tests {
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		go securecomm.Serve(l, nil, securecomm.WithCompression(test.server...))
+
+		conn, err := securecomm.Dial(l.Addr().String(), securecomm.WithCompression(test.client...))
+		if err != nil {
+			l.Close()
+			t.Fatal(err)
+		}
+		if got, ok := conn.Compression(); !ok || got != test.want {
+			t.Errorf("%s: compression is %v, %v", test.name, got, ok)
+		}
+
+		message := bytes.Repeat([]byte("compress me "), 1000)
+		if err := conn.WriteMsg(message); err != nil {
+			t.Fatal(err)
+		}
+		if echo, err := conn.ReadMsg(); err != nil || !bytes.Equal(echo, message) {
+			t.Errorf("%s: unexpected echo of %d bytes, %v", test.name, len(echo), err)
+		}
+
+		conn.Close()
+		l.Close()
+	}
+}
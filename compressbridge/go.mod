@@ -0,0 +1,14 @@
+module github.com/jpreese/go-mentor/compressbridge
+
+go 1.22
+
+require (
+	github.com/golang/snappy v1.0.0
+	github.com/jpreese/go-mentor/challenge2 v0.1.0
+	github.com/klauspost/compress v1.18.0
+)
+
+require (
+	golang.org/x/crypto v0.0.0-20191029031824-8986dd9e96cf // indirect
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+)
@@ -0,0 +1,218 @@
+// Package errcode gives the errors of the challenges stable, machine
+// readable codes, so that commands can choose exit statuses and servers
+// can choose responses the same way whichever package an error came
+// from.
+//
+// Packages define their sentinel errors with New, so that each carries
+// its code however deeply it is wrapped:
+//
+//	var ErrBadMagic = errcode.New(errcode.DrumBadMagic, "not a pattern file")
+//
+// and callers read the code back with Of.
+//
+// The challenge modules each keep a copy of this package under
+// internal/errcode, with their own codes alone, so that they depend on
+// no other module. The copies are generated from this file, so codes
+// and statuses change here alone. Of, ExitStatus and HTTPStatus read the
+// codes of their errors as well as of those made here.
+package errcode
+
+//go:generate go run gen.go
+
+import (
+	"errors"
+	"net/http"
+)
+
+// A Code names a kind of failure. Codes are part of the API: once
+// released they are never renamed or given another meaning.
+type Code string
+
+// The codes of the drum package.
+const (
+	DrumBadMagic         Code = "DRUM_BAD_MAGIC"
+	DrumTruncated        Code = "DRUM_TRUNCATED"
+	DrumChecksumMismatch Code = "DRUM_CHECKSUM_MISMATCH"
+	DrumChecksumMissing  Code = "DRUM_CHECKSUM_MISSING"
+	DrumPatternNotFound  Code = "DRUM_PATTERN_NOT_FOUND"
+	DrumUnknownExporter  Code = "DRUM_UNKNOWN_EXPORTER"
+	DrumInvalidPatternID Code = "DRUM_INVALID_PATTERN_ID"
+)
+
+// The codes of the securecomm package.
+const (
+	SecureMessageTooLarge     Code = "SECURE_MESSAGE_TOO_LARGE"
+	SecureReplayed            Code = "SECURE_REPLAYED"
+	SecureDecryptFailed       Code = "SECURE_DECRYPT_FAILED"
+	SecureBadHandshake        Code = "SECURE_BAD_HANDSHAKE"
+	SecureTranscriptMismatch  Code = "SECURE_TRANSCRIPT_MISMATCH"
+	SecurePassphraseRequired  Code = "SECURE_PASSPHRASE_REQUIRED"
+	SecureIncorrectPassphrase Code = "SECURE_INCORRECT_PASSPHRASE"
+	SecureHostKeyRejected     Code = "SECURE_HOST_KEY_REJECTED"
+	SecurePeerNotFound        Code = "SECURE_PEER_NOT_FOUND"
+	SecureRelayFull           Code = "SECURE_RELAY_FULL"
+	SecureUnexpectedPeer      Code = "SECURE_UNEXPECTED_PEER"
+	SecureNoPeerIdentity      Code = "SECURE_NO_PEER_IDENTITY"
+	SecureUnauthorizedKey     Code = "SECURE_UNAUTHORIZED_KEY"
+	SecureBadSignature        Code = "SECURE_BAD_SIGNATURE"
+	SecureUntrustedSigner     Code = "SECURE_UNTRUSTED_SIGNER"
+	SecureWriteClosed         Code = "SECURE_WRITE_CLOSED"
+	SecurePSKMismatch         Code = "SECURE_PSK_MISMATCH"
+	SecurePeerUnresponsive    Code = "SECURE_PEER_UNRESPONSIVE"
+	SecureProxyRefused        Code = "SECURE_PROXY_REFUSED"
+	SecurePassphraseMismatch  Code = "SECURE_PASSPHRASE_MISMATCH"
+	SecureServerClosed        Code = "SECURE_SERVER_CLOSED"
+	SecureTooManyConnections  Code = "SECURE_TOO_MANY_CONNECTIONS"
+	SecureAckUnsupported      Code = "SECURE_ACK_UNSUPPORTED"
+	SecureChecksumMismatch    Code = "SECURE_CHECKSUM_MISMATCH"
+	SecureRateLimited         Code = "SECURE_RATE_LIMITED"
+	SecureNonceExhausted      Code = "SECURE_NONCE_EXHAUSTED"
+	SecureFrameRejected       Code = "SECURE_FRAME_REJECTED"
+	SecureIdleTimeout         Code = "SECURE_IDLE_TIMEOUT"
+	SecureMaxLifetime         Code = "SECURE_MAX_LIFETIME"
+	SecureBanned              Code = "SECURE_BANNED"
+	SecureAgentKeyNotFound    Code = "SECURE_AGENT_KEY_NOT_FOUND"
+	SecureIncorrectPIN        Code = "SECURE_INCORRECT_PIN"
+	SecureNotRecipient        Code = "SECURE_NOT_RECIPIENT"
+	SecureNoCaptureKeys       Code = "SECURE_NO_CAPTURE_KEYS"
+)
+
+// Error is an error with a code. Its message is that of the error it
+// wraps, or the one it was made with.
+type Error struct {
+	Code Code
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrorCode returns the error's code as a string, for packages that read
+// codes without importing this one.
+func (e *Error) ErrorCode() string {
+	return string(e.Code)
+}
+
+// New returns an error with the code and message, for use as a
+// sentinel. Like errors.New, each call returns a distinct error.
+func New(code Code, msg string) error {
+	return &Error{Code: code, Err: errors.New(msg)}
+}
+
+// Wrap attaches code to err, which keeps its message. It returns nil
+// when err is nil.
+func Wrap(code Code, err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &Error{Code: code, Err: err}
+}
+
+// coder is an error with a code: an *Error, or one made by a copy of
+// this package.
+type coder interface {
+	error
+	ErrorCode() string
+}
+
+// Of returns the code of the outermost coded error in err's chain, or
+// the empty code when none has one.
+func Of(err error) Code {
+	var e coder
+	if errors.As(err, &e) {
+		return Code(e.ErrorCode())
+	}
+
+	return ""
+}
+
+// Exit statuses from sysexits(3), which commands fail with.
+const (
+	exitFailure     = 1
+	exitDataErr     = 65
+	exitNoInput     = 66
+	exitUnavailable = 69
+	exitTempFail    = 75
+	exitProtocol    = 76
+	exitNoPerm      = 77
+	exitConfig      = 78
+)
+
+// statuses holds the exit status and HTTP status of each code.
+var statuses = map[Code]struct{ exit, http int }{
+	DrumBadMagic:         {exitDataErr, http.StatusUnprocessableEntity},
+	DrumTruncated:        {exitDataErr, http.StatusUnprocessableEntity},
+	DrumChecksumMismatch: {exitDataErr, http.StatusUnprocessableEntity},
+	DrumChecksumMissing:  {exitDataErr, http.StatusUnprocessableEntity},
+	DrumPatternNotFound:  {exitNoInput, http.StatusNotFound},
+	DrumUnknownExporter:  {exitConfig, http.StatusBadRequest},
+	DrumInvalidPatternID: {exitDataErr, http.StatusBadRequest},
+
+	SecureMessageTooLarge:     {exitProtocol, http.StatusRequestEntityTooLarge},
+	SecureReplayed:            {exitProtocol, http.StatusBadGateway},
+	SecureDecryptFailed:       {exitProtocol, http.StatusBadGateway},
+	SecureBadHandshake:        {exitProtocol, http.StatusBadGateway},
+	SecureTranscriptMismatch:  {exitProtocol, http.StatusBadGateway},
+	SecurePassphraseRequired:  {exitConfig, http.StatusUnauthorized},
+	SecureIncorrectPassphrase: {exitNoPerm, http.StatusUnauthorized},
+	SecureHostKeyRejected:     {exitNoPerm, http.StatusBadGateway},
+	SecurePeerNotFound:        {exitUnavailable, http.StatusNotFound},
+	SecureRelayFull:           {exitTempFail, http.StatusServiceUnavailable},
+	SecureUnexpectedPeer:      {exitNoPerm, http.StatusBadGateway},
+	SecureNoPeerIdentity:      {exitNoPerm, http.StatusBadGateway},
+	SecureUnauthorizedKey:     {exitNoPerm, http.StatusForbidden},
+	SecureBadSignature:        {exitNoPerm, http.StatusBadGateway},
+	SecureUntrustedSigner:     {exitNoPerm, http.StatusBadGateway},
+	SecureWriteClosed:         {exitFailure, http.StatusInternalServerError},
+	SecurePSKMismatch:         {exitConfig, http.StatusBadGateway},
+	SecurePeerUnresponsive:    {exitUnavailable, http.StatusGatewayTimeout},
+	SecureProxyRefused:        {exitUnavailable, http.StatusBadGateway},
+	SecurePassphraseMismatch:  {exitConfig, http.StatusBadGateway},
+	SecureServerClosed:        {exitUnavailable, http.StatusServiceUnavailable},
+	SecureTooManyConnections:  {exitTempFail, http.StatusServiceUnavailable},
+	SecureAckUnsupported:      {exitProtocol, http.StatusNotImplemented},
+	SecureChecksumMismatch:    {exitDataErr, http.StatusBadGateway},
+	SecureRateLimited:         {exitTempFail, http.StatusTooManyRequests},
+	SecureNonceExhausted:      {exitProtocol, http.StatusBadGateway},
+	SecureFrameRejected:       {exitProtocol, http.StatusBadGateway},
+	SecureIdleTimeout:         {exitTempFail, http.StatusGatewayTimeout},
+	SecureMaxLifetime:         {exitTempFail, http.StatusServiceUnavailable},
+	SecureBanned:              {exitNoPerm, http.StatusForbidden},
+	SecureAgentKeyNotFound:    {exitNoPerm, http.StatusForbidden},
+	SecureIncorrectPIN:        {exitNoPerm, http.StatusUnauthorized},
+	SecureNotRecipient:        {exitNoPerm, http.StatusForbidden},
+	SecureNoCaptureKeys:       {exitConfig, http.StatusBadRequest},
+}
+
+// ExitStatus returns the status a command should exit with when it
+// fails with err: the sysexits(3) status of its code, 1 when it has
+// none, or 0 when err is nil.
+func ExitStatus(err error) int {
+	if err == nil {
+		return 0
+	}
+	if s, ok := statuses[Of(err)]; ok {
+		return s.exit
+	}
+
+	return exitFailure
+}
+
+// HTTPStatus returns the HTTP status a server should answer with when
+// it fails with err, 500 when its code has none, or 200 when err is nil.
+func HTTPStatus(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	if s, ok := statuses[Of(err)]; ok {
+		return s.http
+	}
+
+	return http.StatusInternalServerError
+}
@@ -0,0 +1,112 @@
+package errcode
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"regexp"
+	"testing"
+)
+
+func TestOf(t *testing.T) {
+	sentinel := New(DrumBadMagic, "not a pattern file")
+	wrapped := fmt.Errorf("decode pattern.splice: %w", sentinel)
+
+	if got := Of(wrapped); got != DrumBadMagic {
+		t.Errorf("expected %s, got %q", DrumBadMagic, got)
+	}
+	if !errors.Is(wrapped, sentinel) {
+		t.Error("expected the wrapped error to still be the sentinel")
+	}
+	if wrapped.Error() != "decode pattern.splice: not a pattern file" {
+		t.Errorf("unexpected message %q", wrapped)
+	}
+	if New(DrumBadMagic, "not a pattern file") == sentinel {
+		t.Error("expected New to return a distinct error each call")
+	}
+
+	// The outermost code wins.
+	truncated := Wrap(DrumTruncated, fmt.Errorf("read header: %w", io.ErrUnexpectedEOF))
+	if got := Of(Wrap(SecureDecryptFailed, truncated)); got != SecureDecryptFailed {
+		t.Errorf("expected %s, got %q", SecureDecryptFailed, got)
+	}
+	if !errors.Is(truncated, io.ErrUnexpectedEOF) {
+		t.Error("expected Wrap to keep the error it wraps")
+	}
+
+	if got := Of(io.EOF); got != "" {
+		t.Errorf("expected no code for an uncoded error, got %q", got)
+	}
+	if Wrap(DrumTruncated, nil) != nil {
+		t.Error("expected wrapping nil to give nil")
+	}
+}
+
+// copied is a coded error of another copy of the package.
+type copied struct{ code string }
+
+func (e copied) Error() string     { return "copied" }
+func (e copied) ErrorCode() string { return e.code }
+
+func TestOfCopies(t *testing.T) {
+	err := fmt.Errorf("handshake: %w", copied{string(SecureBadHandshake)})
+	if got := Of(err); got != SecureBadHandshake {
+		t.Errorf("expected %s, got %q", SecureBadHandshake, got)
+	}
+	if got := ExitStatus(err); got != 76 {
+		t.Errorf("expected exit status 76, got %d", got)
+	}
+}
+
+func TestStatuses(t *testing.T) {
+	tData := []struct {
+		err        error
+		exit, http int
+	}{
+		{nil, 0, http.StatusOK},
+		{io.EOF, 1, http.StatusInternalServerError},
+		{New(DrumBadMagic, "bad magic"), 65, http.StatusUnprocessableEntity},
+		{fmt.Errorf("get: %w", New(DrumPatternNotFound, "not found")), 66, http.StatusNotFound},
+		{New(SecureUnauthorizedKey, "unauthorized"), 77, http.StatusForbidden},
+		{New(SecureRateLimited, "slow down"), 75, http.StatusTooManyRequests},
+		{New(Code("UNLISTED"), "unlisted"), 1, http.StatusInternalServerError},
+	}
+
+	for _, exp := range tData {
+		if got := ExitStatus(exp.err); got != exp.exit {
+			t.Errorf("ExitStatus(%v) = %d, expected %d", exp.err, got, exp.exit)
+		}
+		if got := HTTPStatus(exp.err); got != exp.http {
+			t.Errorf("HTTPStatus(%v) = %d, expected %d", exp.err, got, exp.http)
+		}
+	}
+}
+
+func TestCodeNames(t *testing.T) {
+	name := regexp.MustCompile(`^(DRUM|SECURE)_[A-Z0-9_]+$`)
+	for code, s := range statuses {
+		if !name.MatchString(string(code)) {
+			t.Errorf("code %q is not named PACKAGE_REASON", code)
+		}
+		if s.exit == 0 || s.http == 0 {
+			t.Errorf("code %s is missing a status", code)
+		}
+	}
+}
+
+func TestCopiesUpToDate(t *testing.T) {
+	if _, err := os.Stat("../challenge1"); err != nil {
+		t.Skip("the challenges are not beside this module")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command to run gen.go with")
+	}
+
+	if out, err := exec.Command(goTool, "run", "gen.go", "-check").CombinedOutput(); err != nil {
+		t.Errorf("the challenges' copies of the package have drifted: %v\n%s", err, out)
+	}
+}
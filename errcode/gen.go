@@ -0,0 +1,129 @@
+//go:build ignore
+
+// Gen writes the copies of this package that the challenge modules keep
+// under internal/errcode, each holding the codes of its own package
+// alone, from errcode.go. Run it with go generate. With -check it
+// writes nothing and fails if a copy has drifted from errcode.go.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// copies are the challenge packages that keep a copy, and the prefix of
+// the names of their codes.
+var copies = []struct {
+	dir, pkg, prefix string
+}{
+	{"../challenge1/internal/errcode", "drum", "Drum"},
+	{"../challenge2/internal/errcode", "securecomm", "Secure"},
+}
+
+func main() {
+	log.SetFlags(0)
+	check := flag.Bool("check", false, "report copies that differ from errcode.go instead of writing them")
+	flag.Parse()
+
+	src, err := os.ReadFile("errcode.go")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	stale := false
+	for _, c := range copies {
+		out, err := generate(src, c.pkg, c.prefix)
+		if err != nil {
+			log.Fatalf("%s: %v", c.dir, err)
+		}
+
+		path := filepath.Join(c.dir, "errcode.go")
+		if *check {
+			if old, err := os.ReadFile(path); err != nil || !bytes.Equal(old, out) {
+				log.Printf("%s is out of date with errcode.go", path)
+				stale = true
+			}
+			continue
+		}
+		if err := os.WriteFile(path, out, 0644); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if stale {
+		log.Fatal("run go generate in the errcode module")
+	}
+}
+
+var (
+	// codeBlock matches the declarations of the codes of one package.
+	codeBlock = regexp.MustCompile(`(?m)^// The codes of the (\w+) package\.\nconst \((?s:.*?)\n\)\n\n`)
+
+	// status matches an entry of the statuses map.
+	status = regexp.MustCompile(`(?m)^\t([A-Z][a-z]+)\w*:\s+\{.*\},\n`)
+)
+
+// generate returns the copy of src for the package pkg, whose codes'
+// names start with prefix.
+func generate(src []byte, pkg, prefix string) ([]byte, error) {
+	s := string(src)
+
+	i := strings.Index(s, "\npackage errcode\n")
+	if i < 0 {
+		return nil, fmt.Errorf("no package clause in errcode.go")
+	}
+	s = header(pkg) + s[i+1:]
+	s = strings.Replace(s, "//go:generate go run gen.go\n\n", "", 1)
+
+	s = codeBlock.ReplaceAllStringFunc(s, func(block string) string {
+		if codeBlock.FindStringSubmatch(block)[1] != pkg {
+			return ""
+		}
+		return block
+	})
+	s = status.ReplaceAllStringFunc(s, func(entry string) string {
+		if status.FindStringSubmatch(entry)[1] != prefix {
+			return ""
+		}
+		return entry
+	})
+	s = strings.Replace(s, "int }{\n\n", "int }{\n", 1)
+	s = strings.Replace(s, ",\n\n}\n", ",\n}\n", 1)
+
+	return format.Source([]byte(s))
+}
+
+// header returns the generated-code notice and package doc of the copy
+// kept for pkg.
+func header(pkg string) string {
+	doc := fmt.Sprintf("Package errcode is the copy of github.com/jpreese/go-mentor/errcode "+
+		"that the %s package keeps, so that its module depends on no other in "+
+		"the repository. It holds the codes of %[1]s alone. Its errors carry "+
+		"them just as errors of the shared package would, and Of there reads "+
+		"them too.", pkg)
+
+	return "// Code generated by gen.go from errcode.go; DO NOT EDIT.\n\n" + wrap(doc)
+}
+
+// wrap wraps text into lines of comment no longer than 72 columns.
+func wrap(text string) string {
+	var b strings.Builder
+	line := "//"
+	for _, word := range strings.Fields(text) {
+		if len(line)+1+len(word) > 72 {
+			b.WriteString(line + "\n")
+			line = "//"
+		}
+		line += " " + word
+	}
+	b.WriteString(line + "\n")
+
+	return b.String()
+}
@@ -0,0 +1,3 @@
+module github.com/jpreese/go-mentor/errcode
+
+go 1.21
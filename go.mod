@@ -0,0 +1,17 @@
+module github.com/jpreese/go-mentor
+
+go 1.23
+
+require (
+	github.com/jpreese/go-mentor/challenge1 v0.1.0
+	github.com/jpreese/go-mentor/challenge2 v0.1.0
+	github.com/jpreese/go-mentor/challenge3 v0.1.0
+	github.com/jpreese/go-mentor/challenge4 v0.1.0
+	github.com/jpreese/go-mentor/errcode v0.1.0
+)
+
+require (
+	golang.org/x/crypto v0.0.0-20191029031824-8986dd9e96cf // indirect
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
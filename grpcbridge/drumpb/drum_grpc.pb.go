@@ -0,0 +1,329 @@
+// The drum machine patterns of challenge1 and a service decoding,
+// encoding and storing them, for programs that are not written in Go.
+
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.5.1
+// - protoc             (unknown)
+// source: drumpb/drum.proto
+
+package drumpb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.64.0 or later.
+const _ = grpc.SupportPackageIsVersion9
+
+const (
+	PatternService_DecodeStream_FullMethodName = "/gomentor.drum.v1.PatternService/DecodeStream"
+	PatternService_Encode_FullMethodName       = "/gomentor.drum.v1.PatternService/Encode"
+	PatternService_Get_FullMethodName          = "/gomentor.drum.v1.PatternService/Get"
+	PatternService_Put_FullMethodName          = "/gomentor.drum.v1.PatternService/Put"
+	PatternService_List_FullMethodName         = "/gomentor.drum.v1.PatternService/List"
+	PatternService_Delete_FullMethodName       = "/gomentor.drum.v1.PatternService/Delete"
+)
+
+// PatternServiceClient is the client API for PatternService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+//
+// PatternService decodes and encodes .splice files, and keeps patterns
+// by ID in the server's store.
+type PatternServiceClient interface {
+	// DecodeStream decodes the .splice file the client streams in chunks,
+	// streaming back each track as soon as it has been decoded.
+	DecodeStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Chunk, DecodeResponse], error)
+	// Encode encodes a pattern as a .splice file.
+	Encode(ctx context.Context, in *EncodeRequest, opts ...grpc.CallOption) (*EncodeResponse, error)
+	// Get returns the pattern stored under an ID.
+	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Pattern, error)
+	// Put stores a pattern under an ID, replacing any stored under it.
+	Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error)
+	// List lists the IDs of the stored patterns.
+	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
+	// Delete removes the pattern stored under an ID.
+	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error)
+}
+
+type patternServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewPatternServiceClient(cc grpc.ClientConnInterface) PatternServiceClient {
+	return &patternServiceClient{cc}
+}
+
+func (c *patternServiceClient) DecodeStream(ctx context.Context, opts ...grpc.CallOption) (grpc.BidiStreamingClient[Chunk, DecodeResponse], error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	stream, err := c.cc.NewStream(ctx, &PatternService_ServiceDesc.Streams[0], PatternService_DecodeStream_FullMethodName, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &grpc.GenericClientStream[Chunk, DecodeResponse]{ClientStream: stream}
+	return x, nil
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PatternService_DecodeStreamClient = grpc.BidiStreamingClient[Chunk, DecodeResponse]
+
+func (c *patternServiceClient) Encode(ctx context.Context, in *EncodeRequest, opts ...grpc.CallOption) (*EncodeResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(EncodeResponse)
+	err := c.cc.Invoke(ctx, PatternService_Encode_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *patternServiceClient) Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*Pattern, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(Pattern)
+	err := c.cc.Invoke(ctx, PatternService_Get_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *patternServiceClient) Put(ctx context.Context, in *PutRequest, opts ...grpc.CallOption) (*PutResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(PutResponse)
+	err := c.cc.Invoke(ctx, PatternService_Put_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *patternServiceClient) List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(ListResponse)
+	err := c.cc.Invoke(ctx, PatternService_List_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *patternServiceClient) Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*DeleteResponse, error) {
+	cOpts := append([]grpc.CallOption{grpc.StaticMethod()}, opts...)
+	out := new(DeleteResponse)
+	err := c.cc.Invoke(ctx, PatternService_Delete_FullMethodName, in, out, cOpts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// PatternServiceServer is the server API for PatternService service.
+// All implementations must embed UnimplementedPatternServiceServer
+// for forward compatibility.
+//
+// PatternService decodes and encodes .splice files, and keeps patterns
+// by ID in the server's store.
+type PatternServiceServer interface {
+	// DecodeStream decodes the .splice file the client streams in chunks,
+	// streaming back each track as soon as it has been decoded.
+	DecodeStream(grpc.BidiStreamingServer[Chunk, DecodeResponse]) error
+	// Encode encodes a pattern as a .splice file.
+	Encode(context.Context, *EncodeRequest) (*EncodeResponse, error)
+	// Get returns the pattern stored under an ID.
+	Get(context.Context, *GetRequest) (*Pattern, error)
+	// Put stores a pattern under an ID, replacing any stored under it.
+	Put(context.Context, *PutRequest) (*PutResponse, error)
+	// List lists the IDs of the stored patterns.
+	List(context.Context, *ListRequest) (*ListResponse, error)
+	// Delete removes the pattern stored under an ID.
+	Delete(context.Context, *DeleteRequest) (*DeleteResponse, error)
+	mustEmbedUnimplementedPatternServiceServer()
+}
+
+// UnimplementedPatternServiceServer must be embedded to have
+// forward compatible implementations.
+//
+// NOTE: this should be embedded by value instead of pointer to avoid a nil
+// pointer dereference when methods are called.
+type UnimplementedPatternServiceServer struct{}
+
+func (UnimplementedPatternServiceServer) DecodeStream(grpc.BidiStreamingServer[Chunk, DecodeResponse]) error {
+	return status.Errorf(codes.Unimplemented, "method DecodeStream not implemented")
+}
+func (UnimplementedPatternServiceServer) Encode(context.Context, *EncodeRequest) (*EncodeResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Encode not implemented")
+}
+func (UnimplementedPatternServiceServer) Get(context.Context, *GetRequest) (*Pattern, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Get not implemented")
+}
+func (UnimplementedPatternServiceServer) Put(context.Context, *PutRequest) (*PutResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Put not implemented")
+}
+func (UnimplementedPatternServiceServer) List(context.Context, *ListRequest) (*ListResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method List not implemented")
+}
+func (UnimplementedPatternServiceServer) Delete(context.Context, *DeleteRequest) (*DeleteResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
+}
+func (UnimplementedPatternServiceServer) mustEmbedUnimplementedPatternServiceServer() {}
+func (UnimplementedPatternServiceServer) testEmbeddedByValue()                        {}
+
+// UnsafePatternServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to PatternServiceServer will
+// result in compilation errors.
+type UnsafePatternServiceServer interface {
+	mustEmbedUnimplementedPatternServiceServer()
+}
+
+func RegisterPatternServiceServer(s grpc.ServiceRegistrar, srv PatternServiceServer) {
+	// If the following call pancis, it indicates UnimplementedPatternServiceServer was
+	// embedded by pointer and is nil.  This will cause panics if an
+	// unimplemented method is ever invoked, so we test this at initialization
+	// time to prevent it from happening at runtime later due to I/O.
+	if t, ok := srv.(interface{ testEmbeddedByValue() }); ok {
+		t.testEmbeddedByValue()
+	}
+	s.RegisterService(&PatternService_ServiceDesc, srv)
+}
+
+func _PatternService_DecodeStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(PatternServiceServer).DecodeStream(&grpc.GenericServerStream[Chunk, DecodeResponse]{ServerStream: stream})
+}
+
+// This type alias is provided for backwards compatibility with existing code that references the prior non-generic stream type by name.
+type PatternService_DecodeStreamServer = grpc.BidiStreamingServer[Chunk, DecodeResponse]
+
+func _PatternService_Encode_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(EncodeRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PatternServiceServer).Encode(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PatternService_Encode_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PatternServiceServer).Encode(ctx, req.(*EncodeRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PatternService_Get_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PatternServiceServer).Get(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PatternService_Get_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PatternServiceServer).Get(ctx, req.(*GetRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PatternService_Put_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(PutRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PatternServiceServer).Put(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PatternService_Put_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PatternServiceServer).Put(ctx, req.(*PutRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PatternService_List_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PatternServiceServer).List(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PatternService_List_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PatternServiceServer).List(ctx, req.(*ListRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _PatternService_Delete_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(PatternServiceServer).Delete(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: PatternService_Delete_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(PatternServiceServer).Delete(ctx, req.(*DeleteRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// PatternService_ServiceDesc is the grpc.ServiceDesc for PatternService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var PatternService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "gomentor.drum.v1.PatternService",
+	HandlerType: (*PatternServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Encode",
+			Handler:    _PatternService_Encode_Handler,
+		},
+		{
+			MethodName: "Get",
+			Handler:    _PatternService_Get_Handler,
+		},
+		{
+			MethodName: "Put",
+			Handler:    _PatternService_Put_Handler,
+		},
+		{
+			MethodName: "List",
+			Handler:    _PatternService_List_Handler,
+		},
+		{
+			MethodName: "Delete",
+			Handler:    _PatternService_Delete_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "DecodeStream",
+			Handler:       _PatternService_DecodeStream_Handler,
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+	Metadata: "drumpb/drum.proto",
+}
@@ -0,0 +1,17 @@
+module github.com/jpreese/go-mentor/grpcbridge
+
+go 1.23
+
+require (
+	github.com/jpreese/go-mentor/challenge1 v0.1.0
+	github.com/jpreese/go-mentor/errcode v0.1.0
+	google.golang.org/grpc v1.65.0
+	google.golang.org/protobuf v1.34.2
+)
+
+require (
+	golang.org/x/net v0.25.0 // indirect
+	golang.org/x/sys v0.20.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240528184218-531527333157 // indirect
+)
@@ -0,0 +1,230 @@
+// Package grpcbridge serves the drum decoder over gRPC, so that programs
+// written in other languages can decode, encode and store .splice files
+// through the PatternService that drumpb/drum.proto defines:
+//
+//	store, err := drum.NewFileStore("patterns")
+//	s := grpc.NewServer()
+//	drumpb.RegisterPatternServiceServer(s, grpcbridge.NewServer(nil, grpcbridge.WithStore(store)))
+//	s.Serve(lis)
+package grpcbridge
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative drumpb/drum.proto
+
+import (
+	"bytes"
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/errcode"
+	"github.com/jpreese/go-mentor/grpcbridge/drumpb"
+)
+
+// Server is a drumpb.PatternServiceServer decoding with a drum.Decoder
+// and keeping patterns in a drum.Store.
+type Server struct {
+	drumpb.UnimplementedPatternServiceServer
+
+	decoder *drum.Decoder
+	store   drum.Store
+}
+
+// An Option configures a Server.
+type Option func(*Server)
+
+// WithStore keeps the patterns of the Get, Put, List and Delete calls in
+// store. Without it they fail with Unimplemented.
+func WithStore(store drum.Store) Option {
+	return func(s *Server) {
+		s.store = store
+	}
+}
+
+// NewServer returns a Server decoding with decoder, or with a new
+// drum.Decoder if decoder is nil. It honors WithStore.
+func NewServer(decoder *drum.Decoder, opts ...Option) *Server {
+	if decoder == nil {
+		decoder = new(drum.Decoder)
+	}
+
+	s := &Server{decoder: decoder}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
+}
+
+// DecodeStream decodes the chunks the client sends, sending it each
+// track as soon as it has been read and then the pattern's header.
+func (s *Server) DecodeStream(stream drumpb.PatternService_DecodeStreamServer) error {
+	p, err := s.decoder.DecodeStream(&chunkReader{stream: stream}, func(track drum.Track) error {
+		return stream.Send(&drumpb.DecodeResponse{
+			Result: &drumpb.DecodeResponse_Track{Track: toTrack(track)},
+		})
+	})
+	if err != nil {
+		return toStatus(err)
+	}
+
+	return stream.Send(&drumpb.DecodeResponse{
+		Result: &drumpb.DecodeResponse_Header{Header: &drumpb.Pattern{Version: p.Version, Tempo: p.Tempo}},
+	})
+}
+
+// Encode encodes the pattern in the request.
+func (s *Server) Encode(_ context.Context, req *drumpb.EncodeRequest) (*drumpb.EncodeResponse, error) {
+	p, err := FromPattern(req.GetPattern())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	var buf bytes.Buffer
+	if _, err := p.WriteTo(&buf); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	return &drumpb.EncodeResponse{Data: buf.Bytes()}, nil
+}
+
+// Get returns the pattern stored under the requested ID.
+func (s *Server) Get(_ context.Context, req *drumpb.GetRequest) (*drumpb.Pattern, error) {
+	if s.store == nil {
+		return nil, errNoStore
+	}
+
+	p, err := s.store.Get(req.GetId())
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return ToPattern(p), nil
+}
+
+// Put stores the pattern in the request under its ID.
+func (s *Server) Put(_ context.Context, req *drumpb.PutRequest) (*drumpb.PutResponse, error) {
+	if s.store == nil {
+		return nil, errNoStore
+	}
+
+	p, err := FromPattern(req.GetPattern())
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	if err := s.store.Put(req.GetId(), p); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &drumpb.PutResponse{}, nil
+}
+
+// List lists the IDs of the stored patterns.
+func (s *Server) List(context.Context, *drumpb.ListRequest) (*drumpb.ListResponse, error) {
+	if s.store == nil {
+		return nil, errNoStore
+	}
+
+	ids, err := s.store.List()
+	if err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &drumpb.ListResponse{Ids: ids}, nil
+}
+
+// Delete removes the pattern stored under the requested ID.
+func (s *Server) Delete(_ context.Context, req *drumpb.DeleteRequest) (*drumpb.DeleteResponse, error) {
+	if s.store == nil {
+		return nil, errNoStore
+	}
+
+	if err := s.store.Delete(req.GetId()); err != nil {
+		return nil, toStatus(err)
+	}
+
+	return &drumpb.DeleteResponse{}, nil
+}
+
+// errNoStore is the status of the store calls to a Server without one.
+var errNoStore = status.Error(codes.Unimplemented, "the server keeps no patterns")
+
+// chunkReader reads the data of the chunks a client streams.
+type chunkReader struct {
+	stream drumpb.PatternService_DecodeStreamServer
+	buf    []byte
+}
+
+func (r *chunkReader) Read(b []byte) (int, error) {
+	for len(r.buf) == 0 {
+		chunk, err := r.stream.Recv()
+		if err != nil {
+			return 0, err
+		}
+		r.buf = chunk.GetData()
+	}
+
+	n := copy(b, r.buf)
+	r.buf = r.buf[n:]
+
+	return n, nil
+}
+
+// ToPattern returns the protobuf form of p.
+func ToPattern(p *drum.Pattern) *drumpb.Pattern {
+	pb := &drumpb.Pattern{Version: p.Version, Tempo: p.Tempo}
+	for track := range p.Tracks() {
+		pb.Tracks = append(pb.Tracks, toTrack(track))
+	}
+
+	return pb
+}
+
+// FromPattern returns the pattern pb describes. It fails if a track
+// does not have exactly sixteen steps.
+func FromPattern(pb *drumpb.Pattern) (*drum.Pattern, error) {
+	tracks := make([]drum.Track, 0, len(pb.GetTracks()))
+	for _, t := range pb.GetTracks() {
+		steps := make([]byte, len(t.GetSteps()))
+		for i, on := range t.GetSteps() {
+			steps[i] = '-'
+			if on {
+				steps[i] = 'x'
+			}
+		}
+		tracks = append(tracks, drum.Track{ID: int(t.GetId()), Name: t.GetName(), Steps: steps})
+	}
+
+	return drum.NewPattern(pb.GetVersion(), pb.GetTempo(), tracks...)
+}
+
+func toTrack(track drum.Track) *drumpb.Track {
+	steps := make([]bool, len(track.Steps))
+	for i, step := range track.Steps {
+		steps[i] = step == 'x'
+	}
+
+	return &drumpb.Track{Id: int32(track.ID), Name: track.Name, Steps: steps}
+}
+
+// toStatus returns the gRPC status for a decoding or store error: the
+// client's own error when it went away, and otherwise InvalidArgument
+// for a file that is not a pattern or an ID no pattern can be stored
+// under, NotFound for a pattern that is not stored and Internal for
+// anything else.
+func toStatus(err error) error {
+	if _, ok := status.FromError(err); ok {
+		return err
+	}
+
+	switch errcode.Of(err) {
+	case errcode.DrumBadMagic, errcode.DrumTruncated, errcode.DrumChecksumMismatch, errcode.DrumChecksumMissing,
+		errcode.DrumInvalidPatternID:
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errcode.DrumPatternNotFound:
+		return status.Error(codes.NotFound, err.Error())
+	}
+
+	return status.Error(codes.Internal, err.Error())
+}
@@ -0,0 +1,183 @@
+package grpcbridge
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/grpcbridge/drumpb"
+)
+
+// dial serves a Server in memory and returns a client of it.
+func dial(t *testing.T, opts ...Option) drumpb.PatternServiceClient {
+	t.Helper()
+
+	lis := bufconn.Listen(1 << 16)
+	s := grpc.NewServer()
+	drumpb.RegisterPatternServiceServer(s, NewServer(nil, opts...))
+	go s.Serve(lis)
+	t.Cleanup(s.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufconn",
+		grpc.WithContextDialer(func(context.Context, string) (net.Conn, error) { return lis.Dial() }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return drumpb.NewPatternServiceClient(conn)
+}
+
+// decode streams data to the DecodeStream RPC in chunks of size bytes
+// and returns the pattern it sends back.
+func decode(client drumpb.PatternServiceClient, data []byte, size int) (*drum.Pattern, error) {
+	stream, err := client.DecodeStream(context.Background())
+	if err != nil {
+		return nil, err
+	}
+
+	for len(data) > 0 {
+		n := min(size, len(data))
+		if err := stream.Send(&drumpb.Chunk{Data: data[:n]}); err != nil {
+			return nil, err
+		}
+		data = data[n:]
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+
+	var pb drumpb.Pattern
+	for {
+		resp, err := stream.Recv()
+		if err == io.EOF {
+			return FromPattern(&pb)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch result := resp.GetResult().(type) {
+		case *drumpb.DecodeResponse_Track:
+			pb.Tracks = append(pb.Tracks, result.Track)
+		case *drumpb.DecodeResponse_Header:
+			pb.Version, pb.Tempo = result.Header.GetVersion(), result.Header.GetTempo()
+		}
+	}
+}
+
+func TestDecodeStream(t *testing.T) {
+	client := dial(t)
+
+	for _, name := range []string{"pattern_1", "pattern_2", "pattern_5"} {
+		path := "../challenge1/fixtures/" + name + ".splice"
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := drum.DecodeFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := decode(client, data, 7)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Errorf("%s decoded as\n%s\nexpected\n%s", name, got, want)
+		}
+	}
+}
+
+func TestDecodeStreamRejectsOtherFiles(t *testing.T) {
+	_, err := decode(dial(t), []byte("NOT A SPLICE FILE"), 4)
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument, got %v", err)
+	}
+}
+
+func TestEncode(t *testing.T) {
+	client := dial(t)
+
+	want, err := drum.DecodeFile("../challenge1/fixtures/pattern_1.splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := client.Encode(context.Background(), &drumpb.EncodeRequest{Pattern: ToPattern(want)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := drum.DecodeBytes(resp.GetData())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("encoded pattern decoded as\n%s\nexpected\n%s", got, want)
+	}
+
+	bad := &drumpb.Pattern{Tracks: []*drumpb.Track{{Id: 1, Steps: []bool{true}}}}
+	if _, err := client.Encode(context.Background(), &drumpb.EncodeRequest{Pattern: bad}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a short track, got %v", err)
+	}
+}
+
+func TestStore(t *testing.T) {
+	if _, err := dial(t).List(context.Background(), &drumpb.ListRequest{}); status.Code(err) != codes.Unimplemented {
+		t.Errorf("expected Unimplemented without a store, got %v", err)
+	}
+
+	store, err := drum.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := dial(t, WithStore(store))
+	ctx := context.Background()
+
+	want, err := drum.DecodeFile("../challenge1/fixtures/pattern_1.splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Put(ctx, &drumpb.PutRequest{Id: "beat", Pattern: ToPattern(want)}); err != nil {
+		t.Fatal(err)
+	}
+
+	list, err := client.List(ctx, &drumpb.ListRequest{})
+	if err != nil || len(list.GetIds()) != 1 || list.GetIds()[0] != "beat" {
+		t.Fatalf("unexpected list %v, %v", list.GetIds(), err)
+	}
+
+	pb, err := client.Get(ctx, &drumpb.GetRequest{Id: "beat"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := FromPattern(pb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.String() != want.String() {
+		t.Errorf("got pattern\n%s\nexpected\n%s", got, want)
+	}
+
+	if _, err := client.Delete(ctx, &drumpb.DeleteRequest{Id: "beat"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Get(ctx, &drumpb.GetRequest{Id: "beat"}); status.Code(err) != codes.NotFound {
+		t.Errorf("expected NotFound for a deleted pattern, got %v", err)
+	}
+	if _, err := client.Get(ctx, &drumpb.GetRequest{Id: "../beat"}); status.Code(err) != codes.InvalidArgument {
+		t.Errorf("expected InvalidArgument for a malformed id, got %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+module github.com/jpreese/go-mentor/otelbridge
+
+go 1.23
+
+require (
+	github.com/jpreese/go-mentor/challenge1 v0.1.0
+	github.com/jpreese/go-mentor/challenge2 v0.1.0
+	github.com/jpreese/go-mentor/errcode v0.1.0
+	github.com/jpreese/go-mentor/trace v0.1.0
+	go.opentelemetry.io/otel v1.24.0
+	go.opentelemetry.io/otel/sdk v1.24.0
+	go.opentelemetry.io/otel/trace v1.24.0
+)
+
+require (
+	github.com/go-logr/logr v1.4.1 // indirect
+	github.com/go-logr/stdr v1.2.2 // indirect
+	go.opentelemetry.io/otel/metric v1.24.0 // indirect
+	golang.org/x/crypto v0.0.0-20191029031824-8986dd9e96cf // indirect
+	golang.org/x/sys v0.17.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+)
@@ -0,0 +1,102 @@
+// Package otelbridge records the spans of the challenges with
+// OpenTelemetry, so that a service using the drum decoder or the secure
+// transport gets them in its own traces:
+//
+//	tracer := otelbridge.NewTracer(nil)
+//	decoder := &drum.Decoder{Tracer: tracer}
+//	conn, err := securecomm.DialContext(ctx, addr, securecomm.WithTracer(tracer))
+package otelbridge
+
+import (
+	"context"
+	"fmt"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+
+	"github.com/jpreese/go-mentor/errcode"
+	"github.com/jpreese/go-mentor/trace"
+)
+
+// instrumentationName names the tracer spans are started with.
+const instrumentationName = "github.com/jpreese/go-mentor"
+
+// Tracer is a trace.Tracer that starts OpenTelemetry spans. Spans nest
+// under the OpenTelemetry span in the context they are started with, so
+// they join the traces of the code calling into the challenges.
+type Tracer struct {
+	tracer oteltrace.Tracer
+}
+
+// NewTracer returns a Tracer starting spans from tp, or from the global
+// TracerProvider if tp is nil.
+func NewTracer(tp oteltrace.TracerProvider) *Tracer {
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+
+	return &Tracer{tracer: tp.Tracer(instrumentationName)}
+}
+
+// Start starts an OpenTelemetry span.
+func (t *Tracer) Start(ctx context.Context, name string, attrs ...trace.Attribute) (context.Context, trace.Span) {
+	ctx, span := t.tracer.Start(ctx, name, oteltrace.WithAttributes(convert(attrs)...))
+	return ctx, otelSpan{span}
+}
+
+// otelSpan is a trace.Span backed by an OpenTelemetry span.
+type otelSpan struct {
+	span oteltrace.Span
+}
+
+func (s otelSpan) SetAttributes(attrs ...trace.Attribute) {
+	s.span.SetAttributes(convert(attrs)...)
+}
+
+// End records err on the span, along with its error code if it has one,
+// before ending it.
+func (s otelSpan) End(err error) {
+	if err != nil {
+		s.span.RecordError(err)
+		s.span.SetStatus(codes.Error, err.Error())
+		if code := errcode.Of(err); code != "" {
+			s.span.SetAttributes(attribute.String("error.code", string(code)))
+		}
+	}
+	s.span.End()
+}
+
+// convert converts attributes to their OpenTelemetry form. Values of
+// other types than those trace.Attribute holds are recorded as strings.
+func convert(attrs []trace.Attribute) []attribute.KeyValue {
+	kvs := make([]attribute.KeyValue, 0, len(attrs))
+	for _, a := range attrs {
+		switch v := a.Value.(type) {
+		case string:
+			kvs = append(kvs, attribute.String(a.Key, v))
+		case int64:
+			kvs = append(kvs, attribute.Int64(a.Key, v))
+		case bool:
+			kvs = append(kvs, attribute.Bool(a.Key, v))
+		default:
+			kvs = append(kvs, attribute.String(a.Key, fmt.Sprint(v)))
+		}
+	}
+
+	return kvs
+}
+
+// NewTracerProvider returns a TracerProvider that batches the spans of
+// the service called serviceName to exporter, such as an OTLP or stdout
+// exporter. Callers should shut it down before exiting, to flush the
+// last batch.
+func NewTracerProvider(exporter sdktrace.SpanExporter, serviceName string) *sdktrace.TracerProvider {
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attribute.String("service.name", serviceName))),
+	)
+}
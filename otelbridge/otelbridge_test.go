@@ -0,0 +1,112 @@
+package otelbridge
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+	"github.com/jpreese/go-mentor/errcode"
+	"github.com/jpreese/go-mentor/trace"
+)
+
+// The challenges take a Tracer through their own copies of the trace
+// package.
+var _ = securecomm.WithTracer(&Tracer{})
+
+func TestTracer(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	ctx, parent := tracer.Start(context.Background(), "parent", trace.String("a", "b"))
+	_, child := tracer.Start(ctx, "child", trace.Int("n", 1))
+	child.SetAttributes(trace.Bool("ok", false))
+	child.End(fmt.Errorf("decode: %w", errcode.New(errcode.DrumTruncated, "truncated")))
+	parent.End(nil)
+
+	spans := rec.Ended()
+	if len(spans) != 2 {
+		t.Fatalf("expected 2 spans, got %d", len(spans))
+	}
+	c, p := spans[0], spans[1]
+	if c.Parent().SpanID() != p.SpanContext().SpanID() {
+		t.Errorf("expected child to nest under parent")
+	}
+	if p.Status().Code != codes.Unset {
+		t.Errorf("expected parent to succeed, got %v", p.Status())
+	}
+	if c.Status().Code != codes.Error {
+		t.Errorf("expected child to fail, got %v", c.Status())
+	}
+
+	want := map[attribute.Key]attribute.Value{
+		"n":          attribute.Int64Value(1),
+		"ok":         attribute.BoolValue(false),
+		"error.code": attribute.StringValue(string(errcode.DrumTruncated)),
+	}
+	for _, kv := range c.Attributes() {
+		if v, ok := want[kv.Key]; ok {
+			if v != kv.Value {
+				t.Errorf("expected %s=%v, got %v", kv.Key, v.Emit(), kv.Value.Emit())
+			}
+			delete(want, kv.Key)
+		}
+	}
+	if len(want) != 0 {
+		t.Errorf("missing attributes %v", want)
+	}
+}
+
+func TestTracerUncodedError(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	tracer := NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))
+
+	_, span := tracer.Start(context.Background(), "span")
+	span.End(errors.New("boom"))
+
+	s := rec.Ended()[0]
+	for _, kv := range s.Attributes() {
+		if kv.Key == "error.code" {
+			t.Errorf("expected no error code, got %v", kv.Value.Emit())
+		}
+	}
+	if len(s.Events()) != 1 {
+		t.Errorf("expected the error to be recorded, got %d events", len(s.Events()))
+	}
+}
+
+func TestTracerDecoder(t *testing.T) {
+	rec := tracetest.NewSpanRecorder()
+	decoder := &drum.Decoder{Tracer: NewTracer(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(rec)))}
+
+	data, err := os.ReadFile("../challenge1/fixtures/pattern_1.splice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := decoder.Decode(bytes.NewReader(data[:len(data)/2])); err == nil {
+		t.Fatal("expected a truncated pattern to fail")
+	}
+
+	spans := rec.Ended()
+	if len(spans) == 0 || spans[len(spans)-1].Name() != "drum.Decode" {
+		t.Fatalf("expected a drum.Decode span, got %d spans", len(spans))
+	}
+	var code attribute.Value
+	for _, kv := range spans[len(spans)-1].Attributes() {
+		if kv.Key == "error.code" {
+			code = kv.Value
+		}
+	}
+	if code.AsString() != string(errcode.DrumTruncated) {
+		t.Errorf("expected error.code %s, got %q", errcode.DrumTruncated, code.Emit())
+	}
+}
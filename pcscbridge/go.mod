@@ -0,0 +1,13 @@
+module github.com/jpreese/go-mentor/pcscbridge
+
+go 1.22
+
+require (
+	github.com/gballet/go-libpcsclite v0.0.0-20191108122812-4678299bea08
+	github.com/jpreese/go-mentor/challenge2 v0.1.0
+)
+
+require (
+	golang.org/x/crypto v0.0.0-20191029031824-8986dd9e96cf // indirect
+	golang.org/x/sys v0.0.0-20190412213103-97732733099d // indirect
+)
@@ -0,0 +1,111 @@
+// Package pcscbridge reaches smart cards through the PC/SC daemon,
+// pcscd, so that a PIV token such as a YubiKey can hold the identity
+// key of secure connections:
+//
+//	card, err := pcscbridge.Open("")
+//	key, err := securecomm.OpenPIVKey(card, securecomm.PIVSlotKeyManagement, pin)
+//	conn, err := securecomm.Dial(addr, securecomm.WithIdentityKey(key))
+//
+// It speaks pcscd's protocol over its Unix socket with go-libpcsclite,
+// so it needs no C library, but does need pcscd running.
+package pcscbridge
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	pcsc "github.com/gballet/go-libpcsclite"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// ErrNoReader is returned by Open when pcscd knows of no reader, or of
+// none by the name asked for.
+var ErrNoReader = errors.New("pcscbridge: no such reader")
+
+// A Card is a securecomm.SmartCard in a reader pcscd manages. It is
+// safe for concurrent use.
+type Card struct {
+	client *pcsc.Client
+	card   *pcsc.Card
+	reader string
+}
+
+var _ securecomm.SmartCard = (*Card)(nil)
+
+// Open connects to the card in the named reader, or in the first reader
+// pcscd lists when reader is empty.
+func Open(reader string) (*Card, error) {
+	return OpenDaemon("", reader)
+}
+
+// OpenDaemon is like Open, but reaches pcscd on the socket at path
+// rather than where it usually listens.
+func OpenDaemon(path, reader string) (*Card, error) {
+	client, err := pcsc.EstablishContext(path, pcsc.ScopeSystem)
+	if err != nil {
+		return nil, fmt.Errorf("pcscbridge: connect to pcscd: %w", err)
+	}
+
+	readers, err := client.ListReaders()
+	if err != nil {
+		client.ReleaseContext()
+		return nil, fmt.Errorf("pcscbridge: list readers: %w", err)
+	}
+
+	name, err := pickReader(readers, reader)
+	if err != nil {
+		client.ReleaseContext()
+		return nil, err
+	}
+
+	card, err := client.Connect(name, pcsc.ShareShared, pcsc.ProtocolAny)
+	if err != nil {
+		client.ReleaseContext()
+		return nil, fmt.Errorf("pcscbridge: connect to %s: %w", name, err)
+	}
+
+	return &Card{client: client, card: card, reader: name}, nil
+}
+
+// pickReader returns the reader named want among readers, or the first
+// one when want is empty. pcscd pads the names it lists with NULs.
+func pickReader(readers []string, want string) (string, error) {
+	for _, name := range readers {
+		name = strings.TrimRight(name, "\x00")
+		if want == "" || name == want {
+			return name, nil
+		}
+	}
+
+	if want == "" {
+		return "", ErrNoReader
+	}
+	return "", fmt.Errorf("%w: %s", ErrNoReader, want)
+}
+
+// Reader returns the name of the reader the card is in.
+func (c *Card) Reader() string {
+	return c.reader
+}
+
+// Transmit sends a command APDU to the card and returns its response.
+func (c *Card) Transmit(command []byte) ([]byte, error) {
+	response, _, err := c.card.Transmit(command)
+	if err != nil {
+		return nil, fmt.Errorf("pcscbridge: transmit: %w", err)
+	}
+
+	return response, nil
+}
+
+// Close disconnects from the card, leaving it as it is, and from pcscd.
+func (c *Card) Close() error {
+	err := c.card.Disconnect(pcsc.LeaveCard)
+	if releaseErr := c.client.ReleaseContext(); err == nil {
+		err = releaseErr
+	}
+
+	return err
+}
@@ -0,0 +1,181 @@
+package pcscbridge
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+
+	pcsc "github.com/gballet/go-libpcsclite"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+const readerName = "Yubico YubiKey OTP+FIDO+CCID 00 00"
+
+// fakeDaemon answers pcscd's protocol on a Unix socket for one reader,
+// passing the APDUs sent to its card to transmit.
+func fakeDaemon(t *testing.T, transmit func(command []byte) []byte) string {
+	t.Helper()
+
+	path := filepath.Join(t.TempDir(), "pcscd.comm")
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go serveDaemon(conn, transmit)
+		}
+	}()
+
+	return path
+}
+
+func serveDaemon(conn net.Conn, transmit func(command []byte) []byte) {
+	defer conn.Close()
+
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(conn, header[:]); err != nil {
+			return
+		}
+		request := make([]byte, binary.LittleEndian.Uint32(header[:]))
+		if _, err := io.ReadFull(conn, request); err != nil {
+			return
+		}
+
+		var response []byte
+		switch binary.LittleEndian.Uint32(header[4:]) {
+		case pcsc.CommandVersion:
+			response = request
+		case pcsc.SCardEstablishContext:
+			response = request
+			binary.LittleEndian.PutUint32(response[4:], 1)
+		case pcsc.CommandGetReaderState:
+			response = make([]byte, pcsc.ReaderStateDescriptorLength*pcsc.MaxReaderStateDescriptors)
+			copy(response, readerName)
+		case pcsc.SCardConnect:
+			response = request
+			binary.LittleEndian.PutUint32(response[140:], 7)
+		case pcsc.SCardTransmit:
+			command := make([]byte, binary.LittleEndian.Uint32(request[12:]))
+			if _, err := io.ReadFull(conn, command); err != nil {
+				return
+			}
+			answer := transmit(command)
+			binary.LittleEndian.PutUint32(request[24:], uint32(len(answer)))
+			response = append(request, answer...)
+		case pcsc.SCardDisConnect, pcsc.SCardReleaseContext:
+			response = request
+		default:
+			return
+		}
+
+		if _, err := conn.Write(response); err != nil {
+			return
+		}
+	}
+}
+
+func TestTransmit(t *testing.T) {
+	var got []byte
+	path := fakeDaemon(t, func(command []byte) []byte {
+		got = command
+		return []byte{0x01, 0x02, 0x90, 0x00}
+	})
+
+	card, err := OpenDaemon(path, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if card.Reader() != readerName {
+		t.Errorf("reader is %q, expected %q", card.Reader(), readerName)
+	}
+
+	response, err := card.Transmit([]byte{0x00, 0xa4, 0x04, 0x00})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte{0x00, 0xa4, 0x04, 0x00}) {
+		t.Errorf("card got %x", got)
+	}
+	if !bytes.Equal(response, []byte{0x01, 0x02, 0x90, 0x00}) {
+		t.Errorf("unexpected response %x", response)
+	}
+
+	if err := card.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestOpenUnknownReader(t *testing.T) {
+	path := fakeDaemon(t, nil)
+
+	if _, err := OpenDaemon(path, "Some Other Reader"); !errors.Is(err, ErrNoReader) {
+		t.Errorf("expected ErrNoReader, got %v", err)
+	}
+}
+
+// TestPIVKey has securecomm talk PIV to a token behind pcscd.
+func TestPIVKey(t *testing.T) {
+	key, err := securecomm.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := fakeDaemon(t, func(command []byte) []byte {
+		switch command[1] {
+		case 0xa4: // SELECT
+			return []byte{0x90, 0x00}
+		case 0xf7: // GET METADATA
+			metadata := append([]byte{0x01, 0x01, 0xe1, 0x04, 0x22, 0x86, 0x20}, key.Public[:]...)
+			return append(metadata, 0x90, 0x00)
+		case 0x87: // GENERAL AUTHENTICATE
+			var peer [32]byte
+			copy(peer[:], command[len(command)-32:])
+			shared, _ := key.ECDH(&peer)
+			return append(append([]byte{0x7c, 0x22, 0x82, 0x20}, shared[:]...), 0x90, 0x00)
+		}
+		return []byte{0x6a, 0x80}
+	})
+
+	card, err := OpenDaemon(path, readerName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer card.Close()
+
+	token, err := securecomm.OpenPIVKey(card, securecomm.PIVSlotKeyManagement, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if *token.PublicKey() != key.Public {
+		t.Fatal("token reported the wrong public key")
+	}
+
+	peer, err := securecomm.GenerateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := token.ECDH(&peer.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := peer.ECDH(&key.Public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Error("token computed the wrong shared secret")
+	}
+}
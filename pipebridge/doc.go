@@ -0,0 +1,14 @@
+// Package pipebridge runs secure connections over Windows named pipes,
+// for local IPC that still wants authenticated encryption:
+//
+//	l, err := pipebridge.Listen(`\\.\pipe\gomentor`, nil)
+//	go securecomm.Serve(l, handler)
+//
+//	d := securecomm.Dialer{Transport: pipebridge.Transport{}}
+//	conn, err := d.Dial(`\\.\pipe\gomentor`)
+//
+// The standard library cannot open named pipes, so the package builds on
+// go-winio, and is empty on other systems. Unix domain sockets need no
+// bridge: set Dialer.Network to "unix" and serve on a net.Listen("unix")
+// listener.
+package pipebridge
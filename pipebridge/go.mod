@@ -0,0 +1,13 @@
+module github.com/jpreese/go-mentor/pipebridge
+
+go 1.22
+
+require (
+	github.com/Microsoft/go-winio v0.6.2
+	github.com/jpreese/go-mentor/challenge2 v0.1.0
+)
+
+require (
+	golang.org/x/crypto v0.0.0-20191029031824-8986dd9e96cf // indirect
+	golang.org/x/sys v0.10.0 // indirect
+)
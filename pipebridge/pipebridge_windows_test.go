@@ -0,0 +1,51 @@
+package pipebridge
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+func pipePath() string {
+	return fmt.Sprintf(`\\.\pipe\pipebridge-test-%d-%d`, os.Getpid(), time.Now().UnixNano())
+}
+
+func TestEcho(t *testing.T) {
+	path := pipePath()
+	l, err := Listen(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go securecomm.Serve(l, nil)
+
+	d := securecomm.Dialer{Transport: Transport{}, HandshakeTimeout: 5 * time.Second}
+	for i := 0; i < 2; i++ {
+		conn, err := d.Dial(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message := bytes.Repeat([]byte("over a pipe "), 1000)
+		if err := conn.WriteMsg(message); err != nil {
+			t.Fatal(err)
+		}
+		if echo, err := conn.ReadMsg(); err != nil || !bytes.Equal(echo, message) {
+			t.Fatalf("unexpected echo of %d bytes, %v", len(echo), err)
+		}
+
+		conn.Close()
+	}
+}
+
+func TestDialMissingPipe(t *testing.T) {
+	d := securecomm.Dialer{Transport: Transport{}, HandshakeTimeout: time.Second}
+	if _, err := d.Dial(pipePath()); err == nil {
+		t.Error("expected dialing a pipe nobody listens on to fail")
+	}
+}
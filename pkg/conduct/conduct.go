@@ -0,0 +1,401 @@
+// Package conduct plays a drum pattern on several machines together. A
+// Conductor keeps the beat, its tempo and when its first beat fell, and
+// sends them to each Follower connected to it over a secure channel,
+// which vouches that they come from the conductor. Followers estimate
+// how far their clocks are from the conductor's from the round trips of
+// timestamped pings, as NTP does, so that each plays the steps of the
+// pattern when the conductor's clock says they fall, however long the
+// network took to tell it.
+package conduct
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// DefaultPingInterval is how often a Follower pings its conductor to
+// keep its estimate of the conductor's clock up to date.
+const DefaultPingInterval = time.Second
+
+// stepsPerBeat is the number of pattern steps in a beat: patterns hold
+// a bar of sixteenth notes.
+const stepsPerBeat = 4
+
+// pingSamples is how many round trips a Follower keeps, using the
+// quickest, which queueing delayed least, to estimate the clock offset.
+const pingSamples = 8
+
+// ErrInvalidTempo is returned for a tempo that is not positive.
+var ErrInvalidTempo = errors.New("tempo must be positive")
+
+// A message is what conductors and followers send each other: a ping,
+// or the beat.
+type message struct {
+	Ping *ping `json:"ping,omitempty"`
+	Beat *beat `json:"beat,omitempty"`
+}
+
+// A ping is sent by a follower with the time by its clock, and answered
+// by the conductor with the time it received it by its own. Times are
+// in nanoseconds since the Unix epoch.
+type ping struct {
+	Sent     int64 `json:"sent"`
+	Received int64 `json:"received,omitempty"`
+}
+
+// A beat is the tempo, in beats per minute, and when beat zero fell by
+// the conductor's clock, in nanoseconds since the Unix epoch.
+type beat struct {
+	Tempo float32 `json:"tempo"`
+	Start int64   `json:"start"`
+}
+
+// at returns how many beats had passed by t.
+func (b beat) at(t time.Time) float64 {
+	return float64(t.UnixNano()-b.Start) * float64(b.Tempo) / float64(time.Minute)
+}
+
+// time returns when the given number of beats will have passed.
+func (b beat) time(beats float64) time.Time {
+	return time.Unix(0, b.Start+int64(beats*float64(time.Minute)/float64(b.Tempo)))
+}
+
+// A Conductor keeps the beat for its followers. Its Serve method is the
+// securecomm.Handler followers connect to.
+type Conductor struct {
+	mu        sync.Mutex
+	beat      beat
+	followers map[*securecomm.SecureConn]struct{}
+}
+
+// NewConductor returns a Conductor whose first beat is now, at tempo
+// beats per minute.
+func NewConductor(tempo float32) (*Conductor, error) {
+	if !(tempo > 0) {
+		return nil, ErrInvalidTempo
+	}
+
+	return &Conductor{
+		beat:      beat{Tempo: tempo, Start: time.Now().UnixNano()},
+		followers: make(map[*securecomm.SecureConn]struct{}),
+	}, nil
+}
+
+// SetTempo changes the tempo from now on, without skipping or repeating
+// any part of the beat, and tells the followers.
+func (c *Conductor) SetTempo(tempo float32) error {
+	if !(tempo > 0) {
+		return ErrInvalidTempo
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	beats := c.beat.at(now)
+	c.beat = beat{Tempo: tempo}
+	c.beat.Start = now.UnixNano() - int64(beats*float64(time.Minute)/float64(tempo))
+
+	// Sent with mu held so that followers see tempo changes in order.
+	// A follower that cannot be told finds out from its own connection.
+	b, err := json.Marshal(message{Beat: &c.beat})
+	if err != nil {
+		return err
+	}
+	for conn := range c.followers {
+		conn.WriteMsg(b)
+	}
+
+	return nil
+}
+
+// Serve sends the beat to the follower on conn, and its changes, and
+// answers its pings, until it disconnects.
+func (c *Conductor) Serve(ctx context.Context, conn *securecomm.SecureConn) error {
+	c.mu.Lock()
+	b, err := json.Marshal(message{Beat: &c.beat})
+	if err == nil {
+		err = conn.WriteMsg(b)
+	}
+	c.followers[conn] = struct{}{}
+	c.mu.Unlock()
+	defer func() {
+		c.mu.Lock()
+		delete(c.followers, conn)
+		c.mu.Unlock()
+	}()
+	if err != nil {
+		return err
+	}
+
+	for {
+		b, err := conn.ReadMsg()
+		if err != nil {
+			return err
+		}
+		received := time.Now().UnixNano()
+
+		var m message
+		if err := json.Unmarshal(b, &m); err != nil {
+			return fmt.Errorf("decode follower message: %w", err)
+		}
+		if m.Ping == nil {
+			continue
+		}
+		m.Ping.Received = received
+		if b, err = json.Marshal(message{Ping: m.Ping}); err != nil {
+			return err
+		}
+		if err := conn.WriteMsg(b); err != nil {
+			return err
+		}
+	}
+}
+
+// A Follower follows the beat of a Conductor on the other end of a
+// connection. Its methods are safe to call from several goroutines.
+type Follower struct {
+	conn *securecomm.SecureConn
+	now  func() time.Time
+
+	mu      sync.Mutex
+	beat    beat
+	samples []sample
+	offset  time.Duration
+
+	// ready is closed once both the beat and the conductor's clock are
+	// known, and done once the connection fails, for the reason in err.
+	ready     chan struct{}
+	readyOnce sync.Once
+	done      chan struct{}
+	err       error
+}
+
+// A sample is the clock offset one ping measured, and the round trip it
+// took.
+type sample struct {
+	offset, rtt time.Duration
+}
+
+// Follow starts following the beat of the Conductor on the other end of
+// conn, pinging it every DefaultPingInterval.
+func Follow(conn *securecomm.SecureConn) *Follower {
+	return follow(conn, time.Now, DefaultPingInterval)
+}
+
+// follow starts following with a clock that tests can skew.
+func follow(conn *securecomm.SecureConn, now func() time.Time, interval time.Duration) *Follower {
+	f := &Follower{
+		conn:  conn,
+		now:   now,
+		ready: make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go f.receive()
+	go f.ping(interval)
+
+	return f
+}
+
+// Ready returns a channel that is closed once the follower knows the
+// beat and the conductor's clock well enough to play.
+func (f *Follower) Ready() <-chan struct{} {
+	return f.ready
+}
+
+// Done returns a channel that is closed once the connection to the
+// conductor fails or is closed.
+func (f *Follower) Done() <-chan struct{} {
+	return f.done
+}
+
+// Err returns why the connection ended, once Done is closed.
+func (f *Follower) Err() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.err
+}
+
+// Close stops following, closing the connection.
+func (f *Follower) Close() error {
+	return f.conn.Close()
+}
+
+// Offset returns how far ahead of ours the conductor's clock is, as best
+// the follower can tell.
+func (f *Follower) Offset() time.Duration {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.offset
+}
+
+// Now returns the time by the conductor's clock.
+func (f *Follower) Now() time.Time {
+	return f.now().Add(f.Offset())
+}
+
+// Tempo returns the conductor's tempo in beats per minute, zero until
+// it is known.
+func (f *Follower) Tempo() float32 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.beat.Tempo
+}
+
+// Play calls onStep with the number of each step of p and the tracks
+// that play on it as the step falls due by the conductor's clock, until
+// ctx is done or the connection fails. It starts with the step after
+// the current one once the follower is Ready, and follows changes of
+// tempo from the step after they arrive.
+func (f *Follower) Play(ctx context.Context, p *drum.Pattern, onStep func(step int, tracks []drum.Track)) error {
+	select {
+	case <-f.ready:
+	case <-f.done:
+		return f.Err()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	var steps int
+	for track := range p.Tracks() {
+		steps = max(steps, len(track.Steps))
+	}
+	if steps == 0 {
+		return errors.New("pattern has no steps to play")
+	}
+
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	<-timer.C
+	last := math.Inf(-1)
+	for {
+		f.mu.Lock()
+		b := f.beat
+		f.mu.Unlock()
+
+		// A better estimate of the conductor's clock may move it back
+		// into a step already played, which is not played again.
+		now := f.Now()
+		next := max(math.Floor(b.at(now)*stepsPerBeat)+1, last+1)
+		last = next
+		timer.Reset(b.time(next / stepsPerBeat).Sub(now))
+		select {
+		case <-timer.C:
+		case <-f.done:
+			return f.Err()
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		step := int(int64(next) % int64(steps))
+		if step < 0 {
+			step += steps
+		}
+		var playing []drum.Track
+		for track := range p.Tracks() {
+			if step < len(track.Steps) && track.Steps[step] == 'x' {
+				playing = append(playing, track)
+			}
+		}
+		onStep(step, playing)
+	}
+}
+
+// ping pings the conductor, quickly at first to get an estimate of its
+// clock soon, then every interval, until the connection fails.
+func (f *Follower) ping(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for i := 0; ; i++ {
+		b, err := json.Marshal(message{Ping: &ping{Sent: f.now().UnixNano()}})
+		if err != nil {
+			return
+		}
+		// A failed ping means the connection failed, which receive
+		// reports.
+		if f.conn.WriteMsg(b) != nil {
+			return
+		}
+
+		if i < pingSamples {
+			continue
+		}
+		select {
+		case <-f.done:
+			return
+		case <-t.C:
+		}
+	}
+}
+
+// receive notes the beat and the answers to pings from the conductor
+// until the connection fails.
+func (f *Follower) receive() {
+	err := func() error {
+		for {
+			b, err := f.conn.ReadMsg()
+			if err != nil {
+				return err
+			}
+			received := f.now()
+
+			var m message
+			if err := json.Unmarshal(b, &m); err != nil {
+				return fmt.Errorf("decode conductor message: %w", err)
+			}
+			f.mu.Lock()
+			if m.Beat != nil && m.Beat.Tempo > 0 {
+				f.beat = *m.Beat
+			}
+			if m.Ping != nil {
+				f.measure(*m.Ping, received)
+			}
+			ready := f.beat.Tempo > 0 && len(f.samples) > 0
+			f.mu.Unlock()
+
+			if ready {
+				f.readyOnce.Do(func() { close(f.ready) })
+			}
+		}
+	}()
+
+	f.mu.Lock()
+	f.err = err
+	f.mu.Unlock()
+	close(f.done)
+}
+
+// measure estimates the offset of the conductor's clock from an answer
+// to a ping received at received, assuming it took as long to reach the
+// conductor as to come back. The caller must hold mu.
+func (f *Follower) measure(p ping, received time.Time) {
+	rtt := time.Duration(received.UnixNano() - p.Sent)
+	if rtt < 0 {
+		return
+	}
+	offset := time.Duration(p.Received-p.Sent) - rtt/2
+
+	f.samples = append(f.samples, sample{offset: offset, rtt: rtt})
+	if len(f.samples) > pingSamples {
+		f.samples = f.samples[1:]
+	}
+	best := f.samples[0]
+	for _, s := range f.samples[1:] {
+		if s.rtt < best.rtt {
+			best = s
+		}
+	}
+	f.offset = best.offset
+}
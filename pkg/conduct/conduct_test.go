@@ -0,0 +1,123 @@
+package conduct
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securetest"
+)
+
+// follower connects a follower whose clock is skew ahead of the real
+// one to the conductor's server, and waits until it is ready.
+func follower(t *testing.T, ts *securetest.TestServer, skew time.Duration) *Follower {
+	t.Helper()
+
+	conn, err := ts.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := follow(conn, func() time.Time { return time.Now().Add(skew) }, 10*time.Millisecond)
+	t.Cleanup(func() { f.Close() })
+
+	select {
+	case <-f.Ready():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the follower to be ready")
+	}
+
+	return f
+}
+
+func TestFollowerClockOffset(t *testing.T) {
+	c, err := NewConductor(120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := securetest.StartTestServer(t, c.Serve)
+
+	f := follower(t, ts, -time.Hour)
+	if off := f.Now().Sub(time.Now()); off < -50*time.Millisecond || off > 50*time.Millisecond {
+		t.Fatalf("Expected the follower to find the conductor's clock, off by %v", off)
+	}
+	if f.Tempo() != 120 {
+		t.Fatalf("Expected a tempo of 120, got %v", f.Tempo())
+	}
+}
+
+func TestFollowersPlayInStep(t *testing.T) {
+	c, err := NewConductor(240)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := securetest.StartTestServer(t, c.Serve)
+	p, err := drum.DecodeFile(filepath.Join("..", "..", "challenge1", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A step lasts 62.5ms at 240 beats per minute.
+	step := time.Minute / 240 / stepsPerBeat
+	for _, skew := range []time.Duration{time.Hour, -3 * time.Second} {
+		f := follower(t, ts, skew)
+		ctx, cancel := context.WithCancel(context.Background())
+
+		var played int
+		last := -1
+		err := f.Play(ctx, p, func(n int, tracks []drum.Track) {
+			// The step falls due on the conductor's clock, which
+			// started on beat zero.
+			late := time.Since(time.Unix(0, c.beat.Start)) % step
+			if late > step/2 {
+				late -= step
+			}
+			if late < -20*time.Millisecond || late > 20*time.Millisecond {
+				t.Errorf("Step %d played %v off the beat", n, late)
+			}
+			if last >= 0 && n != (last+1)%16 {
+				t.Errorf("Step %d played after step %d", n, last)
+			}
+			for _, track := range tracks {
+				if track.Steps[n] != 'x' {
+					t.Errorf("Track %d played on silent step %d", track.ID, n)
+				}
+			}
+			last = n
+			if played++; played == 4 {
+				cancel()
+			}
+		})
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("Expected Play to stop when canceled, got %v", err)
+		}
+	}
+}
+
+func TestSetTempo(t *testing.T) {
+	c, err := NewConductor(120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ts := securetest.StartTestServer(t, c.Serve)
+	f := follower(t, ts, 0)
+
+	before := c.beat.at(time.Now())
+	if err := c.SetTempo(90); err != nil {
+		t.Fatal(err)
+	}
+	if after := c.beat.at(time.Now()); after < before || after-before > 0.1 {
+		t.Fatalf("Expected the beat to carry on from %v, got %v", before, after)
+	}
+	for deadline := time.Now().Add(5 * time.Second); f.Tempo() != 90; time.Sleep(time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the follower to hear of the new tempo")
+		}
+	}
+
+	if err := c.SetTempo(0); !errors.Is(err, ErrInvalidTempo) {
+		t.Fatalf("Expected ErrInvalidTempo, got %v", err)
+	}
+}
@@ -0,0 +1,455 @@
+// Package jam lets the clients of a securecomm broadcast server edit a
+// drum pattern together. Each client holds a copy of the pattern and
+// broadcasts its edits, turning steps on and off and setting the tempo,
+// which the others apply to their copies.
+//
+// The server only relays messages, so clients may see concurrent edits
+// in different orders. Each step and the tempo therefore keep the
+// Lamport timestamp of the edit that last set them, and an edit only
+// replaces one with an earlier timestamp, ties going to the client with
+// the greater ID, so that every copy ends up the same whatever order the
+// edits arrive in. Clients also broadcast their whole copy when another
+// client joins and every sync interval, which brings newcomers up to
+// date and repairs copies that missed an edit.
+package jam
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// DefaultSyncInterval is how often a Session broadcasts its whole copy
+// of the pattern unless told otherwise with WithSyncInterval.
+const DefaultSyncInterval = 10 * time.Second
+
+// stepsPerTrack is the number of steps in each track of a pattern.
+const stepsPerTrack = 16
+
+// An Option configures a Session.
+type Option func(cfg *config)
+
+type config struct {
+	syncInterval time.Duration
+}
+
+// WithSyncInterval makes a Session broadcast its whole copy of the
+// pattern every interval instead of every DefaultSyncInterval.
+func WithSyncInterval(interval time.Duration) Option {
+	return func(cfg *config) {
+		cfg.syncInterval = interval
+	}
+}
+
+// A stamp orders edits: by the Lamport clock of the client that made
+// them, then by its ID.
+type stamp struct {
+	Clock  uint64 `json:"c"`
+	Origin string `json:"o"`
+}
+
+// after reports whether an edit stamped s wins over one stamped t.
+func (s stamp) after(t stamp) bool {
+	if s.Clock != t.Clock {
+		return s.Clock > t.Clock
+	}
+
+	return s.Origin > t.Origin
+}
+
+// A message is what clients broadcast: an edit of a step or the tempo,
+// or their whole copy of the pattern.
+type message struct {
+	Step  *stepEdit  `json:"step,omitempty"`
+	Tempo *tempoEdit `json:"tempo,omitempty"`
+	State *state     `json:"state,omitempty"`
+}
+
+// A stepEdit turns a step of a track on or off.
+type stepEdit struct {
+	Track int   `json:"track"`
+	Step  int   `json:"step"`
+	On    bool  `json:"on"`
+	Stamp stamp `json:"stamp"`
+}
+
+// A tempoEdit sets the tempo.
+type tempoEdit struct {
+	Tempo float32 `json:"tempo"`
+	Stamp stamp   `json:"stamp"`
+}
+
+// state is a copy of the pattern along with the stamps of the edits
+// that last set each of its steps and its tempo.
+type state struct {
+	Version string       `json:"version"`
+	Tempo   tempoEdit    `json:"tempo"`
+	Tracks  []trackState `json:"tracks"`
+}
+
+// trackState is a track of a state. Steps holds the steps in the x/-
+// notation of drum.Track.
+type trackState struct {
+	ID     int     `json:"id"`
+	Name   string  `json:"name"`
+	Steps  string  `json:"steps"`
+	Stamps []stamp `json:"stamps"`
+}
+
+// A Session is a client's copy of a pattern it edits together with the
+// other clients of a broadcast server. Its methods are safe to call
+// from several goroutines.
+type Session struct {
+	conn *securecomm.SecureConn
+	id   string
+
+	mu      sync.Mutex
+	clock   uint64
+	state   state
+	pattern *drum.Pattern
+
+	// changed is signalled when the pattern changes, and done closed
+	// once the session ends, for the reason in err.
+	changed chan struct{}
+	done    chan struct{}
+	err     error
+}
+
+// Join starts editing a pattern with the other clients of the broadcast
+// server conn is connected to, starting from p, or from nothing until
+// the others send their copies when p is nil. Whatever p holds is
+// merged with the copies of the clients already there, as their edits
+// would be.
+func Join(conn *securecomm.SecureConn, p *drum.Pattern, opts ...Option) (*Session, error) {
+	cfg := config{syncInterval: DefaultSyncInterval}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	var id [8]byte
+	if _, err := rand.Read(id[:]); err != nil {
+		return nil, fmt.Errorf("generate session ID: %w", err)
+	}
+	s := &Session{
+		conn:    conn,
+		id:      hex.EncodeToString(id[:]),
+		changed: make(chan struct{}, 1),
+		done:    make(chan struct{}),
+	}
+
+	if p != nil {
+		s.clock = 1
+		first := stamp{Clock: s.clock, Origin: s.id}
+		s.state.Version = p.Version
+		s.state.Tempo = tempoEdit{Tempo: p.Tempo, Stamp: first}
+		for track := range p.Tracks() {
+			if len(track.Steps) != stepsPerTrack {
+				return nil, fmt.Errorf("track %d has %d steps, expected %d", track.ID, len(track.Steps), stepsPerTrack)
+			}
+			stamps := make([]stamp, stepsPerTrack)
+			for i := range stamps {
+				stamps[i] = first
+			}
+			s.state.Tracks = append(s.state.Tracks, trackState{ID: track.ID, Name: track.Name, Steps: string(track.Steps), Stamps: stamps})
+		}
+		sort.Slice(s.state.Tracks, func(i, j int) bool { return s.state.Tracks[i].ID < s.state.Tracks[j].ID })
+	}
+	s.render()
+
+	if err := s.sendState(); err != nil {
+		return nil, err
+	}
+	go s.receive()
+	go s.sync(cfg.syncInterval)
+
+	return s, nil
+}
+
+// Pattern returns the session's current copy of the pattern. It must be
+// treated as read-only.
+func (s *Session) Pattern() *drum.Pattern {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.pattern
+}
+
+// Changed returns a channel that receives a value when the pattern
+// changed since it last did, whoever edited it.
+func (s *Session) Changed() <-chan struct{} {
+	return s.changed
+}
+
+// Done returns a channel that is closed once the session ends, because
+// it was closed or its connection failed.
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err returns why the session ended, once Done is closed.
+func (s *Session) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.err
+}
+
+// Close leaves the session, closing its connection.
+func (s *Session) Close() error {
+	return s.conn.Close()
+}
+
+// SetStep turns a step of the track with the given ID on or off, and
+// tells the other clients.
+func (s *Session) SetStep(trackID, step int, on bool) error {
+	s.mu.Lock()
+	edit, err := s.setStepLocked(trackID, step, func(bool) bool { return on })
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return s.send(message{Step: edit})
+}
+
+// Toggle turns a step of the track with the given ID on if it is off
+// and off if it is on, and tells the other clients. Should another
+// client edit the step at the same time, both copies end up with the
+// one edit that wins rather than toggling twice.
+func (s *Session) Toggle(trackID, step int) error {
+	s.mu.Lock()
+	edit, err := s.setStepLocked(trackID, step, func(on bool) bool { return !on })
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return s.send(message{Step: edit})
+}
+
+// setStepLocked sets a step to what set returns given whether it is
+// on, and returns the edit to send. The caller must hold mu.
+func (s *Session) setStepLocked(trackID, step int, set func(on bool) bool) (*stepEdit, error) {
+	t := s.track(trackID)
+	if t == nil {
+		return nil, fmt.Errorf("pattern has no track with ID %d", trackID)
+	}
+	if step < 0 || step >= stepsPerTrack {
+		return nil, fmt.Errorf("step %d is out of range for track %d", step, trackID)
+	}
+
+	s.clock++
+	edit := &stepEdit{Track: trackID, Step: step, On: set(t.Steps[step] == 'x'), Stamp: stamp{Clock: s.clock, Origin: s.id}}
+	s.applyLocked(message{Step: edit})
+
+	return edit, nil
+}
+
+// SetTempo sets the tempo and tells the other clients.
+func (s *Session) SetTempo(tempo float32) error {
+	s.mu.Lock()
+	s.clock++
+	edit := &tempoEdit{Tempo: tempo, Stamp: stamp{Clock: s.clock, Origin: s.id}}
+	s.applyLocked(message{Tempo: edit})
+	s.mu.Unlock()
+
+	return s.send(message{Tempo: edit})
+}
+
+// receive applies the edits and copies the other clients send, and
+// sends ours to those that join, until the connection fails.
+func (s *Session) receive() {
+	err := func() error {
+		for {
+			b, err := s.conn.ReadMsg()
+			if err != nil {
+				return err
+			}
+			var event securecomm.BroadcastEvent
+			if err := event.UnmarshalBinary(b); err != nil {
+				return err
+			}
+
+			switch event.Type {
+			case securecomm.BroadcastJoin:
+				if err := s.sendState(); err != nil {
+					return err
+				}
+			case securecomm.BroadcastMessage:
+				// Other clients of the server may not be jamming.
+				var m message
+				if json.Unmarshal(event.Message, &m) != nil {
+					continue
+				}
+				s.mu.Lock()
+				s.applyLocked(m)
+				s.mu.Unlock()
+			}
+		}
+	}()
+
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+	close(s.done)
+}
+
+// sync sends our copy of the pattern every interval until the session
+// ends.
+func (s *Session) sync(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-t.C:
+			// A failed send means the connection failed, which
+			// receive reports.
+			if s.sendState() != nil {
+				return
+			}
+		}
+	}
+}
+
+// sendState sends our copy of the pattern.
+func (s *Session) sendState() error {
+	s.mu.Lock()
+	b, err := json.Marshal(message{State: &s.state})
+	s.mu.Unlock()
+	if err != nil {
+		return err
+	}
+
+	return s.conn.WriteMsg(b)
+}
+
+// send sends m.
+func (s *Session) send(m message) error {
+	b, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	return s.conn.WriteMsg(b)
+}
+
+// applyLocked merges m into our copy of the pattern. The caller must
+// hold mu.
+func (s *Session) applyLocked(m message) {
+	changed := false
+	if edit := m.Step; edit != nil {
+		changed = s.mergeStep(edit.Track, edit.Step, edit.On, edit.Stamp)
+	}
+	if edit := m.Tempo; edit != nil {
+		changed = s.mergeTempo(*edit) || changed
+	}
+	if m.State != nil {
+		if s.state.Version == "" && m.State.Version != "" {
+			s.state.Version = m.State.Version
+			changed = true
+		}
+		changed = s.mergeTempo(m.State.Tempo) || changed
+		for _, t := range m.State.Tracks {
+			if len(t.Steps) != stepsPerTrack || len(t.Stamps) != stepsPerTrack {
+				continue
+			}
+			if s.track(t.ID) == nil {
+				s.state.Tracks = append(s.state.Tracks, trackState{ID: t.ID, Name: t.Name, Steps: "----------------", Stamps: make([]stamp, stepsPerTrack)})
+				sort.Slice(s.state.Tracks, func(i, j int) bool { return s.state.Tracks[i].ID < s.state.Tracks[j].ID })
+				changed = true
+			}
+			for i := range t.Stamps {
+				changed = s.mergeStep(t.ID, i, t.Steps[i] == 'x', t.Stamps[i]) || changed
+			}
+		}
+	}
+
+	if changed {
+		s.render()
+	}
+}
+
+// mergeStep sets a step unless a later edit set it already, and reports
+// whether it changed. An edit of a track we do not have yet is dropped,
+// to arrive again with the next copy of its sender.
+func (s *Session) mergeStep(trackID, step int, on bool, st stamp) bool {
+	s.observe(st)
+	t := s.track(trackID)
+	if t == nil || step < 0 || step >= stepsPerTrack || !st.after(t.Stamps[step]) {
+		return false
+	}
+
+	steps := []byte(t.Steps)
+	steps[step] = '-'
+	if on {
+		steps[step] = 'x'
+	}
+	t.Stamps[step] = st
+	changed := string(steps) != t.Steps
+	t.Steps = string(steps)
+
+	return changed
+}
+
+// mergeTempo sets the tempo unless a later edit set it already, and
+// reports whether it changed.
+func (s *Session) mergeTempo(edit tempoEdit) bool {
+	s.observe(edit.Stamp)
+	if !edit.Stamp.after(s.state.Tempo.Stamp) {
+		return false
+	}
+
+	changed := edit.Tempo != s.state.Tempo.Tempo
+	s.state.Tempo = edit
+
+	return changed
+}
+
+// observe moves our clock past st, so that our next edit wins over the
+// edit st stamps.
+func (s *Session) observe(st stamp) {
+	if st.Clock > s.clock {
+		s.clock = st.Clock
+	}
+}
+
+// track returns the track with the given ID, or nil.
+func (s *Session) track(trackID int) *trackState {
+	for i := range s.state.Tracks {
+		if s.state.Tracks[i].ID == trackID {
+			return &s.state.Tracks[i]
+		}
+	}
+
+	return nil
+}
+
+// render rebuilds the pattern from our copy and signals the change.
+func (s *Session) render() {
+	tracks := make([]drum.Track, len(s.state.Tracks))
+	for i, t := range s.state.Tracks {
+		tracks[i] = drum.Track{ID: t.ID, Name: t.Name, Steps: []byte(t.Steps)}
+	}
+	// NewPattern only fails for tracks without 16 steps, which neither
+	// Join nor applyLocked lets into the state.
+	p, err := drum.NewPattern(s.state.Version, s.state.Tempo.Tempo, tracks...)
+	if err != nil {
+		panic(err)
+	}
+	s.pattern = p
+
+	select {
+	case s.changed <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,166 @@
+package jam
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securetest"
+)
+
+// join connects a new client to the broadcast server and joins the
+// session starting from p.
+func join(t *testing.T, ts *securetest.TestServer, p *drum.Pattern, opts ...Option) *Session {
+	t.Helper()
+
+	conn, err := ts.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := Join(conn, p, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+
+	return s
+}
+
+// converged waits until every session holds want, as rendered by
+// String.
+func converged(t *testing.T, want string, sessions ...*Session) {
+	t.Helper()
+
+	for _, s := range sessions {
+		deadline := time.After(5 * time.Second)
+		for s.Pattern().String() != want {
+			select {
+			case <-s.Changed():
+			case <-deadline:
+				t.Fatalf("Timed out waiting for\n%s\ngot\n%s", want, s.Pattern())
+			}
+		}
+	}
+}
+
+func fixture(t *testing.T) *drum.Pattern {
+	t.Helper()
+
+	p, err := drum.DecodeFile(filepath.Join("..", "..", "challenge1", "fixtures", "pattern_1.splice"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func TestJoinReceivesPattern(t *testing.T) {
+	ts := securetest.StartTestServer(t, securecomm.BroadcastHandler())
+	p := fixture(t)
+
+	host := join(t, ts, p)
+	guest := join(t, ts, nil)
+	converged(t, p.String(), host, guest)
+}
+
+func TestEditsFanOut(t *testing.T) {
+	ts := securetest.StartTestServer(t, securecomm.BroadcastHandler())
+	p := fixture(t)
+
+	a := join(t, ts, p)
+	b := join(t, ts, nil)
+	c := join(t, ts, nil)
+	converged(t, p.String(), a, b, c)
+
+	if err := b.Toggle(0, 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.SetTempo(128); err != nil {
+		t.Fatal(err)
+	}
+	p, err := p.WithStep(0, 1, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converged(t, p.WithTempo(128).String(), a, b, c)
+
+	if err := a.SetStep(99, 0, true); err == nil {
+		t.Error("Expected an edit of a missing track to fail")
+	}
+	if err := a.SetStep(0, 16, true); err == nil {
+		t.Error("Expected an edit of a missing step to fail")
+	}
+}
+
+func TestConcurrentEditsConverge(t *testing.T) {
+	ts := securetest.StartTestServer(t, securecomm.BroadcastHandler())
+	p := fixture(t)
+
+	a := join(t, ts, p)
+	b := join(t, ts, nil)
+	converged(t, p.String(), a, b)
+
+	// Both edit the same step before seeing the other's edit, which
+	// holding their locks keeps them from applying. Whichever wins, they
+	// must agree.
+	a.mu.Lock()
+	b.mu.Lock()
+	editA, errA := a.setStepLocked(1, 2, func(bool) bool { return true })
+	editB, errB := b.setStepLocked(1, 2, func(bool) bool { return false })
+	b.mu.Unlock()
+	a.mu.Unlock()
+	if errA != nil || errB != nil {
+		t.Fatal(errA, errB)
+	}
+	if err := a.send(message{Step: editA}); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.send(message{Step: editB}); err != nil {
+		t.Fatal(err)
+	}
+
+	want, err := p.WithStep(1, 2, a.id > b.id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converged(t, want.String(), a, b)
+}
+
+func TestPeriodicSyncRepairsMissedEdits(t *testing.T) {
+	ts := securetest.StartTestServer(t, securecomm.BroadcastHandler())
+	p := fixture(t)
+
+	a := join(t, ts, p, WithSyncInterval(20*time.Millisecond))
+	b := join(t, ts, nil, WithSyncInterval(20*time.Millisecond))
+	converged(t, p.String(), a, b)
+
+	// An edit b never hears of, as if its message were lost.
+	a.mu.Lock()
+	edit, err := a.setStepLocked(2, 3, func(on bool) bool { return !on })
+	a.mu.Unlock()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := p.WithStep(2, 3, edit.On)
+	if err != nil {
+		t.Fatal(err)
+	}
+	converged(t, want.String(), a, b)
+}
+
+func TestSessionEnds(t *testing.T) {
+	ts := securetest.StartTestServer(t, securecomm.BroadcastHandler())
+	s := join(t, ts, fixture(t))
+
+	s.Close()
+	select {
+	case <-s.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("Timed out waiting for the session to end")
+	}
+	if s.Err() == nil {
+		t.Fatal("Expected the session to report why it ended")
+	}
+}
@@ -0,0 +1,163 @@
+// Package patterns serves drum patterns over secure connections, so that
+// a directory of .splice files can be shared with only the peers that
+// hold an authorized key, and nobody on the path sees what they fetch.
+//
+// Each request is one message: LIST, or GET followed by a space and the
+// name of a pattern. Each response is one message: OK followed by a
+// newline and either the names of the patterns, one per line, or the
+// pattern in its .splice encoding; NOTFOUND for a pattern the server
+// does not hold; or ERR followed by a space and what went wrong.
+package patterns
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// ErrServer is returned by a Client when the server could not answer a
+// request. The error wraps it with the server's explanation.
+var ErrServer = errors.New("pattern server failed")
+
+// Response statuses.
+const (
+	statusOK       = "OK"
+	statusNotFound = "NOTFOUND"
+	statusError    = "ERR"
+)
+
+// Handler returns a securecomm.Handler answering requests for the
+// patterns in store until the client closes the connection.
+func Handler(store drum.Store) securecomm.Handler {
+	return func(ctx context.Context, conn *securecomm.SecureConn) error {
+		for {
+			request, err := conn.ReadMsg()
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+
+			if err := conn.WriteMsg(respond(store, string(request))); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// respond returns the response to request.
+func respond(store drum.Store, request string) []byte {
+	command, name, _ := strings.Cut(request, " ")
+	switch command {
+	case "LIST":
+		ids, err := store.List()
+		if err != nil {
+			return failure(err)
+		}
+		return []byte(statusOK + "\n" + strings.Join(ids, "\n"))
+	case "GET":
+		p, err := store.Get(name)
+		if errors.Is(err, drum.ErrPatternNotFound) {
+			return []byte(statusNotFound)
+		}
+		if err != nil {
+			return failure(err)
+		}
+
+		var b bytes.Buffer
+		b.WriteString(statusOK + "\n")
+		if _, err := p.WriteTo(&b); err != nil {
+			return failure(err)
+		}
+		return b.Bytes()
+	default:
+		return failure(fmt.Errorf("unknown request %q", command))
+	}
+}
+
+// failure returns the response reporting err.
+func failure(err error) []byte {
+	return []byte(statusError + " " + err.Error())
+}
+
+// A Client fetches patterns from a server over conn. It is safe to use
+// from several goroutines, which take turns at the connection.
+type Client struct {
+	mu   sync.Mutex
+	conn *securecomm.SecureConn
+}
+
+// NewClient returns a Client making its requests over conn.
+func NewClient(conn *securecomm.SecureConn) *Client {
+	return &Client{conn: conn}
+}
+
+// Close closes the connection to the server.
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+// List returns the names of the patterns the server holds, in sorted
+// order.
+func (c *Client) List() ([]string, error) {
+	body, err := c.roundTrip("LIST")
+	if err != nil {
+		return nil, fmt.Errorf("list patterns: %w", err)
+	}
+	if len(body) == 0 {
+		return nil, nil
+	}
+
+	return strings.Split(string(body), "\n"), nil
+}
+
+// Get fetches and decodes the pattern called name. It returns an error
+// wrapping drum.ErrPatternNotFound if the server holds no such pattern.
+func (c *Client) Get(name string) (*drum.Pattern, error) {
+	body, err := c.roundTrip("GET " + name)
+	if err != nil {
+		return nil, fmt.Errorf("get pattern %q: %w", name, err)
+	}
+
+	p := new(drum.Pattern)
+	if _, err := p.ReadFrom(bytes.NewReader(body)); err != nil {
+		return nil, fmt.Errorf("decode pattern %q: %w", name, err)
+	}
+
+	return p, nil
+}
+
+// roundTrip sends request and returns the body of a successful
+// response.
+func (c *Client) roundTrip(request string) ([]byte, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if err := c.conn.WriteMsg([]byte(request)); err != nil {
+		return nil, err
+	}
+	response, err := c.conn.ReadMsg()
+	if err != nil {
+		return nil, err
+	}
+
+	status, body, _ := bytes.Cut(response, []byte("\n"))
+	switch {
+	case string(status) == statusOK:
+		return body, nil
+	case string(status) == statusNotFound:
+		return nil, drum.ErrPatternNotFound
+	case bytes.HasPrefix(status, []byte(statusError+" ")):
+		return nil, fmt.Errorf("%w: %s", ErrServer, status[len(statusError)+1:])
+	default:
+		return nil, fmt.Errorf("malformed response %q", status)
+	}
+}
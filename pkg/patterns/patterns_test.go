@@ -0,0 +1,85 @@
+package patterns
+
+import (
+	"errors"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securetest"
+)
+
+// startServer serves the challenge1 fixtures and returns a Client of the
+// server, and the fixtures by name.
+func startServer(t *testing.T) (*Client, map[string]*drum.Pattern) {
+	t.Helper()
+
+	store, err := drum.NewFileStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fixtures := make(map[string]*drum.Pattern)
+	for _, name := range []string{"pattern_1", "pattern_2", "pattern_3"} {
+		p, err := drum.DecodeFile(filepath.Join("..", "..", "challenge1", "fixtures", name+".splice"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Put(name, p); err != nil {
+			t.Fatal(err)
+		}
+		fixtures[name] = p
+	}
+
+	ts := securetest.StartTestServer(t, Handler(store))
+	conn, err := ts.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+
+	return NewClient(conn), fixtures
+}
+
+func TestListAndGet(t *testing.T) {
+	client, fixtures := startServer(t)
+
+	names, err := client.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"pattern_1", "pattern_2", "pattern_3"}; !reflect.DeepEqual(names, want) {
+		t.Fatalf("Listed %q, expected %q", names, want)
+	}
+
+	for _, name := range names {
+		p, err := client.Get(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p.String() != fixtures[name].String() {
+			t.Errorf("Fetched %s as\n%s\nexpected\n%s", name, p, fixtures[name])
+		}
+	}
+}
+
+func TestGetMissing(t *testing.T) {
+	client, _ := startServer(t)
+
+	if _, err := client.Get("pattern_9"); !errors.Is(err, drum.ErrPatternNotFound) {
+		t.Fatalf("Expected ErrPatternNotFound, got %v", err)
+	}
+	// The connection is still good for further requests.
+	if _, err := client.Get("pattern_1"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestServerError(t *testing.T) {
+	client, _ := startServer(t)
+
+	if _, err := client.roundTrip("PUT pattern_1"); !errors.Is(err, ErrServer) || !strings.Contains(err.Error(), `unknown request "PUT"`) {
+		t.Fatalf("Expected ErrServer for an unknown request, got %v", err)
+	}
+}
@@ -0,0 +1,177 @@
+// Package playback sends drum patterns to be played on another machine
+// over secure connections.
+//
+// A client sends the pattern as a .splice file with
+// securecomm.SendFile, which the server keeps in its directory, then
+// one message: PLAY followed by a space and the number of bars to play.
+// The server answers OK once it starts playing, and DONE once it has
+// played them all, or ERR followed by a space and what went wrong.
+package playback
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// stepsPerBeat is the number of pattern steps in a beat: patterns hold
+// a bar of sixteenth notes.
+const stepsPerBeat = 4
+
+// ErrServer is returned by Send when the server could not play the
+// pattern. The error wraps it with the server's explanation.
+var ErrServer = errors.New("playback server failed")
+
+// Response statuses.
+const (
+	statusOK    = "OK"
+	statusDone  = "DONE"
+	statusError = "ERR"
+)
+
+// Play calls onStep with the number of each step of p and the tracks
+// that play on it as the step falls due at p's tempo, starting now, for
+// bars bars or until ctx is done.
+func Play(ctx context.Context, p *drum.Pattern, bars int, onStep func(step int, tracks []drum.Track)) error {
+	if !(p.Tempo > 0) {
+		return fmt.Errorf("cannot play at %v beats per minute", p.Tempo)
+	}
+	var steps int
+	for track := range p.Tracks() {
+		steps = max(steps, len(track.Steps))
+	}
+	if steps == 0 {
+		return errors.New("pattern has no steps to play")
+	}
+
+	step := time.Duration(float64(time.Minute) / float64(p.Tempo) / stepsPerBeat)
+	start := time.Now()
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	for n := 0; n < bars*steps; n++ {
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+
+		var playing []drum.Track
+		for track := range p.Tracks() {
+			if n%steps < len(track.Steps) && track.Steps[n%steps] == 'x' {
+				playing = append(playing, track)
+			}
+		}
+		onStep(n%steps, playing)
+
+		// Timed from the start, so that the steps do not drift.
+		timer.Reset(time.Until(start.Add(time.Duration(n+1) * step)))
+	}
+
+	return nil
+}
+
+// Handler returns a securecomm.Handler that receives patterns into dir
+// and plays them with Play, calling onStep for each step played of the
+// pattern called name. It serves one pattern after another until the
+// client closes the connection.
+func Handler(dir string, onStep func(name string, step int, tracks []drum.Track)) securecomm.Handler {
+	return func(ctx context.Context, conn *securecomm.SecureConn) error {
+		for {
+			manifest, err := securecomm.ReceiveFile(conn, dir, nil)
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			if err != nil {
+				return fmt.Errorf("receive pattern: %w", err)
+			}
+			if err := play(ctx, conn, filepath.Join(dir, manifest.Name), func(step int, tracks []drum.Track) {
+				onStep(manifest.Name, step, tracks)
+			}); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// play answers the PLAY request for the pattern at path.
+func play(ctx context.Context, conn *securecomm.SecureConn, path string, onStep func(step int, tracks []drum.Track)) error {
+	request, err := conn.ReadMsg()
+	if err != nil {
+		return fmt.Errorf("read request: %w", err)
+	}
+	bars, err := parsePlay(string(request))
+	if err != nil {
+		return conn.WriteMsg(failure(err))
+	}
+	p, err := drum.DecodeFile(path)
+	if err != nil {
+		return conn.WriteMsg(failure(err))
+	}
+
+	if err := conn.WriteMsg([]byte(statusOK)); err != nil {
+		return err
+	}
+	if err := Play(ctx, p, bars, onStep); err != nil {
+		return conn.WriteMsg(failure(err))
+	}
+
+	return conn.WriteMsg([]byte(statusDone))
+}
+
+// parsePlay returns the number of bars a PLAY request asks for.
+func parsePlay(request string) (int, error) {
+	command, arg, _ := strings.Cut(request, " ")
+	if command != "PLAY" {
+		return 0, fmt.Errorf("unknown request %q", command)
+	}
+	bars, err := strconv.Atoi(arg)
+	if err != nil || bars < 1 {
+		return 0, fmt.Errorf("bad number of bars %q", arg)
+	}
+
+	return bars, nil
+}
+
+// failure returns the response reporting err.
+func failure(err error) []byte {
+	return []byte(statusError + " " + err.Error())
+}
+
+// Send sends the pattern file at path to the server on conn and has it
+// played bars times over. started, if not nil, is called once the
+// server starts playing. Send returns once it has finished.
+func Send(conn *securecomm.SecureConn, path string, bars int, started func()) error {
+	if err := securecomm.SendFile(conn, path, nil); err != nil {
+		return fmt.Errorf("send pattern: %w", err)
+	}
+	if err := conn.WriteMsg([]byte("PLAY " + strconv.Itoa(bars))); err != nil {
+		return err
+	}
+
+	for _, want := range []string{statusOK, statusDone} {
+		response, err := conn.ReadMsg()
+		if err != nil {
+			return err
+		}
+		switch status := string(response); {
+		case status == want:
+		case strings.HasPrefix(status, statusError+" "):
+			return fmt.Errorf("%w: %s", ErrServer, status[len(statusError)+1:])
+		default:
+			return fmt.Errorf("unexpected response %q", status)
+		}
+		if want == statusOK && started != nil {
+			started()
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,153 @@
+package playback
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securetest"
+)
+
+// fast is a pattern quick enough to play through in a test: each of its
+// steps lasts 2.5ms.
+var fast = func() *drum.Pattern {
+	p, err := drum.NewPattern("test", 6000,
+		drum.Track{ID: 0, Name: "kick", Steps: []byte("x---x---x---x---")},
+		drum.Track{ID: 1, Name: "snare", Steps: []byte("----x-------x---")},
+	)
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}()
+
+// writePattern saves p in dir as name and returns its path.
+func writePattern(t *testing.T, dir, name string, p *drum.Pattern) string {
+	t.Helper()
+
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if _, err := p.WriteTo(f); err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func TestPlay(t *testing.T) {
+	var steps []string
+	start := time.Now()
+	err := Play(context.Background(), fast, 2, func(step int, tracks []drum.Track) {
+		var names []string
+		for _, track := range tracks {
+			names = append(names, track.Name)
+		}
+		steps = append(steps, strings.Join(names, "+"))
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(steps) != 32 {
+		t.Fatalf("expected 32 steps, got %d", len(steps))
+	}
+	if steps[0] != "kick" || steps[4] != "kick+snare" || steps[1] != "" || steps[16+12] != "kick+snare" {
+		t.Errorf("unexpected steps %q", steps)
+	}
+	if elapsed := time.Since(start); elapsed < 31*2500*time.Microsecond {
+		t.Errorf("played 32 steps in %v", elapsed)
+	}
+}
+
+func TestPlayStops(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var n int
+	err := Play(ctx, fast.WithTempo(60), 1, func(int, []drum.Track) {
+		n++
+		cancel()
+	})
+	if !errors.Is(err, context.Canceled) || n != 1 {
+		t.Errorf("expected to stop after one step with context.Canceled, got %d and %v", n, err)
+	}
+
+	empty, err := drum.NewPattern("test", 120)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Play(context.Background(), empty, 1, nil); err == nil {
+		t.Error("expected a pattern with no steps to fail")
+	}
+}
+
+func TestSend(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		names = map[string]int{}
+	)
+	dir := t.TempDir()
+	ts := securetest.StartTestServer(t, Handler(dir, func(name string, step int, tracks []drum.Track) {
+		mu.Lock()
+		names[name]++
+		mu.Unlock()
+	}))
+	conn, err := ts.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	src := t.TempDir()
+	var started bool
+	if err := Send(conn, writePattern(t, src, "fast.splice", fast), 2, func() { started = true }); err != nil {
+		t.Fatal(err)
+	}
+	if !started {
+		t.Error("expected to be told playing started")
+	}
+	// The same connection takes another pattern.
+	if err := Send(conn, writePattern(t, src, "again.splice", fast), 1, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if names["fast.splice"] != 32 || names["again.splice"] != 16 {
+		t.Errorf("unexpected steps played: %v", names)
+	}
+	mu.Unlock()
+
+	if _, err := os.Stat(filepath.Join(dir, "fast.splice")); err != nil {
+		t.Errorf("expected the server to keep the pattern: %v", err)
+	}
+}
+
+func TestSendFailure(t *testing.T) {
+	ts := securetest.StartTestServer(t, Handler(t.TempDir(), func(string, int, []drum.Track) {}))
+	conn, err := ts.Dial()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if err := Send(conn, writePattern(t, t.TempDir(), "fast.splice", fast), 0, nil); !errors.Is(err, ErrServer) {
+		t.Errorf("expected ErrServer for no bars, got %v", err)
+	}
+
+	path := filepath.Join(t.TempDir(), "bad.splice")
+	if err := os.WriteFile(path, []byte("not a pattern"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Send(conn, path, 1, nil); !errors.Is(err, ErrServer) {
+		t.Errorf("expected ErrServer for a bad pattern, got %v", err)
+	}
+}
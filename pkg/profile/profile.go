@@ -0,0 +1,264 @@
+// Package profile runs fixed workloads against the drum decoder and the
+// secure transport, and profiles them, so that their performance can be
+// compared from one release to the next. The workloads are the same
+// however often they run: the patterns decoded and the bytes sent are
+// generated from a fixed seed.
+package profile
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"runtime/pprof"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+// seed seeds the generators of the workloads' inputs.
+const seed = 1
+
+// A Workload is the work to profile. Setting it up is not profiled.
+type Workload interface {
+	// Name names the workload in its Result.
+	Name() string
+
+	// Setup prepares the workload in dir, a directory it may use for
+	// its files, and returns what to profile.
+	Setup(dir string) (run func() (Result, error), err error)
+}
+
+// Result is what a workload did and how long it took.
+type Result struct {
+	Name string
+
+	// Ops is how many operations the workload did, and Bytes how many
+	// bytes they took in.
+	Ops   int64
+	Bytes int64
+
+	Elapsed time.Duration
+
+	// Allocs and AllocBytes are the allocations the workload made.
+	Allocs     uint64
+	AllocBytes uint64
+}
+
+func (r Result) String() string {
+	return fmt.Sprintf("%s: %d ops, %d bytes in %s (%.0f ops/s, %.1f MB/s), %d allocs, %d bytes allocated",
+		r.Name, r.Ops, r.Bytes, r.Elapsed.Round(time.Millisecond), perSecond(float64(r.Ops), r.Elapsed),
+		perSecond(float64(r.Bytes)/1e6, r.Elapsed), r.Allocs, r.AllocBytes)
+}
+
+func perSecond(n float64, d time.Duration) float64 {
+	if d <= 0 {
+		return 0
+	}
+
+	return n / d.Seconds()
+}
+
+// Run sets w up in a temporary directory and runs it, writing a CPU
+// profile of the run to cpu and a heap profile taken after it to heap,
+// each if not nil.
+func Run(w Workload, cpu, heap io.Writer) (Result, error) {
+	dir, err := os.MkdirTemp("", "gomentor-profile-")
+	if err != nil {
+		return Result{}, err
+	}
+	defer os.RemoveAll(dir)
+
+	run, err := w.Setup(dir)
+	if err != nil {
+		return Result{}, fmt.Errorf("set up %s: %w", w.Name(), err)
+	}
+
+	if cpu != nil {
+		if err := pprof.StartCPUProfile(cpu); err != nil {
+			return Result{}, err
+		}
+	}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	start := time.Now()
+	r, err := run()
+	r.Elapsed = time.Since(start)
+	runtime.ReadMemStats(&after)
+	if cpu != nil {
+		pprof.StopCPUProfile()
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("run %s: %w", w.Name(), err)
+	}
+	r.Name = w.Name()
+	r.Allocs, r.AllocBytes = after.Mallocs-before.Mallocs, after.TotalAlloc-before.TotalAlloc
+
+	if heap != nil {
+		runtime.GC()
+		if err := pprof.WriteHeapProfile(heap); err != nil {
+			return Result{}, err
+		}
+	}
+
+	return r, nil
+}
+
+// Decode decodes Files pattern files with one drum.Decoder, as a server
+// indexing a library of them would.
+type Decode struct {
+	// Files is how many files to decode. Zero means 10000.
+	Files int
+}
+
+func (d Decode) Name() string {
+	return "decode"
+}
+
+// Setup writes the files to decode, each a pattern of a few tracks.
+func (d Decode) Setup(dir string) (func() (Result, error), error) {
+	files := d.Files
+	if files <= 0 {
+		files = 10000
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	paths := make([]string, files)
+	var size int64
+	for i := range paths {
+		paths[i] = filepath.Join(dir, fmt.Sprintf("pattern_%05d.splice", i))
+		n, err := writePattern(paths[i], randomPattern(rnd, i))
+		if err != nil {
+			return nil, err
+		}
+		size += n
+	}
+
+	return func() (Result, error) {
+		var decoder drum.Decoder
+		for _, path := range paths {
+			if _, err := decoder.DecodeFile(path); err != nil {
+				return Result{}, err
+			}
+		}
+
+		return Result{Ops: int64(len(paths)), Bytes: size}, nil
+	}, nil
+}
+
+// randomPattern returns the i'th pattern of the decode workload.
+func randomPattern(rnd *rand.Rand, i int) *drum.Pattern {
+	names := []string{"kick", "snare", "clap", "hh-open", "hh-close", "cowbell", "tom", "ride"}
+	tracks := make([]drum.Track, 1+rnd.Intn(len(names)))
+	for id := range tracks {
+		steps := make([]byte, 16)
+		for k := range steps {
+			steps[k] = '-'
+			if rnd.Intn(4) == 0 {
+				steps[k] = 'x'
+			}
+		}
+		tracks[id] = drum.Track{ID: id, Name: names[id], Steps: steps}
+	}
+
+	// NewPattern only fails for tracks without 16 steps.
+	p, err := drum.NewPattern(fmt.Sprintf("profile-%d", i), float32(60+rnd.Intn(120)), tracks...)
+	if err != nil {
+		panic(err)
+	}
+
+	return p
+}
+
+// writePattern saves p at path, returning the size of the file.
+func writePattern(path string, p *drum.Pattern) (int64, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return 0, err
+	}
+	n, err := p.WriteTo(f)
+	if err != nil {
+		f.Close()
+		return 0, err
+	}
+
+	return n, f.Close()
+}
+
+// transferChunkSize is how much the transfer workload writes at a time.
+const transferChunkSize = 64 * 1024
+
+// Transfer sends Size bytes over a secure connection to a server on
+// loopback, which reads and discards them, so that the profile is of
+// the transport and not of a disk.
+type Transfer struct {
+	// Size is how many bytes to send. Zero means 1GB.
+	Size int64
+
+	// Options configure both ends of the connection, such as the cipher
+	// suite.
+	Options []securecomm.Option
+}
+
+func (t Transfer) Name() string {
+	return "transfer"
+}
+
+// Setup starts the server and connects to it.
+func (t Transfer) Setup(dir string) (func() (Result, error), error) {
+	size := t.Size
+	if size <= 0 {
+		size = 1 << 30
+	}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	received := make(chan int64, 1)
+	quiet := securecomm.WithLogger(slog.New(slog.NewTextHandler(io.Discard, nil)))
+	go securecomm.Serve(l, func(ctx context.Context, conn *securecomm.SecureConn) error {
+		n, err := io.Copy(io.Discard, conn)
+		received <- n
+		return err
+	}, append([]securecomm.Option{quiet}, t.Options...)...)
+
+	conn, err := securecomm.Dial(l.Addr().String(), t.Options...)
+	if err != nil {
+		l.Close()
+		return nil, err
+	}
+	chunk := make([]byte, transferChunkSize)
+	rand.New(rand.NewSource(seed)).Read(chunk)
+
+	return func() (Result, error) {
+		defer l.Close()
+
+		var r Result
+		for r.Bytes < size {
+			n, err := conn.Write(chunk[:min(int64(len(chunk)), size-r.Bytes)])
+			r.Bytes += int64(n)
+			r.Ops++
+			if err != nil {
+				conn.Close()
+				return r, err
+			}
+		}
+		if err := conn.Close(); err != nil {
+			return r, err
+		}
+
+		// Wait for the server, so that the run covers decrypting too.
+		if n := <-received; n != size {
+			return r, fmt.Errorf("server received %d of %d bytes", n, size)
+		}
+
+		return r, nil
+	}, nil
+}
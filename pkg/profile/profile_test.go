@@ -0,0 +1,90 @@
+package profile
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+func TestRun(t *testing.T) {
+	for _, w := range []Workload{Decode{Files: 50}, Transfer{Size: 1<<20 + 123}} {
+		t.Run(w.Name(), func(t *testing.T) {
+			var cpu, heap bytes.Buffer
+			r, err := Run(w, &cpu, &heap)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Name != w.Name() || r.Ops == 0 || r.Bytes == 0 || r.Elapsed <= 0 {
+				t.Errorf("unexpected result %+v", r)
+			}
+			if cpu.Len() == 0 || heap.Len() == 0 {
+				t.Errorf("expected profiles, got %d and %d bytes", cpu.Len(), heap.Len())
+			}
+			if !strings.HasPrefix(r.String(), w.Name()+": ") {
+				t.Errorf("unexpected summary %q", r)
+			}
+		})
+	}
+}
+
+func TestDecodeIsReproducible(t *testing.T) {
+	first, err := Run(Decode{Files: 20}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, err := Run(Decode{Files: 20}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if first.Ops != 20 || first.Bytes != second.Bytes {
+		t.Errorf("expected the same 20 files each run, got %+v and %+v", first, second)
+	}
+}
+
+func TestTransferSize(t *testing.T) {
+	r, err := Run(Transfer{Size: 100, Options: []securecomm.Option{securecomm.WithCipherSuite(securecomm.CipherXChaCha20Poly1305)}}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.Bytes != 100 || r.Ops != 1 {
+		t.Errorf("expected one write of 100 bytes, got %+v", r)
+	}
+}
+
+// BenchmarkDecode and BenchmarkTransfer run the workloads the profile
+// command profiles, at sizes quick enough for go test -bench, so that
+// benchstat can compare them between releases.
+func BenchmarkDecode(b *testing.B) {
+	benchmark(b, Decode{Files: 1000})
+}
+
+func BenchmarkTransfer(b *testing.B) {
+	benchmark(b, Transfer{Size: 64 << 20})
+}
+
+func benchmark(b *testing.B, w Workload) {
+	run, err := w.Setup(b.TempDir())
+	if err != nil {
+		b.Fatal(err)
+	}
+	// Each run of a transfer uses up its connection, so only the
+	// first reuses the set up.
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if i > 0 {
+			b.StopTimer()
+			if run, err = w.Setup(b.TempDir()); err != nil {
+				b.Fatal(err)
+			}
+			b.StartTimer()
+		}
+		r, err := run()
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.SetBytes(r.Bytes)
+	}
+}
@@ -0,0 +1,93 @@
+package quicbridge
+
+import (
+	"bytes"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/jpreese/go-mentor/challenge2/pkg/securecomm"
+)
+
+func TestEcho(t *testing.T) {
+	l, err := Listen("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go securecomm.Serve(l, nil)
+
+	d := securecomm.Dialer{Transport: &Transport{}, HandshakeTimeout: 5 * time.Second}
+	for i := 0; i < 2; i++ {
+		conn, err := d.Dial(l.Addr().String())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		message := bytes.Repeat([]byte("over quic "), 1000)
+		if err := conn.WriteMsg(message); err != nil {
+			t.Fatal(err)
+		}
+		if echo, err := conn.ReadMsg(); err != nil || !bytes.Equal(echo, message) {
+			t.Fatalf("unexpected echo of %d bytes, %v", len(echo), err)
+		}
+
+		conn.Close()
+	}
+}
+
+func TestCloseWrite(t *testing.T) {
+	l, err := Listen("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go securecomm.Serve(l, nil)
+
+	d := securecomm.Dialer{Transport: &Transport{}, HandshakeTimeout: 5 * time.Second}
+	conn, err := d.Dial(l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	if _, err := conn.Write([]byte("last words")); err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.CloseWrite(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	var echo bytes.Buffer
+	if _, err := echo.ReadFrom(conn); err != nil {
+		t.Fatal(err)
+	}
+	if echo.String() != "last words" {
+		t.Errorf("unexpected echo %q", echo.String())
+	}
+}
+
+func TestListenerClose(t *testing.T) {
+	l, err := Listen("127.0.0.1:0", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	served := make(chan error, 1)
+	go func() { served <- securecomm.Serve(l, nil) }()
+
+	l.Close()
+	if _, err := l.Accept(); !errors.Is(err, net.ErrClosed) {
+		t.Errorf("expected net.ErrClosed after Close, got %v", err)
+	}
+
+	select {
+	case <-served:
+	case <-time.After(5 * time.Second):
+		t.Fatal("Serve did not return after the listener closed")
+	}
+}
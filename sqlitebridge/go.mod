@@ -0,0 +1,10 @@
+module github.com/jpreese/go-mentor/sqlitebridge
+
+go 1.23
+
+require (
+	github.com/jpreese/go-mentor/challenge1 v0.1.0
+	github.com/mattn/go-sqlite3 v1.14.22
+)
+
+require golang.org/x/text v0.21.0 // indirect
@@ -0,0 +1,138 @@
+// Package sqlitebridge keeps drum patterns in an SQLite database, as a
+// drum.Store for collections too large, or too often changed, to keep
+// as loose files:
+//
+//	store, err := sqlitebridge.Open("patterns.db")
+//	server := patterns.Handler(store)
+//
+// The database is driven by go-sqlite3, so building the package needs
+// cgo.
+package sqlitebridge
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS patterns (
+	id   TEXT PRIMARY KEY,
+	data BLOB NOT NULL
+)`
+
+// Store is a drum.Store keeping each pattern in its .splice encoding in
+// one row of an SQLite database.
+type Store struct {
+	db *sql.DB
+}
+
+var _ drum.Store = (*Store)(nil)
+
+// Open opens the SQLite database at path as a Store, creating it if it
+// does not exist. The path ":memory:" opens a private database held in
+// memory.
+func Open(path string) (*Store, error) {
+	db, err := sql.Open("sqlite3", path)
+	if err != nil {
+		return nil, fmt.Errorf("open store database: %w", err)
+	}
+
+	// Every connection to ":memory:" opens a database of its own.
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("create store table: %w", err)
+	}
+
+	return &Store{db: db}, nil
+}
+
+// Close closes the database.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Put encodes the pattern and stores it under the given ID, replacing
+// any pattern previously stored with that ID.
+func (s *Store) Put(id string, p *drum.Pattern) error {
+	if id == "" {
+		return fmt.Errorf("%w %q", drum.ErrInvalidPatternID, id)
+	}
+
+	var data bytes.Buffer
+	if _, err := p.WriteTo(&data); err != nil {
+		return fmt.Errorf("encode pattern %q: %w", id, err)
+	}
+
+	if _, err := s.db.Exec(`INSERT OR REPLACE INTO patterns (id, data) VALUES (?, ?)`, id, data.Bytes()); err != nil {
+		return fmt.Errorf("store pattern %q: %w", id, err)
+	}
+
+	return nil
+}
+
+// Get decodes the pattern stored under the given ID.
+func (s *Store) Get(id string) (*drum.Pattern, error) {
+	var data []byte
+	err := s.db.QueryRow(`SELECT data FROM patterns WHERE id = ?`, id).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("get pattern %q: %w", id, drum.ErrPatternNotFound)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get pattern %q: %w", id, err)
+	}
+
+	p, err := drum.DecodeBytes(data)
+	if err != nil {
+		return nil, fmt.Errorf("get pattern %q: %w", id, err)
+	}
+
+	return p, nil
+}
+
+// List returns the IDs of all stored patterns in sorted order.
+func (s *Store) List() ([]string, error) {
+	rows, err := s.db.Query(`SELECT id FROM patterns ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("list patterns: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("list patterns: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list patterns: %w", err)
+	}
+
+	return ids, nil
+}
+
+// Delete removes the pattern stored under the given ID.
+func (s *Store) Delete(id string) error {
+	result, err := s.db.Exec(`DELETE FROM patterns WHERE id = ?`, id)
+	if err != nil {
+		return fmt.Errorf("delete pattern %q: %w", id, err)
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("delete pattern %q: %w", id, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("delete pattern %q: %w", id, drum.ErrPatternNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,92 @@
+package sqlitebridge
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/jpreese/go-mentor/challenge1/pkg/drum"
+)
+
+func TestStore(t *testing.T) {
+	store, err := Open(":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	fixtures := []string{"pattern_1", "pattern_2", "pattern_3", "pattern_4", "pattern_5"}
+	for _, id := range fixtures {
+		decoded, err := drum.DecodeFile(path.Join("..", "challenge1", "fixtures", id+".splice"))
+		if err != nil {
+			t.Fatalf("decoding %s: %v", id, err)
+		}
+
+		if err := store.Put(id, decoded); err != nil {
+			t.Fatalf("storing %s: %v", id, err)
+		}
+
+		stored, err := store.Get(id)
+		if err != nil {
+			t.Fatalf("loading %s: %v", id, err)
+		}
+
+		if fmt.Sprint(stored) != fmt.Sprint(decoded) {
+			t.Errorf("%s did not round trip.\nGot:\n%s\nExpected:\n%s", id, stored, decoded)
+		}
+	}
+
+	ids, err := store.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(ids, fixtures) {
+		t.Errorf("unexpected ids: %v != %v", ids, fixtures)
+	}
+
+	if err := store.Delete("pattern_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get("pattern_1"); !errors.Is(err, drum.ErrPatternNotFound) {
+		t.Errorf("expected ErrPatternNotFound after delete, got %v", err)
+	}
+	if err := store.Delete("pattern_1"); !errors.Is(err, drum.ErrPatternNotFound) {
+		t.Errorf("expected ErrPatternNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestStorePersists(t *testing.T) {
+	db := filepath.Join(t.TempDir(), "patterns.db")
+
+	store, err := Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := drum.NewPattern("0.808-alpha", 120, drum.Track{ID: 1, Name: "kick", Steps: []byte("x---x---x---x---")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Put("beat", want); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = Open(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	got, err := store.Get("beat")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("reopened store returned\n%s\nexpected\n%s", got, want)
+	}
+}
@@ -0,0 +1,21 @@
+package testutil
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+)
+
+func TestCopiesUpToDate(t *testing.T) {
+	if _, err := os.Stat("../challenge1"); err != nil {
+		t.Skip("the challenges are not beside this module")
+	}
+	goTool, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command to run gen.go with")
+	}
+
+	if out, err := exec.Command(goTool, "run", "gen.go", "-check").CombinedOutput(); err != nil {
+		t.Errorf("the challenges' copies of the package have drifted: %v\n%s", err, out)
+	}
+}
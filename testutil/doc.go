@@ -0,0 +1,11 @@
+// Package testutil holds the test scaffolding the challenges share:
+// fixtures and the golden files their decoding is checked against, for
+// the drum and torrent decoders, and key pairs and loopback listeners,
+// for the secure channel.
+//
+// The challenge modules each keep a copy of the files their tests use
+// under internal/testutil, generated from this package, so that they
+// depend on no other module.
+package testutil
+
+//go:generate go run gen.go
@@ -0,0 +1,21 @@
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Fixture returns the contents of the fixture at the path elem joins
+// to, failing the test if it cannot be read.
+func Fixture(t testing.TB, elem ...string) []byte {
+	t.Helper()
+
+	path := filepath.Join(elem...)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading fixture %s: %v", path, err)
+	}
+
+	return data
+}
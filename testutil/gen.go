@@ -0,0 +1,123 @@
+//go:build ignore
+
+// Gen writes the copies of this package that the challenge modules keep
+// under internal/testutil, each holding the files its tests use alone.
+// Run it with go generate. With -check it writes nothing and fails if a
+// copy has drifted from this package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// copies are the challenges that keep a copy, what their scaffolding is
+// for, and the files of this package it is made of.
+var copies = []struct {
+	dir, doc string
+	files    []string
+}{
+	{
+		"../challenge1/internal/testutil",
+		"the drum decoder: fixtures and the golden files their decoding is checked against",
+		[]string{"fixture.go", "golden.go", "golden_test.go"},
+	},
+	{
+		"../challenge2/internal/testutil",
+		"the secure channel: key pairs and loopback listeners",
+		[]string{"keys.go", "keys_test.go", "net.go", "net_test.go"},
+	},
+	{
+		"../challenge4/internal/testutil",
+		"the torrent decoder: fixtures and the golden files their decoding is checked against",
+		[]string{"fixture.go", "golden.go", "golden_test.go"},
+	},
+}
+
+const notice = "// Code generated by gen.go from %s; DO NOT EDIT.\n\n"
+
+func main() {
+	log.SetFlags(0)
+	check := flag.Bool("check", false, "report copies that differ from this package instead of writing them")
+	flag.Parse()
+
+	stale := false
+	for _, c := range copies {
+		want := map[string][]byte{"doc.go": doc(c.doc)}
+		for _, name := range c.files {
+			src, err := os.ReadFile(name)
+			if err != nil {
+				log.Fatal(err)
+			}
+			want[name] = append([]byte(fmt.Sprintf(notice, name)), src...)
+		}
+
+		// Files the copy no longer takes from this package go too.
+		have, err := filepath.Glob(filepath.Join(c.dir, "*.go"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, path := range have {
+			if _, ok := want[filepath.Base(path)]; ok {
+				continue
+			}
+			if *check {
+				log.Printf("%s is not part of this package", path)
+				stale = true
+				continue
+			}
+			if err := os.Remove(path); err != nil {
+				log.Fatal(err)
+			}
+		}
+
+		for name, out := range want {
+			path := filepath.Join(c.dir, name)
+			if *check {
+				if old, err := os.ReadFile(path); err != nil || !bytes.Equal(old, out) {
+					log.Printf("%s is out of date with this package", path)
+					stale = true
+				}
+				continue
+			}
+			if err := os.WriteFile(path, out, 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if stale {
+		log.Fatal("run go generate in the testutil module")
+	}
+}
+
+// doc returns the doc.go of a copy whose scaffolding is for what.
+func doc(what string) []byte {
+	text := "Package testutil holds the test scaffolding of " + what + ". It is " +
+		"the part of github.com/jpreese/go-mentor/testutil that this module's " +
+		"tests use, kept here so that the module depends on no other in the " +
+		"repository."
+
+	return []byte("// Code generated by gen.go; DO NOT EDIT.\n\n" + wrap(text) + "package testutil\n")
+}
+
+// wrap wraps text into lines of comment no longer than 72 columns.
+func wrap(text string) string {
+	var b strings.Builder
+	line := "//"
+	for _, word := range strings.Fields(text) {
+		if len(line)+1+len(word) > 72 {
+			b.WriteString(line + "\n")
+			line = "//"
+		}
+		line += " " + word
+	}
+	b.WriteString(line + "\n")
+
+	return b.String()
+}
@@ -0,0 +1,89 @@
+package testutil
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite .golden files with the current output")
+
+// DecodeFunc decodes the fixture found at path.
+type DecodeFunc func(path string) (interface{}, error)
+
+// GoldenFixtures decodes every fixture matching glob and compares the
+// result's String() output against <fixture>.golden and its JSON
+// encoding against <fixture>.json.golden, both stored next to the
+// fixture. Run the tests with -update to rewrite the golden files from
+// the current output.
+func GoldenFixtures(t *testing.T, glob string, decode DecodeFunc) {
+	t.Helper()
+
+	paths, err := filepath.Glob(glob)
+	if err != nil {
+		t.Fatalf("invalid fixture glob %q: %v", glob, err)
+	}
+	if len(paths) == 0 {
+		t.Fatalf("no fixtures match %q", glob)
+	}
+
+	for _, path := range paths {
+		path := path
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			decoded, err := decode(path)
+			if err != nil {
+				t.Fatalf("decoding %s: %v", path, err)
+			}
+
+			base := strings.TrimSuffix(path, filepath.Ext(path))
+			GoldenString(t, base+".golden", fmt.Sprint(decoded))
+			GoldenJSON(t, base+".json.golden", decoded)
+		})
+	}
+}
+
+// GoldenString compares got against the contents of the golden file.
+func GoldenString(t testing.TB, golden string, got string) {
+	t.Helper()
+	Golden(t, golden, []byte(got))
+}
+
+// GoldenJSON compares the indented JSON encoding of v against the
+// contents of the golden file.
+func GoldenJSON(t testing.TB, golden string, v interface{}) {
+	t.Helper()
+
+	got, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		t.Fatalf("encoding %T as JSON: %v", v, err)
+	}
+
+	Golden(t, golden, append(got, '\n'))
+}
+
+// Golden compares got against the contents of the golden file, or
+// rewrites the golden file when the -update flag is set.
+func Golden(t testing.TB, golden string, got []byte) {
+	t.Helper()
+
+	if *update {
+		if err := os.WriteFile(golden, got, 0644); err != nil {
+			t.Fatalf("updating %s: %v", golden, err)
+		}
+		return
+	}
+
+	expected, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("reading %s (run with -update to create it): %v", golden, err)
+	}
+
+	if !bytes.Equal(got, expected) {
+		t.Errorf("output does not match %s.\nGot:\n%s\nExpected:\n%s", golden, got, expected)
+	}
+}
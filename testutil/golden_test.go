@@ -0,0 +1,19 @@
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestGolden(t *testing.T) {
+	golden := filepath.Join(t.TempDir(), "out.golden")
+	if err := os.WriteFile(golden, []byte("{\n  \"A\": 1\n}\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	GoldenJSON(t, golden, struct{ A int }{1})
+	if got := Fixture(t, golden); string(got) != "{\n  \"A\": 1\n}\n" {
+		t.Fatalf("Fixture returned %q", got)
+	}
+}
@@ -0,0 +1,24 @@
+package testutil
+
+import (
+	"crypto/ecdh"
+	"crypto/rand"
+	"testing"
+)
+
+// KeyPair generates a Curve25519 key pair of the kind NaCl box and the
+// secure channel use, failing the test if it cannot.
+func KeyPair(t testing.TB) (public, private *[32]byte) {
+	t.Helper()
+
+	key, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating key pair: %v", err)
+	}
+
+	public, private = new([32]byte), new([32]byte)
+	copy(public[:], key.PublicKey().Bytes())
+	copy(private[:], key.Bytes())
+
+	return public, private
+}
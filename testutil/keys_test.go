@@ -0,0 +1,20 @@
+package testutil
+
+import (
+	"crypto/ecdh"
+	"testing"
+)
+
+func TestKeyPair(t *testing.T) {
+	public, private := KeyPair(t)
+	key, err := ecdh.X25519().NewPrivateKey(private[:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(key.PublicKey().Bytes()) != string(public[:]) {
+		t.Fatal("Expected the public key to belong to the private key")
+	}
+	if other, _ := KeyPair(t); *other == *public {
+		t.Fatal("Expected a new key pair each time")
+	}
+}
@@ -0,0 +1,20 @@
+package testutil
+
+import (
+	"net"
+	"testing"
+)
+
+// Listen listens on a free TCP port of the loopback interface until the
+// test ends, failing the test if it cannot.
+func Listen(t testing.TB) net.Listener {
+	t.Helper()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listening on loopback: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+
+	return l
+}
@@ -0,0 +1,15 @@
+package testutil
+
+import (
+	"net"
+	"testing"
+)
+
+func TestListen(t *testing.T) {
+	l := Listen(t)
+	conn, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
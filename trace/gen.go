@@ -0,0 +1,77 @@
+//go:build ignore
+
+// Gen writes the copies of this package that the challenge modules keep
+// under internal/trace, from trace.go and its tests. Run it with go
+// generate. With -check it writes nothing and fails if a copy has
+// drifted from this package.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// dirs are where the challenges keep their copies.
+var dirs = []string{
+	"../challenge1/internal/trace",
+	"../challenge2/internal/trace",
+}
+
+const notice = "// Code generated by gen.go from %s; DO NOT EDIT.\n\n"
+
+// copyDoc takes the place of the paragraph of the package doc that
+// starts with "The challenge modules".
+const copyDoc = `// This is the copy of github.com/jpreese/go-mentor/trace that this
+// module keeps, so that it depends on no other in the repository. Span
+// and Attribute alias unnamed types, so they are the types of every
+// copy, and a Tracer written against any copy, such as otelbridge's,
+// serves here too.
+`
+
+func main() {
+	log.SetFlags(0)
+	check := flag.Bool("check", false, "report copies that differ from this package instead of writing them")
+	flag.Parse()
+
+	stale := false
+	for _, name := range []string{"trace.go", "trace_test.go"} {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			log.Fatal(err)
+		}
+		out := generate(string(src), name)
+
+		for _, dir := range dirs {
+			path := filepath.Join(dir, name)
+			if *check {
+				if old, err := os.ReadFile(path); err != nil || !bytes.Equal(old, out) {
+					log.Printf("%s is out of date with %s", path, name)
+					stale = true
+				}
+				continue
+			}
+			if err := os.WriteFile(path, out, 0644); err != nil {
+				log.Fatal(err)
+			}
+		}
+	}
+
+	if stale {
+		log.Fatal("run go generate in the trace module")
+	}
+}
+
+// generate returns the copy of src, the file called name.
+func generate(src, name string) []byte {
+	if i := strings.Index(src, "// The challenge modules"); i >= 0 {
+		j := strings.Index(src, "package trace\n")
+		src = src[:i] + copyDoc + src[j:]
+	}
+	src = strings.Replace(src, "//go:generate go run gen.go\n\n", "", 1)
+
+	return []byte(strings.Replace(notice, "%s", name, 1) + src)
+}
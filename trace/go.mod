@@ -0,0 +1,3 @@
+module github.com/jpreese/go-mentor/trace
+
+go 1.21
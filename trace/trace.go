@@ -0,0 +1,141 @@
+// Package trace is the tracing interface the challenges record spans
+// through, so that the drum decoder and the secure transport can take
+// part in the traces of the services that embed them without depending
+// on any tracing library. The otelbridge module adapts OpenTelemetry to
+// it; Recorder keeps spans in memory for tests.
+//
+// The challenge modules each keep a copy of this package under
+// internal/trace, generated from this one, so that they depend on no
+// other module. Span and Attribute are aliases of unnamed types rather
+// than types of their own so that every copy declares the very same
+// types: a Tracer written against this package, such as otelbridge's,
+// is a Tracer of every copy.
+package trace
+
+//go:generate go run gen.go
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// A Tracer starts spans. Implementations must be safe for concurrent
+// use.
+type Tracer interface {
+	// Start starts a span called name, as a child of the span in ctx if
+	// there is one, and returns a context holding the new span.
+	Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span)
+}
+
+// A Span is an operation being traced.
+type Span = interface {
+	// SetAttributes adds attributes to the span, replacing those with
+	// the same keys.
+	SetAttributes(attrs ...Attribute)
+
+	// End ends the span, marking it failed with err if it is not nil.
+	End(err error)
+}
+
+// An Attribute describes a span. Value is a string, int64 or bool.
+type Attribute = struct {
+	Key   string
+	Value any
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int64) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Recorder is a Tracer that keeps the spans it starts in memory, for
+// tests. The zero Recorder is ready to use.
+type Recorder struct {
+	mu    sync.Mutex
+	spans []*RecordedSpan
+}
+
+// RecordedSpan is a span a Recorder started.
+type RecordedSpan struct {
+	Name string
+
+	// Parent is the span it was started under, or nil.
+	Parent *RecordedSpan
+
+	StartTime, EndTime time.Time
+	Err                error
+
+	rec   *Recorder
+	attrs map[string]any
+	ended bool
+}
+
+type spanKey struct{}
+
+// Start starts a span and records it.
+func (r *Recorder) Start(ctx context.Context, name string, attrs ...Attribute) (context.Context, Span) {
+	parent, _ := ctx.Value(spanKey{}).(*RecordedSpan)
+	s := &RecordedSpan{Name: name, Parent: parent, StartTime: time.Now(), rec: r, attrs: make(map[string]any)}
+	s.SetAttributes(attrs...)
+
+	r.mu.Lock()
+	r.spans = append(r.spans, s)
+	r.mu.Unlock()
+
+	return context.WithValue(ctx, spanKey{}, s), s
+}
+
+// Spans returns the spans that have ended, in the order they were
+// started.
+func (r *Recorder) Spans() []*RecordedSpan {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var ended []*RecordedSpan
+	for _, s := range r.spans {
+		if s.ended {
+			ended = append(ended, s)
+		}
+	}
+
+	return ended
+}
+
+// SetAttributes adds attributes to the span.
+func (s *RecordedSpan) SetAttributes(attrs ...Attribute) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+
+	for _, a := range attrs {
+		s.attrs[a.Key] = a.Value
+	}
+}
+
+// End ends the span.
+func (s *RecordedSpan) End(err error) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+
+	s.EndTime, s.Err, s.ended = time.Now(), err, true
+}
+
+// Attr returns the value of the attribute called key, and whether the
+// span has one.
+func (s *RecordedSpan) Attr(key string) (any, bool) {
+	s.rec.mu.Lock()
+	defer s.rec.mu.Unlock()
+
+	v, ok := s.attrs[key]
+	return v, ok
+}